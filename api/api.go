@@ -0,0 +1,217 @@
+package api
+
+import (
+	"io"
+
+	"github.com/Jaskaranbir/es-bank-account/domain"
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/profile"
+	"github.com/Jaskaranbir/es-bank-account/trace"
+)
+
+// Version is version of this package's API. Major version
+// is only incremented for incompatible changes, and minor
+// version for additions.
+const Version = "1.2.0"
+
+// ================== Messaging ==================
+
+// Bus publishes messages to their subscribers.
+type Bus = eventutil.Bus
+
+// MemoryBusCfg is config for in-memory Bus.
+type MemoryBusCfg = eventutil.MemoryBusCfg
+
+// NewMemoryBus creates in-memory Bus with provided config.
+func NewMemoryBus(cfg *MemoryBusCfg) (Bus, error) {
+	return eventutil.NewMemoryBusWithCfg(cfg)
+}
+
+// Event is an event stored by aggregates.
+type Event = model.Event
+
+// ================== Event-Sourcing ==================
+
+// EventStore stores events of aggregates.
+type EventStore = eventutil.EventStore
+
+// EventReader is read-only view of events in an EventRepo.
+type EventReader = eventutil.EventReader
+
+// EventRepo stores events, and publishes these on Bus.
+type EventRepo = eventutil.EventRepo
+
+// StoreStatsProvider is implemented by event-repos
+// and event-stores which can report their size.
+type StoreStatsProvider = eventutil.StoreStatsProvider
+
+// StoreStats are stats of an EventStore.
+type StoreStats = eventutil.EventStoreStats
+
+// AggregateStats are stats of an aggregate in StoreStats.
+type AggregateStats = eventutil.AggregateStats
+
+// NewMemoryEventStore creates in-memory EventStore.
+func NewMemoryEventStore() EventStore {
+	return eventutil.NewMemoryEventStore()
+}
+
+// ExportEvents writes all events of store as NDJSON.
+func ExportEvents(store EventStore, w io.Writer) error {
+	return eventutil.ExportNDJSON(store, w)
+}
+
+// ImportEvents inserts events written by #ExportEvents into store.
+func ImportEvents(store EventStore, r io.Reader) error {
+	return eventutil.ImportNDJSON(store, r)
+}
+
+// MigrationReport is result of migrating events.
+type MigrationReport = eventutil.MigrationReport
+
+// MigrationFailure is an event which couldn't be migrated.
+type MigrationFailure = eventutil.MigrationFailure
+
+// MigrateAccountEvents copies all events of src to dst, in order,
+// rewriting account-states of older schema-versions to current
+// one. Migration is aborted once more than errorBudget events
+// fail migration (negative for no limit).
+func MigrateAccountEvents(src EventStore, dst EventStore, errorBudget int) (*MigrationReport, error) {
+	return eventutil.MigrateEventsWithBudget(
+		src,
+		dst,
+		account.StateMigrator(model.AccountDeposited, model.AccountWithdrawn),
+		errorBudget,
+	)
+}
+
+// ================== Transactions ==================
+
+// Transaction is a validated transaction, as processed by accounts.
+type Transaction = model.Transaction
+
+// CreateTxnReq is a transaction-request, as read from input.
+type CreateTxnReq = txn.CreateTxnReq
+
+// FailureCode classifies why a transaction-request is invalid.
+type FailureCode = txn.FailureCode
+
+// ================== Ingestion-Profiles ==================
+
+// Profile is a named bundle of ingestion-settings
+// for input of an upstream partner.
+type Profile = profile.Profile
+
+// ProfileSettings are ingestion-settings of a Profile.
+type ProfileSettings = profile.Settings
+
+// LoadProfile loads and validates Profile from JSON or
+// YAML file, decided by file's extension.
+func LoadProfile(path string) (*Profile, error) {
+	return profile.Load(path)
+}
+
+// LoadNamedProfile loads Profile with name from dir,
+// from "<name>.json", "<name>.yaml" or "<name>.yml".
+func LoadNamedProfile(dir string, name string) (*Profile, error) {
+	return profile.LoadNamed(dir, name)
+}
+
+// ================== Results ==================
+
+// TxnResultViewRepo stores results of transactions.
+type TxnResultViewRepo = accountview.TxnResultViewRepo
+
+// TxnResultEntry is result of a transaction in TxnResultViewRepo.
+type TxnResultEntry = accountview.TxnResultEntry
+
+// TxnResultCounts are numbers of results in TxnResultViewRepo.
+type TxnResultCounts = accountview.TxnResultCounts
+
+// OpeningBalance is opening-balance of an account.
+type OpeningBalance = account.OpeningBalance
+
+// BalanceDrift is a customer whose balance, replayed
+// from account's events, differs from published balance.
+type BalanceDrift = account.BalanceDrift
+
+// ================== Running ==================
+
+// RoutinesCfg is config of pipeline's routines, see BuildRoutinesCfg.
+type RoutinesCfg = domain.RoutinesCfg
+
+// RunSummary summarizes a run of RunRoutines.
+type RunSummary = domain.RunSummary
+
+// ProcessingSummary is written to summary-file along with report.
+type ProcessingSummary = domain.ProcessingSummary
+
+// RunError is returned by RunRoutines if routines returned errors.
+type RunError = domain.RunError
+
+// EmptyRunError is returned by RunRoutines if run is flagged as empty.
+type EmptyRunError = domain.EmptyRunError
+
+// EmptyRunReason describes why run was flagged as empty.
+type EmptyRunReason = domain.EmptyRunReason
+
+// Reasons for EmptyRunError.
+const (
+	EmptyInput    = domain.EmptyInput
+	ZeroValidTxns = domain.ZeroValidTxns
+)
+
+// DeprecatedUseError is returned by RunRoutines if
+// deprecated features listed in RoutinesCfg are used.
+type DeprecatedUseError = domain.DeprecatedUseError
+
+// RunRoutines runs pipeline's routines with provided config.
+// Summary is returned even if routines returned errors.
+func RunRoutines(cfg *RoutinesCfg) (*RunSummary, error) {
+	return domain.RunRoutines(cfg)
+}
+
+// ================== Validation ==================
+
+// ValidateCfg is config for ValidateInput.
+type ValidateCfg = domain.ValidateCfg
+
+// ValidationReport is returned by ValidateInput.
+type ValidationReport = domain.ValidationReport
+
+// ValidateInput validates transaction-requests in
+// input, without running pipeline.
+func ValidateInput(r io.Reader, cfg ValidateCfg) (*ValidationReport, error) {
+	return domain.ValidateInput(r, cfg)
+}
+
+// ReadOpeningBalancesCSV parses opening-balances from CSV, with
+// as-of times parsed using timeFmt. Seed the parsed balances
+// with Pipeline#SeedOpeningBalances.
+func ReadOpeningBalancesCSV(r io.Reader, timeFmt string) ([]OpeningBalance, error) {
+	return reader.ReadOpeningBalancesCSV(r, timeFmt)
+}
+
+// ================== Observability ==================
+
+// Logger is logger used by pipeline's components.
+type Logger = logger.Logger
+
+// NewStdLogger creates Logger writing to stdout,
+// with its entries prefixed by provided prefix.
+func NewStdLogger(prefix string) Logger {
+	return logger.NewStdLogger(prefix)
+}
+
+// Metrics instruments pipeline's components.
+type Metrics = metrics.Metrics
+
+// Tracer records spans of processing every transaction.
+type Tracer = trace.Tracer
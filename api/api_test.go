@@ -0,0 +1,280 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/api"
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/usageview"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Signatures of API, which must only change along with
+// major version. These fail compilation if changed.
+var (
+	_ func(*api.PipelineCfg) (*api.RoutinesCfg, error)                = api.BuildRoutinesCfg
+	_ func(*api.PipelineCfg) (*api.Pipeline, error)                   = api.NewPipeline
+	_ func(*api.RoutinesCfg) (*api.RunSummary, error)                 = api.RunRoutines
+	_ func(*api.MemoryBusCfg) (api.Bus, error)                        = api.NewMemoryBus
+	_ func() api.EventStore                                           = api.NewMemoryEventStore
+	_ func(io.Reader, api.ValidateCfg) (*api.ValidationReport, error) = api.ValidateInput
+	_ func(io.Reader, string) ([]api.OpeningBalance, error)           = api.ReadOpeningBalancesCSV
+	_ func(string) (*api.Profile, error)                              = api.LoadProfile
+	_ func(string, string) (*api.Profile, error)                      = api.LoadNamedProfile
+
+	_ func(*api.Pipeline) (*api.RunSummary, error)    = (*api.Pipeline).Run
+	_ func(*api.Pipeline) api.EventReader             = (*api.Pipeline).AccountEvents
+	_ func(*api.Pipeline, []api.OpeningBalance) error = (*api.Pipeline).SeedOpeningBalances
+	_ func(*api.Pipeline) ([]api.BalanceDrift, error) = (*api.Pipeline).CheckBalanceDrift
+	_ func(*api.Pipeline, int) (api.StoreStats, bool) = (*api.Pipeline).StoreStats
+
+	_ api.EventReader = api.EventRepo(nil)
+	_ error           = &api.RunError{}
+	_ error           = &api.EmptyRunError{}
+	_ error           = &api.DeprecatedUseError{}
+)
+
+const testInput = `{"id":"1","customer_id":"1","load_amount":"$100.00","time":"2000-01-01T00:00:00Z"}
+{"id":"2","customer_id":"1","load_amount":"$6000.00","time":"2000-01-01T01:00:00Z"}
+{"id":"3","customer_id":"2","load_amount":"$20.00","time":"2000-01-02T00:00:00Z"}
+`
+
+func TestBuildRoutinesCfg(t *testing.T) {
+	output := &bytes.Buffer{}
+	cfg, err := api.BuildRoutinesCfg(&api.PipelineCfg{
+		Input:  strings.NewReader(testInput),
+		Output: output,
+	})
+	if err != nil {
+		t.Fatalf("error building routines-config: %s", err)
+	}
+	cfg.ProcessMgrCfg.IdleTimeoutSec = 1
+
+	summary, err := api.RunRoutines(cfg)
+	if err != nil {
+		t.Fatalf("error running routines: %s", err)
+	}
+	if summary == nil {
+		t.Fatal("expected run-summary")
+	}
+
+	accepted := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		entry := api.TxnResultEntry{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("error unmarshalling result %q: %s", line, err)
+		}
+		accepted[entry.ID] = entry.Accepted
+	}
+	expected := map[string]bool{"1": true, "2": false, "3": true}
+	if len(accepted) != len(expected) {
+		t.Fatalf("expected results %v, got %v", expected, accepted)
+	}
+	for id, isAccepted := range expected {
+		if accepted[id] != isAccepted {
+			t.Errorf("expected txn %q accepted to be %t, got %t", id, isAccepted, accepted[id])
+		}
+	}
+}
+
+func TestPipelineDeliversControlMsgsFirst(t *testing.T) {
+	cfg, err := api.BuildRoutinesCfg(&api.PipelineCfg{
+		Input:  strings.NewReader(testInput),
+		Output: &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatalf("error building routines-config: %s", err)
+	}
+	// Stalled consumer of transactions and report, whose
+	// messages stay queued until routines return.
+	bus, ok := cfg.ProcessMgrCfg.Bus.(eventutil.GroupSubscriber)
+	if !ok {
+		t.Fatal("expected bus of pipeline to support group-subscriptions")
+	}
+	consumer, err := bus.SubscribeGroup([]string{model.TxnRead.String(), model.WriteData.String()})
+	if err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+
+	// Idle-timeout only expires once every transaction has a result
+	fakeClock := clock.NewFakeClock(time.Now())
+	cfg.ProcessMgrCfg.Clock = fakeClock
+	runErr := make(chan error, 1)
+	go func() {
+		_, err := api.RunRoutines(cfg)
+		runErr <- err
+	}()
+	timeout := time.After(10 * time.Second)
+	for isDone := false; !isDone; {
+		select {
+		case err := <-runErr:
+			if err != nil {
+				t.Fatalf("error running routines: %s", err)
+			}
+			isDone = true
+		case <-timeout:
+			t.Fatal("timed-out waiting for routines to return")
+		case <-time.After(10 * time.Millisecond):
+			if cfg.ProcessMgrCfg.TxnResultViewRepo.Index() >= 3 {
+				fakeClock.Advance(time.Duration(cfg.ProcessMgrCfg.IdleTimeoutSec) * time.Second)
+			}
+		}
+	}
+
+	expected := []string{
+		model.WriteData.String(),
+		model.TxnRead.String(), model.TxnRead.String(), model.TxnRead.String(),
+	}
+	for i, expectAction := range expected {
+		select {
+		case msg := <-consumer:
+			var action string
+			var priority int
+			switch v := msg.(type) {
+			case model.Cmd:
+				action, priority = v.Action().String(), v.Priority()
+			case model.Event:
+				action, priority = v.Action().String(), v.Priority()
+			}
+			if action != expectAction {
+				t.Fatalf("expected message %d of action %s, got: %s", i, expectAction, action)
+			}
+			if action == model.WriteData.String() && priority != model.PriorityControl {
+				t.Fatalf("expected %s to have control-priority, got: %d", action, priority)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed-out waiting for message %d", i)
+		}
+	}
+}
+
+func TestBuildRoutinesCfgValidation(t *testing.T) {
+	_, err := api.BuildRoutinesCfg(&api.PipelineCfg{
+		Output: &bytes.Buffer{},
+	})
+	if err == nil {
+		t.Error("expected error for missing input")
+	}
+
+	_, err = api.NewPipeline(&api.PipelineCfg{
+		Input:        strings.NewReader(testInput),
+		Output:       &bytes.Buffer{},
+		ShardOutputs: []io.Writer{&bytes.Buffer{}},
+	})
+	if err == nil {
+		t.Error("expected error for shard-outputs not matching configured shards")
+	}
+}
+
+func TestBuildRoutinesCfgWithProfile(t *testing.T) {
+	ingestionProfile, err := api.LoadNamedProfile("../_samples/profiles", "eur-lax")
+	if err != nil {
+		t.Fatalf("error loading profile: %s", err)
+	}
+
+	output := &bytes.Buffer{}
+	cfg, err := api.BuildRoutinesCfg(&api.PipelineCfg{
+		Input: strings.NewReader("ref,account,amount,epoch\n" +
+			"1,001,€10.125,946893600\n" +
+			"2,001,€0,946897200\n"),
+		Output:  output,
+		Profile: ingestionProfile,
+		// Takes precedence over profile's "allow"
+		ProfileOverrides: &api.ProfileSettings{ZeroAmountPolicy: "reject"},
+	})
+	if err != nil {
+		t.Fatalf("error building routines-config: %s", err)
+	}
+	cfg.ProcessMgrCfg.IdleTimeoutSec = 1
+
+	_, err = api.RunRoutines(cfg)
+	if err != nil {
+		t.Fatalf("error running routines: %s", err)
+	}
+	expected := `{"id":"1","customer_id":"1","accepted":true}`
+	if strings.TrimSpace(output.String()) != expected {
+		t.Fatalf("expected output %s, got %s", expected, output.String())
+	}
+
+	_, err = api.BuildRoutinesCfg(&api.PipelineCfg{
+		Input:   strings.NewReader(""),
+		Output:  &bytes.Buffer{},
+		Profile: &api.Profile{Name: "invalid", Settings: api.ProfileSettings{Format: "xml"}},
+	})
+	if err == nil {
+		t.Error("expected error for invalid profile")
+	}
+}
+
+func TestPipelineSeedOpeningBalances(t *testing.T) {
+	pipeline, err := api.NewPipeline(&api.PipelineCfg{
+		Input:  strings.NewReader(""),
+		Output: &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatalf("error creating pipeline: %s", err)
+	}
+
+	balances, err := api.ReadOpeningBalancesCSV(
+		strings.NewReader("1,$50.00,2000-01-01T00:00:00Z\n"),
+		time.RFC3339,
+	)
+	if err != nil {
+		t.Fatalf("error reading opening-balances: %s", err)
+	}
+	err = pipeline.SeedOpeningBalances(balances)
+	if err != nil {
+		t.Fatalf("error seeding opening-balances: %s", err)
+	}
+
+	events, err := pipeline.AccountEvents().Fetch("1")
+	if err != nil {
+		t.Fatalf("error fetching account-events: %s", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 seeded event, got %d", len(events))
+	}
+}
+
+func TestPipelineServesUsage(t *testing.T) {
+	queries := http.NewServeMux()
+	cfg, err := api.BuildRoutinesCfg(&api.PipelineCfg{
+		Input:   strings.NewReader(testInput),
+		Output:  &bytes.Buffer{},
+		Queries: queries,
+	})
+	if err != nil {
+		t.Fatalf("error building routines-config: %s", err)
+	}
+	cfg.ProcessMgrCfg.IdleTimeoutSec = 1
+	_, err = api.RunRoutines(cfg)
+	if err != nil {
+		t.Fatalf("error running routines: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	queries.ServeHTTP(recorder, httptest.NewRequest(
+		http.MethodGet, "/usage/1?from=2000-01-01T00:00:00Z&to=2000-01-02T00:00:00Z", nil,
+	))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	records := make([]usageview.DatedRecord, 0)
+	err = json.Unmarshal(recorder.Body.Bytes(), &records)
+	if err != nil {
+		t.Fatalf("error unmarshalling usage: %s", err)
+	}
+	// Declined transaction doesn't add usage
+	if len(records) != 1 || records[0].Record.NumTxns != 1 || records[0].Record.TotalAmount != 100 {
+		t.Fatalf("expected usage of single transaction, got %+v", records)
+	}
+}
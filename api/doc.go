@@ -0,0 +1,18 @@
+// Package api is the stable Go API of the application, for
+// programs embedding the pipeline instead of running it as
+// a binary.
+//
+// Types and functions exported here follow semantic versioning
+// (see Version): within a major version, these are only added
+// to, and existing ones keep their signatures and behavior.
+// Most are aliases of types in internal packages (such as
+// eventutil, or domain/account), which remain free to change
+// otherwise. Programs should import this package instead of
+// internal packages, whose exported identifiers not re-exported
+// here have no compatibility guarantees.
+//
+// Pipeline is the facade running the application's pipeline,
+// wired as configured in package config. BuildRoutinesCfg
+// returns the same wiring as a RoutinesCfg, which can be
+// adjusted before it's run with RunRoutines.
+package api
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
+	"github.com/Jaskaranbir/es-bank-account/domain"
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/usageview"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
+	"github.com/Jaskaranbir/es-bank-account/trace"
+)
+
+// ServeMetrics serves Prometheus-metrics on addr in background,
+// until context is done, along with queries from provided handler
+// (see PipelineCfg#Queries). Returns Metrics to instrument pipeline
+// with, which are no-op if addr is blank.
+func ServeMetrics(ctx context.Context, addr string, queries http.Handler) (Metrics, error) {
+	if addr == "" {
+		return metrics.Noop{}, nil
+	}
+
+	promMetrics, err := metrics.NewPrometheus(&metrics.PrometheusCfg{})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating prometheus-metrics")
+	}
+	_, err = metrics.Serve(ctx, &metrics.ServerCfg{
+		Log:     logger.NewStdLogger("metrics"),
+		Addr:    addr,
+		Handler: promMetrics.Handler(),
+		Routes: map[string]http.Handler{
+			account.StatePath:        queries,
+			eventutil.StoreStatsPath: queries,
+			deprecation.Path:         queries,
+			domain.DiagnosticsPath:   queries,
+			usageview.UsagePath:      queries,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error serving metrics")
+	}
+	return promMetrics, nil
+}
+
+// NewFileTracer returns Tracer writing spans to file at
+// path, and func flushing and closing the file once spans
+// are ended (such as after pipeline is run).
+func NewFileTracer(path string) (Tracer, func() error, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating trace-file")
+	}
+	buffWriter := bufio.NewWriter(file)
+	exporter, err := trace.NewFileExporter(buffWriter, nil)
+	if err != nil {
+		file.Close()
+		return nil, nil, errors.Wrap(err, "error creating trace-exporter")
+	}
+
+	closeFile := func() error {
+		err := exporter.Err()
+		if err == nil {
+			err = errors.Wrap(buffWriter.Flush(), "error flushing trace-file")
+		}
+		closeErr := file.Close()
+		if err != nil {
+			return err
+		}
+		return errors.Wrap(closeErr, "error closing trace-file")
+	}
+	return exporter, closeFile, nil
+}
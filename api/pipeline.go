@@ -0,0 +1,736 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	// Bucket-timezone of config is loaded by its
+	// IANA-name, which isn't available on every system.
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	globalcfg "github.com/Jaskaranbir/es-bank-account/config"
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
+	"github.com/Jaskaranbir/es-bank-account/domain"
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/anomaly"
+	"github.com/Jaskaranbir/es-bank-account/domain/progress"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain/usageview"
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/profile"
+	"github.com/Jaskaranbir/es-bank-account/projection"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
+)
+
+// PipelineCfg is config for Pipeline and BuildRoutinesCfg.
+// Settings not set here (such as account-limits) are
+// read from package config.
+type PipelineCfg struct {
+	// Transaction-requests, one per line
+	Input  io.Reader `validate:"nonnil"`
+	Output io.Writer `validate:"nonnil"`
+	// Optional, outputs of output-shards, one for
+	// every shard (see config.OutputShards).
+	ShardOutputs []io.Writer
+	// Optional, defaults to no-op metrics.
+	Metrics Metrics
+	// Optional, records span of processing every transaction.
+	Tracer Tracer
+	// Optional, handlers of queries (such as of account-state)
+	// are registered here, see ServeMetrics for serving these.
+	Queries *http.ServeMux
+	// Optional, messages left unprocessed by a
+	// previous run, republished before input is read.
+	RecoveryInput io.Reader
+	// Optional, messages left unprocessed by this run are
+	// written here once run ends, such as when it's aborted.
+	RecoveryOutput io.Writer
+	// Optional, ingestion-profile of input's partner
+	// (see LoadNamedProfile), with its settings taking
+	// precedence over ones in package config.
+	Profile *Profile
+	// Optional, settings taking precedence over ones of
+	// Profile. A notice is logged for every setting which
+	// conflicts with Profile.
+	ProfileOverrides *ProfileSettings
+}
+
+// BuildRoutinesCfg returns config of pipeline's routines, wired
+// same as Pipeline. Components communicate on a new in-memory
+// Bus, and store their events in memory. Returned config can
+// be adjusted before it's run with RunRoutines.
+func BuildRoutinesCfg(cfg *PipelineCfg) (*RoutinesCfg, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+	if len(cfg.ShardOutputs) != globalcfg.OutputShards {
+		return nil, fmt.Errorf(
+			"expected %d shard-output(s), got %d",
+			globalcfg.OutputShards, len(cfg.ShardOutputs),
+		)
+	}
+	appMetrics := cfg.Metrics
+	if appMetrics == nil {
+		appMetrics = metrics.Noop{}
+	}
+
+	// ================== Ingestion-Profile ==================
+	profileLog := logger.NewStdLogger("profile")
+	if cfg.Profile != nil {
+		err = cfg.Profile.Validate()
+		if err != nil {
+			return nil, errors.Wrap(err, "error validating ingestion-profile")
+		}
+		profileLog.Infof("Applying ingestion-profile: %s", cfg.Profile.Name)
+	}
+	ingestion := profile.Resolve(cfg.Profile, cfg.ProfileOverrides, profileLog)
+	err = ingestion.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating ingestion-settings")
+	}
+	excludeTestTxns := globalcfg.ExcludeTestTxns
+	if ingestion.ExcludeTestTxns != nil {
+		excludeTestTxns = *ingestion.ExcludeTestTxns
+	}
+
+	// Shared by components raising warnings,
+	// which are included in run-summary.
+	runWarnings := warnings.NewMemoryCollector(globalcfg.WarningDetailsPerCode)
+
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		Log:      logger.NewStdLogger("EventBus"),
+		Metrics:  appMetrics,
+		Warnings: runWarnings,
+
+		NoSubscribersWarnInterval: globalcfg.BusNoSubscribersWarnIntervalSec * time.Second,
+		MaxTerminateDrains:        globalcfg.BusMaxTerminateDrains,
+		// Control-messages, such as writing report and its
+		// confirmation, skip ahead of backlogged transactions.
+		PriorityDelivery: true,
+		// Unprocessed messages are written to recovery-output
+		RetainDrained: cfg.RecoveryOutput != nil,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating memory-bus")
+	}
+
+	// Shared between process-manager and command-listeners,
+	// so commands published after draining are rejected.
+	flowEpoch := eventutil.NewFlowEpoch()
+
+	// ================== Account ==================
+	accountCfg, err := accountRunCfg(bus, flowEpoch, appMetrics)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating account-config")
+	}
+	accountEventRepo := accountCfg.AccountCfg.EventRepo
+	if cfg.Queries != nil {
+		cfg.Queries.Handle(account.StatePath, account.NewStateHandler(
+			logger.NewStdLogger("account/StateHandler"),
+			accountEventRepo,
+			*accountCfg.AccountCfg,
+		))
+		cfg.Queries.Handle(deprecation.Path, deprecation.NewHandler(logger.NewStdLogger("deprecation/Handler")))
+	}
+	if statsRepo, ok := accountEventRepo.(eventutil.StoreStatsProvider); ok {
+		if cfg.Queries != nil {
+			cfg.Queries.Handle(eventutil.StoreStatsPath, eventutil.NewStoreStatsHandler(
+				logger.NewStdLogger("eventutil/StoreStatsHandler"),
+				statsRepo,
+				globalcfg.StoreStatsTopN,
+			))
+		}
+		appMetrics.SetStoreStats(func() (int, int) {
+			stats := statsRepo.StoreStats(0)
+			return stats.Events, stats.Aggregates
+		})
+	}
+
+	// ================== TxnResultView ==================
+	// Shared with process-manager, which notes
+	// quarantined events in report.
+	quarantine := accountview.NewEventQuarantine()
+	accountViewCfg := accountViewRunCfg(bus, accountEventRepo, quarantine, excludeTestTxns, appMetrics)
+	if cfg.Queries != nil {
+		// Usage-view is hydrated along with transaction-result
+		// view, with same days/weeks as account's limits.
+		usageRepo := usageview.NewMemoryUsageViewRepo(accountCfg.AccountCfg.BucketLocation)
+		accountViewCfg.Coordinator, err = usageViewCoordinator(accountEventRepo, usageRepo)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating usage-view")
+		}
+		cfg.Queries.Handle(usageview.UsagePath, usageview.NewUsageHandler(
+			logger.NewStdLogger("usageView/UsageHandler"),
+			usageRepo,
+		))
+	}
+
+	// ================== TxnCreator ==================
+	txnCreatorCfg, err := txnCreatorRunCfg(bus, flowEpoch)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating transaction-creator config")
+	}
+	ingestion.ApplyCreator(txnCreatorCfg.CreatorCfg)
+
+	// ================== Process-Manager ==================
+	processMgrCfg := processMgrRunCfg(bus, flowEpoch, accountViewCfg.ResultViewCfg.ResultRepo)
+	processMgrCfg.Quarantine = quarantine
+	if globalcfg.ReportWarnings {
+		processMgrCfg.ReportWarnings = runWarnings
+	}
+	// Skipped transactions are accounted for by view and
+	// process-manager, only if txn-creator skips these.
+	if txnCreatorCfg.CreatorCfg.ZeroAmountPolicy == txn.ZeroAmountSkip {
+		txnCreatorCfg.CreatorCfg.TxnSkipped = model.TxnSkipped
+		accountViewCfg.TxnSkipped = model.TxnSkipped
+		processMgrCfg.TxnSkipped = model.TxnSkipped
+	}
+
+	// ================== Reader ==================
+	readerCfg := &reader.Cfg{
+		Log:        logger.NewStdLogger("reader"),
+		Bus:        bus,
+		Reader:     cfg.Input,
+		DataRead:   model.TxnRead,
+		ReadFailed: model.TxnReadFailed,
+		Metrics:    appMetrics,
+		Warnings:   runWarnings,
+		Encoding:   reader.Encoding(globalcfg.InputEncoding),
+	}
+	ingestion.ApplyReader(readerCfg)
+	if globalcfg.PreSortInput {
+		readerCfg.PreSortKey = domain.NewTxnSortKeyFunc(txnCreatorCfg.CreatorCfg.DefaultTimeFmt)
+		processMgrCfg.OrderedDispatch = true
+	}
+
+	// ================== Writer ==================
+	writerCfg, err := writerRunCfg(bus, cfg.Output)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating writer-config")
+	}
+
+	// ================== Output-Shards ==================
+	shardWriterCfgs := make([]*writer.CmdListenerCfg, 0, len(cfg.ShardOutputs))
+	for shard, shardOutput := range cfg.ShardOutputs {
+		shardWriterCfg, err := shardWriterRunCfg(bus, shard, shardOutput)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating writer-config of output-shard %d", shard)
+		}
+		shardWriterCfgs = append(shardWriterCfgs, shardWriterCfg)
+		processMgrCfg.ShardWriteData = append(processMgrCfg.ShardWriteData, shardWriterCfg.WriteData)
+	}
+
+	// ================== Rejection-Monitor ==================
+	var anomalyCfg *anomaly.EventListenerCfg
+	if globalcfg.RejectionAnomalyWindowSize > 0 {
+		anomalyCfg, err = anomalyRunCfg(bus)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating rejection-monitor config")
+		}
+	}
+
+	// ================== Tracing ==================
+	if cfg.Tracer != nil {
+		readerCfg.Tracer = cfg.Tracer
+		txnCreatorCfg.CreatorCfg.Tracer = cfg.Tracer
+		accountCfg.AccountCfg.Tracer = cfg.Tracer
+		accountViewCfg.ResultViewCfg.Tracer = cfg.Tracer
+		processMgrCfg.Tracer = cfg.Tracer
+		writerCfg.WriterCfg.Tracer = cfg.Tracer
+	}
+
+	// ================== Recovery ==================
+	var recoveryCfg *domain.RecoveryCfg
+	if cfg.RecoveryInput != nil || cfg.RecoveryOutput != nil {
+		recoveryCfg = &domain.RecoveryCfg{
+			Bus:    bus,
+			Input:  cfg.RecoveryInput,
+			Output: cfg.RecoveryOutput,
+		}
+	}
+
+	var progressCfg *progress.Cfg
+	if globalcfg.ProgressIntervalSec > 0 {
+		progressCfg = &progress.Cfg{
+			IntervalSec: globalcfg.ProgressIntervalSec,
+		}
+	}
+
+	routinesCfg := &domain.RoutinesCfg{
+		Log:              logger.NewStdLogger("runner"),
+		ReaderCfg:        readerCfg,
+		TxnCreatorCfg:    txnCreatorCfg,
+		AccountCfg:       accountCfg,
+		AccountViewCfg:   accountViewCfg,
+		ProcessMgrCfg:    processMgrCfg,
+		WriterCfg:        writerCfg,
+		ShardWriterCfgs:  shardWriterCfgs,
+		AnomalyCfg:       anomalyCfg,
+		FailFast:         true,
+		WiringCheck:      domain.WiringCheck(globalcfg.WiringCheck),
+		Recovery:         recoveryCfg,
+		Progress:         progressCfg,
+		FailOnDeprecated: globalcfg.FailOnDeprecated,
+		Warnings:         runWarnings,
+		DiagnosticsCfg: &domain.DiagnosticsCfg{
+			Log:               logger.NewStdLogger("diagnostics"),
+			Bus:               bus,
+			DumpDiagnostics:   model.DumpDiagnostics,
+			DiagnosticsDumped: model.DiagnosticsDumped,
+		},
+	}
+	if cfg.Queries != nil {
+		cfg.Queries.Handle(domain.DiagnosticsPath, domain.NewDiagnosticsHandler(
+			logger.NewStdLogger("diagnostics/Handler"),
+			routinesCfg,
+		))
+	}
+	return routinesCfg, nil
+}
+
+// Pipeline runs the application's pipeline, reading
+// transaction-requests from input and writing their
+// results to output. Use #NewPipeline to create new
+// instance, which can be run once.
+type Pipeline struct {
+	routinesCfg *RoutinesCfg
+}
+
+// NewPipeline validates config, and creates
+// new instance of Pipeline (see BuildRoutinesCfg).
+func NewPipeline(cfg *PipelineCfg) (*Pipeline, error) {
+	routinesCfg, err := BuildRoutinesCfg(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{
+		routinesCfg: routinesCfg,
+	}, nil
+}
+
+// Run runs pipeline until its input is processed
+// and report is written. Summary is returned even
+// if run failed.
+func (p *Pipeline) Run() (*RunSummary, error) {
+	return domain.RunRoutines(p.routinesCfg)
+}
+
+// AccountEvents returns events stored by accounts.
+func (p *Pipeline) AccountEvents() EventReader {
+	return p.routinesCfg.AccountCfg.AccountCfg.EventRepo
+}
+
+// SeedOpeningBalances seeds accounts with opening-balances,
+// which must be done before pipeline is run.
+func (p *Pipeline) SeedOpeningBalances(balances []OpeningBalance) error {
+	return account.SeedOpeningBalances(
+		p.routinesCfg.AccountCfg.AccountCfg.EventRepo,
+		balances,
+		&account.SeedOpts{
+			AccountSeeded: model.AccountSeeded,
+			AllowNegative: globalcfg.AllowNegativeOpeningBalances,
+		},
+	)
+}
+
+// CheckBalanceDrift returns customers whose balance, replayed
+// from account's events, differs from published balance.
+func (p *Pipeline) CheckBalanceDrift() ([]BalanceDrift, error) {
+	return account.CheckBalanceDrift(p.routinesCfg.AccountCfg.AccountCfg, nil)
+}
+
+// StoreStats returns stats of account's event-store, with topN
+// aggregates by number of events. Returns false if event-store
+// doesn't provide stats.
+func (p *Pipeline) StoreStats(topN int) (StoreStats, bool) {
+	statsRepo, ok := p.routinesCfg.AccountCfg.AccountCfg.EventRepo.(eventutil.StoreStatsProvider)
+	if !ok {
+		return StoreStats{}, false
+	}
+	return statsRepo.StoreStats(topN), true
+}
+
+func accountRunCfg(
+	bus eventutil.Bus,
+	flowEpoch *eventutil.FlowEpoch,
+	appMetrics metrics.Metrics,
+) (*account.CmdListenerCfg, error) {
+	// Transaction-IDs are indexed, so loading accounts
+	// only decodes events relevant to their limits.
+	extractTxnID, err := account.NewTxnIDExtractor(&account.TxnIDExtractorCfg{
+		AccountDeposited:     model.AccountDeposited,
+		AccountWithdrawn:     model.AccountWithdrawn,
+		AccountLimitExceeded: model.AccountLimitExceeded,
+		AccountSeeded:        model.AccountSeeded,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating transaction-id extractor")
+	}
+	accountEventStore, err := eventutil.NewMemoryEventStoreWithTxnIDs(extractTxnID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating event-store for account")
+	}
+	accountEventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+		Bus:            bus,
+		EventStore:     accountEventStore,
+		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		Source:         globalcfg.EventSource,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating event-repo for account")
+	}
+	bucketLocation, err := time.LoadLocation(globalcfg.BucketTimezone)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading bucket-timezone")
+	}
+
+	return &account.CmdListenerCfg{
+		Log: logger.NewStdLogger("account/CmdListener"),
+
+		Bus:             bus,
+		ProcessTxnCmd:   model.ProcessTxn,
+		UpdateLimitsCmd: model.UpdateLimits,
+		QueryStateCmd:   model.QueryState,
+		StateQueried:    model.StateQueried,
+		QueryBalanceCmd: model.QueryBalance,
+		BalanceQueried:  model.BalanceQueried,
+		FlowEpoch:       flowEpoch,
+		Metrics:         appMetrics,
+		Stats:           &eventutil.ComponentStats{},
+		ActorMode:       globalcfg.AccountActorMode,
+
+		AccountCfg: &account.AggregateCfg{
+			Log:       logger.NewStdLogger("account/Aggregate"),
+			EventRepo: accountEventRepo,
+
+			DailyTxnsAmountLimit:  globalcfg.DailyTxnsAmountLimit,
+			NumDailyTxnsLimit:     globalcfg.NumDailyTxnsLimit,
+			WeeklyTxnsAmountLimit: globalcfg.WeeklyTxnsAmountLimit,
+			NumWeeklyTxnsLimit:    globalcfg.NumWeeklyTxnsLimit,
+			CategoryLimits:        categoryLimits(),
+			BucketLocation:        bucketLocation,
+			MonthlyAllowance:      globalcfg.MonthlyAllowance,
+			MaxCarryOver:          globalcfg.MaxCarryOver,
+
+			DuplicateScope:     globalcfg.DuplicateScope,
+			GlobalTxnIDs:       globalcfg.GlobalTxnIDs,
+			RejectStaleTxns:    globalcfg.RejectStaleTxns,
+			VerboseLimitErrors: globalcfg.VerboseLimitErrors,
+			LimitDetails:       globalcfg.LimitDetails,
+
+			ExcludeZeroAmountTxnCounts: globalcfg.ExcludeZeroAmountTxnCounts,
+			EventTimeFromTxn:           globalcfg.EventTimeFromTxn,
+			PartialWithdrawal:          globalcfg.PartialWithdrawal,
+
+			AccountDeposited:     model.AccountDeposited,
+			AccountWithdrawn:     model.AccountWithdrawn,
+			DuplicateTxn:         model.DuplicateTxn,
+			AccountLimitExceeded: model.AccountLimitExceeded,
+			AccountSeeded:        model.AccountSeeded,
+			AccountRecovered:     model.AccountRecovered,
+			PartiallyWithdrawn:   model.PartialWithdrawal,
+		},
+	}, nil
+}
+
+// categoryLimits returns category-limits of config
+// as limits of account, keyed by category.
+func categoryLimits() map[string]account.Limits {
+	limits := make(map[string]account.Limits, len(globalcfg.CategoryLimits))
+	for category, limit := range globalcfg.CategoryLimits {
+		limits[category] = account.Limits{
+			DailyTxnsAmountLimit:  limit.DailyTxnsAmountLimit,
+			NumDailyTxnsLimit:     limit.NumDailyTxnsLimit,
+			WeeklyTxnsAmountLimit: limit.WeeklyTxnsAmountLimit,
+			NumWeeklyTxnsLimit:    limit.NumWeeklyTxnsLimit,
+		}
+	}
+	return limits
+}
+
+func accountViewRunCfg(
+	bus eventutil.Bus,
+	accountEventRepo eventutil.EventRepo,
+	quarantine *accountview.EventQuarantine,
+	excludeTestTxns bool,
+	appMetrics metrics.Metrics,
+) *accountview.EventListenerCfg {
+	txnResultViewRepo := accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{
+		ExcludeTestTxns: excludeTestTxns,
+	})
+	var failureMessages *account.FailureMessages
+	if globalcfg.VerboseDeclineReasons {
+		failureMessages = account.DefaultFailureMessages()
+	}
+	var resultClock clock.Clock
+	if globalcfg.ResultProcessedAt {
+		resultClock = clock.RealClock{}
+	}
+	var onResults func([]accountview.TxnResultEntry) error
+	if globalcfg.StreamResults {
+		onResults = domain.NewResultStreamer(bus, model.WriteData)
+	}
+
+	return &accountview.EventListenerCfg{
+		Log: logger.NewStdLogger("accountView/EventListener"),
+
+		Bus:                  bus,
+		AccountDeposited:     model.AccountDeposited,
+		AccountWithdrawn:     model.AccountWithdrawn,
+		DuplicateTxn:         model.DuplicateTxn,
+		AccountLimitExceeded: model.AccountLimitExceeded,
+		RebuildCustomerCmd:   model.RebuildCustomer,
+
+		ResultViewCfg: &accountview.TxnResultViewCfg{
+			Log:        logger.NewStdLogger("accountView/TxnResultView"),
+			ResultRepo: txnResultViewRepo,
+			// To fetch events from Account-aggregate
+			EventRepo: accountEventRepo,
+			Metrics:   appMetrics,
+
+			AccountDeposited:     model.AccountDeposited,
+			AccountWithdrawn:     model.AccountWithdrawn,
+			DuplicateTxn:         model.DuplicateTxn,
+			AccountLimitExceeded: model.AccountLimitExceeded,
+			AccountSeeded:        model.AccountSeeded,
+			AccountRecovered:     model.AccountRecovered,
+			PartiallyWithdrawn:   model.PartialWithdrawal,
+
+			StrictHydration: globalcfg.StrictHydration,
+			Quarantine:      quarantine,
+			FailureMessages: failureMessages,
+			Clock:           resultClock,
+		},
+		BulkCatchUp: globalcfg.ViewBulkCatchUp,
+		OnResults:   onResults,
+	}
+}
+
+// usageViewCoordinator returns projection-coordinator with
+// usage-view registered, to hydrate transaction-result view
+// along with usage-view. Coordinator halts on errors, same as
+// default coordinator of transaction-result view.
+func usageViewCoordinator(
+	accountEventRepo eventutil.EventRepo,
+	usageRepo usageview.UsageViewRepo,
+) (*projection.Coordinator, error) {
+	coordinator, err := projection.NewCoordinator(&projection.CoordinatorCfg{
+		Log:           logger.NewStdLogger("accountView/Coordinator"),
+		EventRepo:     accountEventRepo,
+		FailurePolicy: projection.FailurePolicyHalt,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating projection-coordinator")
+	}
+	usageView, err := usageview.NewUsageView(&usageview.UsageViewCfg{
+		Log:       logger.NewStdLogger("usageView/UsageView"),
+		UsageRepo: usageRepo,
+
+		AccountDeposited: model.AccountDeposited,
+		AccountWithdrawn: model.AccountWithdrawn,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating usage-view")
+	}
+	err = usageView.Register(coordinator)
+	if err != nil {
+		return nil, err
+	}
+	return coordinator, nil
+}
+
+func txnCreatorRunCfg(
+	bus eventutil.Bus,
+	flowEpoch *eventutil.FlowEpoch,
+) (*txn.CmdListenerCfg, error) {
+	txnCreatorEventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+		Bus:            bus,
+		EventStore:     eventutil.NewMemoryEventStore(),
+		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		Source:         globalcfg.EventSource,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating event-repo for transaction-creator")
+	}
+
+	return &txn.CmdListenerCfg{
+		Log: logger.NewStdLogger("txn/CmdListener"),
+
+		Bus:          bus,
+		CreateTxnCmd: model.CreateTxn,
+		FlowEpoch:    flowEpoch,
+		Stats:        &eventutil.ComponentStats{},
+
+		CreatorCfg: &txn.CreatorCfg{
+			Log:                 logger.NewStdLogger("txn/Aggregate"),
+			EventRepo:           txnCreatorEventRepo,
+			DefaultTimeFmt:      globalcfg.TxnRequestTimeFmt,
+			MaxAmountDecimals:   globalcfg.MaxAmountDecimals,
+			StrictTimeRoundTrip: globalcfg.StrictTimeRoundTrip,
+
+			RejectContentDuplicates: globalcfg.RejectContentDuplicates,
+			ZeroAmountPolicy:        txn.ZeroAmountPolicy(globalcfg.ZeroAmountPolicy),
+
+			TxnCreated:      model.TxnCreated,
+			TxnCreateFailed: model.TxnCreateFailed,
+		},
+	}, nil
+}
+
+func processMgrRunCfg(
+	bus eventutil.Bus,
+	flowEpoch *eventutil.FlowEpoch,
+	txnResultViewRepo accountview.TxnResultViewRepo,
+) *domain.ProcessMgrCfg {
+	return &domain.ProcessMgrCfg{
+		Log:               logger.NewStdLogger("ProcessMgr"),
+		Bus:               bus,
+		TxnResultViewRepo: txnResultViewRepo,
+
+		WriteData:  model.WriteData,
+		CreateTxn:  model.CreateTxn,
+		ProcessTxn: model.ProcessTxn,
+
+		TxnRead:         model.TxnRead,
+		TxnCreated:      model.TxnCreated,
+		TxnCreateFailed: model.TxnCreateFailed,
+		ReportWritten:   model.DataWritten,
+
+		ReportWriteFailed: model.WriteFailed,
+		TxnReadFailed:     model.TxnReadFailed,
+
+		IdleTimeoutSec:               globalcfg.ProcessMgrIdleTimeoutSec,
+		ReportWrittenEventTimeoutSec: 2,
+		ReportTimeoutPerMB:           globalcfg.ReportTimeoutPerMB,
+		ReportTimeoutMinSec:          globalcfg.ReportTimeoutMinSec,
+		ReportTimeoutMaxSec:          globalcfg.ReportTimeoutMaxSec,
+
+		FlowEpoch: flowEpoch,
+
+		FailOnEmptyInput:    globalcfg.FailOnEmptyInput,
+		FailOnZeroValidTxns: globalcfg.FailOnZeroValidTxns,
+
+		PayloadEnvelope:      globalcfg.ReportPayloadEnvelope,
+		PerCustomerOutputDir: globalcfg.PerCustomerOutputDir,
+		CustomerGrouped:      globalcfg.CustomerGroupedInput,
+		StragglerPolicy:      domain.StragglerPolicy(globalcfg.StragglerPolicy),
+		SummaryFilePath:      globalcfg.SummaryFilePath,
+
+		ReportSort:       domain.ReportSortMode(globalcfg.ReportSortMode),
+		VerifyInputOrder: globalcfg.VerifyInputOrder,
+		StreamedResults:  globalcfg.StreamResults,
+	}
+}
+
+func anomalyRunCfg(bus eventutil.Bus) (*anomaly.EventListenerCfg, error) {
+	monitor, err := anomaly.NewRejectionMonitor(&anomaly.RejectionMonitorCfg{
+		WindowSize:   globalcfg.RejectionAnomalyWindowSize,
+		Threshold:    globalcfg.RejectionAnomalyThreshold,
+		MinBreachSec: globalcfg.RejectionAnomalyMinBreachSec,
+		CooldownSec:  globalcfg.RejectionAnomalyCooldownSec,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating rejection-monitor")
+	}
+
+	return &anomaly.EventListenerCfg{
+		Log: logger.NewStdLogger("anomaly/EventListener"),
+		Bus: bus,
+
+		AccountDeposited:     model.AccountDeposited,
+		AccountWithdrawn:     model.AccountWithdrawn,
+		DuplicateTxn:         model.DuplicateTxn,
+		AccountLimitExceeded: model.AccountLimitExceeded,
+		RejectionRateAnomaly: model.RejectionRateAnomaly,
+
+		Monitor: monitor,
+	}, nil
+}
+
+func writerRunCfg(bus eventutil.Bus, w io.Writer) (*writer.CmdListenerCfg, error) {
+	writerEventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+		Bus:            bus,
+		EventStore:     eventutil.NewMemoryEventStore(),
+		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		Source:         globalcfg.EventSource,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating event-repo for writer")
+	}
+
+	var sinks []writer.ResultSink
+	if globalcfg.ReportHTTPSinkURL != "" {
+		httpSink, err := writer.NewHTTPSink(writer.HTTPSinkCfg{
+			Name: "http",
+			URL:  globalcfg.ReportHTTPSinkURL,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating http-sink for writer")
+		}
+		sinks = append(sinks, httpSink)
+	}
+
+	return &writer.CmdListenerCfg{
+		Log: logger.NewStdLogger("writer/CmdListener"),
+
+		Bus:       bus,
+		WriteData: model.WriteData,
+		Stats:     &eventutil.ComponentStats{},
+
+		WriterCfg: &writer.AggregateCfg{
+			Log:    logger.NewStdLogger("writer/Aggregate"),
+			Writer: bufio.NewWriter(w),
+			Sinks:  sinks,
+			// Per-customer output and summary are written to files
+			AllowFileTargets: globalcfg.PerCustomerOutputDir != "" || globalcfg.SummaryFilePath != "",
+
+			EventRepo:   writerEventRepo,
+			DataWritten: model.DataWritten,
+			WriteFailed: model.WriteFailed,
+		},
+	}, nil
+}
+
+// shardWriterRunCfg returns config of writer of output-shard,
+// handling its own write-data action.
+func shardWriterRunCfg(bus eventutil.Bus, shard int, w io.Writer) (*writer.CmdListenerCfg, error) {
+	shardEventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+		Bus:            bus,
+		EventStore:     eventutil.NewMemoryEventStore(),
+		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		Source:         globalcfg.EventSource,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating event-repo for shard-writer")
+	}
+
+	return &writer.CmdListenerCfg{
+		Log: logger.NewStdLogger(fmt.Sprintf("shardWriter-%d/CmdListener", shard)),
+
+		Bus:       bus,
+		WriteData: model.CmdAction(fmt.Sprintf("%s.%d", model.WriteData, shard)),
+		Stats:     &eventutil.ComponentStats{},
+
+		WriterCfg: &writer.AggregateCfg{
+			Log:    logger.NewStdLogger(fmt.Sprintf("shardWriter-%d/Aggregate", shard)),
+			Writer: bufio.NewWriter(w),
+
+			EventRepo:   shardEventRepo,
+			DataWritten: model.DataWritten,
+			WriteFailed: model.WriteFailed,
+		},
+	}, nil
+}
@@ -0,0 +1,105 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides current-time and timers.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is Clock backed by "time" package from std-lib.
+type RealClock struct{}
+
+// Now returns current UTC-time.
+func (RealClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// After waits for the duration to elapse and
+// then sends the current time on returned channel.
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// FakeClock is a Clock which only moves
+// forward when explicitly advanced.
+// Use #NewFakeClock to create new instance.
+type FakeClock struct {
+	now     time.Time
+	waiters []fakeWaiter
+	lock    *sync.Mutex
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	channel  chan time.Time
+}
+
+// NewFakeClock creates new instance
+// of FakeClock set to provided time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		waiters: make([]fakeWaiter, 0),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// Now returns current time of FakeClock.
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// After returns a channel which receives the time
+// once FakeClock is advanced past the duration.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Buffered so firing never blocks
+	// on waiters that stopped listening.
+	channel := make(chan time.Time, 1)
+	if d <= 0 {
+		channel <- c.now
+		return channel
+	}
+	c.waiters = append(c.waiters, fakeWaiter{
+		deadline: c.now.Add(d),
+		channel:  channel,
+	})
+	return channel
+}
+
+// Advance moves FakeClock forward by provided
+// duration, firing all timers that expire.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := make([]fakeWaiter, 0)
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.channel <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns number of timers
+// that are yet to be fired.
+func (c *FakeClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.waiters)
+}
@@ -0,0 +1,4 @@
+// Package clock provides an abstraction over
+// time-source, so time-dependent behavior (such
+// as timeouts) can be controlled in tests.
+package clock
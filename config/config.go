@@ -5,6 +5,32 @@ import "os"
 // TxnRequestTimeFmt is default time-format of transaction-times.
 const TxnRequestTimeFmt = "2006-01-02T15:04:05Z"
 
+// MaxAmountDecimals rejects transactions with load-amounts
+// having more decimal places (such as "$4528.201" for 2).
+// Set to 0 to disable.
+const MaxAmountDecimals = 0
+
+// StrictTimeRoundTrip rejects transactions with times
+// not matching their time-format when formatted back,
+// such as times with fractional seconds.
+const StrictTimeRoundTrip = true
+
+// RejectContentDuplicates rejects transactions with same
+// customer, load-amount and time as an earlier transaction
+// in run, but a different ID, such as re-submissions.
+const RejectContentDuplicates = false
+
+// ZeroAmountPolicy handles transactions with zero load-amount.
+// One of: "allow" (processed as any other amount), "reject"
+// (declined with code zero_amount), "skip" (not processed,
+// and recorded as skipped in report).
+const ZeroAmountPolicy = "allow"
+
+// ExcludeZeroAmountTxnCounts doesn't count accepted zero-amount
+// transactions towards daily/weekly number of transactions, so
+// these don't use up limits of other transactions.
+const ExcludeZeroAmountTxnCounts = false
+
 // Account/transaction limits for each customer.
 // Set to 0 to disable, values must be positive.
 const (
@@ -14,6 +40,104 @@ const (
 	NumWeeklyTxnsLimit    = 0
 )
 
+// CategoryLimit is daily/weekly limits of transactions
+// of a category, same as account/transaction limits.
+type CategoryLimit struct {
+	DailyTxnsAmountLimit  float64
+	NumDailyTxnsLimit     int
+	WeeklyTxnsAmountLimit float64
+	NumWeeklyTxnsLimit    int
+}
+
+// CategoryLimits are limits of transactions by their category
+// (such as "ATM" or "online"), keyed by category. These apply
+// along with account/transaction limits, against usage of the
+// category's own transactions.
+var CategoryLimits = map[string]CategoryLimit{}
+
+// BucketTimezone is IANA-name of location (such as
+// "America/New_York") whose calendar-days and weeks bound
+// daily/weekly limits, so these reset at local midnight.
+// Days of DST-transitions are then 23 or 25 hours long.
+const BucketTimezone = "UTC"
+
+// Monthly prepaid load-allowance for each customer, per
+// calendar-month (in BucketTimezone). Unused allowance
+// carries into next month, up to MaxCarryOver.
+// Set to 0 to disable.
+const (
+	MonthlyAllowance = 0
+	MaxCarryOver     = 0
+)
+
+// AccountActorMode runs a long-lived account-aggregate per
+// customer, which keeps account-state in memory between
+// transactions instead of replaying the account's events
+// for every transaction.
+const AccountActorMode = false
+
+// BalanceDriftCheck replays each customer's events after
+// processing, and logs customers whose replayed balance
+// differs from their last published balance.
+const BalanceDriftCheck = false
+
+// LogEventStoreStats logs size of account's event-store
+// (events, aggregates, and approximate bytes) after run.
+const LogEventStoreStats = false
+
+// EventSource tags stored events with identifier of this
+// instance (see model.Event#Source), such as hostname in
+// deployments sharing an event-store. Leave blank to not tag.
+const EventSource = ""
+
+// StoreStatsTopN is number of aggregates with most events
+// included in stats of event-store, when logged after run
+// and served on "/store/stats" (unless "top" is specified).
+const StoreStatsTopN = 5
+
+// StrictHydration fails the run if transaction-result view
+// fails to apply an event. Otherwise, such events are
+// quarantined and skipped, and the report notes their count.
+const StrictHydration = false
+
+// ViewBulkCatchUp hydrates transaction-result view in bulk on
+// first event after it starts (such as events stored before a
+// restart), logging number of events caught up. Later events
+// are hydrated incrementally.
+const ViewBulkCatchUp = true
+
+// DuplicateScope is the window within which transaction-IDs
+// must be unique for a customer. One of: "customer",
+// "customer_day", "customer_week".
+const DuplicateScope = "customer"
+
+// GlobalTxnIDs declines transactions reusing a
+// transaction-ID accepted for another customer.
+const GlobalTxnIDs = false
+
+// RejectStaleTxns declines transactions earlier than
+// latest accepted transaction of customer.
+const RejectStaleTxns = false
+
+// VerboseLimitErrors includes total and limit of exceeded
+// window in errors of transactions exceeding amount-limits.
+const VerboseLimitErrors = false
+
+// EventTimeFromTxn timestamps account's events of a transaction
+// with transaction's time instead of processing-time, so event-
+// store's time-order follows transactions' chronology.
+const EventTimeFromTxn = false
+
+// PartialWithdrawal applies withdrawals exceeding account's
+// balance up to the balance, instead of declining these. A
+// PartialWithdrawal event notes the shortfall.
+const PartialWithdrawal = false
+
+// LimitDetails includes exceeded limit, its value, and value
+// of limit-window in failure-events of transactions exceeding
+// daily/weekly limits.
+const LimitDetails = false
+
 // Files to read/write data from/to respectively.
 // Paths are relative to project-root (main.go).
 const (
@@ -21,10 +145,198 @@ const (
 	OutputFilePath = "output.txt"
 )
 
+// ReportHTTPSinkURL is an optional HTTP endpoint report is
+// posted to (a request per line), along with output-file.
+// Set to blank to only write report to output-file.
+const ReportHTTPSinkURL = ""
+
+// PerCustomerOutputDir is an optional directory results of every
+// customer are written to (as "<customer_id>.ndjson"), along with
+// output-file. Set to blank to disable per-customer output.
+const PerCustomerOutputDir = ""
+
+// OutputShards is number of output-shards results are also
+// written to, sharded by hash of customer-id, each by its own
+// writer. Set to zero to disable sharded output.
+const OutputShards = 0
+
+// OutputShardFilePathFmt is format of path of output-shard
+// files, formatted with index of shard.
+const OutputShardFilePathFmt = "output-%d.txt"
+
+// CustomerGroupedInput marks input as grouped by customer (such
+// as when pre-sorted), so output of every customer is written
+// to PerCustomerOutputDir as soon as its group ends, instead of
+// along with output-file. Requires PerCustomerOutputDir.
+const CustomerGroupedInput = false
+
+// StragglerPolicy is how lines of customers whose group already
+// ended are handled, if CustomerGroupedInput is set. One of: "append"
+// (line is processed with a warning, and customer's output written
+// again), "reject" (line is dropped with a warning, has no result).
+const StragglerPolicy = "append"
+
+// SummaryFilePath is an optional file a one-line summary of
+// the run (totals, duration, declines by cause) is written
+// to, along with output-file. Set to blank to disable summary.
+const SummaryFilePath = ""
+
+// RecoveryFilePath is an optional file messages left unprocessed
+// on bus at shutdown are written to. If file exists at start of
+// run, its messages are republished before input is read, so an
+// interrupted run is resumed. Set to blank to disable recovery.
+const RecoveryFilePath = ""
+
+// InputEncoding is text-encoding of input-file. One of: "utf8",
+// "utf16le", "utf16be". Set to blank to detect encoding from
+// byte-order mark (defaulting to UTF-8).
+const InputEncoding = ""
+
+// IngestionProfile is name of ingestion-profile (see package
+// profile) to read and create transactions with, loaded from
+// IngestionProfilesDir as "<name>.json", "<name>.yaml" or
+// "<name>.yml". Settings of profile take precedence over ones
+// in this file. Set to blank to disable profiles.
+const (
+	IngestionProfile     = ""
+	IngestionProfilesDir = "_samples/profiles"
+)
+
+// OpeningBalancesFilePath is an optional CSV-file of opening-balances
+// (columns: customer_id, balance, as_of) to seed accounts with before
+// processing input. Set to blank to disable seeding.
+const OpeningBalancesFilePath = ""
+
+// MigrationSrcFilePath and MigrationDstFilePath are default
+// NDJSON event-files (see eventutil.ExportNDJSON) read and
+// written by "migrate" subcommand. MigrationErrorBudget is
+// number of events which may fail migration before it's
+// aborted, negative for no limit.
+const (
+	MigrationSrcFilePath = "events.ndjson"
+	MigrationDstFilePath = "events-migrated.ndjson"
+	MigrationErrorBudget = 0
+)
+
+// AllowNegativeOpeningBalances allows seeding overdrawn accounts.
+// Deposits bringing these above zero publish AccountRecovered events.
+const AllowNegativeOpeningBalances = false
+
+// ExcludeTestTxns moves transactions tagged as test
+// into a separate section of report (preceded by a
+// "# test-transactions" line), and excludes them
+// from accepted/declined counts.
+const ExcludeTestTxns = true
+
+// MetricsAddr is address to serve Prometheus-metrics
+// on (at "/metrics"), such as ":9090". Set to blank
+// to disable metrics.
+const MetricsAddr = ""
+
+// BusNoSubscribersWarnIntervalSec throttles warnings for
+// messages published without subscribers, logging these
+// once per action within interval.
+const BusNoSubscribersWarnIntervalSec = 10
+
+// WarningDetailsPerCode is number of warnings of every
+// code whose details are kept in run-summary, along with
+// counts of all warnings.
+const WarningDetailsPerCode = 5
+
+// ReportWarnings notes counts of warnings collected
+// during run in report-trailer.
+const ReportWarnings = false
+
+// BusMaxTerminateDrains bounds goroutines draining
+// subscriptions while event-bus terminates.
+const BusMaxTerminateDrains = 8
+
+// PreSortInput reads complete input before processing,
+// and processes transactions sorted by customer and
+// transaction-time. This ensures correct limit-periods
+// when input isn't chronological, but buffers all input.
+const PreSortInput = false
+
+// Fail the run (with a distinct exit-code) if input has
+// no lines, or no valid transactions, respectively. The
+// report is still written, with a header recording the
+// number of lines read and valid transactions.
+const (
+	FailOnEmptyInput    = false
+	FailOnZeroValidTxns = false
+)
+
+// WiringCheck decides handling of mismatched actions between
+// routines (such as an action subscribed to, but not published
+// by any routine), checked before starting routines. One of:
+// "warn" (log warnings), "strict" (fail run), "off".
+const WiringCheck = "warn"
+
+// ReportPayloadEnvelope sends report to writer wrapped in a
+// versioned payload-envelope, instead of as raw data.
+const ReportPayloadEnvelope = true
+
+// ReportSortMode orders results in report. One of: ""
+// (order results are produced in), "input_order" (order
+// transactions appear in input, even if input is pre-sorted).
+const ReportSortMode = ""
+
+// StreamResults writes results to output as soon as these're
+// recorded by transaction-result view, so output can be tailed
+// while running. Report-header and trailer, if any, are written
+// last, and test transactions aren't moved into a separate
+// section. Incompatible with ReportSortMode "input_order".
+const StreamResults = false
+
+// VerifyInputOrder fails the run, without writing report, if
+// report doesn't have exactly one result for every transaction
+// read from input. Missing and duplicated input-sequences (line
+// numbers of input, skipping blank and malformed lines) are
+// logged.
+const VerifyInputOrder = false
+
+// VerboseDeclineReasons includes a customer-friendly
+// reason (in English) with every declined result in report.
+const VerboseDeclineReasons = false
+
+// ResultProcessedAt includes time every result was
+// recorded at (as "processed_at") in report, for audit.
+const ResultProcessedAt = false
+
 // ProcessMgrIdleTimeoutSec IdleTimeout for process-manager.
 // Check process-manager docs for info on idle-timeout.
 const ProcessMgrIdleTimeoutSec = 5
 
+// Timeout for process-manager to receive confirmation
+// of report being written. The timeout is scaled by
+// report-size (seconds per MB), bounded by min/max.
+const (
+	ReportTimeoutPerMB  = 2
+	ReportTimeoutMinSec = 3
+	ReportTimeoutMaxSec = 120
+)
+
+// Reports a RejectionRateAnomaly once more than threshold
+// (ratio) of last window-size results are rejected for at
+// least min-breach seconds. Anomalies are reported at most
+// once per cooldown. Window-size zero disables monitoring.
+const (
+	RejectionAnomalyWindowSize   = 0
+	RejectionAnomalyThreshold    = 0.5
+	RejectionAnomalyMinBreachSec = 0
+	RejectionAnomalyCooldownSec  = 60
+)
+
+// ProgressIntervalSec is interval at which progress of run is
+// reported to stderr, such as lines read and results processed.
+// Zero disables reporting progress.
+const ProgressIntervalSec = 0
+
+// FailOnDeprecated lists deprecated features (such as
+// "raw-write-data", see package deprecation) whose use
+// fails the run, such as for CI canaries.
+var FailOnDeprecated = []string{}
+
 var defaultEnv = map[string]string{
 	"LOG_LEVEL":          "debug",
 	"EVENTBUS_LOG_LEVEL": "info",
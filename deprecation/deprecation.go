@@ -0,0 +1,124 @@
+package deprecation
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+// Deprecated features, noted by their compatibility paths.
+const (
+	// Write-data command with raw data, instead of a
+	// versioned payload-envelope (see writer.Payload).
+	RawWriteData = "raw-write-data"
+)
+
+// Path is path counts of deprecated features are served on.
+const Path = "/deprecations"
+
+// Counts are uses of deprecated features, keyed by feature.
+type Counts map[string]int64
+
+// Since returns uses of features since provided
+// counts. Features without new uses are excluded.
+func (c Counts) Since(prev Counts) Counts {
+	since := make(Counts)
+	for feature, count := range c {
+		if delta := count - prev[feature]; delta > 0 {
+			since[feature] = delta
+		}
+	}
+	return since
+}
+
+// Features returns features in counts, sorted.
+func (c Counts) Features() []string {
+	features := make([]string, 0, len(c))
+	for feature := range c {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+type registry struct {
+	log logger.Logger
+
+	// Counters are only added, so notes of known
+	// features only take read-lock.
+	lock     *sync.RWMutex
+	counters map[string]*int64
+}
+
+var defaultRegistry = &registry{
+	log:      logger.NewStdLogger("deprecation"),
+	lock:     &sync.RWMutex{},
+	counters: make(map[string]*int64),
+}
+
+// Note records a use of deprecated feature. First use of
+// every feature is also logged as a machine-readable warning
+// along with detail (such as ID of command using feature).
+// Safe for concurrent use.
+func Note(feature string, detail string) {
+	defaultRegistry.note(feature, detail)
+}
+
+// Snapshot returns uses of deprecated features so far.
+func Snapshot() Counts {
+	return defaultRegistry.snapshot()
+}
+
+func (r *registry) note(feature string, detail string) {
+	r.lock.RLock()
+	counter, exists := r.counters[feature]
+	r.lock.RUnlock()
+	if exists {
+		atomic.AddInt64(counter, 1)
+		return
+	}
+
+	r.lock.Lock()
+	counter, exists = r.counters[feature]
+	if !exists {
+		counter = new(int64)
+		r.counters[feature] = counter
+	}
+	r.lock.Unlock()
+	if atomic.AddInt64(counter, 1) == 1 {
+		r.log.Warnf("deprecated-feature=%q detail=%q: First use of deprecated feature", feature, detail)
+	}
+}
+
+func (r *registry) snapshot() Counts {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	counts := make(Counts, len(r.counters))
+	for feature, counter := range r.counters {
+		counts[feature] = atomic.LoadInt64(counter)
+	}
+	return counts
+}
+
+// NewHandler returns http.Handler serving uses of deprecated
+// features so far as JSON, keyed by feature. Handler should
+// be registered on Path.
+func NewHandler(log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(Snapshot())
+		if err != nil {
+			log.Errorf("Error writing deprecation-counts: %s", err)
+		}
+	})
+}
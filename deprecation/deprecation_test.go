@@ -0,0 +1,68 @@
+package deprecation_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+func TestNote(t *testing.T) {
+	const feature = "test-note"
+
+	before := deprecation.Snapshot()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deprecation.Note(feature, "test")
+		}()
+	}
+	wg.Wait()
+	deprecation.Note("test-note-other", "test")
+
+	since := deprecation.Snapshot().Since(before)
+	expected := deprecation.Counts{
+		feature:           10,
+		"test-note-other": 1,
+	}
+	if !reflect.DeepEqual(since, expected) {
+		t.Fatalf("expected uses: %v, got: %v", expected, since)
+	}
+	features := since.Features()
+	if !reflect.DeepEqual(features, []string{feature, "test-note-other"}) {
+		t.Fatalf("expected sorted features, got: %v", features)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	const feature = "test-handler"
+	deprecation.Note(feature, "test")
+
+	handler := deprecation.NewHandler(logger.NewStdLogger("deprecation"))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, deprecation.Path, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got: %d", recorder.Code)
+	}
+	counts := deprecation.Counts{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &counts)
+	if err != nil {
+		t.Fatalf("error unmarshalling response: %s", err)
+	}
+	if counts[feature] != 1 {
+		t.Fatalf("expected 1 use of %s, got: %v", feature, counts)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, deprecation.Path, nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got: %d", recorder.Code)
+	}
+}
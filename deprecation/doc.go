@@ -0,0 +1,5 @@
+// Package deprecation tracks uses of legacy payload-shapes,
+// still accepted through compatibility paths, so producers
+// and consumers using these can be found before the paths
+// are removed.
+package deprecation
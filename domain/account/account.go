@@ -3,14 +3,17 @@ package account
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/validator.v2"
 
+	"github.com/Jaskaranbir/es-bank-account/clock"
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/trace"
 )
 
 // TxnFailureCause represents a probable
@@ -23,6 +26,58 @@ const (
 	DailyLimitsExceeded  TxnFailureCause = "DailyLimitsExceeded"
 	WeeklyLimitsExceeded TxnFailureCause = "WeeklyLimitsExceeded"
 	InsufficientFunds    TxnFailureCause = "InsufficientFunds"
+	FraudSuspected       TxnFailureCause = "FraudSuspected"
+	AllowanceExhausted   TxnFailureCause = "AllowanceExhausted"
+	StaleTxn             TxnFailureCause = "StaleTxn"
+	// Transaction exceeds limits of its category,
+	// see AggregateCfg#CategoryLimits.
+	CategoryLimitsExceeded TxnFailureCause = "CategoryLimitsExceeded"
+)
+
+// LimitType identifies an account-limit
+// exceeded by a transaction.
+type LimitType string
+
+// Account-limits which transactions can exceed.
+const (
+	DailyNumTxnsLimit  LimitType = "DailyNumTxns"
+	DailyAmountLimit   LimitType = "DailyAmount"
+	WeeklyNumTxnsLimit LimitType = "WeeklyNumTxns"
+	WeeklyAmountLimit  LimitType = "WeeklyAmount"
+
+	// Limits of transaction's category
+	CategoryDailyNumTxnsLimit  LimitType = "CategoryDailyNumTxns"
+	CategoryDailyAmountLimit   LimitType = "CategoryDailyAmount"
+	CategoryWeeklyNumTxnsLimit LimitType = "CategoryWeeklyNumTxns"
+	CategoryWeeklyAmountLimit  LimitType = "CategoryWeeklyAmount"
+)
+
+// limitError is error of transaction exceeding an account-limit.
+type limitError struct {
+	limitType    LimitType
+	limitValue   float64
+	currentValue float64
+	msg          string
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+const defaultFraudCheckTimeoutSec = 1
+
+// DuplicateScope defines the window within which
+// transaction-IDs must be unique for a customer.
+type DuplicateScope string
+
+// Supported duplicate-scopes.
+const (
+	// IDs must be unique across all transactions of customer.
+	DuplicateScopeCustomer DuplicateScope = "customer"
+	// IDs must be unique within a day (UTC) for customer.
+	DuplicateScopeCustomerDay DuplicateScope = "customer_day"
+	// IDs must be unique within an ISO-week (UTC) for customer.
+	DuplicateScopeCustomerWeek DuplicateScope = "customer_week"
 )
 
 // account represents an account for a specific customer.
@@ -31,19 +86,106 @@ type account struct {
 	log       logger.Logger
 	eventRepo eventutil.EventRepo
 
-	accountDeposited     model.EventAction
-	accountWithdrawn     model.EventAction
 	duplicateTxn         model.EventAction
 	accountLimitExceeded model.EventAction
+	balanceSnapshot      model.EventAction
+	snapshotEveryNTxns   int
+	accountRecovered     model.EventAction
+	partiallyWithdrawn   model.EventAction
+	partialWithdrawal    bool
+	globalTxnIDs         bool
+	rejectStaleTxns      bool
+	verboseLimitErrors   bool
+	limitDetails         bool
+	// If set, zero-amount transactions aren't
+	// counted in daily/weekly number of transactions.
+	excludeZeroAmountCounts bool
+	eventTimeFromTxn        bool
 
-	dailyLimits  TxnRecord
-	weeklyLimits TxnRecord
+	duplicateDetector DuplicateDetector
+	// Set if detector is account's own default detector,
+	// which is created again when account is reset.
+	ownsDetector bool
+
+	limits limitsSnapshot
+	// Keyed by category, see AggregateCfg#CategoryLimits
+	categoryLimits map[string]limitsSnapshot
+
+	clock               clock.Clock
+	fraudChecker        FraudChecker
+	fraudCheckThreshold float64
+	fraudCheckTimeout   time.Duration
+	fraudFailurePolicy  FraudFailurePolicy
+
+	tracer trace.Tracer
+	// Span of command being handled, ended
+	// before publishing command's result.
+	span trace.Span
+	// Time of events published for command being handled.
+	// Zero (current time) unless EventTimeFromTxn is set.
+	eventTime time.Time
 
-	custID        string
-	dailyTxn      map[int]map[int]TxnRecord
-	weeklyTxn     map[int]map[int]TxnRecord
-	balance       float64
-	txnKeysRecord []string
+	custID string
+	accountState
+
+	// Set for long-lived accounts (see accountActor), which
+	// are loaded once, and apply their own published events
+	// instead of being reloaded for every command.
+	retainState bool
+	loaded      bool
+	// Events published while handling current command.
+	// Only tracked if state is retained.
+	published []model.Event
+	// Keys of transactions declined by account, so replayed
+	// transactions are only processed if they have no result.
+	// Keys are derived using #txnKey.
+	declinedTxnKeys map[string]struct{}
+}
+
+// accountState is state of an account, derived by applying
+// its events. Doesn't depend on event-repo or bus, so events
+// can be applied outside of a live aggregate (see #StateAt).
+// Use #newAccountState to create new instance.
+type accountState struct {
+	accountDeposited model.EventAction
+	accountWithdrawn model.EventAction
+	accountSeeded    model.EventAction
+	duplicateScope   DuplicateScope
+	monthlyAllowance float64
+	maxCarryOver     float64
+	// Days/weeks of limits and months of allowance are
+	// observed in this, see AggregateCfg#BucketLocation.
+	bucketLocation *time.Location
+
+	// Period-buckets older than this are not
+	// relevant to current transaction's limits.
+	pruneBefore time.Time
+	dailyTxn    map[int]map[int]TxnRecord
+	weeklyTxn   map[int]map[int]TxnRecord
+	// Records of categorized transactions,
+	// pruned same as daily/weekly records.
+	categoryDailyTxn  map[categoryBucket]TxnRecord
+	categoryWeeklyTxn map[categoryBucket]TxnRecord
+	// Keyed by month of #bucketKey, months aren't pruned
+	// since carry-over is derived from these.
+	monthlyTxn map[int]AllowanceRecord
+	balance    float64
+	// Time balance last went non-positive (through a
+	// transaction or seeded opening-balance), zero while
+	// positive. Accounts without events have no such time.
+	nonPositiveSince time.Time
+	// Set if account was seeded with a negative opening-balance
+	// (see SeedOpts#AllowNegative), whose deposits are accepted
+	// while balance is below zero.
+	negativeOpening bool
+	// Time and ID of latest accepted transaction,
+	// see #trackLastTxn for ordering of ties.
+	lastTxnTime time.Time
+	lastTxnID   string
+	// Number of accepted transactions
+	numTxns int
+	// Keys are derived using #txnKey
+	txnKeysRecord map[string]struct{}
 }
 
 // TxnRecord is aggregated transaction-data
@@ -60,10 +202,73 @@ type State struct {
 	TxnID   string
 	CustID  string
 	TxnTime time.Time
+	IsTest  bool
 
 	DailyTxn    TxnRecord
 	WeeklyTxn   TxnRecord
+	MonthlyTxn  AllowanceRecord
 	TotalAmount float64
+
+	// Version of limits the transaction was validated against.
+	LimitsVersion uint64
+	// Input-sequence of transaction, see model.Transaction.
+	InputSeq uint64 `json:",omitempty"`
+	// Schema-version of State, see #DecodeState.
+	Version int `json:",omitempty"`
+	// Only set for partially applied withdrawals (see
+	// AggregateCfg#PartialWithdrawal). Amounts are signed
+	// same as model.Transaction#LoadAmount.
+	RequestedAmount float64 `json:",omitempty"`
+	AppliedAmount   float64 `json:",omitempty"`
+	// Only set for transactions with a category, along with
+	// records of category for transaction's day and week.
+	Category          string     `json:",omitempty"`
+	CategoryDailyTxn  *TxnRecord `json:",omitempty"`
+	CategoryWeeklyTxn *TxnRecord `json:",omitempty"`
+}
+
+// PartialWithdrawal is data of event published when a
+// withdrawal exceeding available funds is partially applied.
+type PartialWithdrawal struct {
+	CustID  string
+	TxnID   string
+	TxnTime time.Time
+	// Signed same as model.Transaction#LoadAmount
+	RequestedAmount float64
+	AppliedAmount   float64
+	// Amount which wasn't withdrawn
+	Shortfall float64
+	Balance   float64
+}
+
+// BalanceSnapshot captures an account's balance and
+// limits-usage after a transaction. Emitted every
+// N accepted transactions, if configured.
+type BalanceSnapshot struct {
+	CustID string
+	// Transaction after which snapshot was taken
+	TxnID   string
+	TxnTime time.Time
+	// Number of accepted transactions till snapshot
+	NumTxns int
+	Balance float64
+
+	DailyTxn  TxnRecord
+	WeeklyTxn TxnRecord
+}
+
+// AccountRecovery is data of event published when an accepted
+// transaction brings a non-positive balance above zero.
+type AccountRecovery struct {
+	CustID string
+	// Transaction which brought balance above zero
+	TxnID   string
+	TxnTime time.Time
+	// Time balance went non-positive, and time since
+	// then till transaction (by transaction-times).
+	NonPositiveSince    time.Time
+	NonPositiveDuration time.Duration
+	Balance             float64
 }
 
 // TxnFailure contains data/info for transaction-failure.
@@ -71,6 +276,25 @@ type TxnFailure struct {
 	Txn          model.Transaction
 	Error        string
 	FailureCause TxnFailureCause
+	// Set for transactions exceeding an account-limit, if
+	// AggregateCfg#LimitDetails is set. CurrentValue is of
+	// limit-window including transaction, such as its total
+	// amount for DailyAmountLimit.
+	LimitType    LimitType `json:",omitempty"`
+	LimitValue   float64   `json:",omitempty"`
+	CurrentValue float64   `json:",omitempty"`
+}
+
+// setLimitDetails sets exceeded limit in failure,
+// if err is of transaction exceeding a limit.
+func (f *TxnFailure) setLimitDetails(err error) {
+	var limitErr *limitError
+	if !errors.As(err, &limitErr) {
+		return
+	}
+	f.LimitType = limitErr.limitType
+	f.LimitValue = limitErr.limitValue
+	f.CurrentValue = limitErr.currentValue
 }
 
 // AggregateCfg defines config for Account-aggregate.
@@ -82,80 +306,395 @@ type AggregateCfg struct {
 	AccountWithdrawn     model.EventAction `validate:"nonzero"`
 	DuplicateTxn         model.EventAction `validate:"nonzero"`
 	AccountLimitExceeded model.EventAction `validate:"nonzero"`
+	// Optional, balance-snapshots are not emitted if not set.
+	BalanceSnapshot model.EventAction
+	// Emits balance-snapshot every N accepted transactions
+	// of a customer. Required if BalanceSnapshot is set.
+	SnapshotEveryNTxns int `validate:"min=0"`
+	// Optional, opening balances seeded using
+	// #SeedOpeningBalances are ignored if not set.
+	AccountSeeded model.EventAction
+	// Optional, published with AccountRecovery as data, along
+	// with success-event of transaction bringing a non-positive
+	// balance above zero. Not published if not set.
+	AccountRecovered model.EventAction
+	// Published with PartialWithdrawal as data, along with
+	// success-event of a partially applied withdrawal.
+	// Required if PartialWithdrawal is set.
+	PartiallyWithdrawn model.EventAction
+
+	// Optional, defaults to DuplicateScopeCustomer.
+	// Keys are derived from transaction-time when
+	// loading aggregate, so scope can be changed
+	// for existing events.
+	DuplicateScope DuplicateScope
+	// Optional, defaults to a ScopedIDDetector with DuplicateScope,
+	// created for every account. Otherwise detector is shared by
+	// all accounts, and is responsible for its own retention.
+	DuplicateDetector DuplicateDetector
+	// Optional, transaction-IDs accepted for other customers
+	// (within duplicate-scope) are also declined as duplicates.
+	// Checked by scanning event-store for every transaction
+	// which is unique for customer, so it's slower on large
+	// event-stores. Concurrent accounts (see
+	// CmdListenerCfg#ActorMode) don't see each other's
+	// in-flight transactions.
+	GlobalTxnIDs bool
+	// Optional, transactions earlier than latest accepted
+	// transaction of customer (arriving out-of-order) are
+	// declined as StaleTxn, instead of being counted in
+	// limit-windows of their time. Transactions at same
+	// time as latest one are ordered by their IDs, so a
+	// transaction with a lexicographically smaller ID is
+	// also stale.
+	RejectStaleTxns bool
+	// Optional, errors of transactions exceeding amount-limits
+	// also include total and limit of exceeded window, such as
+	// "limit exceeded for total load-value by: $500.00
+	// (total: $20500.00, limit: $20000.00)".
+	VerboseLimitErrors bool
+	// Optional, failure-events of transactions exceeding
+	// daily/weekly limits include exceeded limit (see
+	// TxnFailure#LimitType), along with its value and
+	// value of limit-window including transaction.
+	LimitDetails bool
+	// Optional, accepted transactions with zero load-amount
+	// aren't counted towards daily/weekly number of
+	// transactions (see NumDailyTxnsLimit), so these don't
+	// use up slots of other transactions. These are still
+	// recorded, so their IDs are checked for duplicates.
+	ExcludeZeroAmountTxnCounts bool
+	// Optional, events published for a transaction (such
+	// as its success/failure-event) have transaction's time
+	// as their time, instead of time these're processed at,
+	// so time-order of event-store follows transactions'
+	// chronology. PointInTimeProcessedAt then also places
+	// these events at transaction's time.
+	EventTimeFromTxn bool
+	// Optional, withdrawals exceeding available funds are
+	// applied up to these instead of being declined. Accounts
+	// have no overdraft, so available funds are at most the
+	// balance (see #availableFunds). Success-event records
+	// requested and applied amounts (see State), and a
+	// PartiallyWithdrawn event notes the shortfall.
+	PartialWithdrawal bool
+
+	DailyTxnsAmountLimit  float64 `validate:"min=0"`
+	NumDailyTxnsLimit     int     `validate:"min=0"`
+	WeeklyTxnsAmountLimit float64 `validate:"min=0"`
+	NumWeeklyTxnsLimit    int     `validate:"min=0"`
+	// Optional, daily/weekly limits of transactions of a
+	// category (see model.Transaction#Category), keyed by
+	// category, such as "ATM" or "online". These apply along
+	// with limits above, against usage of category's own
+	// transactions, so a category can be limited below global
+	// limits. Transactions without a category, or of categories
+	// without limits, are only checked against limits above.
+	// Not changed by limits-updates.
+	CategoryLimits map[string]Limits
+	// Optional, location whose calendar-days and ISO-weeks
+	// bound daily/weekly limits (and their category-limits),
+	// such as America/New_York. Defaults to UTC. Windows start
+	// at local midnight, so days of DST-transitions are 23 or
+	// 25 hours long. Months of allowance are observed in this
+	// too, while days/weeks of duplicate-scope remain in UTC.
+	BucketLocation *time.Location
+
+	// Optional, amount customers can load per calendar-month
+	// (see #BucketLocation). Unused allowance carries into next month, up to
+	// MaxCarryOver. Applies along with daily/weekly limits,
+	// and transactions must pass all configured limits.
+	// Set to 0 to disable. See #AllowanceRecord.
+	MonthlyAllowance float64 `validate:"min=0"`
+	// Optional, requires MonthlyAllowance.
+	// Set to 0 to disable carry-over.
+	MaxCarryOver float64 `validate:"min=0"`
+
+	// Optional, defaults to NoopFraudChecker.
+	// Consulted before accepting transactions with
+	// load-amount above FraudCheckThreshold. Checks
+	// are disabled unless both are set.
+	FraudChecker        FraudChecker
+	FraudCheckThreshold float64 `validate:"min=0"`
+	// Optional, defaults to 1 second.
+	FraudCheckTimeoutSec int `validate:"min=0"`
+	// Optional, defaults to FraudFailOpen.
+	FraudFailurePolicy FraudFailurePolicy
+	// Optional, defaults to clock.RealClock.
+	// Used for fraud-check time-outs.
+	Clock clock.Clock
 
+	// Optional, time events are placed at by #StateAt.
+	// Defaults to PointInTimeTxnTime.
+	PointInTimeBasis PointInTimeBasis
+
+	// Optional, records span of processing every
+	// transaction, keyed by command's correlation.
+	Tracer trace.Tracer
+}
+
+// Limits defines transaction-limits for accounts.
+// A zero value for any limit disables that limit.
+type Limits struct {
 	DailyTxnsAmountLimit  float64 `validate:"min=0"`
 	NumDailyTxnsLimit     int     `validate:"min=0"`
 	WeeklyTxnsAmountLimit float64 `validate:"min=0"`
 	NumWeeklyTxnsLimit    int     `validate:"min=0"`
 }
 
-// newAccount validates Account-Config
-// and creates new Account-instance.
-func newAccount(cfg *AggregateCfg) (*account, error) {
+// Validate validates config, including invariants between its
+// fields (such as weekly-limits not being lower than daily-limits).
+func (cfg *AggregateCfg) Validate() error {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = newAccountState(cfg)
+	if err != nil {
+		return err
+	}
+	err = cfg.checkInvariants()
+	if err != nil {
+		return err
+	}
+	_, err = newLimitsSnapshot(0, cfg.limits())
+	if err != nil {
+		return err
+	}
+	_, err = cfg.categoryLimitsOf()
+	if err != nil {
+		return err
+	}
+	return cfg.checkLimits(cfg.limits())
+}
+
+// checkInvariants checks invariants between fields of config.
+// Limits are checked separately (see #checkLimits), since
+// these can also be updated once listener is running.
+func (cfg *AggregateCfg) checkInvariants() error {
+	if cfg.BalanceSnapshot != "" && cfg.SnapshotEveryNTxns == 0 {
+		return errors.New("snapshot-interval must be set if balance-snapshots are enabled")
+	}
+	if cfg.PartialWithdrawal && cfg.PartiallyWithdrawn == "" {
+		return errors.New("partially-withdrawn action must be set if partial-withdrawals are enabled")
+	}
+	switch cfg.FraudFailurePolicy {
+	case "", FraudFailOpen, FraudFailClosed:
+	default:
+		return fmt.Errorf("invalid fraud-failure policy: %s", cfg.FraudFailurePolicy)
+	}
+	return nil
+}
+
+// limits returns the initial transaction-limits from config.
+func (cfg *AggregateCfg) limits() Limits {
+	return Limits{
+		DailyTxnsAmountLimit:  cfg.DailyTxnsAmountLimit,
+		NumDailyTxnsLimit:     cfg.NumDailyTxnsLimit,
+		WeeklyTxnsAmountLimit: cfg.WeeklyTxnsAmountLimit,
+		NumWeeklyTxnsLimit:    cfg.NumWeeklyTxnsLimit,
+	}
+}
+
+// limitsSnapshot is an immutable, versioned copy of
+// transaction-limits. A new snapshot is created for every
+// limits-update, so a transaction is always validated against
+// a single coherent set of limits.
+// Use #newLimitsSnapshot to create new instance.
+type limitsSnapshot struct {
+	version      uint64
+	dailyLimits  TxnRecord
+	weeklyLimits TxnRecord
+}
+
+// limits returns limits of snapshot.
+func (s limitsSnapshot) limits() Limits {
+	return Limits{
+		DailyTxnsAmountLimit:  s.dailyLimits.TotalAmount,
+		NumDailyTxnsLimit:     s.dailyLimits.NumTxns,
+		WeeklyTxnsAmountLimit: s.weeklyLimits.TotalAmount,
+		NumWeeklyTxnsLimit:    s.weeklyLimits.NumTxns,
+	}
+}
+
+// newLimitsSnapshot validates provided limits
+// and creates new limitsSnapshot.
+func newLimitsSnapshot(version uint64, limits Limits) (limitsSnapshot, error) {
+	err := validator.Validate(limits)
+	if err != nil {
+		return limitsSnapshot{}, errors.Wrap(err, "error validating limits")
+	}
+	err = checkLimitValues(limits)
+	if err != nil {
+		return limitsSnapshot{}, err
+	}
+
+	return limitsSnapshot{
+		version: version,
+		dailyLimits: TxnRecord{
+			NumTxns:     limits.NumDailyTxnsLimit,
+			TotalAmount: limits.DailyTxnsAmountLimit,
+		},
+		weeklyLimits: TxnRecord{
+			NumTxns:     limits.NumWeeklyTxnsLimit,
+			TotalAmount: limits.WeeklyTxnsAmountLimit,
+		},
+	}, nil
+}
+
+// newAccount validates Account-Config and creates new
+// Account-instance which validates transactions against
+// provided limits-snapshot. Limits in config are ignored.
+func newAccount(cfg *AggregateCfg, limits limitsSnapshot) (*account, error) {
 	err := validator.Validate(cfg)
 	if err != nil {
 		return nil, errors.New("error validating config")
 	}
-	if cfg.WeeklyTxnsAmountLimit > 0 &&
-		cfg.WeeklyTxnsAmountLimit < cfg.DailyTxnsAmountLimit {
-		return nil, errors.New("weekly-amount limit must be greater than daily amount limit")
+	state, err := newAccountState(cfg)
+	if err != nil {
+		return nil, err
 	}
-	if cfg.NumWeeklyTxnsLimit > 0 &&
-		cfg.NumWeeklyTxnsLimit < cfg.NumDailyTxnsLimit {
-		return nil, errors.New(
-			"num of weekly-transactions must be greater than num of daily-transactions",
-		)
+	err = cfg.checkInvariants()
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.checkLimits(limits.limits())
+	if err != nil {
+		return nil, err
+	}
+	categoryLimits, err := cfg.categoryLimitsOf()
+	if err != nil {
+		return nil, err
+	}
+	fraudFailurePolicy := cfg.FraudFailurePolicy
+	if fraudFailurePolicy == "" {
+		fraudFailurePolicy = FraudFailOpen
+	}
+	var fraudChecker FraudChecker = NoopFraudChecker{}
+	if cfg.FraudChecker != nil {
+		fraudChecker = cfg.FraudChecker
+	}
+	var accClock clock.Clock = clock.RealClock{}
+	if cfg.Clock != nil {
+		accClock = cfg.Clock
+	}
+	duplicateDetector := cfg.DuplicateDetector
+	if duplicateDetector == nil {
+		duplicateDetector = NewScopedIDDetector(state.duplicateScope)
 	}
 
 	return &account{
 		log:       cfg.Log,
 		eventRepo: cfg.EventRepo,
 
-		accountDeposited:     cfg.AccountDeposited,
-		accountWithdrawn:     cfg.AccountWithdrawn,
 		duplicateTxn:         cfg.DuplicateTxn,
 		accountLimitExceeded: cfg.AccountLimitExceeded,
+		balanceSnapshot:      cfg.BalanceSnapshot,
+		snapshotEveryNTxns:   cfg.SnapshotEveryNTxns,
+		accountRecovered:     cfg.AccountRecovered,
+		partiallyWithdrawn:   cfg.PartiallyWithdrawn,
+		partialWithdrawal:    cfg.PartialWithdrawal,
+		globalTxnIDs:         cfg.GlobalTxnIDs,
+		rejectStaleTxns:      cfg.RejectStaleTxns,
+		verboseLimitErrors:   cfg.VerboseLimitErrors,
+		limitDetails:         cfg.LimitDetails,
 
-		dailyLimits: TxnRecord{
-			NumTxns:     cfg.NumDailyTxnsLimit,
-			TotalAmount: cfg.DailyTxnsAmountLimit,
-		},
-		weeklyLimits: TxnRecord{
-			NumTxns:     cfg.NumWeeklyTxnsLimit,
-			TotalAmount: cfg.WeeklyTxnsAmountLimit,
-		},
+		excludeZeroAmountCounts: cfg.ExcludeZeroAmountTxnCounts,
+		eventTimeFromTxn:        cfg.EventTimeFromTxn,
+
+		duplicateDetector: duplicateDetector,
+		ownsDetector:      cfg.DuplicateDetector == nil,
+
+		limits:         limits,
+		categoryLimits: categoryLimits,
+
+		clock:               accClock,
+		fraudChecker:        fraudChecker,
+		fraudCheckThreshold: cfg.FraudCheckThreshold,
+		fraudCheckTimeout:   fraudCheckTimeout(cfg.FraudCheckTimeoutSec),
+		fraudFailurePolicy:  fraudFailurePolicy,
 
-		dailyTxn:      make(map[int]map[int]TxnRecord),
-		weeklyTxn:     make(map[int]map[int]TxnRecord),
-		txnKeysRecord: make([]string, 0),
+		tracer: trace.OrNoop(cfg.Tracer),
+
+		accountState:    *state,
+		declinedTxnKeys: make(map[string]struct{}),
+	}, nil
+}
+
+// newAccountState creates new, empty accountState applying
+// event-actions and duplicate-scope from provided config.
+// Config is otherwise not validated.
+func newAccountState(cfg *AggregateCfg) (*accountState, error) {
+	duplicateScope := cfg.DuplicateScope
+	switch duplicateScope {
+	case "":
+		duplicateScope = DuplicateScopeCustomer
+	case DuplicateScopeCustomer, DuplicateScopeCustomerDay, DuplicateScopeCustomerWeek:
+	default:
+		return nil, fmt.Errorf("invalid duplicate-scope: %s", duplicateScope)
+	}
+
+	return &accountState{
+		accountDeposited: cfg.AccountDeposited,
+		accountWithdrawn: cfg.AccountWithdrawn,
+		accountSeeded:    cfg.AccountSeeded,
+		duplicateScope:   duplicateScope,
+		monthlyAllowance: cfg.MonthlyAllowance,
+		maxCarryOver:     cfg.MaxCarryOver,
+		bucketLocation:   cfg.BucketLocation,
+
+		dailyTxn:          make(map[int]map[int]TxnRecord),
+		weeklyTxn:         make(map[int]map[int]TxnRecord),
+		categoryDailyTxn:  make(map[categoryBucket]TxnRecord),
+		categoryWeeklyTxn: make(map[categoryBucket]TxnRecord),
+		monthlyTxn:        make(map[int]AllowanceRecord),
+		txnKeysRecord:     make(map[string]struct{}),
 	}, nil
 }
 
 func (a *account) handleProcessTxnCmd(cmd model.Cmd) error {
-	if cmd.Data() == nil {
+	if cmd.RawData() == nil {
 		a.log.Debugf("[CMD: %s] ignored command with nil data", cmd.ID())
 		return nil
 	}
 	logPrefix := fmt.Sprintf("[CMD-Action: %s]: [CMD: %s]:", cmd.Action(), cmd.ID())
 
 	a.log.Tracef("%s Processing transaction", logPrefix)
+	a.span = a.tracer.StartSpan(trace.SpanProcess, cmd.CorrelationKey())
+	defer a.span.End()
 	txn := &model.Transaction{}
-	err := json.Unmarshal(cmd.Data(), txn)
+	err := json.Unmarshal(cmd.RawData(), txn)
 	if err != nil {
 		return errors.Wrap(err, "error unmarshalling event-data")
 	}
 	logPrefix = fmt.Sprintf("%s [Txn: %s]:", logPrefix, txn.ID)
+	a.eventTime = time.Time{}
+	if a.eventTimeFromTxn {
+		a.eventTime = txn.Time.UTC()
+	}
 
-	a.log.Tracef("%s Loading aggregate", logPrefix)
-	err = a.loadAggregate(txn.CustomerID)
-	if err != nil {
-		return errors.Wrap(err, "error loading aggregate")
+	a.pruneBefore = a.windowStart(txn.Time)
+	if !a.loaded {
+		a.log.Tracef("%s Loading aggregate", logPrefix)
+		err = a.loadAggregate(txn.CustomerID)
+		if err != nil {
+			return errors.Wrap(err, "error loading aggregate")
+		}
+		a.loaded = a.retainState
 	}
+	a.pruneBuckets()
 
-	a.ensureYear(txn.Time.UTC().Year())
+	a.ensureBuckets(a.bucketKey(txn.Time))
+
+	// Replayed transactions already processed are skipped,
+	// so their results aren't published again.
+	if cmd.IsReplay() && a.hasResult(txn) {
+		a.log.Debugf("%s Skipped replayed transaction with existing result", logPrefix)
+		return nil
+	}
 
 	// Check duplicate-transaction
-	isUnique, err := a.checkDuplicateTxn(cmd.ID(), txn)
+	isUnique, err := a.checkDuplicateTxn(cmd, txn)
 	if err != nil {
 		return errors.Wrap(err, "errors validating transaction-uniqueness")
 	}
@@ -163,8 +702,24 @@ func (a *account) handleProcessTxnCmd(cmd model.Cmd) error {
 		return nil
 	}
 
+	// Check out-of-order transaction
+	isOrdered, err := a.checkStaleTxn(cmd, txn)
+	if err != nil {
+		return errors.Wrap(err, "errors validating transaction-order")
+	}
+	if !isOrdered {
+		return nil
+	}
+
+	// Withdrawals exceeding available funds are applied
+	// partially, so these pass funds-check of limits.
+	requestedAmount := txn.LoadAmount
+	if a.partialWithdrawal {
+		txn = a.capWithdrawal(txn)
+	}
+
 	// Validate daily-limits
-	dailyTxnRecord, err := a.checkDailyLimits(cmd.ID(), txn)
+	dailyTxnRecord, err := a.checkDailyLimits(cmd, txn)
 	if err != nil {
 		return errors.Wrap(err, "errors validating transaction daily-limits")
 	}
@@ -173,7 +728,7 @@ func (a *account) handleProcessTxnCmd(cmd model.Cmd) error {
 	}
 
 	// Validate weekly-limits
-	weeklyTxnRecord, err := a.checkWeeklyLimits(cmd.ID(), txn)
+	weeklyTxnRecord, err := a.checkWeeklyLimits(cmd, txn)
 	if err != nil {
 		return errors.Wrap(err, "errors validating transaction daily-limits")
 	}
@@ -181,6 +736,33 @@ func (a *account) handleProcessTxnCmd(cmd model.Cmd) error {
 		return nil
 	}
 
+	// Validate limits of transaction's category
+	categoryTxnRecords, err := a.checkCategoryLimits(cmd, txn)
+	if err != nil {
+		return errors.Wrap(err, "errors validating transaction category-limits")
+	}
+	if categoryTxnRecords == nil {
+		return nil
+	}
+
+	// Validate monthly-allowance
+	monthlyTxnRecord, err := a.checkMonthlyAllowance(cmd, txn)
+	if err != nil {
+		return errors.Wrap(err, "errors validating transaction monthly-allowance")
+	}
+	if monthlyTxnRecord == nil {
+		return nil
+	}
+
+	// Check for fraud
+	isAccepted, err := a.checkFraudSuspected(cmd, txn)
+	if err != nil {
+		return errors.Wrap(err, "errors checking transaction for fraud")
+	}
+	if !isAccepted {
+		return nil
+	}
+
 	accEvent := a.accountDeposited
 	if txn.LoadAmount < 0 {
 		accEvent = a.accountWithdrawn
@@ -191,13 +773,24 @@ func (a *account) handleProcessTxnCmd(cmd model.Cmd) error {
 	state := &State{
 		TxnID:       txn.ID,
 		CustID:      txn.CustomerID,
-		TxnTime:     txn.Time,
+		TxnTime:     txn.Time.UTC(),
+		IsTest:      txn.IsTest,
 		DailyTxn:    *dailyTxnRecord,
 		WeeklyTxn:   *weeklyTxnRecord,
+		MonthlyTxn:  *monthlyTxnRecord,
 		TotalAmount: a.balance + txn.LoadAmount,
+
+		LimitsVersion: a.limits.version,
+		InputSeq:      txn.InputSeq,
+		Version:       StateVersion,
+	}
+	if txn.LoadAmount != requestedAmount {
+		state.RequestedAmount = requestedAmount
+		state.AppliedAmount = txn.LoadAmount
 	}
+	categoryTxnRecords.setCategoryRecords(state, txn)
 	a.log.Tracef("%s Publishing success-event", logPrefix)
-	err = a.publishEvent(cmd.ID(), accEvent, state)
+	err = a.publishEvent(cmd, accEvent, state)
 	if err != nil {
 		return errors.Wrapf(
 			err,
@@ -205,6 +798,137 @@ func (a *account) handleProcessTxnCmd(cmd model.Cmd) error {
 		)
 	}
 	a.log.Tracef("%s Published success-event", logPrefix)
+	// Declined transactions aren't recorded
+	a.duplicateDetector.Record(txn.CustomerID, *txn)
+
+	err = a.snapshotBalance(cmd, state)
+	if err != nil {
+		return errors.Wrap(err, "error emitting balance-snapshot")
+	}
+	err = a.publishRecovery(cmd, state)
+	if err != nil {
+		return errors.Wrap(err, "error emitting account-recovery")
+	}
+	err = a.publishPartialWithdrawal(cmd, state)
+	if err != nil {
+		return errors.Wrap(err, "error emitting partial-withdrawal")
+	}
+	return nil
+}
+
+// capWithdrawal returns copy of withdrawal with its amount capped
+// at available funds, or transaction as is if it doesn't exceed
+// these. Withdrawals are still declined if no funds are available.
+func (a *account) capWithdrawal(txn *model.Transaction) *model.Transaction {
+	if txn.LoadAmount >= 0 {
+		return txn
+	}
+	available := a.availableFunds(txn)
+	if available <= 0 || -txn.LoadAmount <= available {
+		return txn
+	}
+	capped := *txn
+	capped.LoadAmount = -available
+	return &capped
+}
+
+// availableFunds returns most that can be withdrawn by
+// transaction, which is the balance, unless funds-check of
+// its daily or weekly window allows less (see #validateLimits).
+func (a *account) availableFunds(txn *model.Transaction) float64 {
+	key := a.bucketKey(txn.Time)
+	available := math.Min(a.balance, a.balance+a.dailyTxn[key.year][key.day].TotalAmount)
+	available = math.Min(available, a.balance+a.weeklyTxn[key.weekYear][key.week].TotalAmount)
+	return math.Max(available, 0)
+}
+
+// publishPartialWithdrawal publishes PartiallyWithdrawn
+// event if accepted transaction was partially applied.
+func (a *account) publishPartialWithdrawal(cmd model.Cmd, state *State) error {
+	if state.RequestedAmount == 0 {
+		return nil
+	}
+
+	logPrefix := fmt.Sprintf(
+		"[CMD: %s]: [Txn: %s]: [EventAction: %s]",
+		cmd.ID(), state.TxnID, a.partiallyWithdrawn,
+	)
+	a.log.Tracef("%s Publishing partial-withdrawal", logPrefix)
+	err := a.publishEvent(cmd, a.partiallyWithdrawn, &PartialWithdrawal{
+		CustID:  state.CustID,
+		TxnID:   state.TxnID,
+		TxnTime: state.TxnTime,
+
+		RequestedAmount: state.RequestedAmount,
+		AppliedAmount:   state.AppliedAmount,
+		Shortfall:       state.AppliedAmount - state.RequestedAmount,
+		Balance:         state.TotalAmount,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error publishing event: %s", a.partiallyWithdrawn)
+	}
+	a.log.Tracef("%s Published partial-withdrawal", logPrefix)
+	return nil
+}
+
+// publishRecovery publishes AccountRecovery event if accepted
+// transaction brought a non-positive balance above zero.
+func (a *account) publishRecovery(cmd model.Cmd, state *State) error {
+	if a.accountRecovered == "" || a.nonPositiveSince.IsZero() || state.TotalAmount <= 0 {
+		return nil
+	}
+
+	logPrefix := fmt.Sprintf(
+		"[CMD: %s]: [Txn: %s]: [EventAction: %s]",
+		cmd.ID(), state.TxnID, a.accountRecovered,
+	)
+	a.log.Tracef("%s Publishing account-recovery", logPrefix)
+	err := a.publishEvent(cmd, a.accountRecovered, &AccountRecovery{
+		CustID:  state.CustID,
+		TxnID:   state.TxnID,
+		TxnTime: state.TxnTime,
+
+		NonPositiveSince:    a.nonPositiveSince,
+		NonPositiveDuration: state.TxnTime.Sub(a.nonPositiveSince),
+		Balance:             state.TotalAmount,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error publishing event: %s", a.accountRecovered)
+	}
+	a.log.Tracef("%s Published account-recovery", logPrefix)
+	return nil
+}
+
+// snapshotBalance publishes BalanceSnapshot event if
+// accepted transaction is at configured interval.
+func (a *account) snapshotBalance(cmd model.Cmd, state *State) error {
+	if a.balanceSnapshot == "" {
+		return nil
+	}
+	numTxns := a.numTxns + 1
+	if numTxns%a.snapshotEveryNTxns != 0 {
+		return nil
+	}
+
+	logPrefix := fmt.Sprintf(
+		"[CMD: %s]: [Txn: %s]: [EventAction: %s]",
+		cmd.ID(), state.TxnID, a.balanceSnapshot,
+	)
+	a.log.Tracef("%s Publishing balance-snapshot", logPrefix)
+	err := a.publishEvent(cmd, a.balanceSnapshot, &BalanceSnapshot{
+		CustID:  state.CustID,
+		TxnID:   state.TxnID,
+		TxnTime: state.TxnTime,
+		NumTxns: numTxns,
+		Balance: state.TotalAmount,
+
+		DailyTxn:  state.DailyTxn,
+		WeeklyTxn: state.WeeklyTxn,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error publishing event: %s", a.balanceSnapshot)
+	}
+	a.log.Tracef("%s Published balance-snapshot", logPrefix)
 	return nil
 }
 
@@ -213,34 +937,210 @@ func (a *account) handleProcessTxnCmd(cmd model.Cmd) error {
 // - bool: Indicates if transaction was unique.
 // - error: Critical errors encountered while checking
 // 					for transaction uniqueness.
-func (a *account) checkDuplicateTxn(cmdID string, txn *model.Transaction) (bool, error) {
-	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmdID, txn.ID)
+func (a *account) checkDuplicateTxn(cmd model.Cmd, txn *model.Transaction) (bool, error) {
+	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmd.ID(), txn.ID)
 
 	a.log.Tracef("%s Validating transaction-uniqueness", logPrefix)
-	for _, txnID := range a.txnKeysRecord {
-		if txnID == txn.ID {
-			failure := &TxnFailure{
-				Txn:          *txn,
-				Error:        errors.New("duplicate transaction").Error(),
-				FailureCause: DuplicateTxn,
-			}
-			subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.duplicateTxn)
-
-			a.log.Tracef("%s Publishing failure-event", subLogPrefix)
-			err := a.publishEvent(cmdID, a.duplicateTxn, failure)
-			if err != nil {
-				return false, errors.Wrapf(
-					err,
-					"error publishing event: %s", a.duplicateTxn,
-				)
-			}
-			a.log.Tracef("%s Published failure-event", subLogPrefix)
-			return false, nil
+	failureErr := ""
+	isDuplicate, original, err := a.duplicateDetector.Check(txn.CustomerID, *txn)
+	if err != nil {
+		return false, errors.Wrap(err, "error checking transaction with duplicate-detector")
+	}
+	if isDuplicate {
+		if original != nil {
+			a.log.Debugf(
+				"%s Transaction is duplicate of transaction: %s at: %s",
+				logPrefix, original.TxnID, original.TxnTime.UTC().Format(time.RFC3339),
+			)
+		}
+		failureErr = "duplicate transaction"
+	} else if a.globalTxnIDs {
+		otherCustID, err := a.otherCustomerOfTxn(txn)
+		if err != nil {
+			return false, errors.Wrap(err, "error checking transaction-id of other customers")
+		}
+		if otherCustID != "" {
+			a.log.Debugf("%s Transaction-id was accepted for customer: %s", logPrefix, otherCustID)
+			failureErr = "duplicate transaction-id of another customer"
 		}
 	}
+
+	if failureErr != "" {
+		failure := &TxnFailure{
+			Txn:          *txn,
+			Error:        failureErr,
+			FailureCause: DuplicateTxn,
+		}
+		subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.duplicateTxn)
+
+		a.log.Tracef("%s Publishing failure-event", subLogPrefix)
+		err := a.publishEvent(cmd, a.duplicateTxn, failure)
+		if err != nil {
+			return false, errors.Wrapf(
+				err,
+				"error publishing event: %s", a.duplicateTxn,
+			)
+		}
+		a.log.Tracef("%s Published failure-event", subLogPrefix)
+		return false, nil
+	}
 	return true, nil
 }
 
+// otherCustomerOfTxn returns ID of another customer transaction
+// (within duplicate-scope) was accepted for, from records of
+// transaction-ID if event-repo indexes these, or otherwise by
+// scanning events in event-store. Returns blank string if
+// there's none.
+func (a *account) otherCustomerOfTxn(txn *model.Transaction) (string, error) {
+	key := a.txnKey(txn.ID, txn.Time)
+
+	fetcher, isIndexed := a.eventRepo.(eventutil.TxnIDFetcher)
+	if isIndexed {
+		records, err := fetcher.FetchByTxnID(txn.ID)
+		if err == nil {
+			for _, record := range records {
+				if record.AggregateID == txn.CustomerID {
+					continue
+				}
+				if record.Action != a.accountDeposited && record.Action != a.accountWithdrawn {
+					continue
+				}
+				if a.txnKey(record.TxnID, record.TxnTime) == key {
+					return record.AggregateID, nil
+				}
+			}
+			return "", nil
+		}
+		if !errors.Is(err, eventutil.ErrTxnIDsNotIndexed) {
+			return "", errors.Wrap(
+				eventutil.MarkFatal(err),
+				"error fetching transaction-id records from event-store",
+			)
+		}
+	}
+
+	events, err := a.eventRepo.FetchByIndex(0)
+	if err != nil {
+		return "", errors.Wrap(eventutil.MarkFatal(err), "error fetching events from event-store")
+	}
+
+	for _, event := range events {
+		if event.AggregateID() == txn.CustomerID {
+			continue
+		}
+		if event.Action() != a.accountDeposited && event.Action() != a.accountWithdrawn {
+			continue
+		}
+		state, err := DecodeState(event.RawData())
+		if err != nil {
+			return "", errors.Wrapf(err, "error unmarshalling data of event: %s", event.ID())
+		}
+		if state.TxnID == txn.ID && a.txnKey(state.TxnID, state.TxnTime) == key {
+			return event.AggregateID(), nil
+		}
+	}
+	return "", nil
+}
+
+// checkStaleTxn checks if transaction isn't earlier than latest
+// accepted transaction of account (see #isBeforeLastTxn), if
+// stale transactions are rejected. Also publishes
+// AccountLimitExceeded event on Bus.
+// Return params:
+// - bool: Indicates if transaction was accepted.
+// - error: Critical errors encountered while
+// 					publishing failure-event.
+func (a *account) checkStaleTxn(cmd model.Cmd, txn *model.Transaction) (bool, error) {
+	if !a.rejectStaleTxns || !a.isBeforeLastTxn(txn.ID, txn.Time) {
+		return true, nil
+	}
+	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmd.ID(), txn.ID)
+
+	errStr := fmt.Sprintf(
+		"transaction is earlier than latest transaction at: %s",
+		a.lastTxnTime.UTC().Format(time.RFC3339),
+	)
+	if txn.Time.Equal(a.lastTxnTime) {
+		errStr = fmt.Sprintf(
+			"transaction is ordered before latest transaction %s at same time: %s",
+			a.lastTxnID, a.lastTxnTime.UTC().Format(time.RFC3339),
+		)
+	}
+	failure := &TxnFailure{
+		Txn:          *txn,
+		Error:        errStr,
+		FailureCause: StaleTxn,
+	}
+	subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.accountLimitExceeded)
+
+	a.log.Tracef("%s Publishing failure-event", subLogPrefix)
+	err := a.publishEvent(cmd, a.accountLimitExceeded, failure)
+	if err != nil {
+		return false, errors.Wrapf(
+			err,
+			"error publishing event: %s", a.accountLimitExceeded,
+		)
+	}
+	a.log.Tracef("%s Published failure-event", subLogPrefix)
+	return false, nil
+}
+
+// isBeforeLastTxn returns true if transaction is ordered before
+// latest accepted transaction of account. Transactions are ordered
+// by time, and then by ID (lexicographically), so transactions with
+// identical timestamps (such as when truncated to seconds) have
+// same order regardless of order these arrived in.
+func (a *accountState) isBeforeLastTxn(txnID string, txnTime time.Time) bool {
+	if txnTime.Equal(a.lastTxnTime) {
+		return txnID < a.lastTxnID
+	}
+	return txnTime.Before(a.lastTxnTime)
+}
+
+// trackLastTxn records transaction as latest accepted transaction
+// of account, if it isn't ordered before current one (see
+// #isBeforeLastTxn). Ties don't affect limit-windows, since
+// transactions at same time are in same periods.
+func (a *accountState) trackLastTxn(txnID string, txnTime time.Time) {
+	if !a.isBeforeLastTxn(txnID, txnTime) {
+		a.lastTxnTime = txnTime
+		a.lastTxnID = txnID
+	}
+}
+
+// checkFraudSuspected checks transaction with fraud-checker.
+// Also publishes AccountLimitExceeded event on Bus.
+// Return params:
+// - bool: Indicates if transaction was accepted.
+// - error: Critical errors encountered while
+// 					publishing failure-event.
+func (a *account) checkFraudSuspected(cmd model.Cmd, txn *model.Transaction) (bool, error) {
+	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmd.ID(), txn.ID)
+
+	reason := a.checkFraud(logPrefix, txn)
+	if reason == "" {
+		return true, nil
+	}
+	failure := &TxnFailure{
+		Txn:          *txn,
+		Error:        fmt.Sprintf("fraud suspected: %s", reason),
+		FailureCause: FraudSuspected,
+	}
+	subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.accountLimitExceeded)
+
+	a.log.Tracef("%s Publishing failure-event", subLogPrefix)
+	err := a.publishEvent(cmd, a.accountLimitExceeded, failure)
+	if err != nil {
+		return false, errors.Wrapf(
+			err,
+			"error publishing event: %s", a.accountLimitExceeded,
+		)
+	}
+	a.log.Tracef("%s Published failure-event", subLogPrefix)
+	return false, nil
+}
+
 // checkDailyLimits checks if transaction passes daily-limits
 // for this account. Also publishes AccountLimitExceeded event
 // on Bus.
@@ -249,34 +1149,26 @@ func (a *account) checkDuplicateTxn(cmdID string, txn *model.Transaction) (bool,
 // - error: Critical errors encountered while validating
 // 					for daily-limits.
 func (a *account) checkDailyLimits(
-	cmdID string,
+	cmd model.Cmd,
 	txn *model.Transaction,
 ) (*TxnRecord, error) {
-	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmdID, txn.ID)
-
-	txnUTCTime := txn.Time.UTC()
-	txnDay := txnUTCTime.YearDay()
-	txnYear := txnUTCTime.Year()
+	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmd.ID(), txn.ID)
 
 	a.log.Tracef("%s Validating daily limits", logPrefix)
-	dailyTxnRecord := a.dailyTxn[txnYear][txnDay]
-	dailyTxnRecord.NumTxns++
-	dailyTxnRecord.TotalAmount += txn.LoadAmount
-
-	failureCause, err := a.validateLimits(dailyTxnRecord, a.dailyLimits)
+	dailyTxnRecord, failureCause, err := a.dailyRecordWith(txn)
 	if err != nil {
-		if failureCause == "" {
-			failureCause = DailyLimitsExceeded
-		}
 		failure := &TxnFailure{
 			Txn:          *txn,
-			Error:        errors.Wrap(err, "failed daily-limits validation").Error(),
+			Error:        err.Error(),
 			FailureCause: failureCause,
 		}
+		if a.limitDetails {
+			failure.setLimitDetails(err)
+		}
 		subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.accountLimitExceeded)
 
 		a.log.Tracef("%s Publishing failure-event", subLogPrefix)
-		err = a.publishEvent(cmdID, a.accountLimitExceeded, failure)
+		err = a.publishEvent(cmd, a.accountLimitExceeded, failure)
 		if err != nil {
 			return nil, errors.Wrapf(
 				err,
@@ -297,33 +1189,26 @@ func (a *account) checkDailyLimits(
 // - error: Critical errors encountered while validating
 // 					for weekly-limits.
 func (a *account) checkWeeklyLimits(
-	cmdID string,
+	cmd model.Cmd,
 	txn *model.Transaction,
 ) (*TxnRecord, error) {
-	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmdID, txn.ID)
-
-	txnUTCTime := txn.Time.UTC()
-	txnYear, txnWeek := txnUTCTime.ISOWeek()
+	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmd.ID(), txn.ID)
 
 	a.log.Tracef("%s Validating weekly limits", logPrefix)
-	weeklyTxnRecord := a.weeklyTxn[txnYear][txnWeek]
-	weeklyTxnRecord.NumTxns++
-	weeklyTxnRecord.TotalAmount += txn.LoadAmount
-
-	failureCause, err := a.validateLimits(weeklyTxnRecord, a.weeklyLimits)
+	weeklyTxnRecord, failureCause, err := a.weeklyRecordWith(txn)
 	if err != nil {
-		if failureCause == "" {
-			failureCause = WeeklyLimitsExceeded
-		}
 		failure := &TxnFailure{
 			Txn:          *txn,
-			Error:        errors.Wrap(err, "failed weekly-limits validation").Error(),
+			Error:        err.Error(),
 			FailureCause: failureCause,
 		}
+		if a.limitDetails {
+			failure.setLimitDetails(err)
+		}
 		subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.accountLimitExceeded)
 
 		a.log.Tracef("%s Publishing failure-event", subLogPrefix)
-		err = a.publishEvent(cmdID, a.accountLimitExceeded, failure)
+		err = a.publishEvent(cmd, a.accountLimitExceeded, failure)
 		if err != nil {
 			return nil, errors.Wrapf(
 				err,
@@ -336,89 +1221,430 @@ func (a *account) checkWeeklyLimits(
 	return &weeklyTxnRecord, nil
 }
 
-func (a *account) publishEvent(correlationKey string, action model.EventAction, data interface{}) error {
+// dailyRecordWith returns daily-record of account including
+// transaction, validated against daily-limits. Errors if
+// transaction fails validation, along with failure-cause.
+func (a *account) dailyRecordWith(txn *model.Transaction) (TxnRecord, TxnFailureCause, error) {
+	key := a.bucketKey(txn.Time)
+	dailyTxnRecord := a.dailyTxn[key.year][key.day]
+	if a.countsTxn(txn) {
+		dailyTxnRecord.NumTxns++
+	}
+	dailyTxnRecord.TotalAmount += txn.LoadAmount
+
+	failureCause, err := a.validateLimits(
+		txn, dailyTxnRecord, a.limits.dailyLimits,
+		DailyNumTxnsLimit, DailyAmountLimit,
+	)
+	if err != nil {
+		if failureCause == "" {
+			failureCause = DailyLimitsExceeded
+		}
+		return dailyTxnRecord, failureCause, errors.Wrap(err, "failed daily-limits validation")
+	}
+	return dailyTxnRecord, "", nil
+}
+
+// weeklyRecordWith returns weekly-record of account including
+// transaction, validated against weekly-limits. Errors if
+// transaction fails validation, along with failure-cause.
+func (a *account) weeklyRecordWith(txn *model.Transaction) (TxnRecord, TxnFailureCause, error) {
+	key := a.bucketKey(txn.Time)
+	weeklyTxnRecord := a.weeklyTxn[key.weekYear][key.week]
+	if a.countsTxn(txn) {
+		weeklyTxnRecord.NumTxns++
+	}
+	weeklyTxnRecord.TotalAmount += txn.LoadAmount
+
+	failureCause, err := a.validateLimits(
+		txn, weeklyTxnRecord, a.limits.weeklyLimits,
+		WeeklyNumTxnsLimit, WeeklyAmountLimit,
+	)
+	if err != nil {
+		if failureCause == "" {
+			failureCause = WeeklyLimitsExceeded
+		}
+		return weeklyTxnRecord, failureCause, errors.Wrap(err, "failed weekly-limits validation")
+	}
+	return weeklyTxnRecord, "", nil
+}
+
+// countsTxn returns false if transaction isn't counted
+// in number of transactions of its limit-windows.
+func (a *account) countsTxn(txn *model.Transaction) bool {
+	return !a.excludeZeroAmountCounts || txn.LoadAmount != 0
+}
+
+// publishEvent stores and publishes event caused by
+// command, carrying causation and correlation of command.
+// Event is timestamped with event-time of command, if set.
+func (a *account) publishEvent(cmd model.Cmd, action model.EventAction, data interface{}) error {
 	event, err := model.NewEvent(&model.EventCfg{
+		Time:           a.eventTime,
 		AggregateID:    a.custID,
-		CorrelationKey: correlationKey,
+		CausationID:    cmd.CausationID(),
+		CausationKey:   cmd.ID(),
+		CorrelationKey: cmd.CorrelationKey(),
+		InputSeq:       cmd.InputSeq(),
 		Action:         action,
 		Data:           data,
 	})
 	if err != nil {
 		return errors.Wrap(err, "error creating event")
 	}
+	// So span doesn't overlap with next stage
+	a.span.End()
 	err = a.eventRepo.InsertAndPublish(event)
-	return errors.Wrap(err, "error storing event in event-repo")
+	if err != nil {
+		return errors.Wrap(eventutil.MarkFatal(err), "error storing event in event-repo")
+	}
+	if a.retainState {
+		a.published = append(a.published, event)
+	}
+	return nil
+}
+
+// reset clears account-state, keeping its config,
+// so account is loaded again on next command.
+func (a *account) reset() {
+	a.custID = ""
+	a.pruneBefore = time.Time{}
+	a.dailyTxn = make(map[int]map[int]TxnRecord)
+	a.weeklyTxn = make(map[int]map[int]TxnRecord)
+	a.categoryDailyTxn = make(map[categoryBucket]TxnRecord)
+	a.categoryWeeklyTxn = make(map[categoryBucket]TxnRecord)
+	a.monthlyTxn = make(map[int]AllowanceRecord)
+	a.balance = 0
+	a.nonPositiveSince = time.Time{}
+	a.negativeOpening = false
+	a.lastTxnTime = time.Time{}
+	a.lastTxnID = ""
+	a.numTxns = 0
+	a.txnKeysRecord = make(map[string]struct{})
+	a.declinedTxnKeys = make(map[string]struct{})
+	if a.ownsDetector {
+		a.duplicateDetector = NewScopedIDDetector(a.duplicateScope)
+	}
+
+	a.loaded = false
+	a.published = nil
+}
+
+// applyPublished applies events published while handling
+// last command, so retained state includes these without
+// reloading aggregate.
+func (a *account) applyPublished() error {
+	for _, event := range a.published {
+		err := a.applyEvent(event)
+		if err != nil {
+			return errors.Wrap(err, "error applying event")
+		}
+		err = a.recordDeclined(event)
+		if err != nil {
+			return errors.Wrap(err, "error recording declined transaction")
+		}
+	}
+	a.published = a.published[:0]
+	return nil
 }
 
 // TxnFailureCause is specified if there's a special/specific error.
 // Otherwise TxnFailureCause is blank on generic errors.
+// Errors of exceeded limits are *limitError, with provided
+// limit-types of window being validated.
 func (a *account) validateLimits(
+	txn *model.Transaction,
 	currValues TxnRecord,
 	limits TxnRecord,
+	numTxnsLimitType LimitType,
+	amountLimitType LimitType,
 ) (TxnFailureCause, error) {
-	if a.balance+currValues.TotalAmount < 0 {
+	// Deposits are accepted on accounts seeded overdrawn,
+	// so these can recover to a positive balance.
+	isRecoveringDeposit := txn.LoadAmount >= 0 && a.negativeOpening
+	if !isRecoveringDeposit && a.balance+currValues.TotalAmount < 0 {
 		return InsufficientFunds, errors.New("balance less than zero")
 	}
+	return "", a.exceededLimit(currValues, limits, numTxnsLimitType, amountLimitType)
+}
+
+// exceededLimit returns *limitError if values of a limit-window
+// exceed its limits, with provided limit-types of window.
+func (a *account) exceededLimit(
+	currValues TxnRecord,
+	limits TxnRecord,
+	numTxnsLimitType LimitType,
+	amountLimitType LimitType,
+) error {
 	if limits.NumTxns > 0 && currValues.NumTxns > limits.NumTxns {
-		return "", errors.New("limit exceeded for number of deposits")
+		return &limitError{
+			limitType:    numTxnsLimitType,
+			limitValue:   float64(limits.NumTxns),
+			currentValue: float64(currValues.NumTxns),
+			msg:          "limit exceeded for number of deposits",
+		}
 	}
 	if limits.TotalAmount > 0 && currValues.TotalAmount > limits.TotalAmount {
-		return "", fmt.Errorf(
+		msg := fmt.Sprintf(
 			"limit exceeded for total load-value by: $%.2f",
-			(currValues.TotalAmount - a.dailyLimits.TotalAmount),
+			(currValues.TotalAmount - limits.TotalAmount),
 		)
+		if a.verboseLimitErrors {
+			msg += fmt.Sprintf(
+				" (total: $%.2f, limit: $%.2f)",
+				currValues.TotalAmount, limits.TotalAmount,
+			)
+		}
+		return &limitError{
+			limitType:    amountLimitType,
+			limitValue:   limits.TotalAmount,
+			currentValue: currValues.TotalAmount,
+			msg:          msg,
+		}
 	}
 
-	return "", nil
+	return nil
 }
 
+// loadAggregate rebuilds account-state from its events. If
+// event-repo indexes transaction-IDs (see eventutil.TxnIDFetcher),
+// only events relevant to limits are decoded (see #replayBounded).
 func (a *account) loadAggregate(custID string) error {
 	a.custID = custID
+	// Counted again from events
+	a.numTxns = 0
+
+	var records []eventutil.TxnIDRecord
+	fetcher, isIndexed := a.eventRepo.(eventutil.TxnIDFetcher)
+	if isIndexed {
+		// Fetched before events, so every
+		// record has its event fetched.
+		var err error
+		records, err = fetcher.FetchIDs(custID)
+		if errors.Is(err, eventutil.ErrTxnIDsNotIndexed) {
+			isIndexed = false
+		} else if err != nil {
+			return errors.Wrap(eventutil.MarkFatal(err), "error fetching transaction-ids from event-store")
+		}
+	}
 	events, err := a.eventRepo.Fetch(custID)
 	if err != nil {
-		return errors.Wrap(err, "error fetching events from event-store")
+		return errors.Wrap(eventutil.MarkFatal(err), "error fetching events from event-store")
+	}
+	if isIndexed {
+		return a.replayBounded(events, records)
 	}
+	return a.replay(events)
+}
 
+// replay rebuilds account-state by applying all of its events.
+func (a *account) replay(events []model.Event) error {
+	// Balance after events applied so far,
+	// for amounts of accepted transactions.
+	balance := 0.0
 	for _, event := range events {
+		prevBalance := balance
 		err := a.applyEvent(event)
 		if err != nil {
 			return errors.Wrap(err, "error applying event")
 		}
+		err = a.recordDeclined(event)
+		if err != nil {
+			return errors.Wrap(err, "error recording declined transaction")
+		}
+		err = a.recordAccepted(event, prevBalance)
+		if err != nil {
+			return errors.Wrap(err, "error recording accepted transaction")
+		}
+		if a.changesBalance(event) {
+			balance = a.balance
+		}
 	}
 
 	return nil
 }
 
-func (a *account) applyEvent(event model.Event) error {
-	state := &State{}
-	err := json.Unmarshal(event.Data(), state)
+// recordAccepted records transaction of success-event with
+// duplicate-detector, so detector's state is rebuilt from
+// events. Load-amount of transaction is derived from balance
+// before event, since State doesn't include it.
+func (a *account) recordAccepted(event model.Event, prevBalance float64) error {
+	if !a.changesBalance(event) || event.Action() == a.accountSeeded {
+		return nil
+	}
+	state, err := DecodeState(event.RawData())
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling event-data")
+	}
+	a.duplicateDetector.Record(a.custID, model.Transaction{
+		ID:         state.TxnID,
+		CustomerID: a.custID,
+		LoadAmount: state.TotalAmount - prevBalance,
+		Time:       state.TxnTime,
+		IsTest:     state.IsTest,
+		InputSeq:   state.InputSeq,
+		Category:   state.Category,
+	})
+	return nil
+}
+
+// recordDeclined records transaction of limit-exceeded event
+// as declined. Duplicate-transaction events aren't recorded,
+// since their transaction already has an accepted result.
+func (a *account) recordDeclined(event model.Event) error {
+	if event.Action() != a.accountLimitExceeded {
+		return nil
+	}
+	failure := &TxnFailure{}
+	err := json.Unmarshal(event.RawData(), failure)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling event-data")
+	}
+	a.declinedTxnKeys[a.txnKey(failure.Txn.ID, failure.Txn.Time)] = struct{}{}
+	return nil
+}
+
+// hasResult returns true if transaction was
+// already accepted or declined by account.
+func (a *account) hasResult(txn *model.Transaction) bool {
+	key := a.txnKey(txn.ID, txn.Time)
+	if _, exists := a.txnKeysRecord[key]; exists {
+		return true
+	}
+	_, exists := a.declinedTxnKeys[key]
+	return exists
+}
+
+func (a *accountState) applyEvent(event model.Event) error {
+	// Opening balance is carried over from another system,
+	// so limit-windows start empty, and only balance is set.
+	if a.accountSeeded != "" && event.Action() == a.accountSeeded {
+		seed := &OpeningBalance{}
+		err := json.Unmarshal(event.RawData(), seed)
+		if err != nil {
+			return errors.Wrap(err, "error unmarshalling event-data")
+		}
+		a.balance = seed.Balance
+		a.negativeOpening = seed.Balance < 0
+		a.nonPositiveSince = time.Time{}
+		a.trackNonPositive(seed.AsOf)
+		return nil
+	}
+	// Failure-events are stored for same aggregate,
+	// but don't change account's state.
+	if event.Action() != a.accountDeposited && event.Action() != a.accountWithdrawn {
+		return nil
+	}
+
+	state, err := DecodeState(event.RawData())
 	if err != nil {
 		return errors.Wrap(err, "error unmarshalling event-data")
 	}
 
-	txnUTCTime := state.TxnTime.UTC()
-	txnYear, txnWeek := txnUTCTime.ISOWeek()
-	txnDay := txnUTCTime.YearDay()
+	key := a.bucketKey(state.TxnTime)
 
-	a.ensureYear(txnYear)
+	// Period-records are only needed for current
+	// limits-window. Every state carries totals
+	// for its period, so older states can be skipped.
+	if !state.TxnTime.Before(a.pruneBefore) {
+		a.ensureBuckets(key)
 
-	a.dailyTxn[txnYear][txnDay] = state.DailyTxn
-	a.weeklyTxn[txnYear][txnWeek] = state.WeeklyTxn
-	a.txnKeysRecord = append(a.txnKeysRecord, state.TxnID)
+		a.dailyTxn[key.year][key.day] = state.DailyTxn
+		a.weeklyTxn[key.weekYear][key.week] = state.WeeklyTxn
+		a.applyCategoryState(state, key)
+	}
+	a.monthlyTxn[key.month] = state.MonthlyTxn
+	a.txnKeysRecord[a.txnKey(state.TxnID, state.TxnTime)] = struct{}{}
 
 	a.balance = state.TotalAmount
+	a.trackNonPositive(state.TxnTime)
+	a.trackLastTxn(state.TxnID, state.TxnTime)
+	a.numTxns++
 
 	return nil
 }
 
-func (a *account) ensureYear(year int) {
-	_, found := a.dailyTxn[year]
+// changesBalance returns true if event sets
+// balance of account once applied.
+func (a *accountState) changesBalance(event model.Event) bool {
+	switch event.Action() {
+	case a.accountDeposited, a.accountWithdrawn:
+		return true
+	}
+	return a.accountSeeded != "" && event.Action() == a.accountSeeded
+}
+
+// trackNonPositive records time balance went non-positive,
+// and clears it once balance is positive again.
+func (a *accountState) trackNonPositive(at time.Time) {
+	switch {
+	case a.balance > 0:
+		a.nonPositiveSince = time.Time{}
+	case a.nonPositiveSince.IsZero():
+		a.nonPositiveSince = at
+	}
+}
+
+// ensureBuckets creates records of years containing
+// daily and weekly buckets of provided key.
+func (a *accountState) ensureBuckets(key bucketKey) {
+	_, found := a.dailyTxn[key.year]
 	if !found {
-		a.dailyTxn[year] = make(map[int]TxnRecord)
+		a.dailyTxn[key.year] = make(map[int]TxnRecord)
 	}
 
-	_, found = a.weeklyTxn[year]
+	_, found = a.weeklyTxn[key.weekYear]
 	if !found {
-		a.weeklyTxn[year] = make(map[int]TxnRecord)
+		a.weeklyTxn[key.weekYear] = make(map[int]TxnRecord)
+	}
+}
+
+// txnKey returns key for tracking uniqueness
+// of transaction-ID as per duplicate-scope.
+func (a *accountState) txnKey(txnID string, txnTime time.Time) string {
+	return scopedTxnKey(a.duplicateScope, txnID, txnTime)
+}
+
+// scopedTxnKey returns key for tracking uniqueness
+// of transaction-ID as per provided duplicate-scope.
+func scopedTxnKey(scope DuplicateScope, txnID string, txnTime time.Time) string {
+	key := bucketKeyOf(txnTime, time.UTC)
+
+	switch scope {
+	case DuplicateScopeCustomerDay:
+		return fmt.Sprintf("%s/%d-%d", txnID, key.year, key.day)
+	case DuplicateScopeCustomerWeek:
+		return fmt.Sprintf("%s/%d-W%d", txnID, key.weekYear, key.week)
+	default:
+		return txnID
+	}
+}
+
+// pruneBuckets removes daily/weekly records for
+// periods that started before pruneBefore.
+func (a *accountState) pruneBuckets() {
+	for year, days := range a.dailyTxn {
+		for day := range days {
+			dayStart := a.dayStart(year, day)
+			if dayStart.Before(a.pruneBefore) {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(a.dailyTxn, year)
+		}
+	}
+
+	for year, weeks := range a.weeklyTxn {
+		for week := range weeks {
+			weekStart := a.weekStart(year, week)
+			if weekStart.Before(a.pruneBefore) {
+				delete(weeks, week)
+			}
+		}
+		if len(weeks) == 0 {
+			delete(a.weeklyTxn, year)
+		}
 	}
+	a.pruneCategoryBuckets()
 }
@@ -2,6 +2,10 @@ package account
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
 	"sync"
@@ -14,6 +18,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
+	"github.com/Jaskaranbir/es-bank-account/clock"
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
 	"github.com/Jaskaranbir/es-bank-account/model"
@@ -53,6 +58,8 @@ var _ = Describe("Account", func() {
 		// time should match txnTimeFmt
 		time       string
 		loadAmount float64
+		isReplay   bool
+		category   string
 	}
 
 	var bus eventutil.Bus
@@ -75,12 +82,14 @@ var _ = Describe("Account", func() {
 			}
 
 			cmd, err := model.NewCmd(&model.CmdCfg{
-				Action: ProcessTxnCmd,
+				Action:   ProcessTxnCmd,
+				IsReplay: cfg.isReplay,
 				Data: &model.Transaction{
 					ID:         cfg.txnID,
 					CustomerID: cfg.customerID,
 					LoadAmount: cfg.loadAmount,
 					Time:       txnUTCTime1,
+					Category:   cfg.category,
 				},
 			})
 			if err != nil {
@@ -95,6 +104,30 @@ var _ = Describe("Account", func() {
 		return nil
 	}
 
+	// newTestAccount replaces account-aggregate under test with
+	// a new instance using same event-repo, so existing events
+	// are loaded on next command. Options modify default config.
+	var newTestAccount = func(limits Limits, opts ...func(*AggregateCfg)) error {
+		snapshot, err := newLimitsSnapshot(0, limits)
+		if err != nil {
+			return errors.Wrap(err, "error creating limits-snapshot")
+		}
+		cfg := &AggregateCfg{
+			Log:       logger.NewStdLogger("Account"),
+			EventRepo: eventRepo,
+
+			AccountDeposited:     AccountDepositedEvent,
+			AccountWithdrawn:     AccountWithdrawnEvent,
+			DuplicateTxn:         DuplicateTxnEvent,
+			AccountLimitExceeded: AccountLimitExceededEvent,
+		}
+		for _, opt := range opts {
+			opt(cfg)
+		}
+		acc, err = newAccount(cfg, snapshot)
+		return err
+	}
+
 	BeforeSuite(func() {
 		SetDefaultEventuallyTimeout(busMsgReceiveTimeoutSec * time.Second)
 	})
@@ -112,15 +145,7 @@ var _ = Describe("Account", func() {
 		})
 		Expect(err).ToNot(HaveOccurred())
 
-		acc, err = newAccount(&AggregateCfg{
-			Log:       logger.NewStdLogger("Account"),
-			EventRepo: eventRepo,
-
-			AccountDeposited:     AccountDepositedEvent,
-			AccountWithdrawn:     AccountWithdrawnEvent,
-			DuplicateTxn:         DuplicateTxnEvent,
-			AccountLimitExceeded: AccountLimitExceededEvent,
-
+		err = newTestAccount(Limits{
 			DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
 			NumDailyTxnsLimit:     NumDailyTxnsLimit,
 			WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
@@ -135,15 +160,7 @@ var _ = Describe("Account", func() {
 
 	When("creating new account-aggregate instance and weekly limits are specified", func() {
 		It("errors if weekly-amount limit is less than daily-amount limit", func() {
-			_, err := newAccount(&AggregateCfg{
-				Log:       logger.NewStdLogger("Account"),
-				EventRepo: eventRepo,
-
-				AccountDeposited:     AccountDepositedEvent,
-				AccountWithdrawn:     AccountWithdrawnEvent,
-				DuplicateTxn:         DuplicateTxnEvent,
-				AccountLimitExceeded: AccountLimitExceededEvent,
-
+			_, err := newLimitsSnapshot(0, Limits{
 				DailyTxnsAmountLimit:  100,
 				NumDailyTxnsLimit:     NumDailyTxnsLimit,
 				WeeklyTxnsAmountLimit: 99,
@@ -153,15 +170,7 @@ var _ = Describe("Account", func() {
 		})
 
 		It("errors if num of weekly-txns are greater than num of daily-txns", func() {
-			_, err := newAccount(&AggregateCfg{
-				Log:       logger.NewStdLogger("Account"),
-				EventRepo: eventRepo,
-
-				AccountDeposited:     AccountDepositedEvent,
-				AccountWithdrawn:     AccountWithdrawnEvent,
-				DuplicateTxn:         DuplicateTxnEvent,
-				AccountLimitExceeded: AccountLimitExceededEvent,
-
+			_, err := newLimitsSnapshot(0, Limits{
 				DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
 				NumDailyTxnsLimit:     4,
 				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
@@ -276,6 +285,70 @@ var _ = Describe("Account", func() {
 			Expect(txnFailure.Txn.ID).To(Equal("10"))
 		})
 
+		It("skips replayed transactions which already have a result", func() {
+			custID := "1"
+			txns := []mockCmdCfg{
+				{
+					txnID:      "10",
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-05T03:04:06Z",
+				},
+				// Declined, exceeds daily-amount limit
+				{
+					txnID:      "11",
+					customerID: custID,
+					loadAmount: DailyTxnsAmountLimit,
+					time:       "2000-01-05T04:04:06Z",
+				},
+			}
+			err := mockCmd(txns...)
+			Expect(err).ToNot(HaveOccurred())
+			events, err := eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(2))
+
+			for i := range txns {
+				txns[i].isReplay = true
+			}
+			err = mockCmd(txns...)
+			Expect(err).ToNot(HaveOccurred())
+
+			replayedEvents, err := eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(replayedEvents).To(Equal(events))
+		})
+
+		It("processes replayed transactions without a result", func() {
+			custID := "1"
+			err := mockCmd(mockCmdCfg{
+				txnID:      "10",
+				customerID: custID,
+				loadAmount: 100,
+				time:       "2000-01-05T03:04:06Z",
+				isReplay:   true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			events, err := eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Action()).To(Equal(AccountDepositedEvent))
+
+			// Not a replay, so declined as duplicate
+			err = mockCmd(mockCmdCfg{
+				txnID:      "10",
+				customerID: custID,
+				loadAmount: 100,
+				time:       "2000-01-05T03:04:06Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			events, err = eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(2))
+			Expect(events[1].Action()).To(Equal(DuplicateTxnEvent))
+		})
+
 		It("declines transaction when daily limit for num of transactions exceeds", func() {
 			limitExceededSub, err := bus.Subscribe(AccountLimitExceededEvent.String())
 			Expect(err).ToNot(HaveOccurred())
@@ -536,11 +609,37 @@ var _ = Describe("Account", func() {
 		})
 	})
 
-	When("daily and weekly limits are unspecified", func() {
-		JustBeforeEach(func() {
-			var err error
+	When("duplicate-scope is configured", func() {
+		var replayWithScope = func(scope DuplicateScope) {
+			Expect(newTestAccount(Limits{}, func(cfg *AggregateCfg) {
+				cfg.DuplicateScope = scope
+			})).To(Succeed())
+		}
 
-			acc, err = newAccount(&AggregateCfg{
+		// Returns ID of transaction declined as duplicate,
+		// or blank string if transaction was accepted.
+		var expectResult = func(
+			depositedSub <-chan interface{},
+			duplicateSub <-chan interface{},
+		) string {
+			select {
+			case <-depositedSub:
+				return ""
+			case msg := <-duplicateSub:
+				event := msg.(model.Event)
+				txnFailure := &TxnFailure{}
+				err := json.Unmarshal(event.Data(), txnFailure)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(txnFailure.FailureCause).To(Equal(DuplicateTxn))
+				return txnFailure.Txn.ID
+			case <-time.After(busMsgReceiveTimeoutSec * time.Second):
+				Fail("timed-out waiting for transaction-result")
+			}
+			return ""
+		}
+
+		It("errors on invalid scope", func() {
+			_, err := newAccount(&AggregateCfg{
 				Log:       logger.NewStdLogger("Account"),
 				EventRepo: eventRepo,
 
@@ -549,49 +648,2128 @@ var _ = Describe("Account", func() {
 				DuplicateTxn:         DuplicateTxnEvent,
 				AccountLimitExceeded: AccountLimitExceededEvent,
 
-				DailyTxnsAmountLimit:  0,
-				NumDailyTxnsLimit:     0,
-				WeeklyTxnsAmountLimit: 0,
-				NumWeeklyTxnsLimit:    0,
-			})
-			Expect(err).ToNot(HaveOccurred())
+				DuplicateScope: "invalid",
+			}, limitsSnapshot{})
+			Expect(err).To(HaveOccurred())
 		})
 
-		It("allows unlimited daily and weekly transactions", func() {
-			accDepositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+		It("checks transaction-uniqueness within scope", func() {
+			depositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			duplicateSub, err := bus.Subscribe(DuplicateTxnEvent.String())
 			Expect(err).ToNot(HaveOccurred())
-
-			expectedNumTxns := 100
 
 			custID := "1"
-			mockCmds := make([]mockCmdCfg, 0)
-			// All transactions occur on same day,
-			// so we test daily/weekly at same time
-			for i := 0; i < expectedNumTxns; i++ {
-				mockCmds = append(mockCmds, mockCmdCfg{
-					txnID:      strconv.Itoa(i),
+			var processTxn = func(day string) string {
+				err := mockCmd(mockCmdCfg{
+					txnID:      "10",
 					customerID: custID,
-					loadAmount: float64(10000 * (i + 1)),
-					time:       "2000-01-05T00:00:01Z",
+					loadAmount: 100,
+					time:       "2000-01-" + day + "T10:00:00Z",
 				})
+				Expect(err).ToNot(HaveOccurred())
+				return expectResult(depositedSub, duplicateSub)
 			}
 
-			wg := &sync.WaitGroup{}
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				defer GinkgoRecover()
-				for i := 0; i < expectedNumTxns; i++ {
-					event := &model.Event{}
-					Eventually(accDepositedSub).Should(Receive(event))
-					Expect(event.Action()).To(Equal(AccountDepositedEvent))
+			replayWithScope(DuplicateScopeCustomerDay)
+			Expect(processTxn("03")).To(BeEmpty())
+			// Same ID is unique on next day
+			Expect(processTxn("04")).To(BeEmpty())
+			Expect(processTxn("04")).To(Equal("10"))
+
+			// Full replay re-derives keys as per scope
+			replayWithScope(DuplicateScopeCustomerDay)
+			Expect(processTxn("04")).To(Equal("10"))
+			Expect(processTxn("05")).To(BeEmpty())
+
+			replayWithScope(DuplicateScopeCustomerWeek)
+			// Same week as previous transactions
+			Expect(processTxn("06")).To(Equal("10"))
+			// Next ISO-week
+			Expect(processTxn("10")).To(BeEmpty())
+
+			replayWithScope(DuplicateScopeCustomer)
+			Expect(processTxn("11")).To(Equal("10"))
+		})
+	})
+
+	// Other customers of transaction are found from indexed
+	// transaction-IDs, without scanning event-store.
+	for _, isIndexed := range []bool{false, true} {
+		isIndexed := isIndexed
+
+		When(fmt.Sprintf("transaction-ids are checked globally (indexed event-store: %t)", isIndexed), func() {
+			// Every account-instance handles a single customer,
+			// so instance is replaced for each customer.
+			var globalTxnIDs = func(cfg *AggregateCfg) {
+				cfg.GlobalTxnIDs = true
+			}
+
+			BeforeEach(func() {
+				repo, err := newReplayRepo(bus, isIndexed)
+				Expect(err).ToNot(HaveOccurred())
+				eventRepo = repo
+				if isIndexed {
+					eventRepo = &noScanRepo{repo.(*eventutil.LoggedEventRepo)}
 				}
-			}()
+			})
 
-			// Add/process sample transactions
-			err = mockCmd(mockCmds...)
+			var processTxn = func(txnID string, custID string) {
+				err := mockCmd(mockCmdCfg{
+					txnID:      txnID,
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-05T10:00:00Z",
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			It("declines transaction-id accepted for another customer", func() {
+				duplicateSub, err := bus.Subscribe(DuplicateTxnEvent.String())
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(newTestAccount(Limits{}, globalTxnIDs)).To(Succeed())
+				processTxn("10", "1")
+				Expect(newTestAccount(Limits{}, globalTxnIDs)).To(Succeed())
+				processTxn("10", "2")
+				processTxn("20", "2")
+
+				event := model.Event{}
+				Eventually(duplicateSub).Should(Receive(&event))
+				Expect(event.AggregateID()).To(Equal("2"))
+				txnFailure := &TxnFailure{}
+				err = json.Unmarshal(event.Data(), txnFailure)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(txnFailure.FailureCause).To(Equal(DuplicateTxn))
+				Expect(txnFailure.Txn.ID).To(Equal("10"))
+				Expect(txnFailure.Error).To(ContainSubstring("another customer"))
+				Consistently(duplicateSub).ShouldNot(Receive())
+
+				events, err := eventRepo.Fetch("2")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(events).To(HaveLen(2))
+				Expect(events[0].Action()).To(Equal(DuplicateTxnEvent))
+				Expect(events[1].Action()).To(Equal(AccountDepositedEvent))
+			})
+
+			It("accepts same transaction-id for other customers by default", func() {
+				Expect(newTestAccount(Limits{})).To(Succeed())
+				processTxn("10", "1")
+				Expect(newTestAccount(Limits{})).To(Succeed())
+				processTxn("10", "2")
+
+				events, err := eventRepo.Fetch("2")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(events).To(HaveLen(1))
+				Expect(events[0].Action()).To(Equal(AccountDepositedEvent))
+			})
+		})
+	}
+
+	When("stale transactions are rejected", func() {
+		var rejectStaleTxns = func(cfg *AggregateCfg) {
+			cfg.RejectStaleTxns = true
+		}
+
+		var processTxns = func() {
+			err := mockCmd(
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 100, time: "2000-01-05T10:00:00Z"},
+				// Same time as latest isn't stale
+				mockCmdCfg{txnID: "2", customerID: "1", loadAmount: 100, time: "2000-01-05T10:00:00Z"},
+				// Arrives after a later transaction
+				mockCmdCfg{txnID: "3", customerID: "1", loadAmount: 100, time: "2000-01-04T23:00:00Z"},
+				mockCmdCfg{txnID: "4", customerID: "1", loadAmount: 100, time: "2000-01-06T10:00:00Z"},
+			)
 			Expect(err).ToNot(HaveOccurred())
-			wg.Wait()
+		}
+
+		It("declines transaction earlier than latest accepted transaction", func() {
+			Expect(newTestAccount(Limits{}, rejectStaleTxns)).To(Succeed())
+			processTxns()
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(4))
+			Expect(events[2].Action()).To(Equal(AccountLimitExceededEvent))
+			txnFailure := &TxnFailure{}
+			err = json.Unmarshal(events[2].Data(), txnFailure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(txnFailure.FailureCause).To(Equal(StaleTxn))
+			Expect(txnFailure.Txn.ID).To(Equal("3"))
+			Expect(txnFailure.Error).To(ContainSubstring("2000-01-05T10:00:00Z"))
+
+			// Declined transaction isn't counted in balance
+			state := &State{}
+			err = json.Unmarshal(events[3].Data(), state)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.TxnID).To(Equal("4"))
+			Expect(state.TotalAmount).To(Equal(float64(300)))
+		})
+
+		It("orders transactions at same time by ID", func() {
+			Expect(newTestAccount(Limits{}, rejectStaleTxns)).To(Succeed())
+			err := mockCmd(
+				mockCmdCfg{txnID: "b", customerID: "1", loadAmount: 100, time: "2000-01-05T10:00:00Z"},
+				mockCmdCfg{txnID: "a", customerID: "1", loadAmount: 100, time: "2000-01-05T10:00:00Z"},
+				mockCmdCfg{txnID: "c", customerID: "1", loadAmount: 100, time: "2000-01-05T10:00:00Z"},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(3))
+			Expect(events[0].Action()).To(Equal(AccountDepositedEvent))
+			Expect(events[1].Action()).To(Equal(AccountLimitExceededEvent))
+			txnFailure := &TxnFailure{}
+			err = json.Unmarshal(events[1].Data(), txnFailure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(txnFailure.FailureCause).To(Equal(StaleTxn))
+			Expect(txnFailure.Txn.ID).To(Equal("a"))
+			Expect(txnFailure.Error).To(ContainSubstring("latest transaction b at same time"))
+			Expect(events[2].Action()).To(Equal(AccountDepositedEvent))
+		})
+
+		It("accepts out-of-order transactions by default", func() {
+			Expect(newTestAccount(Limits{})).To(Succeed())
+			processTxns()
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(4))
+			for _, event := range events {
+				Expect(event.Action()).To(Equal(AccountDepositedEvent))
+			}
 		})
 	})
-})
+
+	When("event-time is taken from transaction-time", func() {
+		limits := Limits{NumDailyTxnsLimit: 2}
+		var eventTimeFromTxn = func(cfg *AggregateCfg) {
+			cfg.EventTimeFromTxn = true
+		}
+
+		txnTimes := []string{
+			"2000-01-05T10:00:00Z",
+			"2000-01-05T09:00:00Z",
+			// Duplicate
+			"2000-01-05T11:00:00Z",
+			// Exceeds daily number of transactions
+			"2000-01-05T12:00:00Z",
+		}
+		var processTxns = func() {
+			err := mockCmd(
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 100, time: txnTimes[0]},
+				mockCmdCfg{txnID: "2", customerID: "1", loadAmount: -50, time: txnTimes[1]},
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 100, time: txnTimes[2]},
+				mockCmdCfg{txnID: "3", customerID: "1", loadAmount: 100, time: txnTimes[3]},
+			)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("sets time of success and failure events to transaction-time", func() {
+			Expect(newTestAccount(limits, eventTimeFromTxn)).To(Succeed())
+			processTxns()
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(4))
+			Expect(events[0].Action()).To(Equal(AccountDepositedEvent))
+			Expect(events[1].Action()).To(Equal(AccountWithdrawnEvent))
+			Expect(events[2].Action()).To(Equal(DuplicateTxnEvent))
+			Expect(events[3].Action()).To(Equal(AccountLimitExceededEvent))
+			for i, event := range events {
+				txnTime, err := time.Parse(txnTimeFmt, txnTimes[i])
+				Expect(err).ToNot(HaveOccurred())
+				Expect(event.Time()).To(Equal(txnTime.UTC()), "event %d", i)
+			}
+		})
+
+		It("sets time of events to processing-time by default", func() {
+			Expect(newTestAccount(limits)).To(Succeed())
+			startTime := time.Now()
+			processTxns()
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(4))
+			for _, event := range events {
+				Expect(event.Time()).ToNot(BeTemporally("<", startTime))
+			}
+		})
+	})
+
+	When("weekly amount-limit is exceeded", func() {
+		limits := Limits{
+			DailyTxnsAmountLimit:  5000,
+			WeeklyTxnsAmountLimit: 6000,
+		}
+		var verboseLimitErrors = func(cfg *AggregateCfg) {
+			cfg.VerboseLimitErrors = true
+		}
+
+		// Returns failure of transaction exceeding
+		// weekly-limit, but not daily-limit.
+		var weeklyFailure = func() *TxnFailure {
+			err := mockCmd(
+				// Monday and Tuesday of same week
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 4000, time: "2000-01-03T10:00:00Z"},
+				mockCmdCfg{txnID: "2", customerID: "1", loadAmount: 4000, time: "2000-01-04T10:00:00Z"},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(2))
+			Expect(events[1].Action()).To(Equal(AccountLimitExceededEvent))
+			txnFailure := &TxnFailure{}
+			err = json.Unmarshal(events[1].Data(), txnFailure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(txnFailure.FailureCause).To(Equal(WeeklyLimitsExceeded))
+			return txnFailure
+		}
+
+		It("reports overage against weekly-limit", func() {
+			Expect(newTestAccount(limits)).To(Succeed())
+			txnFailure := weeklyFailure()
+			// Overage against daily-limit would be $3000
+			Expect(txnFailure.Error).To(HaveSuffix("limit exceeded for total load-value by: $2000.00"))
+		})
+
+		It("includes total and limit of weekly window if verbose", func() {
+			Expect(newTestAccount(limits, verboseLimitErrors)).To(Succeed())
+			txnFailure := weeklyFailure()
+			Expect(txnFailure.Error).To(HaveSuffix(
+				"limit exceeded for total load-value by: $2000.00 (total: $8000.00, limit: $6000.00)",
+			))
+		})
+	})
+
+	When("daily amount-limit is exceeded", func() {
+		limits := Limits{
+			DailyTxnsAmountLimit:  5000,
+			NumDailyTxnsLimit:     3,
+			WeeklyTxnsAmountLimit: 20000,
+		}
+		var limitDetails = func(cfg *AggregateCfg) {
+			cfg.LimitDetails = true
+		}
+
+		var dailyFailure = func() *TxnFailure {
+			err := mockCmd(
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 4000, time: "2000-01-03T10:00:00Z"},
+				mockCmdCfg{txnID: "2", customerID: "1", loadAmount: 2500.5, time: "2000-01-03T11:00:00Z"},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(2))
+			Expect(events[1].Action()).To(Equal(AccountLimitExceededEvent))
+			txnFailure := &TxnFailure{}
+			err = json.Unmarshal(events[1].Data(), txnFailure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(txnFailure.FailureCause).To(Equal(DailyLimitsExceeded))
+			return txnFailure
+		}
+
+		It("includes exceeded limit in failure-event", func() {
+			Expect(newTestAccount(limits, limitDetails)).To(Succeed())
+			txnFailure := dailyFailure()
+			Expect(txnFailure.LimitType).To(Equal(DailyAmountLimit))
+			Expect(txnFailure.LimitValue).To(Equal(float64(5000)))
+			Expect(txnFailure.CurrentValue).To(Equal(6500.5))
+		})
+
+		It("doesn't include exceeded limit by default", func() {
+			Expect(newTestAccount(limits)).To(Succeed())
+			txnFailure := dailyFailure()
+			Expect(txnFailure.LimitType).To(BeEmpty())
+			Expect(txnFailure.LimitValue).To(BeZero())
+			Expect(txnFailure.CurrentValue).To(BeZero())
+		})
+	})
+
+	When("transactions fall in ISO-week 53 spanning new-year", func() {
+		var failureCauses = func() []TxnFailureCause {
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			causes := make([]TxnFailureCause, 0, len(events))
+			for _, event := range events {
+				if event.Action() != AccountLimitExceededEvent {
+					causes = append(causes, "")
+					continue
+				}
+				txnFailure := &TxnFailure{}
+				err = json.Unmarshal(event.Data(), txnFailure)
+				Expect(err).ToNot(HaveOccurred())
+				causes = append(causes, txnFailure.FailureCause)
+			}
+			return causes
+		}
+
+		It("enforces daily-limits on days in previous ISO-year after replaying events", func() {
+			// Aggregate is loaded from events for every transaction
+			err := mockCmd(
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 4000, time: "2021-01-01T10:00:00Z"},
+				mockCmdCfg{txnID: "2", customerID: "1", loadAmount: 2000, time: "2021-01-01T11:00:00Z"},
+				// Same day-of-year in previous year is another day
+				mockCmdCfg{txnID: "3", customerID: "1", loadAmount: 2000, time: "2020-01-01T11:00:00Z"},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(failureCauses()).To(Equal([]TxnFailureCause{"", DailyLimitsExceeded, ""}))
+		})
+
+		It("enforces weekly-limits across new-year", func() {
+			err := mockCmd(
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 10, time: "2020-12-28T10:00:00Z"},
+				mockCmdCfg{txnID: "2", customerID: "1", loadAmount: 10, time: "2020-12-30T10:00:00Z"},
+				mockCmdCfg{txnID: "3", customerID: "1", loadAmount: 10, time: "2020-12-31T10:00:00Z"},
+				mockCmdCfg{txnID: "4", customerID: "1", loadAmount: 10, time: "2021-01-01T10:00:00Z"},
+				mockCmdCfg{txnID: "5", customerID: "1", loadAmount: 10, time: "2021-01-02T10:00:00Z"},
+				mockCmdCfg{txnID: "6", customerID: "1", loadAmount: 10, time: "2021-01-03T10:00:00Z"},
+				// Next ISO-week
+				mockCmdCfg{txnID: "7", customerID: "1", loadAmount: 10, time: "2021-01-04T10:00:00Z"},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(failureCauses()).To(Equal([]TxnFailureCause{
+				"", "", "", "", "", WeeklyLimitsExceeded, "",
+			}))
+		})
+	})
+
+	When("transaction-history spans multiple periods", func() {
+		It("prunes old period-records and validates current window", func() {
+			limitExceededSub, err := bus.Subscribe(AccountLimitExceededEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			custID := "1"
+			// One transaction per week in previous weeks
+			history := make([]mockCmdCfg, 0)
+			for day := 1; day <= 28; day += 7 {
+				history = append(history, mockCmdCfg{
+					customerID: custID,
+					loadAmount: 10,
+					time:       fmt.Sprintf("1999-12-%02dT10:00:00Z", day),
+				})
+			}
+			err = mockCmd(history...)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Week starting Monday, 2000-01-03
+			err = mockCmd(
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-03T00:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-03T08:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-05T08:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-05T09:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-05T10:00:00Z",
+				},
+				// Weekly limit for number of transactions exceeds here
+				mockCmdCfg{
+					txnID:      "last",
+					customerID: custID,
+					loadAmount: 100,
+					time:       "2000-01-06T10:00:00Z",
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			event := &model.Event{}
+			Eventually(limitExceededSub).Should(Receive(event))
+			txnFailure := &TxnFailure{}
+			err = json.Unmarshal(event.Data(), txnFailure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(txnFailure.FailureCause).To(Equal(WeeklyLimitsExceeded))
+			Expect(txnFailure.Txn.ID).To(Equal("last"))
+
+			// Only records from current week are retained
+			Expect(acc.dailyTxn).To(Equal(map[int]map[int]TxnRecord{
+				2000: {
+					3: {NumTxns: 2, TotalAmount: 200},
+					5: {NumTxns: 3, TotalAmount: 300},
+				},
+			}))
+			Expect(acc.weeklyTxn).To(Equal(map[int]map[int]TxnRecord{
+				2000: {
+					1: {NumTxns: 5, TotalAmount: 500},
+				},
+			}))
+			// Balance still includes all transactions
+			Expect(acc.balance).To(Equal(float64(540)))
+		})
+	})
+
+	When("inspecting limit-usage", func() {
+		It("reports usage matching accepted transactions", func() {
+			limitExceededSub, err := bus.Subscribe(AccountLimitExceededEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			custID := "1"
+			err = mockCmd(
+				// Previous week, only counts towards balance
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 1000,
+					time:       "1999-12-29T10:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 2000,
+					time:       "2000-01-03T10:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 3000,
+					time:       "2000-01-05T10:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: -500,
+					time:       "2000-01-05T11:00:00Z",
+				},
+				// Declined, daily amount-limit exceeds
+				mockCmdCfg{
+					customerID: custID,
+					loadAmount: 4000,
+					time:       "2000-01-05T12:00:00Z",
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(limitExceededSub).Should(Receive())
+
+			at, err := time.Parse(txnTimeFmt, "2000-01-05T23:00:00Z")
+			Expect(err).ToNot(HaveOccurred())
+			usage, err := InspectUsage(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+
+				DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
+				NumDailyTxnsLimit:     NumDailyTxnsLimit,
+				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
+				NumWeeklyTxnsLimit:    NumWeeklyTxnsLimit,
+			}, custID, at)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(usage.CustID).To(Equal(custID))
+			Expect(usage.Balance).To(Equal(float64(5500)))
+			Expect(usage.Daily).To(Equal(LimitUsage{
+				Used: TxnRecord{NumTxns: 2, TotalAmount: 2500},
+				Limit: TxnRecord{
+					NumTxns:     NumDailyTxnsLimit,
+					TotalAmount: DailyTxnsAmountLimit,
+				},
+			}))
+			Expect(usage.Weekly).To(Equal(LimitUsage{
+				Used: TxnRecord{NumTxns: 3, TotalAmount: 4500},
+				Limit: TxnRecord{
+					NumTxns:     NumWeeklyTxnsLimit,
+					TotalAmount: WeeklyTxnsAmountLimit,
+				},
+			}))
+		})
+
+		It("reports zero usage for customer without transactions", func() {
+			usage, err := InspectUsage(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+			}, "unknown", time.Now())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(usage.Balance).To(BeZero())
+			Expect(usage.Daily.Used).To(BeZero())
+			Expect(usage.Weekly.Used).To(BeZero())
+		})
+	})
+
+	When("seeding opening-balances", func() {
+		const AccountSeededEvent model.EventAction = "AccountSeeded"
+
+		var seedOpts = &SeedOpts{AccountSeeded: AccountSeededEvent}
+		var asOf = time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC)
+
+		It("initializes balance with empty limit-windows", func() {
+			err := SeedOpeningBalances(eventRepo, []OpeningBalance{
+				{CustID: "1", Balance: 10000, AsOf: asOf},
+				{CustID: "2", Balance: 50, AsOf: asOf},
+			}, seedOpts)
+			Expect(err).ToNot(HaveOccurred())
+
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Action()).To(Equal(AccountSeededEvent))
+			Expect(events[0].IsReplay()).To(BeTrue())
+
+			usage, err := InspectUsage(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+				AccountSeeded:        AccountSeededEvent,
+			}, "1", asOf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(usage.Balance).To(Equal(float64(10000)))
+			Expect(usage.Daily.Used).To(BeZero())
+			Expect(usage.Weekly.Used).To(BeZero())
+		})
+
+		It("rejects invalid entries without writing events", func() {
+			err := mockCmd(mockCmdCfg{
+				customerID: "3",
+				loadAmount: 100,
+				time:       "2000-01-05T10:00:00Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			existing, err := eventRepo.FetchByIndex(0)
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, entries := range [][]OpeningBalance{
+				{{CustID: "1", Balance: 100, AsOf: asOf}, {CustID: "2", Balance: -1, AsOf: asOf}},
+				{{CustID: "1", Balance: 100, AsOf: asOf}, {CustID: "1", Balance: 200, AsOf: asOf}},
+				{{CustID: "1", Balance: 100, AsOf: asOf}, {CustID: "2", Balance: 100}},
+				{{CustID: "1", Balance: 100, AsOf: asOf}, {CustID: "", Balance: 100, AsOf: asOf}},
+				// Customer already has events
+				{{CustID: "1", Balance: 100, AsOf: asOf}, {CustID: "3", Balance: 100, AsOf: asOf}},
+			} {
+				err := SeedOpeningBalances(eventRepo, entries, seedOpts)
+				Expect(err).To(HaveOccurred(), fmt.Sprintf("%+v", entries))
+			}
+
+			events, err := eventRepo.FetchByIndex(0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(Equal(existing))
+		})
+	})
+
+	When("deposits bring balance above zero", func() {
+		const (
+			AccountSeededEvent    model.EventAction = "AccountSeeded"
+			AccountRecoveredEvent model.EventAction = "AccountRecovered"
+		)
+		var asOf = time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC)
+
+		var withRecovery = func(cfg *AggregateCfg) {
+			cfg.AccountSeeded = AccountSeededEvent
+			cfg.AccountRecovered = AccountRecoveredEvent
+		}
+
+		var processTxns = func(custID string, cfgs ...mockCmdCfg) {
+			for _, cfg := range cfgs {
+				cfg.customerID = custID
+				Expect(mockCmd(cfg)).To(Succeed())
+				if acc.retainState {
+					Expect(acc.applyPublished()).To(Succeed())
+				}
+			}
+		}
+
+		var recoveries = func(custID string) []AccountRecovery {
+			events, err := eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			recoveries := make([]AccountRecovery, 0)
+			for _, event := range events {
+				if event.Action() != AccountRecoveredEvent {
+					continue
+				}
+				recovery := AccountRecovery{}
+				Expect(json.Unmarshal(event.Data(), &recovery)).To(Succeed())
+				recoveries = append(recoveries, recovery)
+			}
+			return recoveries
+		}
+
+		BeforeEach(func() {
+			err := SeedOpeningBalances(eventRepo, []OpeningBalance{
+				{CustID: "1", Balance: -100, AsOf: asOf},
+				{CustID: "2", Balance: -100, AsOf: asOf},
+			}, &SeedOpts{
+				AccountSeeded: AccountSeededEvent,
+				AllowNegative: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("checks funds of deposits on accounts not seeded overdrawn", func() {
+			Expect(newTestAccount(Limits{}, withRecovery)).To(Succeed())
+			processTxns("3",
+				// Previous week
+				mockCmdCfg{txnID: "1", loadAmount: 100, time: "2000-01-02T10:00:00Z"},
+				mockCmdCfg{txnID: "2", loadAmount: -80, time: "2000-01-03T10:00:00Z"},
+				mockCmdCfg{txnID: "3", loadAmount: 10, time: "2000-01-03T11:00:00Z"},
+			)
+
+			events, err := eventRepo.Fetch("3")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(3))
+			Expect(events[2].Action()).To(Equal(AccountLimitExceededEvent))
+			txnFailure := &TxnFailure{}
+			Expect(json.Unmarshal(events[2].Data(), txnFailure)).To(Succeed())
+			Expect(txnFailure.FailureCause).To(Equal(InsufficientFunds))
+			Expect(txnFailure.Txn.ID).To(Equal("3"))
+		})
+
+		It("publishes recovery once a deposit brings seeded negative balance above zero", func() {
+			Expect(newTestAccount(Limits{}, withRecovery)).To(Succeed())
+			// Still negative
+			processTxns("1", mockCmdCfg{txnID: "1", loadAmount: 50, time: "2000-01-05T10:00:00Z"})
+			Expect(recoveries("1")).To(BeEmpty())
+
+			processTxns("1", mockCmdCfg{txnID: "2", loadAmount: 80, time: "2000-01-06T10:00:00Z"})
+			Expect(recoveries("1")).To(Equal([]AccountRecovery{{
+				CustID:  "1",
+				TxnID:   "2",
+				TxnTime: time.Date(2000, 1, 6, 10, 0, 0, 0, time.UTC),
+
+				NonPositiveSince:    asOf,
+				NonPositiveDuration: 34 * time.Hour,
+				Balance:             30,
+			}}))
+
+			// Already positive
+			processTxns("1", mockCmdCfg{txnID: "3", loadAmount: 10, time: "2000-01-06T11:00:00Z"})
+			Expect(recoveries("1")).To(HaveLen(1))
+			// Recovery-event doesn't change account's state
+			Expect(newTestAccount(Limits{}, withRecovery)).To(Succeed())
+			Expect(acc.loadAggregate("1")).To(Succeed())
+			Expect(acc.balance).To(Equal(float64(40)))
+			Expect(acc.nonPositiveSince).To(BeZero())
+		})
+
+		It("tracks balance going non-positive same when replaying events", func() {
+			txns := []mockCmdCfg{
+				{txnID: "1", loadAmount: 150, time: "2000-01-05T10:00:00Z"},
+				// Withdrawn to zero, which is non-positive
+				{txnID: "2", loadAmount: -50, time: "2000-01-06T10:00:00Z"},
+				{txnID: "3", loadAmount: 20, time: "2000-01-06T12:00:00Z"},
+			}
+			// Every command reloads aggregate from its events
+			Expect(newTestAccount(Limits{}, withRecovery)).To(Succeed())
+			processTxns("1", txns...)
+			// Aggregate applies its own published events
+			Expect(newTestAccount(Limits{}, withRecovery)).To(Succeed())
+			acc.retainState = true
+			processTxns("2", txns...)
+
+			expected := []AccountRecovery{
+				{
+					TxnID:               "1",
+					TxnTime:             time.Date(2000, 1, 5, 10, 0, 0, 0, time.UTC),
+					NonPositiveSince:    asOf,
+					NonPositiveDuration: 10 * time.Hour,
+					Balance:             50,
+				},
+				{
+					TxnID:               "3",
+					TxnTime:             time.Date(2000, 1, 6, 12, 0, 0, 0, time.UTC),
+					NonPositiveSince:    time.Date(2000, 1, 6, 10, 0, 0, 0, time.UTC),
+					NonPositiveDuration: 2 * time.Hour,
+					Balance:             20,
+				},
+			}
+			for _, custID := range []string{"1", "2"} {
+				for i := range expected {
+					expected[i].CustID = custID
+				}
+				Expect(recoveries(custID)).To(Equal(expected), custID)
+			}
+		})
+	})
+
+	When("partial-withdrawals are enabled", func() {
+		const PartiallyWithdrawnEvent model.EventAction = "PartialWithdrawal"
+
+		var partialCfg = func() *AggregateCfg {
+			return &AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+				PartiallyWithdrawn:   PartiallyWithdrawnEvent,
+
+				PartialWithdrawal: true,
+			}
+		}
+
+		// Returns events of customer with action
+		var eventsOf = func(custID string, action model.EventAction) []model.Event {
+			events, err := eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			matching := make([]model.Event, 0)
+			for _, event := range events {
+				if event.Action() == action {
+					matching = append(matching, event)
+				}
+			}
+			return matching
+		}
+
+		BeforeEach(func() {
+			limits, err := newLimitsSnapshot(0, Limits{})
+			Expect(err).ToNot(HaveOccurred())
+			acc, err = newAccount(partialCfg(), limits)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("applies withdrawal larger than balance up to balance", func() {
+			Expect(mockCmd(mockCmdCfg{
+				txnID: "1", customerID: "1", loadAmount: 100, time: "2000-01-05T10:00:00Z",
+			})).To(Succeed())
+			Expect(mockCmd(mockCmdCfg{
+				txnID: "2", customerID: "1", loadAmount: -150, time: "2000-01-06T10:00:00Z",
+			})).To(Succeed())
+
+			withdrawals := eventsOf("1", AccountWithdrawnEvent)
+			Expect(withdrawals).To(HaveLen(1))
+			state, err := DecodeState(withdrawals[0].Data())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.TxnID).To(Equal("2"))
+			Expect(state.RequestedAmount).To(Equal(float64(-150)))
+			Expect(state.AppliedAmount).To(Equal(float64(-100)))
+			Expect(state.TotalAmount).To(BeZero())
+			Expect(state.DailyTxn.TotalAmount).To(Equal(float64(-100)))
+
+			partials := eventsOf("1", PartiallyWithdrawnEvent)
+			Expect(partials).To(HaveLen(1))
+			partial := PartialWithdrawal{}
+			Expect(json.Unmarshal(partials[0].Data(), &partial)).To(Succeed())
+			Expect(partial).To(Equal(PartialWithdrawal{
+				CustID:  "1",
+				TxnID:   "2",
+				TxnTime: time.Date(2000, 1, 6, 10, 0, 0, 0, time.UTC),
+
+				RequestedAmount: -150,
+				AppliedAmount:   -100,
+				Shortfall:       50,
+				Balance:         0,
+			}))
+
+			// Partial-withdrawal doesn't change account's state
+			Expect(acc.loadAggregate("1")).To(Succeed())
+			Expect(acc.balance).To(BeZero())
+		})
+
+		It("applies withdrawals within balance fully", func() {
+			Expect(mockCmd(mockCmdCfg{
+				txnID: "1", customerID: "1", loadAmount: 100, time: "2000-01-05T10:00:00Z",
+			})).To(Succeed())
+			Expect(mockCmd(mockCmdCfg{
+				txnID: "2", customerID: "1", loadAmount: -100, time: "2000-01-05T11:00:00Z",
+			})).To(Succeed())
+
+			withdrawals := eventsOf("1", AccountWithdrawnEvent)
+			Expect(withdrawals).To(HaveLen(1))
+			state, err := DecodeState(withdrawals[0].Data())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.RequestedAmount).To(BeZero())
+			Expect(state.AppliedAmount).To(BeZero())
+			Expect(eventsOf("1", PartiallyWithdrawnEvent)).To(BeEmpty())
+		})
+
+		It("declines withdrawals without available funds", func() {
+			Expect(mockCmd(mockCmdCfg{
+				txnID: "1", customerID: "1", loadAmount: -50, time: "2000-01-05T10:00:00Z",
+			})).To(Succeed())
+
+			Expect(eventsOf("1", AccountWithdrawnEvent)).To(BeEmpty())
+			Expect(eventsOf("1", PartiallyWithdrawnEvent)).To(BeEmpty())
+			failures := eventsOf("1", AccountLimitExceededEvent)
+			Expect(failures).To(HaveLen(1))
+			failure := TxnFailure{}
+			Expect(json.Unmarshal(failures[0].Data(), &failure)).To(Succeed())
+			Expect(failure.FailureCause).To(Equal(InsufficientFunds))
+		})
+
+		It("requires partially-withdrawn action", func() {
+			cfg := partialCfg()
+			cfg.PartiallyWithdrawn = ""
+			Expect(cfg.Validate()).ToNot(Succeed())
+		})
+	})
+
+	When("replaying what-if analysis", func() {
+		var whatIfCfg = func(dailyAmountLimit float64, numDailyLimit int) *AggregateCfg {
+			return &AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+
+				DailyTxnsAmountLimit:  dailyAmountLimit,
+				NumDailyTxnsLimit:     numDailyLimit,
+				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
+				NumWeeklyTxnsLimit:    NumWeeklyTxnsLimit,
+			}
+		}
+
+		BeforeEach(func() {
+			err := mockCmd(
+				mockCmdCfg{
+					txnID:      "1",
+					customerID: "1",
+					loadAmount: 1000,
+					time:       "2000-01-05T10:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "2",
+					customerID: "1",
+					loadAmount: 2000,
+					time:       "2000-01-05T11:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "3",
+					customerID: "1",
+					loadAmount: -500,
+					time:       "2000-01-05T12:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "4",
+					customerID: "1",
+					loadAmount: 1500,
+					time:       "2000-01-06T10:00:00Z",
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("flags previously-accepted transactions declined by tighter limits", func() {
+			events, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := ReplayWhatIf(whatIfCfg(1500, NumDailyTxnsLimit), "1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.CustID).To(Equal("1"))
+			Expect(result.NumReplayed).To(Equal(4))
+			Expect(result.Declined).To(HaveLen(1))
+			Expect(result.Declined[0].TxnID).To(Equal("2"))
+			Expect(result.Declined[0].LoadAmount).To(Equal(float64(2000)))
+			Expect(result.Declined[0].FailureCause).To(Equal(DailyLimitsExceeded))
+			// Declined deposit isn't counted towards balance
+			Expect(result.Balance).To(Equal(float64(2000)))
+
+			// Nothing is stored by replay
+			replayedEvents, err := eventRepo.Fetch("1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(replayedEvents).To(Equal(events))
+		})
+
+		It("flags withdrawals lacking funds after earlier declines", func() {
+			result, err := ReplayWhatIf(whatIfCfg(DailyTxnsAmountLimit, 1), "1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Declined).To(HaveLen(2))
+			Expect(result.Declined[0].TxnID).To(Equal("2"))
+			Expect(result.Declined[0].FailureCause).To(Equal(DailyLimitsExceeded))
+			Expect(result.Declined[1].TxnID).To(Equal("3"))
+			Expect(result.Declined[1].FailureCause).To(Equal(DailyLimitsExceeded))
+			Expect(result.Balance).To(Equal(float64(2500)))
+		})
+
+		It("flags nothing when replayed with same limits", func() {
+			result, err := ReplayWhatIf(whatIfCfg(DailyTxnsAmountLimit, NumDailyTxnsLimit), "1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.NumReplayed).To(Equal(4))
+			Expect(result.Declined).To(BeEmpty())
+			Expect(result.Balance).To(Equal(float64(4000)))
+		})
+	})
+
+	When("reconstructing point-in-time state", func() {
+		var stateCfg AggregateCfg
+
+		var parseTime = func(value string) time.Time {
+			t, err := time.Parse(txnTimeFmt, value)
+			Expect(err).ToNot(HaveOccurred())
+			return t
+		}
+
+		BeforeEach(func() {
+			stateCfg = AggregateCfg{
+				AccountDeposited: AccountDepositedEvent,
+				AccountWithdrawn: AccountWithdrawnEvent,
+
+				DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
+				NumDailyTxnsLimit:     NumDailyTxnsLimit,
+				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
+				NumWeeklyTxnsLimit:    NumWeeklyTxnsLimit,
+			}
+
+			err := mockCmd(
+				mockCmdCfg{
+					txnID:      "1",
+					customerID: "1",
+					loadAmount: 1000,
+					time:       "2000-01-03T10:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "2",
+					customerID: "1",
+					loadAmount: 2000,
+					time:       "2000-01-05T10:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "3",
+					customerID: "1",
+					loadAmount: -500,
+					time:       "2000-01-05T12:00:00Z",
+				},
+				// Declined, daily amount-limit exceeds
+				mockCmdCfg{
+					txnID:      "4",
+					customerID: "1",
+					loadAmount: 4000,
+					time:       "2000-01-05T13:00:00Z",
+				},
+				// Next ISO-week
+				mockCmdCfg{
+					txnID:      "5",
+					customerID: "1",
+					loadAmount: 1500,
+					time:       "2000-01-10T10:00:00Z",
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns zero state before first event", func() {
+			state, err := StateAt(eventRepo, "1", parseTime("2000-01-01T00:00:00Z"), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.CustID).To(Equal("1"))
+			Expect(state.Basis).To(Equal(PointInTimeTxnTime))
+			Expect(state.Balance).To(BeZero())
+			Expect(state.Daily.Used).To(BeZero())
+			Expect(state.Weekly.Used).To(BeZero())
+			Expect(state.TxnIDs).To(BeEmpty())
+
+			state, err = StateAt(eventRepo, "unknown", time.Now(), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Balance).To(BeZero())
+		})
+
+		It("returns state between transactions", func() {
+			state, err := StateAt(eventRepo, "1", parseTime("2000-01-05T11:00:00Z"), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Balance).To(Equal(float64(3000)))
+			Expect(state.Daily).To(Equal(LimitUsage{
+				Used: TxnRecord{NumTxns: 1, TotalAmount: 2000},
+				Limit: TxnRecord{
+					NumTxns:     NumDailyTxnsLimit,
+					TotalAmount: DailyTxnsAmountLimit,
+				},
+			}))
+			Expect(state.Weekly.Used).To(Equal(TxnRecord{NumTxns: 2, TotalAmount: 3000}))
+			Expect(state.TxnIDs).To(Equal([]string{"1", "2"}))
+
+			// Transaction at exact instant is included
+			state, err = StateAt(eventRepo, "1", parseTime("2000-01-05T12:00:00Z"), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Balance).To(Equal(float64(2500)))
+			Expect(state.Daily.Used).To(Equal(TxnRecord{NumTxns: 2, TotalAmount: 1500}))
+			Expect(state.TxnIDs).To(Equal([]string{"1", "2", "3"}))
+		})
+
+		It("returns usage of periods containing provided time", func() {
+			// Next day of same week, without transactions
+			state, err := StateAt(eventRepo, "1", parseTime("2000-01-06T00:00:00Z"), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Balance).To(Equal(float64(2500)))
+			Expect(state.Daily.Used).To(BeZero())
+			Expect(state.Weekly.Used).To(Equal(TxnRecord{NumTxns: 3, TotalAmount: 2500}))
+			// Declined transactions aren't recorded
+			Expect(state.TxnIDs).To(Equal([]string{"1", "2", "3"}))
+
+			state, err = StateAt(eventRepo, "1", parseTime("2000-01-10T12:00:00Z"), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Balance).To(Equal(float64(4000)))
+			Expect(state.Daily.Used).To(Equal(TxnRecord{NumTxns: 1, TotalAmount: 1500}))
+			Expect(state.Weekly.Used).To(Equal(TxnRecord{NumTxns: 1, TotalAmount: 1500}))
+			Expect(state.TxnIDs).To(Equal([]string{"1", "2", "3", "5"}))
+		})
+
+		It("places events at processing-time if configured", func() {
+			stateCfg.PointInTimeBasis = PointInTimeProcessedAt
+
+			// Transactions are from the past, but were processed now
+			state, err := StateAt(eventRepo, "1", parseTime("2000-01-10T12:00:00Z"), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Basis).To(Equal(PointInTimeProcessedAt))
+			Expect(state.Balance).To(BeZero())
+			Expect(state.TxnIDs).To(BeEmpty())
+
+			state, err = StateAt(eventRepo, "1", time.Now(), stateCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Balance).To(Equal(float64(4000)))
+			Expect(state.TxnIDs).To(HaveLen(4))
+
+			stateCfg.PointInTimeBasis = "unknown"
+			_, err = StateAt(eventRepo, "1", time.Now(), stateCfg)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("serves state over HTTP", func() {
+			handler := NewStateHandler(logger.NewStdLogger("StateHandler"), eventRepo, stateCfg)
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(
+				http.MethodGet, "/state/1?at=2000-01-05T11:00:00Z", nil,
+			))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			state := &PointInTimeState{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), state)).To(Succeed())
+			Expect(state.CustID).To(Equal("1"))
+			Expect(state.Balance).To(Equal(float64(3000)))
+			Expect(state.TxnIDs).To(Equal([]string{"1", "2"}))
+
+			for target, code := range map[string]int{
+				"/state/1":               http.StatusBadRequest,
+				"/state/1?at=2000-01-05": http.StatusBadRequest,
+				"/state/?at=" + url.QueryEscape("2000-01-05T11:00:00Z"): http.StatusNotFound,
+			} {
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+				Expect(recorder.Code).To(Equal(code), target)
+			}
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/state/1", nil))
+			Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	When("checking balance-drift", func() {
+		var driftCfg *AggregateCfg
+
+		BeforeEach(func() {
+			driftCfg = &AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+			}
+
+			err := mockCmd(
+				mockCmdCfg{
+					customerID: "1",
+					loadAmount: 1000,
+					time:       "2000-01-05T10:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: "1",
+					loadAmount: -500,
+					time:       "2000-01-05T11:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: "1",
+					loadAmount: 1500,
+					time:       "2000-01-06T10:00:00Z",
+				},
+				mockCmdCfg{
+					customerID: "2",
+					loadAmount: 300,
+					time:       "2000-01-05T10:00:00Z",
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		// Stores a deposit of 100 whose balance is
+		// off by 50, followed by a valid deposit.
+		var injectInconsistentEvent = func() {
+			txnTime, err := time.Parse(txnTimeFmt, "2000-01-06T11:00:00Z")
+			Expect(err).ToNot(HaveOccurred())
+			event, err := model.NewEvent(&model.EventCfg{
+				AggregateID: "1",
+				Action:      AccountDepositedEvent,
+				Data: &State{
+					TxnID:       "inconsistent",
+					CustID:      "1",
+					TxnTime:     txnTime,
+					DailyTxn:    TxnRecord{NumTxns: 2, TotalAmount: 1600},
+					WeeklyTxn:   TxnRecord{NumTxns: 4, TotalAmount: 2100},
+					TotalAmount: 2150,
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = eventRepo.InsertAndPublish(event)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = mockCmd(mockCmdCfg{
+				txnID:      "after",
+				customerID: "1",
+				loadAmount: 200,
+				time:       "2000-01-06T12:00:00Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("detects no drift in consistent events", func() {
+			drifts, err := CheckBalanceDrift(driftCfg, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drifts).To(BeEmpty())
+		})
+
+		It("detects drift after an inconsistent event", func() {
+			injectInconsistentEvent()
+
+			drifts, err := CheckBalanceDrift(driftCfg, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drifts).To(Equal([]BalanceDrift{
+				{
+					CustID:           "1",
+					PublishedBalance: 2350,
+					ReplayedBalance:  2300,
+					FirstDriftTxnID:  "inconsistent",
+				},
+			}))
+		})
+
+		It("checks only specified customers, within tolerance", func() {
+			injectInconsistentEvent()
+
+			drifts, err := CheckBalanceDrift(driftCfg, &DriftCheckOpts{
+				CustIDs: []string{"2"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drifts).To(BeEmpty())
+
+			drifts, err = CheckBalanceDrift(driftCfg, &DriftCheckOpts{
+				Tolerance: 50,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drifts).To(BeEmpty())
+
+			_, err = CheckBalanceDrift(driftCfg, &DriftCheckOpts{
+				Tolerance: -1,
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("fraud-checker is configured", func() {
+		const fraudCheckThreshold = 1000
+		const fraudCheckTimeoutSec = 2
+
+		var fakeClock *clock.FakeClock
+
+		// Replaces account with one using provided fraud-checker
+		var withFraudChecker = func(checker FraudChecker, policy FraudFailurePolicy) {
+			limits, err := newLimitsSnapshot(0, Limits{
+				DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
+				NumDailyTxnsLimit:     NumDailyTxnsLimit,
+				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
+				NumWeeklyTxnsLimit:    NumWeeklyTxnsLimit,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			acc, err = newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+
+				FraudChecker:         checker,
+				FraudCheckThreshold:  fraudCheckThreshold,
+				FraudCheckTimeoutSec: fraudCheckTimeoutSec,
+				FraudFailurePolicy:   policy,
+				Clock:                fakeClock,
+			}, limits)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		var expectFraudSuspected = func(sub <-chan interface{}, txnID string, reason string) {
+			event := &model.Event{}
+			Eventually(sub).Should(Receive(event))
+			txnFailure := &TxnFailure{}
+			err := json.Unmarshal(event.Data(), txnFailure)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(txnFailure.FailureCause).To(Equal(FraudSuspected))
+			Expect(txnFailure.Txn.ID).To(Equal(txnID))
+			Expect(txnFailure.Error).To(ContainSubstring(reason))
+		}
+
+		BeforeEach(func() {
+			fakeClock = clock.NewFakeClock(time.Now())
+		})
+
+		It("checks only transactions above threshold, with current usage", func() {
+			depositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			checker := NewRecordingFraudChecker(Decision{}, nil, false)
+			withFraudChecker(checker, "")
+
+			err = mockCmd(
+				mockCmdCfg{
+					txnID:      "11",
+					customerID: "1",
+					loadAmount: fraudCheckThreshold,
+					time:       "2000-01-05T00:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "12",
+					customerID: "1",
+					loadAmount: fraudCheckThreshold + 1,
+					time:       "2000-01-05T01:00:00Z",
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(depositedSub).Should(Receive())
+			Eventually(depositedSub).Should(Receive())
+
+			calls := checker.Calls()
+			Expect(calls).To(HaveLen(1))
+			Expect(calls[0].Txn.ID).To(Equal("12"))
+			Expect(calls[0].State.Balance).To(Equal(float64(fraudCheckThreshold)))
+			Expect(calls[0].State.Daily.Used).To(Equal(TxnRecord{
+				NumTxns:     1,
+				TotalAmount: fraudCheckThreshold,
+			}))
+		})
+
+		It("declines transaction rejected by fraud-checker", func() {
+			limitExceededSub, err := bus.Subscribe(AccountLimitExceededEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			checker := NewRecordingFraudChecker(Decision{
+				Reject: true,
+				Reason: "unusual location",
+			}, nil, false)
+			withFraudChecker(checker, "")
+
+			err = mockCmd(mockCmdCfg{
+				txnID:      "11",
+				customerID: "1",
+				loadAmount: 2000,
+				time:       "2000-01-05T00:00:00Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			expectFraudSuspected(limitExceededSub, "11", "unusual location")
+		})
+
+		It("accepts transaction on checker-error with fail-open policy", func() {
+			depositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			checker := NewRecordingFraudChecker(Decision{}, errors.New("service unavailable"), false)
+			withFraudChecker(checker, FraudFailOpen)
+
+			err = mockCmd(mockCmdCfg{
+				txnID:      "11",
+				customerID: "1",
+				loadAmount: 2000,
+				time:       "2000-01-05T00:00:00Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(depositedSub).Should(Receive())
+		})
+
+		It("declines transaction on checker-error with fail-closed policy", func() {
+			limitExceededSub, err := bus.Subscribe(AccountLimitExceededEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			checker := NewRecordingFraudChecker(Decision{}, errors.New("service unavailable"), false)
+			withFraudChecker(checker, FraudFailClosed)
+
+			err = mockCmd(mockCmdCfg{
+				txnID:      "11",
+				customerID: "1",
+				loadAmount: 2000,
+				time:       "2000-01-05T00:00:00Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			expectFraudSuspected(limitExceededSub, "11", "service unavailable")
+		})
+
+		It("applies failure-policy when fraud-check times-out", func() {
+			limitExceededSub, err := bus.Subscribe(AccountLimitExceededEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			checker := NewRecordingFraudChecker(Decision{}, nil, true)
+			withFraudChecker(checker, FraudFailClosed)
+
+			cmdErr := make(chan error, 1)
+			go func() {
+				cmdErr <- mockCmd(mockCmdCfg{
+					txnID:      "11",
+					customerID: "1",
+					loadAmount: 2000,
+					time:       "2000-01-05T00:00:00Z",
+				})
+			}()
+			Eventually(fakeClock.Waiters).Should(Equal(1))
+			Consistently(cmdErr).ShouldNot(Receive())
+
+			fakeClock.Advance(fraudCheckTimeoutSec * time.Second)
+			Eventually(cmdErr).Should(Receive(BeNil()))
+			expectFraudSuspected(limitExceededSub, "11", "timed-out")
+		})
+
+		It("skips fraud-check without a checker or threshold", func() {
+			depositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			checker := NewRecordingFraudChecker(Decision{Reject: true}, nil, false)
+			withoutThreshold := func(cfg *AggregateCfg) {
+				cfg.FraudChecker = checker
+				cfg.Clock = fakeClock
+			}
+			withoutChecker := func(cfg *AggregateCfg) {
+				cfg.FraudCheckThreshold = fraudCheckThreshold
+				cfg.Clock = fakeClock
+			}
+			for i, opt := range []func(*AggregateCfg){withoutThreshold, withoutChecker} {
+				Expect(newTestAccount(Limits{}, opt)).To(Succeed())
+				err = mockCmd(mockCmdCfg{
+					txnID:      strconv.Itoa(i),
+					customerID: "1",
+					loadAmount: 2000,
+					time:       "2000-01-05T00:00:00Z",
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(depositedSub).Should(Receive())
+			}
+			Expect(checker.Calls()).To(BeEmpty())
+			// No time-outs were started
+			Expect(fakeClock.Waiters()).To(BeZero())
+		})
+
+		It("errors on invalid failure-policy", func() {
+			limits, err := newLimitsSnapshot(0, Limits{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+
+				FraudFailurePolicy: "invalid",
+			}, limits)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("balance-snapshots are configured", func() {
+		const BalanceSnapshotEvent model.EventAction = "BalanceSnapshot"
+
+		JustBeforeEach(func() {
+			limits, err := newLimitsSnapshot(0, Limits{
+				DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
+				NumDailyTxnsLimit:     NumDailyTxnsLimit,
+				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
+				NumWeeklyTxnsLimit:    NumWeeklyTxnsLimit,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			acc, err = newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+				BalanceSnapshot:      BalanceSnapshotEvent,
+				SnapshotEveryNTxns:   2,
+			}, limits)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("emits snapshots every N accepted transactions", func() {
+			snapshotSub, err := bus.Subscribe(BalanceSnapshotEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			custID := "1"
+			err = mockCmd(
+				mockCmdCfg{
+					txnID:      "11",
+					customerID: custID,
+					loadAmount: 1000,
+					time:       "2000-01-05T00:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "12",
+					customerID: custID,
+					loadAmount: 500,
+					time:       "2000-01-05T01:00:00Z",
+				},
+				// Declined, doesn't count towards interval
+				mockCmdCfg{
+					txnID:      "12",
+					customerID: custID,
+					loadAmount: 500,
+					time:       "2000-01-05T01:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "13",
+					customerID: custID,
+					loadAmount: -200,
+					time:       "2000-01-06T00:00:00Z",
+				},
+				mockCmdCfg{
+					txnID:      "14",
+					customerID: custID,
+					loadAmount: 300,
+					time:       "2000-01-06T01:00:00Z",
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			expectedSnapshots := []BalanceSnapshot{
+				{
+					CustID:    custID,
+					TxnID:     "12",
+					NumTxns:   2,
+					Balance:   1500,
+					DailyTxn:  TxnRecord{NumTxns: 2, TotalAmount: 1500},
+					WeeklyTxn: TxnRecord{NumTxns: 2, TotalAmount: 1500},
+				},
+				{
+					CustID:    custID,
+					TxnID:     "14",
+					NumTxns:   4,
+					Balance:   1600,
+					DailyTxn:  TxnRecord{NumTxns: 2, TotalAmount: 100},
+					WeeklyTxn: TxnRecord{NumTxns: 4, TotalAmount: 1600},
+				},
+			}
+			for _, expected := range expectedSnapshots {
+				event := &model.Event{}
+				Eventually(snapshotSub).Should(Receive(event))
+				Expect(event.AggregateID()).To(Equal(custID))
+
+				snapshot := &BalanceSnapshot{}
+				err = json.Unmarshal(event.Data(), snapshot)
+				Expect(err).ToNot(HaveOccurred())
+				// Checked separately, since
+				// time-zone may differ
+				Expect(snapshot.TxnTime).ToNot(BeZero())
+				snapshot.TxnTime = time.Time{}
+				Expect(*snapshot).To(Equal(expected))
+			}
+			Consistently(snapshotSub).ShouldNot(Receive())
+		})
+
+		It("errors if snapshot-interval is not set", func() {
+			limits, err := newLimitsSnapshot(0, Limits{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+				BalanceSnapshot:      BalanceSnapshotEvent,
+			}, limits)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("daily and weekly limits are unspecified", func() {
+		JustBeforeEach(func() {
+			limits, err := newLimitsSnapshot(0, Limits{
+				DailyTxnsAmountLimit:  0,
+				NumDailyTxnsLimit:     0,
+				WeeklyTxnsAmountLimit: 0,
+				NumWeeklyTxnsLimit:    0,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			acc, err = newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+			}, limits)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("allows unlimited daily and weekly transactions", func() {
+			accDepositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			expectedNumTxns := 100
+
+			custID := "1"
+			mockCmds := make([]mockCmdCfg, 0)
+			// All transactions occur on same day,
+			// so we test daily/weekly at same time
+			for i := 0; i < expectedNumTxns; i++ {
+				mockCmds = append(mockCmds, mockCmdCfg{
+					txnID:      strconv.Itoa(i),
+					customerID: custID,
+					loadAmount: float64(10000 * (i + 1)),
+					time:       "2000-01-05T00:00:01Z",
+				})
+			}
+
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				for i := 0; i < expectedNumTxns; i++ {
+					event := &model.Event{}
+					Eventually(accDepositedSub).Should(Receive(event))
+					Expect(event.Action()).To(Equal(AccountDepositedEvent))
+				}
+			}()
+
+			// Add/process sample transactions
+			err = mockCmd(mockCmds...)
+			Expect(err).ToNot(HaveOccurred())
+			wg.Wait()
+		})
+	})
+
+	When("monthly allowance is configured", func() {
+		const (
+			MonthlyAllowance = 5000
+			MaxCarryOver     = 2000
+		)
+		custID := "1"
+
+		var depositedSub, withdrawnSub, limitExceededSub <-chan interface{}
+
+		var withAllowance = func(cfg *AggregateCfg) {
+			cfg.MonthlyAllowance = MonthlyAllowance
+			cfg.MaxCarryOver = MaxCarryOver
+		}
+
+		// Returns failure-cause of transaction,
+		// or blank string if it was accepted.
+		var processTxn = func(loadAmount float64, txnTime string) TxnFailureCause {
+			err := mockCmd(mockCmdCfg{
+				customerID: custID,
+				loadAmount: loadAmount,
+				time:       txnTime,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			select {
+			case <-depositedSub:
+				return ""
+			case <-withdrawnSub:
+				return ""
+			case msg := <-limitExceededSub:
+				txnFailure := &TxnFailure{}
+				err := json.Unmarshal(msg.(model.Event).Data(), txnFailure)
+				Expect(err).ToNot(HaveOccurred())
+				return txnFailure.FailureCause
+			case <-time.After(busMsgReceiveTimeoutSec * time.Second):
+				Fail("timed-out waiting for transaction-result")
+			}
+			return ""
+		}
+
+		BeforeEach(func() {
+			var err error
+			depositedSub, err = bus.Subscribe(AccountDepositedEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			withdrawnSub, err = bus.Subscribe(AccountWithdrawnEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			limitExceededSub, err = bus.Subscribe(AccountLimitExceededEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(newTestAccount(Limits{}, withAllowance)).To(Succeed())
+		})
+
+		It("errors if carry-over is set without allowance", func() {
+			_, err := newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+
+				MaxCarryOver: MaxCarryOver,
+			}, limitsSnapshot{})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("accepts loads within allowance and declines once exhausted", func() {
+			Expect(processTxn(3000, "2000-01-05T10:00:00Z")).To(BeEmpty())
+			// Withdrawals don't restore allowance
+			Expect(processTxn(-1000, "2000-01-10T10:00:00Z")).To(BeEmpty())
+			Expect(processTxn(2000, "2000-01-20T10:00:00Z")).To(BeEmpty())
+
+			Expect(processTxn(0.01, "2000-01-31T23:59:59Z")).To(Equal(AllowanceExhausted))
+			// Loaded from events before last transaction
+			Expect(acc.monthlyTxn[acc.bucketKey(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).month]).To(Equal(
+				AllowanceRecord{Consumed: 5000},
+			))
+			// Next month starts with fresh allowance
+			Expect(processTxn(5000, "2000-02-01T00:00:00Z")).To(BeEmpty())
+		})
+
+		It("carries unused allowance into next months, capped at max carry-over", func() {
+			// 4000 unused, capped at 2000
+			Expect(processTxn(1000, "2000-01-05T10:00:00Z")).To(BeEmpty())
+			Expect(processTxn(7000, "2000-02-05T10:00:00Z")).To(BeEmpty())
+			Expect(processTxn(0.01, "2000-02-06T10:00:00Z")).To(Equal(AllowanceExhausted))
+			// Loaded from events before last transaction
+			Expect(acc.monthlyTxn[acc.bucketKey(time.Date(2000, 2, 1, 0, 0, 0, 0, time.UTC)).month]).To(Equal(
+				AllowanceRecord{Consumed: 7000, CarriedOver: 2000},
+			))
+
+			// Nothing is unused in February, but March
+			// had no transactions, so it carries over
+			// its allowance into April.
+			Expect(processTxn(7000.01, "2000-04-05T10:00:00Z")).To(Equal(AllowanceExhausted))
+			Expect(processTxn(7000, "2000-04-05T10:00:00Z")).To(BeEmpty())
+		})
+
+		It("replays allowance-usage deterministically across month-boundary", func() {
+			Expect(processTxn(3000, "2000-01-31T23:00:00Z")).To(BeEmpty())
+			Expect(processTxn(6000, "2000-02-01T01:00:00Z")).To(BeEmpty())
+			Expect(processTxn(500, "2000-02-01T02:00:00Z")).To(BeEmpty())
+
+			january := acc.bucketKey(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).month
+			for i := 0; i < 2; i++ {
+				Expect(newTestAccount(Limits{}, withAllowance)).To(Succeed())
+				// Declined transaction loads aggregate
+				// without adding any records.
+				Expect(processTxn(501, "2000-02-02T00:00:00Z")).To(Equal(AllowanceExhausted))
+				Expect(acc.monthlyTxn).To(Equal(map[int]AllowanceRecord{
+					january:     {Consumed: 3000},
+					january + 1: {Consumed: 6500, CarriedOver: 2000},
+				}))
+			}
+		})
+
+		It("tracks allowance by calendar-month of bucket-location", func() {
+			newYork, err := time.LoadLocation("America/New_York")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newTestAccount(Limits{}, withAllowance, func(cfg *AggregateCfg) {
+				cfg.BucketLocation = newYork
+			})).To(Succeed())
+
+			Expect(processTxn(3000, "2000-01-31T20:00:00Z")).To(BeEmpty())
+			// 23:00 of January 31 (EST), but February in UTC
+			Expect(processTxn(2000.01, "2000-02-01T04:00:00Z")).To(Equal(AllowanceExhausted))
+			// Midnight of February (EST), with January's
+			// unused allowance carried over.
+			Expect(processTxn(7000, "2000-02-01T05:00:00Z")).To(BeEmpty())
+		})
+
+		It("requires transactions to pass all configured limits", func() {
+			Expect(newTestAccount(Limits{
+				DailyTxnsAmountLimit: 4000,
+			}, withAllowance)).To(Succeed())
+			Expect(processTxn(4500, "2000-01-05T10:00:00Z")).To(Equal(DailyLimitsExceeded))
+			Expect(processTxn(4000, "2000-01-05T10:00:00Z")).To(BeEmpty())
+			Expect(processTxn(1500, "2000-01-06T10:00:00Z")).To(Equal(AllowanceExhausted))
+		})
+	})
+
+	When("bucketing limits in a location observing DST", func() {
+		custID := "1"
+
+		var depositedSub, limitExceededSub <-chan interface{}
+
+		// Returns failure of transaction,
+		// or nil if it was accepted.
+		var processTxn = func(txnTime string) *TxnFailure {
+			err := mockCmd(mockCmdCfg{
+				customerID: custID,
+				loadAmount: 100,
+				time:       txnTime,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			select {
+			case <-depositedSub:
+				return nil
+			case msg := <-limitExceededSub:
+				txnFailure := &TxnFailure{}
+				err := json.Unmarshal(msg.(model.Event).Data(), txnFailure)
+				Expect(err).ToNot(HaveOccurred())
+				return txnFailure
+			case <-time.After(busMsgReceiveTimeoutSec * time.Second):
+				Fail("timed-out waiting for transaction-result")
+			}
+			return nil
+		}
+
+		BeforeEach(func() {
+			var err error
+			depositedSub, err = bus.Subscribe(AccountDepositedEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+			limitExceededSub, err = bus.Subscribe(AccountLimitExceededEvent.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			newYork, err := time.LoadLocation("America/New_York")
+			Expect(err).ToNot(HaveOccurred())
+			limits, err := newLimitsSnapshot(0, Limits{
+				DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
+				NumDailyTxnsLimit:     NumDailyTxnsLimit,
+				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
+				NumWeeklyTxnsLimit:    NumWeeklyTxnsLimit,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			acc, err = newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+				LimitDetails:         true,
+
+				BucketLocation: newYork,
+			}, limits)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("limits transactions by local day on a spring-forward day", func() {
+			// 2021-03-14 (a Sunday) is 23 hours long in New York,
+			// from 05:00 UTC till 04:00 UTC of next day.
+			// 23:30 of previous day (EST)
+			Expect(processTxn("2021-03-14T04:30:00Z")).To(BeNil())
+			// 00:00 and 01:30 (EST), 03:30 (EDT)
+			Expect(processTxn("2021-03-14T05:00:00Z")).To(BeNil())
+			Expect(processTxn("2021-03-14T06:30:00Z")).To(BeNil())
+			Expect(processTxn("2021-03-14T07:30:00Z")).To(BeNil())
+
+			// 23:30 (EDT), fourth transaction of day
+			failure := processTxn("2021-03-15T03:30:00Z")
+			Expect(failure).ToNot(BeNil())
+			Expect(failure.FailureCause).To(Equal(DailyLimitsExceeded))
+			Expect(failure.LimitType).To(Equal(DailyNumTxnsLimit))
+
+			// Midnight of Monday (EDT), 23 hours after
+			// previous midnight, starts next day and week.
+			Expect(processTxn("2021-03-15T04:00:00Z")).To(BeNil())
+		})
+
+		It("limits transactions by local day on a fall-back day", func() {
+			// 2021-11-07 (a Sunday) is 25 hours long in New York,
+			// from 04:00 UTC till 05:00 UTC of next day.
+			// 00:00 (EDT), and 01:30 in both EDT and EST
+			Expect(processTxn("2021-11-07T04:00:00Z")).To(BeNil())
+			Expect(processTxn("2021-11-07T05:30:00Z")).To(BeNil())
+			Expect(processTxn("2021-11-07T06:30:00Z")).To(BeNil())
+
+			// 23:30 (EST), 24.5 hours after
+			// midnight, but still same day.
+			failure := processTxn("2021-11-08T04:30:00Z")
+			Expect(failure).ToNot(BeNil())
+			Expect(failure.FailureCause).To(Equal(DailyLimitsExceeded))
+			Expect(failure.LimitType).To(Equal(DailyNumTxnsLimit))
+
+			// Midnight of Monday (EST)
+			Expect(processTxn("2021-11-08T05:00:00Z")).To(BeNil())
+		})
+	})
+
+	// Category-usage is rebuilt from events by full replay,
+	// and from indexed transaction-IDs by bounded replay.
+	for _, isIndexed := range []bool{false, true} {
+		isIndexed := isIndexed
+
+		When(fmt.Sprintf("limiting transactions by category (indexed event-store: %t)", isIndexed), func() {
+			custID := "1"
+
+			var depositedSub, withdrawnSub, limitExceededSub <-chan interface{}
+
+			limits := Limits{
+				DailyTxnsAmountLimit:  DailyTxnsAmountLimit,
+				NumDailyTxnsLimit:     NumDailyTxnsLimit,
+				WeeklyTxnsAmountLimit: WeeklyTxnsAmountLimit,
+				NumWeeklyTxnsLimit:    NumWeeklyTxnsLimit,
+			}
+			var withCategories = func(categoryLimits map[string]Limits) func(*AggregateCfg) {
+				return func(cfg *AggregateCfg) {
+					cfg.LimitDetails = true
+					cfg.CategoryLimits = categoryLimits
+				}
+			}
+
+			// Returns failure of transaction,
+			// or nil if it was accepted.
+			var processTxn = func(category string, loadAmount float64, txnTime string) *TxnFailure {
+				err := mockCmd(mockCmdCfg{
+					customerID: custID,
+					loadAmount: loadAmount,
+					time:       txnTime,
+					category:   category,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				select {
+				case <-depositedSub:
+					return nil
+				case <-withdrawnSub:
+					return nil
+				case msg := <-limitExceededSub:
+					txnFailure := &TxnFailure{}
+					err := json.Unmarshal(msg.(model.Event).Data(), txnFailure)
+					Expect(err).ToNot(HaveOccurred())
+					return txnFailure
+				case <-time.After(busMsgReceiveTimeoutSec * time.Second):
+					Fail("timed-out waiting for transaction-result")
+				}
+				return nil
+			}
+
+			BeforeEach(func() {
+				var err error
+				eventRepo, err = newReplayRepo(bus, isIndexed)
+				Expect(err).ToNot(HaveOccurred())
+				depositedSub, err = bus.Subscribe(AccountDepositedEvent.String())
+				Expect(err).ToNot(HaveOccurred())
+				withdrawnSub, err = bus.Subscribe(AccountWithdrawnEvent.String())
+				Expect(err).ToNot(HaveOccurred())
+				limitExceededSub, err = bus.Subscribe(AccountLimitExceededEvent.String())
+				Expect(err).ToNot(HaveOccurred())
+
+				err = newTestAccount(limits, withCategories(map[string]Limits{
+					"ATM": {
+						DailyTxnsAmountLimit: 1000,
+						NumWeeklyTxnsLimit:   2,
+					},
+				}))
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("errors on invalid category-limits", func() {
+				err := newTestAccount(limits, withCategories(map[string]Limits{
+					"": {DailyTxnsAmountLimit: 1000},
+				}))
+				Expect(err).To(HaveOccurred())
+
+				err = newTestAccount(limits, withCategories(map[string]Limits{
+					"ATM": {
+						DailyTxnsAmountLimit:  1000,
+						WeeklyTxnsAmountLimit: 500,
+					},
+				}))
+				var limitsErr *LimitsError
+				Expect(errors.As(err, &limitsErr)).To(BeTrue())
+				Expect(limitsErr.Conflict).To(Equal(LimitWeeklyBelowDaily))
+			})
+
+			It("declines transaction exceeding category-limit within global limits", func() {
+				Expect(processTxn("ATM", 800, "2000-01-05T10:00:00Z")).To(BeNil())
+
+				failure := processTxn("ATM", 300, "2000-01-05T11:00:00Z")
+				Expect(failure).ToNot(BeNil())
+				Expect(failure.FailureCause).To(Equal(CategoryLimitsExceeded))
+				Expect(failure.Error).To(ContainSubstring("category: ATM"))
+				Expect(failure.LimitType).To(Equal(CategoryDailyAmountLimit))
+				Expect(failure.LimitValue).To(Equal(1000.0))
+				Expect(failure.CurrentValue).To(Equal(1100.0))
+
+				// Global daily-limit still allows same amount
+				// for other categories, or without category.
+				Expect(processTxn("online", 300, "2000-01-05T12:00:00Z")).To(BeNil())
+				Expect(processTxn("", 300, "2000-01-05T13:00:00Z")).To(BeNil())
+			})
+
+			It("checks global limits along with category-limits", func() {
+				Expect(processTxn("online", 4500, "2000-01-05T10:00:00Z")).To(BeNil())
+				failure := processTxn("ATM", 600, "2000-01-05T11:00:00Z")
+				Expect(failure).ToNot(BeNil())
+				Expect(failure.FailureCause).To(Equal(DailyLimitsExceeded))
+			})
+
+			It("tracks category-usage across days from replayed events", func() {
+				Expect(processTxn("ATM", 1000, "2000-01-03T10:00:00Z")).To(BeNil())
+				// Declined transactions aren't counted
+				Expect(processTxn("ATM", 1, "2000-01-03T11:00:00Z").FailureCause).To(Equal(
+					CategoryLimitsExceeded,
+				))
+				Expect(processTxn("ATM", 500, "2000-01-04T10:00:00Z")).To(BeNil())
+
+				// Account is loaded again from its events
+				Expect(newTestAccount(limits, withCategories(map[string]Limits{
+					"ATM": {
+						DailyTxnsAmountLimit: 1000,
+						NumWeeklyTxnsLimit:   2,
+					},
+				}))).To(Succeed())
+				failure := processTxn("ATM", 10, "2000-01-05T10:00:00Z")
+				Expect(failure).ToNot(BeNil())
+				Expect(failure.LimitType).To(Equal(CategoryWeeklyNumTxnsLimit))
+
+				week := categoryBucket{"ATM", 2000, 1}
+				Expect(acc.categoryWeeklyTxn).To(Equal(map[categoryBucket]TxnRecord{
+					week: {NumTxns: 2, TotalAmount: 1500},
+				}))
+				// Next ISO-week starts with fresh category-usage
+				Expect(processTxn("ATM", 10, "2000-01-10T10:00:00Z")).To(BeNil())
+			})
+		})
+	}
+
+	When("migrating state-schema", func() {
+		// Version 1 of State stored transaction-time
+		// with offset of transaction-request.
+		var v1Zone = time.FixedZone("", -5*60*60)
+
+		// downgrade rewrites State of event as version 1.
+		var downgrade = func(event model.Event) model.Event {
+			state := &State{}
+			Expect(json.Unmarshal(event.RawData(), state)).To(Succeed())
+			Expect(state.Version).To(Equal(StateVersion))
+			state.Version = 0
+			state.TxnTime = state.TxnTime.In(v1Zone)
+			data, err := json.Marshal(state)
+			Expect(err).ToNot(HaveOccurred())
+			return event.WithData(data)
+		}
+
+		// replay loads customer's account from events in store.
+		var replay = func(store eventutil.EventStore, custID string) accountState {
+			repo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+				Bus:            bus,
+				EventStore:     store,
+				UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			limits, err := newLimitsSnapshot(0, Limits{})
+			Expect(err).ToNot(HaveOccurred())
+			replayed, err := newAccount(&AggregateCfg{
+				Log:       logger.NewStdLogger("Account"),
+				EventRepo: repo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+			}, limits)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(replayed.loadAggregate(custID)).To(Succeed())
+			return replayed.accountState
+		}
+
+		It("upgrades version 1 states when decoding these", func() {
+			txnTime := time.Date(2000, 1, 5, 10, 0, 0, 0, time.UTC)
+			data, err := json.Marshal(&State{TxnID: "1", TxnTime: txnTime.In(v1Zone)})
+			Expect(err).ToNot(HaveOccurred())
+
+			state, err := DecodeState(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Version).To(Equal(StateVersion))
+			Expect(state.TxnTime).To(Equal(txnTime))
+
+			data, err = json.Marshal(&State{TxnID: "1", Version: StateVersion + 1})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = DecodeState(data)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("replays migrated events same as mixed-version events", func() {
+			Expect(mockCmd(
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 100, time: "2000-01-05T01:00:00Z"},
+				mockCmdCfg{txnID: "2", customerID: "1", loadAmount: 200, time: "2000-01-05T02:00:00Z"},
+				mockCmdCfg{txnID: "3", customerID: "2", loadAmount: 300, time: "2000-01-05T03:00:00Z"},
+				mockCmdCfg{txnID: "4", customerID: "1", loadAmount: -50, time: "2000-01-06T04:00:00Z"},
+				mockCmdCfg{txnID: "5", customerID: "1", loadAmount: 10, time: "2000-01-06T05:00:00Z"},
+				// Fourth transaction of day
+				mockCmdCfg{txnID: "6", customerID: "1", loadAmount: 10, time: "2000-01-06T06:00:00Z"},
+				mockCmdCfg{txnID: "7", customerID: "1", loadAmount: 10, time: "2000-01-06T07:00:00Z"},
+				// Duplicate
+				mockCmdCfg{txnID: "1", customerID: "1", loadAmount: 100, time: "2000-01-07T01:00:00Z"},
+			)).To(Succeed())
+			events, err := eventRepo.FetchByIndex(0)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Every other state is downgraded to version 1
+			original := eventutil.NewMemoryEventStore()
+			mixed := eventutil.NewMemoryEventStore()
+			numStates := 0
+			for _, event := range events {
+				Expect(original.Insert(event)).To(Succeed())
+				if event.Action() == AccountDepositedEvent || event.Action() == AccountWithdrawnEvent {
+					numStates++
+					if numStates%2 == 1 {
+						event = downgrade(event)
+					}
+				}
+				Expect(mixed.Insert(event)).To(Succeed())
+			}
+
+			migrated := eventutil.NewMemoryEventStore()
+			report, err := eventutil.MigrateEvents(
+				mixed,
+				migrated,
+				StateMigrator(AccountDepositedEvent, AccountWithdrawnEvent),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Migrated).To(Equal((numStates + 1) / 2))
+			Expect(report.Unchanged).To(Equal(len(events) - report.Migrated))
+			Expect(report.Failed).To(BeZero())
+
+			migratedEvents, err := migrated.FetchByIndex(0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(migratedEvents).To(HaveLen(len(events)))
+			for i, event := range migratedEvents {
+				Expect(event.ID()).To(Equal(events[i].ID()))
+				Expect(event.AggregateID()).To(Equal(events[i].AggregateID()))
+				Expect(event.Time()).To(Equal(events[i].Time()))
+				Expect(event.CausationKey()).To(Equal(events[i].CausationKey()))
+				Expect(event.CorrelationKey()).To(Equal(events[i].CorrelationKey()))
+			}
+
+			for _, custID := range []string{"1", "2"} {
+				expected := replay(mixed, custID)
+				Expect(replay(migrated, custID)).To(Equal(expected), custID)
+				Expect(replay(original, custID)).To(Equal(expected), custID)
+			}
+		})
+	})
+})
+
+// noScanRepo fails scans of event-store, so
+// specs can check these are avoided when
+// transaction-IDs are indexed.
+type noScanRepo struct {
+	*eventutil.LoggedEventRepo
+}
+
+func (r *noScanRepo) FetchByIndex(int) ([]model.Event, error) {
+	return nil, errors.New("event-store was scanned")
+}
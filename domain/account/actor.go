@@ -0,0 +1,271 @@
+package account
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/metrics"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Default capacity of an actor's mailbox.
+const defaultActorMailboxSize = 100
+
+// Default maximum of actors kept by a pool.
+const defaultMaxActors = 1000
+
+// accountActor is a long-lived account-aggregate for a single
+// customer. It handles commands from its mailbox sequentially,
+// and retains account-state between commands instead of
+// replaying events from event-repo for every command.
+type accountActor struct {
+	mailbox chan model.Cmd
+	// Closed once actor returns
+	done chan struct{}
+	// Element of actor in pool's recently-used list
+	usage *list.Element
+
+	limits  *atomic.Value
+	metrics metrics.Metrics
+
+	// Reset and reloaded from event-repo if a command
+	// is older than account's current limits-window.
+	account *account
+}
+
+// actorPool routes commands to an accountActor per customer.
+// Actors run concurrently, so commands are only ordered per
+// customer. Once pool has max actors, least recently used
+// actor is evicted to start an actor for another customer.
+// Evicted customers are replayed from event-repo if these
+// have commands again. Use #newActorPool to create new instance.
+type actorPool struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     *sync.WaitGroup
+
+	mailboxSize int
+	maxActors   int
+	limits      *atomic.Value
+	metrics     metrics.Metrics
+	// Accounts of actors are copied from this account, since
+	// validating config (in #newAccount) reads event-repo's
+	// fields, which is unsafe once actors are running.
+	template *account
+
+	actors map[string]*accountActor
+	// Customer-IDs of actors, most recently used first
+	usage *list.List
+	// Receives first error returned by any actor
+	errChan chan error
+}
+
+// newActorPool creates pool of account-actors. Actors run until
+// evicted or until pool is stopped, see #stop.
+func newActorPool(
+	mailboxSize int,
+	maxActors int,
+	accountCfg *AggregateCfg,
+	limits *atomic.Value,
+	appMetrics metrics.Metrics,
+) (*actorPool, error) {
+	template, err := newAccount(accountCfg, limits.Load().(limitsSnapshot))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating account-aggregate instance")
+	}
+	template.retainState = true
+	if mailboxSize == 0 {
+		mailboxSize = defaultActorMailboxSize
+	}
+	if maxActors == 0 {
+		maxActors = defaultMaxActors
+	}
+	// Not derived from listener's context, so actors keep
+	// running till pool is stopped after last dispatch.
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &actorPool{
+		ctx:    ctx,
+		cancel: cancel,
+		wg:     &sync.WaitGroup{},
+
+		mailboxSize: mailboxSize,
+		maxActors:   maxActors,
+		limits:      limits,
+		metrics:     appMetrics,
+		template:    template,
+
+		actors:  make(map[string]*accountActor),
+		usage:   list.New(),
+		errChan: make(chan error, 1),
+	}, nil
+}
+
+// size returns number of actors in pool.
+func (p *actorPool) size() int {
+	return len(p.actors)
+}
+
+// dispatch sends command to mailbox of customer's actor,
+// starting the actor if required. Blocks while mailbox is
+// full, and errors if an actor has failed meanwhile.
+func (p *actorPool) dispatch(cmd model.Cmd) error {
+	txn := &model.Transaction{}
+	err := json.Unmarshal(cmd.RawData(), txn)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling command-data")
+	}
+
+	actor, exists := p.actors[txn.CustomerID]
+	if exists {
+		p.usage.MoveToFront(actor.usage)
+	} else {
+		if len(p.actors) >= p.maxActors {
+			p.evict(p.usage.Back().Value.(string))
+		}
+		actor = p.startActor(txn.CustomerID)
+	}
+
+	select {
+	case actor.mailbox <- cmd:
+		return nil
+	case err := <-p.errChan:
+		return err
+	}
+}
+
+func (p *actorPool) startActor(custID string) *accountActor {
+	acc := *p.template
+	acc.reset()
+	actor := &accountActor{
+		mailbox: make(chan model.Cmd, p.mailboxSize),
+		done:    make(chan struct{}),
+		usage:   p.usage.PushFront(custID),
+		limits:  p.limits,
+		metrics: p.metrics,
+		account: &acc,
+	}
+	p.actors[custID] = actor
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(actor.done)
+		err := actor.run(p.ctx)
+		if err != nil {
+			select {
+			case p.errChan <- errors.Wrapf(err, "actor for customer %s failed", custID):
+			default:
+			}
+		}
+	}()
+	return actor
+}
+
+// evict stops actor of customer once it handles commands
+// in its mailbox, so a later actor for same customer
+// doesn't process customer's commands concurrently.
+func (p *actorPool) evict(custID string) {
+	actor := p.actors[custID]
+	close(actor.mailbox)
+	<-actor.done
+
+	delete(p.actors, custID)
+	p.usage.Remove(actor.usage)
+}
+
+// errs receives first error returned by any actor.
+func (p *actorPool) errs() <-chan error {
+	return p.errChan
+}
+
+// stop stops all actors once these handle commands remaining
+// in their mailboxes, and waits for them to return. Returns
+// first error returned by any actor, if not yet received.
+// Must not be called concurrently with #dispatch.
+func (p *actorPool) stop() error {
+	p.cancel()
+	p.wg.Wait()
+
+	select {
+	case err := <-p.errChan:
+		return err
+	default:
+		return nil
+	}
+}
+
+// run handles commands from mailbox until mailbox is closed,
+// or context is done, after which commands remaining in
+// mailbox are handled before returning.
+func (ac *accountActor) run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ac.drain()
+
+		case cmd, ok := <-ac.mailbox:
+			if !ok {
+				return nil
+			}
+			err := ac.process(cmd)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// drain handles commands remaining in mailbox.
+func (ac *accountActor) drain() error {
+	for {
+		select {
+		case cmd, ok := <-ac.mailbox:
+			if !ok {
+				return nil
+			}
+			err := ac.process(cmd)
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (ac *accountActor) process(cmd model.Cmd) error {
+	startTime := time.Now()
+	err := ac.handle(cmd)
+	if err != nil {
+		return errors.Wrap(err, "error handling process-transaction command")
+	}
+	ac.metrics.ObserveTxnProcessing(time.Since(startTime))
+	return nil
+}
+
+func (ac *accountActor) handle(cmd model.Cmd) error {
+	txn := &model.Transaction{}
+	err := json.Unmarshal(cmd.RawData(), txn)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling command-data")
+	}
+	// Buckets before current limits-window are pruned from
+	// retained state, so older transactions need a reload.
+	if ac.account.windowStart(txn.Time).Before(ac.account.pruneBefore) {
+		ac.account.reset()
+	}
+	ac.account.limits = ac.limits.Load().(limitsSnapshot)
+
+	err = ac.account.handleProcessTxnCmd(cmd)
+	if err != nil {
+		return err
+	}
+	return ac.account.applyPublished()
+}
@@ -0,0 +1,375 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// countingEventRepo counts events replayed
+// from event-repo by fetching aggregates.
+type countingEventRepo struct {
+	eventutil.EventRepo
+
+	lock           *sync.Mutex
+	numFetches     int
+	numEventsFetch int
+}
+
+func (r *countingEventRepo) Fetch(aggID string) ([]model.Event, error) {
+	events, err := r.EventRepo.Fetch(aggID)
+	r.lock.Lock()
+	r.numFetches++
+	r.numEventsFetch += len(events)
+	r.lock.Unlock()
+	return events, err
+}
+
+func (r *countingEventRepo) counts() (int, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.numFetches, r.numEventsFetch
+}
+
+var _ = Describe("CmdListener actor-mode", func() {
+	const (
+		ProcessTxnCmd model.CmdAction = "ProcessTxn"
+	)
+	const (
+		AccountDepositedEvent     model.EventAction = "AccountDeposited"
+		AccountWithdrawnEvent     model.EventAction = "AccountWithdrawn"
+		DuplicateTxnEvent         model.EventAction = "DuplicateTxn"
+		AccountLimitExceededEvent model.EventAction = "AccountLimitExceeded"
+		BalanceSnapshotEvent      model.EventAction = "BalanceSnapshot"
+	)
+
+	type listenerRun struct {
+		bus       eventutil.Bus
+		eventRepo *countingEventRepo
+		cancel    context.CancelFunc
+		errGroup  *errgroup.Group
+	}
+
+	var runs []*listenerRun
+
+	// Starts a command-listener with its own bus and event-repo
+	var startListener = func(actorMode bool) *listenerRun {
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		loggedRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+			Bus:            bus,
+			EventStore:     eventutil.NewMemoryEventStore(),
+			UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		eventRepo := &countingEventRepo{
+			EventRepo: loggedRepo,
+			lock:      &sync.Mutex{},
+		}
+
+		listenerCfg := &CmdListenerCfg{
+			Log:           logger.NewStdLogger("account/CmdListener"),
+			Bus:           bus,
+			ProcessTxnCmd: ProcessTxnCmd,
+			ActorMode:     actorMode,
+			// Small mailboxes, so dispatch blocks on full mailboxes
+			ActorMailboxSize: 2,
+
+			AccountCfg: &AggregateCfg{
+				Log:       logger.NewStdLogger("account/Aggregate"),
+				EventRepo: eventRepo,
+
+				AccountDeposited:     AccountDepositedEvent,
+				AccountWithdrawn:     AccountWithdrawnEvent,
+				DuplicateTxn:         DuplicateTxnEvent,
+				AccountLimitExceeded: AccountLimitExceededEvent,
+				BalanceSnapshot:      BalanceSnapshotEvent,
+				SnapshotEveryNTxns:   2,
+
+				DailyTxnsAmountLimit:  5000,
+				NumDailyTxnsLimit:     3,
+				WeeklyTxnsAmountLimit: 20000,
+			},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errGroup, _ := errgroup.WithContext(context.Background())
+		errGroup.Go(func() error {
+			return InitCmdListener(ctx, listenerCfg)
+		})
+		// Ensure the goroutine above
+		// is ready to process messages
+		time.Sleep(10 * time.Millisecond)
+
+		run := &listenerRun{
+			bus:       bus,
+			eventRepo: eventRepo,
+			cancel:    cancel,
+			errGroup:  errGroup,
+		}
+		runs = append(runs, run)
+		return run
+	}
+
+	// Publishes commands for transactions, and waits
+	// for a result-event for every transaction.
+	var process = func(run *listenerRun, txns []model.Transaction) {
+		resultActions := []model.EventAction{
+			AccountDepositedEvent,
+			AccountWithdrawnEvent,
+			DuplicateTxnEvent,
+			AccountLimitExceededEvent,
+		}
+		resultSubs := make([]<-chan interface{}, len(resultActions))
+		for i, action := range resultActions {
+			sub, err := run.bus.Subscribe(action.String())
+			Expect(err).ToNot(HaveOccurred())
+			resultSubs[i] = sub
+		}
+
+		// Published concurrently, since Bus blocks
+		// until results below are received.
+		published := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(published)
+			for _, txn := range txns {
+				cmd, err := model.NewCmd(&model.CmdCfg{
+					Action: ProcessTxnCmd,
+					Data:   txn,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				err = run.bus.Publish(cmd)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		}()
+
+		numResults := 0
+		timeout := time.After(5 * time.Second)
+		for numResults < len(txns) {
+			select {
+			case <-resultSubs[0]:
+			case <-resultSubs[1]:
+			case <-resultSubs[2]:
+			case <-resultSubs[3]:
+			case <-timeout:
+				Fail(fmt.Sprintf("received %d of %d results", numResults, len(txns)))
+			}
+			numResults++
+		}
+		<-published
+	}
+
+	// Returns actions and data of events stored for customer.
+	var customerEvents = func(run *listenerRun, custID string) []string {
+		events, err := run.eventRepo.EventRepo.Fetch(custID)
+		Expect(err).ToNot(HaveOccurred())
+
+		results := make([]string, len(events))
+		for i, event := range events {
+			results[i] = fmt.Sprintf("%s: %s", event.Action(), event.Data())
+		}
+		return results
+	}
+
+	BeforeEach(func() {
+		runs = make([]*listenerRun, 0)
+	})
+
+	AfterEach(func() {
+		for _, run := range runs {
+			run.cancel()
+			err := run.errGroup.Wait()
+			Expect(err).ToNot(HaveOccurred())
+			run.bus.Terminate()
+		}
+	})
+
+	It("produces same events as replaying account for every command", func() {
+		baseTime, err := time.Parse(time.RFC3339, "2000-01-05T00:00:01Z")
+		Expect(err).ToNot(HaveOccurred())
+
+		custIDs := []string{"1", "2", "3"}
+		txns := make([]model.Transaction, 0)
+		for i := 0; i < 12; i++ {
+			for c, custID := range custIDs {
+				txns = append(txns, model.Transaction{
+					ID:         fmt.Sprintf("%s-%d", custID, i),
+					CustomerID: custID,
+					LoadAmount: float64((i%4)*1000 + c*100 - 500),
+					Time:       baseTime.Add(time.Duration(i*20) * time.Hour),
+				})
+			}
+		}
+		txns = append(
+			txns,
+			// Duplicate transaction
+			model.Transaction{ID: "1-3", CustomerID: "1", LoadAmount: 10, Time: baseTime.Add(300 * time.Hour)},
+			// Older than current limits-window of account
+			model.Transaction{ID: "2-old", CustomerID: "2", LoadAmount: 10, Time: baseTime},
+			// Insufficient funds
+			model.Transaction{ID: "3-big", CustomerID: "3", LoadAmount: -100000, Time: baseTime.Add(300 * time.Hour)},
+		)
+
+		replayRun := startListener(false)
+		actorRun := startListener(true)
+		process(replayRun, txns)
+		process(actorRun, txns)
+
+		for _, custID := range custIDs {
+			replayEvents := customerEvents(replayRun, custID)
+			Expect(replayEvents).ToNot(BeEmpty())
+			Expect(customerEvents(actorRun, custID)).To(Equal(replayEvents), custID)
+		}
+	})
+
+	It("replays each account once for repeat-customer workloads", func() {
+		baseTime, err := time.Parse(time.RFC3339, "2000-01-05T00:00:01Z")
+		Expect(err).ToNot(HaveOccurred())
+
+		const numCustomers = 3
+		const numTxnsPerCustomer = 30
+		txns := make([]model.Transaction, 0)
+		for i := 0; i < numTxnsPerCustomer; i++ {
+			for c := 0; c < numCustomers; c++ {
+				txns = append(txns, model.Transaction{
+					ID:         fmt.Sprintf("%d-%d", c, i),
+					CustomerID: fmt.Sprint(c),
+					LoadAmount: 10,
+					Time:       baseTime.Add(time.Duration(i) * time.Minute),
+				})
+			}
+		}
+
+		replayRun := startListener(false)
+		actorRun := startListener(true)
+		process(replayRun, txns)
+		process(actorRun, txns)
+
+		replayFetches, replayedEvents := replayRun.eventRepo.counts()
+		actorFetches, actorReplayedEvents := actorRun.eventRepo.counts()
+		// Replay-approach loads account for every command,
+		// replaying all previous events of customer.
+		Expect(replayFetches).To(Equal(len(txns)))
+		Expect(replayedEvents).To(BeNumerically(">", len(txns)))
+		// Actors load each account once
+		Expect(actorFetches).To(Equal(numCustomers))
+		Expect(actorReplayedEvents).To(BeZero())
+	})
+})
+
+var _ = Describe("actorPool", func() {
+	const (
+		AccountDepositedEvent     model.EventAction = "AccountDeposited"
+		AccountWithdrawnEvent     model.EventAction = "AccountWithdrawn"
+		DuplicateTxnEvent         model.EventAction = "DuplicateTxn"
+		AccountLimitExceededEvent model.EventAction = "AccountLimitExceeded"
+	)
+
+	var bus eventutil.Bus
+	var eventRepo *countingEventRepo
+
+	// Creates pool of actors with small mailboxes
+	var newPool = func(mailboxSize int, maxActors int) *actorPool {
+		accountCfg := &AggregateCfg{
+			Log:       logger.NewStdLogger("account/Aggregate"),
+			EventRepo: eventRepo,
+
+			AccountDeposited:     AccountDepositedEvent,
+			AccountWithdrawn:     AccountWithdrawnEvent,
+			DuplicateTxn:         DuplicateTxnEvent,
+			AccountLimitExceeded: AccountLimitExceededEvent,
+		}
+		snapshot, err := newLimitsSnapshot(0, accountCfg.limits())
+		Expect(err).ToNot(HaveOccurred())
+		limits := &atomic.Value{}
+		limits.Store(snapshot)
+
+		pool, err := newActorPool(mailboxSize, maxActors, accountCfg, limits, metrics.OrNoop(nil))
+		Expect(err).ToNot(HaveOccurred())
+		return pool
+	}
+
+	var dispatch = func(pool *actorPool, custID string, i int) {
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action: "ProcessTxn",
+			Data: model.Transaction{
+				ID:         fmt.Sprintf("%s-%d", custID, i),
+				CustomerID: custID,
+				LoadAmount: 10,
+				Time:       time.Date(2000, 1, 5, 0, i, 0, 0, time.UTC),
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pool.dispatch(cmd)).To(Succeed())
+	}
+
+	var numEvents = func(custID string) int {
+		events, err := eventRepo.EventRepo.Fetch(custID)
+		Expect(err).ToNot(HaveOccurred())
+		return len(events)
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		loggedRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+			Bus:            bus,
+			EventStore:     eventutil.NewMemoryEventStore(),
+			UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		eventRepo = &countingEventRepo{
+			EventRepo: loggedRepo,
+			lock:      &sync.Mutex{},
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("handles commands remaining in mailboxes once stopped", func() {
+		const numTxns = 50
+		pool := newPool(numTxns, 0)
+		for i := 0; i < numTxns; i++ {
+			dispatch(pool, "1", i)
+		}
+		Expect(pool.stop()).To(Succeed())
+		Expect(numEvents("1")).To(Equal(numTxns))
+	})
+
+	It("evicts least recently used actor beyond max actors", func() {
+		pool := newPool(2, 2)
+		dispatch(pool, "1", 0)
+		dispatch(pool, "2", 0)
+		dispatch(pool, "1", 1)
+		// Evicts actor of customer 2
+		dispatch(pool, "3", 0)
+		Expect(pool.size()).To(Equal(2))
+		Expect(pool.actors).To(HaveKey("1"))
+		Expect(pool.actors).To(HaveKey("3"))
+		// Evicted actor handled its commands
+		Expect(numEvents("2")).To(Equal(1))
+
+		// Customer 2 is replayed by a new actor
+		dispatch(pool, "2", 1)
+		Expect(pool.stop()).To(Succeed())
+		Expect(numEvents("2")).To(Equal(2))
+		numFetches, numEventsFetched := eventRepo.counts()
+		Expect(numFetches).To(Equal(4))
+		Expect(numEventsFetched).To(Equal(1))
+	})
+})
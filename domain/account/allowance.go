@@ -0,0 +1,124 @@
+package account
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// AllowanceRecord is usage of monthly-allowance for a
+// calendar-month, as observed in bucket-location.
+// Only loads (positive load-amounts) consume allowance,
+// withdrawals don't restore it.
+type AllowanceRecord struct {
+	// Total amount loaded in month
+	Consumed float64
+	// Unused allowance carried into month from previous
+	// months. Fixed when month's first transaction is
+	// processed, so replaying events yields same carry-over.
+	CarriedOver float64
+}
+
+// carryOverInto returns unused allowance carried into
+// month. Allowance unused in latest month with a record
+// before provided month carries over, and every month
+// without transactions since carries over its full
+// allowance, each capped at max carry-over.
+func (a *accountState) carryOverInto(month int) float64 {
+	if a.maxCarryOver == 0 {
+		return 0
+	}
+	prevMonth := -1
+	for recordMonth := range a.monthlyTxn {
+		if recordMonth < month && recordMonth > prevMonth {
+			prevMonth = recordMonth
+		}
+	}
+	// No allowance to carry before first month
+	if prevMonth == -1 {
+		return 0
+	}
+
+	prev := a.monthlyTxn[prevMonth]
+	carryOver := a.cappedCarryOver(a.monthlyAllowance + prev.CarriedOver - prev.Consumed)
+	for m := prevMonth + 1; m < month; m++ {
+		carryOver = a.cappedCarryOver(a.monthlyAllowance + carryOver)
+	}
+	return carryOver
+}
+
+func (a *accountState) cappedCarryOver(unused float64) float64 {
+	if unused < 0 {
+		return 0
+	}
+	if unused > a.maxCarryOver {
+		return a.maxCarryOver
+	}
+	return unused
+}
+
+// checkMonthlyAllowance checks if transaction passes monthly-
+// allowance for this account. Also publishes AccountLimitExceeded
+// event on Bus.
+// Return params:
+//   - AllowanceRecord: New Monthly-Allowance record for this account.
+//   - error: Critical errors encountered while validating
+//     for monthly-allowance.
+func (a *account) checkMonthlyAllowance(
+	cmd model.Cmd,
+	txn *model.Transaction,
+) (*AllowanceRecord, error) {
+	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmd.ID(), txn.ID)
+
+	a.log.Tracef("%s Validating monthly allowance", logPrefix)
+	monthlyTxnRecord, err := a.monthlyRecordWith(txn)
+	if err != nil {
+		failure := &TxnFailure{
+			Txn:          *txn,
+			Error:        err.Error(),
+			FailureCause: AllowanceExhausted,
+		}
+		subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.accountLimitExceeded)
+
+		a.log.Tracef("%s Publishing failure-event", subLogPrefix)
+		err = a.publishEvent(cmd, a.accountLimitExceeded, failure)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err,
+				"error publishing event: %s", a.accountLimitExceeded,
+			)
+		}
+		a.log.Tracef("%s Published failure-event", subLogPrefix)
+		return nil, nil
+	}
+	return &monthlyTxnRecord, nil
+}
+
+// monthlyRecordWith returns monthly-record of account including
+// transaction. Errors if transaction exceeds allowance of month,
+// including carry-over. Usage is recorded even if allowance is
+// disabled.
+func (a *account) monthlyRecordWith(txn *model.Transaction) (AllowanceRecord, error) {
+	month := a.bucketKey(txn.Time).month
+	monthlyTxnRecord, found := a.monthlyTxn[month]
+	if !found {
+		monthlyTxnRecord.CarriedOver = a.carryOverInto(month)
+	}
+	if txn.LoadAmount > 0 {
+		monthlyTxnRecord.Consumed += txn.LoadAmount
+	}
+
+	if a.monthlyAllowance == 0 {
+		return monthlyTxnRecord, nil
+	}
+	available := a.monthlyAllowance + monthlyTxnRecord.CarriedOver
+	if monthlyTxnRecord.Consumed > available {
+		return monthlyTxnRecord, fmt.Errorf(
+			"monthly allowance exhausted, exceeded by: $%.2f",
+			monthlyTxnRecord.Consumed-available,
+		)
+	}
+	return monthlyTxnRecord, nil
+}
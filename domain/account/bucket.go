@@ -0,0 +1,98 @@
+package account
+
+import "time"
+
+// bucketKey identifies limit-buckets a transaction-time falls in.
+// Use #bucketKeyOf to derive keys.
+type bucketKey struct {
+	// Calendar-year, and day of that year
+	year int
+	day  int
+	// ISO-year, and ISO-week of that year. ISO-year differs
+	// from calendar-year for days around new-year, such
+	// as 1999-01-01 falling in week 53 of 1998.
+	weekYear int
+	week     int
+	// Calendar-month, such that consecutive
+	// months have consecutive keys.
+	month int
+}
+
+// bucketKeyOf derives keys of limit-buckets containing t, with
+// days/weeks/months as observed in location loc (UTC if nil).
+// Buckets are keyed only through this, both when accepting
+// transactions and when replaying their events, so decisions
+// after a rebuild match decisions when transactions were accepted.
+func bucketKeyOf(t time.Time, loc *time.Location) bucketKey {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	weekYear, week := t.ISOWeek()
+	return bucketKey{
+		year:     t.Year(),
+		day:      t.YearDay(),
+		weekYear: weekYear,
+		week:     week,
+		month:    t.Year()*12 + int(t.Month()) - 1,
+	}
+}
+
+// bucketKey derives keys of limit-buckets
+// containing t, as observed in bucket-location.
+func (a *accountState) bucketKey(t time.Time) bucketKey {
+	return bucketKeyOf(t, a.bucketLocation)
+}
+
+// windowStart returns start of largest limits-window
+// (ISO-week, starting Monday) containing provided time,
+// at local midnight in location loc (UTC if nil).
+// Days are stepped by calendar-date, rather than as 24
+// hours, so DST-transitions don't shift window's start.
+func windowStart(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	daysSinceMonday := (int(dayStart.Weekday()) + 6) % 7
+	return dayStart.AddDate(0, 0, -daysSinceMonday)
+}
+
+// windowStart returns start of largest limits-window
+// containing provided time, in bucket-location.
+func (a *accountState) windowStart(t time.Time) time.Time {
+	return windowStart(t, a.bucketLocation)
+}
+
+// dayStart returns local midnight, in bucket-location,
+// starting provided day (see bucketKey#day) of year.
+func (a *accountState) dayStart(year, day int) time.Time {
+	loc := a.bucketLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.Date(year, time.January, day, 0, 0, 0, 0, loc)
+}
+
+// weekStart returns local midnight, in bucket-location,
+// starting provided ISO-week (see bucketKey#week) of year.
+func (a *accountState) weekStart(weekYear, week int) time.Time {
+	// January 4th is always in first ISO-week of year
+	firstWeekStart := a.windowStart(a.dayStart(weekYear, 4))
+	return firstWeekStart.AddDate(0, 0, 7*(week-1))
+}
+
+// PeriodStarts returns starts of day and ISO-week (local
+// midnight in location loc, UTC if nil) containing t, same
+// as limit-buckets of accounts with loc as BucketLocation.
+// Views of usage key their periods by these, so views
+// match usage tracked by accounts.
+func PeriodStarts(t time.Time, loc *time.Location) (time.Time, time.Time) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	key := bucketKeyOf(t, loc)
+	dayStart := time.Date(key.year, time.January, key.day, 0, 0, 0, 0, loc)
+	return dayStart, windowStart(t, loc)
+}
@@ -0,0 +1,207 @@
+package account
+
+import (
+	"encoding/json"
+	"time"
+	// Hostile instants use IANA-zones, which aren't
+	// available on every system running tests.
+	_ "time/tzdata"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Bucket-keys", func() {
+	var newYork, london *time.Location
+
+	BeforeEach(func() {
+		var err error
+		newYork, err = time.LoadLocation("America/New_York")
+		Expect(err).ToNot(HaveOccurred())
+		london, err = time.LoadLocation("Europe/London")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	// hourly returns instants every hour from start till end (inclusive).
+	hourly := func(start, end string) []time.Time {
+		startTime, err := time.Parse(time.RFC3339, start)
+		Expect(err).ToNot(HaveOccurred())
+		endTime, err := time.Parse(time.RFC3339, end)
+		Expect(err).ToNot(HaveOccurred())
+
+		instants := make([]time.Time, 0)
+		for t := startTime; !t.After(endTime); t = t.Add(time.Hour) {
+			instants = append(instants, t)
+		}
+		return instants
+	}
+
+	// acceptKey derives key as when accepting transaction,
+	// from transaction decoded from process-command.
+	acceptKey := func(t time.Time, loc *time.Location) bucketKey {
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action: "ProcessTxn",
+			Data: &model.Transaction{
+				ID:         "1",
+				CustomerID: "1",
+				LoadAmount: 10,
+				Time:       t,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		txn := &model.Transaction{}
+		Expect(json.Unmarshal(cmd.Data(), txn)).To(Succeed())
+		return bucketKeyOf(txn.Time, loc)
+	}
+
+	// replayKey derives key as when replaying
+	// events, from state decoded from event.
+	replayKey := func(t time.Time, loc *time.Location) bucketKey {
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      "AccountDeposited",
+			Data: &State{
+				TxnID:   "1",
+				CustID:  "1",
+				TxnTime: t,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		state := &State{}
+		Expect(json.Unmarshal(event.RawData(), state)).To(Succeed())
+		return bucketKeyOf(state.TxnTime, loc)
+	}
+
+	It("derives same keys when accepting and replaying hostile instants", func() {
+		instants := make([]time.Time, 0)
+		for _, period := range [][2]string{
+			// ISO-week 53 of 1998 spans new-year
+			{"1998-12-31T00:00:00Z", "1999-01-04T23:00:00Z"},
+			// ISO-week 53 of 2020 spans new-year
+			{"2020-12-28T00:00:00Z", "2021-01-04T23:00:00Z"},
+			// Spring-forward and fall-back in America/New_York
+			{"2021-03-14T04:00:00Z", "2021-03-14T09:00:00Z"},
+			{"2021-11-07T03:00:00Z", "2021-11-07T08:00:00Z"},
+			// Spring-forward and fall-back in Europe/London
+			{"2021-03-27T22:00:00Z", "2021-03-28T03:00:00Z"},
+			{"2021-10-30T22:00:00Z", "2021-10-31T03:00:00Z"},
+			// Leap-day
+			{"2020-02-28T00:00:00Z", "2020-03-01T23:00:00Z"},
+		} {
+			instants = append(instants, hourly(period[0], period[1])...)
+		}
+		// Instants just around midnights and DST-transitions
+		for _, instant := range []string{
+			"1998-12-31T23:59:59.999999999Z",
+			"1999-01-01T00:00:00Z",
+			"1999-01-03T23:59:59Z",
+			"2021-01-03T23:59:59.5Z",
+			"2021-03-14T01:59:59-05:00",
+			"2021-03-14T03:00:00-04:00",
+			"2021-11-07T01:30:00-04:00",
+			"2021-11-07T01:30:00-05:00",
+			"2021-03-28T00:59:59Z",
+			"2021-03-28T02:00:00+01:00",
+			"2020-02-29T23:59:59.999Z",
+		} {
+			t, err := time.Parse(time.RFC3339Nano, instant)
+			Expect(err).ToNot(HaveOccurred())
+			instants = append(instants, t)
+		}
+
+		fixedZone := time.FixedZone("", 14*60*60)
+		for _, loc := range []*time.Location{nil, time.UTC, newYork, london} {
+			for _, instant := range instants {
+				expected := bucketKeyOf(instant, loc)
+				// Same instant, as written in various zones
+				for _, inputZone := range []*time.Location{time.UTC, newYork, london, fixedZone} {
+					input := instant.In(inputZone)
+					Expect(acceptKey(input, loc)).To(Equal(expected), "%s in %s", input, loc)
+					Expect(replayKey(input, loc)).To(Equal(expected), "%s in %s", input, loc)
+				}
+			}
+		}
+	})
+
+	table.DescribeTable(
+		"derives keys of calendar-day, ISO-week and calendar-month",
+		func(instant string, zone string, year, day, weekYear, week int, month time.Month) {
+			t, err := time.Parse(time.RFC3339, instant)
+			Expect(err).ToNot(HaveOccurred())
+			loc := time.UTC
+			if zone != "" {
+				loc, err = time.LoadLocation(zone)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			Expect(bucketKeyOf(t, loc)).To(Equal(bucketKey{
+				year:     year,
+				day:      day,
+				weekYear: weekYear,
+				week:     week,
+				month:    year*12 + int(month) - 1,
+			}))
+		},
+		table.Entry("last day of 1998", "1998-12-31T12:00:00Z", "", 1998, 365, 1998, 53, time.December),
+		table.Entry("first day of 1999, in week 53 of 1998",
+			"1999-01-01T12:00:00Z", "", 1999, 1, 1998, 53, time.January),
+		table.Entry("first Monday of 1999", "1999-01-04T00:00:00Z", "", 1999, 4, 1999, 1, time.January),
+		table.Entry("first day of week 53 of 2020", "2020-12-28T00:00:00Z", "", 2020, 363, 2020, 53, time.December),
+		table.Entry("last day of week 53 of 2020",
+			"2021-01-03T23:59:59Z", "", 2021, 3, 2020, 53, time.January),
+		table.Entry("leap-day", "2020-02-29T12:00:00Z", "", 2020, 60, 2020, 9, time.February),
+		table.Entry("first week of 2021 in UTC, week 53 of 2020 in New York",
+			"2021-01-04T03:00:00Z", "America/New_York", 2021, 3, 2020, 53, time.January),
+		table.Entry("before spring-forward in New York, previous day",
+			"2021-03-14T04:30:00Z", "America/New_York", 2021, 72, 2021, 10, time.March),
+		table.Entry("after spring-forward in New York",
+			"2021-03-14T07:00:00Z", "America/New_York", 2021, 73, 2021, 10, time.March),
+		table.Entry("after spring-forward in London, next day and week",
+			"2021-03-28T23:30:00Z", "Europe/London", 2021, 88, 2021, 13, time.March),
+		table.Entry("end of month in UTC, next month in London",
+			"2021-08-31T23:30:00Z", "Europe/London", 2021, 244, 2021, 35, time.September),
+	)
+
+	table.DescribeTable(
+		"derives start of limits-window at local midnight of Monday",
+		func(instant string, zone string, expected string) {
+			t, err := time.Parse(time.RFC3339, instant)
+			Expect(err).ToNot(HaveOccurred())
+			expectedTime, err := time.Parse(time.RFC3339, expected)
+			Expect(err).ToNot(HaveOccurred())
+			var loc *time.Location
+			if zone != "" {
+				loc, err = time.LoadLocation(zone)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			start := windowStart(t, loc)
+			Expect(start.Equal(expectedTime)).To(BeTrue(), "expected %s, got %s", expectedTime, start)
+
+			// Week is keyed same as window, and its
+			// start is derived back by calendar-dates.
+			state := &accountState{bucketLocation: loc}
+			key := state.bucketKey(t)
+			Expect(state.weekStart(key.weekYear, key.week).Equal(expectedTime)).To(BeTrue())
+			Expect(state.dayStart(key.year, key.day).After(t)).To(BeFalse())
+		},
+		table.Entry("UTC by default", "2021-03-17T12:00:00Z", "", "2021-03-15T00:00:00Z"),
+		table.Entry("week after spring-forward in New York",
+			"2021-03-17T12:00:00Z", "America/New_York", "2021-03-15T04:00:00Z"),
+		table.Entry("week with spring-forward in New York, before transition",
+			"2021-03-14T06:30:00Z", "America/New_York", "2021-03-08T05:00:00Z"),
+		table.Entry("week with spring-forward in New York, after transition",
+			"2021-03-15T03:30:00Z", "America/New_York", "2021-03-08T05:00:00Z"),
+		table.Entry("week with fall-back in New York, after transition",
+			"2021-11-08T04:30:00Z", "America/New_York", "2021-11-01T04:00:00Z"),
+		table.Entry("week after fall-back in New York",
+			"2021-11-08T05:00:00Z", "America/New_York", "2021-11-08T05:00:00Z"),
+		table.Entry("week with spring-forward in London",
+			"2021-03-28T22:30:00Z", "Europe/London", "2021-03-22T00:00:00Z"),
+		table.Entry("week after spring-forward in London",
+			"2021-03-28T23:30:00Z", "Europe/London", "2021-03-28T23:00:00Z"),
+	)
+})
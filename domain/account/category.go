@@ -0,0 +1,171 @@
+package account
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// categoryBucket identifies a daily or weekly record
+// of transactions of a category. Period is day of
+// year for daily records, and ISO-week of ISO-year
+// for weekly records (see #bucketKey).
+type categoryBucket struct {
+	category string
+	year     int
+	period   int
+}
+
+// categoryLimitsOf validates category-limits of config, and
+// returns limits-snapshots of these keyed by category.
+func (cfg *AggregateCfg) categoryLimitsOf() (map[string]limitsSnapshot, error) {
+	snapshots := make(map[string]limitsSnapshot, len(cfg.CategoryLimits))
+	for category, limits := range cfg.CategoryLimits {
+		if category == "" {
+			return nil, errors.New("category of category-limits cannot be blank")
+		}
+		snapshot, err := newLimitsSnapshot(0, limits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error validating limits of category: %s", category)
+		}
+		snapshots[category] = snapshot
+	}
+	return snapshots, nil
+}
+
+// categoryRecords are daily and weekly records
+// of a category including a transaction.
+type categoryRecords struct {
+	daily  TxnRecord
+	weekly TxnRecord
+}
+
+// checkCategoryLimits checks if transaction passes limits of
+// its category. Also publishes AccountLimitExceeded event on
+// Bus. Records are empty for transactions without a category.
+// Return params:
+//   - categoryRecords: New records of transaction's category.
+//   - error: Critical errors encountered while validating
+//     for category-limits.
+func (a *account) checkCategoryLimits(
+	cmd model.Cmd,
+	txn *model.Transaction,
+) (*categoryRecords, error) {
+	if txn.Category == "" {
+		return &categoryRecords{}, nil
+	}
+	logPrefix := fmt.Sprintf("[CMD: %s]: [Txn: %s]:", cmd.ID(), txn.ID)
+
+	a.log.Tracef("%s Validating limits of category: %s", logPrefix, txn.Category)
+	records, err := a.categoryRecordsWith(txn)
+	if err == nil {
+		return &records, nil
+	}
+	failure := &TxnFailure{
+		Txn:          *txn,
+		Error:        err.Error(),
+		FailureCause: CategoryLimitsExceeded,
+	}
+	if a.limitDetails {
+		failure.setLimitDetails(err)
+	}
+	subLogPrefix := fmt.Sprintf("%s [EventAction: %s]", logPrefix, a.accountLimitExceeded)
+
+	a.log.Tracef("%s Publishing failure-event", subLogPrefix)
+	err = a.publishEvent(cmd, a.accountLimitExceeded, failure)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"error publishing event: %s", a.accountLimitExceeded,
+		)
+	}
+	a.log.Tracef("%s Published failure-event", subLogPrefix)
+	return nil, nil
+}
+
+// categoryRecordsWith returns daily and weekly records of
+// transaction's category including transaction, validated
+// against limits of category. Usage is recorded even if
+// category has no limits, so limits can be added later.
+func (a *account) categoryRecordsWith(txn *model.Transaction) (categoryRecords, error) {
+	key := a.bucketKey(txn.Time)
+	dailyTxnRecord := a.categoryDailyTxn[categoryBucket{txn.Category, key.year, key.day}]
+	weeklyTxnRecord := a.categoryWeeklyTxn[categoryBucket{txn.Category, key.weekYear, key.week}]
+	if a.countsTxn(txn) {
+		dailyTxnRecord.NumTxns++
+		weeklyTxnRecord.NumTxns++
+	}
+	dailyTxnRecord.TotalAmount += txn.LoadAmount
+	weeklyTxnRecord.TotalAmount += txn.LoadAmount
+
+	records := categoryRecords{
+		daily:  dailyTxnRecord,
+		weekly: weeklyTxnRecord,
+	}
+	limits, exists := a.categoryLimits[txn.Category]
+	if !exists {
+		return records, nil
+	}
+	err := a.exceededLimit(
+		dailyTxnRecord, limits.dailyLimits,
+		CategoryDailyNumTxnsLimit, CategoryDailyAmountLimit,
+	)
+	if err != nil {
+		return records, errors.Wrapf(
+			err, "failed daily-limits validation of category: %s", txn.Category,
+		)
+	}
+	err = a.exceededLimit(
+		weeklyTxnRecord, limits.weeklyLimits,
+		CategoryWeeklyNumTxnsLimit, CategoryWeeklyAmountLimit,
+	)
+	if err != nil {
+		return records, errors.Wrapf(
+			err, "failed weekly-limits validation of category: %s", txn.Category,
+		)
+	}
+	return records, nil
+}
+
+// setCategoryRecords sets category-records of state.
+// No-op for transactions without a category.
+func (r *categoryRecords) setCategoryRecords(state *State, txn *model.Transaction) {
+	if txn.Category == "" {
+		return
+	}
+	daily, weekly := r.daily, r.weekly
+	state.Category = txn.Category
+	state.CategoryDailyTxn = &daily
+	state.CategoryWeeklyTxn = &weekly
+}
+
+// applyCategoryState records category-usage of state.
+// Only called for states within current limits-window.
+func (a *accountState) applyCategoryState(state *State, key bucketKey) {
+	if state.Category == "" {
+		return
+	}
+	if state.CategoryDailyTxn != nil {
+		a.categoryDailyTxn[categoryBucket{state.Category, key.year, key.day}] = *state.CategoryDailyTxn
+	}
+	if state.CategoryWeeklyTxn != nil {
+		a.categoryWeeklyTxn[categoryBucket{state.Category, key.weekYear, key.week}] = *state.CategoryWeeklyTxn
+	}
+}
+
+// pruneCategoryBuckets removes category-records
+// for periods that started before pruneBefore.
+func (a *accountState) pruneCategoryBuckets() {
+	for bucket := range a.categoryDailyTxn {
+		if a.dayStart(bucket.year, bucket.period).Before(a.pruneBefore) {
+			delete(a.categoryDailyTxn, bucket)
+		}
+	}
+	for bucket := range a.categoryWeeklyTxn {
+		if a.weekStart(bucket.year, bucket.period).Before(a.pruneBefore) {
+			delete(a.categoryWeeklyTxn, bucket)
+		}
+	}
+}
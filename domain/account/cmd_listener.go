@@ -2,23 +2,45 @@ package account
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/validator.v2"
 
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
 	"github.com/Jaskaranbir/es-bank-account/model"
 )
 
 type cmdListener struct {
 	log logger.Logger
 
-	bus           eventutil.Bus
-	processTxnCmd model.CmdAction
-	cmdSubs       map[model.CmdAction]<-chan interface{}
+	bus             eventutil.Bus
+	processTxnCmd   model.CmdAction
+	updateLimitsCmd model.CmdAction
+	queryStateCmd   model.CmdAction
+	stateQueried    model.EventAction
+	queryBalanceCmd model.CmdAction
+	balanceQueried  model.EventAction
+	cmdSubs         map[model.CmdAction]<-chan model.Cmd
+	flowEpoch       *eventutil.FlowEpoch
+	metrics         metrics.Metrics
+	stats           *eventutil.ComponentStats
 
-	accountCfg *AggregateCfg
+	accountCfg AggregateCfg
+	// Stores current limitsSnapshot.
+	// Replaced as a whole on every limits-update.
+	limits atomic.Value
+
+	actorMode        bool
+	actorMailboxSize int
+	maxActors        int
+	// Set on start if actor-mode is enabled
+	actors *actorPool
 }
 
 // CmdListenerCfg is config for command-listener.
@@ -27,14 +49,68 @@ type CmdListenerCfg struct {
 
 	Bus           eventutil.Bus   `validate:"nonnil"`
 	ProcessTxnCmd model.CmdAction `validate:"nonzero"`
+	// Optional. Limits-updates are ignored if not set.
+	UpdateLimitsCmd model.CmdAction
+	// Optional. Point-in-time state queries (see #StateAt)
+	// are ignored if not set.
+	QueryStateCmd model.CmdAction
+	// Published with result of a state-query.
+	// Required if QueryStateCmd is set.
+	StateQueried model.EventAction
+	// Optional. Balance queries (see BalanceQuery)
+	// are ignored if not set.
+	QueryBalanceCmd model.CmdAction
+	// Published with Usage of account for a balance-query.
+	// Required if QueryBalanceCmd is set.
+	BalanceQueried model.EventAction
+	// Optional. If set, process-transaction commands
+	// from an older flow-epoch are rejected.
+	FlowEpoch *eventutil.FlowEpoch
+	// Optional, records transaction-processing times.
+	Metrics metrics.Metrics
+	// Optional, counts commands handled by listener,
+	// and accounts cached by actors (see ActorMode).
+	Stats *eventutil.ComponentStats
+	// Optional. If set, a long-lived account-aggregate per
+	// customer handles that customer's commands sequentially
+	// from a mailbox, and keeps account-state in memory instead
+	// of replaying events for every command. Events are still
+	// stored as these occur (and balance-snapshots emitted as
+	// configured), so state survives restarts. Customers are
+	// processed concurrently, so listener must be the only
+	// writer to accounts in event-repo.
+	ActorMode bool
+	// Optional, capacity of each actor's mailbox. Defaults to 100.
+	ActorMailboxSize int `validate:"min=0"`
+	// Optional, maximum actors kept in memory. Least recently
+	// used actor is stopped once exceeded, and its customer
+	// is replayed if it has commands again. Defaults to 1000.
+	MaxActors int `validate:"min=0"`
 
 	AccountCfg *AggregateCfg `validate:"nonnil"`
 }
 
+// Validate validates config, including invariants between its
+// fields. Account-config is validated only by its tags, see
+// AggregateCfg#Validate for its complete validation.
+func (cfg *CmdListenerCfg) Validate() error {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.QueryStateCmd != "" && cfg.StateQueried == "" {
+		return errors.New("state-queried event-action must be set if state-queries are enabled")
+	}
+	if cfg.QueryBalanceCmd != "" && cfg.BalanceQueried == "" {
+		return errors.New("balance-queried event-action must be set if balance-queries are enabled")
+	}
+	return nil
+}
+
 // InitCmdListener validates command-listener
 // config and runs command-listener.
 func InitCmdListener(ctx context.Context, cfg *CmdListenerCfg) error {
-	err := validator.Validate(cfg)
+	err := cfg.Validate()
 	if err != nil {
 		return errors.Wrap(err, "error validating config")
 	}
@@ -43,29 +119,83 @@ func InitCmdListener(ctx context.Context, cfg *CmdListenerCfg) error {
 	}
 
 	// Subscribe to actions from Bus
-	cmdSubs := make(map[model.CmdAction]<-chan interface{})
-	cmdSubs[cfg.ProcessTxnCmd], err = cfg.Bus.Subscribe(cfg.ProcessTxnCmd.String())
+	cmdSubs := make(map[model.CmdAction]<-chan model.Cmd)
+	cmdSubs[cfg.ProcessTxnCmd], err = eventutil.SubscribeCmds(cfg.Bus, cfg.ProcessTxnCmd)
 	if err != nil {
 		return errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.ProcessTxnCmd)
 	}
+	if cfg.UpdateLimitsCmd != "" {
+		cmdSubs[cfg.UpdateLimitsCmd], err = eventutil.SubscribeCmds(cfg.Bus, cfg.UpdateLimitsCmd)
+		if err != nil {
+			return errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.UpdateLimitsCmd)
+		}
+	}
+	if cfg.QueryStateCmd != "" {
+		cmdSubs[cfg.QueryStateCmd], err = eventutil.SubscribeCmds(cfg.Bus, cfg.QueryStateCmd)
+		if err != nil {
+			return errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.QueryStateCmd)
+		}
+	}
+	if cfg.QueryBalanceCmd != "" {
+		cmdSubs[cfg.QueryBalanceCmd], err = eventutil.SubscribeCmds(cfg.Bus, cfg.QueryBalanceCmd)
+		if err != nil {
+			return errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.QueryBalanceCmd)
+		}
+	}
+
+	limits, err := newLimitsSnapshot(0, cfg.AccountCfg.limits())
+	if err != nil {
+		return errors.Wrap(err, "error creating limits-snapshot")
+	}
 
 	// Create and run listener
 	cfg.Log.Infof("Starting command-listener")
 	listener := &cmdListener{
 		log: cfg.Log,
 
-		bus:           cfg.Bus,
-		processTxnCmd: cfg.ProcessTxnCmd,
-		cmdSubs:       cmdSubs,
+		bus:             cfg.Bus,
+		processTxnCmd:   cfg.ProcessTxnCmd,
+		updateLimitsCmd: cfg.UpdateLimitsCmd,
+		queryStateCmd:   cfg.QueryStateCmd,
+		stateQueried:    cfg.StateQueried,
+		queryBalanceCmd: cfg.QueryBalanceCmd,
+		balanceQueried:  cfg.BalanceQueried,
+		cmdSubs:         cmdSubs,
+		flowEpoch:       cfg.FlowEpoch,
+		metrics:         metrics.OrNoop(cfg.Metrics),
+		stats:           cfg.Stats,
 
-		accountCfg: cfg.AccountCfg,
+		// Copy config so it can't be changed from outside
+		accountCfg: *cfg.AccountCfg,
+
+		actorMode:        cfg.ActorMode,
+		actorMailboxSize: cfg.ActorMailboxSize,
+		maxActors:        cfg.MaxActors,
 	}
+	listener.limits.Store(limits)
 	err = listener.start(ctx)
 	return errors.Wrap(err, "listener-routine exited with error")
 }
 
-func (cl *cmdListener) start(ctx context.Context) error {
+func (cl *cmdListener) start(ctx context.Context) (err error) {
 	defer cl.unsubscribe()
+	if cl.actorMode {
+		actors, err := newActorPool(
+			cl.actorMailboxSize, cl.maxActors, &cl.accountCfg, &cl.limits, cl.metrics,
+		)
+		if err != nil {
+			return errors.Wrap(err, "error creating account-actors")
+		}
+		cl.actors = actors
+		// Commands already dispatched to actors are handled
+		// before listener returns, so these aren't lost.
+		defer func() {
+			stopErr := cl.actors.stop()
+			if err == nil && stopErr != nil {
+				err = errors.Wrap(stopErr, "account-actor returned with error")
+			}
+		}()
+	}
 
 	for {
 		select {
@@ -77,22 +207,28 @@ func (cl *cmdListener) start(ctx context.Context) error {
 			}
 			return err
 
-		case msg := <-cl.cmdSubs[cl.processTxnCmd]:
-			// Validate message
-			if msg == nil {
-				continue
+		case cmd, ok := <-cl.cmdSubs[cl.processTxnCmd]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(cl.processTxnCmd.String())
 			}
-			cmd, castSuccess := msg.(model.Cmd)
-			if !castSuccess {
-				cl.log.Warnf("error casting message to command")
+			if cmd.RawData() == nil || !cl.admitEpoch(cmd) {
+				cl.stats.IncIgnored()
 				continue
 			}
-			if cmd.Data() == nil {
+			if cl.actors != nil {
+				err := cl.actors.dispatch(cmd)
+				if err != nil {
+					return errors.Wrap(err, "error dispatching command to account-actor")
+				}
+				cl.stats.IncProcessed()
+				cl.stats.SetCached(cl.actors.size())
 				continue
 			}
 
 			// Aggregate-operations
-			account, err := newAccount(cl.accountCfg)
+			startTime := time.Now()
+			limits := cl.limits.Load().(limitsSnapshot)
+			account, err := newAccount(&cl.accountCfg, limits)
 			if err != nil {
 				return errors.Wrap(err, "error creating account-aggregate instance")
 			}
@@ -100,10 +236,213 @@ func (cl *cmdListener) start(ctx context.Context) error {
 			if err != nil {
 				return errors.Wrap(err, "error handling process-transaction command")
 			}
+			cl.metrics.ObserveTxnProcessing(time.Since(startTime))
+			cl.stats.IncProcessed()
+
+		// Nil channel (never receives) if actor-mode is disabled
+		case err := <-cl.actorErrs():
+			return errors.Wrap(err, "account-actor returned with error")
+
+		// Nil channel (never receives) if limits-updates are disabled
+		case cmd, ok := <-cl.cmdSubs[cl.updateLimitsCmd]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(cl.updateLimitsCmd.String())
+			}
+			if cmd.RawData() == nil {
+				cl.stats.IncIgnored()
+				continue
+			}
+
+			err := cl.handleUpdateLimitsCmd(cmd)
+			if err != nil {
+				return errors.Wrap(err, "error handling update-limits command")
+			}
+			cl.stats.IncProcessed()
+
+		// Nil channel (never receives) if state-queries are disabled
+		case cmd, ok := <-cl.cmdSubs[cl.queryStateCmd]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(cl.queryStateCmd.String())
+			}
+			if cmd.RawData() == nil {
+				cl.stats.IncIgnored()
+				continue
+			}
+
+			err := cl.handleQueryStateCmd(cmd)
+			if err != nil {
+				return errors.Wrap(err, "error handling query-state command")
+			}
+			cl.stats.IncProcessed()
+
+		// Nil channel (never receives) if balance-queries are disabled
+		case cmd, ok := <-cl.cmdSubs[cl.queryBalanceCmd]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(cl.queryBalanceCmd.String())
+			}
+			if cmd.RawData() == nil {
+				cl.stats.IncIgnored()
+				continue
+			}
+
+			err := cl.handleQueryBalanceCmd(cmd)
+			if err != nil {
+				return errors.Wrap(err, "error handling query-balance command")
+			}
+			cl.stats.IncProcessed()
 		}
 	}
 }
 
+// actorErrs receives errors from account-actors.
+// Returns nil channel if actor-mode is disabled.
+func (cl *cmdListener) actorErrs() <-chan error {
+	if cl.actors == nil {
+		return nil
+	}
+	return cl.actors.errs()
+}
+
+// handleUpdateLimitsCmd replaces current limits with a new
+// snapshot. Invalid limits are rejected and current limits
+// are retained.
+func (cl *cmdListener) handleUpdateLimitsCmd(cmd model.Cmd) error {
+	logPrefix := fmt.Sprintf("[CMD-Action: %s]: [CMD: %s]:", cmd.Action(), cmd.ID())
+
+	newLimits := Limits{}
+	err := json.Unmarshal(cmd.RawData(), &newLimits)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling command-data")
+	}
+
+	// Accounts check limits along with monthly-allowance
+	err = cl.accountCfg.checkLimits(newLimits)
+	if err != nil {
+		cl.log.Warnf("%s Rejected limits-update: %s", logPrefix, err)
+		return nil
+	}
+	currLimits := cl.limits.Load().(limitsSnapshot)
+	limits, err := newLimitsSnapshot(currLimits.version+1, newLimits)
+	if err != nil {
+		cl.log.Warnf("%s Rejected limits-update: %s", logPrefix, err)
+		return nil
+	}
+	cl.limits.Store(limits)
+	cl.log.Debugf("%s Updated limits to version: %d", logPrefix, limits.version)
+	return nil
+}
+
+// handleQueryStateCmd publishes point-in-time state of customer's
+// account, with usage against current limits. Events are only read,
+// so this doesn't need to be ordered with processing of transactions.
+// Queries without customer-id are ignored.
+func (cl *cmdListener) handleQueryStateCmd(cmd model.Cmd) error {
+	logPrefix := fmt.Sprintf("[CMD-Action: %s]: [CMD: %s]:", cmd.Action(), cmd.ID())
+
+	query := StateQuery{}
+	err := json.Unmarshal(cmd.RawData(), &query)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling command-data")
+	}
+	if query.CustID == "" {
+		cl.log.Warnf("%s Ignored state-query without customer-id", logPrefix)
+		return nil
+	}
+
+	limits := cl.limits.Load().(limitsSnapshot)
+	accountCfg := cl.accountCfg
+	accountCfg.DailyTxnsAmountLimit = limits.dailyLimits.TotalAmount
+	accountCfg.NumDailyTxnsLimit = limits.dailyLimits.NumTxns
+	accountCfg.WeeklyTxnsAmountLimit = limits.weeklyLimits.TotalAmount
+	accountCfg.NumWeeklyTxnsLimit = limits.weeklyLimits.NumTxns
+
+	state, err := StateAt(accountCfg.EventRepo, query.CustID, query.At, accountCfg)
+	if err != nil {
+		return errors.Wrap(err, "error reconstructing state")
+	}
+	// Queries don't change account-state,
+	// so result is only published.
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID:    query.CustID,
+		CausationID:    cmd.CausationID(),
+		CausationKey:   cmd.ID(),
+		CorrelationKey: cmd.CorrelationKey(),
+		Action:         cl.stateQueried,
+		Data:           state,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating event")
+	}
+	err = cl.bus.Publish(event)
+	if err != nil {
+		return errors.Wrapf(eventutil.MarkFatal(err), "error publishing event: %s", cl.stateQueried)
+	}
+	cl.log.Tracef("%s Published state of customer: %s", logPrefix, query.CustID)
+	return nil
+}
+
+// handleQueryBalanceCmd loads customer's account, and publishes
+// its balance and usage against current limits. Like state-queries,
+// events are only read. Queries without customer-id are ignored.
+func (cl *cmdListener) handleQueryBalanceCmd(cmd model.Cmd) error {
+	logPrefix := fmt.Sprintf("[CMD-Action: %s]: [CMD: %s]:", cmd.Action(), cmd.ID())
+
+	query := BalanceQuery{}
+	err := json.Unmarshal(cmd.RawData(), &query)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling command-data")
+	}
+	if query.CustID == "" {
+		cl.log.Warnf("%s Ignored balance-query without customer-id", logPrefix)
+		return nil
+	}
+
+	limits := cl.limits.Load().(limitsSnapshot)
+	acc, err := newAccount(&cl.accountCfg, limits)
+	if err != nil {
+		return errors.Wrap(err, "error creating account-aggregate instance")
+	}
+	err = acc.loadAggregate(query.CustID)
+	if err != nil {
+		return errors.Wrap(err, "error loading aggregate")
+	}
+	at := query.At
+	if at.IsZero() {
+		at = acc.lastTxnTime
+	}
+
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID:    query.CustID,
+		CausationID:    cmd.CausationID(),
+		CausationKey:   cmd.ID(),
+		CorrelationKey: cmd.CorrelationKey(),
+		Action:         cl.balanceQueried,
+		Data:           acc.usage(at),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating event")
+	}
+	err = cl.bus.Publish(event)
+	if err != nil {
+		return errors.Wrapf(eventutil.MarkFatal(err), "error publishing event: %s", cl.balanceQueried)
+	}
+	cl.log.Tracef("%s Published balance of customer: %s", logPrefix, query.CustID)
+	return nil
+}
+
+// admitEpoch returns false if command was
+// issued in an older flow-epoch than current.
+func (cl *cmdListener) admitEpoch(cmd model.Cmd) bool {
+	if cl.flowEpoch == nil || cl.flowEpoch.Admit(cmd.Epoch()) {
+		return true
+	}
+	cl.log.Warnf(
+		"[CMD-Action: %s]: [CMD: %s]: Rejected late command from flow-epoch: %d (current: %d)",
+		cmd.Action(), cmd.ID(), cmd.Epoch(), cl.flowEpoch.Current(),
+	)
+	return false
+}
+
 func (cl *cmdListener) unsubscribe() error {
 	for action, channel := range cl.cmdSubs {
 		// Already unsubscribed
@@ -112,7 +451,7 @@ func (cl *cmdListener) unsubscribe() error {
 		}
 
 		cl.log.Debugf("Unsubscribing from action: %s", action)
-		err := cl.bus.Unsubscribe(channel, action.String())
+		err := eventutil.UnsubscribeCmds(cl.bus, channel, action)
 		if err != nil {
 			return errors.Wrapf(err, "error unsubscribing from event-bus for action: %s", action)
 		}
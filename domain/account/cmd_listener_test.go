@@ -0,0 +1,344 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("CmdListener", func() {
+	const (
+		ProcessTxnCmd   model.CmdAction = "ProcessTxn"
+		UpdateLimitsCmd model.CmdAction = "UpdateLimits"
+		QueryStateCmd   model.CmdAction = "QueryState"
+		QueryBalanceCmd model.CmdAction = "QueryBalance"
+	)
+	const (
+		AccountDepositedEvent     model.EventAction = "AccountDeposited"
+		AccountWithdrawnEvent     model.EventAction = "AccountWithdrawn"
+		DuplicateTxnEvent         model.EventAction = "DuplicateTxn"
+		AccountLimitExceededEvent model.EventAction = "AccountLimitExceeded"
+		StateQueriedEvent         model.EventAction = "StateQueried"
+		BalanceQueriedEvent       model.EventAction = "BalanceQueried"
+	)
+
+	var bus eventutil.Bus
+	var accountCfg *AggregateCfg
+	var listenerCancel context.CancelFunc
+	var listenerErrGroup *errgroup.Group
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+
+		eventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+			Bus:            bus,
+			EventStore:     eventutil.NewMemoryEventStore(),
+			UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg = &AggregateCfg{
+			Log:       logger.NewStdLogger("account/Aggregate"),
+			EventRepo: eventRepo,
+
+			AccountDeposited:     AccountDepositedEvent,
+			AccountWithdrawn:     AccountWithdrawnEvent,
+			DuplicateTxn:         DuplicateTxnEvent,
+			AccountLimitExceeded: AccountLimitExceededEvent,
+		}
+		listenerCfg := &CmdListenerCfg{
+			Log:             logger.NewStdLogger("account/CmdListener"),
+			Bus:             bus,
+			ProcessTxnCmd:   ProcessTxnCmd,
+			UpdateLimitsCmd: UpdateLimitsCmd,
+			QueryStateCmd:   QueryStateCmd,
+			StateQueried:    StateQueriedEvent,
+			QueryBalanceCmd: QueryBalanceCmd,
+			BalanceQueried:  BalanceQueriedEvent,
+
+			AccountCfg: accountCfg,
+		}
+
+		var ctx context.Context
+		ctx, listenerCancel = context.WithCancel(context.Background())
+		listenerErrGroup, _ = errgroup.WithContext(context.Background())
+		listenerErrGroup.Go(func() error {
+			return InitCmdListener(ctx, listenerCfg)
+		})
+		// Ensure the goroutine above
+		// is ready to process messages
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		listenerCancel()
+		err := listenerErrGroup.Wait()
+		Expect(err).ToNot(HaveOccurred())
+		bus.Terminate()
+	})
+
+	It("reads its own writes for rapid commands on same account", func() {
+		accDepositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+		accWithdrawnSub, err := bus.Subscribe(AccountWithdrawnEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+		limitExceededSub, err := bus.Subscribe(AccountLimitExceededEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		txnTime, err := time.Parse(time.RFC3339, "2000-01-05T00:00:01Z")
+		Expect(err).ToNot(HaveOccurred())
+		txns := []model.Transaction{
+			{
+				ID:         "1",
+				CustomerID: "1",
+				LoadAmount: 100,
+				Time:       txnTime,
+			},
+			// Only valid if deposit above is already applied
+			{
+				ID:         "2",
+				CustomerID: "1",
+				LoadAmount: -100,
+				Time:       txnTime.Add(time.Second),
+			},
+		}
+		// Publish both commands without waiting for results
+		for _, txn := range txns {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action: ProcessTxnCmd,
+				Data:   txn,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = bus.Publish(cmd)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		Eventually(accDepositedSub).Should(Receive())
+		event := &model.Event{}
+		Eventually(accWithdrawnSub).Should(Receive(event))
+		Consistently(limitExceededSub).ShouldNot(Receive())
+
+		state := &State{}
+		err = json.Unmarshal(event.Data(), state)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.TxnID).To(Equal("2"))
+		Expect(state.TotalAmount).To(BeZero())
+		Expect(state.DailyTxn.NumTxns).To(Equal(2))
+	})
+
+	publishCmd := func(action model.CmdAction, data interface{}) {
+		defer GinkgoRecover()
+
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action: action,
+			Data:   data,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = bus.Publish(cmd)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("validates each transaction against a single limits-snapshot", func() {
+		const numTxns = 50
+		const numUpdates = 20
+
+		accDepositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		txnTime, err := time.Parse(time.RFC3339, "2000-01-05T00:00:01Z")
+		Expect(err).ToNot(HaveOccurred())
+
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < numTxns; i++ {
+				publishCmd(ProcessTxnCmd, model.Transaction{
+					ID:         strconv.Itoa(i),
+					CustomerID: strconv.Itoa(i),
+					LoadAmount: 100,
+					Time:       txnTime,
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= numUpdates; i++ {
+				publishCmd(UpdateLimitsCmd, Limits{
+					DailyTxnsAmountLimit:  float64(i * 100),
+					WeeklyTxnsAmountLimit: float64(i * 1000),
+				})
+			}
+		}()
+
+		prevVersion := uint64(0)
+		for i := 0; i < numTxns; i++ {
+			event := &model.Event{}
+			Eventually(accDepositedSub).Should(Receive(event))
+			state := &State{}
+			err = json.Unmarshal(event.Data(), state)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(state.LimitsVersion).To(BeNumerically(">=", prevVersion))
+			Expect(state.LimitsVersion).To(BeNumerically("<=", numUpdates))
+			prevVersion = state.LimitsVersion
+		}
+		wg.Wait()
+
+		// Changes to config after listener-start
+		// must not affect running listener
+		accountCfg.DailyTxnsAmountLimit = 1
+		accountCfg.WeeklyTxnsAmountLimit = 1
+
+		// Invalid limits are rejected and
+		// don't change current version
+		publishCmd(UpdateLimitsCmd, Limits{
+			DailyTxnsAmountLimit:  1000,
+			WeeklyTxnsAmountLimit: 1,
+		})
+		publishCmd(ProcessTxnCmd, model.Transaction{
+			ID:         "last",
+			CustomerID: "last",
+			LoadAmount: 100,
+			Time:       txnTime,
+		})
+		event := &model.Event{}
+		Eventually(accDepositedSub).Should(Receive(event))
+		state := &State{}
+		err = json.Unmarshal(event.Data(), state)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.LimitsVersion).To(BeEquivalentTo(numUpdates))
+	})
+
+	It("publishes point-in-time state for state-queries", func() {
+		accDepositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+		stateQueriedSub, err := bus.Subscribe(StateQueriedEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		txnTime, err := time.Parse(time.RFC3339, "2000-01-05T10:00:00Z")
+		Expect(err).ToNot(HaveOccurred())
+		for i, loadAmount := range []float64{100, 200} {
+			publishCmd(ProcessTxnCmd, model.Transaction{
+				ID:         strconv.Itoa(i),
+				CustomerID: "1",
+				LoadAmount: loadAmount,
+				Time:       txnTime.Add(time.Duration(i) * time.Hour),
+			})
+			Eventually(accDepositedSub).Should(Receive())
+		}
+
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action:         QueryStateCmd,
+			CorrelationKey: "query",
+			Data: StateQuery{
+				CustID: "1",
+				At:     txnTime.Add(30 * time.Minute),
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bus.Publish(cmd)).To(Succeed())
+
+		event := &model.Event{}
+		Eventually(stateQueriedSub).Should(Receive(event))
+		Expect(event.AggregateID()).To(Equal("1"))
+		Expect(event.CausationKey()).To(Equal(cmd.ID()))
+		Expect(event.CorrelationKey()).To(Equal("query"))
+
+		state := &PointInTimeState{}
+		err = json.Unmarshal(event.Data(), state)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.Balance).To(Equal(float64(100)))
+		Expect(state.TxnIDs).To(Equal([]string{"0"}))
+		Expect(state.Daily.Used).To(Equal(TxnRecord{NumTxns: 1, TotalAmount: 100}))
+
+		// Queries don't store events
+		events, err := accountCfg.EventRepo.Fetch("1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+	})
+
+	It("publishes current balance and usage for balance-queries", func() {
+		accDepositedSub, err := bus.Subscribe(AccountDepositedEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+		accWithdrawnSub, err := bus.Subscribe(AccountWithdrawnEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+		balanceQueriedSub, err := bus.Subscribe(BalanceQueriedEvent.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		txnTime, err := time.Parse(time.RFC3339, "2000-01-05T10:00:00Z")
+		Expect(err).ToNot(HaveOccurred())
+		// Previous week
+		publishCmd(ProcessTxnCmd, model.Transaction{
+			ID:         "1",
+			CustomerID: "1",
+			LoadAmount: 500,
+			Time:       txnTime.AddDate(0, 0, -7),
+		})
+		Eventually(accDepositedSub).Should(Receive())
+		publishCmd(ProcessTxnCmd, model.Transaction{
+			ID:         "2",
+			CustomerID: "1",
+			LoadAmount: 200,
+			Time:       txnTime,
+		})
+		Eventually(accDepositedSub).Should(Receive())
+		publishCmd(ProcessTxnCmd, model.Transaction{
+			ID:         "3",
+			CustomerID: "1",
+			LoadAmount: -50,
+			Time:       txnTime.Add(time.Hour),
+		})
+		Eventually(accWithdrawnSub).Should(Receive())
+
+		queryBalance := func(query BalanceQuery) *Usage {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action:         QueryBalanceCmd,
+				CorrelationKey: "query",
+				Data:           query,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bus.Publish(cmd)).To(Succeed())
+
+			event := &model.Event{}
+			Eventually(balanceQueriedSub).Should(Receive(event))
+			Expect(event.AggregateID()).To(Equal("1"))
+			Expect(event.CausationKey()).To(Equal(cmd.ID()))
+			Expect(event.CorrelationKey()).To(Equal("query"))
+
+			usage := &Usage{}
+			err = json.Unmarshal(event.Data(), usage)
+			Expect(err).ToNot(HaveOccurred())
+			return usage
+		}
+
+		// Usage of periods containing latest transaction by default
+		usage := queryBalance(BalanceQuery{CustID: "1"})
+		Expect(usage.CustID).To(Equal("1"))
+		Expect(usage.Balance).To(Equal(float64(650)))
+		Expect(usage.At).To(BeTemporally("==", txnTime.Add(time.Hour)))
+		Expect(usage.Daily.Used).To(Equal(TxnRecord{NumTxns: 2, TotalAmount: 150}))
+		Expect(usage.Weekly.Used).To(Equal(TxnRecord{NumTxns: 2, TotalAmount: 150}))
+
+		usage = queryBalance(BalanceQuery{CustID: "1", At: txnTime.AddDate(0, 0, -7)})
+		Expect(usage.Balance).To(Equal(float64(650)))
+		Expect(usage.Daily.Used).To(Equal(TxnRecord{NumTxns: 1, TotalAmount: 500}))
+
+		// Queries don't store events
+		events, err := accountCfg.EventRepo.Fetch("1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(3))
+	})
+})
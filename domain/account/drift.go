@@ -0,0 +1,182 @@
+package account
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Default difference between balances
+// tolerated as floating-point error.
+const defaultDriftTolerance = 0.005
+
+// BalanceDrift is a customer whose balance, replayed from
+// amounts of their accepted transactions, differs from
+// TotalAmount of their last published State.
+type BalanceDrift struct {
+	CustID string
+	// TotalAmount of last published State
+	PublishedBalance float64
+	// Opening-balance plus amounts of accepted transactions
+	ReplayedBalance float64
+	// First transaction after which balances differed
+	FirstDriftTxnID string
+}
+
+// DriftCheckOpts is config for #CheckBalanceDrift.
+type DriftCheckOpts struct {
+	// Optional, customers to check. Defaults to
+	// all customers with events in event-repo.
+	CustIDs []string
+	// Optional, defaults to 0.005
+	Tolerance float64 `validate:"min=0"`
+}
+
+// CheckBalanceDrift replays each customer's events from event-repo
+// in config, and returns customers whose balance differs from last
+// published State, sorted by customer-id. Replayed balances are
+// derived from daily-records of states instead of their balances,
+// so drift is detected independently of how the aggregate applies
+// events. Nothing is stored or published, so this is safe to run
+// after processing as a self-check.
+func CheckBalanceDrift(cfg *AggregateCfg, opts *DriftCheckOpts) ([]BalanceDrift, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	if opts == nil {
+		opts = &DriftCheckOpts{}
+	}
+	err := validator.Validate(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating options")
+	}
+	tolerance := opts.Tolerance
+	if tolerance == 0 {
+		tolerance = defaultDriftTolerance
+	}
+
+	custIDs := opts.CustIDs
+	if len(custIDs) == 0 {
+		custIDs, err = accountCustIDs(cfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "error listing customers")
+		}
+	}
+
+	drifts := make([]BalanceDrift, 0)
+	for _, custID := range custIDs {
+		events, err := cfg.EventRepo.Fetch(custID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error fetching events for customer: %s", custID)
+		}
+		drift, err := replayBalance(cfg, custID, events, tolerance)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error replaying balance for customer: %s", custID)
+		}
+		if drift != nil {
+			drifts = append(drifts, *drift)
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].CustID < drifts[j].CustID
+	})
+	return drifts, nil
+}
+
+// accountCustIDs returns customers with
+// balance-changing events in event-repo.
+func accountCustIDs(cfg *AggregateCfg) ([]string, error) {
+	events, err := cfg.EventRepo.FetchByIndex(0)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching events from event-store")
+	}
+
+	seen := make(map[string]struct{})
+	custIDs := make([]string, 0)
+	for _, event := range events {
+		if !isBalanceEvent(cfg, event.Action()) {
+			continue
+		}
+		if _, exists := seen[event.AggregateID()]; exists {
+			continue
+		}
+		seen[event.AggregateID()] = struct{}{}
+		custIDs = append(custIDs, event.AggregateID())
+	}
+	return custIDs, nil
+}
+
+func isBalanceEvent(cfg *AggregateCfg, action model.EventAction) bool {
+	return action == cfg.AccountDeposited ||
+		action == cfg.AccountWithdrawn ||
+		(cfg.AccountSeeded != "" && action == cfg.AccountSeeded)
+}
+
+// replayBalance returns BalanceDrift if balance replayed from
+// customer's events differs from their last published State.
+// Amount of each transaction is its State's daily-total, less
+// daily-total of previous State for same day.
+func replayBalance(
+	cfg *AggregateCfg,
+	custID string,
+	events []model.Event,
+	tolerance float64,
+) (*BalanceDrift, error) {
+	type dayKey struct {
+		year int
+		day  int
+	}
+	dailyTotals := make(map[dayKey]float64)
+
+	replayed := float64(0)
+	published := float64(0)
+	firstDriftTxnID := ""
+	for _, event := range events {
+		if cfg.AccountSeeded != "" && event.Action() == cfg.AccountSeeded {
+			seed := &OpeningBalance{}
+			err := json.Unmarshal(event.RawData(), seed)
+			if err != nil {
+				return nil, errors.Wrap(err, "error unmarshalling event-data")
+			}
+			replayed = seed.Balance
+			published = seed.Balance
+			continue
+		}
+		if event.Action() != cfg.AccountDeposited && event.Action() != cfg.AccountWithdrawn {
+			continue
+		}
+
+		state, err := DecodeState(event.RawData())
+		if err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling event-data")
+		}
+		bucket := bucketKeyOf(state.TxnTime, cfg.BucketLocation)
+		key := dayKey{
+			year: bucket.year,
+			day:  bucket.day,
+		}
+		replayed += state.DailyTxn.TotalAmount - dailyTotals[key]
+		dailyTotals[key] = state.DailyTxn.TotalAmount
+		published = state.TotalAmount
+
+		if firstDriftTxnID == "" && math.Abs(replayed-published) > tolerance {
+			firstDriftTxnID = state.TxnID
+		}
+	}
+
+	if math.Abs(replayed-published) <= tolerance {
+		return nil, nil
+	}
+	return &BalanceDrift{
+		CustID:           custID,
+		PublishedBalance: published,
+		ReplayedBalance:  replayed,
+		FirstDriftTxnID:  firstDriftTxnID,
+	}, nil
+}
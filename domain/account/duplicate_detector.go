@@ -0,0 +1,166 @@
+package account
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// TxnRef refers to an accepted transaction.
+type TxnRef struct {
+	CustID     string
+	TxnID      string
+	TxnTime    time.Time
+	LoadAmount float64
+}
+
+// DuplicateDetector decides if transactions are duplicates of
+// accepted transactions of customer. Accounts record accepted
+// transactions once their success-event is published, and also
+// record transactions of stored events when account is loaded,
+// so Record can be called more than once for a transaction.
+// Detectors set in AggregateCfg are shared by all accounts,
+// and must be safe for concurrent use.
+type DuplicateDetector interface {
+	// Check returns true, along with original transaction
+	// (if known), if transaction is a duplicate.
+	Check(custID string, txn model.Transaction) (isDuplicate bool, original *TxnRef, err error)
+	Record(custID string, txn model.Transaction)
+}
+
+func txnRefOf(custID string, txn model.Transaction) *TxnRef {
+	return &TxnRef{
+		CustID:     custID,
+		TxnID:      txn.ID,
+		TxnTime:    txn.Time,
+		LoadAmount: txn.LoadAmount,
+	}
+}
+
+// ScopedIDDetector detects transactions with IDs already
+// accepted for customer within a duplicate-scope.
+// This is default detector of accounts.
+// Use #NewScopedIDDetector to create new instance.
+type ScopedIDDetector struct {
+	scope DuplicateScope
+
+	lock *sync.RWMutex
+	// Keyed by customer-ID, and then by #scopedTxnKey
+	txns map[string]map[string]*TxnRef
+}
+
+// NewScopedIDDetector creates new instance of ScopedIDDetector.
+// Scope defaults to DuplicateScopeCustomer.
+func NewScopedIDDetector(scope DuplicateScope) *ScopedIDDetector {
+	if scope == "" {
+		scope = DuplicateScopeCustomer
+	}
+	return &ScopedIDDetector{
+		scope: scope,
+		lock:  &sync.RWMutex{},
+		txns:  make(map[string]map[string]*TxnRef),
+	}
+}
+
+// Check returns true if transaction-ID was accepted
+// for customer within scope.
+func (d *ScopedIDDetector) Check(custID string, txn model.Transaction) (bool, *TxnRef, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	original, exists := d.txns[custID][scopedTxnKey(d.scope, txn.ID, txn.Time)]
+	return exists, original, nil
+}
+
+// Record records transaction as accepted for customer.
+func (d *ScopedIDDetector) Record(custID string, txn model.Transaction) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	custTxns, exists := d.txns[custID]
+	if !exists {
+		custTxns = make(map[string]*TxnRef)
+		d.txns[custID] = custTxns
+	}
+	key := scopedTxnKey(d.scope, txn.ID, txn.Time)
+	if _, exists := custTxns[key]; !exists {
+		custTxns[key] = txnRefOf(custID, txn)
+	}
+}
+
+// IDAmountDetector detects transactions with same ID and
+// load-amount as a transaction accepted for customer within
+// retention-window of its time. Transactions reusing an ID
+// with another amount, or outside the window, are unique.
+// Use #NewIDAmountDetector to create new instance.
+type IDAmountDetector struct {
+	retention time.Duration
+
+	lock *sync.RWMutex
+	// Keyed by customer-ID, and then by transaction-ID
+	txns map[string]map[string][]*TxnRef
+}
+
+// NewIDAmountDetector creates new instance of IDAmountDetector.
+// Zero retention retains transactions indefinitely.
+func NewIDAmountDetector(retention time.Duration) *IDAmountDetector {
+	return &IDAmountDetector{
+		retention: retention,
+		lock:      &sync.RWMutex{},
+		txns:      make(map[string]map[string][]*TxnRef),
+	}
+}
+
+// Check returns true if a transaction with same ID and load-amount
+// was accepted for customer within retention of transaction's time.
+func (d *IDAmountDetector) Check(custID string, txn model.Transaction) (bool, *TxnRef, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	for _, ref := range d.txns[custID][txn.ID] {
+		if d.matches(ref, txn) {
+			return true, ref, nil
+		}
+	}
+	return false, nil, nil
+}
+
+// Record records transaction as accepted for customer.
+func (d *IDAmountDetector) Record(custID string, txn model.Transaction) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	custTxns, exists := d.txns[custID]
+	if !exists {
+		custTxns = make(map[string][]*TxnRef)
+		d.txns[custID] = custTxns
+	}
+	for _, ref := range custTxns[txn.ID] {
+		if ref.TxnTime.Equal(txn.Time) && d.matches(ref, txn) {
+			return
+		}
+	}
+	custTxns[txn.ID] = append(custTxns[txn.ID], txnRefOf(custID, txn))
+}
+
+func (d *IDAmountDetector) matches(ref *TxnRef, txn model.Transaction) bool {
+	if toCents(ref.LoadAmount) != toCents(txn.LoadAmount) {
+		return false
+	}
+	if d.retention == 0 {
+		return true
+	}
+	gap := txn.Time.Sub(ref.TxnTime)
+	if gap < 0 {
+		gap = -gap
+	}
+	return gap <= d.retention
+}
+
+// toCents rounds amount to cents, so amounts derived from
+// balances (see account#recordAccepted) match loaded amounts.
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
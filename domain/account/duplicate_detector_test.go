@@ -0,0 +1,192 @@
+package account
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Duplicate-detectors", func() {
+	const (
+		ProcessTxnCmd model.CmdAction = "ProcessTxn"
+	)
+	const (
+		AccountDepositedEvent     model.EventAction = "AccountDeposited"
+		AccountWithdrawnEvent     model.EventAction = "AccountWithdrawn"
+		DuplicateTxnEvent         model.EventAction = "DuplicateTxn"
+		AccountLimitExceededEvent model.EventAction = "AccountLimitExceeded"
+	)
+	const custID = "1"
+
+	var bus eventutil.Bus
+	var eventRepo eventutil.EventRepo
+
+	txnAt := func(txnID string, loadAmount float64, txnTime string) model.Transaction {
+		parsedTime, err := time.Parse(time.RFC3339, txnTime)
+		Expect(err).ToNot(HaveOccurred())
+		return model.Transaction{
+			ID:         txnID,
+			CustomerID: custID,
+			LoadAmount: loadAmount,
+			Time:       parsedTime,
+		}
+	}
+
+	// Transaction-IDs are reused with same and other
+	// amounts, within and outside of a day.
+	stream := func() []model.Transaction {
+		return []model.Transaction{
+			txnAt("a", 10, "2000-01-05T01:00:00Z"),
+			// Same ID, other amount
+			txnAt("a", 20, "2000-01-05T02:00:00Z"),
+			txnAt("b", 10, "2000-01-05T01:00:00Z"),
+			// Same ID and amount, days later
+			txnAt("b", 10, "2000-01-08T01:00:00Z"),
+			txnAt("c", 5.25, "2000-01-05T03:00:00Z"),
+			// Same ID and amount, within a day
+			txnAt("c", 5.25, "2000-01-05T04:00:00Z"),
+		}
+	}
+
+	newTestAccount := func(detector DuplicateDetector) *account {
+		limits, err := newLimitsSnapshot(0, Limits{})
+		Expect(err).ToNot(HaveOccurred())
+		acc, err := newAccount(&AggregateCfg{
+			Log:       logger.NewStdLogger("Account"),
+			EventRepo: eventRepo,
+
+			AccountDeposited:     AccountDepositedEvent,
+			AccountWithdrawn:     AccountWithdrawnEvent,
+			DuplicateTxn:         DuplicateTxnEvent,
+			AccountLimitExceeded: AccountLimitExceededEvent,
+
+			DuplicateDetector: detector,
+		}, limits)
+		Expect(err).ToNot(HaveOccurred())
+		return acc
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+
+		eventRepo, err = eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+			Bus:            bus,
+			EventStore:     eventutil.NewMemoryEventStore(),
+			UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	table.DescribeTable(
+		"declines duplicates as per detector, and rebuilds detector on replay",
+		func(newDetector func() DuplicateDetector, expectedDuplicates []int) {
+			detector := newDetector()
+			acc := newTestAccount(detector)
+			for _, txn := range stream() {
+				cmd, err := model.NewCmd(&model.CmdCfg{
+					Action: ProcessTxnCmd,
+					Data:   txn,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(acc.handleProcessTxnCmd(cmd)).To(Succeed())
+			}
+
+			events, err := eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(events).To(HaveLen(len(stream())))
+			duplicates := make([]int, 0)
+			for i, event := range events {
+				if event.Action() == DuplicateTxnEvent {
+					duplicates = append(duplicates, i)
+					continue
+				}
+				Expect(event.Action()).To(Equal(AccountDepositedEvent))
+			}
+			Expect(duplicates).To(Equal(expectedDuplicates))
+
+			// Detector of a new account is rebuilt from events
+			replayedDetector := newDetector()
+			replayedAcc := newTestAccount(replayedDetector)
+			Expect(replayedAcc.loadAggregate(custID)).To(Succeed())
+
+			probes := append(
+				stream(),
+				txnAt("a", 20, "2000-01-05T03:00:00Z"),
+				txnAt("b", 10, "2000-01-08T05:00:00Z"),
+				txnAt("d", 10, "2000-01-05T01:00:00Z"),
+			)
+			for _, probe := range probes {
+				isDuplicate, original, err := detector.Check(custID, probe)
+				Expect(err).ToNot(HaveOccurred())
+				replayedIsDuplicate, replayedOriginal, err := replayedDetector.Check(custID, probe)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(replayedIsDuplicate).To(Equal(isDuplicate), "probe: %+v", probe)
+				Expect(replayedOriginal).To(Equal(original), "probe: %+v", probe)
+			}
+		},
+		table.Entry(
+			"transaction-IDs",
+			func() DuplicateDetector {
+				return NewScopedIDDetector(DuplicateScopeCustomer)
+			},
+			[]int{1, 3, 5},
+		),
+		table.Entry(
+			"transaction-IDs and amounts within a day",
+			func() DuplicateDetector {
+				return NewIDAmountDetector(24 * time.Hour)
+			},
+			[]int{5},
+		),
+	)
+
+	It("doesn't record declined transactions", func() {
+		detector := NewIDAmountDetector(0)
+		limits, err := newLimitsSnapshot(0, Limits{
+			DailyTxnsAmountLimit: 100,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		acc, err := newAccount(&AggregateCfg{
+			Log:       logger.NewStdLogger("Account"),
+			EventRepo: eventRepo,
+
+			AccountDeposited:     AccountDepositedEvent,
+			AccountWithdrawn:     AccountWithdrawnEvent,
+			DuplicateTxn:         DuplicateTxnEvent,
+			AccountLimitExceeded: AccountLimitExceededEvent,
+
+			DuplicateDetector: detector,
+		}, limits)
+		Expect(err).ToNot(HaveOccurred())
+
+		txn := txnAt("a", 500, "2000-01-05T01:00:00Z")
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action: ProcessTxnCmd,
+			Data:   txn,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(acc.handleProcessTxnCmd(cmd)).To(Succeed())
+
+		events, err := eventRepo.Fetch(custID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Action()).To(Equal(AccountLimitExceededEvent))
+
+		isDuplicate, _, err := detector.Check(custID, txn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(isDuplicate).To(BeFalse())
+	})
+})
@@ -0,0 +1,52 @@
+package account
+
+// FailureMessages maps causes of transaction-failure to
+// customer-friendly messages, such as for decline-notifications
+// or verbose reports. Use #DefaultFailureMessages for English
+// messages, or provide custom ones for other locales.
+type FailureMessages struct {
+	// Locale of messages, such as "en".
+	Locale   string
+	Messages map[TxnFailureCause]string
+	// Message for causes without a message, including
+	// blank causes of generic failures.
+	Fallback string
+}
+
+// defaultFailureFallback is used if FailureMessages has no fallback.
+const defaultFailureFallback = "Your transaction was declined. Please contact support for details."
+
+// DefaultFailureMessages returns English messages
+// for every cause of transaction-failure.
+func DefaultFailureMessages() *FailureMessages {
+	return &FailureMessages{
+		Locale: "en",
+		Messages: map[TxnFailureCause]string{
+			DuplicateTxn:         "This transaction was already processed.",
+			DailyLimitsExceeded:  "This transaction exceeds your daily load limit.",
+			WeeklyLimitsExceeded: "This transaction exceeds your weekly load limit.",
+			InsufficientFunds:    "Your balance is too low for this transaction.",
+			FraudSuspected:       "This transaction was declined for your security.",
+			AllowanceExhausted:   "This transaction exceeds your monthly allowance.",
+			StaleTxn:             "This transaction is older than your latest transaction.",
+
+			CategoryLimitsExceeded: "This transaction exceeds your load limit for its category.",
+		},
+		Fallback: defaultFailureFallback,
+	}
+}
+
+// Message returns customer-friendly message for cause.
+// Unknown causes get fallback-message.
+func (m *FailureMessages) Message(cause TxnFailureCause) string {
+	if m == nil {
+		return defaultFailureFallback
+	}
+	if msg, found := m.Messages[cause]; found && msg != "" {
+		return msg
+	}
+	if m.Fallback != "" {
+		return m.Fallback
+	}
+	return defaultFailureFallback
+}
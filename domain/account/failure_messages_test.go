@@ -0,0 +1,47 @@
+package account
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FailureMessages", func() {
+	It("maps every failure-cause to a default message", func() {
+		messages := DefaultFailureMessages()
+
+		Expect(messages.Locale).To(Equal("en"))
+		expected := map[TxnFailureCause]string{
+			DuplicateTxn:         "This transaction was already processed.",
+			DailyLimitsExceeded:  "This transaction exceeds your daily load limit.",
+			WeeklyLimitsExceeded: "This transaction exceeds your weekly load limit.",
+			InsufficientFunds:    "Your balance is too low for this transaction.",
+			FraudSuspected:       "This transaction was declined for your security.",
+			AllowanceExhausted:   "This transaction exceeds your monthly allowance.",
+			StaleTxn:             "This transaction is older than your latest transaction.",
+		}
+		for cause, msg := range expected {
+			Expect(messages.Message(cause)).To(Equal(msg), string(cause))
+		}
+	})
+
+	It("falls back for unknown and blank causes", func() {
+		messages := DefaultFailureMessages()
+		Expect(messages.Message("SomethingElse")).To(Equal(defaultFailureFallback))
+		Expect(messages.Message("")).To(Equal(defaultFailureFallback))
+
+		custom := &FailureMessages{
+			Locale: "fr",
+			Messages: map[TxnFailureCause]string{
+				DuplicateTxn: "Cette transaction a déjà été traitée.",
+			},
+			Fallback: "Votre transaction a été refusée.",
+		}
+		Expect(custom.Message(DuplicateTxn)).To(Equal("Cette transaction a déjà été traitée."))
+		Expect(custom.Message(DailyLimitsExceeded)).To(Equal("Votre transaction a été refusée."))
+
+		// Without any fallback configured
+		var nilMessages *FailureMessages
+		Expect(nilMessages.Message(DuplicateTxn)).To(Equal(defaultFailureFallback))
+		Expect((&FailureMessages{}).Message(DuplicateTxn)).To(Equal(defaultFailureFallback))
+	})
+})
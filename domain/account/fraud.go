@@ -0,0 +1,185 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Decision is result of a fraud-check.
+type Decision struct {
+	Reject bool
+	// Reason for rejection, included in failure-event.
+	Reason string
+}
+
+// StateSummary is a read-only copy of account's
+// current limits-usage, provided to fraud-checks.
+type StateSummary Usage
+
+// FraudChecker scores transactions before they're accepted.
+// Implementations should return when context is done.
+type FraudChecker interface {
+	Score(ctx context.Context, txn model.Transaction, state StateSummary) (Decision, error)
+}
+
+// FraudFailurePolicy decides how a transaction is
+// handled if fraud-check errors or times-out.
+type FraudFailurePolicy string
+
+// Supported fraud-failure policies.
+const (
+	// Transaction is accepted.
+	FraudFailOpen FraudFailurePolicy = "fail_open"
+	// Transaction is rejected as FraudSuspected.
+	FraudFailClosed FraudFailurePolicy = "fail_closed"
+)
+
+// NoopFraudChecker accepts all transactions.
+type NoopFraudChecker struct{}
+
+// Score always accepts transaction.
+func (NoopFraudChecker) Score(context.Context, model.Transaction, StateSummary) (Decision, error) {
+	return Decision{}, nil
+}
+
+// FraudCheck is a call recorded by RecordingFraudChecker.
+type FraudCheck struct {
+	Txn   model.Transaction
+	State StateSummary
+}
+
+// RecordingFraudChecker is a FraudChecker for tests, which
+// records all calls and responds with configured result.
+// Use #NewRecordingFraudChecker to create new instance.
+type RecordingFraudChecker struct {
+	decision Decision
+	err      error
+	// If set, Score blocks until context is done
+	block bool
+
+	lock  *sync.Mutex
+	calls []FraudCheck
+}
+
+// NewRecordingFraudChecker creates new instance of
+// RecordingFraudChecker which returns provided result.
+// If block is set, Score instead blocks until its
+// context is done and returns context's error.
+func NewRecordingFraudChecker(decision Decision, err error, block bool) *RecordingFraudChecker {
+	return &RecordingFraudChecker{
+		decision: decision,
+		err:      err,
+		block:    block,
+
+		lock:  &sync.Mutex{},
+		calls: make([]FraudCheck, 0),
+	}
+}
+
+// Score records call and returns configured result.
+func (c *RecordingFraudChecker) Score(
+	ctx context.Context,
+	txn model.Transaction,
+	state StateSummary,
+) (Decision, error) {
+	c.lock.Lock()
+	c.calls = append(c.calls, FraudCheck{
+		Txn:   txn,
+		State: state,
+	})
+	c.lock.Unlock()
+
+	if c.block {
+		<-ctx.Done()
+		return Decision{}, ctx.Err()
+	}
+	return c.decision, c.err
+}
+
+// Calls returns copy of recorded calls, in called order.
+func (c *RecordingFraudChecker) Calls() []FraudCheck {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	calls := make([]FraudCheck, len(c.calls))
+	copy(calls, c.calls)
+	return calls
+}
+
+type fraudResult struct {
+	decision Decision
+	err      error
+}
+
+// checkFraud consults fraud-checker for transactions above
+// threshold, if both are configured. Errors and time-outs from checker are handled
+// as per failure-policy.
+// Return params:
+// - string: Reason for rejection, blank if accepted.
+func (a *account) checkFraud(logPrefix string, txn *model.Transaction) string {
+	// Checks are disabled without a checker or threshold,
+	// so no routine or timer is started for transactions.
+	_, isNoop := a.fraudChecker.(NoopFraudChecker)
+	if isNoop || a.fraudCheckThreshold == 0 {
+		return ""
+	}
+	if txn.LoadAmount <= a.fraudCheckThreshold {
+		return ""
+	}
+	a.log.Tracef("%s Running fraud-check", logPrefix)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	state := StateSummary(*a.usage(txn.Time))
+	// Buffered so checker-routine can
+	// return even after time-out
+	resultChan := make(chan fraudResult, 1)
+	go func() {
+		decision, err := a.fraudChecker.Score(ctx, *txn, state)
+		resultChan <- fraudResult{
+			decision: decision,
+			err:      err,
+		}
+	}()
+
+	var result fraudResult
+	select {
+	case result = <-resultChan:
+	case <-a.clock.After(a.fraudCheckTimeout):
+		result.err = fmt.Errorf("timed-out after %s", a.fraudCheckTimeout)
+	}
+
+	if result.err != nil {
+		err := errors.Wrap(result.err, "fraud-check failed")
+		if a.fraudFailurePolicy == FraudFailClosed {
+			a.log.Warnf("%s Rejecting transaction: %s", logPrefix, err)
+			return err.Error()
+		}
+		a.log.Warnf("%s Accepting transaction: %s", logPrefix, err)
+		return ""
+	}
+	if result.decision.Reject {
+		reason := result.decision.Reason
+		if reason == "" {
+			reason = "rejected by fraud-check"
+		}
+		return reason
+	}
+	return ""
+}
+
+// fraudCheckTimeout returns time-out for
+// fraud-checks, as configured in seconds.
+func fraudCheckTimeout(timeoutSec int) time.Duration {
+	if timeoutSec == 0 {
+		timeoutSec = defaultFraudCheckTimeoutSec
+	}
+	return time.Duration(timeoutSec) * time.Second
+}
@@ -0,0 +1,132 @@
+package account
+
+import (
+	"fmt"
+	"math"
+)
+
+// LimitsConflict identifies why limits are invalid.
+type LimitsConflict string
+
+// Conflicts of invalid limits. Disabled (zero) limits
+// don't conflict with any other limit.
+const (
+	// Limit is NaN or infinite.
+	LimitNotFinite LimitsConflict = "not_finite"
+	// Weekly-limit is lower than daily-limit of same kind,
+	// so weekly-limit would be exceeded within a day.
+	LimitWeeklyBelowDaily LimitsConflict = "weekly_below_daily"
+	// Daily amount-limit is higher than monthly-allowance with
+	// its max carry-over, so it can never be reached. Weekly
+	// limits aren't checked, since weeks can span two months.
+	LimitAboveAllowance LimitsConflict = "above_allowance"
+	// Limit depends on another limit which is disabled.
+	LimitRequiresOther LimitsConflict = "requires_other"
+)
+
+// LimitsError is error of invalid limits in config (or
+// in a limits-update). Limits are named as in AggregateCfg.
+type LimitsError struct {
+	Conflict LimitsConflict
+	Limit    string
+	// Limit which Limit conflicts with,
+	// blank for LimitNotFinite.
+	OtherLimit string
+	msg        string
+}
+
+func (e *LimitsError) Error() string {
+	return e.msg
+}
+
+// checkLimitValues checks that daily/weekly limits
+// are finite, and consistent with each other.
+func checkLimitValues(limits Limits) error {
+	err := checkFinite("DailyTxnsAmountLimit", limits.DailyTxnsAmountLimit)
+	if err != nil {
+		return err
+	}
+	err = checkFinite("WeeklyTxnsAmountLimit", limits.WeeklyTxnsAmountLimit)
+	if err != nil {
+		return err
+	}
+
+	if limits.WeeklyTxnsAmountLimit > 0 &&
+		limits.WeeklyTxnsAmountLimit < limits.DailyTxnsAmountLimit {
+		return &LimitsError{
+			Conflict:   LimitWeeklyBelowDaily,
+			Limit:      "WeeklyTxnsAmountLimit",
+			OtherLimit: "DailyTxnsAmountLimit",
+			msg:        "weekly-amount limit must be greater than daily amount limit",
+		}
+	}
+	if limits.NumWeeklyTxnsLimit > 0 &&
+		limits.NumWeeklyTxnsLimit < limits.NumDailyTxnsLimit {
+		return &LimitsError{
+			Conflict:   LimitWeeklyBelowDaily,
+			Limit:      "NumWeeklyTxnsLimit",
+			OtherLimit: "NumDailyTxnsLimit",
+			msg:        "num of weekly-transactions must be greater than num of daily-transactions",
+		}
+	}
+	return nil
+}
+
+// checkLimits checks limits (from config, or from a limits-update)
+// along with monthly-allowance of config. Limits are checked for
+// every account created, since limits can be updated independently
+// of monthly-allowance.
+func (cfg *AggregateCfg) checkLimits(limits Limits) error {
+	err := checkLimitValues(limits)
+	if err != nil {
+		return err
+	}
+
+	err = checkFinite("MonthlyAllowance", cfg.MonthlyAllowance)
+	if err != nil {
+		return err
+	}
+	err = checkFinite("MaxCarryOver", cfg.MaxCarryOver)
+	if err != nil {
+		return err
+	}
+	if cfg.MaxCarryOver > 0 && cfg.MonthlyAllowance == 0 {
+		return &LimitsError{
+			Conflict:   LimitRequiresOther,
+			Limit:      "MaxCarryOver",
+			OtherLimit: "MonthlyAllowance",
+			msg:        "monthly-allowance must be set if carry-over is enabled",
+		}
+	}
+	if cfg.MonthlyAllowance == 0 {
+		return nil
+	}
+
+	// Most that can be loaded in a month
+	maxMonthly := cfg.MonthlyAllowance + cfg.MaxCarryOver
+	if limits.DailyTxnsAmountLimit > maxMonthly {
+		return &LimitsError{
+			Conflict:   LimitAboveAllowance,
+			Limit:      "DailyTxnsAmountLimit",
+			OtherLimit: "MonthlyAllowance",
+			msg: fmt.Sprintf(
+				"daily amount limit (%.2f) must not be greater than monthly-allowance with carry-over (%.2f)",
+				limits.DailyTxnsAmountLimit, maxMonthly,
+			),
+		}
+	}
+	return nil
+}
+
+// checkFinite checks that limit is neither NaN nor infinite,
+// which aren't caught by validator-tags of limits.
+func checkFinite(name string, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return &LimitsError{
+			Conflict: LimitNotFinite,
+			Limit:    name,
+			msg:      fmt.Sprintf("%s must be a finite number, got: %f", name, value),
+		}
+	}
+	return nil
+}
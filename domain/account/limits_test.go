@@ -0,0 +1,169 @@
+package account
+
+import (
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+var _ = Describe("Limits validation", func() {
+	type limitsCase struct {
+		limits           Limits
+		monthlyAllowance float64
+		maxCarryOver     float64
+	}
+
+	// newCfg returns valid account-config with limits of test-case.
+	newCfg := func(test limitsCase) *AggregateCfg {
+		return &AggregateCfg{
+			Log:       logger.NewStdLogger("Account"),
+			EventRepo: &eventutil.LoggedEventRepo{},
+
+			AccountDeposited:     "AccountDeposited",
+			AccountWithdrawn:     "AccountWithdrawn",
+			DuplicateTxn:         "DuplicateTxn",
+			AccountLimitExceeded: "AccountLimitExceeded",
+
+			DailyTxnsAmountLimit:  test.limits.DailyTxnsAmountLimit,
+			NumDailyTxnsLimit:     test.limits.NumDailyTxnsLimit,
+			WeeklyTxnsAmountLimit: test.limits.WeeklyTxnsAmountLimit,
+			NumWeeklyTxnsLimit:    test.limits.NumWeeklyTxnsLimit,
+
+			MonthlyAllowance: test.monthlyAllowance,
+			MaxCarryOver:     test.maxCarryOver,
+		}
+	}
+
+	table.DescribeTable(
+		"accepts valid combinations of limits",
+		func(test limitsCase) {
+			cfg := newCfg(test)
+			Expect(cfg.Validate()).To(Succeed())
+
+			snapshot, err := newLimitsSnapshot(0, test.limits)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = newAccount(cfg, snapshot)
+			Expect(err).ToNot(HaveOccurred())
+		},
+		table.Entry("all disabled", limitsCase{}),
+		table.Entry("only daily", limitsCase{
+			limits: Limits{DailyTxnsAmountLimit: 5000, NumDailyTxnsLimit: 3},
+		}),
+		table.Entry("only weekly", limitsCase{
+			limits: Limits{WeeklyTxnsAmountLimit: 20000, NumWeeklyTxnsLimit: 5},
+		}),
+		table.Entry("daily with higher weekly", limitsCase{
+			limits: Limits{
+				DailyTxnsAmountLimit:  5000,
+				NumDailyTxnsLimit:     3,
+				WeeklyTxnsAmountLimit: 20000,
+				NumWeeklyTxnsLimit:    5,
+			},
+		}),
+		table.Entry("daily with equal weekly", limitsCase{
+			limits: Limits{
+				DailyTxnsAmountLimit:  5000,
+				NumDailyTxnsLimit:     3,
+				WeeklyTxnsAmountLimit: 5000,
+				NumWeeklyTxnsLimit:    3,
+			},
+		}),
+		// Disabled weekly-limits don't constrain daily-limits
+		table.Entry("daily with disabled weekly", limitsCase{
+			limits: Limits{DailyTxnsAmountLimit: 50000, NumDailyTxnsLimit: 100},
+		}),
+		table.Entry("daily amount with weekly number", limitsCase{
+			limits: Limits{DailyTxnsAmountLimit: 5000, NumWeeklyTxnsLimit: 1},
+		}),
+		table.Entry("only monthly", limitsCase{monthlyAllowance: 5000}),
+		table.Entry("monthly with carry-over", limitsCase{
+			monthlyAllowance: 5000,
+			maxCarryOver:     2000,
+		}),
+		table.Entry("daily within monthly", limitsCase{
+			limits:           Limits{DailyTxnsAmountLimit: 5000},
+			monthlyAllowance: 5000,
+		}),
+		table.Entry("daily within monthly with carry-over", limitsCase{
+			limits:           Limits{DailyTxnsAmountLimit: 6000},
+			monthlyAllowance: 5000,
+			maxCarryOver:     1000,
+		}),
+		// Weeks can span two months
+		table.Entry("weekly above monthly", limitsCase{
+			limits:           Limits{WeeklyTxnsAmountLimit: 8000},
+			monthlyAllowance: 5000,
+		}),
+	)
+
+	table.DescribeTable(
+		"rejects invalid combinations of limits",
+		func(test limitsCase, conflict LimitsConflict, limit string, otherLimit string) {
+			cfg := newCfg(test)
+			err := cfg.Validate()
+			Expect(err).To(HaveOccurred())
+			limitsErr := &LimitsError{}
+			Expect(err).To(BeAssignableToTypeOf(limitsErr))
+			limitsErr = err.(*LimitsError)
+			Expect(limitsErr.Conflict).To(Equal(conflict))
+			Expect(limitsErr.Limit).To(Equal(limit))
+			Expect(limitsErr.OtherLimit).To(Equal(otherLimit))
+
+			// Limits can also be updated independently of config
+			snapshot, err := newLimitsSnapshot(0, test.limits)
+			if err == nil {
+				_, err = newAccount(cfg, snapshot)
+			}
+			Expect(err).To(Equal(limitsErr))
+		},
+		table.Entry(
+			"weekly amount below daily",
+			limitsCase{limits: Limits{DailyTxnsAmountLimit: 100, WeeklyTxnsAmountLimit: 99}},
+			LimitWeeklyBelowDaily, "WeeklyTxnsAmountLimit", "DailyTxnsAmountLimit",
+		),
+		table.Entry(
+			"weekly number below daily",
+			limitsCase{limits: Limits{NumDailyTxnsLimit: 4, NumWeeklyTxnsLimit: 3}},
+			LimitWeeklyBelowDaily, "NumWeeklyTxnsLimit", "NumDailyTxnsLimit",
+		),
+		table.Entry(
+			"infinite daily amount",
+			limitsCase{limits: Limits{DailyTxnsAmountLimit: math.Inf(1)}},
+			LimitNotFinite, "DailyTxnsAmountLimit", "",
+		),
+		table.Entry(
+			"NaN weekly amount",
+			limitsCase{limits: Limits{WeeklyTxnsAmountLimit: math.NaN()}},
+			LimitNotFinite, "WeeklyTxnsAmountLimit", "",
+		),
+		table.Entry(
+			"infinite monthly-allowance",
+			limitsCase{monthlyAllowance: math.Inf(1)},
+			LimitNotFinite, "MonthlyAllowance", "",
+		),
+		table.Entry(
+			"carry-over without monthly-allowance",
+			limitsCase{maxCarryOver: 1000},
+			LimitRequiresOther, "MaxCarryOver", "MonthlyAllowance",
+		),
+		table.Entry(
+			"daily amount above monthly",
+			limitsCase{limits: Limits{DailyTxnsAmountLimit: 5001}, monthlyAllowance: 5000},
+			LimitAboveAllowance, "DailyTxnsAmountLimit", "MonthlyAllowance",
+		),
+		table.Entry(
+			"daily amount above monthly with carry-over",
+			limitsCase{
+				limits:           Limits{DailyTxnsAmountLimit: 7001},
+				monthlyAllowance: 5000,
+				maxCarryOver:     2000,
+			},
+			LimitAboveAllowance, "DailyTxnsAmountLimit", "MonthlyAllowance",
+		),
+	)
+})
@@ -0,0 +1,185 @@
+package account
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// TxnIDExtractorCfg is config for #NewTxnIDExtractor.
+// Actions must match those of AggregateCfg of accounts
+// loading events from indexed event-store.
+type TxnIDExtractorCfg struct {
+	AccountDeposited     model.EventAction `validate:"nonzero"`
+	AccountWithdrawn     model.EventAction `validate:"nonzero"`
+	AccountLimitExceeded model.EventAction `validate:"nonzero"`
+	// Optional, same as AggregateCfg#AccountSeeded.
+	AccountSeeded model.EventAction
+}
+
+// NewTxnIDExtractor creates extractor indexing transactions of
+// account's events, for event-stores such as one created using
+// eventutil#NewMemoryEventStoreWithTxnIDs. Accounts loading
+// from indexed event-stores only decode events relevant to
+// limits, and rebuild everything else from these records.
+// Records of success-events have balance after transaction as
+// their Value, and records of seeded balances have the balance
+// and its as-of time.
+func NewTxnIDExtractor(cfg *TxnIDExtractorCfg) (eventutil.TxnIDExtractor, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+	actions := *cfg
+
+	return func(event model.Event) (eventutil.TxnIDRecord, bool, error) {
+		record := eventutil.TxnIDRecord{Action: event.Action()}
+
+		switch event.Action() {
+		case actions.AccountDeposited, actions.AccountWithdrawn:
+			state, err := DecodeState(event.RawData())
+			if err != nil {
+				return record, false, errors.Wrap(err, "error unmarshalling event-data")
+			}
+			record.TxnID = state.TxnID
+			record.TxnTime = state.TxnTime
+			record.Value = state.TotalAmount
+			record.IsTest = state.IsTest
+			record.InputSeq = state.InputSeq
+			record.Category = state.Category
+
+		case actions.AccountLimitExceeded:
+			failure := &TxnFailure{}
+			err := json.Unmarshal(event.RawData(), failure)
+			if err != nil {
+				return record, false, errors.Wrap(err, "error unmarshalling event-data")
+			}
+			record.TxnID = failure.Txn.ID
+			record.TxnTime = failure.Txn.Time
+
+		default:
+			if actions.AccountSeeded == "" || event.Action() != actions.AccountSeeded {
+				return record, false, nil
+			}
+			seed := &OpeningBalance{}
+			err := json.Unmarshal(event.RawData(), seed)
+			if err != nil {
+				return record, false, errors.Wrap(err, "error unmarshalling event-data")
+			}
+			record.TxnTime = seed.AsOf
+			record.Value = seed.Balance
+		}
+		return record, true, nil
+	}, nil
+}
+
+// replayBounded rebuilds account-state same as #replay, using
+// transaction-ID records of its events. Transaction-keys, balance
+// and duplicate-detector are rebuilt from records alone (see
+// #scanTxnIDs), so only events still relevant to limits are
+// decoded.
+func (a *account) replayBounded(
+	events []model.Event,
+	records []eventutil.TxnIDRecord,
+) error {
+	indexes, err := a.scanTxnIDs(records, len(events))
+	if err != nil {
+		return err
+	}
+
+	// Events are decoded in order, so later
+	// events overwrite records of their periods.
+	for _, index := range indexes {
+		state, err := DecodeState(events[index].RawData())
+		if err != nil {
+			return errors.Wrap(err, "error unmarshalling event-data")
+		}
+		key := a.bucketKey(state.TxnTime)
+		if !state.TxnTime.Before(a.pruneBefore) {
+			a.ensureBuckets(key)
+			a.dailyTxn[key.year][key.day] = state.DailyTxn
+			a.weeklyTxn[key.weekYear][key.week] = state.WeeklyTxn
+			a.applyCategoryState(state, key)
+		}
+		a.monthlyTxn[key.month] = state.MonthlyTxn
+	}
+	return nil
+}
+
+// scanTxnIDs applies transaction-ID records, and returns
+// indexes (in ascending order) of success-events to be
+// decoded: ones within limits-window (for daily/weekly
+// records), and latest one of every month (for monthly
+// records, which carry-over is derived from).
+func (a *account) scanTxnIDs(records []eventutil.TxnIDRecord, numEvents int) ([]int, error) {
+	// Balance after records applied so far,
+	// for amounts of accepted transactions.
+	balance := 0.0
+	indexes := make([]int, 0)
+	// Latest event of month, keyed by month of #bucketKey
+	monthEvents := make(map[int]int)
+
+	for _, record := range records {
+		if record.Index >= numEvents {
+			return nil, fmt.Errorf("transaction-id record of missing event: %d", record.Index)
+		}
+		switch record.Action {
+		case a.accountDeposited, a.accountWithdrawn:
+			a.txnKeysRecord[a.txnKey(record.TxnID, record.TxnTime)] = struct{}{}
+			a.trackLastTxn(record.TxnID, record.TxnTime)
+			a.numTxns++
+			a.duplicateDetector.Record(a.custID, model.Transaction{
+				ID:         record.TxnID,
+				CustomerID: a.custID,
+				LoadAmount: record.Value - balance,
+				Time:       record.TxnTime,
+				IsTest:     record.IsTest,
+				InputSeq:   record.InputSeq,
+				Category:   record.Category,
+			})
+			a.balance = record.Value
+			a.trackNonPositive(record.TxnTime)
+			balance = record.Value
+
+			if !record.TxnTime.Before(a.pruneBefore) {
+				indexes = append(indexes, record.Index)
+			}
+			monthEvents[a.bucketKey(record.TxnTime).month] = record.Index
+
+		case a.accountLimitExceeded:
+			a.declinedTxnKeys[a.txnKey(record.TxnID, record.TxnTime)] = struct{}{}
+
+		default:
+			if a.accountSeeded == "" || record.Action != a.accountSeeded {
+				continue
+			}
+			a.balance = record.Value
+			a.negativeOpening = record.Value < 0
+			a.nonPositiveSince = time.Time{}
+			a.trackNonPositive(record.TxnTime)
+			balance = record.Value
+		}
+	}
+
+	inWindow := make(map[int]struct{}, len(indexes))
+	for _, index := range indexes {
+		inWindow[index] = struct{}{}
+	}
+	for _, index := range monthEvents {
+		if _, exists := inWindow[index]; !exists {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
@@ -0,0 +1,352 @@
+package account
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+const (
+	replayDeposited     model.EventAction = "AccountDeposited"
+	replayWithdrawn     model.EventAction = "AccountWithdrawn"
+	replayDuplicateTxn  model.EventAction = "DuplicateTxn"
+	replayLimitExceeded model.EventAction = "AccountLimitExceeded"
+	replaySeeded        model.EventAction = "AccountSeeded"
+)
+
+// newReplayRepo creates event-repo for replay-tests, which
+// indexes transaction-IDs if isIndexed is set.
+func newReplayRepo(bus eventutil.Bus, isIndexed bool) (eventutil.EventRepo, error) {
+	var store eventutil.EventStore = eventutil.NewMemoryEventStore()
+	if isIndexed {
+		extractTxnID, err := NewTxnIDExtractor(&TxnIDExtractorCfg{
+			AccountDeposited:     replayDeposited,
+			AccountWithdrawn:     replayWithdrawn,
+			AccountLimitExceeded: replayLimitExceeded,
+			AccountSeeded:        replaySeeded,
+		})
+		if err != nil {
+			return nil, err
+		}
+		store, err = eventutil.NewMemoryEventStoreWithTxnIDs(extractTxnID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+		Bus:            bus,
+		EventStore:     store,
+		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+	})
+}
+
+// newReplayAccount creates account with limits, category-limits,
+// allowance and seeded balances, so replay rebuilds all of its
+// state.
+func newReplayAccount(
+	repo eventutil.EventRepo,
+	scope DuplicateScope,
+	detector DuplicateDetector,
+	limits Limits,
+) (*account, error) {
+	snapshot, err := newLimitsSnapshot(0, limits)
+	if err != nil {
+		return nil, err
+	}
+	return newAccount(&AggregateCfg{
+		Log:       logger.NewStdLogger("Account"),
+		EventRepo: repo,
+
+		AccountDeposited:     replayDeposited,
+		AccountWithdrawn:     replayWithdrawn,
+		DuplicateTxn:         replayDuplicateTxn,
+		AccountLimitExceeded: replayLimitExceeded,
+		AccountSeeded:        replaySeeded,
+
+		DuplicateScope:    scope,
+		DuplicateDetector: detector,
+		MonthlyAllowance:  15000,
+		MaxCarryOver:      5000,
+		CategoryLimits: map[string]Limits{
+			"ATM": {
+				DailyTxnsAmountLimit: 2000,
+				NumWeeklyTxnsLimit:   3,
+			},
+		},
+	}, snapshot)
+}
+
+// randomTxns deterministically generates transactions of a
+// customer for seed, spanning years. Some transactions reuse
+// IDs of earlier ones (including ones outside limits-window),
+// or arrive out of order, and some have a category.
+func randomTxns(seed int64, custID string, numTxns int) []model.Transaction {
+	rnd := rand.New(rand.NewSource(seed))
+	txnTime := time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	txns := make([]model.Transaction, 0, numTxns)
+	for i := 0; i < numTxns; i++ {
+		switch roll := rnd.Float64(); {
+		case roll < 0.6:
+			txnTime = txnTime.Add(time.Duration(rnd.Intn(12)+1) * time.Hour)
+		case roll < 0.9:
+			txnTime = txnTime.AddDate(0, 0, rnd.Intn(6)+1)
+		default:
+			txnTime = txnTime.AddDate(0, rnd.Intn(3)+1, 0)
+		}
+
+		txn := model.Transaction{
+			ID:         fmt.Sprintf("%d", i+1),
+			CustomerID: custID,
+			LoadAmount: float64(rnd.Intn(300000)) / 100,
+			Time:       txnTime,
+		}
+		if rnd.Float64() < 0.3 {
+			txn.LoadAmount = -txn.LoadAmount
+		}
+		if rnd.Float64() < 0.05 {
+			txn.Time = txnTime.AddDate(0, 0, -rnd.Intn(10))
+		}
+		if rnd.Float64() < 0.1 && i > 0 {
+			original := txns[rnd.Intn(len(txns))]
+			txn.ID = original.ID
+			if rnd.Float64() < 0.5 {
+				txn.LoadAmount = original.LoadAmount
+			}
+		}
+		switch roll := rnd.Float64(); {
+		case roll < 0.3:
+			txn.Category = "ATM"
+		case roll < 0.4:
+			txn.Category = "online"
+		}
+		txns = append(txns, txn)
+	}
+	return txns
+}
+
+// processTxn handles transaction using account.
+func processTxn(acc *account, txn model.Transaction) error {
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		Action: "ProcessTxn",
+		Data:   &txn,
+	})
+	if err != nil {
+		return err
+	}
+	return acc.handleProcessTxnCmd(cmd)
+}
+
+var _ = Describe("Bounded replay", func() {
+	const custID = "1"
+	limits := Limits{
+		DailyTxnsAmountLimit:  5000,
+		NumDailyTxnsLimit:     3,
+		WeeklyTxnsAmountLimit: 20000,
+		NumWeeklyTxnsLimit:    5,
+	}
+
+	var bus eventutil.Bus
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	// Full replay is the oracle: accounts loading from indexed
+	// and non-indexed repos must publish same events for random
+	// transactions, and load same state from these.
+	table.DescribeTable(
+		"yields same results as full replay",
+		func(seed int64, scope DuplicateScope, newDetector func() DuplicateDetector) {
+			repos := make([]eventutil.EventRepo, 2)
+			accounts := make([]*account, 2)
+			for i, isIndexed := range []bool{false, true} {
+				var err error
+				repos[i], err = newReplayRepo(bus, isIndexed)
+				Expect(err).ToNot(HaveOccurred())
+				err = SeedOpeningBalances(repos[i], []OpeningBalance{{
+					CustID:  custID,
+					Balance: 250,
+					AsOf:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+				}}, &SeedOpts{AccountSeeded: replaySeeded})
+				Expect(err).ToNot(HaveOccurred())
+
+				var detector DuplicateDetector
+				if newDetector != nil {
+					detector = newDetector()
+				}
+				accounts[i], err = newReplayAccount(repos[i], scope, detector, limits)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			txns := randomTxns(seed, custID, 400)
+			for _, txn := range txns {
+				for _, acc := range accounts {
+					Expect(processTxn(acc, txn)).To(Succeed())
+				}
+			}
+
+			fullEvents, err := repos[0].Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			boundedEvents, err := repos[1].Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(boundedEvents).To(HaveLen(len(fullEvents)))
+			for i, event := range fullEvents {
+				Expect(boundedEvents[i].Action()).To(Equal(event.Action()))
+				Expect(boundedEvents[i].RawData()).To(MatchJSON(event.RawData()))
+			}
+
+			// Fresh accounts loaded for transaction
+			// following history are also same.
+			nextTxnTime := txns[len(txns)-1].Time.AddDate(0, 0, 1)
+			for i, repo := range repos {
+				var detector DuplicateDetector
+				if newDetector != nil {
+					detector = newDetector()
+				}
+				accounts[i], err = newReplayAccount(repo, scope, detector, limits)
+				Expect(err).ToNot(HaveOccurred())
+				accounts[i].pruneBefore = accounts[i].windowStart(nextTxnTime)
+				Expect(accounts[i].loadAggregate(custID)).To(Succeed())
+			}
+			full, bounded := accounts[0], accounts[1]
+			Expect(bounded.accountState).To(Equal(full.accountState))
+			Expect(bounded.declinedTxnKeys).To(Equal(full.declinedTxnKeys))
+			Expect(bounded.duplicateDetector).To(Equal(full.duplicateDetector))
+		},
+		table.Entry("seed 1", int64(1), DuplicateScopeCustomer, nil),
+		table.Entry("seed 2", int64(2), DuplicateScopeCustomer, nil),
+		table.Entry("seed 3, day-scope", int64(3), DuplicateScopeCustomerDay, nil),
+		table.Entry("seed 4, week-scope", int64(4), DuplicateScopeCustomerWeek, nil),
+		table.Entry("seed 5, ID-amount detector", int64(5), DuplicateScopeCustomer,
+			func() DuplicateDetector {
+				return NewIDAmountDetector(0)
+			},
+		),
+	)
+
+	It("falls back to full replay if repo doesn't index transaction-ids", func() {
+		repo, err := newReplayRepo(bus, false)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = repo.(eventutil.TxnIDFetcher).FetchIDs(custID)
+		Expect(err).To(MatchError(eventutil.ErrTxnIDsNotIndexed))
+
+		acc, err := newReplayAccount(repo, "", nil, limits)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(processTxn(acc, randomTxns(1, custID, 1)[0])).To(Succeed())
+		Expect(acc.loadAggregate(custID)).To(Succeed())
+		Expect(acc.numTxns).To(Equal(1))
+	})
+})
+
+// BenchmarkLoadAggregate loads account with 5 years of
+// history. Bounded replay should take about as long as
+// scanning transaction-IDs, since only events within
+// limits-window (and latest event of every month) are
+// decoded, unlike full replay which decodes all events.
+func BenchmarkLoadAggregate(b *testing.B) {
+	const custID = "1"
+
+	bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+	if err != nil {
+		b.Fatalf("error creating bus: %s", err)
+	}
+	defer bus.Terminate()
+	repo, err := newReplayRepo(bus, true)
+	if err != nil {
+		b.Fatalf("error creating event-repo: %s", err)
+	}
+	// Generated using retained state, so
+	// account isn't reloaded for every transaction.
+	acc, err := newReplayAccount(repo, "", nil, Limits{})
+	if err != nil {
+		b.Fatalf("error creating account: %s", err)
+	}
+	acc.retainState = true
+
+	// 4 transactions every day, and a
+	// withdrawal for every 3 deposits.
+	start := time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(5, 0, 0)
+	numTxns := 0
+	for txnTime := start; txnTime.Before(end); txnTime = txnTime.Add(6 * time.Hour) {
+		numTxns++
+		amount := 100.0
+		if numTxns%4 == 0 {
+			amount = -250
+		}
+		err := processTxn(acc, model.Transaction{
+			ID:         fmt.Sprintf("%d", numTxns),
+			CustomerID: custID,
+			LoadAmount: amount,
+			Time:       txnTime,
+		})
+		if err != nil {
+			b.Fatalf("error processing transaction: %s", err)
+		}
+		err = acc.applyPublished()
+		if err != nil {
+			b.Fatalf("error applying events: %s", err)
+		}
+	}
+	events, err := repo.Fetch(custID)
+	if err != nil {
+		b.Fatalf("error fetching events: %s", err)
+	}
+	records, err := repo.(eventutil.TxnIDFetcher).FetchIDs(custID)
+	if err != nil {
+		b.Fatalf("error fetching transaction-ids: %s", err)
+	}
+
+	// newLoadingAccount returns account to be loaded
+	// for transaction following history.
+	newLoadingAccount := func(b *testing.B) *account {
+		acc, err := newReplayAccount(repo, "", nil, Limits{})
+		if err != nil {
+			b.Fatalf("error creating account: %s", err)
+		}
+		acc.custID = custID
+		acc.pruneBefore = acc.windowStart(end)
+		return acc
+	}
+
+	b.Run("FullReplay", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := newLoadingAccount(b).replay(events)
+			if err != nil {
+				b.Fatalf("error replaying events: %s", err)
+			}
+		}
+	})
+	b.Run("BoundedReplay", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := newLoadingAccount(b).loadAggregate(custID)
+			if err != nil {
+				b.Fatalf("error loading aggregate: %s", err)
+			}
+		}
+	})
+	b.Run("IDScan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := newLoadingAccount(b).scanTxnIDs(records, len(events))
+			if err != nil {
+				b.Fatalf("error scanning transaction-ids: %s", err)
+			}
+		}
+	})
+}
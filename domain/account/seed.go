@@ -0,0 +1,97 @@
+package account
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// OpeningBalance is balance of a customer's
+// account carried over from another system.
+type OpeningBalance struct {
+	CustID  string
+	Balance float64
+	// Time balance was taken at.
+	AsOf time.Time
+}
+
+// SeedOpts is config for #SeedOpeningBalances.
+type SeedOpts struct {
+	// Should match AggregateCfg#AccountSeeded.
+	AccountSeeded model.EventAction `validate:"nonzero"`
+	// Optional, allows negative opening-balances,
+	// such as of accounts overdrawn in other system.
+	AllowNegative bool
+}
+
+// SeedOpeningBalances writes an AccountSeeded event for every
+// opening-balance into account's event-repo. Events are marked as
+// replayed, and no commands are issued for these, so these only
+// take effect when aggregates are loaded. Seeded balances don't
+// count towards limits of transactions on same day/week.
+// Entries are validated before writing any events, and customers
+// must not have existing events.
+func SeedOpeningBalances(
+	repo eventutil.EventRepo,
+	entries []OpeningBalance,
+	opts *SeedOpts,
+) error {
+	if repo == nil {
+		return errors.New("event-repo is nil")
+	}
+	if opts == nil {
+		return errors.New("options are nil")
+	}
+	err := validator.Validate(opts)
+	if err != nil {
+		return errors.Wrap(err, "error validating options")
+	}
+
+	seen := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		if entry.CustID == "" {
+			return errors.New("customer-id cannot be empty")
+		}
+		if _, exists := seen[entry.CustID]; exists {
+			return fmt.Errorf("duplicate opening-balance for customer: %s", entry.CustID)
+		}
+		seen[entry.CustID] = struct{}{}
+
+		if entry.Balance < 0 && !opts.AllowNegative {
+			return fmt.Errorf("opening-balance is negative for customer: %s", entry.CustID)
+		}
+		if entry.AsOf.IsZero() {
+			return fmt.Errorf("as-of time not specified for customer: %s", entry.CustID)
+		}
+		events, err := repo.Fetch(entry.CustID)
+		if err != nil {
+			return errors.Wrapf(err, "error fetching events for customer: %s", entry.CustID)
+		}
+		if len(events) > 0 {
+			return fmt.Errorf("customer already has events: %s", entry.CustID)
+		}
+	}
+
+	for _, entry := range entries {
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: entry.CustID,
+			Time:        entry.AsOf,
+			Action:      opts.AccountSeeded,
+			Data:        entry,
+			IsReplay:    true,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error creating event")
+		}
+		err = repo.InsertAndPublish(event)
+		if err != nil {
+			return errors.Wrapf(err, "error storing event for customer: %s", entry.CustID)
+		}
+	}
+	return nil
+}
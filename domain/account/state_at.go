@@ -0,0 +1,165 @@
+package account
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// PointInTimeBasis defines the time an account's
+// event is placed at when reconstructing past state.
+type PointInTimeBasis string
+
+// Supported point-in-time bases.
+const (
+	// Events are placed at time of their transaction
+	// (or time opening-balance was taken at).
+	PointInTimeTxnTime PointInTimeBasis = "txn_time"
+	// Events are placed at time these were processed.
+	PointInTimeProcessedAt PointInTimeBasis = "processed_at"
+)
+
+// StateQuery is data for command querying
+// point-in-time state of customer's account.
+type StateQuery struct {
+	CustID string
+	At     time.Time
+}
+
+// PointInTimeState is state of a customer's
+// account as of a specific time.
+type PointInTimeState struct {
+	CustID string
+	At     time.Time
+	Basis  PointInTimeBasis
+
+	Balance float64
+	// Usage for day and ISO-week (UTC) containing At.
+	Daily  LimitUsage
+	Weekly LimitUsage
+	// IDs of accepted transactions till At, sorted.
+	TxnIDs []string
+}
+
+// StateAt replays customer's account-events placed at or before
+// provided time, and returns account-state as of that time.
+// Events are placed as per PointInTimeBasis in config, and are
+// otherwise applied same as when loading aggregate. Limits from
+// config are included in usage. Only event-actions, limits and
+// point-in-time basis from config are used.
+// Events are replayed in order these were processed, and every
+// event carries totals as of its processing, so if transactions
+// were processed out of order of transaction-time, use
+// PointInTimeProcessedAt basis for exact state.
+// An instant before customer's first event results in zero state.
+func StateAt(
+	repo eventutil.EventReader,
+	custID string,
+	at time.Time,
+	cfg AggregateCfg,
+) (*PointInTimeState, error) {
+	if repo == nil {
+		return nil, errors.New("event-reader is nil")
+	}
+	if custID == "" {
+		return nil, errors.New("customer-id cannot be empty")
+	}
+	basis := cfg.PointInTimeBasis
+	switch basis {
+	case "":
+		basis = PointInTimeTxnTime
+	case PointInTimeTxnTime, PointInTimeProcessedAt:
+	default:
+		return nil, fmt.Errorf("invalid point-in-time basis: %s", basis)
+	}
+
+	limits, err := newLimitsSnapshot(0, cfg.limits())
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating limits-snapshot")
+	}
+	// Transactions are tracked across all periods,
+	// so keys of recorded transactions are their IDs.
+	cfg.DuplicateScope = DuplicateScopeCustomer
+	state, err := newAccountState(&cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating account-state")
+	}
+	state.pruneBefore = state.windowStart(at)
+
+	events, err := repo.Fetch(custID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching events from event-store")
+	}
+	for _, event := range events {
+		eventTime, err := state.eventTime(event, basis)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading time of event: %s", event.ID())
+		}
+		if eventTime.After(at) {
+			continue
+		}
+		err = state.applyEvent(event)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error applying event: %s", event.ID())
+		}
+	}
+
+	txnIDs := make([]string, 0, len(state.txnKeysRecord))
+	for txnID := range state.txnKeysRecord {
+		txnIDs = append(txnIDs, txnID)
+	}
+	sort.Strings(txnIDs)
+
+	key := state.bucketKey(at)
+	return &PointInTimeState{
+		CustID: custID,
+		At:     at,
+		Basis:  basis,
+
+		Balance: state.balance,
+		Daily: LimitUsage{
+			Used:  state.dailyTxn[key.year][key.day],
+			Limit: limits.dailyLimits,
+		},
+		Weekly: LimitUsage{
+			Used:  state.weeklyTxn[key.weekYear][key.week],
+			Limit: limits.weeklyLimits,
+		},
+		TxnIDs: txnIDs,
+	}, nil
+}
+
+// eventTime returns time event is placed at as per provided
+// basis. Events which don't change account-state are placed
+// at time these were processed.
+func (a *accountState) eventTime(event model.Event, basis PointInTimeBasis) (time.Time, error) {
+	if basis == PointInTimeProcessedAt {
+		return event.Time(), nil
+	}
+
+	switch event.Action() {
+	case a.accountDeposited, a.accountWithdrawn:
+		state, err := DecodeState(event.RawData())
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "error unmarshalling event-data")
+		}
+		return state.TxnTime, nil
+
+	case a.accountSeeded:
+		seed := &OpeningBalance{}
+		err := json.Unmarshal(event.RawData(), seed)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "error unmarshalling event-data")
+		}
+		return seed.AsOf, nil
+
+	default:
+		return event.Time(), nil
+	}
+}
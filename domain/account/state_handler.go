@@ -0,0 +1,68 @@
+package account
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+// StatePath is path prefix point-in-time
+// states are served on, as "/state/{customer}".
+const StatePath = "/state/"
+
+// stateHandler serves #StateAt over HTTP.
+type stateHandler struct {
+	log  logger.Logger
+	repo eventutil.EventReader
+	cfg  AggregateCfg
+}
+
+// NewStateHandler returns http.Handler serving point-in-time
+// state of customers' accounts (see #StateAt) as JSON, for
+// requests such as: "GET /state/{customer}?at={RFC3339-time}".
+// Handler should be registered on StatePath.
+func NewStateHandler(
+	log logger.Logger,
+	repo eventutil.EventReader,
+	cfg AggregateCfg,
+) http.Handler {
+	return &stateHandler{
+		log:  log,
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+func (h *stateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	custID := strings.TrimPrefix(r.URL.Path, StatePath)
+	if custID == "" || strings.Contains(custID, "/") {
+		http.Error(w, "customer-id must be specified as: /state/{customer}", http.StatusNotFound)
+		return
+	}
+	at, err := time.Parse(time.RFC3339, r.URL.Query().Get("at"))
+	if err != nil {
+		http.Error(w, "query-param \"at\" must be a RFC3339 time", http.StatusBadRequest)
+		return
+	}
+
+	state, err := StateAt(h.repo, custID, at, h.cfg)
+	if err != nil {
+		h.log.Errorf("[Customer: %s]: Error reconstructing state at %s: %s", custID, at, err)
+		http.Error(w, "error reconstructing state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(state)
+	if err != nil {
+		h.log.Errorf("[Customer: %s]: Error writing state: %s", custID, err)
+	}
+}
@@ -0,0 +1,94 @@
+package account
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Schema-versions of State.
+//   - v1: Version isn't set, and transaction-time is
+//     stored with offset of transaction-request.
+//   - v2: Version is set, and transaction-time is
+//     stored in UTC.
+const (
+	StateVersion1 = 1
+	StateVersion2 = 2
+	// StateVersion is version of States written by account.
+	StateVersion = StateVersion2
+)
+
+// DecodeState unmarshals State from event-data, and upgrades
+// it to current schema-version (see #StateVersion). States of
+// older versions are upgraded as they are read, so stored
+// events don't need to be migrated (see #StateMigrator).
+func DecodeState(data []byte) (*State, error) {
+	state := &State{}
+	err := json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	err = upgradeState(state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// upgradeState upgrades state, in place, to current schema-version.
+func upgradeState(state *State) error {
+	if state.Version == 0 {
+		state.Version = StateVersion1
+	}
+	if state.Version > StateVersion {
+		return errors.Errorf(
+			"state-version %d is newer than supported version %d",
+			state.Version, StateVersion,
+		)
+	}
+
+	if state.Version == StateVersion1 {
+		state.TxnTime = state.TxnTime.UTC()
+		state.Version = StateVersion2
+	}
+	return nil
+}
+
+// StateMigrator returns migrate-func for eventutil#MigrateEvents,
+// which rewrites States of deposit/withdrawal events to current
+// schema-version. Other events, and States already of current
+// version, are returned as is.
+func StateMigrator(
+	accountDeposited model.EventAction,
+	accountWithdrawn model.EventAction,
+) eventutil.MigrateFunc {
+	return func(event model.Event) (model.Event, error) {
+		if event.Action() != accountDeposited && event.Action() != accountWithdrawn {
+			return event, nil
+		}
+
+		version := &struct {
+			Version int
+		}{}
+		err := json.Unmarshal(event.RawData(), version)
+		if err != nil {
+			return event, errors.Wrap(err, "error unmarshalling event-data")
+		}
+		if version.Version == StateVersion {
+			return event, nil
+		}
+
+		state, err := DecodeState(event.RawData())
+		if err != nil {
+			return event, errors.Wrap(err, "error decoding state")
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return event, errors.Wrap(err, "error marshalling state")
+		}
+		return event.WithData(data), nil
+	}
+}
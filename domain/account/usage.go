@@ -0,0 +1,86 @@
+package account
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LimitUsage is usage of transaction-limits for a period.
+type LimitUsage struct {
+	Used TxnRecord
+	// A zero value for any limit means that limit is disabled.
+	Limit TxnRecord
+}
+
+// Usage is a customer's usage of transaction-limits
+// for the periods containing a specific time.
+type Usage struct {
+	CustID string
+	At     time.Time
+	// Latest balance of account.
+	Balance float64
+
+	Daily  LimitUsage
+	Weekly LimitUsage
+}
+
+// BalanceQuery is data for command querying current
+// balance and limits-usage of customer's account.
+type BalanceQuery struct {
+	CustID string
+	// Optional, usage is of periods containing this time.
+	// Defaults to time of latest accepted transaction.
+	At time.Time
+}
+
+// InspectUsage replays customer's account from event-repo in
+// config, and returns its usage against limits in config for
+// the day and week (UTC) containing provided time.
+// Only accepted transactions count towards usage, so this can
+// be used to explain why a transaction was declined.
+func InspectUsage(cfg *AggregateCfg, custID string, at time.Time) (*Usage, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	if custID == "" {
+		return nil, errors.New("customer-id cannot be empty")
+	}
+
+	limits, err := newLimitsSnapshot(0, cfg.limits())
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating limits-snapshot")
+	}
+	acc, err := newAccount(cfg, limits)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating account-aggregate instance")
+	}
+
+	acc.pruneBefore = acc.windowStart(at)
+	err = acc.loadAggregate(custID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading aggregate")
+	}
+	return acc.usage(at), nil
+}
+
+// usage returns limits-usage of loaded
+// aggregate for periods containing provided time.
+func (a *account) usage(at time.Time) *Usage {
+	key := a.bucketKey(at)
+
+	return &Usage{
+		CustID:  a.custID,
+		At:      at,
+		Balance: a.balance,
+
+		Daily: LimitUsage{
+			Used:  a.dailyTxn[key.year][key.day],
+			Limit: a.limits.dailyLimits,
+		},
+		Weekly: LimitUsage{
+			Used:  a.weeklyTxn[key.weekYear][key.week],
+			Limit: a.limits.weeklyLimits,
+		},
+	}
+}
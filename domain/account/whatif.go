@@ -0,0 +1,173 @@
+package account
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// WhatIfDecline is a historically accepted transaction
+// which would be declined under replayed config.
+type WhatIfDecline struct {
+	TxnID      string
+	TxnTime    time.Time
+	LoadAmount float64
+
+	Error        string
+	FailureCause TxnFailureCause
+}
+
+// WhatIfResult is result of replaying a customer's
+// accepted transactions under a different config.
+type WhatIfResult struct {
+	CustID string
+	// Number of historically accepted transactions replayed.
+	NumReplayed int
+	// Transactions which would now be declined, in
+	// order these were originally accepted.
+	Declined []WhatIfDecline
+	// Balance after replay, excluding declined transactions.
+	Balance float64
+}
+
+// ReplayWhatIf replays customer's accepted transactions from
+// event-repo in config through a fresh aggregate, validating
+// these against limits and duplicate-scope in config, and
+// returns transactions which would now be declined.
+// Nothing is stored or published, and fraud-checks are
+// not run, so this is safe to run against live data.
+// Declined transactions don't count towards usage or balance
+// of later transactions, same as when processing these.
+func ReplayWhatIf(cfg *AggregateCfg, custID string) (*WhatIfResult, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	if custID == "" {
+		return nil, errors.New("customer-id cannot be empty")
+	}
+
+	limits, err := newLimitsSnapshot(0, cfg.limits())
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating limits-snapshot")
+	}
+	acc, err := newAccount(cfg, limits)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating account-aggregate instance")
+	}
+	acc.custID = custID
+
+	events, err := cfg.EventRepo.Fetch(custID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching events from event-store")
+	}
+
+	result := &WhatIfResult{
+		CustID:   custID,
+		Declined: make([]WhatIfDecline, 0),
+	}
+	// Historical balance, to derive load-amounts
+	// of transactions from their states.
+	histBalance := float64(0)
+	for _, event := range events {
+		if acc.accountSeeded != "" && event.Action() == acc.accountSeeded {
+			err := acc.applyEvent(event)
+			if err != nil {
+				return nil, errors.Wrap(err, "error applying opening-balance")
+			}
+			histBalance = acc.balance
+			continue
+		}
+		if event.Action() != acc.accountDeposited && event.Action() != acc.accountWithdrawn {
+			continue
+		}
+		histState, err := DecodeState(event.RawData())
+		if err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling event-data")
+		}
+		txn := &model.Transaction{
+			ID:         histState.TxnID,
+			CustomerID: custID,
+			LoadAmount: histState.TotalAmount - histBalance,
+			Time:       histState.TxnTime,
+			IsTest:     histState.IsTest,
+		}
+		histBalance = histState.TotalAmount
+		result.NumReplayed++
+
+		decline, err := acc.replayTxn(event.Action(), txn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error replaying transaction: %s", txn.ID)
+		}
+		if decline != nil {
+			result.Declined = append(result.Declined, *decline)
+		}
+	}
+
+	result.Balance = acc.balance
+	return result, nil
+}
+
+// replayTxn validates transaction against account, and
+// applies it to account if valid. Returns WhatIfDecline
+// if transaction fails validation.
+func (a *account) replayTxn(
+	action model.EventAction,
+	txn *model.Transaction,
+) (*WhatIfDecline, error) {
+	decline := func(cause TxnFailureCause, err error) *WhatIfDecline {
+		return &WhatIfDecline{
+			TxnID:      txn.ID,
+			TxnTime:    txn.Time,
+			LoadAmount: txn.LoadAmount,
+
+			Error:        err.Error(),
+			FailureCause: cause,
+		}
+	}
+
+	if _, exists := a.txnKeysRecord[a.txnKey(txn.ID, txn.Time)]; exists {
+		return decline(DuplicateTxn, errors.New("duplicate transaction")), nil
+	}
+	dailyTxnRecord, failureCause, err := a.dailyRecordWith(txn)
+	if err != nil {
+		return decline(failureCause, err), nil
+	}
+	weeklyTxnRecord, failureCause, err := a.weeklyRecordWith(txn)
+	if err != nil {
+		return decline(failureCause, err), nil
+	}
+	categoryTxnRecords := categoryRecords{}
+	if txn.Category != "" {
+		categoryTxnRecords, err = a.categoryRecordsWith(txn)
+		if err != nil {
+			return decline(CategoryLimitsExceeded, err), nil
+		}
+	}
+	state := &State{
+		TxnID:       txn.ID,
+		CustID:      txn.CustomerID,
+		TxnTime:     txn.Time,
+		IsTest:      txn.IsTest,
+		DailyTxn:    dailyTxnRecord,
+		WeeklyTxn:   weeklyTxnRecord,
+		TotalAmount: a.balance + txn.LoadAmount,
+
+		LimitsVersion: a.limits.version,
+	}
+	categoryTxnRecords.setCategoryRecords(state, txn)
+
+	// Event is only created to be applied,
+	// and is never stored or published.
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID: a.custID,
+		Action:      action,
+		Data:        state,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating event")
+	}
+	err = a.applyEvent(event)
+	return nil, errors.Wrap(err, "error applying event")
+}
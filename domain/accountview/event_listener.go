@@ -2,6 +2,9 @@ package accountview
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/validator.v2"
@@ -9,8 +12,19 @@ import (
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/projection"
 )
 
+// TxnResultProjection is the name transaction-result
+// view is registered with on projection-coordinator.
+const TxnResultProjection = "txnResultView"
+
+// RebuildCustomerReq is data for command rebuilding
+// transaction-results of a customer.
+type RebuildCustomerReq struct {
+	CustomerID string `json:"customer_id"`
+}
+
 type eventListener struct {
 	log logger.Logger
 
@@ -20,8 +34,32 @@ type eventListener struct {
 	duplicateTxn         model.EventAction
 	accountLimitExceeded model.EventAction
 	eventSubs            map[model.EventAction]<-chan interface{}
+	txnSkipped           model.EventAction
+	// Nil if skipped transactions aren't recorded
+	txnSkippedSub      <-chan model.Event
+	rebuildCustomerCmd model.CmdAction
+	// Nil if rebuilding customers isn't configured
+	rebuildCustomerSub <-chan model.Cmd
+
+	coordinator *projection.Coordinator
+	resultView  *txnResultView
 
-	resultView *txnResultView
+	bulkCatchUp bool
+	// Set once first event after start is handled
+	caughtUp bool
+	// Optional, receives results inserted by every hydration
+	onResults func(results []TxnResultEntry) error
+}
+
+// hydration is result of hydrating view on an event.
+type hydration struct {
+	// Set for bulk catch-up (see EventListenerCfg#BulkCatchUp)
+	bulk bool
+	// Number of events applied to transaction-result view
+	applied int
+	// Number of events queued on subscriptions,
+	// which were covered by this hydration.
+	coalesced int
 }
 
 // EventListenerCfg is config for event-listener.
@@ -33,20 +71,63 @@ type EventListenerCfg struct {
 	AccountWithdrawn     model.EventAction `validate:"nonzero"`
 	DuplicateTxn         model.EventAction `validate:"nonzero"`
 	AccountLimitExceeded model.EventAction `validate:"nonzero"`
+	// Optional, published by txn-creator for skipped
+	// transactions (see txn.ZeroAmountSkip), whose results
+	// are recorded as skipped. These results count towards
+	// view-repo's index, though these aren't account's
+	// events, so ResultViewCfg#Checkpoint should be set
+	// if view is resumed.
+	TxnSkipped model.EventAction
+	// Optional, rebuilds results of customer in
+	// RebuildCustomerReq. Published by operators.
+	RebuildCustomerCmd model.CmdAction
 
 	ResultViewCfg *TxnResultViewCfg `validate:"nonnil"`
+	// Optional, allows hydrating other projections
+	// with same reads from event-repo as the
+	// transaction-result view. Defaults to a
+	// coordinator only for transaction-result view,
+	// which halts on errors.
+	Coordinator *projection.Coordinator
+	// Optional, first event received after listener starts
+	// triggers a bulk catch-up, which hydrates events stored
+	// while view wasn't running (such as before a restart),
+	// along with events already queued on subscriptions,
+	// and logs number of events caught up. Later events are
+	// hydrated incrementally, once for every event.
+	BulkCatchUp bool
+	// Optional. If set, called with results inserted by every
+	// hydration once it succeeds, in order these're inserted,
+	// such as for streaming these to writer. Every result is
+	// passed once, and results of rebuilt customers aren't
+	// passed again. An error fails hydration.
+	OnResults func(results []TxnResultEntry) error
 }
 
 // InitEventListener validates event-listener
 // config and runs event-listener.
 func InitEventListener(ctx context.Context, cfg *EventListenerCfg) error {
-	err := validator.Validate(cfg)
-	if err != nil {
-		return errors.Wrap(err, "error validating config")
-	}
 	if ctx == nil {
 		return errors.New("context is nil")
 	}
+	listener, err := newEventListener(cfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Log.Infof("Starting event-listener")
+	err = listener.start(ctx)
+	return errors.Wrap(err, "listener-routine exited with error")
+}
+
+// newEventListener validates config and creates event-listener
+// subscribed to its events. Listener must be started using #start,
+// which also unsubscribes it.
+func newEventListener(cfg *EventListenerCfg) (*eventListener, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
 
 	actions := []model.EventAction{
 		cfg.AccountDeposited,
@@ -58,18 +139,50 @@ func InitEventListener(ctx context.Context, cfg *EventListenerCfg) error {
 	for _, action := range actions {
 		eventSubs[action], err = cfg.Bus.Subscribe(action.String())
 		if err != nil {
-			return errors.Wrapf(err, "error subscribing to event-bus for action: %s", action)
+			return nil, errors.Wrapf(err, "error subscribing to event-bus for action: %s", action)
+		}
+	}
+
+	var txnSkippedSub <-chan model.Event
+	if cfg.TxnSkipped != "" {
+		txnSkippedSub, err = eventutil.SubscribeEvents(cfg.Bus, cfg.TxnSkipped)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.TxnSkipped)
+		}
+	}
+
+	var rebuildCustomerSub <-chan model.Cmd
+	if cfg.RebuildCustomerCmd != "" {
+		rebuildCustomerSub, err = eventutil.SubscribeCmds(cfg.Bus, cfg.RebuildCustomerCmd)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.RebuildCustomerCmd)
 		}
 	}
 
 	resultView, err := newTxnResultView(cfg.ResultViewCfg)
 	if err != nil {
-		return errors.Wrap(err, "error creating transaction-result view")
+		return nil, errors.Wrap(err, "error creating transaction-result view")
 	}
+	resultView.recordInserted = cfg.OnResults != nil
 
-	// Create and run listener
-	cfg.Log.Infof("Starting event-listener")
-	listener := &eventListener{
+	coordinator := cfg.Coordinator
+	if coordinator == nil {
+		coordinator, err = projection.NewCoordinator(&projection.CoordinatorCfg{
+			Log:           cfg.Log,
+			EventRepo:     cfg.ResultViewCfg.EventRepo,
+			StartIndex:    resultView.lastEventIndex,
+			FailurePolicy: projection.FailurePolicyHalt,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating projection-coordinator")
+		}
+	}
+	err = coordinator.Register(TxnResultProjection, resultView.applyHydrated)
+	if err != nil {
+		return nil, errors.Wrap(err, "error registering transaction-result view")
+	}
+
+	return &eventListener{
 		log: cfg.Log,
 
 		bus:                  cfg.Bus,
@@ -78,12 +191,17 @@ func InitEventListener(ctx context.Context, cfg *EventListenerCfg) error {
 		duplicateTxn:         cfg.DuplicateTxn,
 		accountLimitExceeded: cfg.AccountLimitExceeded,
 		eventSubs:            eventSubs,
+		txnSkipped:           cfg.TxnSkipped,
+		txnSkippedSub:        txnSkippedSub,
+		rebuildCustomerCmd:   cfg.RebuildCustomerCmd,
+		rebuildCustomerSub:   rebuildCustomerSub,
 
-		resultView: resultView,
-	}
+		coordinator: coordinator,
+		resultView:  resultView,
 
-	err = listener.start(ctx)
-	return errors.Wrap(err, "listener-routine exited with error")
+		bulkCatchUp: cfg.BulkCatchUp,
+		onResults:   cfg.OnResults,
+	}, nil
 }
 
 func (el *eventListener) start(ctx context.Context) error {
@@ -99,31 +217,218 @@ func (el *eventListener) start(ctx context.Context) error {
 			}
 			return err
 
-		case <-el.eventSubs[el.accountDeposited]:
-			err := el.resultView.hydrate()
+		case _, ok := <-el.eventSubs[el.accountDeposited]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(el.accountDeposited.String())
+			}
+			_, err := el.handleEvent()
+			if err != nil {
+				return err
+			}
+		case _, ok := <-el.eventSubs[el.AccountWithdrawn]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(el.AccountWithdrawn.String())
+			}
+			_, err := el.handleEvent()
 			if err != nil {
-				return errors.Wrap(err, "error hydrating transaction-result view")
+				return err
+			}
+		case _, ok := <-el.eventSubs[el.accountLimitExceeded]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(el.accountLimitExceeded.String())
 			}
-		case <-el.eventSubs[el.AccountWithdrawn]:
-			err := el.resultView.hydrate()
+			_, err := el.handleEvent()
 			if err != nil {
-				return errors.Wrap(err, "error hydrating transaction-result view")
+				return err
 			}
-		case <-el.eventSubs[el.accountLimitExceeded]:
-			err := el.resultView.hydrate()
+		case _, ok := <-el.eventSubs[el.duplicateTxn]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(el.duplicateTxn.String())
+			}
+			_, err := el.handleEvent()
 			if err != nil {
-				return errors.Wrap(err, "error hydrating transaction-result view")
+				return err
+			}
+		case event, ok := <-el.txnSkippedSub:
+			if !ok {
+				return eventutil.SubscriptionClosedError(el.txnSkipped.String())
 			}
-		case <-el.eventSubs[el.duplicateTxn]:
-			err := el.resultView.hydrate()
+			err := el.handleSkipped(event)
 			if err != nil {
-				return errors.Wrap(err, "error hydrating transaction-result view")
+				return err
+			}
+		case cmd, ok := <-el.rebuildCustomerSub:
+			if !ok {
+				return eventutil.SubscriptionClosedError(el.rebuildCustomerCmd.String())
+			}
+			el.handleRebuildCustomerCmd(cmd)
+		}
+	}
+}
+
+// handleEvent hydrates view on receiving an event, in bulk
+// for first event after start if bulk catch-up is enabled.
+func (el *eventListener) handleEvent() (hydration, error) {
+	if !el.bulkCatchUp || el.caughtUp {
+		applied, err := el.hydrate()
+		if err == nil {
+			el.log.Tracef("Hydrated %d event(s) incrementally", applied)
+		}
+		return hydration{applied: applied}, err
+	}
+
+	// Queued events are already stored, so these
+	// are covered by hydration after draining.
+	coalesced := el.drainQueued()
+	applied, err := el.hydrate()
+	if err != nil {
+		return hydration{}, errors.Wrap(err, "error in bulk catch-up")
+	}
+	el.caughtUp = true
+	el.log.Infof(
+		"Caught up %d event(s) in bulk, covering %d queued event(s), "+
+			"hydrating incrementally from now on",
+		applied, coalesced,
+	)
+	return hydration{
+		bulk:      true,
+		applied:   applied,
+		coalesced: coalesced,
+	}, nil
+}
+
+// handleSkipped records result of skipped transaction, and
+// passes it to results-handler, if set. Account's events
+// published so far are hydrated first, so results are
+// passed in same order these're inserted.
+func (el *eventListener) handleSkipped(event model.Event) error {
+	_, err := el.hydrate()
+	if err != nil {
+		return err
+	}
+	err = el.resultView.applySkipped(event)
+	if err != nil {
+		return errors.Wrap(err, "error recording skipped transaction")
+	}
+	return el.passInserted()
+}
+
+// passInserted passes results inserted since last
+// call to results-handler, if set.
+func (el *eventListener) passInserted() error {
+	if el.onResults == nil {
+		return nil
+	}
+	results := el.resultView.takeInserted()
+	if len(results) == 0 {
+		return nil
+	}
+	err := el.onResults(results)
+	return errors.Wrap(err, "error handling hydrated results")
+}
+
+// drainQueued receives events already queued on subscriptions,
+// without waiting for more. Returns number of events received.
+func (el *eventListener) drainQueued() int {
+	drained := 0
+	for _, channel := range el.eventSubs {
+		for isQueued := true; isQueued; {
+			select {
+			case _, ok := <-channel:
+				// Closed subscriptions are handled by listener-loop
+				isQueued = ok
+				if ok {
+					drained++
+				}
+			default:
+				isQueued = false
 			}
 		}
 	}
+	return drained
+}
+
+// handleRebuildCustomerCmd rebuilds results of customer in
+// command. Errors are logged, since a failed rebuild of a
+// customer doesn't affect results of others.
+func (el *eventListener) handleRebuildCustomerCmd(cmd model.Cmd) {
+	logPrefix := fmt.Sprintf("[CMD-Action: %s]: [CMD: %s]:", cmd.Action(), cmd.ID())
+
+	req := &RebuildCustomerReq{}
+	err := json.Unmarshal(cmd.RawData(), req)
+	if err != nil {
+		el.log.Errorf("%s Error unmarshalling command-data: %s", logPrefix, err)
+		return
+	}
+	if req.CustomerID == "" {
+		el.log.Errorf("%s Customer-id is blank", logPrefix)
+		return
+	}
+
+	// Events published so far are hydrated first,
+	// so these are included in rebuilt results.
+	_, err = el.hydrate()
+	if err == nil {
+		err = el.resultView.rebuildCustomer(req.CustomerID)
+	}
+	if err != nil {
+		el.log.Errorf("%s [Customer: %s]: Error rebuilding results: %s", logPrefix, req.CustomerID, err)
+	}
+}
+
+// hydrate hydrates transaction-result view, along with any other
+// projections registered on coordinator. An isolated failure of
+// transaction-result view is returned, since its view-repo would
+// otherwise stop receiving results. Inserted results are passed
+// to results-handler, if set. Returns number of events applied
+// to transaction-result view.
+func (el *eventListener) hydrate() (int, error) {
+	prevStatus, err := el.coordinator.Status(TxnResultProjection)
+	if err != nil {
+		return 0, errors.Wrap(err, "error getting transaction-result view status")
+	}
+
+	startTime := time.Now()
+	err = el.coordinator.Hydrate()
+	el.resultView.metrics.ObserveViewHydration(time.Since(startTime))
+	// Events applied before any failure are still checkpointed
+	checkpointErr := el.resultView.saveCheckpoint()
+	if checkpointErr != nil {
+		return 0, checkpointErr
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "error hydrating transaction-result view")
+	}
+	status, err := el.coordinator.Status(TxnResultProjection)
+	if err != nil {
+		return 0, errors.Wrap(err, "error getting transaction-result view status")
+	}
+	if status.Err != nil {
+		return 0, errors.Wrap(status.Err, "error hydrating transaction-result view")
+	}
+	err = el.passInserted()
+	if err != nil {
+		return 0, err
+	}
+	return status.Applied - prevStatus.Applied, nil
 }
 
 func (el *eventListener) unsubscribe() error {
+	if el.txnSkippedSub != nil {
+		err := eventutil.UnsubscribeEvents(el.bus, el.txnSkippedSub, el.txnSkipped)
+		if err != nil {
+			return errors.Wrapf(err, "error unsubscribing from event-bus for action: %s", el.txnSkipped)
+		}
+		el.txnSkippedSub = nil
+	}
+	if el.rebuildCustomerSub != nil {
+		err := eventutil.UnsubscribeCmds(el.bus, el.rebuildCustomerSub, el.rebuildCustomerCmd)
+		if err != nil {
+			return errors.Wrapf(err, "error unsubscribing from event-bus for action: %s", el.rebuildCustomerCmd)
+		}
+		el.rebuildCustomerSub = nil
+	}
+
 	for action, channel := range el.eventSubs {
 		// Already unsubscribed
 		if channel == nil {
@@ -0,0 +1,133 @@
+package accountview
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// IndexStore persists index of a view-repo, so a restarted
+// view resumes hydration from same event-repo index instead
+// of inserting results of already processed events again.
+type IndexStore interface {
+	// Get returns last stored index, zero if none is stored.
+	Get() int
+	Set(index int) error
+}
+
+// MemoryIndexStore is an in-memory IndexStore, which survives
+// restarts of views sharing it within same process.
+// Use #NewMemoryIndexStore to create new instance.
+type MemoryIndexStore struct {
+	lock  *sync.RWMutex
+	index int
+}
+
+// NewMemoryIndexStore creates a new instance of MemoryIndexStore.
+func NewMemoryIndexStore() *MemoryIndexStore {
+	return &MemoryIndexStore{
+		lock: &sync.RWMutex{},
+	}
+}
+
+// Get returns last stored index.
+func (s *MemoryIndexStore) Get() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.index
+}
+
+// Set stores index.
+func (s *MemoryIndexStore) Set(index int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.index = index
+	return nil
+}
+
+// FileIndexStore is an IndexStore persisting index to a file.
+// Use #NewFileIndexStore to create new instance.
+type FileIndexStore struct {
+	lock  *sync.RWMutex
+	path  string
+	index int
+}
+
+// NewFileIndexStore creates a new instance of FileIndexStore,
+// loading index stored in file at path. Index is zero if file
+// doesn't exist, and file is created on first #Set.
+func NewFileIndexStore(path string) (*FileIndexStore, error) {
+	if path == "" {
+		return nil, errors.New("path is blank")
+	}
+
+	index := 0
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errors.Wrap(err, "error reading index-file")
+	default:
+		index, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing index-file")
+		}
+		if index < 0 {
+			return nil, errors.Errorf("index-file has negative index: %d", index)
+		}
+	}
+
+	return &FileIndexStore{
+		lock:  &sync.RWMutex{},
+		path:  path,
+		index: index,
+	}, nil
+}
+
+// Get returns last stored index.
+func (s *FileIndexStore) Get() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.index
+}
+
+// Set stores index to file. File is replaced by a
+// temporary file, so it's never left partially written.
+func (s *FileIndexStore) Set(index int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	dir := filepath.Dir(s.path)
+	tmpFile, err := ioutil.TempFile(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file")
+	}
+	// No-op once file is renamed
+	defer os.Remove(tmpFile.Name())
+
+	err = func() error {
+		defer tmpFile.Close()
+		_, err := tmpFile.WriteString(strconv.Itoa(index) + "\n")
+		if err != nil {
+			return errors.Wrap(err, "error writing to temporary file")
+		}
+		return errors.Wrap(tmpFile.Sync(), "error syncing temporary file")
+	}()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile.Name(), s.path)
+	if err != nil {
+		return errors.Wrap(err, "error renaming temporary file to index-file")
+	}
+	s.index = index
+	return nil
+}
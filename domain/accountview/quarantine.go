@@ -0,0 +1,74 @@
+package accountview
+
+import (
+	"sync"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Raw event-data is truncated to these many
+// bytes when stored in quarantine.
+const quarantineDataLimit = 256
+
+// QuarantinedEvent is an event skipped by transaction-result
+// view after it failed to be applied.
+type QuarantinedEvent struct {
+	EventID string
+	Action  model.EventAction
+	Error   string
+	// Truncated to 256 bytes
+	RawData string
+}
+
+// EventQuarantine records events which transaction-result view
+// failed to apply. Safe for concurrent use, so it can be shared
+// with routines reporting on quarantined events.
+// Use #NewEventQuarantine to create new instance.
+type EventQuarantine struct {
+	lock   *sync.RWMutex
+	events []QuarantinedEvent
+}
+
+// NewEventQuarantine creates a new instance of EventQuarantine.
+func NewEventQuarantine() *EventQuarantine {
+	return &EventQuarantine{
+		lock:   &sync.RWMutex{},
+		events: make([]QuarantinedEvent, 0),
+	}
+}
+
+// Add records event in quarantine, along with
+// the error it failed to be applied with.
+func (q *EventQuarantine) Add(event model.Event, err error) {
+	rawData := event.RawData()
+	if len(rawData) > quarantineDataLimit {
+		rawData = rawData[:quarantineDataLimit]
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.events = append(q.events, QuarantinedEvent{
+		EventID: event.ID(),
+		Action:  event.Action(),
+		Error:   err.Error(),
+		RawData: string(rawData),
+	})
+}
+
+// Entries returns quarantined events, in order of quarantine.
+func (q *EventQuarantine) Entries() []QuarantinedEvent {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	entries := make([]QuarantinedEvent, len(q.events))
+	copy(entries, q.events)
+	return entries
+}
+
+// Len returns number of quarantined events.
+func (q *EventQuarantine) Len() int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+
+	return len(q.events)
+}
@@ -0,0 +1,51 @@
+package accountview
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+// RebuildView wipes view-repo of config, and rebuilds it from
+// all events in config's event-repo, such as to repair a view
+// which diverged from its events. Results match those of a view
+// freshly hydrated with same config. View-repo must implement
+// ResettableTxnResultViewRepo, and checkpoint (if configured) is
+// reset along with it.
+// Results of skipped transactions (see txn.ZeroAmountSkip) aren't
+// in event-repo, so these aren't restored. View-repo shouldn't be
+// updated by an event-listener while it's being rebuilt.
+func RebuildView(cfg *TxnResultViewCfg) error {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return errors.Wrap(err, "error validating config")
+	}
+	resettableRepo, isResettable := cfg.ResultRepo.(ResettableTxnResultViewRepo)
+	if !isResettable {
+		return errors.New("view-repo can't be reset")
+	}
+
+	err = resettableRepo.Reset()
+	if err != nil {
+		return errors.Wrap(err, "error resetting view-repo")
+	}
+	if cfg.Checkpoint != nil {
+		err = cfg.Checkpoint.Set(0)
+		if err != nil {
+			return errors.Wrap(err, "error resetting checkpoint")
+		}
+	}
+
+	resultView, err := newTxnResultView(cfg)
+	if err != nil {
+		return errors.Wrap(err, "error creating transaction-result view")
+	}
+	err = resultView.hydrate()
+	if err != nil {
+		return errors.Wrap(err, "error hydrating transaction-result view")
+	}
+	cfg.Log.Infof(
+		"Rebuilt view with %d result(s) from %d event(s)",
+		cfg.ResultRepo.Index(), resultView.lastEventIndex,
+	)
+	return nil
+}
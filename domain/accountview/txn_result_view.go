@@ -2,28 +2,63 @@ package accountview
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/validator.v2"
 
+	"github.com/Jaskaranbir/es-bank-account/clock"
 	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/trace"
 )
 
 // txnResultView handles maintaining a projection of transaction-results.
 // Use #newTxnResultView to create new instance.
 type txnResultView struct {
-	log            logger.Logger
-	resultRepo     TxnResultViewRepo
-	eventRepo      eventutil.EventRepo
+	log        logger.Logger
+	resultRepo TxnResultViewRepo
+	eventRepo  eventutil.EventRepo
+	// Event-repo index of next event to hydrate. Counts
+	// every event passed by hydration, including skipped
+	// and quarantined ones, unlike view-repo's index.
 	lastEventIndex int
+	// Optional, along with last stored index
+	checkpoint      IndexStore
+	checkpointIndex int
+	metrics         metrics.Metrics
+	tracer          trace.Tracer
+
+	strictHydration bool
+	quarantine      *EventQuarantine
+	failureMessages *account.FailureMessages
+	// Optional, records processing-time of results
+	clock clock.Clock
+	// Number of events of every aggregate passed by
+	// hydration, so rebuilding an aggregate only applies
+	// events which incremental hydration won't apply again.
+	hydratedEvents map[string]int
+	// If set, results inserted by hydration are kept
+	// until taken (see #takeInserted), such as for
+	// streaming these to writer.
+	recordInserted bool
+	inserted       []TxnResultEntry
+	// Results of skipped transactions by customer, which
+	// aren't in event-repo, so these're inserted again
+	// when customer is rebuilt.
+	skipped map[string][]TxnResultEntry
 
 	accountDeposited     model.EventAction
 	accountWithdrawn     model.EventAction
 	duplicateTxn         model.EventAction
 	accountLimitExceeded model.EventAction
+	accountSeeded        model.EventAction
+	accountRecovered     model.EventAction
+	partiallyWithdrawn   model.EventAction
 }
 
 // TxnResultViewCfg defines config for txnResultView.
@@ -31,11 +66,48 @@ type TxnResultViewCfg struct {
 	Log        logger.Logger       `validate:"nonnil"`
 	ResultRepo TxnResultViewRepo   `validate:"nonnil"`
 	EventRepo  eventutil.EventRepo `validate:"nonnil"`
+	// Optional, counts transaction-results
+	// and records hydration times.
+	Metrics metrics.Metrics
+	// Optional, records span of inserting every
+	// transaction-result, keyed by event's correlation.
+	Tracer trace.Tracer
 
 	AccountDeposited     model.EventAction `validate:"nonzero"`
 	AccountWithdrawn     model.EventAction `validate:"nonzero"`
 	DuplicateTxn         model.EventAction `validate:"nonzero"`
 	AccountLimitExceeded model.EventAction `validate:"nonzero"`
+	// Optional, must be set if account's event-repo
+	// has seeded opening-balances, which are skipped.
+	AccountSeeded model.EventAction
+	// Optional, must be set if account publishes
+	// recovery-events, which are skipped.
+	AccountRecovered model.EventAction
+	// Optional, must be set if account publishes
+	// partial-withdrawal events, which are skipped.
+	PartiallyWithdrawn model.EventAction
+
+	// If set, an event which fails to be applied fails
+	// hydration. Otherwise, such events are recorded in
+	// quarantine and skipped, so hydration continues with
+	// rest of events.
+	StrictHydration bool
+	// Optional, defaults to a new quarantine.
+	// Unused if StrictHydration is set.
+	Quarantine *EventQuarantine
+	// Optional, if set, results of declined transactions
+	// include customer-friendly reason for failure.
+	FailureMessages *account.FailureMessages
+	// Optional. If set, event-repo index of hydration is
+	// stored after every hydration, and view resumes from
+	// stored index instead of view-repo's index. Results
+	// aren't restored, so view-repo should be persisted
+	// along with checkpoint.
+	Checkpoint IndexStore
+	// Optional, if set, results include time these were
+	// recorded at (see TxnResultEntry#ProcessedAt), such
+	// as for audit. Rebuilt results record time of rebuild.
+	Clock clock.Clock
 }
 
 func newTxnResultView(cfg *TxnResultViewCfg) (*txnResultView, error) {
@@ -44,71 +116,331 @@ func newTxnResultView(cfg *TxnResultViewCfg) (*txnResultView, error) {
 		return nil, errors.Wrap(err, "error validating config")
 	}
 
+	quarantine := cfg.Quarantine
+	if quarantine == nil {
+		quarantine = NewEventQuarantine()
+	}
+	lastEventIndex, err := resumeIndex(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &txnResultView{
-		log:            cfg.Log,
-		resultRepo:     cfg.ResultRepo,
-		eventRepo:      cfg.EventRepo,
-		lastEventIndex: 0,
+		log:             cfg.Log,
+		resultRepo:      cfg.ResultRepo,
+		eventRepo:       cfg.EventRepo,
+		lastEventIndex:  lastEventIndex,
+		checkpoint:      cfg.Checkpoint,
+		checkpointIndex: lastEventIndex,
+		metrics:         metrics.OrNoop(cfg.Metrics),
+		tracer:          trace.OrNoop(cfg.Tracer),
+
+		strictHydration: cfg.StrictHydration,
+		quarantine:      quarantine,
+		failureMessages: cfg.FailureMessages,
+		clock:           cfg.Clock,
+		hydratedEvents:  make(map[string]int),
+		skipped:         make(map[string][]TxnResultEntry),
 
 		accountDeposited:     cfg.AccountDeposited,
 		accountWithdrawn:     cfg.AccountWithdrawn,
 		duplicateTxn:         cfg.DuplicateTxn,
 		accountLimitExceeded: cfg.AccountLimitExceeded,
+		accountSeeded:        cfg.AccountSeeded,
+		accountRecovered:     cfg.AccountRecovered,
+		partiallyWithdrawn:   cfg.PartiallyWithdrawn,
 	}, nil
 }
 
+// resumeIndex returns event-repo index to resume hydration from,
+// which is checkpoint's index if set, else view-repo's index.
+// Index restored from a persisted store might be beyond events
+// in event-repo (such as if event-repo was reset), in which case
+// it's clamped to number of events, with a warning.
+func resumeIndex(cfg *TxnResultViewCfg) (int, error) {
+	source := "View-repo"
+	index := cfg.ResultRepo.Index()
+	if cfg.Checkpoint != nil {
+		source = "Checkpoint"
+		index = cfg.Checkpoint.Get()
+	}
+	if index == 0 {
+		return 0, nil
+	}
+	events, err := cfg.EventRepo.FetchByIndex(0)
+	if err != nil {
+		return 0, errors.Wrap(err, "error getting events from event-repo")
+	}
+	if index <= len(events) {
+		return index, nil
+	}
+
+	cfg.Log.Warnf(
+		"%s index %d exceeds %d event(s) in event-repo, resuming from last event",
+		source, index, len(events),
+	)
+	index = len(events)
+	if cfg.Checkpoint != nil {
+		err = cfg.Checkpoint.Set(index)
+		return index, errors.Wrap(err, "error resetting checkpoint")
+	}
+	resumableRepo, isResumable := cfg.ResultRepo.(ResumableTxnResultViewRepo)
+	if isResumable {
+		err = resumableRepo.ResetIndex(index)
+		if err != nil {
+			return 0, errors.Wrap(err, "error resetting view-repo index")
+		}
+	}
+	return index, nil
+}
+
 // hydrate updates transaction-result view-repo
 // with new events from eventstore.
 func (rv *txnResultView) hydrate() error {
 	// Fetch new events
 	rv.log.Tracef("Fetching events from event-repo")
-	events, err := rv.eventRepo.FetchByIndex(rv.resultRepo.Index())
+	events, err := rv.eventRepo.FetchByIndex(rv.lastEventIndex)
 	if err != nil {
-		return errors.Wrap(err, "error getting events from event-repo")
+		return errors.Wrap(eventutil.MarkFatal(err), "error getting events from event-repo")
 	}
 	rv.log.Tracef("Fetched %d event(s) from event-repo", len(events))
 
 	// Add events to view-repo
 	for _, event := range events {
-		rv.log.Tracef("[EventID: %s]: Processing event", event.ID())
-
-		switch event.Action() {
-		case rv.accountDeposited, rv.accountWithdrawn:
-			txnState := &account.State{}
-			err := json.Unmarshal(event.Data(), txnState)
-			if err != nil {
-				return errors.Wrap(err, "error unmarshalling event-data")
-			}
-			err = rv.resultRepo.Insert(TxnResultEntry{
-				ID:         txnState.TxnID,
-				CustomerID: txnState.CustID,
-				Accepted:   true,
-			})
-			if err != nil {
-				return errors.Wrap(err, "error inserting event into transaction-view repo")
+		err := rv.applyHydrated(event)
+		if err != nil {
+			// Events applied so far are still checkpointed
+			checkpointErr := rv.saveCheckpoint()
+			if checkpointErr != nil {
+				rv.log.Errorf("Error saving checkpoint: %s", checkpointErr)
 			}
+			return err
+		}
+	}
+	return rv.saveCheckpoint()
+}
 
-		case rv.duplicateTxn, rv.accountLimitExceeded:
-			txnFailure := &account.TxnFailure{}
-			err := json.Unmarshal(event.Data(), txnFailure)
-			if err != nil {
-				return errors.Wrap(err, "error unmarshalling event-data")
-			}
-			err = rv.resultRepo.Insert(TxnResultEntry{
-				ID:         txnFailure.Txn.ID,
-				CustomerID: txnFailure.Txn.CustomerID,
-				Accepted:   false,
-			})
-			if err != nil {
-				return errors.Wrap(err, "error inserting event into transaction-view repo")
-			}
+// applyHydrated applies event read by incremental hydration,
+// and counts it for its aggregate (see #rebuildCustomer).
+func (rv *txnResultView) applyHydrated(event model.Event) error {
+	entry, err := rv.applyOrQuarantine(event)
+	if err != nil {
+		return err
+	}
+	if rv.recordInserted && entry != nil {
+		rv.inserted = append(rv.inserted, *entry)
+	}
+	// Skipped and quarantined events are
+	// also passed, so these aren't retried.
+	rv.lastEventIndex++
+	rv.hydratedEvents[event.AggregateID()]++
+	return nil
+}
 
-		default:
-			return errors.New("event has invalid action")
+// takeInserted returns results inserted by hydration since
+// last call, in order these were inserted. Results inserted
+// by rebuilding customers aren't included.
+func (rv *txnResultView) takeInserted() []TxnResultEntry {
+	inserted := rv.inserted
+	rv.inserted = nil
+	return inserted
+}
+
+// saveCheckpoint stores index of hydration to
+// checkpoint, if set and index has changed.
+func (rv *txnResultView) saveCheckpoint() error {
+	if rv.checkpoint == nil || rv.lastEventIndex == rv.checkpointIndex {
+		return nil
+	}
+	err := rv.checkpoint.Set(rv.lastEventIndex)
+	if err != nil {
+		return errors.Wrap(err, "error saving checkpoint")
+	}
+	rv.checkpointIndex = rv.lastEventIndex
+	return nil
+}
+
+// rebuildCustomer removes results of customer from view-repo,
+// and applies customer's events again. Only events already
+// passed by incremental hydration are applied, since later
+// events are applied once hydration reaches these, so results
+// aren't counted twice. Results of other customers, and
+// incremental hydration, are left undisturbed.
+func (rv *txnResultView) rebuildCustomer(custID string) error {
+	events, err := rv.eventRepo.Fetch(custID)
+	if err != nil {
+		return errors.Wrap(eventutil.MarkFatal(err), "error fetching events of customer from event-repo")
+	}
+	numHydrated := rv.hydratedEvents[custID]
+	if numHydrated > len(events) {
+		return errors.Errorf(
+			"customer has %d event(s) in event-repo, but %d were hydrated",
+			len(events), numHydrated,
+		)
+	}
+
+	err = rv.resultRepo.RemoveCustomer(custID)
+	if err != nil {
+		return errors.Wrap(err, "error removing results of customer")
+	}
+	for _, event := range events[:numHydrated] {
+		// Events failing to apply were already quarantined
+		// by hydration, so these are only skipped again.
+		_, err := rv.apply(event)
+		if err != nil {
+			if rv.strictHydration {
+				return err
+			}
+			rv.log.Warnf("[EventID: %s]: Skipped event while rebuilding: %s", event.ID(), err)
+		}
+	}
+	for _, entry := range rv.skipped[custID] {
+		err = rv.resultRepo.Insert(entry)
+		if err != nil {
+			return errors.Wrap(eventutil.MarkFatal(err), "error inserting result of skipped transaction")
 		}
+	}
+	rv.log.Infof("[Customer: %s]: Rebuilt results from %d event(s)", custID, numHydrated)
+	return nil
+}
 
-		rv.log.Tracef("[EventID: %s]: Processed event", event.ID())
+// applySkipped adds result of transaction skipped by txn-creator,
+// from data of its TxnSkipped event, to view-repo. Unlike results
+// of account's events, it's recorded once it's received.
+func (rv *txnResultView) applySkipped(event model.Event) error {
+	skip := &txn.TxnSkip{}
+	err := json.Unmarshal(event.RawData(), skip)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling event-data")
+	}
+	if skip.Txn == nil {
+		return errors.New("event has no transaction")
 	}
 
+	entry := TxnResultEntry{
+		ID:         skip.Txn.ID,
+		CustomerID: skip.Txn.CustomerID,
+		Skipped:    true,
+		IsTest:     skip.Txn.IsTest,
+		InputSeq:   skip.Txn.InputSeq,
+
+		ProcessedAt: rv.processedAt(),
+	}
+	err = rv.resultRepo.Insert(entry)
+	if err != nil {
+		return errors.Wrap(eventutil.MarkFatal(err), "error inserting skipped transaction into transaction-view repo")
+	}
+	rv.metrics.IncTxnResults(metrics.ResultSkipped)
+	rv.skipped[entry.CustomerID] = append(rv.skipped[entry.CustomerID], entry)
+	if rv.recordInserted {
+		rv.inserted = append(rv.inserted, entry)
+	}
+	rv.log.Tracef("[EventID: %s]: Recorded skipped transaction", event.ID())
 	return nil
 }
+
+// applyOrQuarantine applies event to view-repo, and returns
+// inserted result (see #apply). If event fails to be applied,
+// it is quarantined instead, unless strict-hydration is enabled.
+func (rv *txnResultView) applyOrQuarantine(event model.Event) (*TxnResultEntry, error) {
+	entry, err := rv.apply(event)
+	if err == nil || rv.strictHydration {
+		return entry, err
+	}
+	rv.log.Errorf("[EventID: %s]: Quarantined event: %s", event.ID(), err)
+	rv.quarantine.Add(event, err)
+	return nil, nil
+}
+
+// Quarantined returns events which were skipped
+// after these failed to be applied.
+func (rv *txnResultView) Quarantined() []QuarantinedEvent {
+	return rv.quarantine.Entries()
+}
+
+// processedAt returns current time to record with
+// results, or zero time if view has no clock.
+func (rv *txnResultView) processedAt() time.Time {
+	if rv.clock == nil {
+		return time.Time{}
+	}
+	return rv.clock.Now()
+}
+
+// apply adds result of transaction in event to transaction-result
+// view-repo, and returns inserted result, or nil if event is skipped.
+func (rv *txnResultView) apply(event model.Event) (*TxnResultEntry, error) {
+	rv.log.Tracef("[EventID: %s]: Processing event", event.ID())
+
+	// Opening-balances aren't transactions
+	if rv.accountSeeded != "" && event.Action() == rv.accountSeeded {
+		rv.log.Tracef("[EventID: %s]: Skipped opening-balance event", event.ID())
+		return nil, nil
+	}
+	// Recovery accompanies transaction's own success-event
+	if rv.accountRecovered != "" && event.Action() == rv.accountRecovered {
+		rv.log.Tracef("[EventID: %s]: Skipped account-recovery event", event.ID())
+		return nil, nil
+	}
+	// As is partial-withdrawal
+	if rv.partiallyWithdrawn != "" && event.Action() == rv.partiallyWithdrawn {
+		rv.log.Tracef("[EventID: %s]: Skipped partial-withdrawal event", event.ID())
+		return nil, nil
+	}
+	span := rv.tracer.StartSpan(trace.SpanViewInsert, event.CorrelationKey())
+	defer span.End()
+
+	var entry TxnResultEntry
+	switch event.Action() {
+	case rv.accountDeposited, rv.accountWithdrawn:
+		txnState, err := account.DecodeState(event.RawData())
+		if err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling event-data")
+		}
+		entry = TxnResultEntry{
+			ID:         txnState.TxnID,
+			CustomerID: txnState.CustID,
+			Accepted:   true,
+			IsTest:     txnState.IsTest,
+			InputSeq:   txnState.InputSeq,
+
+			ProcessedAt: rv.processedAt(),
+		}
+		err = rv.resultRepo.Insert(entry)
+		if err != nil {
+			return nil, errors.Wrap(eventutil.MarkFatal(err), "error inserting event into transaction-view repo")
+		}
+		rv.metrics.IncTxnResults(metrics.ResultAccepted)
+
+	case rv.duplicateTxn, rv.accountLimitExceeded:
+		txnFailure := &account.TxnFailure{}
+		err := json.Unmarshal(event.RawData(), txnFailure)
+		if err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling event-data")
+		}
+		entry = TxnResultEntry{
+			ID:         txnFailure.Txn.ID,
+			CustomerID: txnFailure.Txn.CustomerID,
+			Accepted:   false,
+			IsTest:     txnFailure.Txn.IsTest,
+			InputSeq:   txnFailure.Txn.InputSeq,
+
+			FailureCause: txnFailure.FailureCause,
+			ProcessedAt:  rv.processedAt(),
+		}
+		if rv.failureMessages != nil {
+			entry.Reason = rv.failureMessages.Message(txnFailure.FailureCause)
+		}
+		err = rv.resultRepo.Insert(entry)
+		if err != nil {
+			return nil, errors.Wrap(eventutil.MarkFatal(err), "error inserting event into transaction-view repo")
+		}
+		rv.metrics.IncTxnResults(metrics.ResultDeclined)
+
+	default:
+		return nil, errors.New("event has invalid action")
+	}
+
+	rv.log.Tracef("[EventID: %s]: Processed event", event.ID())
+	return &entry, nil
+}
@@ -2,25 +2,104 @@ package accountview
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
 )
 
+// TestTxnsSectionMarker is the line preceding results of
+// test-transactions in serialized results, if these are
+// excluded (see MemoryTxnResultViewRepoCfg#ExcludeTestTxns).
+// Results are JSON-objects, so these never match the marker.
+// Use #SplitSerialized to separate the sections.
+const TestTxnsSectionMarker = "# test-transactions"
+
 // TxnResultViewRepo handles storing/retrieving transaction-results.
 type TxnResultViewRepo interface {
 	Insert(result TxnResultEntry) error
+	// RemoveCustomer removes all results of customer, keeping
+	// order of other results. Index is reduced by number of
+	// removed results, so it's restored once the customer's
+	// results are inserted again (such as when rebuilding).
+	RemoveCustomer(custID string) error
 	Serialized() string
 	Index() int
 }
 
+// CustomerTxnResultViewRepo is a TxnResultViewRepo
+// which also provides results grouped by customer.
+type CustomerTxnResultViewRepo interface {
+	TxnResultViewRepo
+	ByCustomer() map[string][]TxnResultEntry
+	// CustomerResults returns results of a single
+	// customer, in order these were inserted.
+	CustomerResults(custID string) []TxnResultEntry
+}
+
+// SequencedTxnResultViewRepo is a TxnResultViewRepo which
+// also provides results by input-sequence of transactions.
+type SequencedTxnResultViewRepo interface {
+	TxnResultViewRepo
+	Entries() []TxnResultEntry
+	// Same as #Serialized, with results ordered by
+	// input-sequence instead of insertion-order.
+	SerializedInInputOrder() string
+}
+
+// CountingTxnResultViewRepo is a TxnResultViewRepo which
+// also provides number of accepted/declined results.
+type CountingTxnResultViewRepo interface {
+	TxnResultViewRepo
+	Counts() TxnResultCounts
+}
+
+// ResumableTxnResultViewRepo is a TxnResultViewRepo whose
+// index can be reset, such as when its persisted index is
+// beyond events in event-repo.
+type ResumableTxnResultViewRepo interface {
+	TxnResultViewRepo
+	ResetIndex(index int) error
+}
+
+// ResettableTxnResultViewRepo is a TxnResultViewRepo
+// which can be wiped, such as for rebuilding it from
+// events (see RebuildView).
+type ResettableTxnResultViewRepo interface {
+	TxnResultViewRepo
+	// Reset removes all results, and resets index to zero.
+	Reset() error
+}
+
 // MemoryTxnResultViewRepo is an in-memory TxnResultViewRepo.
 // Use #NewMemoryTxnResultViewRepo to create new instance.
 type MemoryTxnResultViewRepo struct {
-	lock            *sync.RWMutex
-	serializedIndex []byte
-	index           int
+	lock                *sync.RWMutex
+	excludeTestTxns     bool
+	serializedIndex     []byte
+	serializedTestIndex []byte
+	entries             []TxnResultEntry
+	counts              TxnResultCounts
+	index               int
+	indexStore          IndexStore
+}
+
+// MemoryTxnResultViewRepoCfg is config for MemoryTxnResultViewRepo.
+type MemoryTxnResultViewRepoCfg struct {
+	// Moves test-transactions into a separate section
+	// of serialized results, and excludes them from
+	// accepted/declined counts.
+	ExcludeTestTxns bool
+	// Optional. If set, index is restored from store on
+	// creation, and stored on every insert, so a restarted
+	// view doesn't insert results of processed events again.
+	// Results inserted before restart aren't restored.
+	IndexStore IndexStore
 }
 
 // TxnResultEntry reprents a record in TransactionResultViewRepo.
@@ -28,14 +107,83 @@ type TxnResultEntry struct {
 	ID         string `json:"id"`
 	CustomerID string `json:"customer_id"`
 	Accepted   bool   `json:"accepted"`
+	// Set for transactions skipped by txn-creator
+	// (see txn.ZeroAmountSkip), which aren't accepted.
+	Skipped bool `json:"skipped,omitempty"`
+	IsTest  bool `json:"is_test,omitempty"`
+	// Customer-friendly reason for declined transactions,
+	// only set if result-view has failure-messages.
+	Reason string `json:"reason,omitempty"`
+	// Sequence-number of input-record transaction was created
+	// from, zero if unknown. Not serialized, so reports stay
+	// same regardless of order these are written in.
+	InputSeq uint64 `json:"-"`
+	// Failure-cause of declined transactions, blank for
+	// generic failures. Not serialized, since Reason is
+	// the customer-friendly form.
+	FailureCause account.TxnFailureCause `json:"-"`
+	// Time view recorded result at, only set if result-view
+	// has a clock. Omitted from serialized result if zero.
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// MarshalJSON marshals result, omitting ProcessedAt if zero.
+func (e TxnResultEntry) MarshalJSON() ([]byte, error) {
+	// Alias drops this method, so marshalling doesn't recurse
+	type entryAlias TxnResultEntry
+	var processedAt *time.Time
+	if !e.ProcessedAt.IsZero() {
+		processedAt = &e.ProcessedAt
+	}
+	return json.Marshal(&struct {
+		entryAlias
+		ProcessedAt *time.Time `json:"processed_at,omitempty"`
+	}{
+		entryAlias:  entryAlias(e),
+		ProcessedAt: processedAt,
+	})
+}
+
+// TxnResultCounts is number of accepted/declined
+// transactions recorded in view-repo.
+type TxnResultCounts struct {
+	Accepted int
+	Declined int
+	// Skipped transactions, which aren't counted
+	// as declined (or as test-transactions).
+	Skipped int
+	// Declined transactions by failure-cause, with
+	// same exclusions as Declined. Generic failures
+	// are counted under blank cause. Nil if none
+	// are declined.
+	DeclinedByCause map[account.TxnFailureCause]int
+	// Test-transactions are always counted here,
+	// regardless of being excluded from above counts.
+	TestAccepted int
+	TestDeclined int
 }
 
 // NewMemoryTxnResultViewRepo creates a new instance of MemoryTxnResultViewRepo.
-func NewMemoryTxnResultViewRepo() *MemoryTxnResultViewRepo {
+func NewMemoryTxnResultViewRepo(cfg MemoryTxnResultViewRepoCfg) *MemoryTxnResultViewRepo {
+	index := 0
+	if cfg.IndexStore != nil {
+		index = cfg.IndexStore.Get()
+	}
 	return &MemoryTxnResultViewRepo{
-		lock:            &sync.RWMutex{},
-		serializedIndex: make([]byte, 0),
-		index:           0,
+		lock:                &sync.RWMutex{},
+		excludeTestTxns:     cfg.ExcludeTestTxns,
+		serializedIndex:     make([]byte, 0),
+		serializedTestIndex: make([]byte, 0),
+		entries:             make([]TxnResultEntry, 0),
+		counts:              newTxnResultCounts(),
+		index:               index,
+		indexStore:          cfg.IndexStore,
+	}
+}
+
+func newTxnResultCounts() TxnResultCounts {
+	return TxnResultCounts{
+		DeclinedByCause: make(map[account.TxnFailureCause]int),
 	}
 }
 
@@ -49,20 +197,133 @@ func (rv *MemoryTxnResultViewRepo) Insert(result TxnResultEntry) error {
 	rv.lock.Lock()
 	defer rv.lock.Unlock()
 
+	// Stored first, so result isn't inserted again after
+	// restart. Index is reduced while results of a customer
+	// are rebuilt, and only stored once it's restored, so
+	// stored index never regresses.
+	if rv.indexStore != nil && rv.index+1 > rv.indexStore.Get() {
+		err := rv.indexStore.Set(rv.index + 1)
+		if err != nil {
+			return errors.Wrap(err, "error storing index")
+		}
+	}
+	rv.insert(result, resultBytes)
+	rv.entries = append(rv.entries, result)
+	rv.index++
+	return nil
+}
+
+// insert adds result to counts and serialized results.
+// Caller must hold write-lock.
+func (rv *MemoryTxnResultViewRepo) insert(result TxnResultEntry, resultBytes []byte) {
+	isExcluded := rv.excludeTestTxns && result.IsTest
+	if result.IsTest && !result.Skipped {
+		if result.Accepted {
+			rv.counts.TestAccepted++
+		} else {
+			rv.counts.TestDeclined++
+		}
+	}
+	if !isExcluded {
+		switch {
+		case result.Accepted:
+			rv.counts.Accepted++
+		case result.Skipped:
+			rv.counts.Skipped++
+		default:
+			rv.counts.Declined++
+			rv.counts.DeclinedByCause[result.FailureCause]++
+		}
+	}
+
 	// Change here if valid JSON is required
 	// instead of custom serialized-string.
-	rv.serializedIndex = append(rv.serializedIndex, resultBytes...)
-	rv.serializedIndex = append(rv.serializedIndex, []byte("\n")...)
-	rv.index++
+	if isExcluded {
+		rv.serializedTestIndex = append(rv.serializedTestIndex, resultBytes...)
+		rv.serializedTestIndex = append(rv.serializedTestIndex, []byte("\n")...)
+	} else {
+		rv.serializedIndex = append(rv.serializedIndex, resultBytes...)
+		rv.serializedIndex = append(rv.serializedIndex, []byte("\n")...)
+	}
+}
+
+// RemoveCustomer removes results of customer, and rebuilds
+// counts and serialized results from remaining results.
+func (rv *MemoryTxnResultViewRepo) RemoveCustomer(custID string) error {
+	rv.lock.Lock()
+	defer rv.lock.Unlock()
+
+	entries := make([]TxnResultEntry, 0, len(rv.entries))
+	for _, entry := range rv.entries {
+		if entry.CustomerID != custID {
+			entries = append(entries, entry)
+		}
+	}
+	numRemoved := len(rv.entries) - len(entries)
+	if numRemoved == 0 {
+		return nil
+	}
+
+	rv.serializedIndex = make([]byte, 0)
+	rv.serializedTestIndex = make([]byte, 0)
+	rv.counts = newTxnResultCounts()
+	for _, entry := range entries {
+		resultBytes, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, "error marshalling result to json")
+		}
+		rv.insert(entry, resultBytes)
+	}
+	rv.entries = entries
+	rv.index -= numRemoved
 	return nil
 }
 
 // Serialized returns all results in a pre-defined serialized-format.
+// If test-transactions are excluded, these are appended as a separate
+// section, preceded by TestTxnsSectionMarker line.
 func (rv *MemoryTxnResultViewRepo) Serialized() string {
 	rv.lock.RLock()
 	defer rv.lock.RUnlock()
 
-	results := string(rv.serializedIndex)
+	return joinSerialized(rv.serializedIndex, rv.serializedTestIndex)
+}
+
+// SerializedInInputOrder returns results same as #Serialized,
+// ordered by input-sequence of transactions. Results without
+// input-sequence are placed last, in order these were inserted.
+func (rv *MemoryTxnResultViewRepo) SerializedInInputOrder() string {
+	entries := rv.Entries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].InputSeq, entries[j].InputSeq
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+
+	serialized := make([]byte, 0)
+	serializedTest := make([]byte, 0)
+	for _, entry := range entries {
+		// Already marshalled on insert, so can't fail
+		entryBytes, _ := json.Marshal(entry)
+		entryBytes = append(entryBytes, '\n')
+		if rv.excludeTestTxns && entry.IsTest {
+			serializedTest = append(serializedTest, entryBytes...)
+		} else {
+			serialized = append(serialized, entryBytes...)
+		}
+	}
+	return joinSerialized(serialized, serializedTest)
+}
+
+// joinSerialized joins newline-terminated results,
+// with test-results as a separate section.
+func joinSerialized(serialized []byte, serializedTest []byte) string {
+	results := string(serialized)
+	if len(serializedTest) > 0 {
+		results = fmt.Sprintf("%s%s\n%s", results, TestTxnsSectionMarker, serializedTest)
+	}
 	if len(results) > 0 && strings.HasSuffix(results, "\n") {
 		// Remove last newline char
 		results = results[:len(results)-1]
@@ -70,6 +331,113 @@ func (rv *MemoryTxnResultViewRepo) Serialized() string {
 	return results
 }
 
+// SplitSerialized splits serialized results (see #Serialized)
+// into results and results of test-transactions, which is
+// blank if serialized results have no test-section.
+func SplitSerialized(serialized string) (string, string) {
+	marker := TestTxnsSectionMarker + "\n"
+	if strings.HasPrefix(serialized, marker) {
+		return "", serialized[len(marker):]
+	}
+	markerIndex := strings.Index(serialized, "\n"+marker)
+	if markerIndex < 0 {
+		return serialized, ""
+	}
+	return serialized[:markerIndex], serialized[markerIndex+1+len(marker):]
+}
+
+// Entries returns all results, in order these were
+// inserted. Includes test-transactions, even if
+// these are excluded from serialized results.
+func (rv *MemoryTxnResultViewRepo) Entries() []TxnResultEntry {
+	rv.lock.RLock()
+	defer rv.lock.RUnlock()
+
+	entries := make([]TxnResultEntry, len(rv.entries))
+	copy(entries, rv.entries)
+	return entries
+}
+
+// ByCustomer returns results grouped by customer-id,
+// each in order these were inserted.
+func (rv *MemoryTxnResultViewRepo) ByCustomer() map[string][]TxnResultEntry {
+	rv.lock.RLock()
+	defer rv.lock.RUnlock()
+
+	byCustomer := make(map[string][]TxnResultEntry)
+	for _, entry := range rv.entries {
+		byCustomer[entry.CustomerID] = append(byCustomer[entry.CustomerID], entry)
+	}
+	return byCustomer
+}
+
+// CustomerResults returns results of customer,
+// in order these were inserted.
+func (rv *MemoryTxnResultViewRepo) CustomerResults(custID string) []TxnResultEntry {
+	rv.lock.RLock()
+	defer rv.lock.RUnlock()
+
+	results := make([]TxnResultEntry, 0)
+	for _, entry := range rv.entries {
+		if entry.CustomerID == custID {
+			results = append(results, entry)
+		}
+	}
+	return results
+}
+
+// Counts returns number of accepted/declined transactions.
+func (rv *MemoryTxnResultViewRepo) Counts() TxnResultCounts {
+	rv.lock.RLock()
+	defer rv.lock.RUnlock()
+
+	counts := rv.counts
+	counts.DeclinedByCause = nil
+	if len(rv.counts.DeclinedByCause) > 0 {
+		counts.DeclinedByCause = make(map[account.TxnFailureCause]int, len(rv.counts.DeclinedByCause))
+		for cause, count := range rv.counts.DeclinedByCause {
+			counts.DeclinedByCause[cause] = count
+		}
+	}
+	return counts
+}
+
+// ResetIndex sets index, and stores it if repo has an IndexStore.
+// Unlike inserts, stored index is reduced if index is lower.
+func (rv *MemoryTxnResultViewRepo) ResetIndex(index int) error {
+	rv.lock.Lock()
+	defer rv.lock.Unlock()
+
+	if rv.indexStore != nil {
+		err := rv.indexStore.Set(index)
+		if err != nil {
+			return errors.Wrap(err, "error storing index")
+		}
+	}
+	rv.index = index
+	return nil
+}
+
+// Reset removes all results and resets index to zero,
+// along with stored index if repo has an IndexStore.
+func (rv *MemoryTxnResultViewRepo) Reset() error {
+	rv.lock.Lock()
+	defer rv.lock.Unlock()
+
+	if rv.indexStore != nil {
+		err := rv.indexStore.Set(0)
+		if err != nil {
+			return errors.Wrap(err, "error storing index")
+		}
+	}
+	rv.serializedIndex = make([]byte, 0)
+	rv.serializedTestIndex = make([]byte, 0)
+	rv.entries = make([]TxnResultEntry, 0)
+	rv.counts = newTxnResultCounts()
+	rv.index = 0
+	return nil
+}
+
 // Index returns event-repo index of last event processed by repo.
 func (rv *MemoryTxnResultViewRepo) Index() int {
 	rv.lock.RLock()
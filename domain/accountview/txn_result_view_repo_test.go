@@ -0,0 +1,148 @@
+package accountview_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+func TestMemoryTxnResultViewRepoConformance(t *testing.T) {
+	for _, excludeTestTxns := range []bool{false, true} {
+		testsupport.TxnResultViewRepoSuite(t, func() accountview.TxnResultViewRepo {
+			return accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{
+				ExcludeTestTxns: excludeTestTxns,
+			})
+		})
+	}
+}
+
+func TestMemoryTxnResultViewRepoByCustomer(t *testing.T) {
+	repo := accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{
+		ExcludeTestTxns: true,
+	})
+	results := []accountview.TxnResultEntry{
+		{ID: "1", CustomerID: "1", Accepted: true},
+		{ID: "2", CustomerID: "2", Accepted: false},
+		{ID: "3", CustomerID: "1", Accepted: false, IsTest: true},
+	}
+	for _, result := range results {
+		if err := repo.Insert(result); err != nil {
+			t.Fatalf("error inserting result: %s", err)
+		}
+	}
+
+	if entries := repo.Entries(); !reflect.DeepEqual(entries, results) {
+		t.Fatalf("expected entries: %+v, got: %+v", results, entries)
+	}
+	expected := map[string][]accountview.TxnResultEntry{
+		"1": {results[0], results[2]},
+		"2": {results[1]},
+	}
+	if byCustomer := repo.ByCustomer(); !reflect.DeepEqual(byCustomer, expected) {
+		t.Fatalf("expected results by customer: %+v, got: %+v", expected, byCustomer)
+	}
+}
+
+func TestMemoryTxnResultViewRepoSerializedInInputOrder(t *testing.T) {
+	repo := accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{
+		ExcludeTestTxns: true,
+	})
+	results := []accountview.TxnResultEntry{
+		{ID: "3", CustomerID: "1", Accepted: true, InputSeq: 3},
+		{ID: "x", CustomerID: "1", Accepted: true},
+		{ID: "1", CustomerID: "2", Accepted: false, InputSeq: 1},
+		{ID: "4", CustomerID: "1", Accepted: true, IsTest: true, InputSeq: 4},
+		{ID: "2", CustomerID: "1", Accepted: true, InputSeq: 2},
+	}
+	for _, result := range results {
+		if err := repo.Insert(result); err != nil {
+			t.Fatalf("error inserting result: %s", err)
+		}
+	}
+
+	expected := `{"id":"1","customer_id":"2","accepted":false}
+{"id":"2","customer_id":"1","accepted":true}
+{"id":"3","customer_id":"1","accepted":true}
+{"id":"x","customer_id":"1","accepted":true}
+# test-transactions
+{"id":"4","customer_id":"1","accepted":true,"is_test":true}`
+	if serialized := repo.SerializedInInputOrder(); serialized != expected {
+		t.Fatalf("expected serialized results:\n%s\ngot:\n%s", expected, serialized)
+	}
+}
+
+func TestMemoryTxnResultViewRepoReset(t *testing.T) {
+	indexStore := accountview.NewMemoryIndexStore()
+	repo := accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{
+		IndexStore: indexStore,
+	})
+	for _, result := range []accountview.TxnResultEntry{
+		{ID: "1", CustomerID: "1", Accepted: true},
+		{ID: "2", CustomerID: "2", Accepted: false},
+	} {
+		if err := repo.Insert(result); err != nil {
+			t.Fatalf("error inserting result: %s", err)
+		}
+	}
+
+	if err := repo.Reset(); err != nil {
+		t.Fatalf("error resetting repo: %s", err)
+	}
+	if repo.Index() != 0 || indexStore.Get() != 0 {
+		t.Fatalf("expected index 0, got %d (stored: %d)", repo.Index(), indexStore.Get())
+	}
+	if serialized := repo.Serialized(); serialized != "" {
+		t.Fatalf("expected no serialized results, got: %q", serialized)
+	}
+	if counts := repo.Counts(); counts.Accepted != 0 || counts.Declined != 0 {
+		t.Fatalf("expected no counts, got: %+v", counts)
+	}
+
+	result := accountview.TxnResultEntry{ID: "3", CustomerID: "1", Accepted: true}
+	if err := repo.Insert(result); err != nil {
+		t.Fatalf("error inserting result: %s", err)
+	}
+	if entries := repo.Entries(); !reflect.DeepEqual(entries, []accountview.TxnResultEntry{result}) {
+		t.Fatalf("expected only result inserted after reset, got: %+v", entries)
+	}
+}
+
+func TestMemoryTxnResultViewRepoSplitSerialized(t *testing.T) {
+	testResult := accountview.TxnResultEntry{ID: "2", CustomerID: "1", Accepted: true, IsTest: true}
+	result := accountview.TxnResultEntry{ID: "1", CustomerID: "1", Accepted: true}
+	serTestResult := `{"id":"2","customer_id":"1","accepted":true,"is_test":true}`
+	serResult := `{"id":"1","customer_id":"1","accepted":true}`
+
+	testCases := []struct {
+		name         string
+		results      []accountview.TxnResultEntry
+		expected     string
+		expectedTest string
+	}{
+		{"without test-results", []accountview.TxnResultEntry{result}, serResult, ""},
+		{"with only test-results", []accountview.TxnResultEntry{testResult}, "", serTestResult},
+		{"with both", []accountview.TxnResultEntry{testResult, result}, serResult, serTestResult},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{
+				ExcludeTestTxns: true,
+			})
+			for _, result := range testCase.results {
+				if err := repo.Insert(result); err != nil {
+					t.Fatalf("error inserting result: %s", err)
+				}
+			}
+
+			serialized, serializedTest := accountview.SplitSerialized(repo.Serialized())
+			if serialized != testCase.expected {
+				t.Fatalf("expected results: %q, got: %q", testCase.expected, serialized)
+			}
+			if serializedTest != testCase.expectedTest {
+				t.Fatalf("expected test-results: %q, got: %q", testCase.expectedTest, serializedTest)
+			}
+		})
+	}
+}
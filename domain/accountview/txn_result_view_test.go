@@ -1,12 +1,17 @@
 package accountview
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/Jaskaranbir/es-bank-account/clock"
 	"github.com/Jaskaranbir/es-bank-account/domain/account"
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
@@ -72,12 +77,14 @@ var _ = Describe("TxnResultView", func() {
 				ID:         v.TxnID,
 				CustomerID: v.CustID,
 				Accepted:   true,
+				IsTest:     v.IsTest,
 			}
 		case *account.TxnFailure:
 			data = TxnResultEntry{
 				ID:         v.Txn.ID,
 				CustomerID: v.Txn.CustomerID,
 				Accepted:   false,
+				IsTest:     v.Txn.IsTest,
 			}
 		default:
 			return "", errors.New("received result-data of unknown type")
@@ -95,7 +102,7 @@ var _ = Describe("TxnResultView", func() {
 		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
 		Expect(err).ToNot(HaveOccurred())
 
-		resultViewRepo := NewMemoryTxnResultViewRepo()
+		resultViewRepo := NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{})
 		eventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
 			Bus:            bus,
 			EventStore:     eventutil.NewMemoryEventStore(),
@@ -194,4 +201,676 @@ var _ = Describe("TxnResultView", func() {
 			Expect(resultRepo.Serialized()).To(Equal(serResultView))
 		})
 	})
+
+	Context("test-transactions are excluded", func() {
+		BeforeEach(func() {
+			var err error
+			resultViewCfg.ResultRepo = NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{
+				ExcludeTestTxns: true,
+			})
+			resultView, err = newTxnResultView(resultViewCfg)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("records test-transactions in separate section", func() {
+			resultRepo := resultViewCfg.ResultRepo.(*MemoryTxnResultViewRepo)
+
+			testState := &account.State{
+				TxnID:   "1",
+				CustID:  "1",
+				TxnTime: time.Now(),
+				IsTest:  true,
+			}
+			serTestView, err := hydrateAndMarshal(testState, AccountDeposited)
+			Expect(err).ToNot(HaveOccurred())
+
+			state := &account.State{
+				TxnID:   "2",
+				CustID:  "1",
+				TxnTime: time.Now(),
+			}
+			serView, err := hydrateAndMarshal(state, AccountDeposited)
+			Expect(err).ToNot(HaveOccurred())
+
+			testFailure := &account.TxnFailure{
+				Txn: model.Transaction{
+					ID:         "3",
+					CustomerID: "1",
+					LoadAmount: 100,
+					Time:       time.Now(),
+					IsTest:     true,
+				},
+				Error:        "dummy-error",
+				FailureCause: account.DailyLimitsExceeded,
+			}
+			serTestFailureView, err := hydrateAndMarshal(testFailure, AccountLimitExceeded)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resultRepo.Serialized()).To(Equal(fmt.Sprintf(
+				"%s\n%s\n%s\n%s", serView, TestTxnsSectionMarker, serTestView, serTestFailureView,
+			)))
+			Expect(resultRepo.Counts()).To(Equal(TxnResultCounts{
+				Accepted:     1,
+				Declined:     0,
+				TestAccepted: 1,
+				TestDeclined: 1,
+			}))
+		})
+	})
+
+	Context("failure-messages are configured", func() {
+		BeforeEach(func() {
+			var err error
+			resultViewCfg.FailureMessages = account.DefaultFailureMessages()
+			resultView, err = newTxnResultView(resultViewCfg)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("includes reason with declined results", func() {
+			resultRepo := resultViewCfg.ResultRepo
+
+			serView, err := hydrateAndMarshal(&account.State{TxnID: "1", CustID: "1"}, AccountDeposited)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultRepo.Serialized()).To(Equal(serView))
+
+			failure := &account.TxnFailure{
+				Txn: model.Transaction{
+					ID:         "2",
+					CustomerID: "1",
+					LoadAmount: 6000,
+					Time:       time.Now(),
+				},
+				Error:        "dummy-error",
+				FailureCause: account.DailyLimitsExceeded,
+			}
+			_, err = hydrateAndMarshal(failure, AccountLimitExceeded)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultRepo.Serialized()).To(Equal(fmt.Sprintf(
+				"%s\n%s",
+				serView,
+				`{"id":"2","customer_id":"1","accepted":false,`+
+					`"reason":"This transaction exceeds your daily load limit."}`,
+			)))
+		})
+	})
+
+	Context("clock is configured", func() {
+		processedAt := time.Date(2000, 1, 1, 10, 0, 0, 0, time.UTC)
+
+		BeforeEach(func() {
+			var err error
+			resultViewCfg.Clock = clock.NewFakeClock(processedAt)
+			resultView, err = newTxnResultView(resultViewCfg)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("includes processing-time with results", func() {
+			resultRepo := resultViewCfg.ResultRepo.(*MemoryTxnResultViewRepo)
+
+			_, err := hydrateAndMarshal(&account.State{TxnID: "1", CustID: "1"}, AccountDeposited)
+			Expect(err).ToNot(HaveOccurred())
+			failure := &account.TxnFailure{
+				Txn: model.Transaction{
+					ID:         "2",
+					CustomerID: "1",
+					LoadAmount: 6000,
+					Time:       time.Now(),
+				},
+				Error: "dummy-error",
+			}
+			_, err = hydrateAndMarshal(failure, AccountLimitExceeded)
+			Expect(err).ToNot(HaveOccurred())
+
+			entries := resultRepo.Entries()
+			Expect(entries).To(HaveLen(2))
+			for _, entry := range entries {
+				Expect(entry.ProcessedAt).To(Equal(processedAt))
+			}
+			Expect(resultRepo.Serialized()).To(Equal(
+				`{"id":"1","customer_id":"1","accepted":true,"processed_at":"2000-01-01T10:00:00Z"}` + "\n" +
+					`{"id":"2","customer_id":"1","accepted":false,"processed_at":"2000-01-01T10:00:00Z"}`,
+			))
+		})
+
+		It("omits processing-time from results without clock", func() {
+			var err error
+			resultViewCfg.Clock = nil
+			resultView, err = newTxnResultView(resultViewCfg)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = hydrateAndMarshal(&account.State{TxnID: "1", CustID: "1"}, AccountDeposited)
+			Expect(err).ToNot(HaveOccurred())
+			resultRepo := resultViewCfg.ResultRepo.(*MemoryTxnResultViewRepo)
+			Expect(resultRepo.Entries()[0].ProcessedAt.IsZero()).To(BeTrue())
+			Expect(resultRepo.Serialized()).To(Equal(`{"id":"1","customer_id":"1","accepted":true}`))
+		})
+	})
+
+	Context("hydrating corrupt events", func() {
+		var insertCorruptEvent = func(data []byte) {
+			event, err := model.NewEvent(&model.EventCfg{
+				AggregateID: "corrupt",
+				Action:      AccountDeposited,
+				Data:        data,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = resultViewCfg.EventRepo.InsertAndPublish(event)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("quarantines corrupt event and continues with rest", func() {
+			resultRepo := resultViewCfg.ResultRepo.(*MemoryTxnResultViewRepo)
+
+			serView1, err := hydrateAndMarshal(&account.State{TxnID: "1", CustID: "1"}, AccountDeposited)
+			Expect(err).ToNot(HaveOccurred())
+			// Truncated in quarantine
+			corruptData := []byte(`{"txn_id":"` + strings.Repeat("x", 300))
+			insertCorruptEvent(corruptData)
+			serView2, err := hydrateAndMarshal(&account.State{TxnID: "2", CustID: "1"}, AccountDeposited)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resultRepo.Serialized()).To(Equal(fmt.Sprintf("%s\n%s", serView1, serView2)))
+			quarantined := resultView.Quarantined()
+			Expect(quarantined).To(HaveLen(1))
+			Expect(quarantined[0].Action).To(Equal(AccountDeposited))
+			Expect(quarantined[0].Error).To(ContainSubstring("error unmarshalling event-data"))
+			Expect(quarantined[0].RawData).To(Equal(string(corruptData[:256])))
+
+			// Quarantined event is not retried
+			err = resultView.hydrate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultView.Quarantined()).To(HaveLen(1))
+		})
+
+		It("fails hydration with strict-hydration", func() {
+			var err error
+			resultViewCfg.StrictHydration = true
+			resultView, err = newTxnResultView(resultViewCfg)
+			Expect(err).ToNot(HaveOccurred())
+
+			insertCorruptEvent([]byte("{"))
+			err = resultView.hydrate()
+			Expect(err).To(HaveOccurred())
+			Expect(resultView.Quarantined()).To(BeEmpty())
+		})
+	})
+
+	Context("resuming hydration", func() {
+		insertEvent := func(data interface{}) {
+			event, err := model.NewEvent(&model.EventCfg{
+				AggregateID: "1",
+				Action:      AccountDeposited,
+				Data:        data,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = resultViewCfg.EventRepo.InsertAndPublish(event)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		deposit := func(txnID string) {
+			insertEvent(&account.State{TxnID: txnID, CustID: "1"})
+		}
+
+		// Simulates restart of view, with a new view-repo
+		// sharing index-store and event-repo of previous one.
+		restart := func(indexStore IndexStore) *MemoryTxnResultViewRepo {
+			resultRepo := NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{
+				IndexStore: indexStore,
+			})
+			resultViewCfg.ResultRepo = resultRepo
+			var err error
+			resultView, err = newTxnResultView(resultViewCfg)
+			Expect(err).ToNot(HaveOccurred())
+			return resultRepo
+		}
+
+		entryIDs := func(resultRepo *MemoryTxnResultViewRepo) []string {
+			ids := make([]string, 0)
+			for _, entry := range resultRepo.Entries() {
+				ids = append(ids, entry.ID)
+			}
+			return ids
+		}
+
+		It("doesn't insert results of processed events again", func() {
+			tmpDir, err := ioutil.TempDir("", "view-index")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+			indexPath := filepath.Join(tmpDir, "index")
+
+			indexStore, err := NewFileIndexStore(indexPath)
+			Expect(err).ToNot(HaveOccurred())
+			resultRepo := restart(indexStore)
+			for _, txnID := range []string{"1", "2", "3"} {
+				deposit(txnID)
+			}
+			Expect(resultView.hydrate()).To(Succeed())
+			Expect(entryIDs(resultRepo)).To(Equal([]string{"1", "2", "3"}))
+
+			indexStore, err = NewFileIndexStore(indexPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(indexStore.Get()).To(Equal(3))
+			resultRepo = restart(indexStore)
+			Expect(resultRepo.Index()).To(Equal(3))
+
+			deposit("4")
+			Expect(resultView.hydrate()).To(Succeed())
+			Expect(entryIDs(resultRepo)).To(Equal([]string{"4"}))
+			Expect(indexStore.Get()).To(Equal(4))
+		})
+
+		It("clamps stored index exceeding events in event-repo", func() {
+			deposit("1")
+			deposit("2")
+			indexStore := NewMemoryIndexStore()
+			Expect(indexStore.Set(10)).To(Succeed())
+
+			resultRepo := restart(indexStore)
+			Expect(resultRepo.Index()).To(Equal(2))
+			Expect(indexStore.Get()).To(Equal(2))
+
+			deposit("3")
+			Expect(resultView.hydrate()).To(Succeed())
+			Expect(entryIDs(resultRepo)).To(Equal([]string{"3"}))
+			Expect(indexStore.Get()).To(Equal(3))
+		})
+
+		It("resumes from checkpoint instead of view-repo index", func() {
+			checkpoint := NewMemoryIndexStore()
+			resultViewCfg.Checkpoint = checkpoint
+			resultRepo := restart(nil)
+
+			deposit("1")
+			// Quarantined, so it has no result
+			insertEvent([]byte("{"))
+			deposit("2")
+			Expect(resultView.hydrate()).To(Succeed())
+			Expect(entryIDs(resultRepo)).To(Equal([]string{"1", "2"}))
+			// Checkpoint counts quarantined event, unlike view-repo
+			Expect(resultRepo.Index()).To(Equal(2))
+			Expect(checkpoint.Get()).To(Equal(3))
+
+			resultRepo = restart(nil)
+			Expect(resultView.lastEventIndex).To(Equal(3))
+			deposit("3")
+			Expect(resultView.hydrate()).To(Succeed())
+			Expect(entryIDs(resultRepo)).To(Equal([]string{"3"}))
+			Expect(checkpoint.Get()).To(Equal(4))
+		})
+
+		It("clamps checkpoint exceeding events in event-repo", func() {
+			deposit("1")
+			checkpoint := NewMemoryIndexStore()
+			Expect(checkpoint.Set(5)).To(Succeed())
+			resultViewCfg.Checkpoint = checkpoint
+
+			resultRepo := restart(nil)
+			Expect(resultView.lastEventIndex).To(Equal(1))
+			Expect(checkpoint.Get()).To(Equal(1))
+
+			deposit("2")
+			Expect(resultView.hydrate()).To(Succeed())
+			Expect(entryIDs(resultRepo)).To(Equal([]string{"2"}))
+		})
+	})
+
+	Context("catching up on events", func() {
+		var resultRepo *MemoryTxnResultViewRepo
+
+		insertEvent := func(action model.EventAction, data interface{}) {
+			event, err := model.NewEvent(&model.EventCfg{
+				AggregateID: "1",
+				Action:      action,
+				Data:        data,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = resultViewCfg.EventRepo.InsertAndPublish(event)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		deposit := func(txnID string) {
+			insertEvent(AccountDeposited, &account.State{TxnID: txnID, CustID: "1"})
+		}
+		decline := func(txnID string) {
+			insertEvent(AccountLimitExceeded, &account.TxnFailure{
+				Txn: model.Transaction{ID: txnID, CustomerID: "1"},
+			})
+		}
+
+		newListener := func(bulkCatchUp bool) *eventListener {
+			listener, err := newEventListener(&EventListenerCfg{
+				Log: logger.NewStdLogger("EventListener"),
+
+				Bus:                  bus,
+				AccountDeposited:     AccountDeposited,
+				AccountWithdrawn:     AccountWithdrawn,
+				DuplicateTxn:         DuplicateTxn,
+				AccountLimitExceeded: AccountLimitExceeded,
+
+				ResultViewCfg: resultViewCfg,
+				BulkCatchUp:   bulkCatchUp,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return listener
+		}
+
+		// receive receives an event as listener-loop would
+		receive := func(listener *eventListener, action model.EventAction) {
+			Eventually(listener.eventSubs[action]).Should(Receive())
+		}
+
+		BeforeEach(func() {
+			resultRepo = NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{})
+			resultViewCfg.ResultRepo = resultRepo
+
+			// Stored while listener wasn't running
+			deposit("1")
+			decline("2")
+			deposit("3")
+		})
+
+		It("catches up in bulk on first event, and incrementally afterwards", func() {
+			listener := newListener(true)
+			defer listener.unsubscribe()
+
+			deposit("4")
+			deposit("5")
+			decline("6")
+			receive(listener, AccountDeposited)
+			result, err := listener.handleEvent()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(hydration{
+				bulk:    true,
+				applied: 6,
+				// Rest of events published after start
+				coalesced: 2,
+			}))
+			Expect(resultRepo.Index()).To(Equal(6))
+
+			deposit("7")
+			receive(listener, AccountDeposited)
+			result, err = listener.handleEvent()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(hydration{applied: 1}))
+			Expect(resultRepo.Index()).To(Equal(7))
+
+			decline("8")
+			receive(listener, AccountLimitExceeded)
+			result, err = listener.handleEvent()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(hydration{applied: 1}))
+			Expect(resultRepo.Index()).To(Equal(8))
+		})
+
+		It("hydrates every event incrementally if bulk catch-up is disabled", func() {
+			listener := newListener(false)
+			defer listener.unsubscribe()
+
+			deposit("4")
+			deposit("5")
+			receive(listener, AccountDeposited)
+			result, err := listener.handleEvent()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(hydration{applied: 5}))
+
+			// Queued event is hydrated on its own
+			receive(listener, AccountDeposited)
+			result, err = listener.handleEvent()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(hydration{applied: 0}))
+			Expect(resultRepo.Index()).To(Equal(5))
+		})
+	})
+
+	Context("rebuilding customer", func() {
+		const RebuildCustomer model.CmdAction = "RebuildCustomer"
+
+		var resultRepo *MemoryTxnResultViewRepo
+		var cancel context.CancelFunc
+		var listenerErr chan error
+
+		deposit := func(txnID string, custID string) model.Event {
+			event, err := model.NewEvent(&model.EventCfg{
+				AggregateID: custID,
+				Action:      AccountDeposited,
+				Data:        &account.State{TxnID: txnID, CustID: custID},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = resultViewCfg.EventRepo.InsertAndPublish(event)
+			Expect(err).ToNot(HaveOccurred())
+			return event
+		}
+
+		// Returns serialized results of customers
+		// other than custID, in their order.
+		otherLines := func(custID string) []string {
+			lines := make([]string, 0)
+			for _, line := range strings.Split(resultRepo.Serialized(), "\n") {
+				if !strings.Contains(line, fmt.Sprintf(`"customer_id":"%s"`, custID)) {
+					lines = append(lines, line)
+				}
+			}
+			return lines
+		}
+
+		customerTxnIDs := func(custID string) func() []string {
+			return func() []string {
+				ids := make([]string, 0)
+				for _, entry := range resultRepo.ByCustomer()[custID] {
+					ids = append(ids, entry.ID)
+				}
+				return ids
+			}
+		}
+
+		BeforeEach(func() {
+			resultRepo = NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{})
+			resultViewCfg.ResultRepo = resultRepo
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			listenerErr = make(chan error, 1)
+			go func() {
+				listenerErr <- InitEventListener(ctx, &EventListenerCfg{
+					Log: logger.NewStdLogger("EventListener"),
+
+					Bus:                  bus,
+					AccountDeposited:     AccountDeposited,
+					AccountWithdrawn:     AccountWithdrawn,
+					DuplicateTxn:         DuplicateTxn,
+					AccountLimitExceeded: AccountLimitExceeded,
+					RebuildCustomerCmd:   RebuildCustomer,
+
+					ResultViewCfg: resultViewCfg,
+				})
+			}()
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(listenerErr, 5*time.Second).Should(Receive(BeNil()))
+		})
+
+		It("rebuilds results of customer only", func() {
+			var lastEvent model.Event
+			for i, custID := range []string{"1", "2", "3", "2", "1", "3"} {
+				lastEvent = deposit(fmt.Sprintf("%d", i+1), custID)
+			}
+			// Listener might subscribe after events were published,
+			// so last event is published again until it's hydrated.
+			Eventually(func() int {
+				Expect(bus.Publish(lastEvent)).To(Succeed())
+				return resultRepo.Index()
+			}, 5*time.Second).Should(Equal(6))
+			Expect(customerTxnIDs("2")()).To(Equal([]string{"2", "4"}))
+
+			// Corrupt customer's results
+			err := resultRepo.Insert(TxnResultEntry{ID: "bogus", CustomerID: "2"})
+			Expect(err).ToNot(HaveOccurred())
+			expectedOthers := otherLines("2")
+
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action: RebuildCustomer,
+				Data:   &RebuildCustomerReq{CustomerID: "2"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bus.Publish(cmd)).To(Succeed())
+
+			Eventually(customerTxnIDs("2"), 5*time.Second).Should(Equal([]string{"2", "4"}))
+			Expect(otherLines("2")).To(Equal(expectedOthers))
+			Expect(resultRepo.Index()).To(Equal(6))
+
+			// Rebuilt results aren't added again by later hydration
+			deposit("7", "2")
+			Eventually(customerTxnIDs("2"), 5*time.Second).Should(Equal([]string{"2", "4", "7"}))
+			Expect(resultRepo.Index()).To(Equal(7))
+			Expect(otherLines("2")).To(Equal(expectedOthers))
+		})
+	})
+
+	Context("rebuilding view", func() {
+		// Events of every action handled by view,
+		// for a couple of customers.
+		BeforeEach(func() {
+			txnTime := time.Date(2000, 1, 5, 10, 0, 0, 0, time.UTC)
+			results := []struct {
+				custID string
+				action model.EventAction
+				data   interface{}
+			}{
+				{"1", AccountDeposited, &account.State{TxnID: "1", CustID: "1", TxnTime: txnTime}},
+				{"2", AccountWithdrawn, &account.State{TxnID: "2", CustID: "2", TxnTime: txnTime}},
+				{"1", AccountLimitExceeded, &account.TxnFailure{
+					Txn:          model.Transaction{ID: "3", CustomerID: "1", Time: txnTime},
+					FailureCause: account.DailyLimitsExceeded,
+				}},
+				{"1", DuplicateTxn, &account.TxnFailure{
+					Txn:          model.Transaction{ID: "1", CustomerID: "1", Time: txnTime},
+					FailureCause: account.DuplicateTxn,
+				}},
+				{"2", AccountDeposited, &account.State{TxnID: "4", CustID: "2", TxnTime: txnTime, IsTest: true}},
+			}
+			for _, result := range results {
+				event, err := model.NewEvent(&model.EventCfg{
+					AggregateID: result.custID,
+					Action:      result.action,
+					Data:        result.data,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resultViewCfg.EventRepo.InsertAndPublish(event)).To(Succeed())
+			}
+		})
+
+		// freshView returns a view-repo freshly
+		// hydrated from events in event-repo.
+		freshView := func() *MemoryTxnResultViewRepo {
+			viewCfg := *resultViewCfg
+			resultRepo := NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{})
+			viewCfg.ResultRepo = resultRepo
+			view, err := newTxnResultView(&viewCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(view.hydrate()).To(Succeed())
+			return resultRepo
+		}
+
+		It("rebuilds corrupted view same as a fresh view", func() {
+			expected := freshView()
+			Expect(expected.Entries()).To(HaveLen(5))
+
+			indexStore := NewMemoryIndexStore()
+			resultRepo := NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{
+				IndexStore: indexStore,
+			})
+			resultViewCfg.ResultRepo = resultRepo
+			checkpoint := NewMemoryIndexStore()
+			resultViewCfg.Checkpoint = checkpoint
+			var err error
+			resultView, err = newTxnResultView(resultViewCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultView.hydrate()).To(Succeed())
+
+			// Corrupt view
+			Expect(resultRepo.RemoveCustomer("2")).To(Succeed())
+			err = resultRepo.Insert(TxnResultEntry{ID: "bogus", CustomerID: "3", Accepted: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultRepo.Serialized()).ToNot(Equal(expected.Serialized()))
+
+			Expect(RebuildView(resultViewCfg)).To(Succeed())
+			Expect(resultRepo.Serialized()).To(Equal(expected.Serialized()))
+			Expect(resultRepo.Entries()).To(Equal(expected.Entries()))
+			Expect(resultRepo.Counts()).To(Equal(expected.Counts()))
+			Expect(resultRepo.Index()).To(Equal(expected.Index()))
+			Expect(indexStore.Get()).To(Equal(5))
+			Expect(checkpoint.Get()).To(Equal(5))
+		})
+
+		It("fails for view-repo which can't be reset", func() {
+			resultViewCfg.ResultRepo = struct{ TxnResultViewRepo }{
+				NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{}),
+			}
+			Expect(RebuildView(resultViewCfg)).ToNot(Succeed())
+		})
+	})
+
+	Context("migrating account state-schema", func() {
+		// hydrate hydrates a new view-repo from events in store.
+		var hydrate = func(store eventutil.EventStore) string {
+			repo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+				Bus:            bus,
+				EventStore:     store,
+				UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			viewCfg := *resultViewCfg
+			viewCfg.EventRepo = repo
+			viewCfg.ResultRepo = NewMemoryTxnResultViewRepo(MemoryTxnResultViewRepoCfg{})
+			view, err := newTxnResultView(&viewCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(view.hydrate()).To(Succeed())
+			return viewCfg.ResultRepo.Serialized()
+		}
+
+		It("hydrates migrated events same as mixed-version events", func() {
+			v1Zone := time.FixedZone("", -5*60*60)
+			txnTime := time.Date(2000, 1, 5, 10, 0, 0, 0, time.UTC)
+			// Version 1 of State has no version, and
+			// transaction-time with request's offset.
+			results := []struct {
+				action model.EventAction
+				data   interface{}
+			}{
+				{AccountDeposited, &account.State{TxnID: "1", CustID: "1", TxnTime: txnTime.In(v1Zone)}},
+				{AccountDeposited, &account.State{
+					TxnID: "2", CustID: "1", TxnTime: txnTime, Version: account.StateVersion,
+				}},
+				{AccountWithdrawn, &account.State{TxnID: "3", CustID: "2", TxnTime: txnTime.In(v1Zone), IsTest: true}},
+				{DuplicateTxn, &account.TxnFailure{
+					Txn:          model.Transaction{ID: "1", CustomerID: "1", Time: txnTime},
+					FailureCause: account.DuplicateTxn,
+				}},
+			}
+			mixedStore := eventutil.NewMemoryEventStore()
+			for _, result := range results {
+				event, err := model.NewEvent(&model.EventCfg{
+					AggregateID: "1",
+					Action:      result.action,
+					Data:        result.data,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(mixedStore.Insert(event)).To(Succeed())
+			}
+
+			migratedStore := eventutil.NewMemoryEventStore()
+			report, err := eventutil.MigrateEvents(
+				mixedStore,
+				migratedStore,
+				account.StateMigrator(AccountDeposited, AccountWithdrawn),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Migrated).To(Equal(2))
+			Expect(report.Unchanged).To(Equal(2))
+
+			expected := hydrate(mixedStore)
+			Expect(strings.Split(expected, "\n")).To(HaveLen(len(results)))
+			Expect(hydrate(migratedStore)).To(Equal(expected))
+		})
+	})
 })
@@ -0,0 +1,189 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// MonitorAggregateID is aggregate-id of
+// events published by event-listener.
+const MonitorAggregateID = "rejectionMonitor"
+
+// eventListener observes results of transactions from
+// account's events, and publishes anomalies reported by
+// RejectionMonitor.
+type eventListener struct {
+	log logger.Logger
+	bus eventutil.Bus
+
+	accountDeposited     model.EventAction
+	accountWithdrawn     model.EventAction
+	duplicateTxn         model.EventAction
+	accountLimitExceeded model.EventAction
+	rejectionRateAnomaly model.EventAction
+	eventSubs            map[model.EventAction]<-chan model.Event
+
+	monitor *RejectionMonitor
+}
+
+// EventListenerCfg is config for event-listener.
+type EventListenerCfg struct {
+	Log logger.Logger `validate:"nonnil"`
+	Bus eventutil.Bus `validate:"nonnil"`
+
+	AccountDeposited     model.EventAction `validate:"nonzero"`
+	AccountWithdrawn     model.EventAction `validate:"nonzero"`
+	DuplicateTxn         model.EventAction `validate:"nonzero"`
+	AccountLimitExceeded model.EventAction `validate:"nonzero"`
+	// Published with RejectionRateAnomaly as data.
+	// Not stored in any event-store.
+	RejectionRateAnomaly model.EventAction `validate:"nonzero"`
+
+	Monitor *RejectionMonitor `validate:"nonnil"`
+}
+
+// InitEventListener validates event-listener
+// config and runs event-listener.
+func InitEventListener(ctx context.Context, cfg *EventListenerCfg) error {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return errors.Wrap(err, "error validating config")
+	}
+	if ctx == nil {
+		return errors.New("context is nil")
+	}
+
+	eventSubs := make(map[model.EventAction]<-chan model.Event)
+	for _, action := range []model.EventAction{
+		cfg.AccountDeposited,
+		cfg.AccountWithdrawn,
+		cfg.DuplicateTxn,
+		cfg.AccountLimitExceeded,
+	} {
+		eventSubs[action], err = eventutil.SubscribeEvents(cfg.Bus, action)
+		if err != nil {
+			return errors.Wrapf(err, "error subscribing to event-bus for action: %s", action)
+		}
+	}
+
+	cfg.Log.Infof("Starting event-listener")
+	listener := &eventListener{
+		log: cfg.Log,
+		bus: cfg.Bus,
+
+		accountDeposited:     cfg.AccountDeposited,
+		accountWithdrawn:     cfg.AccountWithdrawn,
+		duplicateTxn:         cfg.DuplicateTxn,
+		accountLimitExceeded: cfg.AccountLimitExceeded,
+		rejectionRateAnomaly: cfg.RejectionRateAnomaly,
+		eventSubs:            eventSubs,
+
+		monitor: cfg.Monitor,
+	}
+
+	err = listener.start(ctx)
+	return errors.Wrap(err, "listener-routine exited with error")
+}
+
+func (el *eventListener) start(ctx context.Context) error {
+	defer el.unsubscribe()
+
+	for {
+		var event model.Event
+		var action model.EventAction
+		var ok bool
+
+		select {
+		case <-ctx.Done():
+			el.log.Debug("Received context-done signal")
+			err := el.unsubscribe()
+			if err != nil {
+				err = errors.Wrap(err, "error disposing instance")
+			}
+			return err
+
+		case event, ok = <-el.eventSubs[el.accountDeposited]:
+			action = el.accountDeposited
+		case event, ok = <-el.eventSubs[el.accountWithdrawn]:
+			action = el.accountWithdrawn
+		case event, ok = <-el.eventSubs[el.duplicateTxn]:
+			action = el.duplicateTxn
+		case event, ok = <-el.eventSubs[el.accountLimitExceeded]:
+			action = el.accountLimitExceeded
+		}
+		if !ok {
+			return eventutil.SubscriptionClosedError(action.String())
+		}
+
+		err := el.handleEvent(event)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleEvent observes result of transaction in event,
+// and publishes anomaly if monitor reports one.
+func (el *eventListener) handleEvent(event model.Event) error {
+	var detected *RejectionRateAnomaly
+	switch event.Action() {
+	case el.accountDeposited, el.accountWithdrawn:
+		detected = el.monitor.ObserveAccepted()
+	default:
+		failure := &account.TxnFailure{}
+		err := json.Unmarshal(event.RawData(), failure)
+		if err != nil {
+			// Rejection is still counted, since
+			// only its cause can't be determined.
+			el.log.Errorf("[EventID: %s]: Error unmarshalling event-data: %s", event.ID(), err)
+		}
+		detected = el.monitor.ObserveRejected(string(failure.FailureCause))
+	}
+	if detected == nil {
+		return nil
+	}
+
+	el.log.Warnf(
+		"Rejection-rate anomaly: %d of last %d result(s) rejected (threshold: %.2f), top causes: %+v",
+		detected.Rejected, detected.WindowSize, detected.Threshold, detected.TopCauses,
+	)
+	anomalyEvent, err := model.NewEvent(&model.EventCfg{
+		AggregateID:    MonitorAggregateID,
+		CausationID:    event.ID(),
+		CausationKey:   event.ID(),
+		CorrelationKey: event.CorrelationKey(),
+		Action:         el.rejectionRateAnomaly,
+		Data:           detected,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating anomaly-event")
+	}
+	err = el.bus.Publish(anomalyEvent)
+	return errors.Wrap(eventutil.MarkFatal(err), "error publishing anomaly-event")
+}
+
+func (el *eventListener) unsubscribe() error {
+	for action, channel := range el.eventSubs {
+		// Already unsubscribed
+		if channel == nil {
+			continue
+		}
+
+		el.log.Debugf("Unsubscribing from action: %s", action)
+		err := eventutil.UnsubscribeEvents(el.bus, channel, action)
+		if err != nil {
+			return errors.Wrapf(err, "error unsubscribing from event-bus for action: %s", action)
+		}
+		el.eventSubs[action] = nil
+		el.log.Tracef("Unsubscribed from action: %s", action)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+func TestAnomaly(t *testing.T) {
+	os.Setenv("LOG_LEVEL", "warn")
+	os.Setenv("EVENTBUS_LOG_LEVEL", "error")
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Anomaly Suite")
+}
+
+var _ = Describe("RejectionMonitor", func() {
+	const (
+		AccountDeposited          model.EventAction = "AccountDeposited"
+		AccountWithdrawn          model.EventAction = "AccountWithdrawn"
+		DuplicateTxn              model.EventAction = "DuplicateTxn"
+		AccountLimitExceeded      model.EventAction = "AccountLimitExceeded"
+		RejectionRateAnomalyEvent model.EventAction = "RejectionRateAnomaly"
+	)
+
+	startTime := time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	var bus eventutil.Bus
+	var fakeClock *clock.FakeClock
+	var monitor *RejectionMonitor
+	var cancel context.CancelFunc
+	var listenerErr chan error
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		fakeClock = clock.NewFakeClock(startTime)
+		monitor, err = NewRejectionMonitor(&RejectionMonitorCfg{
+			WindowSize:   10,
+			Threshold:    0.5,
+			MinBreachSec: 3,
+			CooldownSec:  60,
+			Clock:        fakeClock,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		listenerErr = make(chan error, 1)
+		cfg := &EventListenerCfg{
+			Log: logger.NewStdLogger("EventListener"),
+			Bus: bus,
+
+			AccountDeposited:     AccountDeposited,
+			AccountWithdrawn:     AccountWithdrawn,
+			DuplicateTxn:         DuplicateTxn,
+			AccountLimitExceeded: AccountLimitExceeded,
+			RejectionRateAnomaly: RejectionRateAnomalyEvent,
+
+			Monitor: monitor,
+		}
+		go func() {
+			listenerErr <- InitEventListener(ctx, cfg)
+		}()
+
+		// Listener might subscribe after BeforeEach returns, so
+		// accepted results are published until these're observed,
+		// and then until every published one is. These're pushed
+		// out of window by results under test.
+		probe, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      AccountDeposited,
+			Data:        &account.State{TxnID: "probe", CustID: "1"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() int {
+			Expect(bus.Publish(probe)).To(Succeed())
+			return monitor.Observed()
+		}, 5*time.Second).ShouldNot(BeZero())
+		numProbes := 0
+		Eventually(func() bool {
+			prevNumProbes := numProbes
+			numProbes = monitor.Observed()
+			return numProbes == prevNumProbes
+		}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(listenerErr, 5*time.Second).Should(Receive(BeNil()))
+		bus.Terminate()
+	})
+
+	// Publishes result of transaction, and waits for
+	// monitor to observe it, so clock can be advanced.
+	publishResult := func(txnID int, cause account.TxnFailureCause) {
+		action := AccountDeposited
+		var data interface{} = &account.State{TxnID: fmt.Sprint(txnID), CustID: "1"}
+		if cause != "" {
+			action = AccountLimitExceeded
+			if cause == account.DuplicateTxn {
+				action = DuplicateTxn
+			}
+			data = &account.TxnFailure{
+				Txn:          model.Transaction{ID: fmt.Sprint(txnID), CustomerID: "1"},
+				FailureCause: cause,
+			}
+		}
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      action,
+			Data:        data,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		observed := monitor.Observed()
+		Expect(bus.Publish(event)).To(Succeed())
+		Eventually(monitor.Observed, 5*time.Second).Should(Equal(observed + 1))
+	}
+
+	It("publishes one anomaly once burst of rejections lasts min-breach duration", func() {
+		anomalySub, err := eventutil.SubscribeEvents(bus, RejectionRateAnomalyEvent)
+		Expect(err).ToNot(HaveOccurred())
+
+		// 90% accepted, with every 10th transaction a duplicate
+		txnID := 0
+		for ; txnID < 20; txnID++ {
+			fakeClock.Advance(time.Second)
+			var cause account.TxnFailureCause
+			if (txnID+1)%10 == 0 {
+				cause = account.DuplicateTxn
+			}
+			publishResult(txnID+1, cause)
+		}
+		Expect(monitor.Anomalies()).To(BeZero())
+
+		// Burst of rejections. Ratio exceeds threshold with
+		// 5th rejection (along with 20th transaction in window),
+		// and anomaly is reported 3 seconds later, with 8th.
+		burstCauses := []account.TxnFailureCause{account.DailyLimitsExceeded, account.InsufficientFunds}
+		for i := 0; i < 10; i++ {
+			fakeClock.Advance(time.Second)
+			txnID++
+			publishResult(txnID, burstCauses[i%2])
+
+			if i < 7 {
+				Expect(monitor.Anomalies()).To(BeZero(), "after rejection %d", i+1)
+			}
+		}
+
+		var event model.Event
+		Eventually(anomalySub, 5*time.Second).Should(Receive(&event))
+		Consistently(anomalySub).ShouldNot(Receive())
+		Expect(monitor.Anomalies()).To(Equal(1))
+
+		detected := &RejectionRateAnomaly{}
+		Expect(json.Unmarshal(event.Data(), detected)).To(Succeed())
+		Expect(*detected).To(Equal(RejectionRateAnomaly{
+			WindowSize:      10,
+			Rejected:        9,
+			RejectionRatio:  0.9,
+			Threshold:       0.5,
+			BreachStartedAt: startTime.Add(25 * time.Second),
+			DetectedAt:      startTime.Add(28 * time.Second),
+			TopCauses: []CauseCount{
+				{Cause: string(account.DailyLimitsExceeded), Count: 4},
+				{Cause: string(account.InsufficientFunds), Count: 4},
+				{Cause: string(account.DuplicateTxn), Count: 1},
+			},
+		}))
+	})
+
+	It("rate-limits anomalies of repeated breaches", func() {
+		anomalySub, err := eventutil.SubscribeEvents(bus, RejectionRateAnomalyEvent)
+		Expect(err).ToNot(HaveOccurred())
+
+		txnID := 0
+		breach := func() {
+			for i := 0; i < 10; i++ {
+				fakeClock.Advance(time.Second)
+				txnID++
+				publishResult(txnID, account.DailyLimitsExceeded)
+			}
+			for i := 0; i < 10; i++ {
+				fakeClock.Advance(time.Second)
+				txnID++
+				publishResult(txnID, "")
+			}
+		}
+
+		breach()
+		Eventually(anomalySub, 5*time.Second).Should(Receive())
+		// Within cooldown
+		breach()
+		Consistently(anomalySub).ShouldNot(Receive())
+		Expect(monitor.Anomalies()).To(Equal(1))
+
+		fakeClock.Advance(time.Minute)
+		breach()
+		Eventually(anomalySub, 5*time.Second).Should(Receive())
+		Expect(monitor.Anomalies()).To(Equal(2))
+	})
+
+	It("errors on invalid threshold", func() {
+		_, err := NewRejectionMonitor(&RejectionMonitorCfg{
+			WindowSize: 10,
+			Threshold:  1,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,253 @@
+package anomaly
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+)
+
+// Number of failure-causes listed in RejectionRateAnomaly.
+const topCausesLimit = 3
+
+// UnspecifiedCause is listed in RejectionRateAnomaly
+// for rejections without a failure-cause.
+const UnspecifiedCause = "Unspecified"
+
+// RejectionRateAnomaly is data of event published once
+// rejection-ratio of recent results stays above threshold.
+type RejectionRateAnomaly struct {
+	// Number of results ratio was computed over
+	WindowSize     int     `json:"window_size"`
+	Rejected       int     `json:"rejected"`
+	RejectionRatio float64 `json:"rejection_ratio"`
+	Threshold      float64 `json:"threshold"`
+	// Time ratio first exceeded threshold
+	BreachStartedAt time.Time `json:"breach_started_at"`
+	DetectedAt      time.Time `json:"detected_at"`
+	// Most frequent failure-causes of rejections in window,
+	// sorted by count, and then by cause.
+	TopCauses []CauseCount `json:"top_causes"`
+}
+
+// CauseCount is number of rejections with a failure-cause.
+type CauseCount struct {
+	Cause string `json:"cause"`
+	Count int    `json:"count"`
+}
+
+// disposition is result of a transaction.
+type disposition struct {
+	rejected bool
+	// Blank for accepted transactions
+	cause string
+}
+
+// RejectionMonitor tracks rejection-ratio over a sliding window of
+// most-recent results, and reports an anomaly once the ratio stays
+// above threshold for configured duration. Anomalies are reported
+// once per breach, and at most once per cooldown. Safe for concurrent
+// use, so it can be shared with routines reporting on anomalies.
+// Use #NewRejectionMonitor to create new instance.
+type RejectionMonitor struct {
+	windowSize int
+	threshold  float64
+	minBreach  time.Duration
+	cooldown   time.Duration
+	clock      clock.Clock
+
+	lock *sync.Mutex
+	// Ring-buffer of most-recent results
+	window []disposition
+	next   int
+	// Number of results observed
+	observed int
+	// Zero if ratio is within threshold
+	breachStartedAt time.Time
+	// Set once anomaly of current breach is reported
+	breachReported  bool
+	lastReportedAt  time.Time
+	anomalies       int
+	numRejected     int
+	rejectionCauses map[string]int
+}
+
+// RejectionMonitorCfg is config for RejectionMonitor.
+type RejectionMonitorCfg struct {
+	// Number of most-recent results ratio is computed over.
+	// Ratio isn't checked until window is full, so a few
+	// early rejections don't report an anomaly.
+	WindowSize int `validate:"min=1"`
+	// Rejection-ratio, in (0, 1), above which
+	// recent results are considered a breach.
+	Threshold float64
+	// Optional, seconds ratio must stay above threshold
+	// for, before anomaly is reported. Reported as soon
+	// as threshold is exceeded if not set.
+	MinBreachSec int `validate:"min=0"`
+	// Optional, minimum seconds between reported anomalies.
+	CooldownSec int `validate:"min=0"`
+	// Optional, defaults to clock.RealClock.
+	Clock clock.Clock
+}
+
+// Validate validates config, along with
+// invariants between its fields.
+func (cfg *RejectionMonitorCfg) Validate() error {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return errors.Wrap(err, "error validating config")
+	}
+	if cfg.Threshold <= 0 || cfg.Threshold >= 1 {
+		return fmt.Errorf("threshold must be between 0 and 1, got: %v", cfg.Threshold)
+	}
+	return nil
+}
+
+// NewRejectionMonitor validates provided config
+// and creates new instance of RejectionMonitor.
+func NewRejectionMonitor(cfg *RejectionMonitorCfg) (*RejectionMonitor, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	var monitorClock clock.Clock = clock.RealClock{}
+	if cfg.Clock != nil {
+		monitorClock = cfg.Clock
+	}
+
+	return &RejectionMonitor{
+		windowSize: cfg.WindowSize,
+		threshold:  cfg.Threshold,
+		minBreach:  time.Duration(cfg.MinBreachSec) * time.Second,
+		cooldown:   time.Duration(cfg.CooldownSec) * time.Second,
+		clock:      monitorClock,
+
+		lock:            &sync.Mutex{},
+		window:          make([]disposition, 0, cfg.WindowSize),
+		rejectionCauses: make(map[string]int),
+	}, nil
+}
+
+// ObserveAccepted records an accepted transaction. Returns
+// anomaly if one is reported by this result, otherwise nil.
+func (m *RejectionMonitor) ObserveAccepted() *RejectionRateAnomaly {
+	return m.observe(disposition{})
+}
+
+// ObserveRejected records a rejected transaction with its
+// failure-cause (blank if unknown). Returns anomaly if one
+// is reported by this result, otherwise nil.
+func (m *RejectionMonitor) ObserveRejected(cause string) *RejectionRateAnomaly {
+	if cause == "" {
+		cause = UnspecifiedCause
+	}
+	return m.observe(disposition{
+		rejected: true,
+		cause:    cause,
+	})
+}
+
+func (m *RejectionMonitor) observe(result disposition) *RejectionRateAnomaly {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.clock.Now()
+	m.observed++
+	if len(m.window) < m.windowSize {
+		m.window = append(m.window, result)
+	} else {
+		m.remove(m.window[m.next])
+		m.window[m.next] = result
+		m.next = (m.next + 1) % m.windowSize
+	}
+	if result.rejected {
+		m.numRejected++
+		m.rejectionCauses[result.cause]++
+	}
+	if len(m.window) < m.windowSize {
+		return nil
+	}
+
+	ratio := float64(m.numRejected) / float64(m.windowSize)
+	if ratio <= m.threshold {
+		m.breachStartedAt = time.Time{}
+		m.breachReported = false
+		return nil
+	}
+	if m.breachStartedAt.IsZero() {
+		m.breachStartedAt = now
+	}
+
+	if m.breachReported || now.Sub(m.breachStartedAt) < m.minBreach {
+		return nil
+	}
+	if !m.lastReportedAt.IsZero() && now.Sub(m.lastReportedAt) < m.cooldown {
+		return nil
+	}
+	m.breachReported = true
+	m.lastReportedAt = now
+	m.anomalies++
+
+	return &RejectionRateAnomaly{
+		WindowSize:      m.windowSize,
+		Rejected:        m.numRejected,
+		RejectionRatio:  ratio,
+		Threshold:       m.threshold,
+		BreachStartedAt: m.breachStartedAt,
+		DetectedAt:      now,
+		TopCauses:       m.topCauses(),
+	}
+}
+
+// remove removes result leaving window from counts.
+func (m *RejectionMonitor) remove(result disposition) {
+	if !result.rejected {
+		return
+	}
+	m.numRejected--
+	m.rejectionCauses[result.cause]--
+	if m.rejectionCauses[result.cause] == 0 {
+		delete(m.rejectionCauses, result.cause)
+	}
+}
+
+func (m *RejectionMonitor) topCauses() []CauseCount {
+	causes := make([]CauseCount, 0, len(m.rejectionCauses))
+	for cause, count := range m.rejectionCauses {
+		causes = append(causes, CauseCount{
+			Cause: cause,
+			Count: count,
+		})
+	}
+	sort.Slice(causes, func(i, j int) bool {
+		if causes[i].Count != causes[j].Count {
+			return causes[i].Count > causes[j].Count
+		}
+		return causes[i].Cause < causes[j].Cause
+	})
+
+	if len(causes) > topCausesLimit {
+		causes = causes[:topCausesLimit]
+	}
+	return causes
+}
+
+// Observed returns number of results observed.
+func (m *RejectionMonitor) Observed() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.observed
+}
+
+// Anomalies returns number of anomalies reported.
+func (m *RejectionMonitor) Anomalies() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.anomalies
+}
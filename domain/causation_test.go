@@ -0,0 +1,211 @@
+package domain
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+var _ = Describe("Causation chain", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	var txnCreatorCfg *txn.CmdListenerCfg
+	var accountCfg *account.CmdListenerCfg
+
+	// Runs routines with two transactions, recording
+	// messages of provided actions published on bus.
+	var runFlow = func(actions ...string) *testsupport.BusRecorder {
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err = cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err = cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		recorder, err := testsupport.NewBusRecorder(bus, actions...)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg: writerCfg,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		return recorder
+	}
+
+	It("links events from read to account-result", func(done Done) {
+		// Read-events are only published, not stored
+		recorder := runFlow(model.TxnRead.String())
+		defer recorder.Stop()
+
+		// Combine events from all repos for tracing
+		store := eventutil.NewMemoryEventStore()
+		for _, msg := range recorder.Messages(model.TxnRead.String()) {
+			Expect(store.Insert(msg.(model.Event))).To(Succeed())
+		}
+		repos := []eventutil.EventRepo{
+			txnCreatorCfg.CreatorCfg.EventRepo,
+			accountCfg.AccountCfg.EventRepo,
+		}
+		deposited := make([]model.Event, 0)
+		for _, repo := range repos {
+			events, err := repo.FetchByIndex(0)
+			Expect(err).ToNot(HaveOccurred())
+			for _, event := range events {
+				Expect(store.Insert(event)).To(Succeed())
+				if event.Action() == model.AccountDeposited {
+					deposited = append(deposited, event)
+				}
+			}
+		}
+		Expect(deposited).To(HaveLen(2))
+
+		for _, event := range deposited {
+			chain, err := eventutil.TraceChain(store, event.ID())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chain).To(HaveLen(3))
+
+			read := chain[0]
+			Expect(read.Action()).To(Equal(model.TxnRead))
+			Expect(read.CausationID()).To(BeEmpty())
+			Expect(read.CorrelationKey()).To(BeEmpty())
+
+			Expect(chain[1].Action()).To(Equal(model.TxnCreated))
+			Expect(chain[2].Action()).To(Equal(model.AccountDeposited))
+			for _, caused := range chain[1:] {
+				Expect(caused.CorrelationKey()).To(Equal(read.ID()))
+			}
+		}
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("links messages to their direct cause using causation-key", func(done Done) {
+		recorder := runFlow(
+			model.TxnRead.String(),
+			model.CreateTxn.String(),
+			model.TxnCreated.String(),
+			model.ProcessTxn.String(),
+			model.AccountDeposited.String(),
+			model.WriteData.String(),
+			model.DataWritten.String(),
+		)
+		defer recorder.Stop()
+		// Messages are recorded asynchronously, and writer
+		// doesn't return once data is written, so last
+		// messages might still be in flight.
+		for _, action := range []string{model.WriteData.String(), model.DataWritten.String()} {
+			_, err := recorder.WaitFor(action, nil, time.Second)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		// Index recorded messages by their ID
+		messages := make(map[string]interface{})
+		for _, action := range []string{
+			model.TxnRead.String(),
+			model.CreateTxn.String(),
+			model.TxnCreated.String(),
+			model.ProcessTxn.String(),
+			model.WriteData.String(),
+		} {
+			for _, msg := range recorder.Messages(action) {
+				switch m := msg.(type) {
+				case model.Event:
+					messages[m.ID()] = m
+				case model.Cmd:
+					messages[m.ID()] = m
+				}
+			}
+		}
+
+		deposited := recorder.Messages(model.AccountDeposited.String())
+		Expect(deposited).To(HaveLen(2))
+		for _, msg := range deposited {
+			event := msg.(model.Event)
+
+			processCmd, isCmd := messages[event.CausationKey()].(model.Cmd)
+			Expect(isCmd).To(BeTrue())
+			Expect(processCmd.Action()).To(Equal(model.ProcessTxn))
+
+			created, isEvent := messages[processCmd.CausationKey()].(model.Event)
+			Expect(isEvent).To(BeTrue())
+			Expect(created.Action()).To(Equal(model.TxnCreated))
+
+			createCmd, isCmd := messages[created.CausationKey()].(model.Cmd)
+			Expect(isCmd).To(BeTrue())
+			Expect(createCmd.Action()).To(Equal(model.CreateTxn))
+
+			read, isEvent := messages[createCmd.CausationKey()].(model.Event)
+			Expect(isEvent).To(BeTrue())
+			Expect(read.Action()).To(Equal(model.TxnRead))
+			Expect(read.CausationKey()).To(BeEmpty())
+		}
+
+		written := recorder.Messages(model.DataWritten.String())
+		Expect(written).ToNot(BeEmpty())
+		for _, msg := range written {
+			writeCmd, isCmd := messages[msg.(model.Event).CausationKey()].(model.Cmd)
+			Expect(isCmd).To(BeTrue())
+			Expect(writeCmd.Action()).To(Equal(model.WriteData))
+		}
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
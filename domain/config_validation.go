@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/validator.v2"
+)
+
+// ConfigError is returned by #RunRoutines when a nested config
+// in RoutinesCfg is invalid. Only the first invalid config is
+// reported.
+type ConfigError struct {
+	// Path of invalid config from RoutinesCfg,
+	// such as "AccountCfg.AccountCfg".
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config at %s: %s", e.Path, e.Err)
+}
+
+// Unwrap returns validation-error of config.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// validatable is a config which validates
+// invariants between its fields, along with tags.
+type validatable interface {
+	Validate() error
+}
+
+// nestedCfg is a config nested in RoutinesCfg.
+type nestedCfg struct {
+	path string
+	cfg  interface{}
+}
+
+// nestedCfgs returns configs nested in RoutinesCfg, with configs
+// of disabled stages left out. Configs are listed before configs
+// these are nested in, so errors are reported at deepest path.
+func (cfg *RoutinesCfg) nestedCfgs() []nestedCfg {
+	cfgs := make([]nestedCfg, 0)
+	if cfg.isEnabled(StageReader) {
+		cfgs = append(cfgs, nestedCfg{"ReaderCfg", cfg.ReaderCfg})
+	}
+	if cfg.isEnabled(StageTxnCreator) {
+		cfgs = append(
+			cfgs,
+			nestedCfg{"TxnCreatorCfg.CreatorCfg", cfg.TxnCreatorCfg.CreatorCfg},
+			nestedCfg{"TxnCreatorCfg", cfg.TxnCreatorCfg},
+		)
+	}
+	if cfg.isEnabled(StageAccount) {
+		cfgs = append(
+			cfgs,
+			nestedCfg{"AccountCfg.AccountCfg", cfg.AccountCfg.AccountCfg},
+			nestedCfg{"AccountCfg", cfg.AccountCfg},
+		)
+	}
+	if cfg.isEnabled(StageAccountView) {
+		cfgs = append(
+			cfgs,
+			nestedCfg{"AccountViewCfg.ResultViewCfg", cfg.AccountViewCfg.ResultViewCfg},
+			nestedCfg{"AccountViewCfg", cfg.AccountViewCfg},
+		)
+	}
+	cfgs = append(cfgs, nestedCfg{"ProcessMgrCfg", cfg.ProcessMgrCfg})
+	if cfg.isEnabled(StageWriter) {
+		cfgs = append(
+			cfgs,
+			nestedCfg{"WriterCfg.WriterCfg", cfg.WriterCfg.WriterCfg},
+			nestedCfg{"WriterCfg", cfg.WriterCfg},
+		)
+	}
+	cfgs = append(cfgs, nestedCfg{"AnomalyCfg", cfg.AnomalyCfg})
+	cfgs = append(cfgs, nestedCfg{"Recovery", cfg.Recovery})
+	cfgs = append(cfgs, nestedCfg{"DiagnosticsCfg", cfg.DiagnosticsCfg})
+	return cfgs
+}
+
+// validateNested validates configs nested in RoutinesCfg,
+// including invariants between their fields, which are
+// otherwise only checked once their routine starts.
+// Configs of enabled stages must be set.
+func (cfg *RoutinesCfg) validateNested() error {
+	for _, nested := range cfg.nestedCfgs() {
+		// Missing nested configs are reported by their parent
+		value := reflect.ValueOf(nested.cfg)
+		if !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+			continue
+		}
+
+		var err error
+		if v, ok := nested.cfg.(validatable); ok {
+			err = v.Validate()
+		} else {
+			err = validator.Validate(nested.cfg)
+		}
+		if err != nil {
+			return &ConfigError{
+				Path: nested.path,
+				Err:  err,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Nested config validation", func() {
+	var bus eventutil.Bus
+	var routinesCfg *RoutinesCfg
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               1,
+				ReportWrittenEventTimeoutSec: 1,
+			},
+			WriterCfg: writerCfg,
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("reports invalid nested account-config before starting routines", func() {
+		accountCfg := routinesCfg.AccountCfg.AccountCfg
+		accountCfg.WeeklyTxnsAmountLimit = accountCfg.DailyTxnsAmountLimit - 1
+
+		summary, err := RunRoutines(routinesCfg)
+		Expect(summary).To(BeNil())
+		var cfgErr *ConfigError
+		Expect(errors.As(err, &cfgErr)).To(BeTrue())
+		Expect(cfgErr.Path).To(Equal("AccountCfg.AccountCfg"))
+		Expect(cfgErr.Err).To(MatchError(ContainSubstring("weekly-amount limit")))
+		Expect(err.Error()).To(ContainSubstring("invalid config at AccountCfg.AccountCfg"))
+	})
+
+	It("reports first invalid config by its path", func() {
+		routinesCfg.AccountCfg.QueryStateCmd = model.QueryState
+		routinesCfg.ProcessMgrCfg.ReportTimeoutMinSec = 2
+		routinesCfg.ProcessMgrCfg.ReportTimeoutMaxSec = 1
+
+		err := routinesCfg.validateNested()
+		var cfgErr *ConfigError
+		Expect(errors.As(err, &cfgErr)).To(BeTrue())
+		Expect(cfgErr.Path).To(Equal("AccountCfg"))
+		Expect(cfgErr.Err).To(MatchError(ContainSubstring("state-queried event-action")))
+
+		routinesCfg.AccountCfg.QueryStateCmd = ""
+		err = routinesCfg.validateNested()
+		Expect(errors.As(err, &cfgErr)).To(BeTrue())
+		Expect(cfgErr.Path).To(Equal("ProcessMgrCfg"))
+	})
+
+	It("skips configs of disabled stages", func() {
+		accountCfg := routinesCfg.AccountCfg.AccountCfg
+		accountCfg.WeeklyTxnsAmountLimit = accountCfg.DailyTxnsAmountLimit - 1
+		routinesCfg.DisabledStages = []Stage{StageAccount}
+
+		Expect(routinesCfg.validateNested()).To(Succeed())
+	})
+})
@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// StragglerPolicy is how process-manager handles a transaction
+// of a customer whose group already ended in customer-grouped
+// input (see ProcessMgrCfg#CustomerGrouped).
+type StragglerPolicy string
+
+const (
+	// Straggler is processed with a warning, and customer's
+	// output is written again once its new group ends.
+	StragglerAppend StragglerPolicy = "append"
+	// Straggler is dropped with a warning, and has no result.
+	StragglerReject StragglerPolicy = "reject"
+)
+
+// groupFinalizeInterval is interval at which customers
+// whose group ended are checked for having all results.
+const groupFinalizeInterval = 50 * time.Millisecond
+
+// customerFlow tracks transactions of a customer
+// in customer-grouped input.
+type customerFlow struct {
+	// Lines read, and transactions created (or
+	// skipped) or failed to be created from these.
+	read    int
+	created int
+	failed  int
+	// Set once a line of another customer is read after
+	// customer's lines, and cleared if customer appears again.
+	ended bool
+	// Set once customer's output is written before report
+	finalized bool
+}
+
+// customerGroups tracks customers' groups in customer-grouped
+// input, so their output is written once their results are final.
+// Only accessed by process-loop.
+type customerGroups struct {
+	stragglerPolicy StragglerPolicy
+	// Customer of last line read
+	current string
+	flows   map[string]*customerFlow
+	// Customers whose group ended, but whose
+	// output isn't written yet, in order of ending.
+	pending []string
+	// Number of lines of customers whose group already ended
+	stragglers int
+	// Number of written customer-outputs not yet confirmed by
+	// writer. Confirmed by process-loop until report is written.
+	unconfirmedWrites int
+}
+
+func newCustomerGroups(stragglerPolicy StragglerPolicy) *customerGroups {
+	if stragglerPolicy == "" {
+		stragglerPolicy = StragglerAppend
+	}
+	return &customerGroups{
+		stragglerPolicy: stragglerPolicy,
+		flows:           make(map[string]*customerFlow),
+		pending:         make([]string, 0),
+	}
+}
+
+// trackGroupRead tracks line read in TxnRead event, ending group
+// of previous customer if line is of another customer. Returns
+// false if line is a straggler which is rejected, so it isn't
+// processed. Lines without a customer-id aren't tracked.
+func (p *processMgr) trackGroupRead(event model.Event) bool {
+	req, err := txn.ParseTxnReq(event.RawData())
+	if err != nil || req.CustomerID == "" {
+		return true
+	}
+	custID := req.CustomerID
+
+	groups := p.customerGroups
+	flow, exists := groups.flows[custID]
+	if exists && flow.ended {
+		groups.stragglers++
+		if groups.stragglerPolicy == StragglerReject {
+			// Current group continues after straggler
+			p.log.Warnf(
+				"[Event: %s]: [Customer: %q]: Rejected transaction after customer's group ended",
+				event.ID(), custID,
+			)
+			return false
+		}
+		p.log.Warnf(
+			"[Event: %s]: [Customer: %q]: Appending transaction after customer's group ended, "+
+				"customer's output will be written again",
+			event.ID(), custID,
+		)
+		flow.ended = false
+		flow.finalized = false
+		groups.removePending(custID)
+	}
+	if !exists {
+		flow = &customerFlow{}
+		groups.flows[custID] = flow
+	}
+	if custID != groups.current {
+		if prevFlow, exists := groups.flows[groups.current]; exists {
+			prevFlow.ended = true
+			groups.pending = append(groups.pending, groups.current)
+		}
+		groups.current = custID
+	}
+	flow.read++
+	return true
+}
+
+// trackGroupCreated tracks transaction in TxnCreated event.
+func (p *processMgr) trackGroupCreated(event model.Event) {
+	transaction := &model.Transaction{}
+	err := json.Unmarshal(event.RawData(), transaction)
+	if err != nil {
+		p.log.Warnf("error unmarshalling event-data for '%s' Event", p.txnCreated)
+		return
+	}
+	if flow, exists := p.customerGroups.flows[transaction.CustomerID]; exists {
+		flow.created++
+	}
+}
+
+// trackGroupSkipped tracks transaction skipped by txn-creator,
+// which has a result same as a created transaction.
+func (p *processMgr) trackGroupSkipped(transaction *model.Transaction) {
+	if flow, exists := p.customerGroups.flows[transaction.CustomerID]; exists {
+		flow.created++
+	}
+}
+
+// trackGroupCreateFailed tracks transaction which failed to be created.
+func (p *processMgr) trackGroupCreateFailed(failure *txn.CreateTxnFailure) {
+	if failure.TxnReq == nil {
+		return
+	}
+	if flow, exists := p.customerGroups.flows[failure.TxnReq.CustomerID]; exists {
+		flow.failed++
+	}
+}
+
+func (groups *customerGroups) removePending(custID string) {
+	for i, pendingID := range groups.pending {
+		if pendingID == custID {
+			groups.pending = append(groups.pending[:i], groups.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// finalizeGroups writes output of every customer whose group ended,
+// once all of its lines have been created (or failed), and view has
+// results of all created transactions. Customers with IDs unsafe as
+// file-names are left to be handled along with report.
+func (p *processMgr) finalizeGroups(errs *errSink) error {
+	groups := p.customerGroups
+	stillPending := make([]string, 0, len(groups.pending))
+	for _, custID := range groups.pending {
+		flow := groups.flows[custID]
+		if flow.read != flow.created+flow.failed {
+			stillPending = append(stillPending, custID)
+			continue
+		}
+		results := p.customerResultRepo.CustomerResults(custID)
+		if len(results) < flow.created {
+			stillPending = append(stillPending, custID)
+			continue
+		}
+		if checkSafeFileName(custID) != nil {
+			continue
+		}
+
+		cmd, _, err := p.customerWriteCmd(custID, results)
+		if err != nil {
+			return errors.Wrapf(err, "error creating write-command for customer %q", custID)
+		}
+		p.log.Debugf("[Customer: %q]: Writing output of customer whose group ended", custID)
+		flow.finalized = true
+		groups.unconfirmedWrites++
+		p.pubCmd(errs, cmd, fmt.Sprintf("[Customer: %q]:", custID))
+	}
+	groups.pending = stillPending
+	return nil
+}
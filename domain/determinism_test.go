@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Determinism", func() {
+	const numRuns = 5
+	// Budget of a single run, specs are budgeted by runs
+	const runTimeout = 10 * time.Second
+
+	// Transactions of customers are interleaved, and groups
+	// of them share timestamps (as if truncated to hours),
+	// with IDs which aren't ordered same as input.
+	input := func() []txn.CreateTxnReq {
+		random := rand.New(rand.NewSource(1))
+		ids := random.Perm(90)
+		reqs := make([]txn.CreateTxnReq, 0, len(ids))
+		for i, id := range ids {
+			reqs = append(reqs, txn.CreateTxnReq{
+				ID:         fmt.Sprintf("%03d", id),
+				CustomerID: fmt.Sprintf("%d", i%3),
+				LoadAmount: fmt.Sprintf("$%d", 500+random.Intn(3000)),
+				Time:       fmt.Sprintf("2000-01-%02dT%02d:00:00Z", 3+i/30, (i/18)%24),
+			})
+		}
+		return reqs
+	}()
+
+	// run processes input, and returns account's events of
+	// every customer (excluding event-IDs, which are random),
+	// and the report written.
+	run := func() (string, string) {
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		defer bus.Terminate()
+
+		ioReader, err := domain_test.NewMockReader(input)
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter := domain_test.NewMockWriter()
+
+		routinesCfg := routinesRunCfg(bus, ioReader, ioWriter)
+		accountCfg := routinesCfg.AccountCfg
+		accountCfg.AccountCfg.RejectStaleTxns = true
+		accountCfg.AccountCfg.EventTimeFromTxn = true
+		accountViewCfg := routinesCfg.AccountViewCfg
+		accountViewCfg.ResultViewCfg.Clock = clock.NewFakeClock(time.Date(2000, 2, 1, 0, 0, 0, 0, time.UTC))
+		// Customers are processed concurrently, so
+		// report is sorted for comparing across runs.
+		routinesCfg.ProcessMgrCfg.ReportSort = ReportSortInputOrder
+
+		// Every transaction has a result
+		resultRepo := accountViewCfg.ResultViewCfg.ResultRepo
+		isSettled := func() bool {
+			return resultRepo.Index() >= len(input)
+		}
+
+		_, err = runRoutinesSettled(routinesCfg, clock.NewFakeClock(time.Now()), isSettled, runTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		eventRepo := accountCfg.AccountCfg.EventRepo
+		events := &strings.Builder{}
+		for _, custID := range []string{"0", "1", "2"} {
+			custEvents, err := eventRepo.Fetch(custID)
+			Expect(err).ToNot(HaveOccurred())
+			for _, event := range custEvents {
+				fmt.Fprintf(
+					events, "%s %s %s %s\n",
+					event.AggregateID(), event.Action(),
+					event.Time().Format(time.RFC3339Nano), event.RawData(),
+				)
+			}
+		}
+		return events.String(), string(ioWriter.Content())
+	}
+
+	It("produces identical events and report for input with identical timestamps", func(done Done) {
+		expectedEvents, expectedReport := run()
+		// Input has ties deciding which transaction exceeds limits
+		Expect(expectedEvents).To(ContainSubstring(model.AccountLimitExceeded.String()))
+		Expect(expectedEvents).To(ContainSubstring("at same time"))
+
+		for i := 1; i < numRuns; i++ {
+			events, report := run()
+			Expect(events).To(Equal(expectedEvents), "events of run %d differ", i+1)
+			Expect(report).To(Equal(expectedReport), "report of run %d differs", i+1)
+		}
+		close(done)
+	}, numRuns*runTimeout.Seconds())
+})
@@ -0,0 +1,298 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// DiagnosticsPath is path of handler returned by NewDiagnosticsHandler.
+const DiagnosticsPath = "/debug/diagnostics"
+
+// DiagnosticsAggregateID is aggregate-id of
+// events published by diagnostics-routine.
+const DiagnosticsAggregateID = "diagnostics"
+
+// DiagnosticsCfg is config for diagnostics-routine, which
+// dumps diagnostics of run (see CollectDiagnostics) when
+// it receives a DumpDiagnostics command.
+type DiagnosticsCfg struct {
+	Log logger.Logger `validate:"nonnil"`
+	Bus eventutil.Bus `validate:"nonnil"`
+
+	DumpDiagnostics model.CmdAction `validate:"nonzero"`
+	// Published with Diagnostics as data.
+	// Not stored in any event-store.
+	DiagnosticsDumped model.EventAction `validate:"nonzero"`
+}
+
+// Diagnostics is state of a running pipeline, for operators
+// investigating runs which seem stuck or slow. Values are
+// read one at a time while routines are running, so these
+// aren't from same instant, and are only consistent within
+// bounds noted for each.
+type Diagnostics struct {
+	Time time.Time `json:"time"`
+	// Subscriptions keyed by action. Nil if
+	// Bus isn't an eventutil.BusIntrospector.
+	Subscriptions map[string]eventutil.SubscriptionStats `json:"subscriptions"`
+	// Routines keyed by component, as in WiringIssue
+	Components map[string]ComponentDiagnostics `json:"components"`
+	// Transactions sent to account which don't have results in
+	// transaction-result view yet. Derived from Bus's published
+	// counts, so zero if Bus isn't an eventutil.BusIntrospector.
+	InFlightTxns int `json:"in_flight_txns"`
+	// Results indexed by transaction-result view. Read before
+	// account's event-store, so at most StoredEvents, unless
+	// transactions were skipped (see txn.ZeroAmountSkip).
+	ViewIndex int `json:"view_index"`
+	// Size of account's event-store. Zero if account's
+	// event-repo doesn't provide stats.
+	StoredEvents     int `json:"stored_events"`
+	StoredAggregates int `json:"stored_aggregates"`
+	// Account's events yet to be stored and published.
+	// Zero if account's event-repo has no unpublished-log.
+	UnpublishedEvents int `json:"unpublished_events"`
+	// Aggregates cached by routines, such as account-actors
+	CachedAggregates int `json:"cached_aggregates"`
+	Goroutines       int `json:"goroutines"`
+}
+
+// ComponentDiagnostics is wiring of a routine,
+// along with messages handled by it.
+type ComponentDiagnostics struct {
+	Subscribes []string `json:"subscribes"`
+	Publishes  []string `json:"publishes"`
+	// Nil if routine isn't configured with stats
+	Counts *eventutil.ComponentCounts `json:"counts,omitempty"`
+}
+
+// unpublishedCounter is an event-repo with an unpublished-log,
+// see eventutil.LoggedEventRepo#UnpublishedCount.
+type unpublishedCounter interface {
+	UnpublishedCount() (int, error)
+}
+
+// CollectDiagnostics returns diagnostics of routines in config,
+// and is safe to call while they're running. Stages which are
+// disabled are excluded.
+func CollectDiagnostics(cfg *RoutinesCfg) (*Diagnostics, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	diagnostics := &Diagnostics{
+		Time:       time.Now().UTC(),
+		Components: make(map[string]ComponentDiagnostics),
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	// View is read before event-store and Bus, so results it
+	// indexed are already counted by those, see ViewIndex.
+	if cfg.isEnabled(StageAccountView) {
+		diagnostics.ViewIndex = cfg.ProcessMgrCfg.TxnResultViewRepo.Index()
+	}
+	if cfg.isEnabled(StageAccount) {
+		eventRepo := cfg.AccountCfg.AccountCfg.EventRepo
+		if statsRepo, ok := eventRepo.(eventutil.StoreStatsProvider); ok {
+			stats := statsRepo.StoreStats(0)
+			diagnostics.StoredEvents = stats.Events
+			diagnostics.StoredAggregates = stats.Aggregates
+		}
+		if counter, ok := eventRepo.(unpublishedCounter); ok {
+			unpublished, err := counter.UnpublishedCount()
+			if err != nil {
+				return nil, errors.Wrap(err, "error counting unpublished events of account")
+			}
+			diagnostics.UnpublishedEvents = unpublished
+		}
+	}
+	if introspector, ok := cfg.ProcessMgrCfg.Bus.(eventutil.BusIntrospector); ok {
+		diagnostics.Subscriptions = introspector.SubscriptionStats()
+		processMgrCfg := cfg.ProcessMgrCfg
+		// Skipped transactions aren't sent to
+		// account, but are indexed by view.
+		sent := diagnostics.Subscriptions[processMgrCfg.ProcessTxn.String()].Published
+		if processMgrCfg.TxnSkipped != "" {
+			sent += diagnostics.Subscriptions[processMgrCfg.TxnSkipped.String()].Published
+		}
+		// Negative while customers are being rebuilt, since
+		// their results are removed from view until then.
+		if inFlight := int(sent) - diagnostics.ViewIndex; inFlight > 0 {
+			diagnostics.InFlightTxns = inFlight
+		}
+	}
+
+	subscribed, published := newWiring(cfg).componentActions()
+	for component, actions := range subscribed {
+		componentDiagnostics := diagnostics.Components[component]
+		componentDiagnostics.Subscribes = actions
+		diagnostics.Components[component] = componentDiagnostics
+	}
+	for component, actions := range published {
+		componentDiagnostics := diagnostics.Components[component]
+		componentDiagnostics.Publishes = actions
+		diagnostics.Components[component] = componentDiagnostics
+	}
+	for component, stats := range cfg.componentStats() {
+		componentDiagnostics, exists := diagnostics.Components[component]
+		if !exists || stats == nil {
+			continue
+		}
+		counts := stats.Counts()
+		componentDiagnostics.Counts = &counts
+		diagnostics.Components[component] = componentDiagnostics
+		diagnostics.CachedAggregates += int(counts.Cached)
+	}
+	return diagnostics, nil
+}
+
+// componentStats returns stats of routines which can be
+// configured with these, keyed by component.
+func (cfg *RoutinesCfg) componentStats() map[string]*eventutil.ComponentStats {
+	stats := make(map[string]*eventutil.ComponentStats)
+	if cfg.TxnCreatorCfg != nil {
+		stats["txnCreator"] = cfg.TxnCreatorCfg.Stats
+	}
+	if cfg.AccountCfg != nil {
+		stats["account"] = cfg.AccountCfg.Stats
+	}
+	if cfg.WriterCfg != nil {
+		stats["writer"] = cfg.WriterCfg.Stats
+	}
+	for i, shardWriterCfg := range cfg.ShardWriterCfgs {
+		if shardWriterCfg != nil {
+			stats[fmt.Sprintf("shardWriter-%d", i)] = shardWriterCfg.Stats
+		}
+	}
+	return stats
+}
+
+// initDiagnostics runs diagnostics-routine of config, which
+// dumps diagnostics of routines on every DumpDiagnostics
+// command, until context is done.
+func initDiagnostics(ctx context.Context, cfg *RoutinesCfg) error {
+	diagnosticsCfg := cfg.DiagnosticsCfg
+	err := validator.Validate(diagnosticsCfg)
+	if err != nil {
+		return errors.Wrap(err, "error validating config")
+	}
+	if ctx == nil {
+		return errors.New("context is nil")
+	}
+
+	cmdSub, err := eventutil.SubscribeCmds(diagnosticsCfg.Bus, diagnosticsCfg.DumpDiagnostics)
+	if err != nil {
+		return errors.Wrapf(
+			err,
+			"error subscribing to event-bus for action: %s",
+			diagnosticsCfg.DumpDiagnostics,
+		)
+	}
+	unsubscribe := func() error {
+		if cmdSub == nil {
+			return nil
+		}
+		err := eventutil.UnsubscribeCmds(diagnosticsCfg.Bus, cmdSub, diagnosticsCfg.DumpDiagnostics)
+		cmdSub = nil
+		return errors.Wrapf(
+			err,
+			"error unsubscribing from event-bus for action: %s",
+			diagnosticsCfg.DumpDiagnostics,
+		)
+	}
+	defer unsubscribe()
+
+	diagnosticsCfg.Log.Infof("Starting diagnostics-listener")
+	for {
+		select {
+		case <-ctx.Done():
+			diagnosticsCfg.Log.Debug("Received context-done signal")
+			return unsubscribe()
+
+		case cmd, ok := <-cmdSub:
+			if !ok {
+				return eventutil.SubscriptionClosedError(diagnosticsCfg.DumpDiagnostics.String())
+			}
+			err := dumpDiagnostics(cfg, cmd)
+			if err != nil {
+				return errors.Wrap(err, "error dumping diagnostics")
+			}
+		}
+	}
+}
+
+// dumpDiagnostics logs diagnostics of routines as a
+// single JSON-document, and publishes these as event.
+func dumpDiagnostics(cfg *RoutinesCfg, cmd model.Cmd) error {
+	diagnosticsCfg := cfg.DiagnosticsCfg
+
+	diagnostics, err := CollectDiagnostics(cfg)
+	if err != nil {
+		return errors.Wrap(err, "error collecting diagnostics")
+	}
+	diagnosticsJSON, err := json.Marshal(diagnostics)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling diagnostics")
+	}
+	diagnosticsCfg.Log.Infof("Diagnostics: %s", diagnosticsJSON)
+
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID:    DiagnosticsAggregateID,
+		CausationID:    cmd.CausationID(),
+		CausationKey:   cmd.ID(),
+		CorrelationKey: cmd.CorrelationKey(),
+		Action:         diagnosticsCfg.DiagnosticsDumped,
+		Data:           diagnostics,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating event")
+	}
+	err = diagnosticsCfg.Bus.Publish(event)
+	return errors.Wrapf(err, "error publishing event: %s", diagnosticsCfg.DiagnosticsDumped)
+}
+
+type diagnosticsHandler struct {
+	log logger.Logger
+	cfg *RoutinesCfg
+}
+
+// NewDiagnosticsHandler returns http.Handler serving diagnostics
+// of routines in config (see CollectDiagnostics) as JSON, for
+// requests such as: "GET /debug/diagnostics". Handler should
+// be registered on DiagnosticsPath.
+func NewDiagnosticsHandler(log logger.Logger, cfg *RoutinesCfg) http.Handler {
+	return &diagnosticsHandler{
+		log: log,
+		cfg: cfg,
+	}
+}
+
+func (h *diagnosticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	diagnostics, err := CollectDiagnostics(h.cfg)
+	if err != nil {
+		h.log.Errorf("Error collecting diagnostics: %s", err)
+		http.Error(w, "error collecting diagnostics", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(diagnostics)
+	if err != nil {
+		h.log.Errorf("Error writing diagnostics: %s", err)
+	}
+}
@@ -0,0 +1,217 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// readerFunc is an io.Reader backed by a function. Unlike
+// readers such as io.PipeReader, it isn't walked by config
+// validation, so input can be written while routines start.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+var _ = Describe("Diagnostics", func() {
+	const processMgrIdleTimeoutSec = 2
+
+	var bus *eventutil.MemoryBus
+	var routinesCfg *RoutinesCfg
+	var inputWriter *io.PipeWriter
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+
+		// Input is written by tests, so
+		// diagnostics are dumped mid-run.
+		var inputReader *io.PipeReader
+		inputReader, inputWriter = io.Pipe()
+
+		cfgProvider := domain_test.ConfigProvider{}
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountCfg.Stats = &eventutil.ComponentStats{}
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		txnCreatorCfg.Stats = &eventutil.ComponentStats{}
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg.Stats = &eventutil.ComponentStats{}
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   readerFunc(inputReader.Read),
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg: writerCfg,
+			DiagnosticsCfg: &DiagnosticsCfg{
+				Log:               logger.NewStdLogger("diagnostics"),
+				Bus:               bus,
+				DumpDiagnostics:   model.DumpDiagnostics,
+				DiagnosticsDumped: model.DiagnosticsDumped,
+			},
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	// writeInput writes transactions for customer to input.
+	writeInput := func(custID string, numTxns int) {
+		for i := 0; i < numTxns; i++ {
+			reqBytes, err := json.Marshal(txn.CreateTxnReq{
+				ID:         fmt.Sprintf("%s-%d", custID, i),
+				CustomerID: custID,
+				LoadAmount: "$10",
+				Time:       fmt.Sprintf("2000-01-05T%02d:00:00Z", i),
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = inputWriter.Write(append(reqBytes, '\n'))
+			Expect(err).ToNot(HaveOccurred())
+		}
+	}
+
+	// runRoutines runs routines in background, and returns
+	// channel receiving error of run, once routines subscribe.
+	runRoutines := func() <-chan error {
+		runErr := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, err := RunRoutines(routinesCfg)
+			runErr <- err
+		}()
+		Eventually(func() int {
+			return bus.SubscriptionStats()[model.DumpDiagnostics.String()].Subscribers
+		}).Should(Equal(1))
+		return runErr
+	}
+
+	It("dumps consistent diagnostics mid-run on command", func(done Done) {
+		dumpedSub, err := eventutil.SubscribeEvents(bus, model.DiagnosticsDumped)
+		Expect(err).ToNot(HaveOccurred())
+		runErr := runRoutines()
+
+		writeInput("1", 5)
+		resultRepo := routinesCfg.ProcessMgrCfg.TxnResultViewRepo
+		Eventually(resultRepo.Index, processMgrIdleTimeoutSec/2).Should(Equal(5))
+
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action: model.DumpDiagnostics,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bus.Publish(cmd)).To(Succeed())
+		event := <-dumpedSub
+		Expect(event.CausationKey()).To(Equal(cmd.ID()))
+		diagnostics := &Diagnostics{}
+		Expect(json.Unmarshal(event.RawData(), diagnostics)).To(Succeed())
+
+		writeInput("2", 3)
+		Expect(inputWriter.Close()).To(Succeed())
+		Expect(<-runErr).ToNot(HaveOccurred())
+
+		Expect(diagnostics.ViewIndex).To(Equal(5))
+		Expect(diagnostics.ViewIndex).To(BeNumerically("<=", diagnostics.StoredEvents))
+		Expect(diagnostics.StoredAggregates).To(Equal(1))
+		Expect(diagnostics.InFlightTxns).To(BeNumerically(">=", 0))
+		Expect(diagnostics.UnpublishedEvents).To(BeNumerically(">=", 0))
+		Expect(diagnostics.Goroutines).To(BeNumerically(">", 0))
+
+		Expect(diagnostics.Subscriptions[model.ProcessTxn.String()].Published).To(BeEquivalentTo(5))
+		Expect(diagnostics.Components["account"].Counts).ToNot(BeNil())
+		Expect(diagnostics.Components["account"].Counts.Processed).To(BeNumerically(">", 0))
+		Expect(diagnostics.Components["writer"].Counts.Processed).To(BeZero())
+		// Process-manager isn't configured with stats
+		Expect(diagnostics.Components["processMgr"].Counts).To(BeNil())
+
+		// Actions subscribed on Bus match wiring, except
+		// for this test's own subscription.
+		wiredSubs := make(map[string]bool)
+		for _, component := range diagnostics.Components {
+			for _, action := range component.Subscribes {
+				wiredSubs[action] = true
+			}
+		}
+		busSubs := make(map[string]bool)
+		for action, stats := range diagnostics.Subscriptions {
+			if stats.Subscribers > 0 && action != model.DiagnosticsDumped.String() {
+				busSubs[action] = true
+			}
+		}
+		Expect(busSubs).To(Equal(wiredSubs))
+		Expect(diagnostics.Components["diagnostics"].Subscribes).To(
+			ConsistOf(model.DumpDiagnostics.String()),
+		)
+
+		close(done)
+	}, processMgrIdleTimeoutSec+10)
+
+	It("serves diagnostics over HTTP", func(done Done) {
+		runErr := runRoutines()
+		server := httptest.NewServer(NewDiagnosticsHandler(logger.NewStdLogger("diagnostics/Handler"), routinesCfg))
+		defer server.Close()
+
+		writeInput("1", 2)
+		resultRepo := routinesCfg.ProcessMgrCfg.TxnResultViewRepo
+		Eventually(resultRepo.Index, processMgrIdleTimeoutSec/2).Should(Equal(2))
+
+		resp, err := http.Get(server.URL + DiagnosticsPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		diagnostics := &Diagnostics{}
+		Expect(json.NewDecoder(resp.Body).Decode(diagnostics)).To(Succeed())
+		Expect(diagnostics.ViewIndex).To(Equal(2))
+		Expect(diagnostics.Components).To(HaveKey("txnCreator"))
+
+		postResp, err := http.Post(server.URL+DiagnosticsPath, "application/json", nil)
+		Expect(err).ToNot(HaveOccurred())
+		postResp.Body.Close()
+		Expect(postResp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+
+		Expect(inputWriter.Close()).To(Succeed())
+		Expect(<-runErr).ToNot(HaveOccurred())
+		close(done)
+	}, processMgrIdleTimeoutSec+10)
+})
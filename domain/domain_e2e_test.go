@@ -128,7 +128,7 @@ var _ = Describe("Domain E2E", func() {
 		// ================== Runner ==================
 		routinesGrp = &errgroup.Group{}
 		routinesGrp.Go(func() error {
-			err = RunRoutines(&RoutinesCfg{
+			_, err = RunRoutines(&RoutinesCfg{
 				Log:            logger.NewStdLogger("runner"),
 				ReaderCfg:      readerCfg,
 				TxnCreatorCfg:  txnCreatorCfg,
@@ -0,0 +1,51 @@
+package domain
+
+import "sync"
+
+// errSink collects errors from routines for a single owner
+// (such as process-manager's loop). Errors channel is never
+// closed, so routines can't panic sending on a closed channel.
+// Instead, owner closes the sink once it stops receiving, after
+// which sends are dropped instead of blocking their routines.
+// Use #newErrSink to create new instance.
+type errSink struct {
+	errs      chan error
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+func newErrSink() *errSink {
+	return &errSink{
+		errs:      make(chan error),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+}
+
+// send sends error to owner, and returns false if
+// error was dropped because sink is closed.
+func (s *errSink) send(err error) bool {
+	// Prefer reporting closed sink, in case
+	// owner is also ready to receive.
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	select {
+	case s.errs <- err:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// close stops owner from receiving further errors.
+// Should only be called by owner, and is safe to call
+// multiple times.
+func (s *errSink) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
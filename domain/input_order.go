@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ReportSortMode is order of results in report.
+type ReportSortMode string
+
+// Supported report sort-modes.
+const (
+	// Results are in order these were produced in.
+	ReportSortProduced ReportSortMode = ""
+	// Results are in order their transactions appear in
+	// input, using input-sequence assigned by reader.
+	ReportSortInputOrder ReportSortMode = "input_order"
+)
+
+// InputOrderError is returned by process-manager if results
+// don't cover every input-record exactly once, when verifying
+// input-order (see ProcessMgrCfg#VerifyInputOrder).
+type InputOrderError struct {
+	// Number of records read from input
+	NumRecords uint64
+	// Input-sequences without any result
+	Missing []uint64
+	// Input-sequences with more than one result
+	Duplicated []uint64
+	// Input-sequences of results which weren't read from
+	// input, such as results without an input-sequence (0).
+	Unexpected []uint64
+}
+
+func (e *InputOrderError) Error() string {
+	return fmt.Sprintf(
+		"results don't match %d input-record(s): missing: %v, duplicated: %v, unexpected: %v",
+		e.NumRecords, e.Missing, e.Duplicated, e.Unexpected,
+	)
+}
+
+// checkInputOrder checks that input-sequences of results are
+// a permutation of 1..numRecords. Sequences in excluded (such
+// as of records which failed to create a transaction) count as
+// results of their records. Returns nil if check passes.
+func checkInputOrder(numRecords uint64, resultSeqs []uint64, excluded []uint64) *InputOrderError {
+	counts := make(map[uint64]int)
+	for _, seq := range resultSeqs {
+		counts[seq]++
+	}
+	for _, seq := range excluded {
+		counts[seq]++
+	}
+
+	orderErr := &InputOrderError{
+		NumRecords: numRecords,
+		Missing:    make([]uint64, 0),
+		Duplicated: make([]uint64, 0),
+		Unexpected: make([]uint64, 0),
+	}
+	for seq := uint64(1); seq <= numRecords; seq++ {
+		switch {
+		case counts[seq] == 0:
+			orderErr.Missing = append(orderErr.Missing, seq)
+		case counts[seq] > 1:
+			orderErr.Duplicated = append(orderErr.Duplicated, seq)
+		}
+	}
+	for seq := range counts {
+		if seq == 0 || seq > numRecords {
+			orderErr.Unexpected = append(orderErr.Unexpected, seq)
+		}
+	}
+	sort.Slice(orderErr.Unexpected, func(i, j int) bool {
+		return orderErr.Unexpected[i] < orderErr.Unexpected[j]
+	})
+
+	if len(orderErr.Missing) == 0 &&
+		len(orderErr.Duplicated) == 0 &&
+		len(orderErr.Unexpected) == 0 {
+		return nil
+	}
+	return orderErr
+}
@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// filteredResultRepo drops, or inserts twice, results
+// of specific transactions, simulating results lost
+// or delivered twice.
+type filteredResultRepo struct {
+	*accountview.MemoryTxnResultViewRepo
+	droppedTxnID    string
+	duplicatedTxnID string
+}
+
+func (r *filteredResultRepo) Insert(result accountview.TxnResultEntry) error {
+	switch result.ID {
+	case r.droppedTxnID:
+		return nil
+	case r.duplicatedTxnID:
+		err := r.MemoryTxnResultViewRepo.Insert(result)
+		if err != nil {
+			return err
+		}
+	}
+	return r.MemoryTxnResultViewRepo.Insert(result)
+}
+
+var _ = Describe("Input-order verification", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+	var resultRepo *filteredResultRepo
+	var ioWriter *domain_test.MockWriter
+
+	// Input isn't sorted by customer, so pre-sorted
+	// results are written in a different order.
+	input := []txn.CreateTxnReq{
+		{ID: "1", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+		{ID: "2", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T02:00:00Z"},
+		{ID: "3", CustomerID: "2", LoadAmount: "invalid", Time: "2000-01-05T03:00:00Z"},
+		{ID: "4", CustomerID: "1", LoadAmount: "$6000", Time: "2000-01-05T04:00:00Z"},
+		{ID: "5", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T05:00:00Z"},
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		resultRepo = &filteredResultRepo{
+			MemoryTxnResultViewRepo: accountview.NewMemoryTxnResultViewRepo(
+				accountview.MemoryTxnResultViewRepoCfg{},
+			),
+		}
+		ioWriter = domain_test.NewMockWriter()
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	runRoutines := func() error {
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader(input)
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		accountViewCfg.ResultViewCfg.ResultRepo = resultRepo
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:        logger.NewStdLogger("reader"),
+				Bus:        bus,
+				Reader:     ioReader,
+				DataRead:   model.TxnRead,
+				PreSortKey: NewTxnSortKeyFunc(txnCreatorCfg.CreatorCfg.DefaultTimeFmt),
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: resultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				OrderedDispatch:  true,
+				ReportSort:       ReportSortInputOrder,
+				VerifyInputOrder: true,
+			},
+			WriterCfg: writerCfg,
+		})
+		return err
+	}
+
+	// Returns InputOrderError returned by process-manager
+	inputOrderErr := func(err error) *InputOrderError {
+		var runErr *RunError
+		Expect(errors.As(err, &runErr)).To(BeTrue(), err.Error())
+		Expect(runErr.RootCause).ToNot(BeNil())
+		Expect(runErr.RootCause.Component).To(Equal("processMgr"))
+
+		var orderErr *InputOrderError
+		Expect(errors.As(runErr.RootCause.Err, &orderErr)).To(BeTrue(), err.Error())
+		return orderErr
+	}
+
+	It("writes report in input-order", func(done Done) {
+		err := runRoutines()
+		Expect(err).ToNot(HaveOccurred())
+
+		// Invalid transaction "3" has no result
+		ids := make([]string, 0)
+		for _, line := range strings.Split(string(ioWriter.Content()), "\n") {
+			result := accountview.TxnResultEntry{}
+			Expect(json.Unmarshal([]byte(line), &result)).To(Succeed())
+			ids = append(ids, result.ID)
+		}
+		Expect(ids).To(Equal([]string{"1", "2", "4", "5"}))
+
+		// Results were produced in pre-sorted order
+		producedIDs := make([]string, 0)
+		for _, entry := range resultRepo.Entries() {
+			producedIDs = append(producedIDs, entry.ID)
+		}
+		Expect(producedIDs).To(Equal([]string{"2", "4", "1", "5"}))
+		close(done)
+	}, 10)
+
+	It("reports input-sequence of dropped result", func(done Done) {
+		resultRepo.droppedTxnID = "4"
+
+		orderErr := inputOrderErr(runRoutines())
+		Expect(orderErr.NumRecords).To(Equal(uint64(5)))
+		Expect(orderErr.Missing).To(Equal([]uint64{4}))
+		Expect(orderErr.Duplicated).To(BeEmpty())
+		Expect(orderErr.Unexpected).To(BeEmpty())
+		// Report isn't written
+		Expect(ioWriter.Content()).To(BeEmpty())
+		close(done)
+	}, 10)
+
+	It("reports duplicated result masking a dropped one", func(done Done) {
+		resultRepo.droppedTxnID = "1"
+		resultRepo.duplicatedTxnID = "5"
+
+		orderErr := inputOrderErr(runRoutines())
+		Expect(orderErr.Missing).To(Equal([]uint64{1}))
+		Expect(orderErr.Duplicated).To(Equal([]uint64{5}))
+		Expect(orderErr.Error()).To(ContainSubstring("missing: [1], duplicated: [5]"))
+		close(done)
+	}, 10)
+})
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Prometheus metrics", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+	var promMetrics *metrics.Prometheus
+
+	BeforeEach(func() {
+		var err error
+		promMetrics, err = metrics.NewPrometheus(&metrics.PrometheusCfg{})
+		Expect(err).ToNot(HaveOccurred())
+		bus, err = eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+			Log:     logger.NewStdLogger("EventBus"),
+			Metrics: promMetrics,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("exposes metrics of instrumented points after a flow", func(done Done) {
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountCfg.Metrics = promMetrics
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		accountViewCfg.ResultViewCfg.Metrics = promMetrics
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+				Metrics:  promMetrics,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg: writerCfg,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		server := httptest.NewServer(promMetrics.Handler())
+		defer server.Close()
+		resp, err := http.Get(server.URL + metrics.MetricsPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(string(body)).To(SatisfyAll(
+			ContainSubstring("es_bank_account_lines_read_total 2"),
+			ContainSubstring(`es_bank_account_bus_messages_published_total{action="TxnRead"} 2`),
+			ContainSubstring(`es_bank_account_bus_messages_published_total{action="DataWritten"} 1`),
+			// Second transaction is a duplicate
+			ContainSubstring(`es_bank_account_txn_results_total{result="accepted"} 1`),
+			ContainSubstring(`es_bank_account_txn_results_total{result="declined"} 1`),
+			ContainSubstring("es_bank_account_txn_processing_seconds_count 2"),
+			ContainSubstring("es_bank_account_view_hydration_seconds_count"),
+		))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// ShardOf returns output-shard results of customer are
+// written to, out of numShards (see ProcessMgrCfg#ShardWriteData).
+// Shard of a customer is same across runs.
+func ShardOf(custID string, numShards int) int {
+	if numShards <= 1 {
+		return 0
+	}
+	hash := fnv.New32a()
+	// Writes to hash never fail
+	_, _ = hash.Write([]byte(custID))
+	return int(hash.Sum32() % uint32(numShards))
+}
+
+// shardWriteCmds returns command writing results of every
+// output-shard, and total size of written data. Results
+// of customers are grouped, in order of customer-ids.
+// Shards without results are skipped.
+func (p *processMgr) shardWriteCmds() ([]model.Cmd, int, error) {
+	byCustomer := p.customerResultRepo.ByCustomer()
+	custIDs := make([]string, 0, len(byCustomer))
+	for custID := range byCustomer {
+		custIDs = append(custIDs, custID)
+	}
+	sort.Strings(custIDs)
+
+	shardLines := make([][]string, len(p.shardWriteData))
+	for _, custID := range custIDs {
+		shard := ShardOf(custID, len(p.shardWriteData))
+		for _, entry := range byCustomer[custID] {
+			entryBytes, err := json.Marshal(entry)
+			if err != nil {
+				return nil, 0, errors.Wrap(err, "error marshalling result")
+			}
+			shardLines[shard] = append(shardLines[shard], string(entryBytes))
+		}
+	}
+
+	cmds := make([]model.Cmd, 0, len(shardLines))
+	size := 0
+	for shard, lines := range shardLines {
+		if len(lines) == 0 {
+			continue
+		}
+		data := []byte(strings.Join(lines, "\n"))
+		size += len(data)
+		if p.payloadEnvelope {
+			payload, err := writer.NewPayloadBuilder(data).Build()
+			if err != nil {
+				return nil, 0, errors.Wrapf(err, "error building payload for shard %d", shard)
+			}
+			data = payload
+		}
+		action := p.shardWriteData[shard]
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action:   action,
+			Data:     data,
+			Priority: model.PriorityControl,
+		})
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "error creating '%s' command", action)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, size, nil
+}
@@ -0,0 +1,177 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Output-shards", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	readResults := func(data string) []accountview.TxnResultEntry {
+		results := make([]accountview.TxnResultEntry, 0)
+		for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+			if line == "" {
+				continue
+			}
+			result := accountview.TxnResultEntry{}
+			err := json.Unmarshal([]byte(line), &result)
+			Expect(err).ToNot(HaveOccurred())
+			results = append(results, result)
+		}
+		return results
+	}
+
+	It("assigns customers to same shard every time", func() {
+		Expect(ShardOf("1", 2)).To(Equal(0))
+		Expect(ShardOf("2", 2)).To(Equal(1))
+		Expect(ShardOf("3", 2)).To(Equal(0))
+		Expect(ShardOf("4", 2)).To(Equal(1))
+		for i := 0; i < 100; i++ {
+			custID := fmt.Sprint(i)
+			Expect(ShardOf(custID, 3)).To(Equal(ShardOf(custID, 3)))
+			Expect(ShardOf(custID, 3)).To(BeNumerically("<", 3))
+			Expect(ShardOf(custID, 1)).To(BeZero())
+		}
+	})
+
+	It("writes results of every customer to its shard, along with report", func(done Done) {
+		const numShards = 2
+
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "3", CustomerID: "1", LoadAmount: "$6000", Time: "2000-01-05T02:00:00Z"},
+			{ID: "4", CustomerID: "3", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+			{ID: "5", CustomerID: "4", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter := domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		shardWriters := make([]*domain_test.MockWriter, 0, numShards)
+		shardWriterCfgs := make([]*writer.CmdListenerCfg, 0, numShards)
+		shardWriteData := make([]model.CmdAction, 0, numShards)
+		for shard := 0; shard < numShards; shard++ {
+			shardWriter := domain_test.NewMockWriter()
+			shardWriterCfg, err := cfgProvider.WriterRunCfg(bus, shardWriter)
+			Expect(err).ToNot(HaveOccurred())
+			shardWriterCfg.WriteData = model.CmdAction(fmt.Sprintf("%s.%d", model.WriteData, shard))
+
+			shardWriters = append(shardWriters, shardWriter)
+			shardWriterCfgs = append(shardWriterCfgs, shardWriterCfg)
+			shardWriteData = append(shardWriteData, shardWriterCfg.WriteData)
+		}
+
+		_, err = RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:           model.TxnRead,
+				TxnCreated:        model.TxnCreated,
+				TxnCreateFailed:   model.TxnCreateFailed,
+				ReportWritten:     model.DataWritten,
+				ReportWriteFailed: model.WriteFailed,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				PayloadEnvelope: true,
+				ShardWriteData:  shardWriteData,
+			},
+			WriterCfg:       writerCfg,
+			ShardWriterCfgs: shardWriterCfgs,
+			WiringCheck:     WiringCheckStrict,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		// Combined report has results of all customers
+		Expect(readResults(string(ioWriter.Content()))).To(HaveLen(5))
+
+		// Customers "1" and "3" hash to shard 0,
+		// while "2" and "4" hash to shard 1.
+		Expect(readResults(string(shardWriters[0].Content()))).To(ConsistOf(
+			accountview.TxnResultEntry{ID: "1", CustomerID: "1", Accepted: true},
+			accountview.TxnResultEntry{ID: "3", CustomerID: "1", Accepted: false},
+			accountview.TxnResultEntry{ID: "4", CustomerID: "3", Accepted: true},
+		))
+		Expect(readResults(string(shardWriters[1].Content()))).To(ConsistOf(
+			accountview.TxnResultEntry{ID: "2", CustomerID: "2", Accepted: true},
+			accountview.TxnResultEntry{ID: "5", CustomerID: "4", Accepted: true},
+		))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("errors if shard-actions are reused", func() {
+		err := (&ProcessMgrCfg{
+			Log:               logger.NewStdLogger("ProcessMgr"),
+			Bus:               bus,
+			TxnResultViewRepo: accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{}),
+
+			WriteData:  model.WriteData,
+			CreateTxn:  model.CreateTxn,
+			ProcessTxn: model.ProcessTxn,
+
+			TxnRead:         model.TxnRead,
+			TxnCreated:      model.TxnCreated,
+			TxnCreateFailed: model.TxnCreateFailed,
+			ReportWritten:   model.DataWritten,
+
+			IdleTimeoutSec:               processMgrIdleTimeoutSec,
+			ReportWrittenEventTimeoutSec: 3,
+
+			ShardWriteData: []model.CmdAction{"WriteData.0", model.WriteData},
+		}).Validate()
+		Expect(err).To(MatchError(ContainSubstring("already used")))
+	})
+})
@@ -0,0 +1,357 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Per-customer output", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+	var outputDir string
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		tmpDir, err := ioutil.TempDir("", "per-customer-output")
+		Expect(err).ToNot(HaveOccurred())
+		// Created by writer
+		outputDir = filepath.Join(tmpDir, "results")
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+		os.RemoveAll(filepath.Dir(outputDir))
+	})
+
+	readResults := func(data string) []accountview.TxnResultEntry {
+		results := make([]accountview.TxnResultEntry, 0)
+		for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+			result := accountview.TxnResultEntry{}
+			err := json.Unmarshal([]byte(line), &result)
+			Expect(err).ToNot(HaveOccurred())
+			results = append(results, result)
+		}
+		return results
+	}
+
+	It("writes results of every customer to their own file, along with report", func(done Done) {
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "3", CustomerID: "1", LoadAmount: "$6000", Time: "2000-01-05T02:00:00Z"},
+			{ID: "4", CustomerID: "3", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+			{ID: "5", CustomerID: "../4", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter := domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg.WriterCfg.AllowFileTargets = true
+
+		summary, err := RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				PayloadEnvelope:      true,
+				PerCustomerOutputDir: outputDir,
+			},
+			WriterCfg: writerCfg,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.UnsafeCustomerIDs).To(Equal([]string{"../4"}))
+
+		// Combined report has results of all customers
+		Expect(readResults(string(ioWriter.Content()))).To(HaveLen(5))
+
+		files, err := ioutil.ReadDir(outputDir)
+		Expect(err).ToNot(HaveOccurred())
+		fileNames := make([]string, 0)
+		for _, file := range files {
+			fileNames = append(fileNames, file.Name())
+		}
+		sort.Strings(fileNames)
+		Expect(fileNames).To(Equal([]string{"1.ndjson", "2.ndjson", "3.ndjson"}))
+
+		expected := map[string][]accountview.TxnResultEntry{
+			"1": {
+				{ID: "1", CustomerID: "1", Accepted: true},
+				{ID: "3", CustomerID: "1", Accepted: false},
+			},
+			"2": {{ID: "2", CustomerID: "2", Accepted: true}},
+			"3": {{ID: "4", CustomerID: "3", Accepted: true}},
+		}
+		for custID, results := range expected {
+			data, err := ioutil.ReadFile(filepath.Join(outputDir, custID+".ndjson"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readResults(string(data))).To(ConsistOf(results), custID)
+		}
+		// Unsafe customer-id isn't written outside directory
+		_, err = os.Stat(filepath.Join(filepath.Dir(outputDir), "4.ndjson"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	Context("customer-grouped input", func() {
+		// Targets of write-commands, in order these are published.
+		// Report has blank target.
+		var writeTargets func() []string
+
+		BeforeEach(func() {
+			writeSub, err := bus.Subscribe(model.WriteData.String())
+			Expect(err).ToNot(HaveOccurred())
+
+			lock := &sync.Mutex{}
+			targets := make([]string, 0)
+			go func() {
+				for msg := range writeSub {
+					cmd, isCmd := msg.(model.Cmd)
+					if !isCmd {
+						continue
+					}
+					payload := &writer.Payload{}
+					data := bytes.TrimPrefix(cmd.RawData(), []byte(writer.PayloadMagic))
+					if json.Unmarshal(data, payload) != nil {
+						continue
+					}
+					target := payload.Target
+					if target != "" {
+						target = filepath.Base(target)
+					}
+					lock.Lock()
+					targets = append(targets, target)
+					lock.Unlock()
+				}
+			}()
+			writeTargets = func() []string {
+				lock.Lock()
+				defer lock.Unlock()
+				return append([]string{}, targets...)
+			}
+		})
+
+		run := func(
+			reqs []txn.CreateTxnReq,
+			stragglerPolicy StragglerPolicy,
+		) (*RunSummary, *domain_test.MockWriter) {
+			cfgProvider := domain_test.ConfigProvider{}
+			ioReader, err := domain_test.NewMockReader(reqs)
+			Expect(err).ToNot(HaveOccurred())
+			ioWriter := domain_test.NewMockWriter()
+
+			accountCfg, err := cfgProvider.AccountRunCfg(bus)
+			Expect(err).ToNot(HaveOccurred())
+			accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+			txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+			Expect(err).ToNot(HaveOccurred())
+			writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+			Expect(err).ToNot(HaveOccurred())
+			writerCfg.WriterCfg.AllowFileTargets = true
+
+			summary, err := RunRoutines(&RoutinesCfg{
+				Log: logger.NewStdLogger("runner"),
+				ReaderCfg: &reader.Cfg{
+					Log:      logger.NewStdLogger("reader"),
+					Bus:      bus,
+					Reader:   ioReader,
+					DataRead: model.TxnRead,
+				},
+				TxnCreatorCfg:  txnCreatorCfg,
+				AccountCfg:     accountCfg,
+				AccountViewCfg: accountViewCfg,
+				ProcessMgrCfg: &ProcessMgrCfg{
+					Log:               logger.NewStdLogger("ProcessMgr"),
+					Bus:               bus,
+					TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+					WriteData:  model.WriteData,
+					CreateTxn:  model.CreateTxn,
+					ProcessTxn: model.ProcessTxn,
+
+					TxnRead:         model.TxnRead,
+					TxnCreated:      model.TxnCreated,
+					TxnCreateFailed: model.TxnCreateFailed,
+					ReportWritten:   model.DataWritten,
+
+					IdleTimeoutSec:               processMgrIdleTimeoutSec,
+					ReportWrittenEventTimeoutSec: 3,
+
+					PayloadEnvelope:      true,
+					PerCustomerOutputDir: outputDir,
+					CustomerGrouped:      true,
+					StragglerPolicy:      stragglerPolicy,
+				},
+				WriterCfg: writerCfg,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			return summary, ioWriter
+		}
+
+		readCustomer := func(custID string) []accountview.TxnResultEntry {
+			data, err := ioutil.ReadFile(filepath.Join(outputDir, custID+".ndjson"))
+			Expect(err).ToNot(HaveOccurred())
+			return readResults(string(data))
+		}
+
+		It("writes output of every customer once its group ends", func(done Done) {
+			summary, ioWriter := run([]txn.CreateTxnReq{
+				{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+				{ID: "2", CustomerID: "1", LoadAmount: "$6000", Time: "2000-01-05T02:00:00Z"},
+				{ID: "3", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+				// Invalid, has no result
+				{ID: "4", CustomerID: "2", LoadAmount: "invalid", Time: "2000-01-05T02:00:00Z"},
+				{ID: "5", CustomerID: "3", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+			}, "")
+			Expect(summary.Stragglers).To(BeZero())
+			Expect(readResults(string(ioWriter.Content()))).To(HaveLen(4))
+
+			// Outputs of customers whose group ended are written
+			// before report. Last customer's group ends at drain,
+			// so its output is written along with report.
+			targets := writeTargets()
+			Expect(targets).To(HaveLen(4))
+			Expect(targets[:2]).To(ConsistOf("1.ndjson", "2.ndjson"))
+			Expect(targets[2:]).To(Equal([]string{"", "3.ndjson"}))
+
+			Expect(readCustomer("1")).To(Equal([]accountview.TxnResultEntry{
+				{ID: "1", CustomerID: "1", Accepted: true},
+				{ID: "2", CustomerID: "1", Accepted: false},
+			}))
+			Expect(readCustomer("2")).To(Equal([]accountview.TxnResultEntry{
+				{ID: "3", CustomerID: "2", Accepted: true},
+			}))
+			Expect(readCustomer("3")).To(Equal([]accountview.TxnResultEntry{
+				{ID: "5", CustomerID: "3", Accepted: true},
+			}))
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+
+		stragglerReqs := []txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "3", CustomerID: "3", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			// Straggler, customer's group already ended
+			{ID: "4", CustomerID: "1", LoadAmount: "$20", Time: "2000-01-05T02:00:00Z"},
+			{ID: "5", CustomerID: "3", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+		}
+
+		It("appends stragglers to customer's output", func(done Done) {
+			summary, ioWriter := run(stragglerReqs, StragglerAppend)
+			// Appended straggler ends group of customer before
+			// it, so next line of that customer is a straggler too.
+			Expect(summary.Stragglers).To(Equal(2))
+			Expect(readResults(string(ioWriter.Content()))).To(HaveLen(5))
+
+			Expect(readCustomer("1")).To(Equal([]accountview.TxnResultEntry{
+				{ID: "1", CustomerID: "1", Accepted: true},
+				{ID: "4", CustomerID: "1", Accepted: true},
+			}))
+			Expect(readCustomer("3")).To(Equal([]accountview.TxnResultEntry{
+				{ID: "3", CustomerID: "3", Accepted: true},
+				{ID: "5", CustomerID: "3", Accepted: true},
+			}))
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+
+		It("rejects stragglers if configured", func(done Done) {
+			summary, ioWriter := run(stragglerReqs, StragglerReject)
+			Expect(summary.Stragglers).To(Equal(1))
+			Expect(summary.LinesRead).To(Equal(5))
+
+			// Straggler has no result
+			report := readResults(string(ioWriter.Content()))
+			Expect(report).To(HaveLen(4))
+			for _, result := range report {
+				Expect(result.ID).ToNot(Equal("4"))
+			}
+			Expect(readCustomer("1")).To(Equal([]accountview.TxnResultEntry{
+				{ID: "1", CustomerID: "1", Accepted: true},
+			}))
+			// Group of customer after straggler isn't ended by it
+			Expect(readCustomer("3")).To(Equal([]accountview.TxnResultEntry{
+				{ID: "3", CustomerID: "3", Accepted: true},
+				{ID: "5", CustomerID: "3", Accepted: true},
+			}))
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+
+		It("requires per-customer output", func() {
+			err := (&ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{}),
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				PayloadEnvelope: true,
+				CustomerGrouped: true,
+			}).Validate()
+			Expect(err).To(MatchError(ContainSubstring("requires per-customer output")))
+		})
+	})
+})
@@ -1,19 +1,29 @@
 package domain
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/validator.v2"
 
+	"github.com/Jaskaranbir/es-bank-account/clock"
 	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
 	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/trace"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
 )
 
 // processMgr handles coordinating the overall application-flow,
@@ -23,6 +33,7 @@ type processMgr struct {
 	log               logger.Logger
 	bus               eventutil.Bus
 	txnResultViewRepo accountview.TxnResultViewRepo
+	clock             clock.Clock
 
 	writeData  model.CmdAction
 	createTxn  model.CmdAction
@@ -32,13 +43,123 @@ type processMgr struct {
 	txnCreated      model.EventAction
 	txnCreateFailed model.EventAction
 	reportWritten   model.EventAction
+	// Optional
+	reportWriteFailed model.EventAction
+	txnReadFailed     model.EventAction
+	txnSkipped        model.EventAction
+
+	// Set if reader failed before reaching end of input
+	readFailure *reader.ReadFailure
+
+	// Counts of TxnRead and TxnCreated events
+	// received before draining completed.
+	linesRead int
+	validTxns int
+	// Lines whose create-command was published, which are
+	// yet to be created, failed or skipped. Draining waits
+	// for these, since created transactions still need
+	// their process-commands.
+	awaitingCreate int
+	// Count of TxnSkipped events, which
+	// aren't counted as valid transactions.
+	skippedTxns int
+	// Report is prefixed with a ReportHeader if either is set
+	failOnEmptyInput    bool
+	failOnZeroValidTxns bool
+	// If set, report is wrapped in a writer.Payload
+	payloadEnvelope bool
+	// Set along with repo providing results by input-sequence,
+	// if report is sorted or verified by input-order.
+	reportSort       ReportSortMode
+	verifyInputOrder bool
+	sequencedRepo    accountview.SequencedTxnResultViewRepo
+	// Highest input-sequence of TxnRead events received,
+	// and input-sequences of TxnCreateFailed events.
+	lastInputSeq     uint64
+	createFailedSeqs []uint64
+	// Optional, quarantined events are noted in report
+	quarantine *accountview.EventQuarantine
+	// Optional, warning-counts are noted in report
+	reportWarnings *warnings.MemoryCollector
+	// If set, results are streamed to writer by view,
+	// so report only has its header and trailer. Results
+	// streamed in this run are those inserted beyond
+	// view-repo's index at start, and the number of these
+	// confirmed written is counted from writer's events.
+	streamedResults  bool
+	streamStartIndex int
+	numStreamed      int
+	// If set, results of every customer are also written
+	// to a file in this directory. Set along with repo
+	// providing results by customer.
+	perCustomerOutputDir string
+	customerResultRepo   accountview.CustomerTxnResultViewRepo
+	// Actions of writers of output-shards, by shard
+	shardWriteData []model.CmdAction
+	// Set if input is grouped by customer, so customers'
+	// outputs are written as soon as their groups end.
+	customerGroups *customerGroups
+	// If set, a ProcessingSummary is written to this
+	// file along with report. Set along with repo
+	// providing counts of results.
+	summaryFilePath string
+	countingRepo    accountview.CountingTxnResultViewRepo
+	// Time process-manager started, noted in summary
+	startedAt time.Time
+	// Customers whose results weren't written to a
+	// file, since their IDs are unsafe as file-names.
+	unsafeCustomerIDs []string
+	// Correlation-keys of flows with valid transactions,
+	// only tracked if tracer is set. Every such flow gets
+	// a span for writing report.
+	tracer      trace.Tracer
+	tracedFlows []string
+	// Only accessed by process-loop
+	stage shutdownStage
+	// Set once report is written, if run is flagged as empty
+	emptyRunErr *EmptyRunError
+
+	// Optional, commands are stamped with current epoch
+	flowEpoch *eventutil.FlowEpoch
+	// Tracks routines publishing commands, so
+	// these are drained before writing report.
+	pending *routineTracker
+	// Each routine publishing commands waits for previous
+	// routine publishing same command-type for same customer,
+	// so commands of a customer are published in order of
+	// their events. If set, routines wait for previous routine
+	// of any customer instead. See #dispatchTurn.
+	orderedDispatch bool
+	// Latest turns of customers, removed once these end
+	// without a later turn, so only customers with routines
+	// in flight are tracked.
+	turnsLock         *sync.Mutex
+	lastCreateTxnPub  map[string]<-chan struct{}
+	lastProcessTxnPub map[string]<-chan struct{}
 
 	idleTimeoutSec               int
 	reportWrittenEventTimeoutSec int
+	reportTimeoutPerMB           float64
+	reportTimeoutMinSec          int
+	reportTimeoutMaxSec          int
 
-	eventSubs map[model.EventAction]<-chan interface{}
+	eventSubs map[model.EventAction]<-chan model.Event
 }
 
+// shutdownStage is stage of process-manager's shutdown.
+type shutdownStage int
+
+const (
+	// Processing events
+	stageRunning shutdownStage = iota
+	// Context is done, waiting for transactions in
+	// flight, and routines publishing their commands.
+	stageDraining
+	// Report is sent to writer, waiting
+	// for it to be written.
+	stageReporting
+)
+
 // ProcessMgrCfg is config for processMgr.
 type ProcessMgrCfg struct {
 	Log               logger.Logger                 `validate:"nonnil"`
@@ -53,19 +174,260 @@ type ProcessMgrCfg struct {
 	TxnCreated      model.EventAction `validate:"nonzero"`
 	TxnCreateFailed model.EventAction `validate:"nonzero"`
 	ReportWritten   model.EventAction `validate:"nonzero"`
+	// Optional, waiting for ReportWritten event
+	// is aborted when this event is received.
+	ReportWriteFailed model.EventAction
+	// Optional, report is marked as partial
+	// when this event is received.
+	TxnReadFailed model.EventAction
+	// Optional, must be set if txn-creator skips transactions
+	// (see txn.ZeroAmountSkip), which are then accounted for
+	// along with created transactions, without being counted
+	// as valid transactions.
+	TxnSkipped model.EventAction
 
 	// Closes context if no message
 	// is received within timeout
 	IdleTimeoutSec               int `validate:"min=1"`
 	ReportWrittenEventTimeoutSec int `validate:"min=1"`
+	// Scales timeout for ReportWritten event by
+	// size of report (seconds per MB of report).
+	// Set to 0 to use ReportWrittenEventTimeoutSec
+	// as a fixed timeout.
+	ReportTimeoutPerMB float64 `validate:"min=0"`
+	// Bounds for scaled timeout. Min defaults to
+	// ReportWrittenEventTimeoutSec, and Max is set
+	// to 0 to disable upper-bound.
+	ReportTimeoutMinSec int `validate:"min=0"`
+	ReportTimeoutMaxSec int `validate:"min=0"`
+
+	// Optional, defaults to clock.RealClock
+	Clock clock.Clock
+	// Optional. If set, commands are stamped with current
+	// flow-epoch, and epoch is advanced once draining
+	// completes, before writing report. Should be shared
+	// with command-listeners so late commands are rejected.
+	// Draining waits for listeners to admit commands (see
+	// FlowEpoch#Admit), up to idle-timeout.
+	FlowEpoch *eventutil.FlowEpoch
+	// Optional. If set, commands are published in same order
+	// as events they're created from, so transactions are
+	// processed in order these were read. Required if input
+	// is pre-sorted by reader. Commands of same customer are
+	// always published in this order.
+	OrderedDispatch bool
+	// Optional. If set, process-manager returns an EmptyRunError
+	// after writing report if no lines were read from input.
+	FailOnEmptyInput bool
+	// Optional. If set, process-manager returns an EmptyRunError
+	// after writing report if no valid transactions were read.
+	FailOnZeroValidTxns bool
+	// Optional. If set, report is sent to writer wrapped in
+	// a versioned writer.Payload envelope, instead of as raw
+	// data. Writers accept both.
+	PayloadEnvelope bool
+	// Optional, should be shared with transaction-result view.
+	// Number of quarantined events is noted in report-trailer.
+	Quarantine *accountview.EventQuarantine
+	// Optional, should be shared with RoutinesCfg#Warnings. If
+	// set, counts of warnings collected until report is written
+	// are noted in report-trailer, which is written if any
+	// warnings were collected.
+	ReportWarnings *warnings.MemoryCollector
+	// Optional. If set, along with report, results of every
+	// customer are written to "<dir>/<customer_id>.ndjson".
+	// Customers whose IDs are unsafe as file-names are
+	// skipped, and noted in RunSummary. Requires
+	// PayloadEnvelope, and TxnResultViewRepo to be an
+	// accountview.CustomerTxnResultViewRepo.
+	PerCustomerOutputDir string
+	// Optional. If set, input is expected to be grouped by customer
+	// (such as when pre-sorted), and output of every customer is
+	// written once a line of another customer is read after its
+	// group, and all of its transactions have results, instead of
+	// along with report. Requires PerCustomerOutputDir.
+	CustomerGrouped bool
+	// Optional, defaults to StragglerAppend. Handles lines of
+	// customers whose group already ended, if CustomerGrouped.
+	StragglerPolicy StragglerPolicy
+	// Optional. If set, along with report, results are sharded
+	// across these actions by hash of customer-id (see ShardOf),
+	// each of which should be handled by its own writer-instance
+	// (publishing on ReportWritten). Results of shard are sent on
+	// action at its index. Requires TxnResultViewRepo to be an
+	// accountview.CustomerTxnResultViewRepo.
+	ShardWriteData []model.CmdAction
+	// Optional. If set, along with report, a single-line
+	// ProcessingSummary is written to this file. Requires
+	// PayloadEnvelope, and TxnResultViewRepo to be an
+	// accountview.CountingTxnResultViewRepo.
+	SummaryFilePath string
+	// Optional, defaults to ReportSortProduced.
+	// ReportSortInputOrder requires TxnResultViewRepo
+	// to be an accountview.SequencedTxnResultViewRepo.
+	ReportSort ReportSortMode
+	// Optional. If set, once draining, process-manager checks
+	// that report has exactly one result for every transaction
+	// read from input (using input-sequences assigned by reader),
+	// and returns an InputOrderError without writing report
+	// otherwise. Unlike comparing counts, this catches a lost
+	// result masked by a duplicated one. Requires TxnResultViewRepo
+	// to be an accountview.SequencedTxnResultViewRepo.
+	VerifyInputOrder bool
+	// Optional, records span of writing report for
+	// every valid transaction, keyed by its flow's
+	// correlation-key.
+	Tracer trace.Tracer
+	// Optional. If set, results are expected to be streamed to
+	// writer by transaction-result view as these're inserted (see
+	// NewResultStreamer), so report
+	// only has its header and trailer, if any, written after the
+	// streamed results. Writes of streamed results are confirmed
+	// along with report. Test transactions are streamed along
+	// with others, instead of in a section of their own.
+	// Incompatible with ReportSortInputOrder.
+	StreamedResults bool
+}
+
+// ReportHeader is prepended as first line of report
+// if any of the empty-run checks are enabled (see
+// ProcessMgrCfg#FailOnEmptyInput and #FailOnZeroValidTxns).
+type ReportHeader struct {
+	LinesRead int `json:"lines_read"`
+	ValidTxns int `json:"valid_txns"`
+}
+
+// ReportTrailer is appended as last line of report
+// if report covers the input only partially, if
+// results of some events were quarantined, or if
+// warnings are reported (see ProcessMgrCfg#ReportWarnings).
+type ReportTrailer struct {
+	Partial   bool `json:"partial"`
+	LinesRead int  `json:"lines_read"`
+	// Events skipped by transaction-result view,
+	// whose results are missing from report.
+	QuarantinedEvents int `json:"quarantined_events,omitempty"`
+	// Warnings collected during run, keyed by code
+	Warnings warnings.Counts `json:"warnings,omitempty"`
 }
 
 // InitProcessMgr validates process-manager
 // config and runs process-manager.
 func InitProcessMgr(ctx context.Context, cfg *ProcessMgrCfg) error {
+	runner, err := newProcessMgr(cfg)
+	if err != nil {
+		return err
+	}
+	err = runner.start(ctx)
+	return errors.Wrap(err, "process-loop returned with error")
+}
+
+// Validate validates config, including invariants between its fields.
+func (cfg *ProcessMgrCfg) Validate() error {
 	err := validator.Validate(cfg)
 	if err != nil {
-		return errors.Wrap(err, "error validating config")
+		return err
+	}
+	if cfg.ReportTimeoutMaxSec > 0 &&
+		cfg.ReportTimeoutMaxSec < cfg.ReportTimeoutMinSec {
+		return errors.New("max report-timeout must be greater than min report-timeout")
+	}
+	if cfg.PerCustomerOutputDir != "" {
+		if !cfg.PayloadEnvelope {
+			return errors.New("per-customer output requires payload-envelope")
+		}
+		_, castSuccess := cfg.TxnResultViewRepo.(accountview.CustomerTxnResultViewRepo)
+		if !castSuccess {
+			return errors.New(
+				"per-customer output requires transaction-result view-repo providing results by customer",
+			)
+		}
+	}
+	if len(cfg.ShardWriteData) > 0 {
+		_, castSuccess := cfg.TxnResultViewRepo.(accountview.CustomerTxnResultViewRepo)
+		if !castSuccess {
+			return errors.New(
+				"sharded output requires transaction-result view-repo providing results by customer",
+			)
+		}
+		actions := map[model.CmdAction]bool{cfg.WriteData: true}
+		for i, action := range cfg.ShardWriteData {
+			if action == "" {
+				return fmt.Errorf("shard-action at index %d is blank", i)
+			}
+			if actions[action] {
+				return fmt.Errorf("shard-action at index %d is already used: %s", i, action)
+			}
+			actions[action] = true
+		}
+	}
+	if cfg.CustomerGrouped && cfg.PerCustomerOutputDir == "" {
+		return errors.New("customer-grouped input requires per-customer output")
+	}
+	switch cfg.StragglerPolicy {
+	case "", StragglerAppend, StragglerReject:
+	default:
+		return fmt.Errorf("invalid straggler-policy: %s", cfg.StragglerPolicy)
+	}
+	if cfg.SummaryFilePath != "" {
+		if !cfg.PayloadEnvelope {
+			return errors.New("summary-file requires payload-envelope")
+		}
+		_, castSuccess := cfg.TxnResultViewRepo.(accountview.CountingTxnResultViewRepo)
+		if !castSuccess {
+			return errors.New(
+				"summary-file requires transaction-result view-repo providing counts of results",
+			)
+		}
+	}
+	switch cfg.ReportSort {
+	case ReportSortProduced, ReportSortInputOrder:
+	default:
+		return fmt.Errorf("invalid report sort-mode: %s", cfg.ReportSort)
+	}
+	if cfg.StreamedResults && cfg.ReportSort == ReportSortInputOrder {
+		return errors.New("streamed results can't be sorted by input-order")
+	}
+	if cfg.ReportSort == ReportSortInputOrder || cfg.VerifyInputOrder {
+		_, castSuccess := cfg.TxnResultViewRepo.(accountview.SequencedTxnResultViewRepo)
+		if !castSuccess {
+			return errors.New(
+				"input-order requires transaction-result view-repo providing results by input-sequence",
+			)
+		}
+	}
+	return nil
+}
+
+// newProcessMgr validates config, and creates process-manager
+// subscribed to its actions on Bus. Use #start to run it.
+func newProcessMgr(cfg *ProcessMgrCfg) (*processMgr, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+	var customerResultRepo accountview.CustomerTxnResultViewRepo
+	if cfg.PerCustomerOutputDir != "" || len(cfg.ShardWriteData) > 0 {
+		// Checked by validation
+		customerResultRepo = cfg.TxnResultViewRepo.(accountview.CustomerTxnResultViewRepo)
+	}
+	var customerGroups *customerGroups
+	if cfg.CustomerGrouped {
+		customerGroups = newCustomerGroups(cfg.StragglerPolicy)
+	}
+	var sequencedRepo accountview.SequencedTxnResultViewRepo
+	if cfg.ReportSort == ReportSortInputOrder || cfg.VerifyInputOrder {
+		// Checked by validation
+		sequencedRepo = cfg.TxnResultViewRepo.(accountview.SequencedTxnResultViewRepo)
+	}
+	var countingRepo accountview.CountingTxnResultViewRepo
+	if cfg.SummaryFilePath != "" {
+		// Checked by validation
+		countingRepo = cfg.TxnResultViewRepo.(accountview.CountingTxnResultViewRepo)
+	}
+	procClock := cfg.Clock
+	if procClock == nil {
+		procClock = clock.RealClock{}
 	}
 
 	// Subscribe to actions from Bus
@@ -75,20 +437,29 @@ func InitProcessMgr(ctx context.Context, cfg *ProcessMgrCfg) error {
 		cfg.TxnCreateFailed,
 		cfg.ReportWritten,
 	}
-	eventSubs := make(map[model.EventAction]<-chan interface{})
-	for _, action := range actions {
-		eventSubs[action], err = cfg.Bus.Subscribe(action.String())
-		if err != nil {
-			return errors.Wrapf(err, "error subscribing to event-bus for action: %s", action)
-		}
+	if cfg.ReportWriteFailed != "" {
+		actions = append(actions, cfg.ReportWriteFailed)
+	}
+	if cfg.TxnReadFailed != "" {
+		actions = append(actions, cfg.TxnReadFailed)
+	}
+	if cfg.TxnSkipped != "" {
+		actions = append(actions, cfg.TxnSkipped)
+	}
+	// Subscribed as a group, so events confirming writes are
+	// received ahead of a backlog of transactions, on buses
+	// delivering by priority.
+	eventSubs, err := eventutil.SubscribeEventGroup(cfg.Bus, actions)
+	if err != nil {
+		return nil, errors.Wrap(err, "error subscribing to event-bus")
 	}
 
-	// Create and run manager
 	cfg.Log.Infof("Starting process-manager")
-	runner := &processMgr{
+	return &processMgr{
 		log:               cfg.Log,
 		bus:               cfg.Bus,
 		txnResultViewRepo: cfg.TxnResultViewRepo,
+		clock:             procClock,
 
 		writeData:  cfg.WriteData,
 		createTxn:  cfg.CreateTxn,
@@ -99,44 +470,111 @@ func InitProcessMgr(ctx context.Context, cfg *ProcessMgrCfg) error {
 		txnCreateFailed: cfg.TxnCreateFailed,
 		reportWritten:   cfg.ReportWritten,
 
+		reportWriteFailed: cfg.ReportWriteFailed,
+		txnReadFailed:     cfg.TxnReadFailed,
+		txnSkipped:        cfg.TxnSkipped,
+
 		idleTimeoutSec:               cfg.IdleTimeoutSec,
 		reportWrittenEventTimeoutSec: cfg.ReportWrittenEventTimeoutSec,
+		reportTimeoutPerMB:           cfg.ReportTimeoutPerMB,
+		reportTimeoutMinSec:          cfg.ReportTimeoutMinSec,
+		reportTimeoutMaxSec:          cfg.ReportTimeoutMaxSec,
+
+		flowEpoch: cfg.FlowEpoch,
+		pending:   newRoutineTracker(),
+
+		orderedDispatch:   cfg.OrderedDispatch,
+		turnsLock:         &sync.Mutex{},
+		lastCreateTxnPub:  make(map[string]<-chan struct{}),
+		lastProcessTxnPub: make(map[string]<-chan struct{}),
+
+		failOnEmptyInput:    cfg.FailOnEmptyInput,
+		failOnZeroValidTxns: cfg.FailOnZeroValidTxns,
+
+		payloadEnvelope:  cfg.PayloadEnvelope,
+		quarantine:       cfg.Quarantine,
+		reportWarnings:   cfg.ReportWarnings,
+		streamedResults:  cfg.StreamedResults,
+		streamStartIndex: cfg.TxnResultViewRepo.Index(),
+
+		reportSort:       cfg.ReportSort,
+		verifyInputOrder: cfg.VerifyInputOrder,
+		sequencedRepo:    sequencedRepo,
+		createFailedSeqs: make([]uint64, 0),
+
+		perCustomerOutputDir: cfg.PerCustomerOutputDir,
+		customerResultRepo:   customerResultRepo,
+		customerGroups:       customerGroups,
+		unsafeCustomerIDs:    make([]string, 0),
+		shardWriteData:       cfg.ShardWriteData,
+
+		summaryFilePath: cfg.SummaryFilePath,
+		countingRepo:    countingRepo,
+
+		tracer:      trace.OrNoop(cfg.Tracer),
+		tracedFlows: make([]string, 0),
 
 		eventSubs: eventSubs,
-	}
-	err = runner.start(ctx)
-	return errors.Wrap(err, "process-loop returned with error")
+	}, nil
 }
 
 func (p *processMgr) start(ctx context.Context) error {
 	defer p.unsubscribe()
+	p.startedAt = p.clock.Now()
 
-	// Helps collect error from routines.
-	// This should not be closed in "defer"
-	// block cos its possible for other routines
-	// to still write to this while they exit
-	// (in a clean/errorless exit, this wont
-	// happen).
-	errChan := make(chan error)
-	// Some tasks need to be completed after
-	// context-done signal is received.
-	// To prevent select-case from executing
-	// context-done multiple times, this
-	// control-var is used.
-	ctxDoneAck := false
+	// Helps collect errors from routines publishing commands.
+	// Closing sink on return lets routines still sending
+	// errors exit, instead of blocking on this loop.
+	errs := newErrSink()
+	defer errs.close()
+	// Receives result of waiting for report to be written.
+	// Buffered, so report-routine never blocks on it, such
+	// as when this loop already returned with an error.
+	reportResult := make(chan error, 1)
+	// Closed once pending command-routines have returned
+	// after context-done, and their commands are admitted.
+	// Nil (never receives) until then, and while
+	// transactions are still awaited.
+	var drainedSig <-chan struct{}
+	// Receives if draining makes no progress within
+	// idle-timeout, such as when awaited transactions
+	// get no results. Restarted whenever awaited
+	// transactions get results.
+	var drainTimeoutSig <-chan time.Time
+	drainAwaiting := 0
 	// Closes context when no messages are
 	// detected within specified timeout.
 	timeoutCancelSig := make(chan struct{})
 	defer close(timeoutCancelSig)
 
 	internalCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Set to nil once context-done is received, since
+	// done-channel stays closed and would otherwise be
+	// selected again on every iteration.
+	ctxDoneSig := internalCtx.Done()
+	// Timeout-routine returns on context-done, so it must
+	// not be signalled after that. Context might be done
+	// before this loop receives it, so this can't rely
+	// on shutdown-stage alone.
+	resetTimeout := func() {
+		select {
+		case timeoutCancelSig <- struct{}{}:
+		case <-internalCtx.Done():
+		}
+	}
+
+	// Receives when customers whose group ended should be
+	// checked for having all results. Nil unless there're
+	// such customers.
+	var finalizeSig <-chan time.Time
 
 	go func() {
 		for {
 			select {
 			case <-internalCtx.Done():
 				return
-			case <-time.After(time.Duration(p.idleTimeoutSec) * time.Second):
+			case <-p.clock.After(time.Duration(p.idleTimeoutSec) * time.Second):
 				p.log.Debug(
 					"Timed-out waiting for new messages. Closing internal-context...",
 				)
@@ -148,6 +586,36 @@ func (p *processMgr) start(ctx context.Context) error {
 	}()
 
 	for {
+		// Draining completes once awaited transactions have
+		// results, and their commands are published and admitted.
+		if p.stage == stageDraining {
+			if drainTimeoutSig == nil || p.awaitingCreate != drainAwaiting {
+				drainAwaiting = p.awaitingCreate
+				drainTimeoutSig = p.clock.After(time.Duration(p.idleTimeoutSec) * time.Second)
+			}
+			if drainedSig == nil && p.awaitingCreate == 0 {
+				drainedSig = p.drain()
+			}
+		}
+
+		// Writes of customers' outputs, and of streamed results,
+		// are confirmed here until report is written, and then
+		// along with report.
+		var writtenSub, writeFailedSub <-chan model.Event
+		if p.customerGroups != nil && p.stage != stageReporting {
+			if finalizeSig == nil && len(p.customerGroups.pending) > 0 {
+				finalizeSig = p.clock.After(groupFinalizeInterval)
+			}
+			if p.customerGroups.unconfirmedWrites > 0 {
+				writtenSub = p.eventSubs[p.reportWritten]
+				writeFailedSub = p.eventSubs[p.reportWriteFailed]
+			}
+		}
+		if p.streamedResults && p.stage != stageReporting {
+			writtenSub = p.eventSubs[p.reportWritten]
+			writeFailedSub = p.eventSubs[p.reportWriteFailed]
+		}
+
 		// Some operations here run in their own routines to
 		// prevent deadlock in process-manager (such as when
 		// its waiting for a case to complete, but that case
@@ -155,97 +623,711 @@ func (p *processMgr) start(ctx context.Context) error {
 		// event/command, and so all such cases need to be
 		// able to process concurrently).
 		select {
-		case <-internalCtx.Done():
-			if ctxDoneAck {
+		case <-ctxDoneSig:
+			ctxDoneSig = nil
+			if !p.advanceStage(stageRunning, stageDraining) {
 				continue
 			}
-			ctxDoneAck = true
 			p.log.Debug("Received context-done signal")
-			err := p.writeReportAndStopLoop(errChan)
+
+		case <-drainedSig:
+			drainedSig = nil
+			if p.awaitingCreate > 0 {
+				continue
+			}
+			p.log.Debug("Drained pending commands")
+			err := p.completeDrain(reportResult)
+			if err != nil {
+				return errors.Wrap(err, "error processing context-done signal")
+			}
+
+		case <-drainTimeoutSig:
+			drainTimeoutSig = nil
+			drainedSig = nil
+			p.log.Warnf(
+				"Timed-out draining, with %d transaction(s) yet to be created, "+
+					"or commands yet to be admitted",
+				p.awaitingCreate,
+			)
+			err := p.completeDrain(reportResult)
 			if err != nil {
 				return errors.Wrap(err, "error processing context-done signal")
 			}
 
-		case msg := <-p.eventSubs[p.txnRead]:
-			timeoutCancelSig <- struct{}{}
-			p.pubCreateTxnCmd(errChan, msg)
+		case event, ok := <-p.eventSubs[p.txnRead]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(p.txnRead.String())
+			}
+			// Late events are also tracked, so their
+			// missing results fail input-order check.
+			if event.InputSeq() > p.lastInputSeq {
+				p.lastInputSeq = event.InputSeq()
+			}
+			if p.stage == stageReporting {
+				p.logLateEvent(event)
+				continue
+			}
+			resetTimeout()
+			p.linesRead++
+			if p.customerGroups != nil && !p.trackGroupRead(event) {
+				// Rejected straggler has no result,
+				// same as a failed transaction.
+				if event.InputSeq() != 0 {
+					p.createFailedSeqs = append(p.createFailedSeqs, event.InputSeq())
+				}
+				continue
+			}
+			p.awaitingCreate++
+			p.pubCreateTxnCmd(errs, event)
 
-		case msg := <-p.eventSubs[p.txnCreated]:
-			timeoutCancelSig <- struct{}{}
-			p.pubProcessTxnCmd(errChan, msg)
+		case event, ok := <-p.eventSubs[p.txnCreated]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(p.txnCreated.String())
+			}
+			if p.stage == stageReporting {
+				p.logLateEvent(event)
+				continue
+			}
+			resetTimeout()
+			p.receivedCreateResult()
+			p.validTxns++
+			if p.customerGroups != nil {
+				p.trackGroupCreated(event)
+			}
+			p.pubProcessTxnCmd(errs, event)
 
-		case msg := <-p.eventSubs[p.txnCreateFailed]:
-			timeoutCancelSig <- struct{}{}
-			p.logCreateTxnFailure(msg)
+		case event, ok := <-p.eventSubs[p.txnCreateFailed]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(p.txnCreateFailed.String())
+			}
+			resetTimeout()
+			p.receivedCreateResult()
+			p.logCreateTxnFailure(event)
 
-		case err := <-errChan:
+		case event, ok := <-p.eventSubs[p.txnSkipped]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(p.txnSkipped.String())
+			}
+			resetTimeout()
+			p.receivedCreateResult()
+			p.recordSkippedTxn(event)
+
+		case event, ok := <-p.eventSubs[p.txnReadFailed]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(p.txnReadFailed.String())
+			}
+			resetTimeout()
+			p.recordReadFailure(event)
+
+		case <-finalizeSig:
+			finalizeSig = nil
+			err := p.finalizeGroups(errs)
+			if err != nil {
+				return errors.Wrap(err, "error writing outputs of customers")
+			}
+
+		case event, ok := <-writtenSub:
+			if !ok {
+				return eventutil.SubscriptionClosedError(p.reportWritten.String())
+			}
+			p.log.Tracef("[Event: %s]: [Action: %s]: Received event", event.ID(), event.Action())
+			if event.CorrelationKey() == StreamCorrelationKey {
+				p.countStreamed(event)
+			} else {
+				p.customerGroups.unconfirmedWrites--
+			}
+
+		case event, ok := <-writeFailedSub:
+			if !ok {
+				return eventutil.SubscriptionClosedError(p.reportWriteFailed.String())
+			}
+			failure := &writer.WriteFailure{}
+			err := json.Unmarshal(event.RawData(), failure)
+			if err != nil {
+				return errors.Wrapf(err, "error unmarshalling event-data for '%s' Event", p.reportWriteFailed)
+			}
+			if event.CorrelationKey() == StreamCorrelationKey {
+				return fmt.Errorf("write-service failed writing streamed results: %s", failure.Error)
+			}
+			return fmt.Errorf("write-service failed writing output of customer: %s", failure.Error)
+
+		case err := <-errs.errs:
 			return errors.Wrap(err, "received error on error-channel")
+
+		case err := <-reportResult:
+			if err != nil {
+				return errors.Wrap(err, "received error on error-channel")
+			}
+			if p.emptyRunErr != nil {
+				return p.emptyRunErr
+			}
+			return nil
+		}
+	}
+}
+
+// advanceStage advances shutdown-stage to "to" if current
+// stage is "from", and returns false otherwise. Stages only
+// advance forward, so each shutdown-step runs exactly once.
+func (p *processMgr) advanceStage(from shutdownStage, to shutdownStage) bool {
+	if p.stage != from || to <= from {
+		return false
+	}
+	p.stage = to
+	return true
+}
+
+// drain waits for routines still publishing commands
+// to return, and for listeners to admit their commands.
+// Returned channel is closed once both are done.
+func (p *processMgr) drain() <-chan struct{} {
+	drainedSig := make(chan struct{})
+	go func() {
+		<-p.pending.idle()
+		if p.flowEpoch != nil {
+			<-p.flowEpoch.Admitted()
 		}
+		close(drainedSig)
+	}()
+	return drainedSig
+}
+
+// completeDrain stops further commands from being processed
+// by advancing flow-epoch, and writes report. Commands of
+// transactions in flight are admitted by then, so only
+// commands issued after draining are rejected.
+func (p *processMgr) completeDrain(reportResult chan<- error) error {
+	if !p.advanceStage(stageDraining, stageReporting) {
+		return nil
+	}
+	if p.flowEpoch != nil {
+		epoch := p.flowEpoch.Advance()
+		p.log.Debugf("Advanced flow-epoch to: %d", epoch)
+	}
+	return p.writeReportAndStopLoop(reportResult)
+}
+
+// receivedCreateResult notes result of an awaited transaction.
+// Results of transactions not read by process-manager (such as
+// ones published directly) aren't awaited.
+func (p *processMgr) receivedCreateResult() {
+	if p.awaitingCreate > 0 {
+		p.awaitingCreate--
+	}
+}
+
+// issueEpoch returns flow-epoch to stamp a command with,
+// which is then awaited when draining (see #drain).
+func (p *processMgr) issueEpoch() uint64 {
+	if p.flowEpoch == nil {
+		return 0
 	}
+	return p.flowEpoch.Issue()
 }
 
-func (p *processMgr) writeReportAndStopLoop(errChan chan<- error) error {
+// logLateEvent logs events received after process-manager
+// completed draining, for which no commands are published.
+func (p *processMgr) logLateEvent(event model.Event) {
+	p.log.Warnf(
+		"[Event: %s]: [Action: %s]: Ignored event received after draining completed",
+		event.ID(), event.Action(),
+	)
+}
+
+func (p *processMgr) writeReportAndStopLoop(reportResult chan<- error) error {
+	if p.verifyInputOrder {
+		err := p.checkInputOrder()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Get data from transaction-result view-repo and
 	// send command to writer-service to write it
-	txnResults := p.txnResultViewRepo.Serialized()
-	writeDataCmd, err := model.NewCmd(&model.CmdCfg{
-		Action: p.writeData,
-		Data:   []byte(txnResults),
-	})
-	if err != nil {
-		return errors.Wrapf(err, "error creating '%s' command", p.writeData)
+	txnResults := ""
+	switch {
+	case p.streamedResults:
+		// Already written by view
+	case p.reportSort == ReportSortInputOrder:
+		txnResults = p.sequencedRepo.SerializedInInputOrder()
+	default:
+		txnResults = p.txnResultViewRepo.Serialized()
 	}
-	err = p.bus.Publish(writeDataCmd)
-	if err != nil {
-		return errors.Wrapf(err, "error publishing '%s' command on bus", p.writeData)
+	if p.failOnEmptyInput || p.failOnZeroValidTxns {
+		header, err := json.Marshal(&ReportHeader{
+			LinesRead: p.linesRead,
+			ValidTxns: p.validTxns,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error marshalling report-header")
+		}
+		if txnResults == "" {
+			txnResults = string(header)
+		} else {
+			txnResults = fmt.Sprintf("%s\n%s", header, txnResults)
+		}
+		p.emptyRunErr = p.checkEmptyRun()
+	}
+	numQuarantined := 0
+	if p.quarantine != nil {
+		numQuarantined = p.quarantine.Len()
 	}
-	p.log.Debugf("Waiting for response from writer-service")
+	var warningCounts warnings.Counts
+	if p.reportWarnings != nil {
+		warningCounts = p.reportWarnings.Counts()
+	}
+	if p.readFailure != nil || numQuarantined > 0 || len(warningCounts) > 0 {
+		trailer := &ReportTrailer{
+			LinesRead:         p.linesRead,
+			QuarantinedEvents: numQuarantined,
+			Warnings:          warningCounts,
+		}
+		if p.readFailure != nil {
+			trailer.Partial = true
+			trailer.LinesRead = p.readFailure.LinesPublished
+		}
+		trailerBytes, err := json.Marshal(trailer)
+		if err != nil {
+			return errors.Wrap(err, "error marshalling report-trailer")
+		}
+		if p.streamedResults && txnResults == "" {
+			txnResults = string(trailerBytes)
+		} else {
+			txnResults = fmt.Sprintf("%s\n%s", txnResults, trailerBytes)
+		}
+	}
+	writeCmds := make([]model.Cmd, 0)
+	// Streamed results are confirmed without report,
+	// if it has nothing else to write.
+	if !p.streamedResults || txnResults != "" {
+		cmdData := []byte(txnResults)
+		if p.payloadEnvelope {
+			payload, err := writer.NewPayloadBuilder(cmdData).Build()
+			if err != nil {
+				return errors.Wrap(err, "error building report-payload")
+			}
+			cmdData = payload
+		}
+		// Writing report is control-flow, which shouldn't wait
+		// behind a backlog of transactions on buses delivering
+		// by priority. Same for other write-commands below.
+		writeDataCmd, err := model.NewCmd(&model.CmdCfg{
+			Action:   p.writeData,
+			Data:     cmdData,
+			Priority: model.PriorityControl,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error creating '%s' command", p.writeData)
+		}
+		writeCmds = append(writeCmds, writeDataCmd)
+	}
+	// Results streamed by view, which are yet to be confirmed
+	numToStream := 0
+	if p.streamedResults {
+		numToStream = p.txnResultViewRepo.Index() - p.streamStartIndex
+	}
+	// Customers' outputs written before report,
+	// and not yet confirmed by writer.
+	numUnconfirmed := 0
+	if p.customerGroups != nil {
+		numUnconfirmed = p.customerGroups.unconfirmedWrites
+	}
+	reportSize := len(txnResults)
+	if p.perCustomerOutputDir != "" {
+		customerCmds, size, err := p.customerWriteCmds()
+		if err != nil {
+			return errors.Wrap(err, "error creating per-customer write-commands")
+		}
+		writeCmds = append(writeCmds, customerCmds...)
+		reportSize += size
+	}
+	if len(p.shardWriteData) > 0 {
+		shardCmds, size, err := p.shardWriteCmds()
+		if err != nil {
+			return errors.Wrap(err, "error creating shard write-commands")
+		}
+		writeCmds = append(writeCmds, shardCmds...)
+		reportSize += size
+	}
+	if p.summaryFilePath != "" {
+		summaryCmd, size, err := p.summaryWriteCmd()
+		if err != nil {
+			return errors.Wrap(err, "error creating summary write-command")
+		}
+		writeCmds = append(writeCmds, summaryCmd)
+		reportSize += size
+	}
+	timeout := p.reportTimeout(reportSize)
+	p.log.Debugf(
+		"Writing %d command(s), waiting for response from writer-service (timeout: %s)",
+		len(writeCmds), timeout,
+	)
 
-	// Wait for success-event from data-writer, or time-out with error
+	writeSpans := p.startWriteSpans()
+	if len(writeCmds) > 0 {
+		err := p.bus.Publish(writeCmds[0])
+		if err != nil {
+			endSpans(writeSpans)
+			return errors.Wrapf(err, "error publishing '%s' command on bus", p.writeData)
+		}
+	}
+
+	// Wait for success-event from data-writer for every command, or
+	// time-out with error. Receiving from a nil-channel blocks forever,
+	// so the write-failed case is never selected when its action is
+	// not configured. Subscriptions are read before routine
+	// starts, since loop unsubscribes these once it returns.
+	writtenSub := p.eventSubs[p.reportWritten]
+	writeFailedSub := p.eventSubs[p.reportWriteFailed]
 	go func() {
+		timeoutSig := p.clock.After(timeout)
 		err := func() error {
-			select {
-			case <-time.After(time.Duration(p.reportWrittenEventTimeoutSec) * time.Second):
-				return errors.New("timed-out waiting for response from write-service")
-
-			case msg := <-p.eventSubs[p.reportWritten]:
-				event, castSuccess := msg.(model.Event)
-				if !castSuccess {
-					return fmt.Errorf("error casting message to '%s' Event", p.reportWritten)
+			written := 0
+			for written < len(writeCmds)+numUnconfirmed || p.numStreamed < numToStream {
+				isReport, err := p.awaitWrite(timeoutSig, writtenSub, writeFailedSub)
+				if err != nil {
+					return err
+				}
+				if isReport {
+					written++
 				}
-				p.log.Tracef("[Event: %s]: [Action: %s]: Received event", event.ID(), event.Action())
 			}
 			return nil
 		}()
 
+		endSpans(writeSpans)
+		// Sent exactly once, with nil once report is written
+		reportResult <- err
+	}()
+
+	// Writer publishes an event for every command, so remaining
+	// commands are published once waiting started, else writer
+	// would block on publishing while these are published.
+	for i := 1; i < len(writeCmds); i++ {
+		cmd := writeCmds[i]
+		err := p.bus.Publish(cmd)
 		if err != nil {
-			errChan <- err
+			return errors.Wrapf(err, "error publishing '%s' command on bus", cmd.Action())
+		}
+	}
+	return nil
+}
+
+// awaitWrite waits for data-writer to confirm a write, and
+// returns error if write failed or timeout is received.
+// Returns false if write was of streamed results, which are
+// counted instead (see #countStreamed).
+func (p *processMgr) awaitWrite(
+	timeoutSig <-chan time.Time,
+	writtenSub <-chan model.Event,
+	writeFailedSub <-chan model.Event,
+) (bool, error) {
+	select {
+	case <-timeoutSig:
+		return false, errors.New("timed-out waiting for response from write-service")
+
+	case event, ok := <-writtenSub:
+		if !ok {
+			return false, eventutil.SubscriptionClosedError(p.reportWritten.String())
+		}
+		p.log.Tracef("[Event: %s]: [Action: %s]: Received event", event.ID(), event.Action())
+		if event.CorrelationKey() == StreamCorrelationKey {
+			p.countStreamed(event)
+			return false, nil
 		}
-		close(errChan)
-	}()
 
+	case event, ok := <-writeFailedSub:
+		if !ok {
+			return false, eventutil.SubscriptionClosedError(p.reportWriteFailed.String())
+		}
+		p.log.Tracef("[Event: %s]: [Action: %s]: Received event", event.ID(), event.Action())
+
+		failure := &writer.WriteFailure{}
+		err := json.Unmarshal(event.RawData(), failure)
+		if err != nil {
+			return false, errors.Wrapf(err, "error unmarshalling event-data for '%s' Event", p.reportWriteFailed)
+		}
+		if event.CorrelationKey() == StreamCorrelationKey {
+			return false, fmt.Errorf("write-service failed writing streamed results: %s", failure.Error)
+		}
+		return false, fmt.Errorf("write-service failed writing report: %s", failure.Error)
+	}
+	return true, nil
+}
+
+// countStreamed counts results in data of writer's
+// event confirming a write of streamed results.
+func (p *processMgr) countStreamed(event model.Event) {
+	data := event.RawData()
+	if len(data) > 0 {
+		p.numStreamed += bytes.Count(data, []byte("\n")) + 1
+	}
+}
+
+// customerWriteCmds returns command writing results of every
+// customer to their own file, and total size of written data.
+// Customers with IDs unsafe as file-names are skipped, as are
+// customers whose output was written once their group ended.
+func (p *processMgr) customerWriteCmds() ([]model.Cmd, int, error) {
+	byCustomer := p.customerResultRepo.ByCustomer()
+	custIDs := make([]string, 0, len(byCustomer))
+	for custID := range byCustomer {
+		if p.customerGroups != nil {
+			flow, exists := p.customerGroups.flows[custID]
+			if exists && flow.finalized {
+				continue
+			}
+		}
+		custIDs = append(custIDs, custID)
+	}
+	// Commands are published in same order every run
+	sort.Strings(custIDs)
+
+	cmds := make([]model.Cmd, 0, len(custIDs))
+	size := 0
+	for _, custID := range custIDs {
+		err := checkSafeFileName(custID)
+		if err != nil {
+			p.log.Warnf("[Customer: %q]: Skipped per-customer output: %s", custID, err)
+			p.unsafeCustomerIDs = append(p.unsafeCustomerIDs, custID)
+			continue
+		}
+
+		cmd, cmdSize, err := p.customerWriteCmd(custID, byCustomer[custID])
+		if err != nil {
+			return nil, 0, err
+		}
+		cmds = append(cmds, cmd)
+		size += cmdSize
+	}
+	return cmds, size, nil
+}
+
+// customerWriteCmd returns command writing results of customer
+// to their own file, and size of written data.
+func (p *processMgr) customerWriteCmd(
+	custID string,
+	results []accountview.TxnResultEntry,
+) (model.Cmd, int, error) {
+	lines := make([]string, 0, len(results))
+	for _, entry := range results {
+		entryBytes, err := json.Marshal(entry)
+		if err != nil {
+			return model.Cmd{}, 0, errors.Wrap(err, "error marshalling result")
+		}
+		lines = append(lines, string(entryBytes))
+	}
+	data := strings.Join(lines, "\n")
+
+	payload, err := writer.NewPayloadBuilder([]byte(data)).
+		WithTarget(filepath.Join(p.perCustomerOutputDir, custID+".ndjson")).
+		Build()
+	if err != nil {
+		return model.Cmd{}, 0, errors.Wrapf(err, "error building payload for customer %q", custID)
+	}
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		Action:   p.writeData,
+		Data:     payload,
+		Priority: model.PriorityControl,
+	})
+	if err != nil {
+		return model.Cmd{}, 0, errors.Wrapf(err, "error creating '%s' command", p.writeData)
+	}
+	return cmd, len(data), nil
+}
+
+// summaryWriteCmd returns command writing ProcessingSummary
+// to summary-file, and size of written data.
+func (p *processMgr) summaryWriteCmd() (model.Cmd, int, error) {
+	summary := newProcessingSummary(
+		p.linesRead,
+		p.validTxns,
+		p.countingRepo.Counts(),
+		p.startedAt,
+		p.clock.Now(),
+	)
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return model.Cmd{}, 0, errors.Wrap(err, "error marshalling summary")
+	}
+
+	payload, err := writer.NewPayloadBuilder(data).
+		WithTarget(p.summaryFilePath).
+		Build()
+	if err != nil {
+		return model.Cmd{}, 0, errors.Wrap(err, "error building summary-payload")
+	}
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		Action:   p.writeData,
+		Data:     payload,
+		Priority: model.PriorityControl,
+	})
+	if err != nil {
+		return model.Cmd{}, 0, errors.Wrapf(err, "error creating '%s' command", p.writeData)
+	}
+	return cmd, len(data), nil
+}
+
+// checkSafeFileName returns error if name can't be
+// used as a file-name, such as if it's a path.
+func checkSafeFileName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name is blank")
+	case strings.ContainsAny(name, `/\`):
+		return errors.New("name contains path-separator")
+	case strings.Contains(name, ".."):
+		return errors.New("name contains '..'")
+	case strings.ContainsRune(name, 0):
+		return errors.New("name contains NUL-character")
+	}
 	return nil
 }
 
-func (p *processMgr) pubCreateTxnCmd(errChan chan<- error, msg interface{}) {
-	if msg == nil {
-		return
+// startWriteSpans starts span of writing
+// report for every traced flow.
+func (p *processMgr) startWriteSpans() []trace.Span {
+	spans := make([]trace.Span, len(p.tracedFlows))
+	for i, correlationKey := range p.tracedFlows {
+		spans[i] = p.tracer.StartSpan(trace.SpanWrite, correlationKey)
 	}
-	event, castSuccess := msg.(model.Event)
-	if !castSuccess {
-		p.log.Warnf("error casting message to '%s' Event", p.txnRead)
-		return
+	return spans
+}
+
+func endSpans(spans []trace.Span) {
+	for _, span := range spans {
+		span.End()
+	}
+}
+
+// checkEmptyRun returns EmptyRunError if run is
+// empty as per enabled checks, or nil otherwise.
+func (p *processMgr) checkEmptyRun() *EmptyRunError {
+	reason := EmptyRunReason("")
+	switch {
+	case p.failOnEmptyInput && p.linesRead == 0:
+		reason = EmptyInput
+	case p.failOnZeroValidTxns && p.validTxns == 0:
+		reason = ZeroValidTxns
+	default:
+		return nil
+	}
+
+	p.log.Warnf(
+		"Run is empty: %s (lines read: %d, valid transactions: %d)",
+		reason, p.linesRead, p.validTxns,
+	)
+	return &EmptyRunError{
+		Reason:    reason,
+		LinesRead: p.linesRead,
+		ValidTxns: p.validTxns,
+	}
+}
+
+// reportTimeout returns duration to wait for report to be
+// written, scaled by report-size if configured to do so.
+func (p *processMgr) reportTimeout(reportSize int) time.Duration {
+	fixedTimeout := time.Duration(p.reportWrittenEventTimeoutSec) * time.Second
+	if p.reportTimeoutPerMB == 0 {
+		return fixedTimeout
+	}
+
+	sizeMB := float64(reportSize) / (1024 * 1024)
+	timeout := time.Duration(p.reportTimeoutPerMB * sizeMB * float64(time.Second))
+
+	minTimeout := fixedTimeout
+	if p.reportTimeoutMinSec > 0 {
+		minTimeout = time.Duration(p.reportTimeoutMinSec) * time.Second
+	}
+	if timeout < minTimeout {
+		timeout = minTimeout
+	}
+	maxTimeout := time.Duration(p.reportTimeoutMaxSec) * time.Second
+	if maxTimeout > 0 && timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+	return timeout
+}
+
+// flowCorrelationKey returns correlation-key for messages caused
+// by event. Events without a correlation-key start a new flow,
+// which is then identified by the event's ID.
+func flowCorrelationKey(event model.Event) string {
+	if event.CorrelationKey() != "" {
+		return event.CorrelationKey()
 	}
+	return event.ID()
+}
+
+// dispatchTurn returns the channel a publishing routine waits
+// on before publishing (nil if it doesn't need to wait), and
+// the func it calls once done. Routines wait for previous
+// routine of same customer, so transactions of a customer are
+// processed in input-order, and account's events are same
+// across runs of same input, even for transactions with
+// identical timestamps. With ordered-dispatch, routines wait
+// for previous routine of any customer.
+// Must only be called from process-loop.
+func (p *processMgr) dispatchTurn(
+	lastPubs map[string]<-chan struct{},
+	custID string,
+) (<-chan struct{}, func()) {
+	if p.orderedDispatch {
+		custID = ""
+	}
+	p.turnsLock.Lock()
+	defer p.turnsLock.Unlock()
+
+	prevPub := lastPubs[custID]
+	pubDone := make(chan struct{})
+	lastPubs[custID] = pubDone
+
+	endTurn := func() {
+		p.turnsLock.Lock()
+		defer p.turnsLock.Unlock()
+		close(pubDone)
+		// Later turns wait on this, until it's ended
+		if lastPubs[custID] == pubDone {
+			delete(lastPubs, custID)
+		}
+	}
+	return prevPub, endTurn
+}
+
+func (p *processMgr) pubCreateTxnCmd(errs *errSink, event model.Event) {
 	// Send create-transaction command
 	logPrefix := fmt.Sprintf("[Event: %s]: [Action: %s]:", event.ID(), event.Action())
 	p.log.Tracef("%s Received event", logPrefix)
 
+	// Epoch is read before routine starts. Draining waits
+	// for routine before advancing epoch, so only commands
+	// issued after draining completed carry older epoch.
+	epoch := p.issueEpoch()
+	// Malformed requests have no customer, and
+	// are dispatched in order among themselves.
+	var custID string
+	if req, err := txn.ParseTxnReq(event.RawData()); err == nil {
+		custID = req.CustomerID
+	}
+	prevPub, endTurn := p.dispatchTurn(p.lastCreateTxnPub, custID)
+	p.pending.add()
 	go func() {
+		defer p.pending.done()
+		defer endTurn()
+		if prevPub != nil {
+			<-prevPub
+		}
+
 		err := func() error {
 			cmd, err := model.NewCmd(&model.CmdCfg{
-				CorrelationKey: event.ID(),
+				CausationID:    event.ID(),
+				CausationKey:   event.ID(),
+				CorrelationKey: flowCorrelationKey(event),
+				Epoch:          epoch,
+				IsReplay:       event.IsReplay(),
+				InputSeq:       event.InputSeq(),
 				Action:         p.createTxn,
-				Data:           event.Data(),
+				Data:           event.RawData(),
 			})
 			if err != nil {
 				return errors.Wrapf(err, "error creating '%s' command", p.createTxn)
@@ -257,31 +1339,47 @@ func (p *processMgr) pubCreateTxnCmd(errChan chan<- error, msg interface{}) {
 			return nil
 		}()
 
-		if err != nil {
-			errChan <- err
+		if err != nil && !errs.send(err) {
+			p.log.Debugf("%s Dropped error after process-manager returned: %s", logPrefix, err)
 		}
 	}()
 }
 
-func (p *processMgr) pubProcessTxnCmd(errChan chan<- error, msg interface{}) {
-	if msg == nil {
-		return
-	}
-	event, castSuccess := msg.(model.Event)
-	if !castSuccess {
-		p.log.Warnf("error casting message to '%s' Event", p.txnCreated)
-		return
+func (p *processMgr) pubProcessTxnCmd(errs *errSink, event model.Event) {
+	if !trace.IsNoop(p.tracer) {
+		p.tracedFlows = append(p.tracedFlows, flowCorrelationKey(event))
 	}
 	// Send process-transaction command
 	logPrefix := fmt.Sprintf("[Event: %s]: [Action: %s]:", event.ID(), event.Action())
 	p.log.Tracef("%s Received event", logPrefix)
 
+	// Epoch is read before routine starts. Draining waits
+	// for routine before advancing epoch, so only commands
+	// issued after draining completed carry older epoch.
+	epoch := p.issueEpoch()
+	transaction := &model.Transaction{}
+	if err := json.Unmarshal(event.RawData(), transaction); err != nil {
+		p.log.Warnf("%s Error unmarshalling event-data, dispatching without customer: %s", logPrefix, err)
+	}
+	prevPub, endTurn := p.dispatchTurn(p.lastProcessTxnPub, transaction.CustomerID)
+	p.pending.add()
 	go func() {
+		defer p.pending.done()
+		defer endTurn()
+		if prevPub != nil {
+			<-prevPub
+		}
+
 		err := func() error {
 			cmd, err := model.NewCmd(&model.CmdCfg{
-				CorrelationKey: event.ID(),
+				CausationID:    event.ID(),
+				CausationKey:   event.ID(),
+				CorrelationKey: flowCorrelationKey(event),
+				Epoch:          epoch,
+				IsReplay:       event.IsReplay(),
+				InputSeq:       event.InputSeq(),
 				Action:         p.processTxn,
-				Data:           event.Data(),
+				Data:           event.RawData(),
 			})
 			if err != nil {
 				return errors.Wrapf(err, "error creating '%s' command", p.processTxn)
@@ -290,31 +1388,97 @@ func (p *processMgr) pubProcessTxnCmd(errChan chan<- error, msg interface{}) {
 			return errors.Wrapf(err, "error publishing '%s' command on bus", p.processTxn)
 		}()
 
+		if err != nil && !errs.send(err) {
+			p.log.Debugf("%s Dropped error after process-manager returned: %s", logPrefix, err)
+		}
+	}()
+}
+
+// pubCmd publishes command in its own routine,
+// which is drained before writing report.
+func (p *processMgr) pubCmd(errs *errSink, cmd model.Cmd, logPrefix string) {
+	p.pending.add()
+	go func() {
+		defer p.pending.done()
+
+		err := p.bus.Publish(cmd)
 		if err != nil {
-			errChan <- err
+			err = errors.Wrapf(err, "error publishing '%s' command on bus", cmd.Action())
+			if !errs.send(err) {
+				p.log.Debugf("%s Dropped error after process-manager returned: %s", logPrefix, err)
+			}
 		}
 	}()
 }
 
-func (p *processMgr) logCreateTxnFailure(msg interface{}) {
-	if msg == nil {
+func (p *processMgr) logCreateTxnFailure(event model.Event) {
+	logPrefix := fmt.Sprintf("[Event: %s]: [Action: %s]:", event.ID(), event.Action())
+	p.log.Tracef("%s Received event", logPrefix)
+	if event.InputSeq() != 0 {
+		p.createFailedSeqs = append(p.createFailedSeqs, event.InputSeq())
+	}
+
+	failureData := &txn.CreateTxnFailure{}
+	err := json.Unmarshal(event.RawData(), failureData)
+	if err != nil {
+		p.log.Warnf("error unmarshalling event-data for '%s' Event", p.txnCreateFailed)
 		return
 	}
-	event, castSuccess := msg.(model.Event)
-	if !castSuccess {
-		p.log.Warnf("error casting message to '%s' Event", p.txnCreated)
+	p.log.Infof("Failed creating transaction: %+v", failureData)
+	if p.customerGroups != nil {
+		p.trackGroupCreateFailed(failureData)
+	}
+}
+
+// recordSkippedTxn counts transaction skipped by txn-creator,
+// whose result is recorded by view without being processed.
+func (p *processMgr) recordSkippedTxn(event model.Event) {
+	logPrefix := fmt.Sprintf("[Event: %s]: [Action: %s]:", event.ID(), event.Action())
+	p.log.Tracef("%s Received event", logPrefix)
+	p.skippedTxns++
+
+	skip := &txn.TxnSkip{}
+	err := json.Unmarshal(event.RawData(), skip)
+	if err != nil || skip.Txn == nil {
+		p.log.Warnf("error unmarshalling event-data for '%s' Event", p.txnSkipped)
 		return
 	}
+	p.log.Debugf("%s [Txn: %s]: Skipped transaction: %s", logPrefix, skip.Txn.ID, skip.Reason)
+	if p.customerGroups != nil {
+		p.trackGroupSkipped(skip.Txn)
+	}
+}
+
+// checkInputOrder returns *InputOrderError if results don't
+// cover every transaction read from input exactly once.
+// Transactions which failed to be created have no result.
+func (p *processMgr) checkInputOrder() error {
+	entries := p.sequencedRepo.Entries()
+	resultSeqs := make([]uint64, len(entries))
+	for i, entry := range entries {
+		resultSeqs[i] = entry.InputSeq
+	}
+	orderErr := checkInputOrder(p.lastInputSeq, resultSeqs, p.createFailedSeqs)
+	if orderErr != nil {
+		p.log.Errorf("Input-order check failed: %s", orderErr)
+		return orderErr
+	}
+	p.log.Debugf("Input-order check passed for %d input-record(s)", p.lastInputSeq)
+	return nil
+}
+
+func (p *processMgr) recordReadFailure(event model.Event) {
 	logPrefix := fmt.Sprintf("[Event: %s]: [Action: %s]:", event.ID(), event.Action())
 	p.log.Tracef("%s Received event", logPrefix)
 
-	failureData := &txn.CreateTxnFailure{}
-	err := json.Unmarshal(event.Data(), failureData)
+	failure := &reader.ReadFailure{}
+	err := json.Unmarshal(event.RawData(), failure)
 	if err != nil {
-		p.log.Warnf("error unmarshalling event-data for '%s' Event", p.txnCreateFailed)
+		p.log.Warnf("error unmarshalling event-data for '%s' Event", p.txnReadFailed)
 		return
 	}
-	p.log.Infof("Failed creating transaction: %+v", failureData)
+	p.log.Warnf("Input read partially, report will be marked partial: %+v", failure)
+	p.readFailure = failure
 }
 
 func (p *processMgr) unsubscribe() error {
@@ -325,7 +1489,7 @@ func (p *processMgr) unsubscribe() error {
 		}
 
 		p.log.Debugf("Unsubscribing from action: %s", action)
-		err := p.bus.Unsubscribe(channel, action.String())
+		err := eventutil.UnsubscribeEvents(p.bus, channel, action)
 		if err != nil {
 			return errors.Wrapf(err, "error unsubscribing from event-bus for action: %s", action)
 		}
@@ -0,0 +1,215 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("ProcessMgr flow-epoch", func() {
+	const (
+		WriteData model.CmdAction = "writeDataCmd"
+		CreateTxn model.CmdAction = "createTxnCmd"
+	)
+	const (
+		TxnRead         model.EventAction = "txnRead"
+		TxnCreated      model.EventAction = "txnCreated"
+		TxnCreateFailed model.EventAction = "txnCreateFailed"
+		ReportWritten   model.EventAction = "reportWritten"
+	)
+
+	var bus eventutil.Bus
+	var flowEpoch *eventutil.FlowEpoch
+	var accountEventRepo eventutil.EventRepo
+
+	var cancel context.CancelFunc
+	var processMgrCancel context.CancelFunc
+	var errGroup *errgroup.Group
+
+	var publishTxnCreated = func(txn model.Transaction) {
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: txn.ID,
+			Action:      TxnCreated,
+			Data:        txn,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = bus.Publish(event)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		flowEpoch = eventutil.NewFlowEpoch()
+
+		cfgProvider := &domain_test.ConfigProvider{}
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountCfg.FlowEpoch = flowEpoch
+		accountEventRepo = accountCfg.AccountCfg.EventRepo
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		var processMgrCtx context.Context
+		processMgrCtx, processMgrCancel = context.WithCancel(ctx)
+
+		errGroup, _ = errgroup.WithContext(context.Background())
+		errGroup.Go(func() error {
+			return account.InitCmdListener(ctx, accountCfg)
+		})
+		errGroup.Go(func() error {
+			// Report is never written in these tests,
+			// so process-manager exits with time-out.
+			_ = InitProcessMgr(processMgrCtx, &ProcessMgrCfg{
+				Log: logger.NewStdLogger("ProcessMgr"),
+				Bus: bus,
+				TxnResultViewRepo: accountview.NewMemoryTxnResultViewRepo(
+					accountview.MemoryTxnResultViewRepoCfg{},
+				),
+
+				WriteData:  WriteData,
+				CreateTxn:  CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         TxnRead,
+				TxnCreated:      TxnCreated,
+				TxnCreateFailed: TxnCreateFailed,
+				ReportWritten:   ReportWritten,
+
+				IdleTimeoutSec:               3600,
+				ReportWrittenEventTimeoutSec: 1,
+
+				FlowEpoch: flowEpoch,
+			})
+			return nil
+		})
+		// Ensure the goroutines above
+		// are ready to process messages
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		processMgrCancel()
+		cancel()
+		err := errGroup.Wait()
+		Expect(err).ToNot(HaveOccurred())
+		bus.Terminate()
+	})
+
+	It("rejects commands from before drain without altering store", func() {
+		accDepositedSub, err := bus.Subscribe(model.AccountDeposited.String())
+		Expect(err).ToNot(HaveOccurred())
+		writeDataCmdSub, err := bus.Subscribe(WriteData.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		txnTime, err := time.Parse(time.RFC3339, "2000-01-05T00:00:01Z")
+		Expect(err).ToNot(HaveOccurred())
+		publishTxnCreated(model.Transaction{
+			ID:         "1",
+			CustomerID: "1",
+			LoadAmount: 100,
+			Time:       txnTime,
+		})
+		Eventually(accDepositedSub).Should(Receive())
+
+		// Enter drain-phase
+		processMgrCancel()
+		Eventually(writeDataCmdSub).Should(Receive())
+		Expect(flowEpoch.Current()).To(BeEquivalentTo(1))
+
+		// Delayed command, issued before drain
+		lateCmd, err := model.NewCmd(&model.CmdCfg{
+			Epoch:  0,
+			Action: model.ProcessTxn,
+			Data: model.Transaction{
+				ID:         "2",
+				CustomerID: "2",
+				LoadAmount: 100,
+				Time:       txnTime,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = bus.Publish(lateCmd)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(flowEpoch.NumRejected).Should(BeEquivalentTo(1))
+		Consistently(accDepositedSub).ShouldNot(Receive())
+		events, err := accountEventRepo.Fetch("2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+
+	It("completes transactions in flight before advancing epoch", func() {
+		createTxnSub, err := bus.Subscribe(CreateTxn.String())
+		Expect(err).ToNot(HaveOccurred())
+		accDepositedSub, err := bus.Subscribe(model.AccountDeposited.String())
+		Expect(err).ToNot(HaveOccurred())
+		writeDataCmdSub, err := bus.Subscribe(WriteData.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		txnReadEvent, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      TxnRead,
+			Data: &txn.CreateTxnReq{
+				ID:         "1",
+				CustomerID: "1",
+				LoadAmount: "$100",
+				Time:       "2000-01-05T00:00:01Z",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bus.Publish(txnReadEvent)).To(Succeed())
+		// Admitted same as by txn-service
+		createTxnCmd := model.Cmd{}
+		Eventually(createTxnSub).Should(Receive(&createTxnCmd))
+		Expect(flowEpoch.Admit(createTxnCmd.Epoch())).To(BeTrue())
+
+		// Transaction is still being created when draining starts
+		processMgrCancel()
+		Consistently(writeDataCmdSub).ShouldNot(Receive())
+		Expect(flowEpoch.Current()).To(BeZero())
+
+		txnTime, err := time.Parse(time.RFC3339, "2000-01-05T00:00:01Z")
+		Expect(err).ToNot(HaveOccurred())
+		publishTxnCreated(model.Transaction{
+			ID:         "1",
+			CustomerID: "1",
+			LoadAmount: 100,
+			Time:       txnTime,
+		})
+		Eventually(accDepositedSub).Should(Receive())
+		Eventually(writeDataCmdSub).Should(Receive())
+		Expect(flowEpoch.Current()).To(BeEquivalentTo(1))
+		Expect(flowEpoch.NumRejected()).To(BeZero())
+	})
+
+	It("publishes no commands for events received after drain", func() {
+		processTxnSub, err := bus.Subscribe(model.ProcessTxn.String())
+		Expect(err).ToNot(HaveOccurred())
+		writeDataCmdSub, err := bus.Subscribe(WriteData.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		processMgrCancel()
+		Eventually(writeDataCmdSub).Should(Receive())
+
+		publishTxnCreated(model.Transaction{
+			ID:         "1",
+			CustomerID: "1",
+			LoadAmount: 100,
+			Time:       time.Now(),
+		})
+		Consistently(processTxnSub).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,213 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// failingBus is a Bus which fails
+// publishing commands of an action.
+type failingBus struct {
+	eventutil.Bus
+	failAction model.CmdAction
+}
+
+func (b *failingBus) Publish(msg interface{}) error {
+	cmd, isCmd := msg.(model.Cmd)
+	if isCmd && cmd.Action() == b.failAction {
+		return errors.New("mock publish error")
+	}
+	return b.Bus.Publish(msg)
+}
+
+// Should be run with "-race" flag.
+var _ = Describe("ProcessMgr error-channel", func() {
+	const (
+		WriteData  model.CmdAction = "writeDataCmd"
+		CreateTxn  model.CmdAction = "createTxnCmd"
+		ProcessTxn model.CmdAction = "processTxnCmd"
+	)
+	const (
+		TxnRead         model.EventAction = "txnRead"
+		TxnCreated      model.EventAction = "txnCreated"
+		TxnCreateFailed model.EventAction = "txnCreateFailed"
+		ReportWritten   model.EventAction = "reportWritten"
+	)
+	const numEvents = 50
+
+	var bus eventutil.Bus
+
+	var newTestProcessMgr = func(failAction model.CmdAction) *processMgr {
+		processMgr, err := newProcessMgr(&ProcessMgrCfg{
+			Log: logger.NewStdLogger("ProcessMgr"),
+			Bus: &failingBus{
+				Bus:        bus,
+				failAction: failAction,
+			},
+			TxnResultViewRepo: &mockResultViewRepo{},
+
+			WriteData:  WriteData,
+			CreateTxn:  CreateTxn,
+			ProcessTxn: ProcessTxn,
+
+			TxnRead:         TxnRead,
+			TxnCreated:      TxnCreated,
+			TxnCreateFailed: TxnCreateFailed,
+			ReportWritten:   ReportWritten,
+
+			IdleTimeoutSec:               3600,
+			ReportWrittenEventTimeoutSec: 2,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return processMgr
+	}
+
+	// Publishes events concurrently. Publishing errors are
+	// ignored, since process-manager might have returned.
+	var publishEvents = func(action model.EventAction) *sync.WaitGroup {
+		wg := &sync.WaitGroup{}
+		for i := 0; i < numEvents; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				event, err := model.NewEvent(&model.EventCfg{
+					AggregateID: fmt.Sprintf("%d", i),
+					Action:      action,
+					Data:        []byte("{}"),
+				})
+				Expect(err).ToNot(HaveOccurred())
+				_ = bus.Publish(event)
+			}(i)
+		}
+		return wg
+	}
+
+	// Returns channel closed once wait-group is done
+	var waitSig = func(wg *sync.WaitGroup) <-chan struct{} {
+		sig := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(sig)
+		}()
+		return sig
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("drops errors sent after owner stops receiving", func() {
+		errs := newErrSink()
+
+		sent := make(chan bool, numEvents)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < numEvents; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				sent <- errs.send(fmt.Errorf("error %d", i))
+			}(i)
+		}
+
+		// Owner returns after first error
+		Eventually(errs.errs).Should(Receive(HaveOccurred()))
+		errs.close()
+		errs.close()
+
+		Eventually(waitSig(wg)).Should(BeClosed())
+		close(sent)
+		numSent := 0
+		for isSent := range sent {
+			if isSent {
+				numSent++
+			}
+		}
+		Expect(numSent).To(Equal(1))
+		Expect(errs.send(errors.New("late error"))).To(BeFalse())
+	})
+
+	It("returns first publish-error without blocking other publishing routines", func() {
+		processMgr := newTestProcessMgr(CreateTxn)
+		startErr := make(chan error, 1)
+		go func() {
+			startErr <- processMgr.start(context.Background())
+		}()
+
+		published := publishEvents(TxnRead)
+		var err error
+		Eventually(startErr, 5*time.Second).Should(Receive(&err))
+		Expect(err).To(MatchError(ContainSubstring("mock publish error")))
+
+		Eventually(waitSig(published)).Should(BeClosed())
+		// Routines which failed after process-manager
+		// returned must not block on sending errors.
+		Eventually(processMgr.pending.idle()).Should(BeClosed())
+	})
+
+	It("handles publish-errors concurrent with report completion", func() {
+		writeDataSub, err := bus.Subscribe(WriteData.String())
+		Expect(err).ToNot(HaveOccurred())
+		writerDone := make(chan struct{})
+		defer func() {
+			close(writerDone)
+			Expect(bus.Unsubscribe(writeDataSub, WriteData.String())).To(Succeed())
+		}()
+		// Mock writer-service acknowledging reports
+		go func() {
+			for {
+				select {
+				case <-writerDone:
+					return
+				case <-writeDataSub:
+					event, err := model.NewEvent(&model.EventCfg{
+						AggregateID: "writer",
+						Action:      ReportWritten,
+						Data:        []byte("{}"),
+					})
+					if err == nil {
+						_ = bus.Publish(event)
+					}
+				}
+			}
+		}()
+
+		for i := 0; i < 10; i++ {
+			processMgr := newTestProcessMgr(ProcessTxn)
+			ctx, cancel := context.WithCancel(context.Background())
+			startErr := make(chan error, 1)
+			go func() {
+				startErr <- processMgr.start(ctx)
+			}()
+
+			published := publishEvents(TxnCreated)
+			// Report is written while commands are still failing
+			cancel()
+
+			// Either path may win, but process-manager
+			// must return exactly once without panicking.
+			var err error
+			Eventually(startErr, 5*time.Second).Should(Receive(&err))
+			if err != nil {
+				Expect(err).To(MatchError(ContainSubstring("mock publish error")))
+			}
+			Eventually(waitSig(published)).Should(BeClosed())
+			Eventually(processMgr.pending.idle()).Should(BeClosed())
+		}
+	})
+})
@@ -0,0 +1,208 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// mockResultViewRepo is a TxnResultViewRepo
+// which serializes to a fixed payload.
+type mockResultViewRepo struct {
+	serialized string
+}
+
+func (r *mockResultViewRepo) Insert(accountview.TxnResultEntry) error {
+	return nil
+}
+
+func (r *mockResultViewRepo) RemoveCustomer(string) error {
+	return nil
+}
+
+func (r *mockResultViewRepo) Serialized() string {
+	return r.serialized
+}
+
+func (r *mockResultViewRepo) Index() int {
+	return 0
+}
+
+var _ = Describe("ProcessMgr report-timeout", func() {
+	const (
+		WriteData  model.CmdAction = "writeDataCmd"
+		CreateTxn  model.CmdAction = "createTxnCmd"
+		ProcessTxn model.CmdAction = "processTxnCmd"
+	)
+	const (
+		TxnRead           model.EventAction = "txnRead"
+		TxnCreated        model.EventAction = "txnCreated"
+		TxnCreateFailed   model.EventAction = "txnCreateFailed"
+		ReportWritten     model.EventAction = "reportWritten"
+		ReportWriteFailed model.EventAction = "reportWriteFailed"
+	)
+	// 2MB report at 10sec/MB scales
+	// timeout to 20 seconds.
+	const reportSize = 2 * 1024 * 1024
+	const reportTimeoutPerMB = 10
+
+	var bus eventutil.Bus
+	var fakeClock *clock.FakeClock
+
+	var processMgrCancel context.CancelFunc
+	var processMgrErrGroup *errgroup.Group
+
+	// Cancels process-manager and waits until it
+	// has published the report and started its
+	// report-timeout timer.
+	var awaitReport = func() {
+		writeDataCmdSub, err := bus.Subscribe(WriteData.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		processMgrCancel()
+		Eventually(writeDataCmdSub).Should(Receive())
+		// Idle-timeout, drain-timeout and report-timeout timers
+		Eventually(fakeClock.Waiters).Should(Equal(3))
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		fakeClock = clock.NewFakeClock(time.Now())
+
+		var ctx context.Context
+		ctx, processMgrCancel = context.WithCancel(context.Background())
+		processMgrErrGroup, _ = errgroup.WithContext(context.Background())
+		processMgrErrGroup.Go(func() error {
+			err := InitProcessMgr(ctx, &ProcessMgrCfg{
+				Log: logger.NewStdLogger("ProcessMgr"),
+				Bus: bus,
+				TxnResultViewRepo: &mockResultViewRepo{
+					serialized: strings.Repeat("x", reportSize),
+				},
+
+				WriteData:  WriteData,
+				CreateTxn:  CreateTxn,
+				ProcessTxn: ProcessTxn,
+
+				TxnRead:           TxnRead,
+				TxnCreated:        TxnCreated,
+				TxnCreateFailed:   TxnCreateFailed,
+				ReportWritten:     ReportWritten,
+				ReportWriteFailed: ReportWriteFailed,
+
+				IdleTimeoutSec:               3600,
+				ReportWrittenEventTimeoutSec: 2,
+				ReportTimeoutPerMB:           reportTimeoutPerMB,
+
+				Clock: fakeClock,
+			})
+			if err != nil {
+				err = errors.Wrap(err, "error in process-manager")
+			}
+			return err
+		})
+		// Ensure the goroutine above
+		// is ready to process messages
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	AfterEach(func() {
+		processMgrCancel()
+		// Keep advancing clock so any pending
+		// report-timeout expires and lets the
+		// process-manager exit.
+		doneSig := make(chan struct{})
+		go func() {
+			_ = processMgrErrGroup.Wait()
+			close(doneSig)
+		}()
+		Eventually(func() bool {
+			fakeClock.Advance(time.Hour)
+			select {
+			case <-doneSig:
+				return true
+			default:
+				return false
+			}
+		}).Should(BeTrue())
+		bus.Terminate()
+	})
+
+	It("scales timeout by report-size within bounds", func() {
+		mgr := &processMgr{
+			reportWrittenEventTimeoutSec: 2,
+			reportTimeoutPerMB:           reportTimeoutPerMB,
+		}
+		Expect(mgr.reportTimeout(reportSize)).To(Equal(20 * time.Second))
+		// Min defaults to fixed-timeout
+		Expect(mgr.reportTimeout(1024)).To(Equal(2 * time.Second))
+
+		mgr.reportTimeoutMinSec = 5
+		mgr.reportTimeoutMaxSec = 15
+		Expect(mgr.reportTimeout(1024)).To(Equal(5 * time.Second))
+		Expect(mgr.reportTimeout(reportSize)).To(Equal(15 * time.Second))
+
+		mgr.reportTimeoutPerMB = 0
+		Expect(mgr.reportTimeout(reportSize)).To(Equal(2 * time.Second))
+	})
+
+	It("succeeds when a large report is written within scaled timeout", func() {
+		awaitReport()
+
+		// Slow writer, takes longer than the fixed timeout
+		fakeClock.Advance(15 * time.Second)
+		dataWrittenEvent, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      ReportWritten,
+			Data:        []byte("test-data"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = bus.Publish(dataWrittenEvent)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = processMgrErrGroup.Wait()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("errors when report is not written within scaled timeout", func() {
+		awaitReport()
+
+		fakeClock.Advance(21 * time.Second)
+		err := processMgrErrGroup.Wait()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("timed-out"))
+	})
+
+	It("stops waiting when write-failed event is received", func() {
+		awaitReport()
+
+		writeFailedEvent, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      ReportWriteFailed,
+			Data: &writer.WriteFailure{
+				Error: "disk full",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = bus.Publish(writeFailedEvent)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = processMgrErrGroup.Wait()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("disk full"))
+	})
+})
@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("ProcessMgr shutdown", func() {
+	const (
+		WriteData  model.CmdAction = "writeDataCmd"
+		CreateTxn  model.CmdAction = "createTxnCmd"
+		ProcessTxn model.CmdAction = "processTxnCmd"
+	)
+	const (
+		TxnRead         model.EventAction = "txnRead"
+		TxnCreated      model.EventAction = "txnCreated"
+		TxnCreateFailed model.EventAction = "txnCreateFailed"
+		ReportWritten   model.EventAction = "reportWritten"
+	)
+
+	var bus eventutil.Bus
+	var fakeClock *clock.FakeClock
+	var processMgr *processMgr
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		fakeClock = clock.NewFakeClock(time.Now())
+
+		processMgr, err = newProcessMgr(&ProcessMgrCfg{
+			Log:               logger.NewStdLogger("ProcessMgr"),
+			Bus:               bus,
+			TxnResultViewRepo: &mockResultViewRepo{},
+
+			WriteData:  WriteData,
+			CreateTxn:  CreateTxn,
+			ProcessTxn: ProcessTxn,
+
+			TxnRead:         TxnRead,
+			TxnCreated:      TxnCreated,
+			TxnCreateFailed: TxnCreateFailed,
+			ReportWritten:   ReportWritten,
+
+			IdleTimeoutSec:               1,
+			ReportWrittenEventTimeoutSec: 3600,
+
+			Clock: fakeClock,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("writes report exactly once when context is done repeatedly", func() {
+		writeDataSub, err := bus.Subscribe(WriteData.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		startErr := make(chan error, 1)
+		go func() {
+			startErr <- processMgr.start(ctx)
+		}()
+		// Ensure idle-timeout timer is started
+		Eventually(fakeClock.Waiters).Should(Equal(1))
+
+		// Idle-timeout and parent-context race to close context
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cancel()
+			}()
+		}
+		fakeClock.Advance(time.Second)
+		wg.Wait()
+
+		Eventually(writeDataSub).Should(Receive())
+		Consistently(writeDataSub, 200*time.Millisecond).ShouldNot(Receive())
+		Expect(processMgr.stage).To(Equal(stageReporting))
+
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "writer",
+			Action:      ReportWritten,
+			Data:        []byte("{}"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bus.Publish(event)).To(Succeed())
+		Eventually(startErr).Should(Receive(BeNil()))
+		Expect(writeDataSub).ToNot(Receive())
+	})
+
+	It("advances shutdown-stages only forward", func() {
+		Expect(processMgr.advanceStage(stageDraining, stageReporting)).To(BeFalse())
+		Expect(processMgr.advanceStage(stageRunning, stageDraining)).To(BeTrue())
+		Expect(processMgr.advanceStage(stageRunning, stageDraining)).To(BeFalse())
+		Expect(processMgr.advanceStage(stageDraining, stageRunning)).To(BeFalse())
+		Expect(processMgr.advanceStage(stageDraining, stageReporting)).To(BeTrue())
+		Expect(processMgr.stage).To(Equal(stageReporting))
+	})
+
+	It("forgets dispatch-turns of customers once these end", func() {
+		prevPub, endFirst := processMgr.dispatchTurn(processMgr.lastCreateTxnPub, "cust-1")
+		Expect(prevPub).To(BeNil())
+		prevPub, endSecond := processMgr.dispatchTurn(processMgr.lastCreateTxnPub, "cust-1")
+		Expect(prevPub).ToNot(BeNil())
+
+		// Later turn of customer is still in flight
+		endFirst()
+		Expect(prevPub).To(BeClosed())
+		Expect(processMgr.lastCreateTxnPub).To(HaveKey("cust-1"))
+
+		endSecond()
+		Expect(processMgr.lastCreateTxnPub).To(BeEmpty())
+	})
+})
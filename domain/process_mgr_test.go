@@ -45,7 +45,7 @@ var _ = Describe("ProcessMgr", func() {
 		var err error
 		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
 		Expect(err).ToNot(HaveOccurred())
-		txnResultViewRepo = accountview.NewMemoryTxnResultViewRepo()
+		txnResultViewRepo = accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{})
 
 		// Start Process-Manager
 		var ctx context.Context
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+)
+
+// unspecifiedCause is listed in ProcessingSummary
+// for declines without a failure-cause.
+const unspecifiedCause = "Unspecified"
+
+// ProcessingSummary is written as a single line to summary-file
+// (see ProcessMgrCfg#SummaryFilePath) along with report.
+type ProcessingSummary struct {
+	LinesRead int `json:"lines_read"`
+	ValidTxns int `json:"valid_txns"`
+	// Counts of results in report, excluding
+	// test-transactions if view-repo excludes these.
+	Results  int `json:"results"`
+	Accepted int `json:"accepted"`
+	Declined int `json:"declined"`
+	// Transactions skipped by txn-creator
+	Skipped int `json:"skipped,omitempty"`
+	// Declined results by failure-cause
+	DeclinesByCause map[string]int `json:"declines_by_cause"`
+	StartedAt       time.Time      `json:"started_at"`
+	// Time from process-manager starting to writing report
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// newProcessingSummary creates summary from counts of view-repo.
+func newProcessingSummary(
+	linesRead int,
+	validTxns int,
+	counts accountview.TxnResultCounts,
+	startedAt time.Time,
+	endedAt time.Time,
+) *ProcessingSummary {
+	declinesByCause := make(map[string]int, len(counts.DeclinedByCause))
+	for cause, count := range counts.DeclinedByCause {
+		causeName := string(cause)
+		if causeName == "" {
+			causeName = unspecifiedCause
+		}
+		declinesByCause[causeName] += count
+	}
+
+	return &ProcessingSummary{
+		LinesRead:       linesRead,
+		ValidTxns:       validTxns,
+		Results:         counts.Accepted + counts.Declined + counts.Skipped,
+		Accepted:        counts.Accepted,
+		Declined:        counts.Declined,
+		Skipped:         counts.Skipped,
+		DeclinesByCause: declinesByCause,
+		StartedAt:       startedAt,
+		DurationMs:      endedAt.Sub(startedAt).Milliseconds(),
+	}
+}
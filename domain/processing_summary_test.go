@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/progress"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Processing summary", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+	var summaryPath string
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		tmpDir, err := ioutil.TempDir("", "processing-summary")
+		Expect(err).ToNot(HaveOccurred())
+		// Directory is created by writer
+		summaryPath = filepath.Join(tmpDir, "summary", "summary.json")
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+		os.RemoveAll(filepath.Dir(filepath.Dir(summaryPath)))
+	})
+
+	// routinesCfg creates config for run of transactions
+	// with accepted and declined results, writing report
+	// to ioWriter.
+	routinesCfg := func(ioWriter *domain_test.MockWriter) *RoutinesCfg {
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			// Exceeds daily limit
+			{ID: "3", CustomerID: "1", LoadAmount: "$6000", Time: "2000-01-05T02:00:00Z"},
+			// Invalid, has no result
+			{ID: "4", CustomerID: "2", LoadAmount: "invalid", Time: "2000-01-05T03:00:00Z"},
+			// Duplicate of "1"
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T04:00:00Z"},
+			{ID: "5", CustomerID: "3", LoadAmount: "$10", Time: "2000-01-05T05:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg.WriterCfg.AllowFileTargets = true
+
+		return &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				PayloadEnvelope: true,
+				SummaryFilePath: summaryPath,
+			},
+			WriterCfg: writerCfg,
+		}
+	}
+
+	It("writes summary matching report to summary-file", func(done Done) {
+		ioWriter := domain_test.NewMockWriter()
+		_, err := RunRoutines(routinesCfg(ioWriter))
+		Expect(err).ToNot(HaveOccurred())
+
+		numAccepted := 0
+		numDeclined := 0
+		reportLines := strings.Split(strings.TrimSpace(string(ioWriter.Content())), "\n")
+		for _, line := range reportLines {
+			result := accountview.TxnResultEntry{}
+			Expect(json.Unmarshal([]byte(line), &result)).To(Succeed())
+			if result.Accepted {
+				numAccepted++
+			} else {
+				numDeclined++
+			}
+		}
+
+		data, err := ioutil.ReadFile(summaryPath)
+		Expect(err).ToNot(HaveOccurred())
+		// Single line
+		Expect(strings.TrimSpace(string(data))).ToNot(ContainSubstring("\n"))
+
+		summary := &ProcessingSummary{}
+		Expect(json.Unmarshal(data, summary)).To(Succeed())
+		Expect(summary.LinesRead).To(Equal(6))
+		Expect(summary.ValidTxns).To(Equal(5))
+		Expect(summary.Results).To(Equal(len(reportLines)))
+		Expect(summary.Accepted).To(Equal(numAccepted))
+		Expect(summary.Declined).To(Equal(numDeclined))
+		Expect(summary.Accepted).To(Equal(3))
+		Expect(summary.DeclinesByCause).To(Equal(map[string]int{
+			string(account.DailyLimitsExceeded): 1,
+			string(account.DuplicateTxn):        1,
+		}))
+		Expect(summary.StartedAt).ToNot(BeZero())
+		Expect(summary.DurationMs).To(BeNumerically(">=", 0))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("reports final progress of run", func(done Done) {
+		output := &bytes.Buffer{}
+		cfg := routinesCfg(domain_test.NewMockWriter())
+		cfg.Progress = &progress.Cfg{
+			Writer: output,
+			// Only final line is reported
+			IntervalSec: 3600,
+			IsTerminal: func(io.Writer) bool {
+				return false
+			},
+		}
+		_, err := RunRoutines(cfg)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(output.String()).To(MatchRegexp(
+			`^done: read 6 lines \| processed \d+ \| accepted 3 rejected 2 \| .+ txn/s \| elapsed \S+\n$`,
+		))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("errors if view-repo doesn't provide counts of results", func() {
+		err := (&ProcessMgrCfg{
+			Log:               logger.NewStdLogger("ProcessMgr"),
+			Bus:               bus,
+			TxnResultViewRepo: &uncountedResultRepo{},
+
+			WriteData:  model.WriteData,
+			CreateTxn:  model.CreateTxn,
+			ProcessTxn: model.ProcessTxn,
+
+			TxnRead:         model.TxnRead,
+			TxnCreated:      model.TxnCreated,
+			TxnCreateFailed: model.TxnCreateFailed,
+			ReportWritten:   model.DataWritten,
+
+			IdleTimeoutSec:               processMgrIdleTimeoutSec,
+			ReportWrittenEventTimeoutSec: 3,
+
+			PayloadEnvelope: true,
+			SummaryFilePath: summaryPath,
+		}).Validate()
+		Expect(err).To(MatchError(ContainSubstring("providing counts of results")))
+	})
+})
+
+// uncountedResultRepo hides counts of wrapped repo.
+type uncountedResultRepo struct {
+	accountview.TxnResultViewRepo
+}
@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/profile"
+)
+
+var _ = Describe("Ingestion-profiles", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	// run runs routines on input-file with sample-profile, and
+	// returns run-summary, "<id>:<customer-id>:<disposition>"
+	// of results in input-order, and number of skipped lines.
+	run := func(profileName string, inputPath string) (*RunSummary, []string, int) {
+		ingestionProfile, err := profile.LoadNamed("../_samples/profiles", profileName)
+		Expect(err).ToNot(HaveOccurred())
+
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		defer bus.Terminate()
+
+		input, err := os.Open(inputPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer input.Close()
+		ioWriter := domain_test.NewMockWriter()
+		deadLetterLog := eventutil.NewMemoryDeadLetterLog()
+
+		cfgProvider := domain_test.ConfigProvider{}
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		ingestionProfile.ApplyCreator(txnCreatorCfg.CreatorCfg)
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		readerCfg := &reader.Cfg{
+			Log:        logger.NewStdLogger("reader"),
+			Bus:        bus,
+			Reader:     input,
+			DataRead:   model.TxnRead,
+			ReadFailed: model.TxnReadFailed,
+
+			DeadLetterLog:   deadLetterLog,
+			MaxSkippedLines: 1,
+		}
+		ingestionProfile.ApplyReader(readerCfg)
+
+		summary, err := RunRoutines(&RoutinesCfg{
+			Log:         logger.NewStdLogger("runner"),
+			WiringCheck: WiringCheckStrict,
+			ReaderCfg:   readerCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				ReportWriteFailed: model.WriteFailed,
+				TxnReadFailed:     model.TxnReadFailed,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				OrderedDispatch: true,
+				ReportSort:      ReportSortInputOrder,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			WriterCfg:      writerCfg,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		results := make([]string, 0)
+		for _, line := range strings.Split(strings.TrimSpace(string(ioWriter.Content())), "\n") {
+			entry := accountview.TxnResultEntry{}
+			Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+			disposition := "declined"
+			if entry.Accepted {
+				disposition = "accepted"
+			}
+			results = append(results, entry.ID+":"+entry.CustomerID+":"+disposition)
+		}
+		skippedLines, err := deadLetterLog.Entries()
+		Expect(err).ToNot(HaveOccurred())
+		return summary, results, len(skippedLines)
+	}
+
+	It("runs strict JSON-input of USD-partner", func(done Done) {
+		summary, results, numSkipped := run("usd-strict", "testdata/profile_usd_strict.ndjson")
+		// Zero-amount, precision, max-amount, currency and
+		// time-format failures are rejected by txn-creator.
+		Expect(results).To(Equal([]string{
+			"1:10:accepted",
+			// Above daily amount-limit
+			"5:11:declined",
+			"8:12:accepted",
+		}))
+		Expect(summary.ValidTxns).To(Equal(3))
+		Expect(numSkipped).To(BeZero())
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("runs lax CSV-input of EUR-partner", func(done Done) {
+		summary, results, numSkipped := run("eur-lax", "testdata/profile_eur_lax.csv")
+		// Customer-IDs are normalized, and zero-amounts and
+		// amounts of any precision are accepted. Invalid amounts
+		// and times are rejected.
+		Expect(results).To(Equal([]string{
+			"1:42:accepted",
+			"2:42:accepted",
+			// Above daily amount-limit
+			"3:7:declined",
+			"6:8:accepted",
+		}))
+		Expect(summary.ValidTxns).To(Equal(4))
+		// Record not matching header
+		Expect(numSkipped).To(Equal(1))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
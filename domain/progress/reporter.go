@@ -0,0 +1,238 @@
+// Package progress reports progress of batch runs
+// to operators, as concise periodic lines.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+// DefaultIntervalSec is default interval between progress-lines.
+const DefaultIntervalSec = 10
+
+// Snapshot is progress of a run at a point in time.
+type Snapshot struct {
+	// Lines read from input
+	LinesRead int
+	// Events indexed by transaction-result view
+	Processed int
+	Accepted  int
+	Declined  int
+}
+
+// Source provides current progress of a run.
+// Must be safe to call while run is in progress.
+type Source interface {
+	Snapshot() Snapshot
+}
+
+// SourceFunc is a Source backed by a function.
+type SourceFunc func() Snapshot
+
+// Snapshot returns result of function.
+func (f SourceFunc) Snapshot() Snapshot {
+	return f()
+}
+
+// Cfg is config for Reporter.
+type Cfg struct {
+	// Optional, set by domain#RunRoutines from
+	// its reader and transaction-result view.
+	Source Source
+	// Optional, defaults to os.Stderr. Every line is written
+	// with a single write, so lines don't interleave with
+	// logs of a logger sharing same writer.
+	Writer io.Writer
+	// Optional, defaults to DefaultIntervalSec.
+	IntervalSec int `validate:"min=0"`
+	// Optional, total lines of input, if known.
+	TotalLines int `validate:"min=0"`
+	// Optional, defaults to clock.RealClock.
+	Clock clock.Clock
+	// Optional, defaults to logger#IsTerminal. Progress-line
+	// is rewritten in place (using carriage-return) if Writer
+	// is a terminal, otherwise every line is appended.
+	IsTerminal func(w io.Writer) bool
+}
+
+// Reporter periodically writes a line summarizing progress
+// of a run, and a final line once run completes.
+// Use #NewReporter to create new instance.
+type Reporter struct {
+	source   Source
+	writer   io.Writer
+	interval time.Duration
+	total    int
+	clock    clock.Clock
+	inPlace  bool
+
+	startedAt time.Time
+	// Snapshot and time of last line,
+	// for throughput since last line.
+	last   Snapshot
+	lastAt time.Time
+	// Length of last in-place line,
+	// so shorter lines clear it.
+	lastLen int
+}
+
+// NewReporter validates config and creates new Reporter.
+func NewReporter(cfg *Cfg) (*Reporter, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Source == nil {
+		return nil, errors.New("source is nil")
+	}
+
+	w := cfg.Writer
+	if w == nil {
+		w = os.Stderr
+	}
+	intervalSec := cfg.IntervalSec
+	if intervalSec == 0 {
+		intervalSec = DefaultIntervalSec
+	}
+	clk := cfg.Clock
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	isTerminal := cfg.IsTerminal
+	if isTerminal == nil {
+		isTerminal = logger.IsTerminal
+	}
+
+	return &Reporter{
+		source:   cfg.Source,
+		writer:   w,
+		interval: time.Duration(intervalSec) * time.Second,
+		total:    cfg.TotalLines,
+		clock:    clk,
+		inPlace:  isTerminal(w),
+	}, nil
+}
+
+// Start writes a progress-line every interval until
+// context is done, and then writes final line.
+func (r *Reporter) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("context is nil")
+	}
+	r.startedAt = r.clock.Now()
+	r.lastAt = r.startedAt
+
+	for {
+		select {
+		case <-ctx.Done():
+			return r.writeFinal()
+		case <-r.clock.After(r.interval):
+			err := r.writeProgress()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeProgress writes line with throughput since last line.
+func (r *Reporter) writeProgress() error {
+	now := r.clock.Now()
+	snapshot := r.source.Snapshot()
+	rate := ratePerSec(snapshot.Processed-r.last.Processed, now.Sub(r.lastAt))
+	r.last = snapshot
+	r.lastAt = now
+
+	line := r.format(snapshot, rate, now.Sub(r.startedAt))
+	if !r.inPlace {
+		return r.write(line + "\n")
+	}
+	padding := ""
+	if len(line) < r.lastLen {
+		padding = strings.Repeat(" ", r.lastLen-len(line))
+	}
+	r.lastLen = len(line)
+	return r.write("\r" + line + padding)
+}
+
+// writeFinal writes line with average throughput of run.
+func (r *Reporter) writeFinal() error {
+	now := r.clock.Now()
+	snapshot := r.source.Snapshot()
+	elapsed := now.Sub(r.startedAt)
+	line := "done: " + r.format(snapshot, ratePerSec(snapshot.Processed, elapsed), elapsed)
+
+	if r.inPlace && r.lastLen > 0 {
+		// Final line replaces progress-line
+		padding := ""
+		if len(line) < r.lastLen {
+			padding = strings.Repeat(" ", r.lastLen-len(line))
+		}
+		return r.write("\r" + line + padding + "\n")
+	}
+	return r.write(line + "\n")
+}
+
+func (r *Reporter) write(data string) error {
+	_, err := io.WriteString(r.writer, data)
+	return errors.Wrap(err, "error writing progress")
+}
+
+// format formats line such as: "read 120k/450k lines | processed
+// 118.2k | accepted 117.9k rejected 300 | 9.8k txn/s | elapsed 2m10s".
+func (r *Reporter) format(snapshot Snapshot, rate float64, elapsed time.Duration) string {
+	read := fmt.Sprintf("read %s lines", formatCount(float64(snapshot.LinesRead)))
+	if r.total > 0 {
+		read = fmt.Sprintf(
+			"read %s/%s lines",
+			formatCount(float64(snapshot.LinesRead)), formatCount(float64(r.total)),
+		)
+	}
+	return fmt.Sprintf(
+		"%s | processed %s | accepted %s rejected %s | %s txn/s | elapsed %s",
+		read,
+		formatCount(float64(snapshot.Processed)),
+		formatCount(float64(snapshot.Accepted)),
+		formatCount(float64(snapshot.Declined)),
+		formatCount(rate),
+		elapsed.Round(time.Second),
+	)
+}
+
+func ratePerSec(count int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(count) / elapsed.Seconds()
+}
+
+// formatCount formats count compactly, such as
+// "300", "9.8k", "120k" or "1.2M".
+func formatCount(count float64) string {
+	suffix := ""
+	switch {
+	case count >= 1e6:
+		count /= 1e6
+		suffix = "M"
+	case count >= 1e3:
+		count /= 1e3
+		suffix = "k"
+	default:
+		return fmt.Sprintf("%.0f", count)
+	}
+	formatted := fmt.Sprintf("%.1f", count)
+	return strings.TrimSuffix(formatted, ".0") + suffix
+}
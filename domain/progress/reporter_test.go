@@ -0,0 +1,210 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/progress"
+)
+
+func TestProgress(t *testing.T) {
+	os.Setenv("LOG_LEVEL", "warn")
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Progress Suite")
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	lock *sync.Mutex
+	buf  *bytes.Buffer
+}
+
+func newSyncBuffer() *syncBuffer {
+	return &syncBuffer{
+		lock: &sync.Mutex{},
+		buf:  &bytes.Buffer{},
+	}
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+var _ = Describe("Reporter", func() {
+	const intervalSec = 10
+	interval := intervalSec * time.Second
+	startTime := time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	var fakeClock *clock.FakeClock
+	var output *syncBuffer
+	var sourceLock *sync.Mutex
+	var snapshot progress.Snapshot
+	var cancel context.CancelFunc
+	var reporterErr chan error
+
+	setSnapshot := func(s progress.Snapshot) {
+		sourceLock.Lock()
+		defer sourceLock.Unlock()
+		snapshot = s
+	}
+
+	startReporter := func(isTerminal bool) {
+		reporter, err := progress.NewReporter(&progress.Cfg{
+			Source: progress.SourceFunc(func() progress.Snapshot {
+				sourceLock.Lock()
+				defer sourceLock.Unlock()
+				return snapshot
+			}),
+			Writer:      output,
+			IntervalSec: intervalSec,
+			TotalLines:  450000,
+			Clock:       fakeClock,
+			IsTerminal: func(io.Writer) bool {
+				return isTerminal
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		reporterErr = make(chan error, 1)
+		go func() {
+			reporterErr <- reporter.Start(ctx)
+		}()
+		Eventually(fakeClock.Waiters).Should(Equal(1))
+	}
+
+	// tick advances clock by an interval, and waits
+	// for reporter to write line and wait again.
+	tick := func() {
+		fakeClock.Advance(interval)
+		Eventually(fakeClock.Waiters).Should(Equal(1))
+	}
+
+	BeforeEach(func() {
+		fakeClock = clock.NewFakeClock(startTime)
+		output = newSyncBuffer()
+		sourceLock = &sync.Mutex{}
+		snapshot = progress.Snapshot{}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("appends a line every interval, and final line once done", func() {
+		startReporter(false)
+
+		setSnapshot(progress.Snapshot{
+			LinesRead: 120000,
+			Processed: 118200,
+			Accepted:  117900,
+			Declined:  300,
+		})
+		tick()
+		Expect(output.String()).To(Equal(
+			"read 120k/450k lines | processed 118.2k | accepted 117.9k rejected 300 | " +
+				"11.8k txn/s | elapsed 10s\n",
+		))
+
+		setSnapshot(progress.Snapshot{
+			LinesRead: 130000,
+			Processed: 128200,
+			Accepted:  127800,
+			Declined:  400,
+		})
+		tick()
+		Expect(output.String()).To(HaveSuffix(
+			"read 130k/450k lines | processed 128.2k | accepted 127.8k rejected 400 | " +
+				"1k txn/s | elapsed 20s\n",
+		))
+
+		cancel()
+		Eventually(reporterErr).Should(Receive(BeNil()))
+		Expect(output.String()).To(Equal(
+			"read 120k/450k lines | processed 118.2k | accepted 117.9k rejected 300 | " +
+				"11.8k txn/s | elapsed 10s\n" +
+				"read 130k/450k lines | processed 128.2k | accepted 127.8k rejected 400 | " +
+				"1k txn/s | elapsed 20s\n" +
+				// Average throughput of run
+				"done: read 130k/450k lines | processed 128.2k | accepted 127.8k rejected 400 | " +
+				"6.4k txn/s | elapsed 20s\n",
+		))
+	})
+
+	It("rewrites line in place if writer is a terminal", func() {
+		startReporter(true)
+
+		setSnapshot(progress.Snapshot{
+			LinesRead: 450000,
+			Processed: 1200000,
+			Accepted:  1100000,
+			Declined:  100000,
+		})
+		tick()
+		firstLine := "read 450k/450k lines | processed 1.2M | accepted 1.1M rejected 100k | " +
+			"120k txn/s | elapsed 10s"
+		Expect(output.String()).To(Equal("\r" + firstLine))
+
+		// Shorter line clears rest of previous line
+		setSnapshot(progress.Snapshot{
+			LinesRead: 450000,
+			Processed: 1200000,
+			Accepted:  1100000,
+			Declined:  100000,
+		})
+		tick()
+		secondLine := "read 450k/450k lines | processed 1.2M | accepted 1.1M rejected 100k | " +
+			"0 txn/s | elapsed 20s"
+		padding := "   "
+		Expect(len(secondLine + padding)).To(Equal(len(firstLine)))
+		Expect(output.String()).To(Equal("\r" + firstLine + "\r" + secondLine + padding))
+
+		cancel()
+		Eventually(reporterErr).Should(Receive(BeNil()))
+		Expect(output.String()).To(HaveSuffix(
+			"\rdone: read 450k/450k lines | processed 1.2M | accepted 1.1M rejected 100k | " +
+				"60k txn/s | elapsed 20s\n",
+		))
+	})
+
+	It("writes only final line if run completes within an interval", func() {
+		startReporter(false)
+
+		setSnapshot(progress.Snapshot{
+			LinesRead: 3,
+			Processed: 2,
+			Accepted:  1,
+			Declined:  1,
+		})
+		fakeClock.Advance(2 * time.Second)
+		cancel()
+		Eventually(reporterErr).Should(Receive(BeNil()))
+		Expect(output.String()).To(Equal(
+			"done: read 3/450k lines | processed 2 | accepted 1 rejected 1 | 1 txn/s | elapsed 2s\n",
+		))
+	})
+
+	It("errors if source is not set", func() {
+		_, err := progress.NewReporter(&progress.Cfg{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,139 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Encoding is text-encoding of input.
+type Encoding string
+
+// Supported input-encodings.
+const (
+	EncodingUTF8    Encoding = "utf8"
+	EncodingUTF16LE Encoding = "utf16le"
+	EncodingUTF16BE Encoding = "utf16be"
+)
+
+// Byte-order marks of supported encodings.
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// EncodingMismatchError is returned if input's encoding,
+// detected from its start, differs from configured encoding.
+type EncodingMismatchError struct {
+	Detected   Encoding
+	Configured Encoding
+}
+
+func (e *EncodingMismatchError) Error() string {
+	return fmt.Sprintf(
+		"input appears to be encoded as %s, but is configured as %s",
+		e.Detected, e.Configured,
+	)
+}
+
+// DecodeInput returns io.Reader reading provided input as UTF-8,
+// with byte-order mark (if any) removed. If encoding is blank,
+// it is detected from byte-order mark, defaulting to UTF-8.
+// Encoding is checked on first read, so this doesn't block on
+// input. First read returns *EncodingMismatchError if input's
+// start (byte-order mark, or zero-bytes of UTF-16 encoded ASCII)
+// contradicts encoding.
+func DecodeInput(r io.Reader, encoding Encoding) (io.Reader, error) {
+	switch encoding {
+	case "", EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE:
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+	return &decodingReader{
+		src:      bufio.NewReader(r),
+		encoding: encoding,
+	}, nil
+}
+
+// decodingReader decodes input as per its
+// encoding, which is checked on first read.
+type decodingReader struct {
+	src      *bufio.Reader
+	encoding Encoding
+
+	decoded io.Reader
+	err     error
+}
+
+func (r *decodingReader) Read(p []byte) (int, error) {
+	if r.decoded == nil && r.err == nil {
+		r.decoded, r.err = r.decoder()
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.decoded.Read(p)
+}
+
+// decoder checks encoding against start of
+// input, and returns reader decoding input.
+func (r *decodingReader) decoder() (io.Reader, error) {
+	// Read-errors are returned again on next read
+	start, _ := r.src.Peek(len(bomUTF8))
+	if len(start) == 0 {
+		return r.src, nil
+	}
+	detected, hasBOM := detectEncoding(start)
+	encoding := r.encoding
+	if encoding == "" {
+		encoding = detected
+	} else if detected != encoding {
+		return nil, &EncodingMismatchError{
+			Detected:   detected,
+			Configured: encoding,
+		}
+	}
+
+	switch encoding {
+	case EncodingUTF16LE:
+		decoder := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+		return transform.NewReader(r.src, decoder), nil
+	case EncodingUTF16BE:
+		decoder := unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder()
+		return transform.NewReader(r.src, decoder), nil
+	default:
+		if hasBOM {
+			_, err := r.src.Discard(len(bomUTF8))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return r.src, nil
+	}
+}
+
+// detectEncoding detects encoding from start of input, using its
+// byte-order mark if present. Otherwise, since lines start with
+// ASCII characters, a zero-byte in first character indicates UTF-16.
+// Defaults to UTF-8.
+func detectEncoding(start []byte) (encoding Encoding, hasBOM bool) {
+	switch {
+	case bytes.HasPrefix(start, bomUTF8):
+		return EncodingUTF8, true
+	case bytes.HasPrefix(start, bomUTF16LE):
+		return EncodingUTF16LE, true
+	case bytes.HasPrefix(start, bomUTF16BE):
+		return EncodingUTF16BE, true
+	case len(start) >= 2 && start[0] != 0 && start[1] == 0:
+		return EncodingUTF16LE, false
+	case len(start) >= 2 && start[0] == 0 && start[1] != 0:
+		return EncodingUTF16BE, false
+	default:
+		return EncodingUTF8, false
+	}
+}
@@ -0,0 +1,99 @@
+package reader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Format is format of records in input.
+type Format string
+
+// Supported input-formats.
+const (
+	// A JSON-object per line, published as is.
+	FormatNDJSON Format = "ndjson"
+	// Comma-separated values, a record per line, with first
+	// record as header. Every other record is published as
+	// a JSON-object, with values (as strings) keyed by their
+	// column-names. Records which can't be converted (such
+	// as with too many values) are published as is, so these
+	// are handled same as malformed JSON-lines.
+	FormatCSV Format = "csv"
+)
+
+// csvConverter converts CSV-records (lines)
+// to JSON-objects, keyed by their header.
+type csvConverter struct {
+	// Renames columns of header to keys of JSON-objects.
+	// Columns not listed keep their name.
+	columns map[string]string
+	// Keys of JSON-objects, nil till header is read
+	header []string
+}
+
+// newLineConverter returns converter for format, or nil if
+// lines of format are published as is. Columns only apply
+// to FormatCSV.
+func newLineConverter(format Format, columns map[string]string) (*csvConverter, error) {
+	switch format {
+	case "", FormatNDJSON:
+		if len(columns) > 0 {
+			return nil, fmt.Errorf("columns can only be set for format: %s", FormatCSV)
+		}
+		return nil, nil
+	case FormatCSV:
+		return &csvConverter{columns: columns}, nil
+	default:
+		return nil, fmt.Errorf("invalid input-format: %s", format)
+	}
+}
+
+// convert returns line converted to a JSON-object. Returns
+// true if line was header, which isn't published.
+func (c *csvConverter) convert(line string) (string, bool) {
+	values, err := parseCSVRecord(line)
+	if c.header == nil {
+		// Header is required to convert any other record
+		if err != nil {
+			values = []string{line}
+		}
+		c.header = make([]string, len(values))
+		for i, column := range values {
+			column = strings.TrimSpace(column)
+			if key, exists := c.columns[column]; exists {
+				column = key
+			}
+			c.header[i] = column
+		}
+		return "", true
+	}
+	if err != nil || len(values) != len(c.header) {
+		return line, false
+	}
+
+	record := make(map[string]string, len(values))
+	for i, value := range values {
+		record[c.header[i]] = value
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return line, false
+	}
+	return string(data), false
+}
+
+// parseCSVRecord parses a single CSV-record.
+func parseCSVRecord(line string) ([]string, error) {
+	csvReader := csv.NewReader(strings.NewReader(line))
+	// Field-counts are checked against header instead
+	csvReader.FieldsPerRecord = -1
+	values, err := csvReader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing csv-record")
+	}
+	return values, nil
+}
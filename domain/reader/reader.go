@@ -2,10 +2,13 @@ package reader
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -13,7 +16,10 @@ import (
 
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/trace"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
 )
 
 // Reader reads the data line-by-line basis from provided io.Reader,
@@ -23,8 +29,31 @@ type Reader struct {
 	log     logger.Logger
 	scanner *bufio.Scanner
 
-	bus      eventutil.Bus
-	dataRead model.EventAction
+	bus            eventutil.Bus
+	dataRead       model.EventAction
+	readFailed     model.EventAction
+	linesPublished int
+	// Input-sequence of last line read, see #Start
+	inputSeq uint64
+
+	deadLetterLog   eventutil.DeadLetterLog
+	maxSkippedLines int
+	linesSkipped    int
+
+	preSortKey SortKeyFunc
+	buffered   []sortedLine
+	// Nil if lines are published as is
+	converter *csvConverter
+
+	// Lines and bytes scanned from input so far,
+	// including blank and skipped lines.
+	progressLock *sync.RWMutex
+	linesRead    int
+	bytesRead    int64
+
+	metrics  metrics.Metrics
+	tracer   trace.Tracer
+	warnings warnings.Collector
 }
 
 // Cfg defines config for Reader.
@@ -34,6 +63,70 @@ type Cfg struct {
 
 	Bus      eventutil.Bus     `validate:"nonnil"`
 	DataRead model.EventAction `validate:"nonzero"`
+	// Optional, published with ReadFailure as data
+	// if reading is interrupted by an error.
+	ReadFailed model.EventAction
+
+	// Optional. If set, malformed lines (not valid JSON)
+	// are skipped and stored here instead of being published.
+	DeadLetterLog eventutil.DeadLetterLog
+	// Reading fails once more than these many lines are
+	// skipped. Only applies if DeadLetterLog is set.
+	MaxSkippedLines int `validate:"min=0"`
+
+	// Optional. If set, all lines are read before any is
+	// published, and lines are published sorted by their
+	// SortKey (stable for equal keys). This allows lines to
+	// be processed in chronological order, at the cost of
+	// buffering complete input in memory.
+	PreSortKey SortKeyFunc
+
+	// Optional, counts lines read.
+	Metrics metrics.Metrics
+	// Optional, records span of reading every line,
+	// keyed by ID of its event (which starts its flow).
+	Tracer trace.Tracer
+	// Optional, collects warning for every skipped line.
+	Warnings warnings.Collector
+
+	// Optional, encoding of input. If not set, encoding
+	// is detected from byte-order mark, defaulting to
+	// UTF-8. See #DecodeInput.
+	Encoding Encoding
+	// Optional, format of input. Defaults to FormatNDJSON.
+	Format Format
+	// Optional, renames columns of FormatCSV header (keys)
+	// to keys of published JSON-objects (values), such as
+	// "amount" to "load_amount".
+	CSVColumns map[string]string
+}
+
+// ReadFailure is data for ReadFailed event.
+type ReadFailure struct {
+	LinesPublished int    `json:"lines_published"`
+	LinesSkipped   int    `json:"lines_skipped,omitempty"`
+	Error          string `json:"error"`
+}
+
+// PartialReadError is returned when reading stopped due
+// to an error before reaching end of input. All lines
+// before the error were published, so any results
+// produced from these cover the input only partially.
+type PartialReadError struct {
+	LinesPublished int
+	Cause          error
+}
+
+func (e *PartialReadError) Error() string {
+	return fmt.Sprintf(
+		"partial read, stopped after %d line(s): %s",
+		e.LinesPublished, e.Cause,
+	)
+}
+
+// Unwrap returns underlying read-error.
+func (e *PartialReadError) Unwrap() error {
+	return e.Cause
 }
 
 // NewReader validates Reader-Config
@@ -43,18 +136,112 @@ func NewReader(cfg *Cfg) (*Reader, error) {
 	if err != nil {
 		return nil, err
 	}
+	input, err := DecodeInput(cfg.Reader, cfg.Encoding)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating input-decoder")
+	}
+	converter, err := newLineConverter(cfg.Format, cfg.CSVColumns)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Reader{
+	reader := &Reader{
 		log:     cfg.Log,
-		scanner: bufio.NewScanner(cfg.Reader),
+		scanner: bufio.NewScanner(input),
+
+		bus:        cfg.Bus,
+		dataRead:   cfg.DataRead,
+		readFailed: cfg.ReadFailed,
+
+		deadLetterLog:   cfg.DeadLetterLog,
+		maxSkippedLines: cfg.MaxSkippedLines,
+
+		preSortKey: cfg.PreSortKey,
+		converter:  converter,
+
+		progressLock: &sync.RWMutex{},
+
+		metrics:  metrics.OrNoop(cfg.Metrics),
+		tracer:   trace.OrNoop(cfg.Tracer),
+		warnings: warnings.OrNoop(cfg.Warnings),
+	}
+	reader.scanner.Split(reader.scanLines)
+	return reader, nil
+}
+
+// Progress returns number of lines, and bytes (including
+// line-delimiters), scanned from input so far. Lines are
+// counted before being published, and include blank and
+// skipped lines. Safe to call while reader is running.
+func (r *Reader) Progress() (linesRead int, bytesRead int64) {
+	r.progressLock.RLock()
+	defer r.progressLock.RUnlock()
+
+	return r.linesRead, r.bytesRead
+}
+
+// scanLines splits input into lines same as #scanTrimmedLines,
+// while tracking progress of lines and bytes scanned.
+func (r *Reader) scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := scanTrimmedLines(data, atEOF)
+	if token != nil {
+		r.progressLock.Lock()
+		r.linesRead++
+		r.bytesRead += int64(advance)
+		r.progressLock.Unlock()
+	}
+	return advance, token, err
+}
+
+// scanTrimmedLines splits input into lines same as
+// bufio#ScanLines, also removing all trailing carriage-
+// returns, such as from files exported on Windows.
+func scanTrimmedLines(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if token != nil {
+		token = bytes.TrimRight(token, "\r")
+	}
+	return advance, token, err
+}
+
+// ForEachLine calls fn with each non-blank line of provided
+// io.Reader, decoded and split same as lines read by Reader
+// (with encoding detected from input). Line-numbers start
+// from 1, and include blank lines. Stops at first error
+// returned by fn, or error reading input.
+func ForEachLine(r io.Reader, fn func(lineNum int, line string) error) error {
+	input, err := DecodeInput(r, "")
+	if err != nil {
+		return errors.Wrap(err, "error creating input-decoder")
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Split(scanTrimmedLines)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if isBlankLine(line) {
+			continue
+		}
+		err := fn(lineNum, line)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
 
-		bus:      cfg.Bus,
-		dataRead: cfg.DataRead,
-	}, nil
+func isBlankLine(line string) bool {
+	return strings.ReplaceAll(line, "\n", "") == ""
 }
 
 // Start runs the loop which reads lines from provided
-// io.Reader and listens for context-signal.
+// io.Reader and listens for context-signal. Every line
+// published is assigned an input-sequence (see
+// model.Event#InputSeq), increasing in order lines are
+// read from input, even if these are pre-sorted.
+// Returns *PartialReadError if reading fails before end
+// of input, reaching end of input is not an error.
 func (r *Reader) Start(ctx context.Context) error {
 	if ctx == nil {
 		return errors.New("context is nil")
@@ -66,18 +253,29 @@ func (r *Reader) Start(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			r.log.Debug("Received context-done signal")
-			err := r.scanner.Err()
-			if err != nil {
-				return errors.Wrap(err, "errored reading data")
-			}
-			return nil
+			return r.readErr(r.scanner.Err())
 
 		default:
 			data := r.scanner.Text()
-			trimmedData := strings.ReplaceAll(data, "\n", "")
-			if trimmedData == "" {
+			if isBlankLine(data) {
 				continue
 			}
+			if r.converter != nil {
+				var isHeader bool
+				data, isHeader = r.converter.convert(data)
+				if isHeader {
+					continue
+				}
+			}
+
+			isMalformed := r.deadLetterLog != nil && !json.Valid([]byte(data))
+			// Malformed lines are skipped, so
+			// these don't get an input-sequence.
+			var inputSeq uint64
+			if !isMalformed {
+				r.inputSeq++
+				inputSeq = r.inputSeq
+			}
 
 			aggID, err := uuid.NewRandom()
 			if err != nil {
@@ -85,27 +283,121 @@ func (r *Reader) Start(ctx context.Context) error {
 			}
 			event, err := model.NewEvent(&model.EventCfg{
 				AggregateID: aggID.String(),
+				InputSeq:    inputSeq,
 				Action:      r.dataRead,
 				Data:        []byte(data),
 			})
 			if err != nil {
 				return errors.Wrap(err, "error creating event")
 			}
-			logPrefix := fmt.Sprintf("[Event: %s]:", event.ID())
+			// Ended before publishing, so span
+			// doesn't overlap with next stage.
+			span := r.tracer.StartSpan(trace.SpanRead, event.ID())
+			span.End()
+			if isMalformed {
+				err = r.skipLine(event)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 
-			r.log.Tracef("%s Publishing newly read data", logPrefix)
-			err = r.bus.Publish(event)
+			if r.preSortKey != nil {
+				r.bufferLine(event, data)
+				continue
+			}
+			err = r.publishLine(event)
 			if err != nil {
-				return errors.Wrap(err, "error publishing to bus")
+				return err
 			}
-			r.log.Tracef("%s Published newly read data", logPrefix)
+		}
+	}
+
+	// Lines read before a read-error are still published
+	if r.preSortKey != nil {
+		err := r.publishBuffered()
+		if err != nil {
+			return err
 		}
 	}
 
 	r.log.Debug("Finished reading data")
-	err := r.scanner.Err()
+	return r.readErr(r.scanner.Err())
+}
+
+// publishLine publishes line read on bus.
+func (r *Reader) publishLine(event model.Event) error {
+	logPrefix := fmt.Sprintf("[Event: %s]:", event.ID())
+
+	r.log.Tracef("%s Publishing newly read data", logPrefix)
+	err := r.bus.Publish(event)
 	if err != nil {
-		return errors.Wrap(err, "error reading file-lines")
+		return errors.Wrap(err, "error publishing to bus")
 	}
+	r.linesPublished++
+	r.metrics.IncLinesRead()
+	r.log.Tracef("%s Published newly read data", logPrefix)
 	return nil
 }
+
+// skipLine stores malformed line in dead-letter log.
+// Returns *PartialReadError if too many lines were skipped.
+func (r *Reader) skipLine(event model.Event) error {
+	r.linesSkipped++
+	reason := fmt.Sprintf(
+		"malformed line after %d published line(s): invalid JSON",
+		r.linesPublished,
+	)
+	r.log.Warnf("[Event: %s]: Skipping %s", event.ID(), reason)
+	r.warnings.Add("reader", warnings.SkippedLine, fmt.Sprintf("event %s: %s", event.ID(), reason))
+	err := r.deadLetterLog.Insert(event, reason)
+	if err != nil {
+		return errors.Wrap(err, "error inserting malformed line into dead-letter log")
+	}
+
+	if r.linesSkipped > r.maxSkippedLines {
+		return r.readErr(fmt.Errorf(
+			"skipped %d malformed line(s), exceeding limit of %d",
+			r.linesSkipped, r.maxSkippedLines,
+		))
+	}
+	return nil
+}
+
+// readErr returns *PartialReadError if reading stopped due
+// to an error, and publishes ReadFailed event if configured.
+func (r *Reader) readErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	r.log.Errorf("Reading stopped after %d line(s): %s", r.linesPublished, err)
+	readErr := &PartialReadError{
+		LinesPublished: r.linesPublished,
+		Cause:          err,
+	}
+	if r.readFailed == "" {
+		return readErr
+	}
+
+	aggID, err := uuid.NewRandom()
+	if err != nil {
+		return errors.Wrap(err, "error generating aggregate-id")
+	}
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID: aggID.String(),
+		Action:      r.readFailed,
+		Data: &ReadFailure{
+			LinesPublished: r.linesPublished,
+			LinesSkipped:   r.linesSkipped,
+			Error:          readErr.Cause.Error(),
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating event")
+	}
+	err = r.bus.Publish(event)
+	if err != nil {
+		return errors.Wrap(err, "error publishing to bus")
+	}
+	return readErr
+}
@@ -0,0 +1,504 @@
+package reader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
+)
+
+func TestReader(t *testing.T) {
+	os.Setenv("LOG_LEVEL", "error")
+	os.Setenv("EVENTBUS_LOG_LEVEL", "error")
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reader Suite")
+}
+
+var _ = Describe("Reader", func() {
+	const (
+		DataRead   model.EventAction = "dataRead"
+		ReadFailed model.EventAction = "readFailed"
+	)
+
+	var bus eventutil.Bus
+	var recorder *testsupport.BusRecorder
+	var deadLetterLog *eventutil.MemoryDeadLetterLog
+
+	// Input with two malformed lines
+	input := strings.Join([]string{
+		`{"id":"1"}`,
+		`{"id":"2"`,
+		`{"id":"3"}`,
+		`not-json`,
+		`{"id":"4"}`,
+	}, "\n")
+
+	var newReader = func(maxSkippedLines int) *Reader {
+		reader, err := NewReader(&Cfg{
+			Log:        logger.NewStdLogger("reader"),
+			Reader:     strings.NewReader(input),
+			Bus:        bus,
+			DataRead:   DataRead,
+			ReadFailed: ReadFailed,
+
+			DeadLetterLog:   deadLetterLog,
+			MaxSkippedLines: maxSkippedLines,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return reader
+	}
+
+	var readLines = func() []string {
+		lines := make([]string, 0)
+		for _, msg := range recorder.Messages(DataRead.String()) {
+			lines = append(lines, string(msg.(model.Event).Data()))
+		}
+		return lines
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		recorder, err = testsupport.NewBusRecorder(bus, DataRead.String(), ReadFailed.String())
+		Expect(err).ToNot(HaveOccurred())
+		deadLetterLog = eventutil.NewMemoryDeadLetterLog()
+	})
+
+	AfterEach(func() {
+		recorder.Stop()
+		bus.Terminate()
+	})
+
+	It("skips malformed lines within tolerance", func() {
+		err := newReader(2).Start(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(readLines).Should(Equal([]string{
+			`{"id":"1"}`,
+			`{"id":"3"}`,
+			`{"id":"4"}`,
+		}))
+		entries, err := deadLetterLog.Entries()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(string(entries[0].Msg.(model.Event).Data())).To(Equal(`{"id":"2"`))
+		Expect(string(entries[1].Msg.(model.Event).Data())).To(Equal(`not-json`))
+		Expect(recorder.Messages(ReadFailed.String())).To(BeEmpty())
+	})
+
+	It("collects warnings for skipped lines", func() {
+		collector := warnings.NewMemoryCollector(warnings.DefaultMaxDetails)
+		reader, err := NewReader(&Cfg{
+			Log:      logger.NewStdLogger("reader"),
+			Reader:   strings.NewReader(input),
+			Bus:      bus,
+			DataRead: DataRead,
+
+			DeadLetterLog:   deadLetterLog,
+			MaxSkippedLines: 2,
+			Warnings:        collector,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reader.Start(context.Background())).To(Succeed())
+
+		summary := collector.Summary()
+		Expect(summary.Counts()).To(Equal(warnings.Counts{warnings.SkippedLine: 2}))
+		details := summary[warnings.SkippedLine].Details
+		Expect(details).To(HaveLen(2))
+		Expect(details[0].Component).To(Equal("reader"))
+		Expect(details[0].Detail).To(ContainSubstring("after 1 published line(s)"))
+		Expect(details[1].Detail).To(ContainSubstring("after 2 published line(s)"))
+	})
+
+	It("fails once malformed lines exceed tolerance", func() {
+		err := newReader(1).Start(context.Background())
+
+		var partialErr *PartialReadError
+		Expect(errors.As(err, &partialErr)).To(BeTrue())
+		Expect(partialErr.LinesPublished).To(Equal(2))
+		Eventually(readLines).Should(Equal([]string{
+			`{"id":"1"}`,
+			`{"id":"3"}`,
+		}))
+
+		msg, err := recorder.WaitFor(ReadFailed.String(), nil, 2*time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		failure := &ReadFailure{}
+		err = json.Unmarshal(msg.(model.Event).Data(), failure)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(failure.LinesPublished).To(Equal(2))
+		Expect(failure.LinesSkipped).To(Equal(2))
+	})
+
+	It("publishes malformed lines if dead-letter log is not set", func() {
+		deadLetterLog = nil
+		reader, err := NewReader(&Cfg{
+			Log:      logger.NewStdLogger("reader"),
+			Reader:   strings.NewReader(input),
+			Bus:      bus,
+			DataRead: DataRead,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = reader.Start(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(readLines).Should(HaveLen(5))
+	})
+
+	Describe("progress", func() {
+		type progress struct {
+			lines int
+			bytes int64
+		}
+		var progressOf = func(reader *Reader) func() progress {
+			return func() progress {
+				lines, bytes := reader.Progress()
+				return progress{lines: lines, bytes: bytes}
+			}
+		}
+
+		It("reports lines and bytes read, including skipped lines", func() {
+			reader := newReader(2)
+			Expect(progressOf(reader)()).To(Equal(progress{}))
+
+			err := reader.Start(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(progressOf(reader)()).To(Equal(progress{
+				lines: 5,
+				bytes: int64(len(input)),
+			}))
+		})
+
+		It("reports progress while reading", func() {
+			pipeReader, pipeWriter := io.Pipe()
+			reader, err := NewReader(&Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Reader:   pipeReader,
+				Bus:      bus,
+				DataRead: DataRead,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			readErr := make(chan error, 1)
+			go func() {
+				readErr <- reader.Start(context.Background())
+			}()
+
+			firstLines := "{\"id\":\"1\"}\n\n{\"id\":\"2\"}\n"
+			_, err = pipeWriter.Write([]byte(firstLines))
+			Expect(err).ToNot(HaveOccurred())
+			// Blank lines are counted too
+			Eventually(progressOf(reader)).Should(Equal(progress{
+				lines: 3,
+				bytes: int64(len(firstLines)),
+			}))
+
+			_, err = pipeWriter.Write([]byte(`{"id":"3"}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pipeWriter.Close()).To(Succeed())
+			Eventually(readErr).Should(Receive(BeNil()))
+			Expect(progressOf(reader)()).To(Equal(progress{
+				lines: 4,
+				bytes: int64(len(firstLines) + len(`{"id":"3"}`)),
+			}))
+			Eventually(readLines).Should(HaveLen(3))
+		})
+	})
+
+	Describe("encoding", func() {
+		plainLines := []string{
+			`{"id":"1","customer_id":"1","load_amount":"$1","time":"2000-01-01T00:00:00Z"}`,
+			`{"id":"2","customer_id":"2","load_amount":"€2","time":"2000-01-01T00:00:00Z"}`,
+		}
+		plain := []byte(strings.Join(plainLines, "\n"))
+
+		var encodeUTF16 = func(endianness unicode.Endianness, bom unicode.BOMPolicy) []byte {
+			encoded, err := unicode.UTF16(endianness, bom).NewEncoder().Bytes(plain)
+			Expect(err).ToNot(HaveOccurred())
+			return encoded
+		}
+
+		var readInput = func(input []byte, encoding Encoding) ([]string, error) {
+			reader, err := NewReader(&Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Reader:   bytes.NewReader(input),
+				Bus:      bus,
+				DataRead: DataRead,
+				Encoding: encoding,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = reader.Start(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			Eventually(readLines).Should(HaveLen(len(plainLines)))
+			return readLines(), nil
+		}
+
+		DescribeTable(
+			"publishes same lines as plain UTF-8 input",
+			func(input []byte, encoding Encoding) {
+				lines, err := readInput(input, encoding)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(lines).To(Equal(plainLines))
+			},
+			Entry("plain UTF-8", plain, Encoding("")),
+			Entry("UTF-8 with BOM", append([]byte{0xEF, 0xBB, 0xBF}, plain...), Encoding("")),
+			Entry(
+				"CRLF line-endings",
+				[]byte(strings.Join(plainLines, "\r\n")+"\r\n"),
+				EncodingUTF8,
+			),
+			Entry("UTF-16LE with BOM", encodeUTF16(unicode.LittleEndian, unicode.UseBOM), Encoding("")),
+			Entry("UTF-16LE declared", encodeUTF16(unicode.LittleEndian, unicode.UseBOM), EncodingUTF16LE),
+			Entry("UTF-16BE without BOM", encodeUTF16(unicode.BigEndian, unicode.IgnoreBOM), EncodingUTF16BE),
+		)
+
+		DescribeTable(
+			"fails on mis-declared encoding",
+			func(input []byte, configured, detected Encoding) {
+				_, err := readInput(input, configured)
+				// Nothing is read from mis-declared input
+				var partialErr *PartialReadError
+				Expect(errors.As(err, &partialErr)).To(BeTrue())
+				Expect(partialErr.LinesPublished).To(BeZero())
+				Expect(readLines()).To(BeEmpty())
+
+				var mismatchErr *EncodingMismatchError
+				Expect(errors.As(err, &mismatchErr)).To(BeTrue())
+				Expect(mismatchErr).To(Equal(&EncodingMismatchError{
+					Detected:   detected,
+					Configured: configured,
+				}))
+				Expect(err.Error()).To(ContainSubstring(
+					"input appears to be encoded as " + string(detected),
+				))
+			},
+			Entry(
+				"UTF-16LE declared as UTF-8",
+				encodeUTF16(unicode.LittleEndian, unicode.UseBOM),
+				EncodingUTF8, EncodingUTF16LE,
+			),
+			Entry(
+				"UTF-16LE without BOM declared as UTF-8",
+				encodeUTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+				EncodingUTF8, EncodingUTF16LE,
+			),
+			Entry("UTF-8 declared as UTF-16BE", plain, EncodingUTF16BE, EncodingUTF8),
+		)
+
+		It("reads empty input with any encoding", func() {
+			reader, err := NewReader(&Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Reader:   bytes.NewReader(nil),
+				Bus:      bus,
+				DataRead: DataRead,
+				Encoding: EncodingUTF16LE,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.Start(context.Background())).To(Succeed())
+			Expect(readLines()).To(BeEmpty())
+		})
+
+		It("splits lines same in ForEachLine", func() {
+			lines := make([]string, 0)
+			err := ForEachLine(
+				bytes.NewReader(encodeUTF16(unicode.LittleEndian, unicode.UseBOM)),
+				func(_ int, line string) error {
+					lines = append(lines, line)
+					return nil
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lines).To(Equal(plainLines))
+		})
+	})
+
+	Describe("pre-sort", func() {
+		// Sorts lines by group, then time
+		sortKey := func(line string) (SortKey, error) {
+			data := &struct {
+				Group string    `json:"group"`
+				Time  time.Time `json:"time"`
+			}{}
+			err := json.Unmarshal([]byte(line), data)
+			if err != nil {
+				return SortKey{}, err
+			}
+			return SortKey{Group: data.Group, Time: data.Time}, nil
+		}
+
+		It("publishes lines sorted by group and time once input is read", func() {
+			sortInput := strings.Join([]string{
+				`{"group":"b","time":"2000-01-02T00:00:00Z"}`,
+				`{"group":"a","time":"2000-01-03T00:00:00Z"}`,
+				`no-key`,
+				`{"group":"b","time":"2000-01-01T00:00:00Z"}`,
+				`{"group":"a","time":"2000-01-01T00:00:00Z"}`,
+			}, "\n")
+			reader, err := NewReader(&Cfg{
+				Log:        logger.NewStdLogger("reader"),
+				Reader:     strings.NewReader(sortInput),
+				Bus:        bus,
+				DataRead:   DataRead,
+				PreSortKey: sortKey,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = reader.Start(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(readLines).Should(Equal([]string{
+				`{"group":"a","time":"2000-01-01T00:00:00Z"}`,
+				`{"group":"a","time":"2000-01-03T00:00:00Z"}`,
+				`{"group":"b","time":"2000-01-01T00:00:00Z"}`,
+				`{"group":"b","time":"2000-01-02T00:00:00Z"}`,
+				// Lines without key are published last
+				`no-key`,
+			}))
+		})
+
+		It("publishes sorted lines read before a read-error", func() {
+			lines := []string{
+				`{"group":"a","time":"2000-01-02T00:00:00Z"}`,
+				`{"group":"a","time":"2000-01-01T00:00:00Z"}`,
+				`{"group":"a","time":"2000-01-03T00:00:00Z"}`,
+			}
+			// Fail after first two lines
+			readBytes := len(lines[0]) + len(lines[1]) + 2
+			reader, err := NewReader(&Cfg{
+				Log: logger.NewStdLogger("reader"),
+				Reader: testsupport.NewMockErrReader(
+					strings.NewReader(strings.Join(lines, "\n")),
+					readBytes,
+					errors.New("connection reset"),
+				),
+				Bus:        bus,
+				DataRead:   DataRead,
+				PreSortKey: sortKey,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = reader.Start(context.Background())
+			var partialErr *PartialReadError
+			Expect(errors.As(err, &partialErr)).To(BeTrue())
+			Expect(partialErr.LinesPublished).To(Equal(2))
+			Eventually(readLines).Should(Equal([]string{lines[1], lines[0]}))
+		})
+	})
+
+	Describe("csv-format", func() {
+		It("publishes records as JSON-objects keyed by renamed header", func() {
+			csvInput := strings.Join([]string{
+				`ref,amount,note`,
+				`1,€10,"a, b"`,
+				`2,€20`,
+				``,
+				`3,€30,c`,
+			}, "\n")
+			reader, err := NewReader(&Cfg{
+				Log:        logger.NewStdLogger("reader"),
+				Reader:     strings.NewReader(csvInput),
+				Bus:        bus,
+				DataRead:   DataRead,
+				Format:     FormatCSV,
+				CSVColumns: map[string]string{"ref": "id"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = reader.Start(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(readLines).Should(Equal([]string{
+				`{"amount":"€10","id":"1","note":"a, b"}`,
+				// Records not matching header are published as is
+				`2,€20`,
+				`{"amount":"€30","id":"3","note":"c"}`,
+			}))
+		})
+
+		It("rejects invalid format-config", func() {
+			_, err := NewReader(&Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Reader:   strings.NewReader(""),
+				Bus:      bus,
+				DataRead: DataRead,
+				Format:   "xml",
+			})
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewReader(&Cfg{
+				Log:        logger.NewStdLogger("reader"),
+				Reader:     strings.NewReader(""),
+				Bus:        bus,
+				DataRead:   DataRead,
+				CSVColumns: map[string]string{"ref": "id"},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("ReadOpeningBalancesCSV", func() {
+	const timeFmt = "2006-01-02T15:04:05Z"
+
+	It("parses balances, skipping header", func() {
+		csv := "customer_id,balance,as_of\n" +
+			"1,$1500.25,2000-01-01T00:00:00Z\n" +
+			"2, 0,2000-01-02T10:00:00Z\n"
+
+		balances, err := ReadOpeningBalancesCSV(strings.NewReader(csv), timeFmt)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(balances).To(Equal([]account.OpeningBalance{
+			{
+				CustID:  "1",
+				Balance: 1500.25,
+				AsOf:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			{
+				CustID:  "2",
+				Balance: 0,
+				AsOf:    time.Date(2000, 1, 2, 10, 0, 0, 0, time.UTC),
+			},
+		}))
+	})
+
+	It("parses balances without header", func() {
+		balances, err := ReadOpeningBalancesCSV(
+			strings.NewReader("1,100,2000-01-01T00:00:00Z\n"),
+			timeFmt,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(balances).To(HaveLen(1))
+		Expect(balances[0].CustID).To(Equal("1"))
+	})
+
+	It("errors on invalid rows", func() {
+		for _, csv := range []string{
+			"1,abc,2000-01-01T00:00:00Z\n",
+			"1,100,01/01/2000\n",
+			",100,2000-01-01T00:00:00Z\n",
+			"1,100\n",
+		} {
+			_, err := ReadOpeningBalancesCSV(strings.NewReader(csv), timeFmt)
+			Expect(err).To(HaveOccurred(), csv)
+		}
+	})
+})
@@ -0,0 +1,88 @@
+package reader
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+)
+
+// Columns of opening-balances CSV, in order.
+var openingBalanceColumns = []string{"customer_id", "balance", "as_of"}
+
+// ReadOpeningBalancesCSV parses opening-balances from CSV with
+// columns: customer_id, balance, as_of. A header-row with these
+// column-names is skipped if present. Balances may be prefixed
+// with "$", and as-of times are parsed using provided time-format.
+// Use account.SeedOpeningBalances to seed the parsed balances.
+func ReadOpeningBalancesCSV(r io.Reader, timeFmt string) ([]account.OpeningBalance, error) {
+	if r == nil {
+		return nil, errors.New("reader is nil")
+	}
+	if timeFmt == "" {
+		return nil, errors.New("time-format cannot be empty")
+	}
+
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = len(openingBalanceColumns)
+	csvReader.TrimLeadingSpace = true
+
+	balances := make([]account.OpeningBalance, 0)
+	for row := 1; ; row++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return balances, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading row %d", row)
+		}
+		if row == 1 && isOpeningBalanceHeader(record) {
+			continue
+		}
+
+		balance, err := parseOpeningBalance(record, timeFmt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing row %d", row)
+		}
+		balances = append(balances, balance)
+	}
+}
+
+func isOpeningBalanceHeader(record []string) bool {
+	for i, column := range openingBalanceColumns {
+		if strings.ToLower(strings.TrimSpace(record[i])) != column {
+			return false
+		}
+	}
+	return true
+}
+
+func parseOpeningBalance(record []string, timeFmt string) (account.OpeningBalance, error) {
+	custID := strings.TrimSpace(record[0])
+	if custID == "" {
+		return account.OpeningBalance{}, errors.New("customer-id is blank")
+	}
+
+	balanceStr := strings.TrimPrefix(strings.TrimSpace(record[1]), "$")
+	balance, err := strconv.ParseFloat(balanceStr, 64)
+	if err != nil {
+		return account.OpeningBalance{}, fmt.Errorf("invalid balance: %s", record[1])
+	}
+
+	asOf, err := time.Parse(timeFmt, strings.TrimSpace(record[2]))
+	if err != nil {
+		return account.OpeningBalance{}, errors.Wrap(err, "error parsing as-of time")
+	}
+
+	return account.OpeningBalance{
+		CustID:  custID,
+		Balance: balance,
+		AsOf:    asOf.UTC(),
+	}, nil
+}
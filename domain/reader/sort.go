@@ -0,0 +1,70 @@
+package reader
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// SortKey orders lines when reading with pre-sort.
+// Lines are ordered by Group, then by Time.
+type SortKey struct {
+	Group string
+	Time  time.Time
+}
+
+// SortKeyFunc returns SortKey for a line read.
+type SortKeyFunc func(line string) (SortKey, error)
+
+// sortedLine is a line buffered for pre-sort.
+type sortedLine struct {
+	event model.Event
+	key   SortKey
+	// False if key couldn't be determined for line
+	hasKey bool
+}
+
+// bufferLine buffers line for publishing once input is read.
+func (r *Reader) bufferLine(event model.Event, line string) {
+	key, err := r.preSortKey(line)
+	if err != nil {
+		r.log.Warnf(
+			"[Event: %s]: Error getting sort-key, line will be published after sorted lines: %s",
+			event.ID(), err,
+		)
+	}
+	r.buffered = append(r.buffered, sortedLine{
+		event:  event,
+		key:    key,
+		hasKey: err == nil,
+	})
+}
+
+// publishBuffered sorts and publishes buffered lines. Lines
+// without a sort-key are published last, in read order.
+func (r *Reader) publishBuffered() error {
+	sort.SliceStable(r.buffered, func(i, j int) bool {
+		a, b := r.buffered[i], r.buffered[j]
+		if a.hasKey != b.hasKey {
+			return a.hasKey
+		}
+		if !a.hasKey {
+			return false
+		}
+		if a.key.Group != b.key.Group {
+			return a.key.Group < b.key.Group
+		}
+		return a.key.Time.Before(b.key.Time)
+	})
+
+	r.log.Debugf("Publishing %d sorted line(s)", len(r.buffered))
+	for _, line := range r.buffered {
+		err := r.publishLine(line.event)
+		if err != nil {
+			return err
+		}
+	}
+	r.buffered = nil
+	return nil
+}
@@ -0,0 +1,284 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// reconcileInput configures input generated by #generateReconcileInput.
+type reconcileInput struct {
+	seed     int64
+	numLines int
+	// Rates of lines which are malformed (not valid JSON),
+	// duplicates of an earlier line, and invalid transaction-
+	// requests (which fail to be created).
+	malformedRate float64
+	duplicateRate float64
+	invalidRate   float64
+}
+
+// txnKeyPattern matches transaction-key of
+// lines, including malformed ones.
+var txnKeyPattern = regexp.MustCompile(`"id":"([^"]+)","customer_id":"([^"]+)"`)
+
+// generateReconcileInput deterministically generates input-lines
+// for seed, along with transaction-key ("{id}_{customer-id}") of
+// every line. Duplicated lines have same key as their original.
+func generateReconcileInput(input reconcileInput) ([]string, []string) {
+	rnd := rand.New(rand.NewSource(input.seed))
+	baseTime := time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	lines := make([]string, 0, input.numLines)
+	keys := make([]string, 0, input.numLines)
+	validLines := make([]int, 0)
+	for i := 0; i < input.numLines; i++ {
+		roll := rnd.Float64()
+		if roll < input.duplicateRate && len(validLines) > 0 {
+			original := validLines[rnd.Intn(len(validLines))]
+			lines = append(lines, lines[original])
+			keys = append(keys, keys[original])
+			continue
+		}
+
+		req := txn.CreateTxnReq{
+			ID:         fmt.Sprintf("%d", i+1),
+			CustomerID: fmt.Sprintf("%d", rnd.Intn(10)+1),
+			LoadAmount: fmt.Sprintf("$%d.%02d", rnd.Intn(500), rnd.Intn(100)),
+			Time:       baseTime.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+		}
+		roll = rnd.Float64()
+		isMalformed := roll < input.malformedRate
+		isInvalid := !isMalformed && roll < input.malformedRate+input.invalidRate
+		if isInvalid {
+			req.LoadAmount = "$invalid"
+		}
+		reqBytes, err := json.Marshal(req)
+		Expect(err).ToNot(HaveOccurred())
+
+		line := string(reqBytes)
+		if isMalformed {
+			// Truncated, but still includes transaction-key
+			line = line[:len(line)/2+len(req.ID)+len(req.CustomerID)]
+		}
+		if !isMalformed && !isInvalid {
+			validLines = append(validLines, len(lines))
+		}
+		lines = append(lines, line)
+		keys = append(keys, fmt.Sprintf("%s_%s", req.ID, req.CustomerID))
+	}
+	return lines, keys
+}
+
+// diffKeys returns keys of expected missing from
+// actual, and keys of actual not in expected,
+// counting every occurrence of a key.
+func diffKeys(expected []string, actual []string) ([]string, []string) {
+	counts := make(map[string]int)
+	for _, key := range expected {
+		counts[key]++
+	}
+	for _, key := range actual {
+		counts[key]--
+	}
+
+	missing := make([]string, 0)
+	extra := make([]string, 0)
+	for key, count := range counts {
+		for ; count > 0; count-- {
+			missing = append(missing, key)
+		}
+		for ; count < 0; count++ {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// This test checks the key invariant of pipeline: every
+// non-blank input line is accounted for exactly once, either
+// as a result in report (accepted or declined), as a failed
+// transaction-request, or as a dead-lettered malformed line.
+// Lines left unprocessed by an interrupted run are accounted
+// for by the run resuming it.
+var _ = Describe("Report reconciliation", func() {
+	// Budget of a single run, specs are budgeted by runs
+	const runTimeout = 15 * time.Second
+
+	var buses []eventutil.Bus
+
+	BeforeEach(func() {
+		buses = make([]eventutil.Bus, 0)
+	})
+
+	AfterEach(func() {
+		for _, bus := range buses {
+			bus.Terminate()
+		}
+	})
+
+	newBus := func() *eventutil.MemoryBus {
+		bus := newRecoveryBus()
+		buses = append(buses, bus)
+		return bus
+	}
+
+	// run runs pipeline with lines as input, and returns
+	// transaction-keys of every line accounted for by run.
+	// Process-manager's idle-timeout only expires once every
+	// line reached txn-creator (or was dead-lettered), and
+	// numAwaited lines are accounted for.
+	run := func(
+		bus eventutil.Bus,
+		lines []string,
+		numAwaited int,
+		recoveryCfg *RecoveryCfg,
+		disabledStages []Stage,
+	) []string {
+		ioWriter := domain_test.NewMockWriter()
+		deadLetterLog := eventutil.NewMemoryDeadLetterLog()
+
+		routinesCfg := routinesRunCfg(bus, strings.NewReader(strings.Join(lines, "\n")), ioWriter)
+		routinesCfg.ReaderCfg.DeadLetterLog = deadLetterLog
+		routinesCfg.ReaderCfg.MaxSkippedLines = len(lines)
+		routinesCfg.ProcessMgrCfg.PayloadEnvelope = true
+		routinesCfg.Recovery = recoveryCfg
+		routinesCfg.DisabledStages = disabledStages
+
+		creatorRepo := routinesCfg.TxnCreatorCfg.CreatorCfg.EventRepo
+		resultRepo := routinesCfg.AccountViewCfg.ResultViewCfg.ResultRepo
+		isSettled := func() bool {
+			creatorEvents, err := creatorRepo.FetchByIndex(0)
+			Expect(err).ToNot(HaveOccurred())
+			numFailed := 0
+			for _, event := range creatorEvents {
+				if event.Action() == model.TxnCreateFailed {
+					numFailed++
+				}
+			}
+			deadLetters, err := deadLetterLog.Entries()
+			Expect(err).ToNot(HaveOccurred())
+
+			numReached := len(creatorEvents) + len(deadLetters)
+			numAccounted := resultRepo.Index() + numFailed + len(deadLetters)
+			return numReached >= len(lines) && numAccounted >= numAwaited
+		}
+
+		_, err := runRoutinesSettled(routinesCfg, clock.NewFakeClock(time.Now()), isSettled, runTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		keys := make([]string, 0)
+		// Results in report
+		for _, line := range strings.Split(string(ioWriter.Content()), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			result := accountview.TxnResultEntry{}
+			err := json.Unmarshal([]byte(line), &result)
+			Expect(err).ToNot(HaveOccurred())
+			keys = append(keys, fmt.Sprintf("%s_%s", result.ID, result.CustomerID))
+		}
+		// Failed transaction-requests
+		creatorEvents, err := creatorRepo.FetchByIndex(0)
+		Expect(err).ToNot(HaveOccurred())
+		for _, event := range creatorEvents {
+			if event.Action() != model.TxnCreateFailed {
+				continue
+			}
+			failure := txn.CreateTxnFailure{}
+			err := json.Unmarshal(event.RawData(), &failure)
+			Expect(err).ToNot(HaveOccurred())
+			keys = append(keys, fmt.Sprintf("%s_%s", failure.TxnReq.ID, failure.TxnReq.CustomerID))
+		}
+		// Dead-lettered malformed lines
+		deadLetters, err := deadLetterLog.Entries()
+		Expect(err).ToNot(HaveOccurred())
+		for _, deadLetter := range deadLetters {
+			event, ok := deadLetter.Msg.(model.Event)
+			Expect(ok).To(BeTrue())
+			match := txnKeyPattern.FindStringSubmatch(string(event.Data()))
+			Expect(match).ToNot(BeNil(), "dead-letter without transaction-key: %s", event.Data())
+			keys = append(keys, fmt.Sprintf("%s_%s", match[1], match[2]))
+		}
+		return keys
+	}
+
+	expectReconciled := func(expected []string, actual []string) {
+		missing, extra := diffKeys(expected, actual)
+		Expect(missing).To(BeEmpty(), "lines missing from outputs (extra: %v)", extra)
+		Expect(extra).To(BeEmpty(), "lines in outputs but not in input")
+		Expect(actual).To(HaveLen(len(expected)))
+	}
+
+	table.DescribeTable(
+		"accounts for every input line exactly once",
+		func(input reconcileInput) {
+			lines, expected := generateReconcileInput(input)
+			actual := run(newBus(), lines, len(lines), nil, nil)
+			expectReconciled(expected, actual)
+		},
+		table.Entry("clean input", reconcileInput{seed: 1, numLines: 100}),
+		table.Entry("malformed lines", reconcileInput{
+			seed: 2, numLines: 100, malformedRate: 0.1,
+		}),
+		table.Entry("duplicate lines", reconcileInput{
+			seed: 3, numLines: 100, duplicateRate: 0.2,
+		}),
+		table.Entry("invalid requests", reconcileInput{
+			seed: 4, numLines: 100, invalidRate: 0.1,
+		}),
+		table.Entry("all perturbations", reconcileInput{
+			seed: 5, numLines: 200, malformedRate: 0.05, duplicateRate: 0.1, invalidRate: 0.05,
+		}),
+	)
+
+	It("accounts for every input line across interrupted and resumed run", func(done Done) {
+		lines, expected := generateReconcileInput(reconcileInput{
+			seed: 6, numLines: 100, malformedRate: 0.05, duplicateRate: 0.1, invalidRate: 0.05,
+		})
+
+		// ================ Interrupted run ================
+		// Account is disabled, so transactions are left
+		// unprocessed on stalled subscription, and none
+		// are awaited beyond reaching txn-creator.
+		bus := newBus()
+		_, err := bus.Subscribe(model.ProcessTxn.String())
+		Expect(err).ToNot(HaveOccurred())
+		recoveryFile := &bytes.Buffer{}
+		actual := run(bus, lines, 0, &RecoveryCfg{
+			Bus:    bus,
+			Output: recoveryFile,
+		}, []Stage{StageAccount})
+
+		// ================ Resumed run ================
+		// Awaits lines left unprocessed by interrupted run
+		freshBus := newBus()
+		resumed := run(freshBus, []string{}, len(expected)-len(actual), &RecoveryCfg{
+			Bus:   freshBus,
+			Input: recoveryFile,
+		}, nil)
+		Expect(resumed).ToNot(BeEmpty())
+		actual = append(actual, resumed...)
+		expectReconciled(expected, actual)
+
+		close(done)
+	}, 2*runTimeout.Seconds())
+})
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+)
+
+// RecoveryCfg is config for recovering messages left
+// unprocessed on Bus by a run, such as when it was aborted.
+type RecoveryCfg struct {
+	Bus eventutil.Bus `validate:"nonnil"`
+	// Optional, messages written by Output of a previous run.
+	// These are republished once routines start, before any
+	// input is read.
+	Input io.Reader
+	// Optional, messages drained from Bus once routines return
+	// are written here. Bus must support draining, such as a
+	// eventutil.MemoryBus created with RetainDrained.
+	Output io.Writer
+}
+
+// drainer is a Bus which can write messages drained from its
+// subscriptions on termination, see eventutil.MemoryBus#DrainTo.
+type drainer interface {
+	DrainTo(w io.Writer) (map[string]int, error)
+}
+
+// Validate validates config, and checks that Bus
+// supports draining if recovery-output is set.
+func (cfg *RecoveryCfg) Validate() error {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Output != nil {
+		if _, ok := cfg.Bus.(drainer); !ok {
+			return errors.New("recovery-output requires bus which supports draining")
+		}
+	}
+	return nil
+}
+
+// Recover republishes messages written by eventutil.MemoryBus#DrainTo
+// to bus, in order these were written. Run this at start of a resumed
+// run, once routines are subscribed, so the messages are processed.
+func Recover(r io.Reader, bus eventutil.Bus) error {
+	if bus == nil {
+		return errors.New("bus is nil")
+	}
+
+	msgs, err := eventutil.ReadDrained(r)
+	if err != nil {
+		return errors.Wrap(err, "error reading recovered messages")
+	}
+	for i, msg := range msgs {
+		err := bus.Publish(msg)
+		if err != nil {
+			return errors.Wrapf(err, "error publishing recovered message %d", i+1)
+		}
+	}
+	return nil
+}
+
+// drainRecovery writes messages left unprocessed on Bus to
+// recovery-output, if configured. This terminates Bus.
+func drainRecovery(cfg *RecoveryCfg) error {
+	if cfg == nil || cfg.Output == nil {
+		return nil
+	}
+	_, err := cfg.Bus.(drainer).DrainTo(cfg.Output)
+	return errors.Wrap(err, "error draining bus to recovery-output")
+}
@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Recovery", func() {
+	// Budget of a single run, specs are budgeted by runs
+	const runTimeout = 15 * time.Second
+
+	var buses []eventutil.Bus
+
+	BeforeEach(func() {
+		buses = make([]eventutil.Bus, 0)
+	})
+
+	AfterEach(func() {
+		for _, bus := range buses {
+			bus.Terminate()
+		}
+	})
+
+	newBus := func() *eventutil.MemoryBus {
+		bus := newRecoveryBus()
+		buses = append(buses, bus)
+		return bus
+	}
+
+	// run runs routines on reqs, and returns results in report.
+	// Process-manager's idle-timeout only expires once view has
+	// numResults results.
+	run := func(
+		bus eventutil.Bus,
+		reqs []txn.CreateTxnReq,
+		numResults int,
+		recoveryCfg *RecoveryCfg,
+	) []accountview.TxnResultEntry {
+		ioReader, err := domain_test.NewMockReader(reqs)
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter := domain_test.NewMockWriter()
+
+		routinesCfg := routinesRunCfg(bus, ioReader, ioWriter)
+		routinesCfg.Recovery = recoveryCfg
+
+		resultRepo := routinesCfg.AccountViewCfg.ResultViewCfg.ResultRepo
+		isSettled := func() bool {
+			return resultRepo.Index() >= numResults
+		}
+
+		_, err = runRoutinesSettled(routinesCfg, clock.NewFakeClock(time.Now()), isSettled, runTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		results := make([]accountview.TxnResultEntry, 0)
+		for _, line := range strings.Split(strings.TrimSpace(string(ioWriter.Content())), "\n") {
+			if line == "" {
+				continue
+			}
+			result := accountview.TxnResultEntry{}
+			err := json.Unmarshal([]byte(line), &result)
+			Expect(err).ToNot(HaveOccurred())
+			results = append(results, result)
+		}
+		return results
+	}
+
+	It("writes unprocessed messages on shutdown, and recovers these in next run", func(done Done) {
+		reqs := []txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$20", Time: "2000-01-05T02:00:00Z"},
+			{ID: "3", CustomerID: "1", LoadAmount: "$30", Time: "2000-01-05T03:00:00Z"},
+		}
+
+		// ================ Interrupted run ================
+		bus := newBus()
+		// Stalled subscription, whose messages stay
+		// unprocessed until shutdown. Process-manager
+		// still receives these, so results are awaited.
+		_, err := bus.Subscribe(model.TxnRead.String())
+		Expect(err).ToNot(HaveOccurred())
+
+		recoveryFile := &bytes.Buffer{}
+		run(bus, reqs, len(reqs), &RecoveryCfg{
+			Bus:    bus,
+			Output: recoveryFile,
+		})
+
+		lines := strings.Split(strings.TrimSpace(recoveryFile.String()), "\n")
+		Expect(lines).To(HaveLen(len(reqs)))
+		for i, line := range lines {
+			drainedMsg := eventutil.DrainedMsg{}
+			err := json.Unmarshal([]byte(line), &drainedMsg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drainedMsg.Type).To(Equal(eventutil.DrainedEvent))
+			Expect(drainedMsg.Action).To(Equal(model.TxnRead.String()))
+			Expect(drainedMsg.ID).ToNot(BeEmpty())
+
+			event := model.Event{}
+			err = json.Unmarshal(drainedMsg.Msg, &event)
+			Expect(err).ToNot(HaveOccurred())
+			req := txn.CreateTxnReq{}
+			err = json.Unmarshal(event.Data(), &req)
+			Expect(err).ToNot(HaveOccurred())
+			// Written in order published
+			Expect(req.ID).To(Equal(reqs[i].ID))
+		}
+
+		// ================ Resumed run ================
+		freshBus := newBus()
+		results := run(freshBus, []txn.CreateTxnReq{}, len(reqs), &RecoveryCfg{
+			Bus:   freshBus,
+			Input: recoveryFile,
+		})
+		Expect(results).To(ConsistOf(
+			accountview.TxnResultEntry{ID: "1", CustomerID: "1", Accepted: true},
+			accountview.TxnResultEntry{ID: "2", CustomerID: "2", Accepted: true},
+			accountview.TxnResultEntry{ID: "3", CustomerID: "1", Accepted: true},
+		))
+
+		close(done)
+	}, 2*runTimeout.Seconds())
+
+	It("rejects recovery-output for bus which doesn't support draining", func() {
+		bus := newBus()
+		// Wrapped bus only provides Bus-interface
+		cfg := &RecoveryCfg{
+			Bus:    &failingBus{Bus: bus},
+			Output: &bytes.Buffer{},
+		}
+		Expect(cfg.Validate()).To(MatchError(ContainSubstring("requires bus which supports draining")))
+
+		cfg.Bus = bus
+		Expect(cfg.Validate()).To(Succeed())
+	})
+})
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// StreamCorrelationKey is correlation-key of commands streaming
+// results to writer (see NewResultStreamer), so writer's events
+// confirming these can be told apart from report's.
+const StreamCorrelationKey = "txn-result-stream"
+
+// NewResultStreamer returns handler for results of transaction-result
+// view (see accountview.EventListenerCfg#OnResults), which sends these
+// to writer on writeData action as soon as these're inserted, as a
+// single command with StreamCorrelationKey. Process-manager should
+// then be configured with StreamedResults.
+func NewResultStreamer(
+	bus eventutil.Bus,
+	writeData model.CmdAction,
+) func(results []accountview.TxnResultEntry) error {
+	return func(results []accountview.TxnResultEntry) error {
+		lines := make([]string, 0, len(results))
+		for _, entry := range results {
+			entryBytes, err := json.Marshal(entry)
+			if err != nil {
+				return errors.Wrap(err, "error marshalling result")
+			}
+			lines = append(lines, string(entryBytes))
+		}
+
+		payload, err := writer.NewPayloadBuilder([]byte(strings.Join(lines, "\n"))).Build()
+		if err != nil {
+			return errors.Wrap(err, "error building payload of streamed results")
+		}
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action:         writeData,
+			CorrelationKey: StreamCorrelationKey,
+			Data:           payload,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "error creating '%s' command", writeData)
+		}
+		err = bus.Publish(cmd)
+		return errors.Wrapf(err, "error publishing '%s' command on bus", writeData)
+	}
+}
@@ -0,0 +1,60 @@
+package domain
+
+import "sync"
+
+// routineTracker tracks routines (such as ones publishing
+// commands) for a single owner. Unlike sync.WaitGroup,
+// routines can be added while owner waits for tracked
+// routines, such as when owner keeps handling events
+// while draining.
+// Use #newRoutineTracker to create new instance.
+type routineTracker struct {
+	lock        *sync.Mutex
+	numRoutines int
+	// Closed once no routines are running
+	idleSigs []chan struct{}
+}
+
+func newRoutineTracker() *routineTracker {
+	return &routineTracker{
+		lock: &sync.Mutex{},
+	}
+}
+
+// add tracks a routine, which must call #done once it returns.
+func (t *routineTracker) add() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.numRoutines++
+}
+
+// done marks a tracked routine as returned.
+func (t *routineTracker) done() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.numRoutines--
+	if t.numRoutines > 0 {
+		return
+	}
+	for _, idleSig := range t.idleSigs {
+		close(idleSig)
+	}
+	t.idleSigs = nil
+}
+
+// idle returns channel which is closed once
+// no tracked routines are running.
+func (t *routineTracker) idle() <-chan struct{} {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	idleSig := make(chan struct{})
+	if t.numRoutines == 0 {
+		close(idleSig)
+		return idleSig
+	}
+	t.idleSigs = append(t.idleSigs, idleSig)
+	return idleSig
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+)
+
+// RoutineError is an error returned by a routine.
+type RoutineError struct {
+	Component string
+	Err       error
+	// Time routine returned error.
+	At time.Time
+}
+
+func (e RoutineError) Error() string {
+	return fmt.Sprintf("[%s]: %s", e.Component, e.Err)
+}
+
+// Unwrap returns error returned by routine.
+func (e RoutineError) Unwrap() error {
+	return e.Err
+}
+
+// RunError is returned by #RunRoutines
+// when routines return with errors.
+type RunError struct {
+	// Routine which returned fatal error,
+	// only set if run was aborted by it.
+	FatalRoutine string
+	// Fatal error which aborted the run.
+	// This is the primary cause of failure.
+	Fatal error
+	// Errors returned by other routines,
+	// in order the routines were stopped.
+	Errors []RoutineError
+
+	// First error returned by any routine, which
+	// usually caused other routines to fail.
+	RootCause *RoutineError
+	// Errors from Errors which are likely caused by run
+	// being torn down after root-cause (see #IsSecondaryErr),
+	// in order the routines were stopped.
+	Secondary []RoutineError
+
+	// Set if input was also read partially. Such read isn't
+	// a routine-error, and is matched by errors#As instead.
+	PartialRead *reader.PartialReadError
+}
+
+func (e *RunError) Error() string {
+	b := &strings.Builder{}
+	if e.Fatal != nil {
+		fmt.Fprintf(b, "Run aborted on fatal error: [%s]: %s", e.FatalRoutine, e.Fatal)
+		if len(e.Errors) > 0 {
+			b.WriteString("\nOther routines returned with errors:")
+		}
+	} else {
+		b.WriteString("Some routines returned with errors:")
+	}
+	for _, routineErr := range e.Errors {
+		b.WriteString("\n")
+		b.WriteString(routineErr.Error())
+	}
+	if e.PartialRead != nil {
+		fmt.Fprintf(b, "\nInput was read partially: %s", e.PartialRead)
+	}
+	return b.String()
+}
+
+// Unwrap returns fatal error, if any.
+func (e *RunError) Unwrap() error {
+	return e.Fatal
+}
+
+// Is returns true if target matches fatal error,
+// error from any routine, or partial-read error.
+func (e *RunError) Is(target error) bool {
+	if e.Fatal != nil && errors.Is(e.Fatal, target) {
+		return true
+	}
+	for _, routineErr := range e.Errors {
+		if errors.Is(routineErr.Err, target) {
+			return true
+		}
+	}
+	return e.PartialRead != nil && errors.Is(e.PartialRead, target)
+}
+
+// As finds first error matching target in
+// partial-read error, if input was read partially.
+func (e *RunError) As(target interface{}) bool {
+	return e.PartialRead != nil && errors.As(e.PartialRead, target)
+}
+
+// IsSecondaryErr returns true if error is caused by
+// run being torn down, such as a canceled context or
+// terminating Bus, rather than routine failing itself.
+func IsSecondaryErr(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, eventutil.ErrBusTerminating)
+}
+
+// EmptyRunReason describes why run was flagged as empty.
+type EmptyRunReason string
+
+// Reasons for EmptyRunError.
+const (
+	// No lines were read from input.
+	EmptyInput EmptyRunReason = "empty input"
+	// Lines were read, but none were valid transactions.
+	ZeroValidTxns EmptyRunReason = "zero valid transactions"
+)
+
+// EmptyRunError is returned by #RunRoutines when run is
+// empty and the corresponding check is enabled in config
+// (see ProcessMgrCfg#FailOnEmptyInput and #FailOnZeroValidTxns).
+// Report is still written when this is returned.
+type EmptyRunError struct {
+	Reason    EmptyRunReason
+	LinesRead int
+	ValidTxns int
+}
+
+func (e *EmptyRunError) Error() string {
+	return fmt.Sprintf(
+		"run is empty: %s (lines read: %d, valid transactions: %d)",
+		e.Reason, e.LinesRead, e.ValidTxns,
+	)
+}
+
+// DeprecatedUseError is returned by #RunRoutines when deprecated
+// features listed in RoutinesCfg#FailOnDeprecated are used during
+// run. Report is still written when this is returned.
+type DeprecatedUseError struct {
+	// Uses of listed features, keyed by feature
+	Uses deprecation.Counts
+}
+
+func (e *DeprecatedUseError) Error() string {
+	uses := make([]string, 0, len(e.Uses))
+	for _, feature := range e.Uses.Features() {
+		uses = append(uses, fmt.Sprintf("%s (%d)", feature, e.Uses[feature]))
+	}
+	return fmt.Sprintf("deprecated features used: %s", strings.Join(uses, ", "))
+}
+
+// newDeprecatedUseError returns DeprecatedUseError if any of
+// failOn features were used, otherwise returns nil.
+func newDeprecatedUseError(failOn []string, uses deprecation.Counts) *DeprecatedUseError {
+	failedUses := make(deprecation.Counts)
+	for _, feature := range failOn {
+		if count := uses[feature]; count > 0 {
+			failedUses[feature] = count
+		}
+	}
+	if len(failedUses) == 0 {
+		return nil
+	}
+	return &DeprecatedUseError{Uses: failedUses}
+}
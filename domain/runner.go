@@ -4,43 +4,244 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/validator.v2"
 
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
 	"github.com/Jaskaranbir/es-bank-account/domain/account"
 	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/anomaly"
+	"github.com/Jaskaranbir/es-bank-account/domain/progress"
 	"github.com/Jaskaranbir/es-bank-account/domain/reader"
 	"github.com/Jaskaranbir/es-bank-account/domain/txn"
 	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
 )
 
-type routinesRunner struct{}
+type routinesRunner struct {
+	failFast bool
+
+	lock *sync.Mutex
+	// Routine which first returned a fatal error
+	fatalRoutine string
+	// First routine to return an error
+	rootCause *RoutineError
+	// Time each routine returned an error
+	failedAt map[string]time.Time
+	// Cancels process-manager, so it doesn't wait for
+	// its idle-timeout when run is aborted.
+	processMgrCancel context.CancelFunc
+	// Set once process-manager is created,
+	// to collect its counts for run-summary.
+	processMgr *processMgr
+	// Set once reader is created, before
+	// progress-reporter is run.
+	reader *reader.Reader
+}
+
+// Stage is a pipeline-stage run by RunRoutines.
+// Named same as component in RoutineError.
+type Stage string
+
+// Pipeline-stages which can be disabled.
+// Process-manager controls run's lifecycle,
+// and so is always run.
+const (
+	StageReader      Stage = "reader"
+	StageTxnCreator  Stage = "txnCreator"
+	StageAccount     Stage = "account"
+	StageAccountView Stage = "txnResultView"
+	StageWriter      Stage = "writer"
+)
 
 // RoutinesCfg is config for all routines.
+// Configs of enabled stages are required, and are
+// validated by #RunRoutines before starting routines.
 type RoutinesCfg struct {
 	Log logger.Logger
 
-	ReaderCfg     *reader.Cfg         `validate:"nonnil"`
-	TxnCreatorCfg *txn.CmdListenerCfg `validate:"nonnil"`
+	ReaderCfg     *reader.Cfg
+	TxnCreatorCfg *txn.CmdListenerCfg
+
+	AccountCfg     *account.CmdListenerCfg
+	AccountViewCfg *accountview.EventListenerCfg
+
+	ProcessMgrCfg *ProcessMgrCfg `validate:"nonnil"`
+	WriterCfg     *writer.CmdListenerCfg
+	// Optional, writer-instances of output-shards (see
+	// ProcessMgrCfg#ShardWriteData), run as part of writer-stage.
+	ShardWriterCfgs []*writer.CmdListenerCfg
+	// Optional, monitors rejection-rate of results, and
+	// publishes anomalies. Not run if not set.
+	AnomalyCfg *anomaly.EventListenerCfg
+
+	// If set, the first routine to return a fatal error
+	// (see model.FatalError) aborts the run immediately,
+	// instead of process-manager waiting for its idle-timeout.
+	// The fatal error is reported as primary cause in RunError.
+	FailFast bool
+	// Optional, defaults to WiringCheckWarn.
+	// See CheckWiring for the checks performed.
+	WiringCheck WiringCheck
+	// Optional, stages which aren't run, such as to test
+	// other stages in isolation, or for partial deployments.
+	// Configs of disabled stages are ignored, and messages
+	// only handled by these are dropped by Bus.
+	DisabledStages []Stage
+	// Optional, recovers messages left unprocessed on Bus by
+	// a previous run, and writes those left by this run.
+	Recovery *RecoveryCfg
+	// Optional, periodically reports progress of run, and
+	// its final progress once process-manager returns.
+	// Progress is of reader and ProcessMgrCfg#TxnResultViewRepo,
+	// unless a source is set. Not run if not set.
+	Progress *progress.Cfg
+	// Optional, dumps diagnostics of run (see CollectDiagnostics)
+	// on every DumpDiagnostics command. Not run if not set.
+	DiagnosticsCfg *DiagnosticsCfg
+	// Optional, run fails with DeprecatedUseError if any of
+	// these deprecated features (see package deprecation) is
+	// used during run, such as for CI canaries. Report is
+	// still written.
+	FailOnDeprecated []string
+	// Optional, should be shared with configs of components
+	// collecting warnings. Warnings collected by the end of
+	// run are included in RunSummary, such as messages of
+	// unexpected type skipped by typed subscriptions, if Bus
+	// collects these (see eventutil.MemoryBusCfg#Warnings).
+	Warnings *warnings.MemoryCollector
+}
+
+// isEnabled returns true if stage isn't disabled in config.
+func (cfg *RoutinesCfg) isEnabled(stage Stage) bool {
+	for _, disabled := range cfg.DisabledStages {
+		if disabled == stage {
+			return false
+		}
+	}
+	return true
+}
 
-	AccountCfg     *account.CmdListenerCfg       `validate:"nonnil"`
-	AccountViewCfg *accountview.EventListenerCfg `validate:"nonnil"`
+// validateStages validates disabled stages, and
+// checks that configs of enabled stages are set.
+func (cfg *RoutinesCfg) validateStages() error {
+	hasCfg := map[Stage]bool{
+		StageReader:      cfg.ReaderCfg != nil,
+		StageTxnCreator:  cfg.TxnCreatorCfg != nil,
+		StageAccount:     cfg.AccountCfg != nil,
+		StageAccountView: cfg.AccountViewCfg != nil,
+		StageWriter:      cfg.WriterCfg != nil,
+	}
+	for _, stage := range cfg.DisabledStages {
+		if _, exists := hasCfg[stage]; !exists {
+			return fmt.Errorf("invalid stage: %s", stage)
+		}
+	}
+	for stage, isSet := range hasCfg {
+		if !isSet && cfg.isEnabled(stage) {
+			return fmt.Errorf("config is nil for enabled stage: %s", stage)
+		}
+	}
+	for i, shardWriterCfg := range cfg.ShardWriterCfgs {
+		if shardWriterCfg == nil {
+			return fmt.Errorf("shard-writer config at index %d is nil", i)
+		}
+	}
+	return nil
+}
 
-	ProcessMgrCfg *ProcessMgrCfg         `validate:"nonnil"`
-	WriterCfg     *writer.CmdListenerCfg `validate:"nonnil"`
+// RunSummary describes outcome of a run.
+type RunSummary struct {
+	// Set if reader failed before reaching end of input,
+	// so report covers the input only partially.
+	Partial bool
+	// Number of lines read from input. If run
+	// is partial, this is lines read before failure.
+	LinesRead int
+	// Number of lines which were valid transactions.
+	ValidTxns int
+	// Number of transactions skipped by txn-creator
+	// (see txn.ZeroAmountSkip), which aren't counted
+	// in ValidTxns.
+	SkippedTxns int
+	// Set if run was flagged as empty, see EmptyRunError.
+	Empty bool
+	// Number of events skipped by transaction-result view,
+	// whose results are missing from report.
+	QuarantinedEvents int
+	// Customers whose results weren't written to per-customer
+	// output, since their IDs are unsafe as file-names.
+	UnsafeCustomerIDs []string
+	// Number of lines of customers whose group already ended,
+	// if input is customer-grouped (see ProcessMgrCfg#CustomerGrouped).
+	Stragglers int
+	// Number of rejection-rate anomalies reported.
+	RejectionAnomalies int
+	// Number of events and aggregates in account's event-store
+	// after run. Zero if account's event-repo doesn't provide
+	// stats (see eventutil.StoreStatsProvider).
+	StoredEvents     int
+	StoredAggregates int
+	// Uses of deprecated features during run, keyed by
+	// feature. Nil if no deprecated feature was used.
+	Deprecations deprecation.Counts
+	// Warnings collected during run (see RoutinesCfg#Warnings),
+	// with first few details of every code. Nil if none were.
+	Warnings warnings.Summary
 }
 
 // RunRoutines runs domain-routines with provided config.
-func RunRoutines(cfg *RoutinesCfg) error {
+// Summary is returned even if routines returned errors.
+// Returns *ConfigError if a nested config is invalid.
+func RunRoutines(cfg *RoutinesCfg) (*RunSummary, error) {
 	err := validator.Validate(cfg)
 	if err != nil {
-		return errors.Wrap(err, "error validating config")
+		return nil, errors.Wrap(err, "error validating config")
+	}
+	err = cfg.validateStages()
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating stages")
+	}
+	// Tags of nested configs are validated above, but not
+	// invariants between their fields, which would otherwise
+	// only fail once their routines start.
+	err = cfg.validateNested()
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating nested configs")
+	}
+	// Pre-sorted order would otherwise be lost
+	// when process-manager publishes commands.
+	if cfg.isEnabled(StageReader) &&
+		cfg.ReaderCfg.PreSortKey != nil &&
+		!cfg.ProcessMgrCfg.OrderedDispatch {
+		return nil, errors.New("pre-sorted input requires ordered-dispatch in process-manager")
+	}
+	err = checkWiring(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error checking wiring")
 	}
 
-	runner := routinesRunner{}
+	deprecationsAtStart := deprecation.Snapshot()
+	runner := &routinesRunner{
+		failFast: cfg.FailFast,
+		lock:     &sync.Mutex{},
+		failedAt: make(map[string]time.Time),
+	}
+	// Progress-reporter is created before any routine starts,
+	// so its invalid config doesn't leave routines running.
+	var progressReporter *progress.Reporter
+	if cfg.Progress != nil {
+		progressReporter, err = runner.newProgressReporter(cfg.Progress, cfg.ProcessMgrCfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating progress-reporter")
+		}
+	}
 
 	// Context to monitor all routines collectively
 	mainCtx, mainCancel := context.WithCancel(context.Background())
@@ -52,42 +253,149 @@ func RunRoutines(cfg *RoutinesCfg) error {
 	// routine to not process messages and cause
 	// error in process-manager, allowing it to exit.
 	// And so we dont use context-cancel here (yet).
-	processMgrRun, _ := runner.runProcessMgr(cfg.Log, mainCancel, cfg.ProcessMgrCfg)
+	// The exception is a fatal error with fail-fast enabled.
+	processMgrRun, processMgrCancel := runner.runProcessMgr(cfg.Log, mainCancel, cfg.ProcessMgrCfg)
+	runner.setProcessMgrCancel(processMgrCancel)
+	// Disabled stages are replaced by routines which
+	// return immediately without errors on teardown.
 	// TxnCreator
-	txnCreatorRun, txnCreatorCancel := runner.runTxnCreator(cfg.Log, mainCancel, cfg.TxnCreatorCfg)
+	txnCreatorRun, txnCreatorCancel := disabledRoutine()
+	if cfg.isEnabled(StageTxnCreator) {
+		txnCreatorRun, txnCreatorCancel = runner.runTxnCreator(cfg.Log, mainCancel, cfg.TxnCreatorCfg)
+	}
 	// Account
-	accountRun, accountCancel := runner.runAccount(cfg.Log, mainCancel, cfg.AccountCfg)
+	accountRun, accountCancel := disabledRoutine()
+	if cfg.isEnabled(StageAccount) {
+		accountRun, accountCancel = runner.runAccount(cfg.Log, mainCancel, cfg.AccountCfg)
+	}
 	// TxnResultView
-	accountViewRun, accountViewCancel := runner.runAccountView(cfg.Log, mainCancel, cfg.AccountViewCfg)
+	accountViewRun, accountViewCancel := disabledRoutine()
+	if cfg.isEnabled(StageAccountView) {
+		accountViewRun, accountViewCancel = runner.runAccountView(cfg.Log, mainCancel, cfg.AccountViewCfg)
+	}
+	// Rejection-rate monitor
+	anomalyRun, anomalyCancel := disabledRoutine()
+	if cfg.AnomalyCfg != nil {
+		anomalyRun, anomalyCancel = runner.runAnomalyListener(cfg.Log, mainCancel, cfg.AnomalyCfg)
+	}
 	// Writer
-	writerRun, writerCancel := runner.runWriter(cfg.Log, mainCancel, cfg.WriterCfg)
-	// Reader
-	readerRun, readerCancel, err := runner.runReader(cfg.Log, mainCancel, cfg.ReaderCfg)
-	if err != nil {
+	writerRun, writerCancel := disabledRoutine()
+	if cfg.isEnabled(StageWriter) {
+		writerRun, writerCancel = runner.runWriter(cfg.Log, mainCancel, "writer", cfg.WriterCfg)
+	}
+	// Writers of output-shards
+	shardWriterRuns := make([]*errgroup.Group, 0, len(cfg.ShardWriterCfgs))
+	shardWriterCancels := make([]context.CancelFunc, 0, len(cfg.ShardWriterCfgs))
+	if cfg.isEnabled(StageWriter) {
+		for i, shardWriterCfg := range cfg.ShardWriterCfgs {
+			component := fmt.Sprintf("shardWriter-%d", i)
+			run, cancel := runner.runWriter(cfg.Log, mainCancel, component, shardWriterCfg)
+			shardWriterRuns = append(shardWriterRuns, run)
+			shardWriterCancels = append(shardWriterCancels, cancel)
+		}
+	}
+	// Diagnostics
+	diagnosticsRun, diagnosticsCancel := disabledRoutine()
+	if cfg.DiagnosticsCfg != nil {
+		diagnosticsRun, diagnosticsCancel = runner.runDiagnostics(cfg.Log, mainCancel, cfg)
+	}
+	// Set if run can't proceed once routines are started, such
+	// as when recovering messages fails. Started routines are
+	// then torn down same as an aborted run, and messages they
+	// leave on Bus are drained to recovery-output.
+	var setupErr error
+	abortSetup := func(err error) {
+		cfg.Log.Errorf("Aborting run: %s", err)
+		setupErr = err
+		processMgrCancel()
 		mainCancel()
-		return errors.Wrap(err, "error running reader")
+	}
+	// Recovered messages are republished once their
+	// handlers are subscribed, and before input is read.
+	if cfg.Recovery != nil && cfg.Recovery.Input != nil {
+		err = Recover(cfg.Recovery.Input, cfg.Recovery.Bus)
+		if err != nil {
+			abortSetup(errors.Wrap(err, "error recovering messages"))
+		}
+	}
+	// Reader
+	readerRun, readerCancel := disabledRoutine()
+	if setupErr == nil && cfg.isEnabled(StageReader) {
+		run, cancel, err := runner.runReader(cfg.Log, mainCancel, cfg.ReaderCfg)
+		if err != nil {
+			abortSetup(errors.Wrap(err, "error running reader"))
+		} else {
+			readerRun, readerCancel = run, cancel
+		}
+	}
+	// Progress-reporter
+	progressRun, progressCancel := disabledRoutine()
+	if setupErr == nil && progressReporter != nil {
+		progressRun, progressCancel = runner.runProgress(cfg.Log, progressReporter)
 	}
 
 	// ================== Manage routines ==================
 	<-mainCtx.Done()
-	// To collect errors from all routines as they close
-	routineErrors := make(map[string]error)
+	// To collect errors from all routines as they close.
+	// Errors are kept in teardown-order, so they're
+	// always reported in same order.
+	routineErrors := make([]RoutineError, 0)
+	summary := &RunSummary{}
+	// Reported separately from other routine-errors
+	var partialErr *reader.PartialReadError
+	var emptyRunErr *EmptyRunError
 
 	readerCancel()
 	cfg.Log.Tracef("Waiting for Reader to return")
 	err = readerRun.Wait()
-	if err != nil {
+	if errors.As(err, &partialErr) {
+		cfg.Log.Warnf("Input was read partially, report will be incomplete")
+		summary.Partial = true
+		summary.LinesRead = partialErr.LinesPublished
+	} else if err != nil {
 		err = errors.Wrap(err, "reader returned with error")
-		routineErrors["reader"] = err
+		routineErrors = append(routineErrors, RoutineError{Component: "reader", Err: err})
 	}
 
 	// Process-manager controls its own exit
 	// based on an internal message-timeout
 	cfg.Log.Tracef("Waiting for ProcessMgr to return")
 	err = processMgrRun.Wait()
-	if err != nil {
+	if errors.As(err, &emptyRunErr) {
+		cfg.Log.Warnf("Run is empty: %s", emptyRunErr.Reason)
+		summary.Empty = true
+	} else if err != nil {
 		err = errors.Wrap(err, "process-manager returned with error")
-		routineErrors["processMgr"] = err
+		routineErrors = append(routineErrors, RoutineError{Component: "processMgr", Err: err})
+	}
+	// Final progress is reported once processing is done
+	progressCancel()
+	cfg.Log.Tracef("Waiting for ProgressReporter to return")
+	err = progressRun.Wait()
+	if err != nil {
+		err = errors.Wrap(err, "progress-reporter returned with error")
+		routineErrors = append(routineErrors, RoutineError{Component: "progressReporter", Err: err})
+	}
+	diagnosticsCancel()
+	cfg.Log.Tracef("Waiting for diagnostics-listener to return")
+	err = diagnosticsRun.Wait()
+	if err != nil {
+		err = errors.Wrap(err, "diagnostics-listener returned with error")
+		routineErrors = append(routineErrors, RoutineError{Component: "diagnostics", Err: err})
+	}
+	if processMgr := runner.getProcessMgr(); processMgr != nil {
+		summary.ValidTxns = processMgr.validTxns
+		summary.SkippedTxns = processMgr.skippedTxns
+		if len(processMgr.unsafeCustomerIDs) > 0 {
+			summary.UnsafeCustomerIDs = processMgr.unsafeCustomerIDs
+		}
+		if processMgr.customerGroups != nil {
+			summary.Stragglers = processMgr.customerGroups.stragglers
+		}
+		// Reader's count is used for partial runs
+		if !summary.Partial {
+			summary.LinesRead = processMgr.linesRead
+		}
 	}
 
 	txnCreatorCancel()
@@ -95,7 +403,7 @@ func RunRoutines(cfg *RoutinesCfg) error {
 	err = txnCreatorRun.Wait()
 	if err != nil {
 		err = errors.Wrap(err, "transaction-creator returned with error")
-		routineErrors["txnCreator"] = err
+		routineErrors = append(routineErrors, RoutineError{Component: "txnCreator", Err: err})
 	}
 
 	accountCancel()
@@ -103,7 +411,15 @@ func RunRoutines(cfg *RoutinesCfg) error {
 	err = accountRun.Wait()
 	if err != nil {
 		err = errors.Wrap(err, "account returned with error")
-		routineErrors["account"] = err
+		routineErrors = append(routineErrors, RoutineError{Component: "account", Err: err})
+	}
+	if cfg.isEnabled(StageAccount) {
+		statsRepo, ok := cfg.AccountCfg.AccountCfg.EventRepo.(eventutil.StoreStatsProvider)
+		if ok {
+			stats := statsRepo.StoreStats(0)
+			summary.StoredEvents = stats.Events
+			summary.StoredAggregates = stats.Aggregates
+		}
 	}
 
 	accountViewCancel()
@@ -111,7 +427,23 @@ func RunRoutines(cfg *RoutinesCfg) error {
 	err = accountViewRun.Wait()
 	if err != nil {
 		err = errors.Wrap(err, "transaction-result-view returned with error")
-		routineErrors["txnResultView"] = err
+		routineErrors = append(routineErrors, RoutineError{Component: "txnResultView", Err: err})
+	}
+	if cfg.isEnabled(StageAccountView) {
+		if quarantine := cfg.AccountViewCfg.ResultViewCfg.Quarantine; quarantine != nil {
+			summary.QuarantinedEvents = quarantine.Len()
+		}
+	}
+
+	anomalyCancel()
+	cfg.Log.Tracef("Waiting for rejection-monitor to return")
+	err = anomalyRun.Wait()
+	if err != nil {
+		err = errors.Wrap(err, "rejection-monitor returned with error")
+		routineErrors = append(routineErrors, RoutineError{Component: "rejectionMonitor", Err: err})
+	}
+	if cfg.AnomalyCfg != nil && cfg.AnomalyCfg.Monitor != nil {
+		summary.RejectionAnomalies = cfg.AnomalyCfg.Monitor.Anomalies()
 	}
 
 	writerCancel()
@@ -119,21 +451,182 @@ func RunRoutines(cfg *RoutinesCfg) error {
 	err = writerRun.Wait()
 	if err != nil {
 		err = errors.Wrap(err, "writer returned with error")
-		routineErrors["writer"] = err
+		routineErrors = append(routineErrors, RoutineError{Component: "writer", Err: err})
+	}
+	for i, run := range shardWriterRuns {
+		component := fmt.Sprintf("shardWriter-%d", i)
+		shardWriterCancels[i]()
+		cfg.Log.Tracef("Waiting for %s to return", component)
+		err = run.Wait()
+		if err != nil {
+			err = errors.Wrapf(err, "%s returned with error", component)
+			routineErrors = append(routineErrors, RoutineError{Component: component, Err: err})
+		}
 	}
 
-	// Collect and print all errors
-	errStr := ""
-	for routine, routineErr := range routineErrors {
-		errStr += fmt.Sprintf("[%s]: %s\n", routine, routineErr)
+	// Routines have returned, so any messages
+	// still on Bus would otherwise be lost.
+	err = drainRecovery(cfg.Recovery)
+	if err != nil {
+		routineErrors = append(routineErrors, RoutineError{Component: "recovery", Err: err})
 	}
-	if errStr != "" {
-		errStr = "Some routines returned with errors:\n" + errStr
-		// Remove last newline char
-		errStr = errStr[:len(errStr)-1]
-		return errors.New(errStr)
+	if uses := deprecation.Snapshot().Since(deprecationsAtStart); len(uses) > 0 {
+		summary.Deprecations = uses
+	}
+	if cfg.Warnings != nil {
+		summary.Warnings = cfg.Warnings.Summary()
+	}
+	if setupErr != nil {
+		return summary, setupErr
+	}
+
+	runErr := &RunError{
+		RootCause:   runner.firstFailure(),
+		PartialRead: partialErr,
+	}
+	fatalRoutine := runner.abortedBy()
+	for _, routineErr := range routineErrors {
+		routineErr.At = runner.failedTime(routineErr.Component)
+		if routineErr.Component == fatalRoutine {
+			runErr.FatalRoutine = fatalRoutine
+			runErr.Fatal = routineErr.Err
+			continue
+		}
+		runErr.Errors = append(runErr.Errors, routineErr)
+
+		isRootCause := runErr.RootCause != nil &&
+			runErr.RootCause.Component == routineErr.Component
+		if !isRootCause && IsSecondaryErr(routineErr.Err) {
+			runErr.Secondary = append(runErr.Secondary, routineErr)
+		}
+	}
+	if len(routineErrors) > 0 {
+		logRootCause(cfg.Log, runErr)
+	}
+	if runErr.Fatal != nil {
+		return summary, runErr
+	}
+
+	if len(routineErrors) > 0 {
+		return summary, runErr
+	}
+	if partialErr != nil {
+		return summary, errors.Wrap(partialErr, "input read partially")
+	}
+	if deprecatedErr := newDeprecatedUseError(cfg.FailOnDeprecated, summary.Deprecations); deprecatedErr != nil {
+		return summary, deprecatedErr
+	}
+	if emptyRunErr != nil {
+		return summary, emptyRunErr
+	}
+	return summary, nil
+}
+
+// logRootCause logs root-cause of run-failure ahead
+// of other errors, so it isn't buried among errors
+// from routines torn down after it.
+func logRootCause(stdLog logger.Logger, runErr *RunError) {
+	if runErr.RootCause == nil {
+		return
+	}
+	stdLog.Errorf(
+		"Root cause of run-failure: [%s] at %s: %s",
+		runErr.RootCause.Component,
+		runErr.RootCause.At.Format(time.RFC3339Nano),
+		runErr.RootCause.Err,
+	)
+	if len(runErr.Secondary) > 0 {
+		stdLog.Warnf(
+			"%d routine(s) returned secondary errors after root cause",
+			len(runErr.Secondary),
+		)
 	}
-	return nil
+}
+
+// recordFailure records time routine returned error
+// at, and records the first such error as root-cause.
+func (r *routinesRunner) recordFailure(routine string, err error) {
+	if err == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	r.failedAt[routine] = now
+	if r.rootCause == nil {
+		r.rootCause = &RoutineError{
+			Component: routine,
+			Err:       err,
+			At:        now,
+		}
+	}
+}
+
+// firstFailure returns error first returned
+// by any routine, or nil if none errored.
+func (r *routinesRunner) firstFailure() *RoutineError {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rootCause
+}
+
+// failedTime returns time routine returned error at.
+func (r *routinesRunner) failedTime(routine string) time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.failedAt[routine]
+}
+
+func (r *routinesRunner) setProcessMgrCancel(cancel context.CancelFunc) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.processMgrCancel = cancel
+}
+
+func (r *routinesRunner) setProcessMgr(processMgr *processMgr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.processMgr = processMgr
+}
+
+func (r *routinesRunner) getProcessMgr() *processMgr {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.processMgr
+}
+
+// checkFatal aborts run if fail-fast is enabled
+// and routine returned with a fatal error.
+func (r *routinesRunner) checkFatal(stdLog logger.Logger, routine string, err error) {
+	if !r.failFast || !model.IsFatal(err) {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.fatalRoutine != "" {
+		return
+	}
+	r.fatalRoutine = routine
+	stdLog.Errorf("Aborting run on fatal error in routine: %s: %s", routine, err)
+	if r.processMgrCancel != nil {
+		r.processMgrCancel()
+	}
+}
+
+// abortedBy returns routine which aborted
+// the run, or blank if run wasn't aborted.
+func (r *routinesRunner) abortedBy() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.fatalRoutine
+}
+
+// disabledRoutine returns routine for a disabled
+// stage, which is never run, and so returns no error.
+func disabledRoutine() (*errgroup.Group, context.CancelFunc) {
+	return &errgroup.Group{}, func() {}
 }
 
 func (r *routinesRunner) runAccount(
@@ -154,6 +647,8 @@ func (r *routinesRunner) runAccount(
 		}
 		stdLog.Infof("Account routine returned")
 		cancel()
+		r.recordFailure("account", err)
+		r.checkFatal(stdLog, "account", err)
 		mainCancel()
 		return err
 	})
@@ -180,6 +675,64 @@ func (r *routinesRunner) runAccountView(
 		}
 		stdLog.Infof("Account-view routine returned")
 		cancel()
+		r.recordFailure("txnResultView", err)
+		r.checkFatal(stdLog, "txnResultView", err)
+		mainCancel()
+		return err
+	})
+	startupWg.Wait()
+
+	return run, cancel
+}
+
+func (r *routinesRunner) runAnomalyListener(
+	stdLog logger.Logger,
+	mainCancel context.CancelFunc,
+	cfg *anomaly.EventListenerCfg,
+) (*errgroup.Group, context.CancelFunc) {
+	startupWg := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	run, _ := errgroup.WithContext(ctx)
+
+	startupWg.Add(1)
+	run.Go(func() error {
+		startupWg.Done()
+		err := anomaly.InitEventListener(ctx, cfg)
+		if err != nil {
+			err = errors.Wrap(err, "error in rejection-monitor routine")
+		}
+		stdLog.Infof("Rejection-monitor routine returned")
+		cancel()
+		r.recordFailure("rejectionMonitor", err)
+		r.checkFatal(stdLog, "rejectionMonitor", err)
+		mainCancel()
+		return err
+	})
+	startupWg.Wait()
+
+	return run, cancel
+}
+
+func (r *routinesRunner) runDiagnostics(
+	stdLog logger.Logger,
+	mainCancel context.CancelFunc,
+	cfg *RoutinesCfg,
+) (*errgroup.Group, context.CancelFunc) {
+	startupWg := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	run, _ := errgroup.WithContext(ctx)
+
+	startupWg.Add(1)
+	run.Go(func() error {
+		startupWg.Done()
+		err := initDiagnostics(ctx, cfg)
+		if err != nil {
+			err = errors.Wrap(err, "error in diagnostics routine")
+		}
+		stdLog.Infof("Diagnostics routine returned")
+		cancel()
+		r.recordFailure("diagnostics", err)
+		r.checkFatal(stdLog, "diagnostics", err)
 		mainCancel()
 		return err
 	})
@@ -206,6 +759,8 @@ func (r *routinesRunner) runTxnCreator(
 		}
 		stdLog.Infof("Transaction-creator routine returned")
 		cancel()
+		r.recordFailure("txnCreator", err)
+		r.checkFatal(stdLog, "txnCreator", err)
 		mainCancel()
 		return err
 	})
@@ -225,13 +780,31 @@ func (r *routinesRunner) runProcessMgr(
 
 	startupWg.Add(1)
 	run.Go(func() error {
-		startupWg.Done()
-		err := InitProcessMgr(ctx, cfg)
+		err := func() error {
+			processMgr, err := newProcessMgr(cfg)
+			// Process-manager subscribes on creation, so messages
+			// published once this returns (such as recovered
+			// messages) aren't missed.
+			startupWg.Done()
+			if err != nil {
+				return err
+			}
+			r.setProcessMgr(processMgr)
+			err = processMgr.start(ctx)
+			return errors.Wrap(err, "process-loop returned with error")
+		}()
 		if err != nil {
 			err = errors.Wrap(err, "error in process-manager")
 		}
 		stdLog.Infof("Process-manager routine returned")
 		cancel()
+		// Empty-run is reported after report is
+		// written, and is not a routine-failure.
+		var emptyRunErr *EmptyRunError
+		if !errors.As(err, &emptyRunErr) {
+			r.recordFailure("processMgr", err)
+		}
+		r.checkFatal(stdLog, "processMgr", err)
 		mainCancel()
 		return err
 	})
@@ -249,6 +822,7 @@ func (r *routinesRunner) runReader(
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "error creating reader")
 	}
+	r.reader = reader
 
 	startupWg := &sync.WaitGroup{}
 	ctx, cancel := context.WithCancel(context.Background())
@@ -263,6 +837,8 @@ func (r *routinesRunner) runReader(
 		}
 		stdLog.Infof("Reader-routine routine returned")
 		cancel()
+		r.recordFailure("reader", err)
+		r.checkFatal(stdLog, "reader", err)
 		mainCancel()
 		return err
 	})
@@ -271,9 +847,69 @@ func (r *routinesRunner) runReader(
 	return run, cancel, nil
 }
 
+// newProgressReporter creates progress-reporter, with progress
+// of run as its source unless cfg specifies one.
+func (r *routinesRunner) newProgressReporter(
+	cfg *progress.Cfg,
+	processMgrCfg *ProcessMgrCfg,
+) (*progress.Reporter, error) {
+	reporterCfg := *cfg
+	if reporterCfg.Source == nil {
+		reporterCfg.Source = r.progressSource(processMgrCfg.TxnResultViewRepo)
+	}
+	return progress.NewReporter(&reporterCfg)
+}
+
+// runProgress runs progress-reporter. Errors of reporter
+// only fail reporting progress, and so don't abort run.
+func (r *routinesRunner) runProgress(
+	stdLog logger.Logger,
+	reporter *progress.Reporter,
+) (*errgroup.Group, context.CancelFunc) {
+	startupWg := &sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	run, _ := errgroup.WithContext(ctx)
+
+	startupWg.Add(1)
+	run.Go(func() error {
+		startupWg.Done()
+		err := reporter.Start(ctx)
+		if err != nil {
+			err = errors.Wrap(err, "error in progress-reporter routine")
+		}
+		stdLog.Infof("Progress-reporter routine returned")
+		return err
+	})
+	startupWg.Wait()
+
+	return run, cancel
+}
+
+// progressSource returns progress of reader (if run), and
+// of transaction-result view-repo. Accepted and declined
+// results are only counted if view-repo provides counts.
+func (r *routinesRunner) progressSource(resultRepo accountview.TxnResultViewRepo) progress.Source {
+	countingRepo, _ := resultRepo.(accountview.CountingTxnResultViewRepo)
+	return progress.SourceFunc(func() progress.Snapshot {
+		snapshot := progress.Snapshot{
+			Processed: resultRepo.Index(),
+		}
+		if r.reader != nil {
+			snapshot.LinesRead, _ = r.reader.Progress()
+		}
+		if countingRepo != nil {
+			counts := countingRepo.Counts()
+			snapshot.Accepted = counts.Accepted
+			snapshot.Declined = counts.Declined
+		}
+		return snapshot
+	})
+}
+
 func (r *routinesRunner) runWriter(
 	stdLog logger.Logger,
 	mainCancel context.CancelFunc,
+	component string,
 	cfg *writer.CmdListenerCfg,
 ) (*errgroup.Group, context.CancelFunc) {
 	startupWg := &sync.WaitGroup{}
@@ -285,10 +921,12 @@ func (r *routinesRunner) runWriter(
 		startupWg.Done()
 		err := writer.InitCmdListener(ctx, cfg)
 		if err != nil {
-			err = errors.Wrap(err, "error in writer routine")
+			err = errors.Wrapf(err, "error in %s routine", component)
 		}
-		stdLog.Infof("Writer-routine routine returned")
+		stdLog.Infof("%s routine returned", component)
 		cancel()
+		r.recordFailure(component, err)
+		r.checkFatal(stdLog, component, err)
 		mainCancel()
 		return err
 	})
@@ -0,0 +1,1220 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/anomaly"
+	"github.com/Jaskaranbir/es-bank-account/domain/progress"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
+)
+
+var _ = Describe("RunRoutines", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+	var ioWriter *domain_test.MockWriter
+	var routinesCfg *RoutinesCfg
+
+	// Two lines are read before reader fails
+	testData := []txn.CreateTxnReq{
+		{
+			ID:         "15887",
+			CustomerID: "528",
+			LoadAmount: "$3318.47",
+			Time:       "2000-01-01T00:00:00Z",
+		},
+		{
+			ID:         "16987",
+			CustomerID: "898",
+			LoadAmount: "$33.47",
+			Time:       "2000-01-02T00:00:00Z",
+		},
+		{
+			ID:         "14087",
+			CustomerID: "197",
+			LoadAmount: "$99",
+			Time:       "2000-05-01T00:00:00Z",
+		},
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		cfgProvider := domain_test.ConfigProvider{}
+
+		mockReader, err := domain_test.NewMockReader(testData)
+		Expect(err).ToNot(HaveOccurred())
+		readBytes := 0
+		for _, req := range testData[:2] {
+			reqBytes, err := json.Marshal(req)
+			Expect(err).ToNot(HaveOccurred())
+			// Including newline-char
+			readBytes += len(reqBytes) + 1
+		}
+		ioReader := domain_test.NewMockErrReader(
+			mockReader,
+			readBytes,
+			errors.New("connection reset"),
+		)
+		ioWriter = domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:        logger.NewStdLogger("reader"),
+				Bus:        bus,
+				Reader:     ioReader,
+				DataRead:   model.TxnRead,
+				ReadFailed: model.TxnReadFailed,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+				TxnReadFailed:   model.TxnReadFailed,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+				// Report is unwrapped by writer
+				PayloadEnvelope: true,
+			},
+			WriterCfg: writerCfg,
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("marks run and report as partial on read-error", func(done Done) {
+		summary, err := RunRoutines(routinesCfg)
+		Expect(err).To(HaveOccurred())
+
+		var partialErr *reader.PartialReadError
+		Expect(errors.As(err, &partialErr)).To(BeTrue(), err.Error())
+		Expect(partialErr.LinesPublished).To(Equal(2))
+		Expect(partialErr.Cause.Error()).To(Equal("connection reset"))
+
+		Expect(summary).To(Equal(&RunSummary{
+			Partial:   true,
+			LinesRead: 2,
+			ValidTxns: 2,
+
+			StoredEvents:     2,
+			StoredAggregates: 2,
+		}))
+
+		results := strings.Split(string(ioWriter.Content()), "\n")
+		Expect(results).To(HaveLen(3))
+		trailer := &ReportTrailer{}
+		err = json.Unmarshal([]byte(results[2]), trailer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trailer).To(Equal(&ReportTrailer{
+			Partial:   true,
+			LinesRead: 2,
+		}))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("tears down started routines if recovering messages fails", func(done Done) {
+		routinesCfg.Recovery = &RecoveryCfg{
+			Bus:   bus,
+			Input: strings.NewReader("not a drained message"),
+		}
+
+		summary, err := RunRoutines(routinesCfg)
+		Expect(err).To(MatchError(ContainSubstring("error recovering messages")))
+		for action, stats := range bus.(eventutil.BusIntrospector).SubscriptionStats() {
+			Expect(stats.Subscribers).To(BeZero(), "action %s is still subscribed", action)
+		}
+		// Input isn't read once run is aborted
+		Expect(summary.LinesRead).To(BeZero())
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("reports partial read along with routine-errors", func(done Done) {
+		// Subscribing to terminated bus fails on startup
+		terminatedBus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		terminatedBus.Terminate()
+		routinesCfg.TxnCreatorCfg.Bus = terminatedBus
+
+		summary, err := RunRoutines(routinesCfg)
+		Expect(summary.Partial).To(BeTrue())
+
+		var runErr *RunError
+		Expect(errors.As(err, &runErr)).To(BeTrue(), err.Error())
+		Expect(runErr.RootCause.Component).To(Equal("txnCreator"))
+		Expect(runErr.PartialRead).ToNot(BeNil())
+
+		var partialErr *reader.PartialReadError
+		Expect(errors.As(err, &partialErr)).To(BeTrue())
+		Expect(partialErr.Cause.Error()).To(Equal("connection reset"))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("doesn't start routines if progress-reporter is misconfigured", func() {
+		routinesCfg.Progress = &progress.Cfg{IntervalSec: -1}
+
+		summary, err := RunRoutines(routinesCfg)
+		Expect(err).To(MatchError(ContainSubstring("Progress.IntervalSec")))
+		Expect(summary).To(BeNil())
+		for action, stats := range bus.(eventutil.BusIntrospector).SubscriptionStats() {
+			Expect(stats.Subscribers).To(BeZero(), "action %s is subscribed", action)
+		}
+	})
+
+	It("reports warnings of run in summary and report", func(done Done) {
+		collector := warnings.NewMemoryCollector(warnings.DefaultMaxDetails)
+		routinesCfg.Warnings = collector
+		routinesCfg.ProcessMgrCfg.ReportWarnings = collector
+		// As if added by a component, such as Bus
+		collector.Add("eventBus", warnings.NoSubscribers, "action: someAction")
+
+		summary, err := RunRoutines(routinesCfg)
+		Expect(err).To(HaveOccurred())
+		Expect(summary.Warnings).To(Equal(warnings.Summary{
+			warnings.NoSubscribers: {
+				Count: 1,
+				Details: []warnings.Detail{
+					{Component: "eventBus", Detail: "action: someAction"},
+				},
+			},
+		}))
+
+		results := strings.Split(string(ioWriter.Content()), "\n")
+		Expect(results).To(HaveLen(3))
+		trailer := &ReportTrailer{}
+		err = json.Unmarshal([]byte(results[2]), trailer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trailer.Warnings).To(Equal(warnings.Counts{warnings.NoSubscribers: 1}))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
+
+var errStoreUnavailable = errors.New("event-store unavailable")
+
+// Fails all reads with specified error,
+// as if the event-store was unavailable.
+type failingEventRepo struct {
+	eventutil.EventRepo
+	err error
+}
+
+func (r *failingEventRepo) FetchByIndex(int) ([]model.Event, error) {
+	return nil, r.err
+}
+
+// Fails all inserts with specified error,
+// as if the event-store was unavailable.
+type failingEventStore struct {
+	eventutil.EventStore
+	err error
+}
+
+func (s *failingEventStore) Insert(model.Event) error {
+	return s.err
+}
+
+var _ = Describe("RunRoutines fail-fast", func() {
+	// Run would take this long if not aborted
+	const processMgrIdleTimeoutSec = 30
+
+	var bus eventutil.Bus
+	var routinesCfg *RoutinesCfg
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		cfgProvider := domain_test.ConfigProvider{}
+
+		mockReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{
+				ID:         "15887",
+				CustomerID: "528",
+				LoadAmount: "$3318.47",
+				Time:       "2000-01-01T00:00:00Z",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		accountViewCfg.ResultViewCfg.EventRepo = &failingEventRepo{
+			EventRepo: accountCfg.AccountCfg.EventRepo,
+			err:       model.NewFatalError(errStoreUnavailable),
+		}
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   mockReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg: writerCfg,
+			FailFast:  true,
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("aborts run promptly on fatal error", func(done Done) {
+		_, err := RunRoutines(routinesCfg)
+		Expect(err).To(HaveOccurred())
+		Expect(model.IsFatal(err)).To(BeTrue(), err.Error())
+
+		var runErr *RunError
+		Expect(errors.As(err, &runErr)).To(BeTrue(), err.Error())
+		Expect(runErr.FatalRoutine).To(Equal("txnResultView"))
+		Expect(errors.Is(runErr.Fatal, errStoreUnavailable)).To(BeTrue(), err.Error())
+		for _, routineErr := range runErr.Errors {
+			Expect(routineErr.Component).ToNot(Equal("txnResultView"))
+		}
+		Expect(err.Error()).To(HavePrefix("Run aborted on fatal error: [txnResultView]:"))
+
+		close(done)
+	}, 5)
+
+	It("aborts run when event-store of a component fails", func(done Done) {
+		// Store returns a plain error, which
+		// account marks as fatal itself.
+		eventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+			Bus: bus,
+			EventStore: &failingEventStore{
+				EventStore: eventutil.NewMemoryEventStore(),
+				err:        errStoreUnavailable,
+			},
+			UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		routinesCfg.AccountCfg.AccountCfg.EventRepo = eventRepo
+		routinesCfg.AccountViewCfg.ResultViewCfg.EventRepo = eventRepo
+
+		_, err = RunRoutines(routinesCfg)
+		Expect(err).To(HaveOccurred())
+		Expect(model.IsFatal(err)).To(BeTrue(), err.Error())
+
+		var runErr *RunError
+		Expect(errors.As(err, &runErr)).To(BeTrue(), err.Error())
+		Expect(runErr.FatalRoutine).To(Equal("account"))
+		Expect(errors.Is(runErr.Fatal, errStoreUnavailable)).To(BeTrue(), err.Error())
+		Expect(err.Error()).To(HavePrefix("Run aborted on fatal error: [account]:"))
+
+		close(done)
+	}, 5)
+})
+
+var _ = Describe("RunRoutines errors", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var buses []eventutil.Bus
+
+	// Runs routines with transaction-creator
+	// and account failing on startup.
+	runWithFailures := func() error {
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		buses = append(buses, bus)
+		cfgProvider := domain_test.ConfigProvider{}
+
+		mockReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{
+				ID:         "15887",
+				CustomerID: "528",
+				LoadAmount: "$3318.47",
+				Time:       "2000-01-01T00:00:00Z",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		// Subscribing to terminated bus fails on startup
+		terminatedBus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		terminatedBus.Terminate()
+		accountCfg.Bus = terminatedBus
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		txnCreatorCfg.Bus = terminatedBus
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   mockReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 1,
+			},
+			WriterCfg: writerCfg,
+		})
+		return err
+	}
+
+	AfterEach(func() {
+		for _, bus := range buses {
+			bus.Terminate()
+		}
+		buses = nil
+	})
+
+	It("reports routine-errors in stable order", func(done Done) {
+		err := runWithFailures()
+		Expect(err).To(HaveOccurred())
+
+		var runErr *RunError
+		Expect(errors.As(err, &runErr)).To(BeTrue(), err.Error())
+		components := make([]string, 0)
+		for _, routineErr := range runErr.Errors {
+			components = append(components, routineErr.Component)
+		}
+		Expect(components).To(Equal([]string{"txnCreator", "account"}))
+
+		for i := 0; i < 2; i++ {
+			rerunErr := runWithFailures()
+			Expect(rerunErr).To(HaveOccurred())
+			Expect(rerunErr.Error()).To(Equal(err.Error()))
+		}
+
+		close(done)
+	}, 3*(processMgrIdleTimeoutSec+5))
+})
+
+var _ = Describe("RunRoutines empty-run", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var buses []eventutil.Bus
+
+	// Runs routines against provided input, and
+	// returns run-results and written report.
+	run := func(input string, failOnEmpty, failOnZeroValid bool) (*RunSummary, error, string) {
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		buses = append(buses, bus)
+		cfgProvider := domain_test.ConfigProvider{}
+		ioWriter := domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		summary, err := RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   strings.NewReader(input),
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+				PayloadEnvelope:              true,
+
+				FailOnEmptyInput:    failOnEmpty,
+				FailOnZeroValidTxns: failOnZeroValid,
+			},
+			WriterCfg: writerCfg,
+		})
+		return summary, err, string(ioWriter.Content())
+	}
+
+	expectHeader := func(report string, header *ReportHeader) {
+		lines := strings.Split(report, "\n")
+		Expect(lines).To(HaveLen(1))
+		readHeader := &ReportHeader{}
+		err := json.Unmarshal([]byte(lines[0]), readHeader)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readHeader).To(Equal(header))
+	}
+
+	AfterEach(func() {
+		for _, bus := range buses {
+			bus.Terminate()
+		}
+		buses = nil
+	})
+
+	Context("input is empty", func() {
+		It("keeps current behavior by default", func(done Done) {
+			summary, err, report := run("", false, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(summary).To(Equal(&RunSummary{}))
+			Expect(report).To(BeEmpty())
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+
+		It("returns EmptyRunError and writes report-header", func(done Done) {
+			summary, err, report := run("", true, true)
+			Expect(err).To(HaveOccurred())
+			emptyRunErr := &EmptyRunError{}
+			Expect(errors.As(err, &emptyRunErr)).To(BeTrue(), err.Error())
+			Expect(emptyRunErr).To(Equal(&EmptyRunError{Reason: EmptyInput}))
+			Expect(summary).To(Equal(&RunSummary{Empty: true}))
+
+			expectHeader(report, &ReportHeader{})
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+	})
+
+	Context("input only has invalid transactions", func() {
+		// Both lines fail transaction-creation
+		input := `{"id":"1","customer_id":"1","load_amount":"abc","time":"2000-01-05T00:00:01Z"}
+{"id":"2","customer_id":"","load_amount":"$10","time":"not-a-time"}
+`
+
+		It("keeps current behavior by default", func(done Done) {
+			summary, err, report := run(input, false, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(summary).To(Equal(&RunSummary{LinesRead: 2}))
+			Expect(report).To(BeEmpty())
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+
+		It("is not flagged when only empty-input check is enabled", func(done Done) {
+			_, err, report := run(input, true, false)
+			Expect(err).ToNot(HaveOccurred())
+			expectHeader(report, &ReportHeader{LinesRead: 2})
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+
+		It("returns EmptyRunError and writes report-header", func(done Done) {
+			summary, err, report := run(input, true, true)
+			Expect(err).To(HaveOccurred())
+			emptyRunErr := &EmptyRunError{}
+			Expect(errors.As(err, &emptyRunErr)).To(BeTrue(), err.Error())
+			Expect(emptyRunErr).To(Equal(&EmptyRunError{
+				Reason:    ZeroValidTxns,
+				LinesRead: 2,
+			}))
+			Expect(summary).To(Equal(&RunSummary{LinesRead: 2, Empty: true}))
+
+			expectHeader(report, &ReportHeader{LinesRead: 2})
+
+			close(done)
+		}, processMgrIdleTimeoutSec+5)
+	})
+})
+
+var errCreatorStore = errors.New("creator-store unavailable")
+
+// Terminates bus and fails on storing events, as
+// if creator failed and run was torn down after it.
+type terminatingEventRepo struct {
+	eventutil.EventRepo
+	bus eventutil.Bus
+}
+
+func (r *terminatingEventRepo) InsertAndPublish(model.Event) error {
+	r.bus.Terminate()
+	return errCreatorStore
+}
+
+var _ = Describe("RunRoutines root-cause", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+	var routinesCfg *RoutinesCfg
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		cfgProvider := domain_test.ConfigProvider{}
+
+		// Single line, so reader is done
+		// before bus is terminated.
+		mockReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{
+				ID:         "15887",
+				CustomerID: "528",
+				LoadAmount: "$3318.47",
+				Time:       "2000-01-05T00:00:00Z",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		txnCreatorCfg.CreatorCfg.EventRepo = &terminatingEventRepo{
+			EventRepo: txnCreatorCfg.CreatorCfg.EventRepo,
+			bus:       bus,
+		}
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   mockReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 1,
+			},
+			WriterCfg: writerCfg,
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("separates root-cause from secondary errors", func(done Done) {
+		_, err := RunRoutines(routinesCfg)
+		Expect(err).To(HaveOccurred())
+
+		var runErr *RunError
+		Expect(errors.As(err, &runErr)).To(BeTrue(), err.Error())
+		Expect(runErr.RootCause).ToNot(BeNil())
+		Expect(runErr.RootCause.Component).To(Equal("txnCreator"))
+		Expect(errors.Is(runErr.RootCause.Err, errCreatorStore)).To(BeTrue())
+		Expect(runErr.RootCause.At).ToNot(BeZero())
+
+		secondary := make(map[string]bool)
+		for _, routineErr := range runErr.Secondary {
+			Expect(IsSecondaryErr(routineErr.Err)).To(BeTrue())
+			Expect(routineErr.At).ToNot(BeTemporally("<", runErr.RootCause.At))
+			secondary[routineErr.Component] = true
+		}
+		for _, component := range []string{"account", "txnResultView", "writer"} {
+			Expect(secondary).To(HaveKey(component), err.Error())
+		}
+		Expect(secondary).ToNot(HaveKey("txnCreator"))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
+
+var _ = Describe("RunError", func() {
+	It("matches errors from any routine", func() {
+		errOther := errors.New("other error")
+		err := error(&RunError{
+			Errors: []RoutineError{
+				{Component: "txnCreator", Err: errors.Wrap(errOther, "wrapped")},
+				{Component: "txnResultView", Err: errors.Wrap(errStoreUnavailable, "wrapped")},
+			},
+		})
+		err = errors.Wrap(err, "error running domain-routines")
+
+		Expect(errors.Is(err, errOther)).To(BeTrue())
+		Expect(errors.Is(err, errStoreUnavailable)).To(BeTrue())
+		Expect(errors.Is(err, errors.New("unknown error"))).To(BeFalse())
+	})
+
+	It("matches partial-read error", func() {
+		errReset := errors.New("connection reset")
+		err := error(&RunError{
+			Errors: []RoutineError{
+				{Component: "txnCreator", Err: errors.New("error a")},
+			},
+			PartialRead: &reader.PartialReadError{LinesPublished: 2, Cause: errReset},
+		})
+		err = errors.Wrap(err, "error running domain-routines")
+
+		var partialErr *reader.PartialReadError
+		Expect(errors.As(err, &partialErr)).To(BeTrue())
+		Expect(partialErr.LinesPublished).To(Equal(2))
+		Expect(errors.Is(err, errReset)).To(BeTrue())
+		Expect(err).To(MatchError(HaveSuffix(
+			"[txnCreator]: error a\nInput was read partially: " +
+				"partial read, stopped after 2 line(s): connection reset",
+		)))
+	})
+
+	It("renders routine-errors in order", func() {
+		err := &RunError{
+			Errors: []RoutineError{
+				{Component: "txnCreator", Err: errors.New("error a")},
+				{Component: "account", Err: errors.New("error b")},
+			},
+		}
+		Expect(err.Error()).To(Equal(
+			"Some routines returned with errors:\n[txnCreator]: error a\n[account]: error b",
+		))
+	})
+})
+
+var _ = Describe("RunRoutines quarantine", func() {
+	const processMgrIdleTimeoutSec = 1
+	const numTxns = 49
+
+	var bus eventutil.Bus
+	var ioWriter *domain_test.MockWriter
+	var quarantine *accountview.EventQuarantine
+	var routinesCfg *RoutinesCfg
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		cfgProvider := domain_test.ConfigProvider{}
+
+		testData := make([]txn.CreateTxnReq, 0, numTxns)
+		for i := 0; i < numTxns; i++ {
+			testData = append(testData, txn.CreateTxnReq{
+				ID:         fmt.Sprintf("%d", i+1),
+				CustomerID: fmt.Sprintf("%d", i%5+1),
+				LoadAmount: "$10.00",
+				Time:       fmt.Sprintf("2000-01-%02dT00:00:00Z", i%28+1),
+			})
+		}
+		mockReader, err := domain_test.NewMockReader(testData)
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter = domain_test.NewMockWriter()
+		quarantine = accountview.NewEventQuarantine()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		accountViewCfg.ResultViewCfg.Quarantine = quarantine
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Corrupt event, such as from a hand-edited store
+		corruptEvent, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "corrupt",
+			Action:      model.AccountDeposited,
+			Data:        []byte(`{"txn_id":`),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = accountCfg.AccountCfg.EventRepo.InsertAndPublish(corruptEvent)
+		Expect(err).ToNot(HaveOccurred())
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   mockReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+				Quarantine:                   quarantine,
+			},
+			WriterCfg: writerCfg,
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("quarantines corrupt event and completes run", func(done Done) {
+		summary, err := RunRoutines(routinesCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.QuarantinedEvents).To(Equal(1))
+
+		entries := quarantine.Entries()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Action).To(Equal(model.AccountDeposited))
+		Expect(entries[0].RawData).To(Equal(`{"txn_id":`))
+
+		results := strings.Split(string(ioWriter.Content()), "\n")
+		Expect(results).To(HaveLen(numTxns + 1))
+		trailer := &ReportTrailer{}
+		err = json.Unmarshal([]byte(results[numTxns]), trailer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trailer).To(Equal(&ReportTrailer{
+			LinesRead:         numTxns,
+			QuarantinedEvents: 1,
+		}))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("fails run with strict-hydration", func(done Done) {
+		routinesCfg.AccountViewCfg.ResultViewCfg.StrictHydration = true
+
+		_, err := RunRoutines(routinesCfg)
+		Expect(err).To(HaveOccurred())
+		var runErr *RunError
+		Expect(errors.As(err, &runErr)).To(BeTrue(), err.Error())
+		Expect(runErr.Errors).ToNot(BeEmpty())
+		Expect(quarantine.Len()).To(BeZero())
+
+		close(done)
+	}, processMgrIdleTimeoutSec+10)
+})
+
+var _ = Describe("RunRoutines subset of stages", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+	var txnCreatorCfg *txn.CmdListenerCfg
+	var routinesCfg *RoutinesCfg
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		cfgProvider := domain_test.ConfigProvider{}
+
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$20", Time: "2000-01-05T02:00:00Z"},
+			{ID: "3", CustomerID: "", LoadAmount: "$30", Time: "2000-01-05T03:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		// Account isn't run, so its event-repo stays empty
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err = cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg:      writerCfg,
+			DisabledStages: []Stage{StageAccount},
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("creates transactions without processing these if account is disabled", func(done Done) {
+		recorder, err := testsupport.NewBusRecorder(
+			bus,
+			model.TxnCreated.String(),
+			model.TxnCreateFailed.String(),
+			model.ProcessTxn.String(),
+			model.AccountDeposited.String(),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer recorder.Stop()
+
+		summary, err := RunRoutines(routinesCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.LinesRead).To(Equal(3))
+		Expect(summary.ValidTxns).To(Equal(2))
+
+		created := recorder.Messages(model.TxnCreated.String())
+		Expect(created).To(HaveLen(2))
+		Expect(recorder.Messages(model.TxnCreateFailed.String())).To(HaveLen(1))
+		events, err := txnCreatorCfg.CreatorCfg.EventRepo.FetchByIndex(0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(3))
+
+		// Commands are still issued, but nothing processes these
+		Expect(recorder.Messages(model.ProcessTxn.String())).To(HaveLen(2))
+		Expect(recorder.Messages(model.AccountDeposited.String())).To(BeEmpty())
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("validates stages", func() {
+		routinesCfg.DisabledStages = []Stage{"unknown"}
+		_, err := RunRoutines(routinesCfg)
+		Expect(err).To(MatchError(ContainSubstring("invalid stage: unknown")))
+
+		// Config is required for enabled stages
+		routinesCfg.DisabledStages = nil
+		_, err = RunRoutines(routinesCfg)
+		Expect(err).To(MatchError(ContainSubstring("config is nil for enabled stage: account")))
+	})
+
+	It("ignores disabled stages when checking wiring", func() {
+		routinesCfg.DisabledStages = []Stage{StageAccount, StageWriter}
+		issues := CheckWiring(routinesCfg)
+
+		noSubscriber := make([]string, 0)
+		for _, issue := range issues {
+			if issue.Kind == NoSubscriber {
+				noSubscriber = append(noSubscriber, issue.Action)
+			}
+		}
+		Expect(noSubscriber).To(ConsistOf(
+			model.ProcessTxn.String(),
+			model.WriteData.String(),
+		))
+	})
+})
+
+var _ = Describe("RunRoutines rejection-anomalies", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("counts anomalies in run-summary", func(done Done) {
+		cfgProvider := domain_test.ConfigProvider{}
+
+		// Results are processed concurrently, but any order of 10
+		// accepted and 20 rejected results has a window of 10 with
+		// more than half rejected.
+		testData := make([]txn.CreateTxnReq, 0)
+		for i := 0; i < 30; i++ {
+			loadAmount := "$10.00"
+			if i >= 10 {
+				loadAmount = "$6000.00"
+			}
+			testData = append(testData, txn.CreateTxnReq{
+				ID:         fmt.Sprintf("%d", i+1),
+				CustomerID: fmt.Sprintf("%d", i+1),
+				LoadAmount: loadAmount,
+				Time:       "2000-01-05T00:00:00Z",
+			})
+		}
+		mockReader, err := domain_test.NewMockReader(testData)
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+		monitor, err := anomaly.NewRejectionMonitor(&anomaly.RejectionMonitorCfg{
+			WindowSize:  10,
+			Threshold:   0.5,
+			CooldownSec: 60,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		summary, err := RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   mockReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				ReportWriteFailed: model.WriteFailed,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg: writerCfg,
+			AnomalyCfg: &anomaly.EventListenerCfg{
+				Log: logger.NewStdLogger("anomaly"),
+				Bus: bus,
+
+				AccountDeposited:     model.AccountDeposited,
+				AccountWithdrawn:     model.AccountWithdrawn,
+				DuplicateTxn:         model.DuplicateTxn,
+				AccountLimitExceeded: model.AccountLimitExceeded,
+				RejectionRateAnomaly: model.RejectionRateAnomaly,
+
+				Monitor: monitor,
+			},
+			WiringCheck: WiringCheckStrict,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(monitor.Observed()).To(Equal(30))
+		Expect(summary.RejectionAnomalies).To(Equal(1))
+		// One result-event for each customer
+		Expect(summary.StoredEvents).To(Equal(30))
+		Expect(summary.StoredAggregates).To(Equal(30))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
+
+var _ = Describe("RunRoutines deprecated features", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	// runWithRawReport runs a transaction with report
+	// sent to writer as raw (non-envelope) payload.
+	runWithRawReport := func(failOnDeprecated []string) (*RunSummary, *domain_test.MockWriter, error) {
+		cfgProvider := domain_test.ConfigProvider{}
+		mockReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10.00", Time: "2000-01-05T00:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter := domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		summary, err := RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   mockReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg:        writerCfg,
+			FailOnDeprecated: failOnDeprecated,
+		})
+		return summary, ioWriter, err
+	}
+
+	It("counts uses of deprecated features in run-summary", func(done Done) {
+		summary, _, err := runWithRawReport(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary.Deprecations).To(Equal(deprecation.Counts{
+			deprecation.RawWriteData: 1,
+		}))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("fails run if a listed deprecated feature is used", func(done Done) {
+		summary, ioWriter, err := runWithRawReport([]string{deprecation.RawWriteData})
+
+		deprecatedErr := &DeprecatedUseError{}
+		Expect(errors.As(err, &deprecatedErr)).To(BeTrue())
+		Expect(deprecatedErr.Uses).To(Equal(deprecation.Counts{
+			deprecation.RawWriteData: 1,
+		}))
+		Expect(err).To(MatchError(ContainSubstring("raw-write-data (1)")))
+		Expect(summary.Deprecations).To(Equal(deprecatedErr.Uses))
+		// Report is still written
+		Expect(string(ioWriter.Content())).To(ContainSubstring(`"id":"1"`))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Seeded opening-balances", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	asOf := time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC)
+	testData := []txn.CreateTxnReq{
+		// Only succeeds because of seeded balance
+		{ID: "1", CustomerID: "1", LoadAmount: "-$6000", Time: "2000-01-05T01:00:00Z"},
+		// Seeded balance doesn't count towards daily limit
+		{ID: "2", CustomerID: "1", LoadAmount: "$5000", Time: "2000-01-05T02:00:00Z"},
+		{ID: "3", CustomerID: "2", LoadAmount: "-$150", Time: "2000-01-05T01:00:00Z"},
+		{ID: "4", CustomerID: "2", LoadAmount: "-$100", Time: "2000-01-05T02:00:00Z"},
+	}
+
+	var bus eventutil.Bus
+	var ioWriter *domain_test.MockWriter
+	var routinesCfg *RoutinesCfg
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		cfgProvider := domain_test.ConfigProvider{}
+
+		ioReader, err := domain_test.NewMockReader(testData)
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter = domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = account.SeedOpeningBalances(
+			accountCfg.AccountCfg.EventRepo,
+			[]account.OpeningBalance{
+				{CustID: "1", Balance: 10000, AsOf: asOf},
+				{CustID: "2", Balance: 100, AsOf: asOf},
+			},
+			&account.SeedOpts{AccountSeeded: model.AccountSeeded},
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+				OrderedDispatch:              true,
+			},
+			WriterCfg: writerCfg,
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("validates transactions against seeded balances", func(done Done) {
+		_, err := RunRoutines(routinesCfg)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Report only contains results of input-transactions
+		accepted := make(map[string]bool)
+		for _, line := range strings.Split(string(ioWriter.Content()), "\n") {
+			result := &accountview.TxnResultEntry{}
+			err := json.Unmarshal([]byte(line), result)
+			Expect(err).ToNot(HaveOccurred())
+			accepted[result.ID] = result.Accepted
+		}
+		Expect(accepted).To(Equal(map[string]bool{
+			"1": true,
+			"2": true,
+			"3": false,
+			"4": true,
+		}))
+
+		accountEvents, err := routinesCfg.AccountCfg.AccountCfg.EventRepo.Fetch("2")
+		Expect(err).ToNot(HaveOccurred())
+		failureCauses := make([]account.TxnFailureCause, 0)
+		for _, event := range accountEvents {
+			if event.Action() != model.AccountLimitExceeded {
+				continue
+			}
+			txnFailure := &account.TxnFailure{}
+			err := json.Unmarshal(event.Data(), txnFailure)
+			Expect(err).ToNot(HaveOccurred())
+			failureCauses = append(failureCauses, txnFailure.FailureCause)
+		}
+		Expect(failureCauses).To(Equal([]account.TxnFailureCause{account.InsufficientFunds}))
+
+		for custID, balance := range map[string]float64{"1": 9000, "2": 0} {
+			usage, err := account.InspectUsage(routinesCfg.AccountCfg.AccountCfg, custID, asOf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(usage.Balance).To(Equal(balance), custID)
+		}
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Idle-timeout of process-manager in configs provided by
+// #processMgrRunCfg. Process-manager is driven by a fake
+// clock in #runRoutinesSettled, so this is never waited for.
+const settledIdleTimeoutSec = 1
+
+// processMgrRunCfg provides config of process-manager
+// for #runRoutinesSettled, with report-written timeout
+// well beyond idle-timeout. Provided here rather than by
+// domain_test#ConfigProvider, which can't import domain.
+func processMgrRunCfg(bus eventutil.Bus, resultRepo accountview.TxnResultViewRepo) *ProcessMgrCfg {
+	return &ProcessMgrCfg{
+		Log:               logger.NewStdLogger("ProcessMgr"),
+		Bus:               bus,
+		TxnResultViewRepo: resultRepo,
+
+		WriteData:  model.WriteData,
+		CreateTxn:  model.CreateTxn,
+		ProcessTxn: model.ProcessTxn,
+
+		TxnRead:         model.TxnRead,
+		TxnCreated:      model.TxnCreated,
+		TxnCreateFailed: model.TxnCreateFailed,
+		ReportWritten:   model.DataWritten,
+
+		IdleTimeoutSec:               settledIdleTimeoutSec,
+		ReportWrittenEventTimeoutSec: 3600,
+	}
+}
+
+// routinesRunCfg provides config of all routines on bus, built
+// from domain_test#ConfigProvider, reading input from r and
+// writing report to w. Process-manager is configured as by
+// #processMgrRunCfg.
+func routinesRunCfg(bus eventutil.Bus, r io.Reader, w io.Writer) *RoutinesCfg {
+	cfgProvider := domain_test.ConfigProvider{}
+	accountCfg, err := cfgProvider.AccountRunCfg(bus)
+	Expect(err).ToNot(HaveOccurred())
+	accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+	txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+	Expect(err).ToNot(HaveOccurred())
+	writerCfg, err := cfgProvider.WriterRunCfg(bus, w)
+	Expect(err).ToNot(HaveOccurred())
+
+	return &RoutinesCfg{
+		Log: logger.NewStdLogger("runner"),
+		ReaderCfg: &reader.Cfg{
+			Log:      logger.NewStdLogger("reader"),
+			Bus:      bus,
+			Reader:   r,
+			DataRead: model.TxnRead,
+		},
+		TxnCreatorCfg:  txnCreatorCfg,
+		AccountCfg:     accountCfg,
+		AccountViewCfg: accountViewCfg,
+		ProcessMgrCfg:  processMgrRunCfg(bus, accountViewCfg.ResultViewCfg.ResultRepo),
+		WriterCfg:      writerCfg,
+	}
+}
+
+// newRecoveryBus creates bus retaining drained messages, for runs
+// writing these to recovery-output. Delivery is queued, so
+// publishing to a stalled subscription doesn't block.
+func newRecoveryBus() *eventutil.MemoryBus {
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		Log:              logger.NewStdLogger("EventBus"),
+		PriorityDelivery: true,
+		RetainDrained:    true,
+	})
+	Expect(err).ToNot(HaveOccurred())
+	return bus
+}
+
+// runRoutinesSettled runs routines with process-manager driven
+// by fakeClock instead of wall-clock, so its idle-timeout can't
+// expire while lines are still being processed. Clock is only
+// advanced (by idle-timeout) once isSettled returns true, such
+// as once every line has a result, and process-manager received
+// results of all transaction-requests (see #createResultsReceived),
+// so draining never times out on results still in flight. Clock
+// is then advanced until routines return, or timeout elapses.
+// Report-written timeout of process-manager should hence be
+// well beyond idle-timeout.
+func runRoutinesSettled(
+	cfg *RoutinesCfg,
+	fakeClock *clock.FakeClock,
+	isSettled func() bool,
+	timeout time.Duration,
+) (*RunSummary, error) {
+	cfg.ProcessMgrCfg.Clock = fakeClock
+	idleTimeout := time.Duration(cfg.ProcessMgrCfg.IdleTimeoutSec) * time.Second
+
+	type runResult struct {
+		summary *RunSummary
+		err     error
+	}
+	resultSig := make(chan runResult, 1)
+	go func() {
+		summary, err := RunRoutines(cfg)
+		resultSig <- runResult{summary: summary, err: err}
+	}()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeoutSig := time.After(timeout)
+	for {
+		select {
+		case result := <-resultSig:
+			return result.summary, result.err
+		case <-timeoutSig:
+			Fail("routines did not return within " + timeout.String())
+			return nil, nil
+		case <-ticker.C:
+			if isSettled() && createResultsReceived(cfg.ProcessMgrCfg) {
+				fakeClock.Advance(idleTimeout)
+			}
+		}
+	}
+}
+
+// createResultsReceived returns true if txn-creator published
+// a result for every transaction-request, and process-manager
+// received all of these. Always true if Bus doesn't provide
+// stats (see eventutil.BusIntrospector).
+func createResultsReceived(cfg *ProcessMgrCfg) bool {
+	introspector, ok := cfg.Bus.(eventutil.BusIntrospector)
+	if !ok {
+		return true
+	}
+	stats := introspector.SubscriptionStats()
+
+	var numResults int64
+	resultActions := []model.EventAction{cfg.TxnCreated, cfg.TxnCreateFailed, cfg.TxnSkipped}
+	for _, action := range resultActions {
+		actionStats := stats[action.String()]
+		if actionStats.Buffered > 0 {
+			return false
+		}
+		numResults += actionStats.Published
+	}
+	return numResults >= stats[cfg.CreateTxn.String()].Published
+}
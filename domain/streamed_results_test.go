@@ -0,0 +1,195 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain/writer"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Streamed results", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	reqs := []txn.CreateTxnReq{
+		{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+		{ID: "2", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+		{ID: "3", CustomerID: "1", LoadAmount: "$6000", Time: "2000-01-05T02:00:00Z"},
+		{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+		{ID: "4", CustomerID: "3", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+		{ID: "5", CustomerID: "2", LoadAmount: "$20", Time: "2000-01-06T03:00:00Z"},
+	}
+
+	// run runs routines on reqs, with results streamed if
+	// stream is set. Returns written output, and data of
+	// streamed write-commands, in order these were published.
+	run := func(
+		reqs []txn.CreateTxnReq,
+		stream bool,
+		withHeader bool,
+	) (string, []string) {
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		defer bus.Terminate()
+
+		writeSub, err := eventutil.SubscribeCmds(bus, model.WriteData)
+		Expect(err).ToNot(HaveOccurred())
+		lock := &sync.Mutex{}
+		streamed := make([]string, 0)
+		go func() {
+			for cmd := range writeSub {
+				if cmd.CorrelationKey() != StreamCorrelationKey {
+					continue
+				}
+				data := bytes.TrimPrefix(cmd.RawData(), []byte(writer.PayloadMagic))
+				payload := &writer.Payload{}
+				if json.Unmarshal(data, payload) != nil {
+					continue
+				}
+				lock.Lock()
+				streamed = append(streamed, string(payload.Data))
+				lock.Unlock()
+			}
+		}()
+
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader(reqs)
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter := domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		if stream {
+			accountViewCfg.OnResults = NewResultStreamer(bus, model.WriteData)
+		}
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				FailOnEmptyInput: withHeader,
+				PayloadEnvelope:  true,
+				StreamedResults:  stream,
+			},
+			WriterCfg: writerCfg,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		lock.Lock()
+		defer lock.Unlock()
+		return string(ioWriter.Content()), append([]string{}, streamed...)
+	}
+
+	// Order of results of different customers
+	// varies between runs, so only their sets
+	// are compared across runs.
+	lines := func(output string) []string {
+		return strings.Split(strings.TrimSpace(output), "\n")
+	}
+
+	It("writes results as these're recorded, same as report", func(done Done) {
+		report, reportStreamed := run(reqs, false, false)
+		Expect(reportStreamed).To(BeEmpty())
+
+		output, streamed := run(reqs, true, false)
+		Expect(streamed).ToNot(BeEmpty())
+		Expect(lines(output)).To(ConsistOf(lines(report)))
+
+		// Streamed writes make up the output in order these
+		// were sent, with every result written once.
+		Expect(strings.Join(streamed, "\n")).To(Equal(strings.TrimSpace(output)))
+		Expect(lines(output)).To(HaveLen(len(reqs)))
+		for _, line := range lines(output) {
+			entry := accountview.TxnResultEntry{}
+			Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+		}
+
+		close(done)
+	}, 2*(processMgrIdleTimeoutSec+5))
+
+	It("writes report-header after streamed results", func(done Done) {
+		report, _ := run(reqs, false, true)
+		reportLines := lines(report)
+
+		output, streamed := run(reqs, true, true)
+		outputLines := lines(output)
+		Expect(outputLines).To(HaveLen(len(reportLines)))
+		// Header is moved from first line to last
+		Expect(outputLines[len(outputLines)-1]).To(Equal(reportLines[0]))
+		Expect(outputLines[:len(outputLines)-1]).To(ConsistOf(reportLines[1:]))
+		Expect(strings.Join(streamed, "\n")).To(Equal(strings.Join(outputLines[:len(outputLines)-1], "\n")))
+
+		close(done)
+	}, 2*(processMgrIdleTimeoutSec+5))
+
+	It("requires report not to be sorted by input-order", func() {
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		defer bus.Terminate()
+
+		cfg := &ProcessMgrCfg{
+			Log: logger.NewStdLogger("ProcessMgr"),
+			Bus: bus,
+			TxnResultViewRepo: accountview.NewMemoryTxnResultViewRepo(
+				accountview.MemoryTxnResultViewRepoCfg{},
+			),
+
+			WriteData:  model.WriteData,
+			CreateTxn:  model.CreateTxn,
+			ProcessTxn: model.ProcessTxn,
+
+			TxnRead:         model.TxnRead,
+			TxnCreated:      model.TxnCreated,
+			TxnCreateFailed: model.TxnCreateFailed,
+			ReportWritten:   model.DataWritten,
+
+			IdleTimeoutSec:               processMgrIdleTimeoutSec,
+			ReportWrittenEventTimeoutSec: 3,
+
+			StreamedResults: true,
+		}
+		Expect(cfg.Validate()).To(Succeed())
+		cfg.ReportSort = ReportSortInputOrder
+		Expect(cfg.Validate()).To(HaveOccurred())
+	})
+})
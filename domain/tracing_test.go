@@ -0,0 +1,146 @@
+package domain
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+	"github.com/Jaskaranbir/es-bank-account/trace"
+)
+
+// tickingClock is a FakeClock which advances by a
+// millisecond whenever its time is read, so every
+// timestamp is distinct and follows call-order.
+type tickingClock struct {
+	*clock.FakeClock
+}
+
+func (c tickingClock) Now() time.Time {
+	c.FakeClock.Advance(time.Millisecond)
+	return c.FakeClock.Now()
+}
+
+var _ = Describe("Tracing", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	var bus eventutil.Bus
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("joins spans of every stage into a trace per transaction", func(done Done) {
+		tracer := trace.NewRecorder(tickingClock{
+			FakeClock: clock.NewFakeClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)),
+		})
+
+		cfgProvider := domain_test.ConfigProvider{}
+		ioReader, err := domain_test.NewMockReader([]txn.CreateTxnReq{
+			{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			{ID: "2", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+			// Exceeds daily-limits
+			{ID: "3", CustomerID: "1", LoadAmount: "$6000", Time: "2000-01-05T02:00:00Z"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountCfg.AccountCfg.Tracer = tracer
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		accountViewCfg.ResultViewCfg.Tracer = tracer
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		txnCreatorCfg.CreatorCfg.Tracer = tracer
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg.WriterCfg.Tracer = tracer
+
+		recorder, err := testsupport.NewBusRecorder(bus, model.TxnRead.String())
+		Expect(err).ToNot(HaveOccurred())
+		defer recorder.Stop()
+
+		_, err = RunRoutines(&RoutinesCfg{
+			Log: logger.NewStdLogger("runner"),
+			ReaderCfg: &reader.Cfg{
+				Log:      logger.NewStdLogger("reader"),
+				Bus:      bus,
+				Reader:   ioReader,
+				DataRead: model.TxnRead,
+				Tracer:   tracer,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				IdleTimeoutSec:               processMgrIdleTimeoutSec,
+				ReportWrittenEventTimeoutSec: 3,
+
+				Tracer: tracer,
+			},
+			WriterCfg: writerCfg,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		reads := recorder.Messages(model.TxnRead.String())
+		Expect(reads).To(HaveLen(3))
+		for _, msg := range reads {
+			spans := tracer.Trace(msg.(model.Event).ID())
+
+			names := make([]string, 0)
+			for _, span := range spans {
+				names = append(names, span.Name)
+			}
+			Expect(names).To(Equal([]string{
+				trace.SpanRead,
+				trace.SpanCreate,
+				trace.SpanProcess,
+				trace.SpanViewInsert,
+				trace.SpanWrite,
+			}))
+			for i, span := range spans {
+				Expect(span.Start).To(BeTemporally("<", span.End))
+				if i > 0 {
+					Expect(spans[i-1].End).To(BeTemporally("<", span.Start))
+				}
+			}
+		}
+
+		reportWrites := 0
+		for _, span := range tracer.Spans() {
+			if span.Name == trace.SpanReportWrite {
+				reportWrites++
+			}
+		}
+		Expect(reportWrites).To(Equal(1))
+
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+})
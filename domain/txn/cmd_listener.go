@@ -16,9 +16,14 @@ type cmdListener struct {
 
 	bus          eventutil.Bus
 	createTxnCmd model.CmdAction
-	cmdSubs      map[model.CmdAction]<-chan interface{}
+	cmdSubs      map[model.CmdAction]<-chan model.Cmd
+	flowEpoch    *eventutil.FlowEpoch
+	stats        *eventutil.ComponentStats
 
 	creatorCfg *CreatorCfg
+	// Shared by creators of every command, so
+	// content-duplicates are found across run.
+	contentHashes contentHashes
 }
 
 // CmdListenerCfg is config for command-listener.
@@ -27,6 +32,11 @@ type CmdListenerCfg struct {
 
 	Bus          eventutil.Bus   `validate:"nonnil"`
 	CreateTxnCmd model.CmdAction `validate:"nonzero"`
+	// Optional. If set, create-transaction commands
+	// from an older flow-epoch are rejected.
+	FlowEpoch *eventutil.FlowEpoch
+	// Optional, counts commands handled by listener.
+	Stats *eventutil.ComponentStats
 
 	CreatorCfg *CreatorCfg `validate:"nonnil"`
 }
@@ -43,8 +53,8 @@ func InitCmdListener(ctx context.Context, cfg *CmdListenerCfg) error {
 	}
 
 	// Subscribe to actions from Bus
-	cmdSubs := make(map[model.CmdAction]<-chan interface{})
-	cmdSubs[cfg.CreateTxnCmd], err = cfg.Bus.Subscribe(cfg.CreateTxnCmd.String())
+	cmdSubs := make(map[model.CmdAction]<-chan model.Cmd)
+	cmdSubs[cfg.CreateTxnCmd], err = eventutil.SubscribeCmds(cfg.Bus, cfg.CreateTxnCmd)
 	if err != nil {
 		return errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.CreateTxnCmd)
 	}
@@ -57,8 +67,11 @@ func InitCmdListener(ctx context.Context, cfg *CmdListenerCfg) error {
 		bus:          cfg.Bus,
 		createTxnCmd: cfg.CreateTxnCmd,
 		cmdSubs:      cmdSubs,
+		flowEpoch:    cfg.FlowEpoch,
+		stats:        cfg.Stats,
 
-		creatorCfg: cfg.CreatorCfg,
+		creatorCfg:    cfg.CreatorCfg,
+		contentHashes: newContentHashes(cfg.CreatorCfg),
 	}
 	err = listener.start(ctx)
 	return errors.Wrap(err, "listener-routine exited with error")
@@ -77,17 +90,12 @@ func (cl *cmdListener) start(ctx context.Context) error {
 			}
 			return err
 
-		case msg := <-cl.cmdSubs[cl.createTxnCmd]:
-			// Validate message
-			if msg == nil {
-				continue
-			}
-			cmd, castSuccess := msg.(model.Cmd)
-			if !castSuccess {
-				cl.log.Warnf("error casting message to command")
-				continue
+		case cmd, ok := <-cl.cmdSubs[cl.createTxnCmd]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(cl.createTxnCmd.String())
 			}
-			if cmd.Data() == nil {
+			if cmd.RawData() == nil || !cl.admitEpoch(cmd) {
+				cl.stats.IncIgnored()
 				continue
 			}
 
@@ -96,14 +104,29 @@ func (cl *cmdListener) start(ctx context.Context) error {
 			if err != nil {
 				return errors.Wrap(err, "error creating transaction-creator instance")
 			}
+			tc.contentHashes = cl.contentHashes
 			err = tc.handleCreateTxnCmd(cmd)
 			if err != nil {
 				return errors.Wrap(err, "error handling command")
 			}
+			cl.stats.IncProcessed()
 		}
 	}
 }
 
+// admitEpoch returns false if command was
+// issued in an older flow-epoch than current.
+func (cl *cmdListener) admitEpoch(cmd model.Cmd) bool {
+	if cl.flowEpoch == nil || cl.flowEpoch.Admit(cmd.Epoch()) {
+		return true
+	}
+	cl.log.Warnf(
+		"[CMD-Action: %s]: [CMD: %s]: Rejected late command from flow-epoch: %d (current: %d)",
+		cmd.Action(), cmd.ID(), cmd.Epoch(), cl.flowEpoch.Current(),
+	)
+	return false
+}
+
 func (cl *cmdListener) unsubscribe() error {
 	for action, channel := range cl.cmdSubs {
 		// Already unsubscribed
@@ -112,7 +135,7 @@ func (cl *cmdListener) unsubscribe() error {
 		}
 
 		cl.log.Debugf("Unsubscribing from action: %s", action)
-		err := cl.bus.Unsubscribe(channel, action.String())
+		err := eventutil.UnsubscribeCmds(cl.bus, channel, action)
 		if err != nil {
 			return errors.Wrapf(err, "error unsubscribing from event-bus for action: %s", action)
 		}
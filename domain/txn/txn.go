@@ -1,6 +1,7 @@
 package txn
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/trace"
 )
 
 // creator handles validating commands and
@@ -20,13 +22,26 @@ import (
 // those commands.
 // Use #newCreator to create new instance.
 type creator struct {
-	defaultTimeFmt string
+	defaultTimeFmt      string
+	maxAmountDecimals   int
+	strictTimeRoundTrip bool
+	// Nil if content-duplicates aren't rejected
+	contentHashes    contentHashes
+	zeroAmountPolicy ZeroAmountPolicy
+	currencySymbol   string
+	// Nil if customer-IDs aren't normalized
+	normalizeCustomerID func(custID string) string
+	validators          []TxnValidator
 
 	log       logger.Logger
 	eventRepo eventutil.EventRepo
 
 	txnCreated      model.EventAction
 	txnCreateFailed model.EventAction
+	// Set if zero-amounts are skipped
+	txnSkipped model.EventAction
+
+	tracer trace.Tracer
 }
 
 // CreateTxnReq represents the request from which
@@ -37,6 +52,8 @@ type CreateTxnReq struct {
 	LoadAmount string `json:"load_amount"`
 	Time       string `json:"time"`
 	TimeFmt    string `json:"time_format"`
+	IsTest     bool   `json:"is_test,omitempty"`
+	Category   string `json:"category,omitempty"`
 }
 
 // CreateTxnFailure is failure during transaction-creation.
@@ -45,15 +62,135 @@ type CreateTxnFailure struct {
 	Error  string        `json:"error"`
 }
 
+// TxnSkip is data of TxnSkipped event, published instead
+// of TxnCreated for transactions which aren't processed,
+// such as for zero load-amount (see ZeroAmountSkip).
+type TxnSkip struct {
+	Txn    *model.Transaction `json:"txn"`
+	Reason string             `json:"reason"`
+}
+
+// ZeroAmountPolicy is how txn-creator handles
+// transactions with zero load-amount.
+type ZeroAmountPolicy string
+
+// Policies for zero load-amounts.
+const (
+	// Transaction is created, same as any other amount
+	ZeroAmountAllow ZeroAmountPolicy = "allow"
+	// Transaction fails creation with ZeroAmount code
+	ZeroAmountReject ZeroAmountPolicy = "reject"
+	// TxnSkipped event is published instead of TxnCreated,
+	// so transaction isn't processed by account, but still
+	// has a (skipped) result.
+	ZeroAmountSkip ZeroAmountPolicy = "skip"
+)
+
+// FailureCode classifies why a transaction-request is invalid.
+type FailureCode string
+
+// Codes for invalid transaction-requests.
+const (
+	MalformedReq      FailureCode = "malformed_request"
+	MissingTxnID      FailureCode = "missing_txn_id"
+	MissingCustomerID FailureCode = "missing_customer_id"
+	InvalidLoadAmount FailureCode = "invalid_load_amount"
+	InvalidTime       FailureCode = "invalid_time"
+	ExcessPrecision   FailureCode = "excess_amount_precision"
+	// Time doesn't match its time-format when formatted back,
+	// so parts of it were either ignored or parsed leniently.
+	TimeFormatAmbiguous FailureCode = "time_format_ambiguous"
+	// Transaction has same customer, amount and time as an
+	// earlier transaction with different ID in run.
+	DuplicateContent FailureCode = "duplicate_content"
+	// Load-amount is zero, and zero-amounts are rejected
+	ZeroAmount FailureCode = "zero_amount"
+	// Transaction was rejected by a validator of
+	// txn-creator (see CreatorCfg#Validators).
+	RejectedByValidator FailureCode = "rejected_by_validator"
+)
+
+// DefaultCurrencySymbol is currency-symbol
+// load-amounts are prefixed with by default.
+const DefaultCurrencySymbol = "$"
+
+// TimeFmtEpochSeconds is a time-format for times specified as
+// seconds since Unix-epoch (such as "946684800"), which are
+// parsed as UTC-times. Can be used wherever a time-format
+// is accepted, such as in CreateTxnReq#TimeFmt.
+const TimeFmtEpochSeconds = "epoch_seconds"
+
+// TxnValidator validates transactions created by txn-creator.
+// Transactions for which it returns an error fail creation,
+// with code RejectedByValidator unless error is *CreateTxnError.
+type TxnValidator func(txn *model.Transaction) error
+
+// timeFmtReferenceTime is formatted and parsed back by
+// txn-creator to check default time-format. Day is over 12
+// and every part is distinct, so none can be mistaken for
+// another.
+var timeFmtReferenceTime = time.Date(2001, 2, 13, 14, 25, 36, 0, time.UTC)
+
+// CreateTxnError is returned when a transaction
+// cannot be created from a transaction-request.
+type CreateTxnError struct {
+	Code  FailureCode
+	Cause error
+}
+
+func (e *CreateTxnError) Error() string {
+	return e.Cause.Error()
+}
+
+// Unwrap returns underlying error.
+func (e *CreateTxnError) Unwrap() error {
+	return e.Cause
+}
+
 // CreatorCfg is config for txnCreator.
 type CreatorCfg struct {
 	DefaultTimeFmt string `validate:"nonzero"`
+	// Optional, load-amounts with more decimal places
+	// (such as "$4528.201" for 2) are rejected. Set to
+	// 0 to disable.
+	MaxAmountDecimals int `validate:"min=0"`
+	// Optional, transaction-times are formatted back with
+	// their time-format, and rejected if result doesn't match
+	// time (ignoring case), such as for "2000-01-05T01:00:00.5Z"
+	// with format "2006-01-02T15:04:05Z".
+	StrictTimeRoundTrip bool
+	// Optional, transactions with same customer, load-amount
+	// and time as a transaction created earlier in run, but
+	// a different ID, are rejected, such as for accidental
+	// re-submissions. Transactions with same ID are left to
+	// account's duplicate-detection. A hash of every created
+	// transaction is kept for the run.
+	RejectContentDuplicates bool
+	// Optional, defaults to ZeroAmountAllow.
+	// ZeroAmountSkip requires TxnSkipped.
+	ZeroAmountPolicy ZeroAmountPolicy
+	// Optional, symbol load-amounts are prefixed
+	// with. Defaults to DefaultCurrencySymbol.
+	CurrencySymbol string
+	// Optional, customer-IDs of transaction-requests are
+	// replaced with result of this, such as for trimming
+	// spaces. Blank results fail creation.
+	NormalizeCustomerID func(custID string) string
+	// Optional, applied in order to every created transaction.
+	Validators []TxnValidator
 
 	Log       logger.Logger       `validate:"nonnil"`
 	EventRepo eventutil.EventRepo `validate:"nonnil"`
 
 	TxnCreated      model.EventAction `validate:"nonzero"`
 	TxnCreateFailed model.EventAction `validate:"nonzero"`
+	// Optional, published with TxnSkip as data
+	// for transactions which are skipped.
+	TxnSkipped model.EventAction
+
+	// Optional, records span of creating every
+	// transaction, keyed by command's correlation.
+	Tracer trace.Tracer
 }
 
 // newCreator validates txnCreator-config
@@ -63,28 +200,62 @@ func newCreator(cfg *CreatorCfg) (*creator, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = CheckTimeFmt(cfg.DefaultTimeFmt)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating default time-format")
+	}
+	zeroAmountPolicy := cfg.ZeroAmountPolicy
+	switch zeroAmountPolicy {
+	case "":
+		zeroAmountPolicy = ZeroAmountAllow
+	case ZeroAmountAllow, ZeroAmountReject:
+	case ZeroAmountSkip:
+		if cfg.TxnSkipped == "" {
+			return nil, errors.New("skipping zero-amounts requires txn-skipped action")
+		}
+	default:
+		return nil, fmt.Errorf("invalid zero-amount policy: %s", zeroAmountPolicy)
+	}
+
+	currencySymbol := cfg.CurrencySymbol
+	if currencySymbol == "" {
+		currencySymbol = DefaultCurrencySymbol
+	}
 
 	return &creator{
-		defaultTimeFmt: cfg.DefaultTimeFmt,
+		defaultTimeFmt:      cfg.DefaultTimeFmt,
+		maxAmountDecimals:   cfg.MaxAmountDecimals,
+		strictTimeRoundTrip: cfg.StrictTimeRoundTrip,
+		contentHashes:       newContentHashes(cfg),
+		zeroAmountPolicy:    zeroAmountPolicy,
+		currencySymbol:      currencySymbol,
+		normalizeCustomerID: cfg.NormalizeCustomerID,
+		validators:          cfg.Validators,
 
 		log:             cfg.Log,
 		eventRepo:       cfg.EventRepo,
 		txnCreated:      cfg.TxnCreated,
 		txnCreateFailed: cfg.TxnCreateFailed,
+		txnSkipped:      cfg.TxnSkipped,
+
+		tracer: trace.OrNoop(cfg.Tracer),
 	}, nil
 }
 
 func (tc *creator) handleCreateTxnCmd(cmd model.Cmd) error {
-	if cmd.Data() == nil {
+	if cmd.RawData() == nil {
 		return nil
 	}
 	logPrefix := fmt.Sprintf("[CMD-Action: %s]: [CMD: %s]:", cmd.Action(), cmd.ID())
 	tc.log.Tracef("%s Creating transaction", logPrefix)
+	// Also ended before publishing result,
+	// so span doesn't overlap with next stage.
+	span := tc.tracer.StartSpan(trace.SpanCreate, cmd.CorrelationKey())
+	defer span.End()
 
-	req := &CreateTxnReq{}
-	err := json.Unmarshal(cmd.Data(), req)
+	req, err := ParseTxnReq(cmd.RawData())
 	if err != nil {
-		return errors.Wrapf(err, "error unmarshalling transaction-req from event-data: %s", string(cmd.Data()))
+		return errors.Wrapf(err, "error unmarshalling transaction-req from event-data: %s", string(cmd.RawData()))
 	}
 
 	// Create transaction from transaction-request
@@ -101,34 +272,55 @@ func (tc *creator) handleCreateTxnCmd(cmd model.Cmd) error {
 		event, err := model.NewEvent(&model.EventCfg{
 			// txn is nil, so cant get aggregate-id
 			AggregateID:    "-",
-			CorrelationKey: cmd.ID(),
+			CausationID:    cmd.CausationID(),
+			CausationKey:   cmd.ID(),
+			CorrelationKey: cmd.CorrelationKey(),
+			IsReplay:       cmd.IsReplay(),
+			InputSeq:       cmd.InputSeq(),
 			Action:         tc.txnCreateFailed,
 			Data:           txnFail,
 		})
 		if err != nil {
 			return errors.Wrap(err, "error creating event")
 		}
+		span.End()
 		pubErr := tc.eventRepo.InsertAndPublish(event)
 		if pubErr == nil {
 			tc.log.Tracef("%s Published fail-result event", logPrefix)
 		}
-		return errors.Wrap(pubErr, "error publishing fail-event")
+		return errors.Wrap(eventutil.MarkFatal(pubErr), "error publishing fail-event")
 	}
+	txn.InputSeq = cmd.InputSeq()
 
-	// Publish transaction-created event
+	// Publish transaction-created event, or
+	// skipped-event for skipped zero-amounts.
+	action := tc.txnCreated
+	var eventData interface{} = txn
+	if tc.skipsTxn(txn) {
+		action = tc.txnSkipped
+		eventData = &TxnSkip{
+			Txn:    txn,
+			Reason: "transaction has zero load-amount",
+		}
+	}
 	tc.log.Tracef("%s Publishing result event", logPrefix)
 	event, err := model.NewEvent(&model.EventCfg{
 		AggregateID:    txn.ID,
-		CorrelationKey: cmd.ID(),
-		Action:         tc.txnCreated,
-		Data:           txn,
+		CausationID:    cmd.CausationID(),
+		CausationKey:   cmd.ID(),
+		CorrelationKey: cmd.CorrelationKey(),
+		IsReplay:       cmd.IsReplay(),
+		InputSeq:       cmd.InputSeq(),
+		Action:         action,
+		Data:           eventData,
 	})
 	if err != nil {
 		return errors.Wrap(err, "error creating event")
 	}
+	span.End()
 	err = tc.eventRepo.InsertAndPublish(event)
 	if err != nil {
-		return errors.Wrap(err, "error publishing transaction on event-bus")
+		return errors.Wrap(eventutil.MarkFatal(err), "error publishing transaction on event-bus")
 	}
 	tc.log.Tracef("%s Published result event", logPrefix)
 	return nil
@@ -136,41 +328,190 @@ func (tc *creator) handleCreateTxnCmd(cmd model.Cmd) error {
 
 // createTxn returns a transaction-instance
 // using properties from given CreateTxnReq.
-// Returns error if TransactionRequest contains
-// invalid values.
 func (tc *creator) createTxn(txnReq *CreateTxnReq) (*model.Transaction, error) {
+	if tc.normalizeCustomerID != nil {
+		txnReq.CustomerID = tc.normalizeCustomerID(txnReq.CustomerID)
+	}
+	txn, err := CreateTxnWithOpts(txnReq, &CreateOpts{
+		DefaultTimeFmt: tc.defaultTimeFmt,
+		CurrencySymbol: tc.currencySymbol,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tc.maxAmountDecimals > 0 {
+		err = checkAmountPrecision(txnReq.LoadAmount, tc.currencySymbol, tc.maxAmountDecimals)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tc.strictTimeRoundTrip {
+		// CreateTxn sets default time-format if request has none
+		err = CheckTimeRoundTrip(txn.Time, txnReq.Time, txnReq.TimeFmt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tc.zeroAmountPolicy == ZeroAmountReject && txn.LoadAmount == 0 {
+		return nil, &CreateTxnError{
+			Code:  ZeroAmount,
+			Cause: errors.New("LoadAmount cannot be zero"),
+		}
+	}
+	for _, validate := range tc.validators {
+		err = validate(txn)
+		if err == nil {
+			continue
+		}
+		var createErr *CreateTxnError
+		if errors.As(err, &createErr) {
+			return nil, err
+		}
+		return nil, &CreateTxnError{Code: RejectedByValidator, Cause: err}
+	}
+	// Skipped transactions aren't recorded, since these
+	// aren't processed, and have a distinct result.
+	if tc.contentHashes != nil && !tc.skipsTxn(txn) {
+		err = tc.contentHashes.checkDuplicate(txn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return txn, nil
+}
+
+// skipsTxn returns true if transaction is
+// skipped instead of being created.
+func (tc *creator) skipsTxn(txn *model.Transaction) bool {
+	return tc.zeroAmountPolicy == ZeroAmountSkip && txn.LoadAmount == 0
+}
+
+// contentHashes maps hashes of customer, load-amount and
+// time of created transactions to their transaction-IDs.
+type contentHashes map[[sha256.Size]byte]string
+
+// newContentHashes returns empty contentHashes if config
+// rejects content-duplicates, otherwise returns nil.
+func newContentHashes(cfg *CreatorCfg) contentHashes {
+	if !cfg.RejectContentDuplicates {
+		return nil
+	}
+	return make(contentHashes)
+}
+
+// checkDuplicate returns *CreateTxnError if a transaction
+// with different ID, but same customer, load-amount and time,
+// was recorded earlier. Otherwise, transaction is recorded.
+func (h contentHashes) checkDuplicate(txn *model.Transaction) error {
+	hash := sha256.Sum256([]byte(fmt.Sprintf(
+		"%s\x00%s\x00%d",
+		txn.CustomerID,
+		strconv.FormatFloat(txn.LoadAmount, 'f', -1, 64),
+		txn.Time.UnixNano(),
+	)))
+	originalID, exists := h[hash]
+	if !exists {
+		h[hash] = txn.ID
+		return nil
+	}
+	if originalID == txn.ID {
+		return nil
+	}
+	return &CreateTxnError{
+		Code: DuplicateContent,
+		Cause: fmt.Errorf(
+			"transaction has same customer, amount and time as transaction: %s",
+			originalID,
+		),
+	}
+}
+
+// ParseTxnReq parses a transaction-request from data read
+// from input. Returns *CreateTxnError if data is malformed.
+func ParseTxnReq(data []byte) (*CreateTxnReq, error) {
+	req := &CreateTxnReq{}
+	err := json.Unmarshal(data, req)
+	if err != nil {
+		return nil, &CreateTxnError{Code: MalformedReq, Cause: err}
+	}
+	return req, nil
+}
+
+// CreateOpts are options for parsing transaction-requests.
+type CreateOpts struct {
+	// Used if request doesn't specify a time-format
+	DefaultTimeFmt string
+	// Optional, defaults to DefaultCurrencySymbol
+	CurrencySymbol string
+}
+
+// CreateTxn returns a transaction-instance using properties
+// from given CreateTxnReq, parsing its time with defaultTimeFmt
+// if the request doesn't specify a time-format. Returns
+// *CreateTxnError if CreateTxnReq contains invalid values.
+// This is same validation as used by transaction-creator,
+// so input can be validated without running it.
+func CreateTxn(txnReq *CreateTxnReq, defaultTimeFmt string) (*model.Transaction, error) {
+	return CreateTxnWithOpts(txnReq, &CreateOpts{DefaultTimeFmt: defaultTimeFmt})
+}
+
+// CreateTxnWithOpts is same as #CreateTxn, but
+// also allows setting currency-symbol of amounts.
+func CreateTxnWithOpts(txnReq *CreateTxnReq, opts *CreateOpts) (*model.Transaction, error) {
+	if opts == nil {
+		return nil, errors.New("options cannot be nil")
+	}
+	currencySymbol := opts.CurrencySymbol
+	if currencySymbol == "" {
+		currencySymbol = DefaultCurrencySymbol
+	}
 	if txnReq == nil {
 		return nil, errors.New("TransactionRequest cannot be nil")
 	}
 
 	// Assuming ID "0" is valid
 	if txnReq.ID == "" {
-		return nil, errors.New("TransactionID cannot be empty")
+		return nil, &CreateTxnError{
+			Code:  MissingTxnID,
+			Cause: errors.New("TransactionID cannot be empty"),
+		}
 	}
 
 	// Assuming CustomerID "0" is valid
 	if txnReq.CustomerID == "" {
-		return nil, errors.New("CustomerID cannot be empty")
+		return nil, &CreateTxnError{
+			Code:  MissingCustomerID,
+			Cause: errors.New("CustomerID cannot be empty"),
+		}
 	}
 
 	// ============== Validate LoadAmount ==============
-	// "[1:]" removes the "$" prefix from string
-	if txnReq.LoadAmount == "" || txnReq.LoadAmount[1:] == "" {
-		return nil, errors.New("LoadAmount cannot be empty")
+	// Removes currency-symbol prefix from string
+	if txnReq.LoadAmount == "" || strings.TrimPrefix(txnReq.LoadAmount, currencySymbol) == "" {
+		return nil, &CreateTxnError{
+			Code:  InvalidLoadAmount,
+			Cause: errors.New("LoadAmount cannot be empty"),
+		}
 	}
-	loadAmountStr := strings.ReplaceAll(txnReq.LoadAmount, "$", "")
+	loadAmountStr := strings.ReplaceAll(txnReq.LoadAmount, currencySymbol, "")
 	loadAmount, err := strconv.ParseFloat(loadAmountStr, 64)
 	if err != nil {
-		return nil, errors.New("invalid value for LoadAmount")
+		return nil, &CreateTxnError{
+			Code:  InvalidLoadAmount,
+			Cause: errors.New("invalid value for LoadAmount"),
+		}
 	}
 
 	// ============== Validate Time ==============
 	if txnReq.TimeFmt == "" {
-		txnReq.TimeFmt = tc.defaultTimeFmt
+		txnReq.TimeFmt = opts.DefaultTimeFmt
 	}
-	parsedTime, err := time.Parse(txnReq.TimeFmt, txnReq.Time)
+	parsedTime, err := ParseTime(txnReq.TimeFmt, txnReq.Time)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing time")
+		return nil, &CreateTxnError{
+			Code:  InvalidTime,
+			Cause: errors.Wrap(err, "error parsing time"),
+		}
 	}
 
 	return &model.Transaction{
@@ -178,5 +519,110 @@ func (tc *creator) createTxn(txnReq *CreateTxnReq) (*model.Transaction, error) {
 		CustomerID: txnReq.CustomerID,
 		LoadAmount: loadAmount,
 		Time:       parsedTime,
+		IsTest:     txnReq.IsTest,
+		Category:   txnReq.Category,
 	}, nil
 }
+
+// CheckAmountPrecision returns *CreateTxnError if load-amount
+// (as in CreateTxnReq) has more than provided decimal places.
+// Trailing zeros aren't counted, so "$10.500" has 1 decimal
+// place. Load-amount must otherwise be valid (see #CreateTxn).
+func CheckAmountPrecision(loadAmount string, maxDecimals int) error {
+	return checkAmountPrecision(loadAmount, DefaultCurrencySymbol, maxDecimals)
+}
+
+// checkAmountPrecision is #CheckAmountPrecision
+// for amounts with provided currency-symbol.
+func checkAmountPrecision(loadAmount string, currencySymbol string, maxDecimals int) error {
+	amount := strings.ToLower(strings.ReplaceAll(loadAmount, currencySymbol, ""))
+	// Exponent shifts decimal places, such as "1.5e-1"
+	exponent := 0
+	if expIndex := strings.Index(amount, "e"); expIndex != -1 {
+		var err error
+		exponent, err = strconv.Atoi(amount[expIndex+1:])
+		if err != nil {
+			return &CreateTxnError{
+				Code:  InvalidLoadAmount,
+				Cause: errors.New("invalid value for LoadAmount"),
+			}
+		}
+		amount = amount[:expIndex]
+	}
+
+	decimals := 0
+	if dotIndex := strings.Index(amount, "."); dotIndex != -1 {
+		decimals = len(strings.TrimRight(amount[dotIndex+1:], "0"))
+	}
+	decimals -= exponent
+	if decimals > maxDecimals {
+		return &CreateTxnError{
+			Code: ExcessPrecision,
+			Cause: fmt.Errorf(
+				"LoadAmount has %d decimal places, at most %d are allowed",
+				decimals, maxDecimals,
+			),
+		}
+	}
+	return nil
+}
+
+// CheckTimeRoundTrip returns *CreateTxnError if parsedTime, formatted
+// with timeFmt, doesn't match (ignoring case) timeStr it was parsed
+// from. time.Parse accepts some inputs its format can't represent,
+// such as fractional seconds, or unpadded numbers, which are lost if
+// accepted.
+func CheckTimeRoundTrip(parsedTime time.Time, timeStr string, timeFmt string) error {
+	formatted := FormatTime(parsedTime, timeFmt)
+	if !strings.EqualFold(formatted, timeStr) {
+		return &CreateTxnError{
+			Code: TimeFormatAmbiguous,
+			Cause: fmt.Errorf(
+				"time %q doesn't match time-format %q, formats back as %q",
+				timeStr, timeFmt, formatted,
+			),
+		}
+	}
+	return nil
+}
+
+// CheckTimeFmt returns error if a time formatted with timeFmt
+// doesn't parse back to same time, such as for formats missing
+// parts of time (like seconds), or not using Go's reference
+// time (like "yyyy-MM-dd").
+func CheckTimeFmt(timeFmt string) error {
+	formatted := FormatTime(timeFmtReferenceTime, timeFmt)
+	parsedTime, err := ParseTime(timeFmt, formatted)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing time formatted with time-format %q", timeFmt)
+	}
+	if !parsedTime.Equal(timeFmtReferenceTime) {
+		return fmt.Errorf(
+			"time-format %q doesn't round-trip: %s is formatted as %q, and parsed as %s",
+			timeFmt, timeFmtReferenceTime, formatted, parsedTime,
+		)
+	}
+	return nil
+}
+
+// ParseTime parses timeStr with time-format, which is either
+// a layout (see time.Parse) or TimeFmtEpochSeconds.
+func ParseTime(timeFmt string, timeStr string) (time.Time, error) {
+	if timeFmt != TimeFmtEpochSeconds {
+		return time.Parse(timeFmt, timeStr)
+	}
+	seconds, err := strconv.ParseInt(timeStr, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "error parsing epoch-seconds")
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// FormatTime formats t with time-format, which is either
+// a layout (see time.Time#Format) or TimeFmtEpochSeconds.
+func FormatTime(t time.Time, timeFmt string) string {
+	if timeFmt != TimeFmtEpochSeconds {
+		return t.Format(timeFmt)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
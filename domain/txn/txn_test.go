@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -170,6 +171,51 @@ var _ = Describe("Creator", func() {
 				Expect(createdTxn.ID).To(Equal(req.ID))
 				Expect(createdTxn.CustomerID).To(Equal(req.CustomerID))
 			})
+
+			Specify("test-transaction", func() {
+				req := &CreateTxnReq{
+					ID:         "43583",
+					CustomerID: "37648",
+					LoadAmount: "$4528.20",
+					Time:       time.Now().Format(txnReqTimeFmt),
+					IsTest:     true,
+				}
+				cmd, err := model.NewCmd(&model.CmdCfg{
+					Action: CreateTxn,
+					Data:   req,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				err = txnCreator.handleCreateTxnCmd(cmd)
+				Expect(err).ToNot(HaveOccurred())
+
+				createdTxn, err := expectEvent(successSub, failSub, TxnCreated)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(createdTxn.ID).To(Equal(req.ID))
+				Expect(createdTxn.IsTest).To(BeTrue())
+			})
+
+			Specify("categorized transaction", func() {
+				req := &CreateTxnReq{
+					ID:         "43584",
+					CustomerID: "37648",
+					LoadAmount: "$4528.20",
+					Time:       time.Now().Format(txnReqTimeFmt),
+					Category:   "ATM",
+				}
+				cmd, err := model.NewCmd(&model.CmdCfg{
+					Action: CreateTxn,
+					Data:   req,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				err = txnCreator.handleCreateTxnCmd(cmd)
+				Expect(err).ToNot(HaveOccurred())
+
+				createdTxn, err := expectEvent(successSub, failSub, TxnCreated)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(createdTxn.Category).To(Equal("ATM"))
+			})
 		})
 
 		It("errors on empty transaction-request", func() {
@@ -301,4 +347,434 @@ var _ = Describe("Creator", func() {
 			Expect(createdTxn.CustomerID).To(Equal(req.CustomerID))
 		})
 	})
+
+	When("amount-precision is limited", func() {
+		BeforeEach(func() {
+			txnCreator.maxAmountDecimals = 2
+		})
+
+		var handleAmount = func(loadAmount string) {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action: CreateTxn,
+				Data: &CreateTxnReq{
+					ID:         "43583",
+					CustomerID: "37648",
+					LoadAmount: loadAmount,
+					Time:       time.Now().Format(txnReqTimeFmt),
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = txnCreator.handleCreateTxnCmd(cmd)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("accepts amounts with two decimal places", func() {
+			handleAmount("$4528.20")
+			createdTxn, err := expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.LoadAmount).To(Equal(4528.2))
+		})
+
+		It("accepts integer amounts", func() {
+			handleAmount("-$4528")
+			createdTxn, err := expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.LoadAmount).To(Equal(float64(-4528)))
+		})
+
+		It("rejects amounts with three decimal places", func() {
+			handleAmount("$4528.201")
+			_, err := expectEvent(successSub, failSub, TxnCreateFailed)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("counts decimal places ignoring trailing zeros and exponents", func() {
+			Expect(CheckAmountPrecision("$4528.2000", 2)).To(Succeed())
+			Expect(CheckAmountPrecision("$4.5282e3", 2)).To(Succeed())
+			Expect(CheckAmountPrecision("$1e2", 0)).To(Succeed())
+
+			err := CheckAmountPrecision("$45.28201e2", 2)
+			var createErr *CreateTxnError
+			Expect(errors.As(err, &createErr)).To(BeTrue())
+			Expect(createErr.Code).To(Equal(ExcessPrecision))
+			Expect(createErr.Error()).To(Equal("LoadAmount has 3 decimal places, at most 2 are allowed"))
+		})
+	})
+
+	When("time round-trip is strict", func() {
+		BeforeEach(func() {
+			txnCreator.strictTimeRoundTrip = true
+		})
+
+		var createErrCode = func(req *CreateTxnReq) FailureCode {
+			_, err := txnCreator.createTxn(req)
+			var createErr *CreateTxnError
+			Expect(errors.As(err, &createErr)).To(BeTrue())
+			return createErr.Code
+		}
+
+		It("accepts times matching their time-format", func() {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action: CreateTxn,
+				Data: &CreateTxnReq{
+					ID:         "43583",
+					CustomerID: "37648",
+					LoadAmount: "$835.78",
+					Time:       "2000-01-13T04:05:06Z",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = txnCreator.handleCreateTxnCmd(cmd)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdTxn, err := expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.Time).To(Equal(time.Date(2000, 1, 13, 4, 5, 6, 0, time.UTC)))
+		})
+
+		It("accepts month-names differing only in case", func() {
+			_, err := txnCreator.createTxn(&CreateTxnReq{
+				ID:         "43583",
+				CustomerID: "37648",
+				LoadAmount: "$835.78",
+				Time:       "13 JAN 2000 04:05:06",
+				TimeFmt:    "02 Jan 2006 15:04:05",
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("declines 13th day with swapped day/month time-format", func() {
+			// Month 13 fails parsing, before round-trip is checked
+			Expect(createErrCode(&CreateTxnReq{
+				ID:         "43583",
+				CustomerID: "37648",
+				LoadAmount: "$835.78",
+				Time:       "2000-01-13T04:05:06Z",
+				TimeFmt:    "2006-02-01T15:04:05Z",
+			})).To(Equal(InvalidTime))
+		})
+
+		It("declines earlier days with swapped day/month time-format if parts are lost", func() {
+			req := &CreateTxnReq{
+				ID:         "43583",
+				CustomerID: "37648",
+				LoadAmount: "$835.78",
+				Time:       "2000-01-05T04:05:06.5Z",
+				TimeFmt:    "2006-02-01T15:04:05Z",
+			}
+			// Parsed as May 1st, with fractional seconds
+			// which time-format can't represent.
+			txnCreator.strictTimeRoundTrip = false
+			createdTxn, err := txnCreator.createTxn(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.Time).To(Equal(time.Date(2000, 5, 1, 4, 5, 6, 5e8, time.UTC)))
+			txnCreator.strictTimeRoundTrip = true
+			Expect(createErrCode(req)).To(Equal(TimeFormatAmbiguous))
+
+			// Padded day and month are parsed as May 1st,
+			// but swapped time-format doesn't pad these.
+			req.Time = "2000-01-05T04:05:06Z"
+			req.TimeFmt = "2006-2-1T15:04:05Z"
+			txnCreator.strictTimeRoundTrip = false
+			_, err = txnCreator.createTxn(req)
+			Expect(err).ToNot(HaveOccurred())
+			txnCreator.strictTimeRoundTrip = true
+			Expect(createErrCode(req)).To(Equal(TimeFormatAmbiguous))
+		})
+
+		It("declines times losing parts when formatted back", func() {
+			req := &CreateTxnReq{
+				ID:         "43583",
+				CustomerID: "37648",
+				LoadAmount: "$835.78",
+				// Fractional seconds are parsed, but not in time-format
+				Time: "2000-01-13T04:05:06.5Z",
+			}
+			Expect(createErrCode(req)).To(Equal(TimeFormatAmbiguous))
+
+			// Padded month is parsed, but not in time-format
+			req.Time = "2000-01-13T04:05:06Z"
+			req.TimeFmt = "2006-1-02T15:04:05Z"
+			Expect(createErrCode(req)).To(Equal(TimeFormatAmbiguous))
+		})
+	})
+
+	When("content-duplicates are rejected", func() {
+		BeforeEach(func() {
+			txnCreator.contentHashes = make(contentHashes)
+		})
+
+		var handleReq = func(id string, loadAmount string) {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action: CreateTxn,
+				Data: &CreateTxnReq{
+					ID:         id,
+					CustomerID: "37648",
+					LoadAmount: loadAmount,
+					Time:       "2000-01-13T04:05:06Z",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = txnCreator.handleCreateTxnCmd(cmd)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("declines transaction with different ID but same content", func() {
+			handleReq("1", "$835.78")
+			_, err := expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+
+			handleReq("2", "$835.78")
+			_, err = expectEvent(successSub, failSub, TxnCreateFailed)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = txnCreator.createTxn(&CreateTxnReq{
+				ID:         "3",
+				CustomerID: "37648",
+				LoadAmount: "$835.780",
+				Time:       "2000-01-13T04:05:06Z",
+			})
+			var createErr *CreateTxnError
+			Expect(errors.As(err, &createErr)).To(BeTrue())
+			Expect(createErr.Code).To(Equal(DuplicateContent))
+			Expect(createErr.Error()).To(ContainSubstring("as transaction: 1"))
+		})
+
+		It("creates transactions with same ID, or different content", func() {
+			handleReq("1", "$835.78")
+			_, err := expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Left to account's duplicate-detection
+			handleReq("1", "$835.78")
+			_, err = expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+
+			handleReq("2", "$835.79")
+			_, err = expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	When("zero-amounts are handled by policy", func() {
+		const TxnSkipped model.EventAction = "txnSkipped"
+
+		var skippedSub <-chan interface{}
+
+		BeforeEach(func() {
+			var err error
+			skippedSub, err = bus.Subscribe(TxnSkipped.String())
+			Expect(err).ToNot(HaveOccurred())
+			txnCreator.txnSkipped = TxnSkipped
+		})
+
+		var handleAmount = func(loadAmount string) {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action:   CreateTxn,
+				InputSeq: 7,
+				Data: &CreateTxnReq{
+					ID:         "43583",
+					CustomerID: "37648",
+					LoadAmount: loadAmount,
+					Time:       "2000-01-13T04:05:06Z",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			err = txnCreator.handleCreateTxnCmd(cmd)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("creates zero-amount transactions if allowed", func() {
+			txnCreator.zeroAmountPolicy = ZeroAmountAllow
+			handleAmount("$0.00")
+			createdTxn, err := expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.LoadAmount).To(BeZero())
+		})
+
+		It("rejects zero-amount transactions", func() {
+			txnCreator.zeroAmountPolicy = ZeroAmountReject
+			handleAmount("$0.00")
+			_, err := expectEvent(successSub, failSub, TxnCreateFailed)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = txnCreator.createTxn(&CreateTxnReq{
+				ID:         "43583",
+				CustomerID: "37648",
+				LoadAmount: "-$0",
+				Time:       "2000-01-13T04:05:06Z",
+			})
+			var createErr *CreateTxnError
+			Expect(errors.As(err, &createErr)).To(BeTrue())
+			Expect(createErr.Code).To(Equal(ZeroAmount))
+
+			// Other amounts are still created
+			handleAmount("$0.01")
+			_, err = expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("publishes skipped-event for zero-amount transactions", func() {
+			txnCreator.zeroAmountPolicy = ZeroAmountSkip
+			handleAmount("$0.00")
+
+			var msg interface{}
+			Eventually(skippedSub, busMsgReceiveTimeoutSec).Should(Receive(&msg))
+			event, castSuccess := msg.(model.Event)
+			Expect(castSuccess).To(BeTrue())
+			Expect(event.InputSeq()).To(Equal(uint64(7)))
+			skip := &TxnSkip{}
+			Expect(json.Unmarshal(event.Data(), skip)).To(Succeed())
+			Expect(skip.Txn.ID).To(Equal("43583"))
+			Expect(skip.Txn.InputSeq).To(Equal(uint64(7)))
+			Expect(skip.Reason).ToNot(BeEmpty())
+			Consistently(successSub).ShouldNot(Receive())
+			Consistently(failSub).ShouldNot(Receive())
+
+			handleAmount("$1.00")
+			_, err := expectEvent(successSub, failSub, TxnCreated)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("validates policy", func() {
+			cfg := &CreatorCfg{
+				DefaultTimeFmt: txnReqTimeFmt,
+				Log:            logger.NewStdLogger("TxnCreator"),
+				EventRepo:      txnCreator.eventRepo,
+
+				TxnCreated:      TxnCreated,
+				TxnCreateFailed: TxnCreateFailed,
+			}
+			creator, err := newCreator(cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(creator.zeroAmountPolicy).To(Equal(ZeroAmountAllow))
+
+			cfg.ZeroAmountPolicy = "ignore"
+			_, err = newCreator(cfg)
+			Expect(err).To(HaveOccurred())
+
+			// Skipping requires skipped-action
+			cfg.ZeroAmountPolicy = ZeroAmountSkip
+			_, err = newCreator(cfg)
+			Expect(err).To(HaveOccurred())
+			cfg.TxnSkipped = TxnSkipped
+			_, err = newCreator(cfg)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	When("ingestion-settings are customized", func() {
+		var createErrCode = func(req *CreateTxnReq) FailureCode {
+			_, err := txnCreator.createTxn(req)
+			var createErr *CreateTxnError
+			Expect(errors.As(err, &createErr)).To(BeTrue())
+			return createErr.Code
+		}
+
+		It("parses amounts with currency-symbol", func() {
+			txnCreator.currencySymbol = "€"
+			txnCreator.maxAmountDecimals = 2
+			createdTxn, err := txnCreator.createTxn(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: "2",
+				LoadAmount: "-€10.50",
+				Time:       "2000-01-13T04:05:06Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.LoadAmount).To(Equal(-10.5))
+
+			Expect(createErrCode(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: "2",
+				LoadAmount: "$10.50",
+				Time:       "2000-01-13T04:05:06Z",
+			})).To(Equal(InvalidLoadAmount))
+			Expect(createErrCode(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: "2",
+				LoadAmount: "€10.505",
+				Time:       "2000-01-13T04:05:06Z",
+			})).To(Equal(ExcessPrecision))
+		})
+
+		It("parses epoch-second times", func() {
+			txnCreator.defaultTimeFmt = TimeFmtEpochSeconds
+			txnCreator.strictTimeRoundTrip = true
+			createdTxn, err := txnCreator.createTxn(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: "2",
+				LoadAmount: "$10",
+				Time:       "946893600",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.Time).To(Equal(time.Date(2000, 1, 3, 10, 0, 0, 0, time.UTC)))
+
+			Expect(createErrCode(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: "2",
+				LoadAmount: "$10",
+				Time:       "2000-01-03T10:00:00Z",
+			})).To(Equal(InvalidTime))
+		})
+
+		It("normalizes customer-IDs, and runs validators", func() {
+			txnCreator.normalizeCustomerID = strings.TrimSpace
+			txnCreator.validators = []TxnValidator{
+				func(txn *model.Transaction) error {
+					if txn.LoadAmount > 100 {
+						return errors.New("amount too high")
+					}
+					return nil
+				},
+			}
+			createdTxn, err := txnCreator.createTxn(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: " 2 ",
+				LoadAmount: "$100",
+				Time:       "2000-01-13T04:05:06Z",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdTxn.CustomerID).To(Equal("2"))
+
+			// Normalized IDs can be blank
+			Expect(createErrCode(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: "  ",
+				LoadAmount: "$100",
+				Time:       "2000-01-13T04:05:06Z",
+			})).To(Equal(MissingCustomerID))
+			Expect(createErrCode(&CreateTxnReq{
+				ID:         "1",
+				CustomerID: "2",
+				LoadAmount: "$101",
+				Time:       "2000-01-13T04:05:06Z",
+			})).To(Equal(RejectedByValidator))
+		})
+	})
+
+	It("rejects default time-formats which don't round-trip", func() {
+		cfg := &CreatorCfg{
+			Log:       logger.NewStdLogger("TxnCreator"),
+			EventRepo: txnCreator.eventRepo,
+
+			TxnCreated:      TxnCreated,
+			TxnCreateFailed: TxnCreateFailed,
+		}
+		for _, timeFmt := range []string{
+			"yyyy-MM-ddTHH:mm:ssZ",
+			// Missing seconds
+			"2006-01-02T15:04",
+		} {
+			cfg.DefaultTimeFmt = timeFmt
+			_, err := newCreator(cfg)
+			Expect(err).To(HaveOccurred(), "time-format: %s", timeFmt)
+		}
+
+		// Swapped day/month still round-trips
+		for _, timeFmt := range []string{txnReqTimeFmt, "2006-02-01T15:04:05Z"} {
+			cfg.DefaultTimeFmt = timeFmt
+			_, err := newCreator(cfg)
+			Expect(err).ToNot(HaveOccurred(), "time-format: %s", timeFmt)
+		}
+	})
 })
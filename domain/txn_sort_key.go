@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+)
+
+// NewTxnSortKeyFunc returns a reader.SortKeyFunc which orders
+// transaction-requests by customer-id, then by transaction-time.
+// Times are parsed same as when creating transactions.
+func NewTxnSortKeyFunc(defaultTimeFmt string) reader.SortKeyFunc {
+	return func(line string) (reader.SortKey, error) {
+		req := &txn.CreateTxnReq{}
+		err := json.Unmarshal([]byte(line), req)
+		if err != nil {
+			return reader.SortKey{}, errors.Wrap(err, "error unmarshalling transaction-req")
+		}
+
+		timeFmt := req.TimeFmt
+		if timeFmt == "" {
+			timeFmt = defaultTimeFmt
+		}
+		parsedTime, err := txn.ParseTime(timeFmt, req.Time)
+		if err != nil {
+			return reader.SortKey{}, errors.Wrap(err, "error parsing time")
+		}
+		return reader.SortKey{
+			Group: req.CustomerID,
+			Time:  parsedTime,
+		}, nil
+	}
+}
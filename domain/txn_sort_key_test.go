@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	globalcfg "github.com/Jaskaranbir/es-bank-account/config"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Pre-sorted input", func() {
+	const processMgrIdleTimeoutSec = 1
+
+	// Daily transactions of customer "1" are out of order,
+	// the daily txn-limit of 3 is exceeded by the 4th one.
+	shuffledData := []txn.CreateTxnReq{
+		{ID: "4", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T04:00:00Z"},
+		{ID: "5", CustomerID: "2", LoadAmount: "$10", Time: "2000-01-05T02:00:00Z"},
+		{ID: "1", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T01:00:00Z"},
+		{ID: "2", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T02:00:00Z"},
+		{ID: "3", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+	}
+
+	var bus eventutil.Bus
+	var ioWriter *domain_test.MockWriter
+
+	var routinesCfg = func(input []txn.CreateTxnReq, preSort bool) *RoutinesCfg {
+		cfgProvider := domain_test.ConfigProvider{}
+
+		ioReader, err := domain_test.NewMockReader(input)
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter = domain_test.NewMockWriter()
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, ioWriter)
+		Expect(err).ToNot(HaveOccurred())
+
+		readerCfg := &reader.Cfg{
+			Log:      logger.NewStdLogger("reader"),
+			Bus:      bus,
+			Reader:   ioReader,
+			DataRead: model.TxnRead,
+		}
+		if preSort {
+			readerCfg.PreSortKey = NewTxnSortKeyFunc(globalcfg.TxnRequestTimeFmt)
+		}
+		processMgrCfg := &ProcessMgrCfg{
+			Log:               logger.NewStdLogger("ProcessMgr"),
+			Bus:               bus,
+			TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+			WriteData:  model.WriteData,
+			CreateTxn:  model.CreateTxn,
+			ProcessTxn: model.ProcessTxn,
+
+			TxnRead:         model.TxnRead,
+			TxnCreated:      model.TxnCreated,
+			TxnCreateFailed: model.TxnCreateFailed,
+			ReportWritten:   model.DataWritten,
+
+			IdleTimeoutSec:               processMgrIdleTimeoutSec,
+			ReportWrittenEventTimeoutSec: 3,
+
+			// Input-order is preserved in both cases,
+			// so decisions only differ by pre-sort.
+			OrderedDispatch: true,
+		}
+
+		return &RoutinesCfg{
+			Log:            logger.NewStdLogger("runner"),
+			ReaderCfg:      readerCfg,
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg:  processMgrCfg,
+			WriterCfg:      writerCfg,
+		}
+	}
+
+	// Runs routines with input, and returns
+	// acceptance of transactions by their ID.
+	var run = func(input []txn.CreateTxnReq, preSort bool) map[string]bool {
+		_, err := RunRoutines(routinesCfg(input, preSort))
+		Expect(err).ToNot(HaveOccurred())
+
+		accepted := make(map[string]bool)
+		for _, line := range strings.Split(string(ioWriter.Content()), "\n") {
+			result := &accountview.TxnResultEntry{}
+			err := json.Unmarshal([]byte(line), result)
+			Expect(err).ToNot(HaveOccurred())
+			accepted[result.ID] = result.Accepted
+		}
+		return accepted
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("makes limit-decisions in chronological order", func(done Done) {
+		Expect(run(shuffledData, true)).To(Equal(map[string]bool{
+			"1": true,
+			"2": true,
+			"3": true,
+			"4": false,
+			"5": true,
+		}))
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	It("requires ordered-dispatch for pre-sorted input", func() {
+		cfg := routinesCfg(shuffledData, true)
+		cfg.ProcessMgrCfg.OrderedDispatch = false
+		_, err := RunRoutines(cfg)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("makes limit-decisions in input order without pre-sort", func(done Done) {
+		Expect(run(shuffledData, false)).To(Equal(map[string]bool{
+			"1": true,
+			"2": true,
+			"3": false,
+			"4": true,
+			"5": true,
+		}))
+		close(done)
+	}, processMgrIdleTimeoutSec+5)
+
+	Describe("NewTxnSortKeyFunc", func() {
+		sortKey := NewTxnSortKeyFunc(globalcfg.TxnRequestTimeFmt)
+
+		It("returns customer-id and transaction-time as key", func() {
+			key, err := sortKey(`{"id":"1","customer_id":"2","time":"2000-01-05T01:00:00Z"}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key.Group).To(Equal("2"))
+			Expect(key.Time.Format(globalcfg.TxnRequestTimeFmt)).To(Equal("2000-01-05T01:00:00Z"))
+		})
+
+		It("uses custom time-format if specified", func() {
+			key, err := sortKey(`{"customer_id":"2","time":"01/02/2000","time_format":"01/02/2006"}`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key.Time.Format(globalcfg.TxnRequestTimeFmt)).To(Equal("2000-01-02T00:00:00Z"))
+		})
+
+		It("errors on invalid transaction-request", func() {
+			_, err := sortKey(`not-json`)
+			Expect(err).To(HaveOccurred())
+			_, err = sortKey(`{"customer_id":"2","time":"invalid"}`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,77 @@
+package usageview
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+// UsagePath is path prefix usage-history of
+// customers is served on, as "/usage/{customer}".
+const UsagePath = "/usage/"
+
+// Periods usage can be queried for.
+const (
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+)
+
+// usageHandler serves usage-history from UsageViewRepo over HTTP.
+type usageHandler struct {
+	log  logger.Logger
+	repo UsageViewRepo
+}
+
+// NewUsageHandler returns http.Handler serving usage-history
+// of customers (see UsageViewRepo) as JSON, for requests such as:
+// "GET /usage/{customer}?from={RFC3339-time}&to={RFC3339-time}&period={day|week}".
+// Period defaults to day. Handler should be registered on UsagePath.
+func NewUsageHandler(log logger.Logger, repo UsageViewRepo) http.Handler {
+	return &usageHandler{
+		log:  log,
+		repo: repo,
+	}
+}
+
+func (h *usageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	custID := strings.TrimPrefix(r.URL.Path, UsagePath)
+	if custID == "" || strings.Contains(custID, "/") {
+		http.Error(w, "customer-id must be specified as: /usage/{customer}", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		http.Error(w, "query-param \"from\" must be a RFC3339 time", http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil {
+		http.Error(w, "query-param \"to\" must be a RFC3339 time", http.StatusBadRequest)
+		return
+	}
+
+	var records []DatedRecord
+	switch query.Get("period") {
+	case "", PeriodDay:
+		records = h.repo.DailyUsage(custID, from, to)
+	case PeriodWeek:
+		records = h.repo.WeeklyUsage(custID, from, to)
+	default:
+		http.Error(w, "query-param \"period\" must be one of: day, week", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(records)
+	if err != nil {
+		h.log.Errorf("[Customer: %s]: Error writing usage: %s", custID, err)
+	}
+}
@@ -0,0 +1,95 @@
+package usageview
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/projection"
+)
+
+// UsageProjection is the name usage-view
+// is registered with on projection-coordinator.
+const UsageProjection = "usageView"
+
+// UsageView maintains a projection of per-day and per-ISO-week
+// limits-usage of customers from account's events, so usage-history
+// can be queried without replaying accounts.
+// Use #NewUsageView to create new instance.
+type UsageView struct {
+	log       logger.Logger
+	usageRepo UsageViewRepo
+
+	accountDeposited model.EventAction
+	accountWithdrawn model.EventAction
+}
+
+// UsageViewCfg defines config for UsageView.
+type UsageViewCfg struct {
+	Log       logger.Logger `validate:"nonnil"`
+	UsageRepo UsageViewRepo `validate:"nonnil"`
+
+	AccountDeposited model.EventAction `validate:"nonzero"`
+	AccountWithdrawn model.EventAction `validate:"nonzero"`
+}
+
+// NewUsageView validates provided config
+// and creates new instance of UsageView.
+func NewUsageView(cfg *UsageViewCfg) (*UsageView, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+
+	return &UsageView{
+		log:       cfg.Log,
+		usageRepo: cfg.UsageRepo,
+
+		accountDeposited: cfg.AccountDeposited,
+		accountWithdrawn: cfg.AccountWithdrawn,
+	}, nil
+}
+
+// Register registers usage-view to be
+// hydrated by provided coordinator.
+func (uv *UsageView) Register(coordinator *projection.Coordinator) error {
+	if coordinator == nil {
+		return errors.New("coordinator is nil")
+	}
+	err := coordinator.Register(UsageProjection, uv.Apply)
+	return errors.Wrap(err, "error registering usage-view")
+}
+
+// Apply adds usage of accepted transaction in event to
+// usage-view repo. Other events (such as failures or
+// opening-balances) don't affect usage, and are skipped.
+func (uv *UsageView) Apply(event model.Event) error {
+	if event.Action() != uv.accountDeposited && event.Action() != uv.accountWithdrawn {
+		uv.log.Tracef("[EventID: %s]: Skipped event with action: %s", event.ID(), event.Action())
+		return nil
+	}
+	uv.log.Tracef("[EventID: %s]: Processing event", event.ID())
+
+	state, err := account.DecodeState(event.RawData())
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling event-data")
+	}
+
+	// States carry running totals of their day, so transaction's
+	// usage is the difference from day's usage so far.
+	dayUsage := uv.usageRepo.DailyUsage(state.CustID, state.TxnTime, state.TxnTime)
+	delta := state.DailyTxn
+	if len(dayUsage) > 0 {
+		delta.NumTxns -= dayUsage[0].Record.NumTxns
+		delta.TotalAmount -= dayUsage[0].Record.TotalAmount
+	}
+	err = uv.usageRepo.Add(state.CustID, state.TxnTime, delta)
+	if err != nil {
+		return errors.Wrap(err, "error adding usage to usage-view repo")
+	}
+
+	uv.log.Tracef("[EventID: %s]: Processed event", event.ID())
+	return nil
+}
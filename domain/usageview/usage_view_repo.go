@@ -0,0 +1,130 @@
+package usageview
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+)
+
+// UsageViewRepo handles storing/retrieving per-day
+// and per-ISO-week limits-usage of customers. Days and
+// weeks are observed in repo's location, which must be
+// same as account's BucketLocation (see account#PeriodStarts).
+type UsageViewRepo interface {
+	// Add adds delta to day and ISO-week containing
+	// provided time. Deltas can be negative, such as
+	// for reversed transactions.
+	Add(custID string, at time.Time, delta account.TxnRecord) error
+	// DailyUsage returns records of days from day of "from"
+	// till day of "to", sorted by date. Days without
+	// activity are omitted.
+	DailyUsage(custID string, from, to time.Time) []DatedRecord
+	// WeeklyUsage returns records of ISO-weeks from week
+	// of "from" till week of "to", sorted by date. Weeks
+	// without activity are omitted.
+	WeeklyUsage(custID string, from, to time.Time) []DatedRecord
+}
+
+// DatedRecord is usage of a customer for a specific period.
+type DatedRecord struct {
+	// Start of period (local midnight in repo's location),
+	// which is Monday for ISO-weeks.
+	Date   time.Time
+	Record account.TxnRecord
+}
+
+// MemoryUsageViewRepo is an in-memory UsageViewRepo.
+// Use #NewMemoryUsageViewRepo to create new instance.
+type MemoryUsageViewRepo struct {
+	lock     *sync.RWMutex
+	location *time.Location
+	// Keyed by customer, then by start of period
+	daily  map[string]map[time.Time]account.TxnRecord
+	weekly map[string]map[time.Time]account.TxnRecord
+}
+
+// NewMemoryUsageViewRepo creates a new instance of
+// MemoryUsageViewRepo, with days and weeks observed
+// in location loc (UTC if nil).
+func NewMemoryUsageViewRepo(loc *time.Location) *MemoryUsageViewRepo {
+	return &MemoryUsageViewRepo{
+		lock:     &sync.RWMutex{},
+		location: loc,
+		daily:    make(map[string]map[time.Time]account.TxnRecord),
+		weekly:   make(map[string]map[time.Time]account.TxnRecord),
+	}
+}
+
+// Add adds delta to day and ISO-week containing provided time.
+func (r *MemoryUsageViewRepo) Add(custID string, at time.Time, delta account.TxnRecord) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	dayStart, weekStart := account.PeriodStarts(at, r.location)
+	addRecord(r.daily, custID, dayStart, delta)
+	addRecord(r.weekly, custID, weekStart, delta)
+	return nil
+}
+
+// DailyUsage returns records of days in provided range.
+func (r *MemoryUsageViewRepo) DailyUsage(custID string, from, to time.Time) []DatedRecord {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	fromDay, _ := account.PeriodStarts(from, r.location)
+	toDay, _ := account.PeriodStarts(to, r.location)
+	return recordsBetween(r.daily[custID], fromDay, toDay)
+}
+
+// WeeklyUsage returns records of ISO-weeks in provided range.
+func (r *MemoryUsageViewRepo) WeeklyUsage(custID string, from, to time.Time) []DatedRecord {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	_, fromWeek := account.PeriodStarts(from, r.location)
+	_, toWeek := account.PeriodStarts(to, r.location)
+	return recordsBetween(r.weekly[custID], fromWeek, toWeek)
+}
+
+func addRecord(
+	records map[string]map[time.Time]account.TxnRecord,
+	custID string,
+	periodStart time.Time,
+	delta account.TxnRecord,
+) {
+	custRecords, exists := records[custID]
+	if !exists {
+		custRecords = make(map[time.Time]account.TxnRecord)
+		records[custID] = custRecords
+	}
+	record := custRecords[periodStart]
+	record.NumTxns += delta.NumTxns
+	record.TotalAmount += delta.TotalAmount
+	custRecords[periodStart] = record
+}
+
+// recordsBetween returns records of periods starting
+// from "from" till "to" (inclusive), sorted by date.
+func recordsBetween(
+	custRecords map[time.Time]account.TxnRecord,
+	from time.Time,
+	to time.Time,
+) []DatedRecord {
+	results := make([]DatedRecord, 0)
+	for periodStart, record := range custRecords {
+		if periodStart.Before(from) || periodStart.After(to) {
+			continue
+		}
+		results = append(results, DatedRecord{
+			Date:   periodStart,
+			Record: record,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Date.Before(results[j].Date)
+	})
+	return results
+}
@@ -0,0 +1,302 @@
+package usageview
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/account"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/projection"
+)
+
+func TestUsageView(t *testing.T) {
+	os.Setenv("LOG_LEVEL", "warn")
+	os.Setenv("EVENTBUS_LOG_LEVEL", "error")
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "UsageView Suite")
+}
+
+var _ = Describe("UsageView", func() {
+	const (
+		AccountDeposited model.EventAction = "AccountDeposited"
+		AccountWithdrawn model.EventAction = "AccountWithdrawn"
+		DuplicateTxn     model.EventAction = "DuplicateTxn"
+	)
+
+	var bus eventutil.Bus
+	var eventRepo eventutil.EventRepo
+	var usageRepo *MemoryUsageViewRepo
+
+	// Running daily/weekly totals of customers,
+	// as these would be tracked by account.
+	var daily map[string]account.TxnRecord
+	var weekly map[string]account.TxnRecord
+
+	var parseTime = func(value string) time.Time {
+		t, err := time.Parse(time.RFC3339, value)
+		Expect(err).ToNot(HaveOccurred())
+		return t
+	}
+
+	var insertEvent = func(aggID string, action model.EventAction, data interface{}) {
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: aggID,
+			Action:      action,
+			Data:        data,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = eventRepo.InsertAndPublish(event)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	// Stores state-event for an accepted transaction
+	var txn = func(custID string, txnTime time.Time, amount float64) {
+		year, week := txnTime.ISOWeek()
+		dayKey := fmt.Sprintf("%s/%s", custID, txnTime.Format("2006-01-02"))
+		weekKey := fmt.Sprintf("%s/%d-W%d", custID, year, week)
+
+		dayRecord := daily[dayKey]
+		dayRecord.NumTxns++
+		dayRecord.TotalAmount += amount
+		daily[dayKey] = dayRecord
+		weekRecord := weekly[weekKey]
+		weekRecord.NumTxns++
+		weekRecord.TotalAmount += amount
+		weekly[weekKey] = weekRecord
+
+		action := AccountDeposited
+		if amount < 0 {
+			action = AccountWithdrawn
+		}
+		insertEvent(custID, action, &account.State{
+			CustID:    custID,
+			TxnTime:   txnTime,
+			DailyTxn:  dayRecord,
+			WeeklyTxn: weekRecord,
+		})
+	}
+
+	var day = func(value string) time.Time {
+		return parseTime(value + "T00:00:00Z")
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		eventRepo, err = eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+			Bus:            bus,
+			EventStore:     eventutil.NewMemoryEventStore(),
+			UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		usageRepo = NewMemoryUsageViewRepo(nil)
+		daily = make(map[string]account.TxnRecord)
+		weekly = make(map[string]account.TxnRecord)
+
+		// A month of activity, straddling a year-boundary.
+		// Customer 1 deposits 100 every day, and withdraws 50
+		// every third day. Customer 2 deposits 200 and 300
+		// every other day.
+		start := day("2004-12-15")
+		for i := 0; i < 31; i++ {
+			date := start.AddDate(0, 0, i)
+			txn("1", date.Add(10*time.Hour), 100)
+			if i%3 == 0 {
+				txn("1", date.Add(15*time.Hour), -50)
+			}
+			if i%2 == 0 {
+				txn("2", date.Add(9*time.Hour), 200)
+				txn("2", date.Add(18*time.Hour), 300)
+			}
+		}
+		// Don't affect usage
+		insertEvent("1", DuplicateTxn, &account.TxnFailure{
+			Txn: model.Transaction{ID: "dup", CustomerID: "1", LoadAmount: 1000, Time: start},
+		})
+		insertEvent("1", "UnknownAction", &account.State{
+			CustID:   "1",
+			TxnTime:  start,
+			DailyTxn: account.TxnRecord{NumTxns: 10, TotalAmount: 10000},
+		})
+
+		usageView, err := NewUsageView(&UsageViewCfg{
+			Log:       logger.NewStdLogger("UsageView"),
+			UsageRepo: usageRepo,
+
+			AccountDeposited: AccountDeposited,
+			AccountWithdrawn: AccountWithdrawn,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		coordinator, err := projection.NewCoordinator(&projection.CoordinatorCfg{
+			Log:           logger.NewStdLogger("Coordinator"),
+			EventRepo:     eventRepo,
+			FailurePolicy: projection.FailurePolicyHalt,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		err = usageView.Register(coordinator)
+		Expect(err).ToNot(HaveOccurred())
+		err = coordinator.Hydrate()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("returns daily usage within range", func() {
+		Expect(usageRepo.DailyUsage("1", day("2004-12-15"), parseTime("2004-12-17T23:00:00Z"))).To(Equal([]DatedRecord{
+			{Date: day("2004-12-15"), Record: account.TxnRecord{NumTxns: 2, TotalAmount: 50}},
+			{Date: day("2004-12-16"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 100}},
+			{Date: day("2004-12-17"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 100}},
+		}))
+		// Days without activity are omitted
+		Expect(usageRepo.DailyUsage("2", day("2004-12-15"), day("2004-12-18"))).To(Equal([]DatedRecord{
+			{Date: day("2004-12-15"), Record: account.TxnRecord{NumTxns: 2, TotalAmount: 500}},
+			{Date: day("2004-12-17"), Record: account.TxnRecord{NumTxns: 2, TotalAmount: 500}},
+		}))
+	})
+
+	It("returns usage of periods straddling a year-boundary", func() {
+		from := parseTime("2004-12-31T12:00:00Z")
+		to := parseTime("2005-01-04T08:00:00Z")
+		Expect(usageRepo.DailyUsage("1", from, parseTime("2005-01-02T08:00:00Z"))).To(Equal([]DatedRecord{
+			{Date: day("2004-12-31"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 100}},
+			{Date: day("2005-01-01"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 100}},
+			{Date: day("2005-01-02"), Record: account.TxnRecord{NumTxns: 2, TotalAmount: 50}},
+		}))
+
+		// ISO-week 2004-W53 runs from 2004-12-27 till 2005-01-02
+		Expect(usageRepo.WeeklyUsage("1", from, to)).To(Equal([]DatedRecord{
+			{Date: day("2004-12-27"), Record: account.TxnRecord{NumTxns: 10, TotalAmount: 550}},
+			{Date: day("2005-01-03"), Record: account.TxnRecord{NumTxns: 9, TotalAmount: 600}},
+		}))
+		Expect(usageRepo.WeeklyUsage("2", from, from)).To(Equal([]DatedRecord{
+			{Date: day("2004-12-27"), Record: account.TxnRecord{NumTxns: 8, TotalAmount: 2000}},
+		}))
+	})
+
+	It("returns no usage for empty ranges", func() {
+		Expect(usageRepo.DailyUsage("1", day("2005-01-20"), day("2005-01-25"))).To(BeEmpty())
+		Expect(usageRepo.WeeklyUsage("1", day("2004-11-01"), day("2004-11-30"))).To(BeEmpty())
+		// "From" after "to"
+		Expect(usageRepo.DailyUsage("1", day("2004-12-20"), day("2004-12-16"))).To(BeEmpty())
+		Expect(usageRepo.DailyUsage("unknown", day("2004-12-15"), day("2005-01-14"))).To(BeEmpty())
+	})
+
+	It("subtracts negative deltas from buckets of their day and week", func() {
+		// Such as for a reversed transaction
+		err := usageRepo.Add("1", parseTime("2004-12-31T16:00:00Z"), account.TxnRecord{
+			NumTxns:     -1,
+			TotalAmount: -100,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(usageRepo.DailyUsage("1", day("2004-12-31"), day("2004-12-31"))).To(Equal([]DatedRecord{
+			{Date: day("2004-12-31"), Record: account.TxnRecord{}},
+		}))
+		Expect(usageRepo.WeeklyUsage("1", day("2004-12-31"), day("2004-12-31"))).To(Equal([]DatedRecord{
+			{Date: day("2004-12-27"), Record: account.TxnRecord{NumTxns: 9, TotalAmount: 450}},
+		}))
+		Expect(usageRepo.DailyUsage("1", day("2005-01-01"), day("2005-01-01"))).To(Equal([]DatedRecord{
+			{Date: day("2005-01-01"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 100}},
+		}))
+	})
+
+	It("keys periods same as account in its bucket-location", func() {
+		newYork, err := time.LoadLocation("America/New_York")
+		Expect(err).ToNot(HaveOccurred())
+		localRepo := NewMemoryUsageViewRepo(newYork)
+		usageView, err := NewUsageView(&UsageViewCfg{
+			Log:       logger.NewStdLogger("UsageView"),
+			UsageRepo: localRepo,
+
+			AccountDeposited: AccountDeposited,
+			AccountWithdrawn: AccountWithdrawn,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		// States as tracked by account bucketing in New York,
+		// where first transaction is late on previous day.
+		states := []account.State{
+			{
+				CustID:    "1",
+				TxnTime:   parseTime("2005-01-10T03:00:00Z"),
+				DailyTxn:  account.TxnRecord{NumTxns: 1, TotalAmount: 100},
+				WeeklyTxn: account.TxnRecord{NumTxns: 1, TotalAmount: 100},
+			},
+			{
+				CustID:    "1",
+				TxnTime:   parseTime("2005-01-10T15:00:00Z"),
+				DailyTxn:  account.TxnRecord{NumTxns: 1, TotalAmount: 200},
+				WeeklyTxn: account.TxnRecord{NumTxns: 1, TotalAmount: 200},
+			},
+		}
+		for _, state := range states {
+			event, err := model.NewEvent(&model.EventCfg{
+				AggregateID: state.CustID,
+				Action:      AccountDeposited,
+				Data:        state,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(usageView.Apply(event)).To(Succeed())
+		}
+
+		localDay := func(value string) time.Time {
+			t, err := time.ParseInLocation("2006-01-02", value, newYork)
+			Expect(err).ToNot(HaveOccurred())
+			return t
+		}
+		Expect(localRepo.DailyUsage("1", localDay("2005-01-09"), localDay("2005-01-10"))).To(Equal([]DatedRecord{
+			{Date: localDay("2005-01-09"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 100}},
+			{Date: localDay("2005-01-10"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 200}},
+		}))
+		// Sunday and Monday fall in different ISO-weeks
+		Expect(localRepo.WeeklyUsage("1", localDay("2005-01-09"), localDay("2005-01-10"))).To(Equal([]DatedRecord{
+			{Date: localDay("2005-01-03"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 100}},
+			{Date: localDay("2005-01-10"), Record: account.TxnRecord{NumTxns: 1, TotalAmount: 200}},
+		}))
+	})
+
+	It("serves usage over HTTP", func() {
+		handler := NewUsageHandler(logger.NewStdLogger("UsageHandler"), usageRepo)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(
+			http.MethodGet, "/usage/2?from=2004-12-27T00:00:00Z&to=2005-01-03T00:00:00Z&period=week", nil,
+		))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		records := make([]DatedRecord, 0)
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &records)).To(Succeed())
+		Expect(records).To(Equal([]DatedRecord{
+			{Date: day("2004-12-27"), Record: account.TxnRecord{NumTxns: 8, TotalAmount: 2000}},
+			{Date: day("2005-01-03"), Record: account.TxnRecord{NumTxns: 6, TotalAmount: 1500}},
+		}))
+
+		for target, code := range map[string]int{
+			"/usage/1?from=2004-12-27T00:00:00Z&to=2005-01-03T00:00:00Z":              http.StatusOK,
+			"/usage/1?from=2004-12-27T00:00:00Z":                                      http.StatusBadRequest,
+			"/usage/1?from=2004-12-27&to=2005-01-03T00:00:00Z":                        http.StatusBadRequest,
+			"/usage/1?from=2004-12-27T00:00:00Z&to=2005-01-03T00:00:00Z&period=month": http.StatusBadRequest,
+			"/usage/?from=2004-12-27T00:00:00Z&to=2005-01-03T00:00:00Z":               http.StatusNotFound,
+		} {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+			Expect(recorder.Code).To(Equal(code), target)
+		}
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/usage/1", nil))
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Default number of offending lines
+// included in ValidationReport.
+const defaultMaxOffendingLines = 10
+
+// ValidateCfg is config for #ValidateInput.
+type ValidateCfg struct {
+	DefaultTimeFmt string `validate:"nonzero"`
+	// Optional, same as txn.CreatorCfg#MaxAmountDecimals.
+	MaxAmountDecimals int `validate:"min=0"`
+	// Optional, same as txn.CreatorCfg#StrictTimeRoundTrip.
+	StrictTimeRoundTrip bool
+	// Optional, number of offending lines to include
+	// in report. Defaults to 10.
+	MaxOffendingLines int `validate:"min=0"`
+}
+
+// ValidationReport describes transaction-requests in an input.
+type ValidationReport struct {
+	ValidRecords   int
+	InvalidRecords int
+	// Number of invalid records by failure-code
+	FailureCodes map[txn.FailureCode]int
+	// Customers with valid records
+	DistinctCustomers int
+	// Earliest and latest time of valid records.
+	// Zero if there are no valid records.
+	FirstTxnTime time.Time
+	LastTxnTime  time.Time
+	// First invalid records, in order of input
+	OffendingLines []OffendingLine
+}
+
+// OffendingLine is an invalid record in input.
+type OffendingLine struct {
+	// Starts from 1, including blank lines
+	LineNum int
+	Line    string
+	Code    txn.FailureCode
+	Error   string
+}
+
+// HasInvalid returns true if any invalid records were found.
+func (r *ValidationReport) HasInvalid() bool {
+	return r.InvalidRecords > 0
+}
+
+// ValidateInput reads transaction-requests from provided io.Reader,
+// and reports valid/invalid records without processing these.
+// Lines are read, and transactions parsed and validated, same as
+// when running domain-routines, but no bus, events or accounts are
+// involved. Report is returned along with error if reading fails,
+// covering lines read before the failure.
+func ValidateInput(r io.Reader, cfg ValidateCfg) (*ValidationReport, error) {
+	if r == nil {
+		return nil, errors.New("reader is nil")
+	}
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+	err = txn.CheckTimeFmt(cfg.DefaultTimeFmt)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating default time-format")
+	}
+	maxOffendingLines := cfg.MaxOffendingLines
+	if maxOffendingLines == 0 {
+		maxOffendingLines = defaultMaxOffendingLines
+	}
+
+	report := &ValidationReport{
+		FailureCodes:   make(map[txn.FailureCode]int),
+		OffendingLines: make([]OffendingLine, 0),
+	}
+	customers := make(map[string]struct{})
+	err = reader.ForEachLine(r, func(lineNum int, line string) error {
+		transaction, err := parseTxnLine(line, cfg)
+		if err != nil {
+			code := txn.MalformedReq
+			var createErr *txn.CreateTxnError
+			if errors.As(err, &createErr) {
+				code = createErr.Code
+			}
+			report.InvalidRecords++
+			report.FailureCodes[code]++
+			if len(report.OffendingLines) < maxOffendingLines {
+				report.OffendingLines = append(report.OffendingLines, OffendingLine{
+					LineNum: lineNum,
+					Line:    line,
+					Code:    code,
+					Error:   err.Error(),
+				})
+			}
+			return nil
+		}
+
+		report.ValidRecords++
+		customers[transaction.CustomerID] = struct{}{}
+		if report.FirstTxnTime.IsZero() || transaction.Time.Before(report.FirstTxnTime) {
+			report.FirstTxnTime = transaction.Time
+		}
+		if transaction.Time.After(report.LastTxnTime) {
+			report.LastTxnTime = transaction.Time
+		}
+		return nil
+	})
+	report.DistinctCustomers = len(customers)
+	if err != nil {
+		return report, errors.Wrap(err, "error reading input")
+	}
+	return report, nil
+}
+
+// parseTxnLine creates transaction from a line of input,
+// same as transaction-creator does for its commands.
+func parseTxnLine(line string, cfg ValidateCfg) (*model.Transaction, error) {
+	req, err := txn.ParseTxnReq([]byte(line))
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := txn.CreateTxn(req, cfg.DefaultTimeFmt)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxAmountDecimals > 0 {
+		err = txn.CheckAmountPrecision(req.LoadAmount, cfg.MaxAmountDecimals)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.StrictTimeRoundTrip {
+		err = txn.CheckTimeRoundTrip(transaction.Time, req.Time, req.TimeFmt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return transaction, nil
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	globalcfg "github.com/Jaskaranbir/es-bank-account/config"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+var _ = Describe("ValidateInput", func() {
+	var validateFile = func(path string, maxOffendingLines int) *ValidationReport {
+		file, err := os.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+
+		report, err := ValidateInput(file, ValidateCfg{
+			DefaultTimeFmt:    globalcfg.TxnRequestTimeFmt,
+			MaxOffendingLines: maxOffendingLines,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return report
+	}
+
+	It("reports valid and invalid records of input", func() {
+		report := validateFile("testdata/validate_mixed.txt", 0)
+
+		Expect(report.HasInvalid()).To(BeTrue())
+		Expect(report.ValidRecords).To(Equal(3))
+		Expect(report.InvalidRecords).To(Equal(7))
+		Expect(report.FailureCodes).To(Equal(map[txn.FailureCode]int{
+			txn.MalformedReq:      2,
+			txn.MissingTxnID:      1,
+			txn.MissingCustomerID: 1,
+			txn.InvalidLoadAmount: 2,
+			txn.InvalidTime:       1,
+		}))
+		Expect(report.DistinctCustomers).To(Equal(2))
+		Expect(report.FirstTxnTime).To(Equal(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(report.LastTxnTime).To(Equal(time.Date(2000, 1, 5, 10, 30, 0, 0, time.UTC)))
+
+		// Line-numbers include blank lines
+		lineNums := make([]int, 0)
+		codes := make([]txn.FailureCode, 0)
+		for _, line := range report.OffendingLines {
+			lineNums = append(lineNums, line.LineNum)
+			codes = append(codes, line.Code)
+		}
+		Expect(lineNums).To(Equal([]int{3, 4, 6, 7, 8, 10, 11}))
+		Expect(codes).To(Equal([]txn.FailureCode{
+			txn.MalformedReq,
+			txn.MissingTxnID,
+			txn.MissingCustomerID,
+			txn.InvalidLoadAmount,
+			txn.InvalidTime,
+			txn.InvalidLoadAmount,
+			txn.MalformedReq,
+		}))
+		Expect(report.OffendingLines[1].Line).To(HavePrefix(`{"customer_id":"1"`))
+		Expect(report.OffendingLines[1].Error).To(Equal("TransactionID cannot be empty"))
+	})
+
+	It("limits offending lines in report", func() {
+		report := validateFile("testdata/validate_mixed.txt", 2)
+
+		Expect(report.InvalidRecords).To(Equal(7))
+		Expect(report.OffendingLines).To(HaveLen(2))
+		Expect(report.OffendingLines[0].LineNum).To(Equal(3))
+		Expect(report.OffendingLines[1].LineNum).To(Equal(4))
+	})
+
+	It("reports clean input as valid", func() {
+		report := validateFile("testdata/validate_clean.txt", 0)
+
+		Expect(report.HasInvalid()).To(BeFalse())
+		Expect(report.ValidRecords).To(Equal(3))
+		Expect(report.FailureCodes).To(BeEmpty())
+		Expect(report.OffendingLines).To(BeEmpty())
+		Expect(report.DistinctCustomers).To(Equal(2))
+		// Custom time-formats are parsed same as in a run
+		Expect(report.LastTxnTime).To(Equal(time.Date(2000, 1, 2, 12, 0, 0, 0, time.UTC)))
+	})
+
+	It("returns report of lines read before a read-error", func() {
+		lines := []string{
+			`{"id":"1","customer_id":"1","load_amount":"$1","time":"2000-01-01T00:00:00Z"}`,
+			`{"id":"2","customer_id":"2","load_amount":"$1","time":"2000-01-01T00:00:00Z"}`,
+		}
+		report, err := ValidateInput(
+			testsupport.NewMockErrReader(
+				strings.NewReader(strings.Join(lines, "\n")),
+				len(lines[0])+1,
+				errors.New("connection reset"),
+			),
+			ValidateCfg{DefaultTimeFmt: globalcfg.TxnRequestTimeFmt},
+		)
+		Expect(err).To(MatchError(ContainSubstring("connection reset")))
+		Expect(report.ValidRecords).To(Equal(1))
+	})
+})
@@ -0,0 +1,325 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// WiringCheck decides how RunRoutines handles
+// issues found by CheckWiring before starting routines.
+type WiringCheck string
+
+const (
+	// WiringCheckWarn logs wiring-issues as warnings.
+	WiringCheckWarn WiringCheck = "warn"
+	// WiringCheckStrict fails run with a WiringError
+	// if any wiring-issues are found.
+	WiringCheckStrict WiringCheck = "strict"
+	// WiringCheckOff disables checking wiring.
+	WiringCheckOff WiringCheck = "off"
+)
+
+// WiringIssueKind is kind of a WiringIssue.
+type WiringIssueKind string
+
+const (
+	// NoPublisher is an action subscribed to by routines,
+	// but not published by any routine. Subscribers never
+	// receive messages for this action.
+	NoPublisher WiringIssueKind = "NoPublisher"
+	// NoSubscriber is an action published by routines,
+	// but not subscribed to by any routine. Messages for
+	// this action are dropped by Bus.
+	NoSubscriber WiringIssueKind = "NoSubscriber"
+)
+
+// WiringIssue is an action which isn't connected
+// between publishing and subscribing routines.
+type WiringIssue struct {
+	Kind   WiringIssueKind
+	Action string
+	// Routines subscribed to action for NoPublisher,
+	// and routines publishing action for NoSubscriber.
+	Components []string
+}
+
+func (i WiringIssue) String() string {
+	if i.Kind == NoPublisher {
+		return fmt.Sprintf(
+			"action %s is subscribed by [%s], but not published by any routine",
+			i.Action, strings.Join(i.Components, ", "),
+		)
+	}
+	return fmt.Sprintf(
+		"action %s is published by [%s], but not subscribed by any routine",
+		i.Action, strings.Join(i.Components, ", "),
+	)
+}
+
+// WiringError is returned by RunRoutines
+// if wiring-issues are found in strict-mode.
+type WiringError struct {
+	Issues []WiringIssue
+}
+
+func (e *WiringError) Error() string {
+	issues := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		issues[i] = issue.String()
+	}
+	return "pipeline is miswired:\n" + strings.Join(issues, "\n")
+}
+
+// wiring tracks routines publishing and subscribing each action.
+type wiring struct {
+	publishers  map[string][]string
+	subscribers map[string][]string
+	// Actions published only to be stored (such as
+	// snapshots), or consumed outside routines (such
+	// as anomalies), which don't need subscribers.
+	storeOnly map[string]bool
+	// Actions published from outside routines (such
+	// as limits-updates), which don't need publishers.
+	external map[string]bool
+}
+
+func (w *wiring) publishes(component string, actions ...string) {
+	for _, action := range actions {
+		if action != "" {
+			w.publishers[action] = append(w.publishers[action], component)
+		}
+	}
+}
+
+func (w *wiring) subscribes(component string, actions ...string) {
+	for _, action := range actions {
+		if action != "" {
+			w.subscribers[action] = append(w.subscribers[action], component)
+		}
+	}
+}
+
+// CheckWiring cross-checks actions published and subscribed
+// by routines in config, and returns subscribed actions which
+// no routine publishes, and published actions which no routine
+// subscribes to. These usually result from mismatched action
+// constants between configs of routines, which otherwise
+// silently break message-flow. Optional actions which are
+// not set, and disabled stages, are ignored. Issues are
+// sorted by kind and action.
+func CheckWiring(cfg *RoutinesCfg) []WiringIssue {
+	w := newWiring(cfg)
+
+	issues := make([]WiringIssue, 0)
+	for action, components := range w.subscribers {
+		if _, exists := w.publishers[action]; !exists && !w.external[action] {
+			issues = append(issues, WiringIssue{
+				Kind:       NoPublisher,
+				Action:     action,
+				Components: components,
+			})
+		}
+	}
+	for action, components := range w.publishers {
+		if _, exists := w.subscribers[action]; !exists && !w.storeOnly[action] {
+			issues = append(issues, WiringIssue{
+				Kind:       NoSubscriber,
+				Action:     action,
+				Components: components,
+			})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Kind != issues[j].Kind {
+			return issues[i].Kind < issues[j].Kind
+		}
+		return issues[i].Action < issues[j].Action
+	})
+	return issues
+}
+
+// newWiring returns routines publishing and
+// subscribing actions in config, see CheckWiring.
+func newWiring(cfg *RoutinesCfg) *wiring {
+	w := &wiring{
+		publishers:  make(map[string][]string),
+		subscribers: make(map[string][]string),
+		storeOnly:   make(map[string]bool),
+		external:    make(map[string]bool),
+	}
+
+	if readerCfg := cfg.ReaderCfg; readerCfg != nil && cfg.isEnabled(StageReader) {
+		w.publishes("reader", readerCfg.DataRead.String(), readerCfg.ReadFailed.String())
+	}
+	if txnCreatorCfg := cfg.TxnCreatorCfg; txnCreatorCfg != nil && cfg.isEnabled(StageTxnCreator) {
+		w.subscribes("txnCreator", txnCreatorCfg.CreateTxnCmd.String())
+		if creatorCfg := txnCreatorCfg.CreatorCfg; creatorCfg != nil {
+			w.publishes(
+				"txnCreator",
+				creatorCfg.TxnCreated.String(),
+				creatorCfg.TxnCreateFailed.String(),
+				creatorCfg.TxnSkipped.String(),
+			)
+		}
+	}
+	if accountCfg := cfg.AccountCfg; accountCfg != nil && cfg.isEnabled(StageAccount) {
+		w.subscribes("account", accountCfg.ProcessTxnCmd.String())
+		if accountCfg.UpdateLimitsCmd != "" {
+			w.subscribes("account", accountCfg.UpdateLimitsCmd.String())
+			w.external[accountCfg.UpdateLimitsCmd.String()] = true
+		}
+		// Queries are published from outside routines,
+		// and so are their results consumed.
+		for cmd, result := range map[model.CmdAction]model.EventAction{
+			accountCfg.QueryStateCmd:   accountCfg.StateQueried,
+			accountCfg.QueryBalanceCmd: accountCfg.BalanceQueried,
+		} {
+			if cmd != "" {
+				w.subscribes("account", cmd.String())
+				w.external[cmd.String()] = true
+				w.publishes("account", result.String())
+				w.storeOnly[result.String()] = true
+			}
+		}
+		if aggCfg := accountCfg.AccountCfg; aggCfg != nil {
+			w.publishes(
+				"account",
+				aggCfg.AccountDeposited.String(),
+				aggCfg.AccountWithdrawn.String(),
+				aggCfg.DuplicateTxn.String(),
+				aggCfg.AccountLimitExceeded.String(),
+			)
+			for _, action := range []string{
+				aggCfg.BalanceSnapshot.String(),
+				aggCfg.AccountSeeded.String(),
+				aggCfg.AccountRecovered.String(),
+				aggCfg.PartiallyWithdrawn.String(),
+			} {
+				if action != "" {
+					w.publishes("account", action)
+					w.storeOnly[action] = true
+				}
+			}
+		}
+	}
+	if accountViewCfg := cfg.AccountViewCfg; accountViewCfg != nil && cfg.isEnabled(StageAccountView) {
+		w.subscribes(
+			"txnResultView",
+			accountViewCfg.AccountDeposited.String(),
+			accountViewCfg.AccountWithdrawn.String(),
+			accountViewCfg.DuplicateTxn.String(),
+			accountViewCfg.AccountLimitExceeded.String(),
+			accountViewCfg.TxnSkipped.String(),
+		)
+		if accountViewCfg.RebuildCustomerCmd != "" {
+			w.subscribes("txnResultView", accountViewCfg.RebuildCustomerCmd.String())
+			w.external[accountViewCfg.RebuildCustomerCmd.String()] = true
+		}
+	}
+	if processMgrCfg := cfg.ProcessMgrCfg; processMgrCfg != nil {
+		w.publishes(
+			"processMgr",
+			processMgrCfg.WriteData.String(),
+			processMgrCfg.CreateTxn.String(),
+			processMgrCfg.ProcessTxn.String(),
+		)
+		for _, action := range processMgrCfg.ShardWriteData {
+			w.publishes("processMgr", action.String())
+		}
+		w.subscribes(
+			"processMgr",
+			processMgrCfg.TxnRead.String(),
+			processMgrCfg.TxnCreated.String(),
+			processMgrCfg.TxnCreateFailed.String(),
+			processMgrCfg.ReportWritten.String(),
+			processMgrCfg.ReportWriteFailed.String(),
+			processMgrCfg.TxnReadFailed.String(),
+			processMgrCfg.TxnSkipped.String(),
+		)
+	}
+	if anomalyCfg := cfg.AnomalyCfg; anomalyCfg != nil {
+		w.subscribes(
+			"rejectionMonitor",
+			anomalyCfg.AccountDeposited.String(),
+			anomalyCfg.AccountWithdrawn.String(),
+			anomalyCfg.DuplicateTxn.String(),
+			anomalyCfg.AccountLimitExceeded.String(),
+		)
+		w.publishes("rejectionMonitor", anomalyCfg.RejectionRateAnomaly.String())
+		w.storeOnly[anomalyCfg.RejectionRateAnomaly.String()] = true
+	}
+	if writerCfg := cfg.WriterCfg; writerCfg != nil && cfg.isEnabled(StageWriter) {
+		w.subscribes("writer", writerCfg.WriteData.String())
+		if aggCfg := writerCfg.WriterCfg; aggCfg != nil {
+			w.publishes("writer", aggCfg.DataWritten.String(), aggCfg.WriteFailed.String())
+		}
+	}
+	if cfg.isEnabled(StageWriter) {
+		for i, shardWriterCfg := range cfg.ShardWriterCfgs {
+			if shardWriterCfg == nil {
+				continue
+			}
+			component := fmt.Sprintf("shardWriter-%d", i)
+			w.subscribes(component, shardWriterCfg.WriteData.String())
+			if aggCfg := shardWriterCfg.WriterCfg; aggCfg != nil {
+				w.publishes(component, aggCfg.DataWritten.String(), aggCfg.WriteFailed.String())
+			}
+		}
+	}
+	if diagnosticsCfg := cfg.DiagnosticsCfg; diagnosticsCfg != nil {
+		w.subscribes("diagnostics", diagnosticsCfg.DumpDiagnostics.String())
+		w.external[diagnosticsCfg.DumpDiagnostics.String()] = true
+		w.publishes("diagnostics", diagnosticsCfg.DiagnosticsDumped.String())
+		w.storeOnly[diagnosticsCfg.DiagnosticsDumped.String()] = true
+	}
+	return w
+}
+
+// componentActions returns actions subscribed and published
+// by every routine, keyed by routine. Actions are sorted.
+func (w *wiring) componentActions() (subscribed, published map[string][]string) {
+	invert := func(actionComponents map[string][]string) map[string][]string {
+		componentActions := make(map[string][]string)
+		for action, components := range actionComponents {
+			for _, component := range components {
+				componentActions[component] = append(componentActions[component], action)
+			}
+		}
+		for _, actions := range componentActions {
+			sort.Strings(actions)
+		}
+		return componentActions
+	}
+	return invert(w.subscribers), invert(w.publishers)
+}
+
+// checkWiring checks wiring of routines as per mode in
+// config, and returns WiringError if issues are found
+// in strict-mode.
+func checkWiring(cfg *RoutinesCfg) error {
+	mode := cfg.WiringCheck
+	switch mode {
+	case "":
+		mode = WiringCheckWarn
+	case WiringCheckWarn, WiringCheckStrict:
+	case WiringCheckOff:
+		return nil
+	default:
+		return fmt.Errorf("invalid wiring-check mode: %s", mode)
+	}
+
+	issues := CheckWiring(cfg)
+	if len(issues) == 0 {
+		return nil
+	}
+	if mode == WiringCheckStrict {
+		return &WiringError{Issues: issues}
+	}
+	for _, issue := range issues {
+		cfg.Log.Warnf("Wiring-issue: %s", issue)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package domain
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Wiring", func() {
+	var bus eventutil.Bus
+	var logBuf *bytes.Buffer
+	var routinesCfg *RoutinesCfg
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		cfgProvider := domain_test.ConfigProvider{}
+
+		ioReader, err := domain_test.NewMockReader(nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		accountCfg, err := cfgProvider.AccountRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		accountCfg.UpdateLimitsCmd = model.UpdateLimits
+		accountCfg.AccountCfg.BalanceSnapshot = model.BalanceSnapshot
+		accountCfg.AccountCfg.SnapshotEveryNTxns = 10
+		accountViewCfg := cfgProvider.AccountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
+		txnCreatorCfg, err := cfgProvider.TxnCreatorRunCfg(bus)
+		Expect(err).ToNot(HaveOccurred())
+		writerCfg, err := cfgProvider.WriterRunCfg(bus, domain_test.NewMockWriter())
+		Expect(err).ToNot(HaveOccurred())
+
+		logBuf = &bytes.Buffer{}
+		routinesCfg = &RoutinesCfg{
+			Log: logger.NewStdLoggerWithCfg(logger.StdLoggerCfg{
+				Prefix: "runner",
+				Writer: logBuf,
+			}),
+			ReaderCfg: &reader.Cfg{
+				Log:        logger.NewStdLogger("reader"),
+				Bus:        bus,
+				Reader:     ioReader,
+				DataRead:   model.TxnRead,
+				ReadFailed: model.TxnReadFailed,
+			},
+			TxnCreatorCfg:  txnCreatorCfg,
+			AccountCfg:     accountCfg,
+			AccountViewCfg: accountViewCfg,
+			ProcessMgrCfg: &ProcessMgrCfg{
+				Log:               logger.NewStdLogger("ProcessMgr"),
+				Bus:               bus,
+				TxnResultViewRepo: accountViewCfg.ResultViewCfg.ResultRepo,
+
+				WriteData:  model.WriteData,
+				CreateTxn:  model.CreateTxn,
+				ProcessTxn: model.ProcessTxn,
+
+				TxnRead:         model.TxnRead,
+				TxnCreated:      model.TxnCreated,
+				TxnCreateFailed: model.TxnCreateFailed,
+				ReportWritten:   model.DataWritten,
+
+				ReportWriteFailed: model.WriteFailed,
+				TxnReadFailed:     model.TxnReadFailed,
+
+				IdleTimeoutSec:               1,
+				ReportWrittenEventTimeoutSec: 3,
+			},
+			WriterCfg: writerCfg,
+		}
+	})
+
+	AfterEach(func() {
+		bus.Terminate()
+	})
+
+	It("finds no issues in correctly wired config", func() {
+		// Limits-updates are published externally, and
+		// snapshots/seeds are only stored, so these
+		// aren't reported as issues.
+		Expect(CheckWiring(routinesCfg)).To(BeEmpty())
+	})
+
+	It("reports mismatched actions between routines", func() {
+		routinesCfg.AccountViewCfg.AccountDeposited = "AccountDepositedTypo"
+
+		Expect(CheckWiring(routinesCfg)).To(Equal([]WiringIssue{
+			{
+				Kind:       NoPublisher,
+				Action:     "AccountDepositedTypo",
+				Components: []string{"txnResultView"},
+			},
+			{
+				Kind:       NoSubscriber,
+				Action:     model.AccountDeposited.String(),
+				Components: []string{"account"},
+			},
+		}))
+	})
+
+	It("reports unset optional actions only on publishing side", func() {
+		routinesCfg.ProcessMgrCfg.TxnReadFailed = ""
+
+		Expect(CheckWiring(routinesCfg)).To(Equal([]WiringIssue{
+			{
+				Kind:       NoSubscriber,
+				Action:     model.TxnReadFailed.String(),
+				Components: []string{"reader"},
+			},
+		}))
+	})
+
+	It("logs issues as warnings by default", func() {
+		routinesCfg.WriterCfg.WriteData = "WriteDataTypo"
+
+		err := checkWiring(routinesCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logBuf.String()).To(ContainSubstring(
+			"action WriteDataTypo is subscribed by [writer], but not published by any routine",
+		))
+		Expect(logBuf.String()).To(ContainSubstring(
+			"action WriteData is published by [processMgr], but not subscribed by any routine",
+		))
+	})
+
+	It("fails run with WiringError in strict-mode", func() {
+		routinesCfg.WriterCfg.WriteData = "WriteDataTypo"
+		routinesCfg.WiringCheck = WiringCheckStrict
+
+		summary, err := RunRoutines(routinesCfg)
+		Expect(err).To(HaveOccurred())
+		Expect(summary).To(BeNil())
+
+		var wiringErr *WiringError
+		Expect(errors.As(err, &wiringErr)).To(BeTrue(), err.Error())
+		Expect(wiringErr.Issues).To(HaveLen(2))
+		Expect(logBuf.String()).To(BeEmpty())
+	})
+
+	It("skips checks when disabled", func() {
+		routinesCfg.WriterCfg.WriteData = "WriteDataTypo"
+		routinesCfg.WiringCheck = WiringCheckOff
+
+		err := checkWiring(routinesCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logBuf.String()).To(BeEmpty())
+	})
+
+	It("errors on invalid mode", func() {
+		routinesCfg.WiringCheck = "lenient"
+
+		err := checkWiring(routinesCfg)
+		Expect(err).To(HaveOccurred())
+	})
+})
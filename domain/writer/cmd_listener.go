@@ -16,7 +16,8 @@ type cmdListener struct {
 
 	bus       eventutil.Bus
 	writeData model.CmdAction
-	cmdSubs   map[model.CmdAction]<-chan interface{}
+	cmdSubs   map[model.CmdAction]<-chan model.Cmd
+	stats     *eventutil.ComponentStats
 
 	writerCfg *AggregateCfg
 }
@@ -27,6 +28,8 @@ type CmdListenerCfg struct {
 
 	Bus       eventutil.Bus   `validate:"nonnil"`
 	WriteData model.CmdAction `validate:"nonzero"`
+	// Optional, counts commands handled by listener.
+	Stats *eventutil.ComponentStats
 
 	WriterCfg *AggregateCfg `validate:"nonnil"`
 }
@@ -43,8 +46,8 @@ func InitCmdListener(ctx context.Context, cfg *CmdListenerCfg) error {
 	}
 
 	// Subscribe to actions from Bus
-	cmdSubs := make(map[model.CmdAction]<-chan interface{})
-	cmdSubs[cfg.WriteData], err = cfg.Bus.Subscribe(cfg.WriteData.String())
+	cmdSubs := make(map[model.CmdAction]<-chan model.Cmd)
+	cmdSubs[cfg.WriteData], err = eventutil.SubscribeCmds(cfg.Bus, cfg.WriteData)
 	if err != nil {
 		return errors.Wrapf(err, "error subscribing to event-bus for action: %s", cfg.WriteData)
 	}
@@ -57,6 +60,7 @@ func InitCmdListener(ctx context.Context, cfg *CmdListenerCfg) error {
 		bus:       cfg.Bus,
 		writeData: cfg.WriteData,
 		cmdSubs:   cmdSubs,
+		stats:     cfg.Stats,
 
 		writerCfg: cfg.WriterCfg,
 	}
@@ -77,17 +81,12 @@ func (cl *cmdListener) start(ctx context.Context) error {
 			}
 			return err
 
-		case msg := <-cl.cmdSubs[cl.writeData]:
-			// Validate message
-			if msg == nil {
-				continue
-			}
-			cmd, castSuccess := msg.(model.Cmd)
-			if !castSuccess {
-				cl.log.Warnf("error casting message to command")
-				continue
+		case cmd, ok := <-cl.cmdSubs[cl.writeData]:
+			if !ok {
+				return eventutil.SubscriptionClosedError(cl.writeData.String())
 			}
-			if cmd.Data() == nil {
+			if cmd.RawData() == nil {
+				cl.stats.IncIgnored()
 				continue
 			}
 
@@ -96,8 +95,13 @@ func (cl *cmdListener) start(ctx context.Context) error {
 			if err != nil {
 				return errors.Wrap(err, "error creating writer-instance")
 			}
+			// Report can be followed by per-customer output,
+			// so listener keeps handling commands until done.
 			err = writer.handleWriteDataCmd(cmd)
-			return errors.Wrap(err, "error handling write-data command")
+			if err != nil {
+				return errors.Wrap(err, "error handling write-data command")
+			}
+			cl.stats.IncProcessed()
 		}
 	}
 }
@@ -110,7 +114,7 @@ func (cl *cmdListener) unsubscribe() error {
 		}
 
 		cl.log.Debugf("Unsubscribing from action: %s", action)
-		err := cl.bus.Unsubscribe(channel, action.String())
+		err := eventutil.UnsubscribeCmds(cl.bus, channel, action)
 		if err != nil {
 			return errors.Wrapf(err, "error unsubscribing from event-bus for action: %s", action)
 		}
@@ -0,0 +1,43 @@
+package writer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// writeFileAtomic writes data as a line to file at path, creating
+// its directory if needed. Data is written to a temporary file in
+// same directory, which then replaces file, so file is never left
+// partially written.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.Wrap(err, "error creating target-directory")
+	}
+
+	tmpFile, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "error creating temporary file")
+	}
+	// No-op once file is renamed
+	defer os.Remove(tmpFile.Name())
+
+	err = func() error {
+		defer tmpFile.Close()
+		// Data is shared with other routines, so it's copied
+		_, err := tmpFile.Write(append(data[:len(data):len(data)], '\n'))
+		if err != nil {
+			return errors.Wrap(err, "error writing to temporary file")
+		}
+		return errors.Wrap(tmpFile.Sync(), "error syncing temporary file")
+	}()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile.Name(), path)
+	return errors.Wrap(err, "error renaming temporary file to target")
+}
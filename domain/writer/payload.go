@@ -0,0 +1,160 @@
+package writer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PayloadMagic prefixes serialized Payloads, so writer can tell
+// envelopes apart from legacy raw payloads. The leading NUL-byte
+// doesn't occur in text-reports, and marks payloads that were
+// intended as envelopes, even if rest of the magic is corrupted.
+const PayloadMagic = "\x00ESBA-PAYLOAD:"
+
+// PayloadVersion is the latest Payload-version supported by writer.
+// Payloads with other versions are rejected instead of written.
+const PayloadVersion = 1
+
+// Payload is a versioned envelope for data of write-data commands.
+// Use #NewPayloadBuilder to create serialized payloads.
+type Payload struct {
+	Version int `json:"version"`
+	// Optional, path of file data is written to instead
+	// of sinks, such as for per-customer output. Only
+	// written by writers allowing file-targets.
+	Target string `json:"target,omitempty"`
+	// Reserved for encoded (such as compressed)
+	// data, must be blank in current version.
+	Encoding string     `json:"encoding,omitempty"`
+	Chunk    *ChunkInfo `json:"chunk,omitempty"`
+	Data     []byte     `json:"data"`
+}
+
+// ChunkInfo is position of a chunk in chunked data.
+// Current version only supports single-chunk data.
+type ChunkInfo struct {
+	Index int `json:"index"`
+	Total int `json:"total"`
+}
+
+// PayloadBuilder builds serialized Payloads of latest version.
+// Use #NewPayloadBuilder to create new instance.
+type PayloadBuilder struct {
+	payload Payload
+}
+
+// NewPayloadBuilder creates a PayloadBuilder for data.
+func NewPayloadBuilder(data []byte) *PayloadBuilder {
+	return &PayloadBuilder{
+		payload: Payload{
+			Version: PayloadVersion,
+			Data:    data,
+		},
+	}
+}
+
+// WithTarget sets target of payload.
+func (b *PayloadBuilder) WithTarget(target string) *PayloadBuilder {
+	b.payload.Target = target
+	return b
+}
+
+// WithEncoding sets encoding of payload-data.
+func (b *PayloadBuilder) WithEncoding(encoding string) *PayloadBuilder {
+	b.payload.Encoding = encoding
+	return b
+}
+
+// WithChunk sets position of payload-data in chunked data.
+func (b *PayloadBuilder) WithChunk(index, total int) *PayloadBuilder {
+	b.payload.Chunk = &ChunkInfo{
+		Index: index,
+		Total: total,
+	}
+	return b
+}
+
+// Build validates payload, and serializes it
+// as a magic-prefixed JSON-document.
+func (b *PayloadBuilder) Build() ([]byte, error) {
+	err := b.payload.validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating payload")
+	}
+	doc, err := json.Marshal(&b.payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshalling payload")
+	}
+	return append([]byte(PayloadMagic), doc...), nil
+}
+
+// validate checks if payload is supported by this writer.
+func (p *Payload) validate() error {
+	if p.Version != PayloadVersion {
+		return fmt.Errorf(
+			"unsupported payload-version %d (supported: %d)",
+			p.Version, PayloadVersion,
+		)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(p.Target), "/") {
+		if elem == ".." {
+			return fmt.Errorf("payload-target %q must not contain '..'", p.Target)
+		}
+	}
+	if p.Encoding != "" {
+		return fmt.Errorf("unsupported payload-encoding %q", p.Encoding)
+	}
+	if p.Chunk != nil && (p.Chunk.Index != 0 || p.Chunk.Total != 1) {
+		return fmt.Errorf(
+			"unsupported payload-chunk %d of %d, only single-chunk data is supported",
+			p.Chunk.Index, p.Chunk.Total,
+		)
+	}
+	return nil
+}
+
+// payloadMode is how command-data was decoded by #decodePayload.
+type payloadMode int
+
+const (
+	// Command-data is a magic-prefixed envelope
+	envelopeMode payloadMode = iota
+	// Command-data is written as is
+	rawMode
+	// Command-data starts like an envelope, but magic is
+	// corrupted, so it's written as is with a warning
+	corruptedMagicMode
+)
+
+// decodePayload returns payload to be written from command-data.
+// Data without PayloadMagic prefix is returned as payload-data,
+// while envelopes which can't be decoded, or aren't supported
+// by this writer, return an error.
+func decodePayload(cmdData []byte) (*Payload, payloadMode, error) {
+	if !bytes.HasPrefix(cmdData, []byte(PayloadMagic)) {
+		rawPayload := &Payload{
+			Version: PayloadVersion,
+			Data:    cmdData,
+		}
+		if bytes.HasPrefix(cmdData, []byte(PayloadMagic[:1])) {
+			return rawPayload, corruptedMagicMode, nil
+		}
+		return rawPayload, rawMode, nil
+	}
+
+	payload := &Payload{}
+	err := json.Unmarshal(cmdData[len(PayloadMagic):], payload)
+	if err != nil {
+		return nil, envelopeMode, errors.Wrap(err, "error unmarshalling payload")
+	}
+	err = payload.validate()
+	if err != nil {
+		return nil, envelopeMode, errors.Wrap(err, "error validating payload")
+	}
+	return payload, envelopeMode, nil
+}
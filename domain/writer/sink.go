@@ -0,0 +1,183 @@
+package writer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+)
+
+// ResultSink is a target data is written to,
+// such as a file or an HTTP endpoint.
+type ResultSink interface {
+	// Name identifies sink in logs and errors.
+	Name() string
+	// WriteResult writes data to sink, as a single line/request.
+	// Data is shared with other sinks, and must not be modified.
+	WriteResult(data []byte) error
+}
+
+// writerSink writes data as lines to a buffered-writer.
+type writerSink struct {
+	name       string
+	buffWriter *bufio.Writer
+}
+
+// NewWriterSink returns ResultSink writing data as lines to
+// provided writer, flushing after every line. If writer isn't
+// a bufio-writer, it is wrapped in one.
+func NewWriterSink(name string, w io.Writer) ResultSink {
+	// Check if passed writer is bufio-writer,
+	// else create bufio-writer
+	buffWriter, castSuccess := w.(*bufio.Writer)
+	if !castSuccess {
+		buffWriter = bufio.NewWriter(w)
+	}
+	return &writerSink{
+		name:       name,
+		buffWriter: buffWriter,
+	}
+}
+
+func (s *writerSink) Name() string {
+	return s.name
+}
+
+func (s *writerSink) WriteResult(data []byte) error {
+	_, err := fmt.Fprintln(s.buffWriter, string(data))
+	if err != nil {
+		return errors.Wrap(err, "error writing to writer")
+	}
+	err = s.buffWriter.Flush()
+	return errors.Wrap(err, "error flushing bufferred-writer")
+}
+
+// HTTPSinkCfg defines config for HTTP-sink.
+type HTTPSinkCfg struct {
+	Name string `validate:"nonzero"`
+	URL  string `validate:"nonzero"`
+	// Optional, defaults to "application/json".
+	ContentType string
+	// Optional, defaults to http.Client
+	// with 10 seconds timeout.
+	Client *http.Client
+}
+
+// httpSink posts data to an HTTP endpoint.
+type httpSink struct {
+	name        string
+	url         string
+	contentType string
+	client      *http.Client
+}
+
+// NewHTTPSink returns ResultSink posting data to URL in config.
+// Responses with status other than 2xx are returned as errors.
+func NewHTTPSink(cfg HTTPSinkCfg) (ResultSink, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{
+			Timeout: 10 * time.Second,
+		}
+	}
+	return &httpSink{
+		name:        cfg.Name,
+		url:         cfg.URL,
+		contentType: cfg.ContentType,
+		client:      cfg.Client,
+	}, nil
+}
+
+func (s *httpSink) Name() string {
+	return s.name
+}
+
+func (s *httpSink) WriteResult(data []byte) error {
+	resp, err := s.client.Post(s.url, s.contentType, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "error posting data")
+	}
+	defer resp.Body.Close()
+	// Drain body so connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response-status: %s", resp.Status)
+	}
+	return nil
+}
+
+// SinkError is error returned by a sink.
+type SinkError struct {
+	Sink string
+	Err  error
+}
+
+func (e SinkError) Error() string {
+	return fmt.Sprintf("[%s]: %s", e.Sink, e.Err)
+}
+
+// MultiSinkError is returned if any sinks
+// fail to write data. Data might have been
+// written to other sinks.
+type MultiSinkError struct {
+	// Errors of failed sinks, in order
+	// sinks were configured in.
+	Errors []SinkError
+}
+
+func (e *MultiSinkError) Error() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%d sink(s) failed to write data:", len(e.Errors))
+	for _, sinkErr := range e.Errors {
+		b.WriteString("\n")
+		b.WriteString(sinkErr.Error())
+	}
+	return b.String()
+}
+
+// writeToSinks writes data to all sinks concurrently, and
+// returns *MultiSinkError if any sinks fail. Every sink is
+// written to, regardless of failure of others.
+func writeToSinks(sinks []ResultSink, data []byte) error {
+	errs := make([]error, len(sinks))
+	wg := &sync.WaitGroup{}
+	for i, sink := range sinks {
+		wg.Add(1)
+		go func(i int, sink ResultSink) {
+			defer wg.Done()
+			errs[i] = sink.WriteResult(data)
+		}(i, sink)
+	}
+	wg.Wait()
+
+	var sinkErrs []SinkError
+	for i, err := range errs {
+		if err != nil {
+			sinkErrs = append(sinkErrs, SinkError{
+				Sink: sinks[i].Name(),
+				Err:  err,
+			})
+		}
+	}
+	if len(sinkErrs) > 0 {
+		return &MultiSinkError{
+			Errors: sinkErrs,
+		}
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package writer
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 
@@ -9,77 +8,175 @@ import (
 	"github.com/pkg/errors"
 	"gopkg.in/validator.v2"
 
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
 	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/trace"
 )
 
-// writer writes data to specific
-// buffered-writer interface.
+// writer writes data to its sinks.
 // Use #newWriter to create new instance.
 type writer struct {
-	log        logger.Logger
-	buffWriter *bufio.Writer
+	log    logger.Logger
+	sinks  []ResultSink
+	tracer trace.Tracer
+
+	allowFileTargets bool
 
 	eventRepo   eventutil.EventRepo
 	dataWritten model.EventAction
+	writeFailed model.EventAction
+}
+
+// WriteFailure contains data/info for write-failure.
+type WriteFailure struct {
+	Error string `json:"error"`
 }
 
 // AggregateCfg defines config for Writer-aggregate.
 type AggregateCfg struct {
-	Log    logger.Logger `validate:"nonnil"`
-	Writer io.Writer     `validate:"nonnil"`
+	Log logger.Logger `validate:"nonnil"`
+	// Optional if Sinks are provided, data is written as lines
+	// to this writer. Wrapped in bufio-writer if it isn't one.
+	Writer io.Writer
+	// Optional, additional sinks data is written to. Data is
+	// written to Writer and all sinks concurrently, and
+	// DataWritten is only published after all succeed.
+	Sinks []ResultSink
+	// Optional. If set, payloads with a target (see
+	// Payload#Target) are written atomically to file at
+	// target-path, instead of to sinks. Otherwise, such
+	// payloads fail to be written.
+	AllowFileTargets bool
 
 	EventRepo   eventutil.EventRepo `validate:"nonnil"`
 	DataWritten model.EventAction   `validate:"nonzero"`
+	// Optional, WriteFailure is published
+	// on this action if writing data fails.
+	WriteFailed model.EventAction
+
+	// Optional, records span of every write, keyed by
+	// command's correlation (or its ID, if not set).
+	Tracer trace.Tracer
 }
 
-func newWriter(cfg *AggregateCfg) (*writer, error) {
+// Validate validates config, including invariants between its fields.
+func (cfg *AggregateCfg) Validate() error {
 	err := validator.Validate(cfg)
+	if err != nil {
+		return err
+	}
+	for i, sink := range cfg.Sinks {
+		if sink == nil {
+			return fmt.Errorf("sink at index %d is nil", i)
+		}
+	}
+	if cfg.Writer == nil && len(cfg.Sinks) == 0 {
+		return errors.New("either writer or sinks must be provided")
+	}
+	return nil
+}
+
+func newWriter(cfg *AggregateCfg) (*writer, error) {
+	err := cfg.Validate()
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if passed writer is bufio-writer,
-	// else create bufio-writer
-	buffWriter, castSuccess := cfg.Writer.(*bufio.Writer)
-	if !castSuccess {
-		buffWriter = bufio.NewWriter(cfg.Writer)
+	sinks := make([]ResultSink, 0, len(cfg.Sinks)+1)
+	if cfg.Writer != nil {
+		sinks = append(sinks, NewWriterSink("writer", cfg.Writer))
 	}
+	sinks = append(sinks, cfg.Sinks...)
 
 	return &writer{
-		log:        cfg.Log,
-		buffWriter: buffWriter,
+		log:    cfg.Log,
+		sinks:  sinks,
+		tracer: trace.OrNoop(cfg.Tracer),
+
+		allowFileTargets: cfg.AllowFileTargets,
 
 		eventRepo:   cfg.EventRepo,
 		dataWritten: cfg.DataWritten,
+		writeFailed: cfg.WriteFailed,
 	}, nil
 }
 
 func (w *writer) handleWriteDataCmd(cmd model.Cmd) error {
-	if cmd.Data() == nil {
+	if cmd.RawData() == nil {
 		w.log.Debugf("[CMD: %s] ignored command with nil data", cmd.ID())
 		return nil
 	}
 
-	err := w.write(cmd.ID(), string(cmd.Data()))
-	return errors.Wrap(err, "error writing data")
+	err := w.write(cmd)
+	if err != nil {
+		err = errors.Wrap(err, "error writing data")
+		if w.writeFailed != "" {
+			pubErr := w.publishWriteFailure(cmd, err)
+			if pubErr != nil {
+				w.log.Errorf("[CMD: %s]: %s", cmd.ID(), pubErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (w *writer) publishWriteFailure(cmd model.Cmd, writeErr error) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return errors.Wrap(err, "error generating aggregate-id")
+	}
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID:    id.String(),
+		CausationID:    cmd.CausationID(),
+		CausationKey:   cmd.ID(),
+		CorrelationKey: cmd.CorrelationKey(),
+		Action:         w.writeFailed,
+		Data: &WriteFailure{
+			Error: writeErr.Error(),
+		},
+		Priority: model.PriorityControl,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating event")
+	}
+
+	w.log.Tracef("[CMD: %s]: [Event: %s]: Publishing write-failed event", cmd.ID(), event.ID())
+	err = w.eventRepo.InsertAndPublish(event)
+	return errors.Wrap(eventutil.MarkFatal(err), "error inserting event to event-repo")
 }
 
-func (w *writer) write(cmdID string, data string) error {
-	logPrefix := fmt.Sprintf("[CMD: %s]:", cmdID)
+func (w *writer) write(cmd model.Cmd) error {
+	logPrefix := fmt.Sprintf("[CMD: %s]:", cmd.ID())
+	correlationID := cmd.CorrelationKey()
+	if correlationID == "" {
+		correlationID = cmd.ID()
+	}
+	span := w.tracer.StartSpan(trace.SpanReportWrite, correlationID)
+	defer span.End()
 
-	// Write data to buffered-writer
-	w.log.Tracef("%s Writing result to output-file", logPrefix)
-	_, err := fmt.Fprintln(w.buffWriter, data)
+	payload, mode, err := decodePayload(cmd.RawData())
 	if err != nil {
-		return errors.Wrap(err, "error writing to output-file")
+		return errors.Wrap(err, "error decoding command-data")
+	}
+	if mode == rawMode {
+		deprecation.Note(deprecation.RawWriteData, fmt.Sprintf("command: %s", cmd.ID()))
 	}
-	err = w.buffWriter.Flush()
+	if mode == corruptedMagicMode {
+		w.log.Warnf(
+			"%s Command-data looks like a payload-envelope with corrupted magic, writing data as is",
+			logPrefix,
+		)
+	}
+
+	payloadData := payload.Data
+	err = w.writePayload(logPrefix, payload)
 	if err != nil {
-		return errors.Wrap(err, "error flushing bufferred-writer")
+		return err
 	}
-	w.log.Tracef("%s Wrote result to output-file", logPrefix)
+	span.End()
 
 	id, err := uuid.NewRandom()
 	if err != nil {
@@ -88,9 +185,14 @@ func (w *writer) write(cmdID string, data string) error {
 	// Send result-event
 	event, err := model.NewEvent(&model.EventCfg{
 		AggregateID:    id.String(),
-		CorrelationKey: cmdID,
+		CausationID:    cmd.CausationID(),
+		CausationKey:   cmd.ID(),
+		CorrelationKey: cmd.CorrelationKey(),
 		Action:         w.dataWritten,
-		Data:           []byte(data),
+		Data:           payloadData,
+		// Confirms control-flow (such as writing report),
+		// so it shouldn't wait behind other messages.
+		Priority: model.PriorityControl,
 	})
 	if err != nil {
 		return errors.Wrap(err, "error creating event")
@@ -100,9 +202,34 @@ func (w *writer) write(cmdID string, data string) error {
 	w.log.Tracef("%s Publishing data-written event", logPrefix)
 	err = w.eventRepo.InsertAndPublish(event)
 	if err != nil {
-		return errors.Wrap(err, "error inserting event to event-repo")
+		return errors.Wrap(eventutil.MarkFatal(err), "error inserting event to event-repo")
 	}
 	w.log.Tracef("%s Published data-written event", logPrefix)
 
 	return nil
 }
+
+// writePayload writes payload-data to its target-file
+// if it has a target, or to sinks otherwise.
+func (w *writer) writePayload(logPrefix string, payload *Payload) error {
+	if payload.Target == "" {
+		w.log.Tracef("%s Writing result to %d sink(s)", logPrefix, len(w.sinks))
+		err := writeToSinks(w.sinks, payload.Data)
+		if err != nil {
+			return err
+		}
+		w.log.Tracef("%s Wrote result to sink(s)", logPrefix)
+		return nil
+	}
+
+	if !w.allowFileTargets {
+		return fmt.Errorf("payload has target %q, but file-targets are not allowed", payload.Target)
+	}
+	w.log.Tracef("%s Writing result to target: %s", logPrefix, payload.Target)
+	err := writeFileAtomic(payload.Target, payload.Data)
+	if err != nil {
+		return errors.Wrapf(err, "error writing to target %q", payload.Target)
+	}
+	w.log.Tracef("%s Wrote result to target: %s", logPrefix, payload.Target)
+	return nil
+}
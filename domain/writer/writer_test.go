@@ -0,0 +1,299 @@
+package writer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/deprecation"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+func TestWriter(t *testing.T) {
+	// Warnings are checked by tests
+	os.Setenv("LOG_LEVEL", "warn")
+	os.Setenv("EVENTBUS_LOG_LEVEL", "error")
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Writer Suite")
+}
+
+var _ = Describe("Writer", func() {
+	const (
+		WriteDataCmd model.CmdAction   = "WriteData"
+		DataWritten  model.EventAction = "DataWritten"
+		WriteFailed  model.EventAction = "WriteFailed"
+	)
+
+	var bus eventutil.Bus
+	var recorder *testsupport.BusRecorder
+	var eventRepo eventutil.EventRepo
+	var output *bytes.Buffer
+	var logBuf *bytes.Buffer
+	var w *writer
+
+	const report = `{"id":"1","customer_id":"1","accepted":true}`
+
+	// Handles a write-data command with data, and
+	// returns error returned by writer, if any.
+	var handle = func(data []byte) error {
+		cmd, err := model.NewCmd(&model.CmdCfg{
+			Action: WriteDataCmd,
+			Data:   data,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return w.handleWriteDataCmd(cmd)
+	}
+
+	var waitForEvent = func(action model.EventAction) model.Event {
+		msg, err := recorder.WaitFor(action.String(), nil, 2*time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		return msg.(model.Event)
+	}
+
+	BeforeEach(func() {
+		var err error
+		bus, err = eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		recorder, err = testsupport.NewBusRecorder(bus, DataWritten.String(), WriteFailed.String())
+		Expect(err).ToNot(HaveOccurred())
+		eventRepo, err = eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+			Bus:            bus,
+			EventStore:     eventutil.NewMemoryEventStore(),
+			UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		output = &bytes.Buffer{}
+		logBuf = &bytes.Buffer{}
+		w, err = newWriter(&AggregateCfg{
+			Log: logger.NewStdLoggerWithCfg(logger.StdLoggerCfg{
+				Prefix: "writer/Aggregate",
+				Writer: logBuf,
+			}),
+			Writer: output,
+
+			EventRepo:   eventRepo,
+			DataWritten: DataWritten,
+			WriteFailed: WriteFailed,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		recorder.Stop()
+		bus.Terminate()
+	})
+
+	It("writes legacy raw payloads as is", func() {
+		usesBefore := deprecation.Snapshot()
+		err := handle([]byte(report))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deprecation.Snapshot().Since(usesBefore)).To(Equal(deprecation.Counts{
+			deprecation.RawWriteData: 1,
+		}))
+
+		Expect(output.String()).To(Equal(report + "\n"))
+		event := waitForEvent(DataWritten)
+		Expect(string(event.Data())).To(Equal(report))
+		Expect(logBuf.String()).To(BeEmpty())
+	})
+
+	It("writes data of v1 envelopes", func() {
+		payload, err := NewPayloadBuilder([]byte(report)).
+			WithChunk(0, 1).
+			Build()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(payload)).To(HavePrefix(PayloadMagic))
+
+		usesBefore := deprecation.Snapshot()
+		err = handle(payload)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deprecation.Snapshot().Since(usesBefore)).To(BeEmpty())
+
+		Expect(output.String()).To(Equal(report + "\n"))
+		event := waitForEvent(DataWritten)
+		Expect(string(event.Data())).To(Equal(report))
+		// Confirmation skips ahead of backlogged messages
+		Expect(event.Priority()).To(Equal(model.PriorityControl))
+	})
+
+	It("writes targeted payloads to files only if file-targets are allowed", func() {
+		tmpDir, err := ioutil.TempDir("", "writer-targets")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		target := filepath.Join(tmpDir, "results", "1.ndjson")
+
+		payload, err := NewPayloadBuilder([]byte(report)).WithTarget(target).Build()
+		Expect(err).ToNot(HaveOccurred())
+		err = handle(payload)
+		Expect(err).To(MatchError(ContainSubstring("file-targets are not allowed")))
+		waitForEvent(WriteFailed)
+
+		w.allowFileTargets = true
+		err = handle(payload)
+		Expect(err).ToNot(HaveOccurred())
+		waitForEvent(DataWritten)
+
+		// Not written to sinks
+		Expect(output.String()).To(BeEmpty())
+		data, err := ioutil.ReadFile(target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(report + "\n"))
+		// Temporary file is replaced by target
+		files, err := ioutil.ReadDir(filepath.Dir(target))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+
+		_, err = NewPayloadBuilder([]byte(report)).WithTarget("../1.ndjson").Build()
+		Expect(err).To(MatchError(ContainSubstring("must not contain '..'")))
+	})
+
+	It("rejects unknown payload-versions with WriteFailed event", func() {
+		doc, err := json.Marshal(&Payload{
+			Version: PayloadVersion + 1,
+			Data:    []byte(report),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		err = handle(append([]byte(PayloadMagic), doc...))
+		Expect(err).To(HaveOccurred())
+
+		Expect(output.String()).To(BeEmpty())
+		event := waitForEvent(WriteFailed)
+		failure := &WriteFailure{}
+		err = json.Unmarshal(event.Data(), failure)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(failure.Error).To(ContainSubstring("unsupported payload-version 2"))
+		Expect(event.Priority()).To(Equal(model.PriorityControl))
+		Expect(recorder.Messages(DataWritten.String())).To(BeEmpty())
+	})
+
+	It("rejects unsupported payload-features when building", func() {
+		_, err := NewPayloadBuilder([]byte(report)).WithEncoding("gzip").Build()
+		Expect(err).To(HaveOccurred())
+		_, err = NewPayloadBuilder([]byte(report)).WithChunk(1, 2).Build()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("falls back to raw-mode with a warning for corrupted magic", func() {
+		payload, err := NewPayloadBuilder([]byte(report)).Build()
+		Expect(err).ToNot(HaveOccurred())
+		// Corrupt magic after its leading marker
+		payload[1] = 'X'
+
+		err = handle(payload)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(output.String()).To(Equal(string(payload) + "\n"))
+		waitForEvent(DataWritten)
+		Expect(logBuf.String()).To(ContainSubstring("corrupted magic"))
+	})
+
+	Describe("multiple sinks", func() {
+		var posted chan string
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			posted = make(chan string, 1)
+			server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				Expect(err).ToNot(HaveOccurred())
+				posted <- string(body)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		var newMultiSinkWriter = func(sinks ...ResultSink) {
+			var err error
+			w, err = newWriter(&AggregateCfg{
+				Log:    logger.NewStdLogger("writer/Aggregate"),
+				Writer: output,
+				Sinks:  sinks,
+
+				EventRepo:   eventRepo,
+				DataWritten: DataWritten,
+				WriteFailed: WriteFailed,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("writes report to all sinks before publishing DataWritten", func() {
+			httpSink, err := NewHTTPSink(HTTPSinkCfg{
+				Name: "http",
+				URL:  server.URL,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			newMultiSinkWriter(httpSink)
+
+			err = handle([]byte(report))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(output.String()).To(Equal(report + "\n"))
+			Expect(posted).To(Receive(Equal(report)))
+			event := waitForEvent(DataWritten)
+			Expect(string(event.Data())).To(Equal(report))
+		})
+
+		It("surfaces errors of failing sinks with WriteFailed event", func() {
+			failing := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer failing.Close()
+
+			httpSink, err := NewHTTPSink(HTTPSinkCfg{
+				Name: "http",
+				URL:  server.URL,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			failingSink, err := NewHTTPSink(HTTPSinkCfg{
+				Name: "failing-http",
+				URL:  failing.URL,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			newMultiSinkWriter(failingSink, httpSink)
+
+			err = handle([]byte(report))
+			var sinkErr *MultiSinkError
+			Expect(errors.As(err, &sinkErr)).To(BeTrue())
+			Expect(sinkErr.Errors).To(HaveLen(1))
+			Expect(sinkErr.Errors[0].Sink).To(Equal("failing-http"))
+
+			// Healthy sinks are still written to
+			Expect(output.String()).To(Equal(report + "\n"))
+			Expect(posted).To(Receive(Equal(report)))
+
+			event := waitForEvent(WriteFailed)
+			failure := &WriteFailure{}
+			err = json.Unmarshal(event.Data(), failure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(failure.Error).To(ContainSubstring("[failing-http]: unexpected response-status: 503"))
+			Expect(recorder.Messages(DataWritten.String())).To(BeEmpty())
+		})
+
+		It("requires either writer or sinks", func() {
+			_, err := newWriter(&AggregateCfg{
+				Log:         logger.NewStdLogger("writer/Aggregate"),
+				EventRepo:   eventRepo,
+				DataWritten: DataWritten,
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
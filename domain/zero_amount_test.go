@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/domain_test"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var _ = Describe("Zero-amount transactions", func() {
+	// Budget of a single run, specs are budgeted by runs
+	const runTimeout = 10 * time.Second
+
+	// Customer "1" has four transactions on same day, with
+	// daily number of transactions limited to 3. Transaction
+	// "1" is repeated with same ID.
+	reqs := []txn.CreateTxnReq{
+		{ID: "1", CustomerID: "1", LoadAmount: "$0.00", Time: "2000-01-05T01:00:00Z"},
+		{ID: "2", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T02:00:00Z"},
+		{ID: "3", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T03:00:00Z"},
+		{ID: "4", CustomerID: "1", LoadAmount: "$10", Time: "2000-01-05T04:00:00Z"},
+		{ID: "1", CustomerID: "1", LoadAmount: "$0.00", Time: "2000-01-05T05:00:00Z"},
+		{ID: "5", CustomerID: "2", LoadAmount: "$20", Time: "2000-01-05T01:00:00Z"},
+	}
+
+	// run runs routines on reqs with zero-amount policy, and
+	// returns run-summary, and "<id>:<disposition>" of results
+	// in input-order.
+	run := func(
+		policy txn.ZeroAmountPolicy,
+		excludeCounts bool,
+	) (*RunSummary, []string) {
+		bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+		Expect(err).ToNot(HaveOccurred())
+		defer bus.Terminate()
+
+		ioReader, err := domain_test.NewMockReader(reqs)
+		Expect(err).ToNot(HaveOccurred())
+		ioWriter := domain_test.NewMockWriter()
+
+		routinesCfg := routinesRunCfg(bus, ioReader, ioWriter)
+		routinesCfg.WiringCheck = WiringCheckStrict
+		accountCfg := routinesCfg.AccountCfg
+		accountCfg.AccountCfg.NumDailyTxnsLimit = 3
+		accountCfg.AccountCfg.ExcludeZeroAmountTxnCounts = excludeCounts
+		txnCreatorCfg := routinesCfg.TxnCreatorCfg
+		txnCreatorCfg.CreatorCfg.ZeroAmountPolicy = policy
+
+		processMgrCfg := routinesCfg.ProcessMgrCfg
+		processMgrCfg.ReportWriteFailed = model.WriteFailed
+		processMgrCfg.OrderedDispatch = true
+		processMgrCfg.ReportSort = ReportSortInputOrder
+		// Every line must have a result, or have failed creation
+		processMgrCfg.VerifyInputOrder = true
+		if policy == txn.ZeroAmountSkip {
+			txnCreatorCfg.CreatorCfg.TxnSkipped = model.TxnSkipped
+			routinesCfg.AccountViewCfg.TxnSkipped = model.TxnSkipped
+			processMgrCfg.TxnSkipped = model.TxnSkipped
+		}
+
+		// Every line has a result, except rejected zero-amounts
+		numResults := len(reqs)
+		if policy == txn.ZeroAmountReject {
+			numResults -= 2
+		}
+		resultRepo := routinesCfg.AccountViewCfg.ResultViewCfg.ResultRepo.(accountview.SequencedTxnResultViewRepo)
+		isSettled := func() bool {
+			return len(resultRepo.Entries()) >= numResults
+		}
+
+		summary, err := runRoutinesSettled(routinesCfg, clock.NewFakeClock(time.Now()), isSettled, runTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		results := make([]string, 0)
+		for _, line := range strings.Split(strings.TrimSpace(string(ioWriter.Content())), "\n") {
+			entry := accountview.TxnResultEntry{}
+			Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+			disposition := "declined"
+			switch {
+			case entry.Accepted:
+				disposition = "accepted"
+			case entry.Skipped:
+				disposition = "skipped"
+			}
+			results = append(results, entry.ID+":"+disposition)
+		}
+		return summary, results
+	}
+
+	It("counts allowed zero-amounts towards number of transactions", func(done Done) {
+		summary, results := run(txn.ZeroAmountAllow, false)
+		Expect(results).To(Equal([]string{
+			"1:accepted", "2:accepted", "3:accepted",
+			// Fourth transaction of day
+			"4:declined",
+			"1:declined",
+			"5:accepted",
+		}))
+		Expect(summary.ValidTxns).To(Equal(6))
+		Expect(summary.SkippedTxns).To(BeZero())
+
+		close(done)
+	}, runTimeout.Seconds())
+
+	It("excludes allowed zero-amounts from number of transactions if configured", func(done Done) {
+		summary, results := run(txn.ZeroAmountAllow, true)
+		Expect(results).To(Equal([]string{
+			"1:accepted", "2:accepted", "3:accepted", "4:accepted",
+			// Still recorded for duplicate-detection
+			"1:declined",
+			"5:accepted",
+		}))
+		Expect(summary.ValidTxns).To(Equal(6))
+
+		close(done)
+	}, runTimeout.Seconds())
+
+	It("rejects zero-amounts", func(done Done) {
+		summary, results := run(txn.ZeroAmountReject, false)
+		// Rejected transactions have no result
+		Expect(results).To(Equal([]string{
+			"2:accepted", "3:accepted", "4:accepted", "5:accepted",
+		}))
+		Expect(summary.LinesRead).To(Equal(6))
+		Expect(summary.ValidTxns).To(Equal(4))
+		Expect(summary.SkippedTxns).To(BeZero())
+
+		close(done)
+	}, runTimeout.Seconds())
+
+	It("records skipped zero-amounts without processing these", func(done Done) {
+		summary, results := run(txn.ZeroAmountSkip, false)
+		Expect(results).To(Equal([]string{
+			"1:skipped", "2:accepted", "3:accepted", "4:accepted",
+			// Not processed, so not a duplicate either
+			"1:skipped",
+			"5:accepted",
+		}))
+		Expect(summary.LinesRead).To(Equal(6))
+		Expect(summary.ValidTxns).To(Equal(4))
+		Expect(summary.SkippedTxns).To(Equal(2))
+
+		close(done)
+	}, runTimeout.Seconds())
+})
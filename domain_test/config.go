@@ -48,11 +48,18 @@ func (cp *ConfigProvider) AccountRunCfg(
 			NumDailyTxnsLimit:     globalcfg.NumDailyTxnsLimit,
 			WeeklyTxnsAmountLimit: globalcfg.WeeklyTxnsAmountLimit,
 			NumWeeklyTxnsLimit:    globalcfg.NumWeeklyTxnsLimit,
+			MonthlyAllowance:      globalcfg.MonthlyAllowance,
+			MaxCarryOver:          globalcfg.MaxCarryOver,
+
+			DuplicateScope: globalcfg.DuplicateScope,
 
 			AccountDeposited:     model.AccountDeposited,
 			AccountWithdrawn:     model.AccountWithdrawn,
 			DuplicateTxn:         model.DuplicateTxn,
 			AccountLimitExceeded: model.AccountLimitExceeded,
+			AccountSeeded:        model.AccountSeeded,
+			AccountRecovered:     model.AccountRecovered,
+			PartiallyWithdrawn:   model.PartialWithdrawal,
 		},
 	}, nil
 }
@@ -63,7 +70,9 @@ func (cp *ConfigProvider) AccountViewRunCfg(
 	bus eventutil.Bus,
 	accountEventRepo eventutil.EventRepo,
 ) *accountview.EventListenerCfg {
-	txnResultViewRepo := accountview.NewMemoryTxnResultViewRepo()
+	txnResultViewRepo := accountview.NewMemoryTxnResultViewRepo(accountview.MemoryTxnResultViewRepoCfg{
+		ExcludeTestTxns: globalcfg.ExcludeTestTxns,
+	})
 
 	return &accountview.EventListenerCfg{
 		Log: logger.NewStdLogger("accountView/EventListener"),
@@ -73,6 +82,7 @@ func (cp *ConfigProvider) AccountViewRunCfg(
 		AccountWithdrawn:     model.AccountWithdrawn,
 		DuplicateTxn:         model.DuplicateTxn,
 		AccountLimitExceeded: model.AccountLimitExceeded,
+		RebuildCustomerCmd:   model.RebuildCustomer,
 
 		ResultViewCfg: &accountview.TxnResultViewCfg{
 			Log:        logger.NewStdLogger("accountView/TxnResultView"),
@@ -84,6 +94,9 @@ func (cp *ConfigProvider) AccountViewRunCfg(
 			AccountWithdrawn:     model.AccountWithdrawn,
 			DuplicateTxn:         model.DuplicateTxn,
 			AccountLimitExceeded: model.AccountLimitExceeded,
+			AccountSeeded:        model.AccountSeeded,
+			AccountRecovered:     model.AccountRecovered,
+			PartiallyWithdrawn:   model.PartialWithdrawal,
 		},
 	}
 }
@@ -107,9 +120,11 @@ func (cp *ConfigProvider) TxnCreatorRunCfg(bus eventutil.Bus) (*txn.CmdListenerC
 		CreateTxnCmd: model.CreateTxn,
 
 		CreatorCfg: &txn.CreatorCfg{
-			Log:            logger.NewStdLogger("txn/Aggregate"),
-			EventRepo:      txnCreatorEventRepo,
-			DefaultTimeFmt: globalcfg.TxnRequestTimeFmt,
+			Log:                 logger.NewStdLogger("txn/Aggregate"),
+			EventRepo:           txnCreatorEventRepo,
+			DefaultTimeFmt:      globalcfg.TxnRequestTimeFmt,
+			MaxAmountDecimals:   globalcfg.MaxAmountDecimals,
+			StrictTimeRoundTrip: globalcfg.StrictTimeRoundTrip,
 
 			TxnCreated:      model.TxnCreated,
 			TxnCreateFailed: model.TxnCreateFailed,
@@ -144,6 +159,7 @@ func (cp *ConfigProvider) WriterRunCfg(
 
 			EventRepo:   writerEventRepo,
 			DataWritten: model.DataWritten,
+			WriteFailed: model.WriteFailed,
 		},
 	}, nil
 }
@@ -2,15 +2,33 @@ package eventutil
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
 
+	"github.com/Jaskaranbir/es-bank-account/clock"
 	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
 )
 
+// ErrBusTerminating is returned by Bus operations once
+// Bus is terminating. Errors wrapping this are usually
+// secondary to whatever caused Bus to be terminated.
+var ErrBusTerminating = errors.New("bus is terminating")
+
+// SubscriptionClosedError returns error for a subscription
+// closed by Bus, which only happens when Bus is terminating.
+func SubscriptionClosedError(action string) error {
+	return errors.Wrapf(ErrBusTerminating, "subscription closed for action: %s", action)
+}
+
 // Bus provides interface for publishing and
 // subscribing data to/from specific topics.
 type Bus interface {
@@ -20,10 +38,52 @@ type Bus interface {
 	Terminate()
 }
 
+// SubscriptionStats is state of subscriptions to an action.
+type SubscriptionStats struct {
+	// Open subscriptions to action
+	Subscribers int `json:"subscribers"`
+	// Messages buffered or queued for subscribers,
+	// which they haven't received yet.
+	Buffered int `json:"buffered"`
+	// Messages published to action so far
+	Published int64 `json:"published"`
+}
+
+// ErrGroupsUnsupported is returned by GroupSubscriber#SubscribeGroup
+// if Bus can't deliver messages of a group in priority-order.
+var ErrGroupsUnsupported = errors.New("group-subscriptions require priority-delivery")
+
+// GroupSubscriber is a Bus which delivers messages of several
+// actions on a single subscription, highest priority first
+// across all of these, such as so a consumer receives control-
+// messages ahead of a backlog of messages of other actions.
+type GroupSubscriber interface {
+	// SubscribeGroup returns a receive-channel which receives
+	// messages published to any of actions. Unsubscribing it
+	// from any of these (see Bus#Unsubscribe) unsubscribes
+	// it from all.
+	SubscribeGroup(actions []string) (<-chan interface{}, error)
+}
+
+// BusIntrospector is a Bus which reports state
+// of its subscriptions, such as for diagnostics.
+type BusIntrospector interface {
+	// SubscriptionStats returns stats keyed by action, for
+	// actions which were subscribed or published to.
+	SubscriptionStats() map[string]SubscriptionStats
+}
+
 // MemoryBus is an in-memory Bus without persistence.
-// Use #NewMemoryBus to create new instance.
+// Use #NewMemoryBus or #NewMemoryBusWithCfg to create new instance.
 type MemoryBus struct {
-	log logger.Logger
+	// Messages of unexpected type skipped by typed
+	// subscriptions. Accessed atomically, kept first
+	// for 64-bit alignment.
+	numMismatches uint64
+
+	log              logger.Logger
+	priorityDelivery bool
+	metrics          metrics.Metrics
 
 	terminateLock *sync.RWMutex
 	isTerminating bool
@@ -31,12 +91,126 @@ type MemoryBus struct {
 	subsLock      map[string]*sync.RWMutex
 
 	subscriptions map[string][]*subscription
+	// Messages published so far, keyed by action
+	publishedLock *sync.Mutex
+	published     map[string]int64
+
+	clock clock.Clock
+	// Warnings for publishing to actions without subscribers
+	// are logged once per action within this interval.
+	noSubsWarnInterval time.Duration
+	noSubsWarnLock     *sync.Mutex
+	noSubsWarns        map[string]*throttledWarn
+	warnings           warnings.Collector
+
+	// Messages drained from subscriptions without being
+	// received by subscribers, only kept if enabled.
+	retainDrained bool
+	drainedLock   *sync.Mutex
+	drained       []drainedEntry
+	// Tracks drain-routines, so drained
+	// messages are complete once these return.
+	drainWg *sync.WaitGroup
+	// Maximum drain-routines run on termination
+	maxTerminateDrains int
+
+	// Typed subscriptions (see #SubscribeEvents) of Bus
+	typedSubRegistry *typedSubRegistry
+	mismatchHandler  MismatchHandler
+}
+
+// drainedEntry is a message drained from a subscription.
+type drainedEntry struct {
+	action string
+	msg    interface{}
+}
+
+// drainJob is a subscription to be drained by a drain-routine.
+// Close-signal carries messages left in subscription's queue,
+// and is sent once subscription is closed.
+type drainJob struct {
+	id       string
+	channel  <-chan interface{}
+	action   string
+	closeSig chan []interface{}
+}
+
+// throttledWarn tracks a warning logged at most once per interval.
+type throttledWarn struct {
+	loggedAt time.Time
+	// Warnings suppressed since warning was last logged
+	suppressed int
 }
 
+// defaultNoSubsWarnInterval is used if MemoryBusCfg
+// doesn't specify NoSubscribersWarnInterval.
+const defaultNoSubsWarnInterval = 10 * time.Second
+
+// defaultMaxTerminateDrains is used if MemoryBusCfg
+// doesn't specify MaxTerminateDrains.
+const defaultMaxTerminateDrains = 8
+
 type subscription struct {
 	channel chan interface{}
 	isOpen  bool
 	lock    *sync.RWMutex
+	// Only set if priority-delivery is enabled
+	queue *priorityQueue
+	// Actions subscription is listed under, which
+	// are several for group-subscriptions.
+	actions []string
+}
+
+// close closes subscription-channel, and returns messages
+// which were queued but not delivered to channel.
+// Must be called with subscription-lock held.
+func (s *subscription) close() []interface{} {
+	var discarded []interface{}
+	if s.queue != nil {
+		discarded = s.queue.close()
+	}
+	close(s.channel)
+	s.isOpen = false
+	return discarded
+}
+
+// MemoryBusCfg is config for MemoryBus.
+type MemoryBusCfg struct {
+	Log logger.Logger `validate:"nonnil"`
+	// If enabled, messages with higher priority (see
+	// model.PriorityNormal) are delivered to a subscriber
+	// first, and in published order within a priority.
+	// Messages are queued per subscription, so Publish
+	// doesn't block on subscribers in this mode.
+	PriorityDelivery bool
+	// Optional, counts published messages.
+	Metrics metrics.Metrics
+	// Optional, warning for publishing a message without any
+	// subscribers is logged once per action within interval,
+	// and suppressed for rest of interval. Defaults to 10s.
+	NoSubscribersWarnInterval time.Duration `validate:"min=0"`
+	// Optional, defaults to clock.RealClock
+	Clock clock.Clock
+	// Optional, collects warning for every message published
+	// without subscribers, including throttled warnings.
+	Warnings warnings.Collector
+	// Optional. If set, messages drained from subscriptions
+	// when these are closed (such as on unsubscribing or
+	// termination), which subscribers didn't receive, are
+	// retained instead of discarded. Use #DrainTo to write
+	// these, such as to recover them in a later run.
+	RetainDrained bool
+	// Optional, maximum routines draining subscriptions on
+	// termination, which share subscriptions between them
+	// instead of using a routine per subscription, so many
+	// subscriptions don't spawn as many goroutines at once.
+	// Defaults to 8.
+	MaxTerminateDrains int `validate:"min=0"`
+	// Optional, handles messages of unexpected type delivered
+	// to typed subscriptions (see #SubscribeEvents), which are
+	// skipped. Defaults to logging a warning and collecting it
+	// in Warnings (see #CollectMismatches).
+	MismatchHandler MismatchHandler
 }
 
 // NewMemoryBus creates new instance of MemoryBus.
@@ -44,15 +218,64 @@ func NewMemoryBus(log logger.Logger) (*MemoryBus, error) {
 	if log == nil {
 		return nil, errors.New("Log cannot be nil")
 	}
+	return NewMemoryBusWithCfg(&MemoryBusCfg{
+		Log: log,
+	})
+}
+
+// NewMemoryBusWithCfg validates provided config
+// and creates new instance of MemoryBus.
+func NewMemoryBusWithCfg(cfg *MemoryBusCfg) (*MemoryBus, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+
+	busClock := cfg.Clock
+	if busClock == nil {
+		busClock = clock.RealClock{}
+	}
+	noSubsWarnInterval := cfg.NoSubscribersWarnInterval
+	if noSubsWarnInterval == 0 {
+		noSubsWarnInterval = defaultNoSubsWarnInterval
+	}
+	maxTerminateDrains := cfg.MaxTerminateDrains
+	if maxTerminateDrains == 0 {
+		maxTerminateDrains = defaultMaxTerminateDrains
+	}
+	mismatchHandler := cfg.MismatchHandler
+	if mismatchHandler == nil {
+		mismatchHandler = CollectMismatches(cfg.Warnings)
+	}
 
 	return &MemoryBus{
-		log: log,
+		log:              cfg.Log,
+		priorityDelivery: cfg.PriorityDelivery,
+		metrics:          metrics.OrNoop(cfg.Metrics),
+
+		clock:              busClock,
+		noSubsWarnInterval: noSubsWarnInterval,
+		noSubsWarnLock:     &sync.Mutex{},
+		noSubsWarns:        make(map[string]*throttledWarn),
+		warnings:           warnings.OrNoop(cfg.Warnings),
+
+		retainDrained: cfg.RetainDrained,
+		drainedLock:   &sync.Mutex{},
+		drained:       make([]drainedEntry, 0),
+		drainWg:       &sync.WaitGroup{},
+
+		maxTerminateDrains: maxTerminateDrains,
+
+		typedSubRegistry: newTypedSubRegistry(),
+		mismatchHandler:  mismatchHandler,
 
 		terminateLock: &sync.RWMutex{},
 		isTerminating: false,
 
 		subscriptions: make(map[string][]*subscription),
 		subsMapLock:   &sync.RWMutex{},
+		publishedLock: &sync.Mutex{},
+		published:     make(map[string]int64),
 	}, nil
 }
 
@@ -64,14 +287,17 @@ func (b *MemoryBus) Publish(msg interface{}) error {
 	}
 	var action string
 	var msgID string
+	var priority int
 
 	switch v := msg.(type) {
 	case model.Cmd:
 		action = v.Action().String()
 		msgID = v.ID()
+		priority = v.Priority()
 	case model.Event:
 		action = v.Action().String()
 		msgID = v.ID()
+		priority = v.Priority()
 	default:
 		return errors.New("received message of unknown type")
 	}
@@ -81,7 +307,7 @@ func (b *MemoryBus) Publish(msg interface{}) error {
 	b.terminateLock.RLock()
 	if b.isTerminating {
 		b.terminateLock.RUnlock()
-		return errors.New("bus is terminating")
+		return ErrBusTerminating
 	}
 	b.terminateLock.RUnlock()
 
@@ -97,22 +323,123 @@ func (b *MemoryBus) Publish(msg interface{}) error {
 
 	b.log.Tracef("%s Subscribers count: %d", logPrefix, len(subs))
 	if len(subs) == 0 {
-		b.log.Warn("No subscribers found for action")
+		b.warnNoSubscribers(action)
 	}
 
 	for _, sub := range subs {
 		sub.lock.RLock()
 		if sub.isOpen {
 			b.log.Tracef("%s Publishing event", logPrefix)
-			sub.channel <- msg
+			if sub.queue != nil {
+				sub.queue.push(msg, priority)
+			} else {
+				sub.channel <- msg
+			}
 			b.log.Tracef("%s Published event", logPrefix)
 		}
 		sub.lock.RUnlock()
 	}
 
+	b.publishedLock.Lock()
+	b.published[action]++
+	b.publishedLock.Unlock()
+	b.metrics.IncMsgsPublished(action)
 	return nil
 }
 
+// SubscriptionStats returns stats of subscriptions keyed by
+// action. Subscriptions are read one at a time while Bus is
+// in use, so stats of different actions aren't from same
+// instant. Group-subscriptions (see #SubscribeGroup) are
+// counted under each of their actions, along with all
+// messages buffered for these.
+func (b *MemoryBus) SubscriptionStats() map[string]SubscriptionStats {
+	b.subsMapLock.RLock()
+	subsMap := make(map[string][]*subscription, len(b.subscriptions))
+	for action, subs := range b.subscriptions {
+		subsMap[action] = subs
+	}
+	b.subsMapLock.RUnlock()
+
+	b.publishedLock.Lock()
+	published := make(map[string]int64, len(b.published))
+	for action, count := range b.published {
+		published[action] = count
+	}
+	b.publishedLock.Unlock()
+
+	stats := make(map[string]SubscriptionStats, len(subsMap))
+	for action, subs := range subsMap {
+		actionStats := SubscriptionStats{Published: published[action]}
+		for _, sub := range subs {
+			sub.lock.RLock()
+			if sub.isOpen {
+				actionStats.Subscribers++
+				actionStats.Buffered += len(sub.channel)
+				if sub.queue != nil {
+					actionStats.Buffered += sub.queue.len()
+				}
+			}
+			sub.lock.RUnlock()
+		}
+		stats[action] = actionStats
+	}
+	return stats
+}
+
+// ReportMismatch counts message of unexpected type delivered to
+// a typed subscription of action (see #SubscribeEvents), and
+// forwards it to MemoryBusCfg#MismatchHandler.
+func (b *MemoryBus) ReportMismatch(action string, msg interface{}) {
+	atomic.AddUint64(&b.numMismatches, 1)
+	b.metrics.IncTypeMismatches(action)
+	b.mismatchHandler(action, msg)
+}
+
+// Mismatches returns number of messages of unexpected type
+// delivered to typed subscriptions of Bus, which were skipped.
+func (b *MemoryBus) Mismatches() uint64 {
+	return atomic.LoadUint64(&b.numMismatches)
+}
+
+func (b *MemoryBus) typedSubs() *typedSubRegistry {
+	return b.typedSubRegistry
+}
+
+// warnNoSubscribers logs warning for publishing to action without
+// subscribers, unless it was already logged for action within
+// interval. Number of suppressed warnings is noted once interval
+// passes and warning is logged again. Every warning is
+// collected regardless, see MemoryBusCfg#Warnings.
+func (b *MemoryBus) warnNoSubscribers(action string) {
+	b.warnings.Add("eventBus", warnings.NoSubscribers, fmt.Sprintf("action: %s", action))
+
+	b.noSubsWarnLock.Lock()
+	defer b.noSubsWarnLock.Unlock()
+
+	now := b.clock.Now()
+	warn, exists := b.noSubsWarns[action]
+	if exists && now.Sub(warn.loggedAt) < b.noSubsWarnInterval {
+		warn.suppressed++
+		return
+	}
+	if !exists {
+		warn = &throttledWarn{}
+		b.noSubsWarns[action] = warn
+	}
+
+	if warn.suppressed > 0 {
+		b.log.Warnf(
+			"[Action: %s]: No subscribers found for action (suppressed %d similar warning(s))",
+			action, warn.suppressed,
+		)
+	} else {
+		b.log.Warnf("[Action: %s]: No subscribers found for action", action)
+	}
+	warn.loggedAt = now
+	warn.suppressed = 0
+}
+
 // Subscribe returns a receive-channel which'll
 // receive data when data is published to
 // specified action.
@@ -120,33 +447,68 @@ func (b *MemoryBus) Subscribe(action string) (<-chan interface{}, error) {
 	if action == "" {
 		return nil, errors.New("action is blank")
 	}
-	b.terminateLock.RLock()
-	if b.isTerminating {
-		b.terminateLock.RUnlock()
-		return nil, errors.New("bus is terminating")
+	return b.subscribe([]string{action})
+}
+
+// SubscribeGroup returns a receive-channel which'll receive
+// data when data is published to any of specified actions.
+// Messages of all actions are queued for subscription together,
+// and so are delivered highest priority first across actions.
+// Requires priority-delivery, see MemoryBusCfg#PriorityDelivery.
+func (b *MemoryBus) SubscribeGroup(actions []string) (<-chan interface{}, error) {
+	if !b.priorityDelivery {
+		return nil, ErrGroupsUnsupported
 	}
-	b.terminateLock.RUnlock()
+	if len(actions) == 0 {
+		return nil, errors.New("no actions provided")
+	}
+	isListed := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		if action == "" {
+			return nil, errors.New("action is blank")
+		}
+		if isListed[action] {
+			return nil, fmt.Errorf("duplicate action: %s", action)
+		}
+		isListed[action] = true
+	}
+	return b.subscribe(actions)
+}
 
-	logPrefix := fmt.Sprintf("[Subscribe]: [Action: %s]:", action)
+// subscribe adds a subscription listed under each of actions.
+func (b *MemoryBus) subscribe(actions []string) (<-chan interface{}, error) {
+	logPrefix := fmt.Sprintf("[Subscribe]: [Action: %s]:", strings.Join(actions, ","))
 
+	// Held until subscription is added, so Terminate
+	// either closes subscription, or it isn't added.
 	b.terminateLock.RLock()
+	defer b.terminateLock.RUnlock()
 	if b.isTerminating {
 		b.log.Tracef("%s Bus terminating, ignoring subscription-request", logPrefix)
-		b.terminateLock.RUnlock()
-		return nil, nil
+		return nil, ErrBusTerminating
 	}
-	b.terminateLock.RUnlock()
 
-	b.ensureActionChan(action)
+	for _, action := range actions {
+		b.ensureActionChan(action)
+	}
 	sub := &subscription{
 		channel: make(chan interface{}, 2),
 		isOpen:  true,
 		lock:    &sync.RWMutex{},
+		actions: actions,
+	}
+	if b.priorityDelivery {
+		// Unbuffered, so priority is decided when
+		// subscriber is ready to receive.
+		sub.channel = make(chan interface{})
+		sub.queue = newPriorityQueue(sub.channel)
 	}
 
 	b.log.Debugf("%s Adding subscription", logPrefix)
 	b.subsMapLock.Lock()
-	b.subscriptions[action] = append(b.subscriptions[action], sub)
+	for _, action := range actions {
+		b.subscriptions[action] = append(b.subscriptions[action], sub)
+	}
 	b.subsMapLock.Unlock()
 	b.log.Tracef("%s Subscription added", logPrefix)
 
@@ -169,10 +531,24 @@ func (b *MemoryBus) Unsubscribe(c <-chan interface{}, action string) error {
 
 	logPrefix := fmt.Sprintf("[Unsubscribe]: [Action: %s]:", action)
 
+	// Subscriptions are already closed
+	// and removed on termination.
+	b.terminateLock.RLock()
+	if b.isTerminating {
+		b.terminateLock.RUnlock()
+		return ErrBusTerminating
+	}
+	b.terminateLock.RUnlock()
+
 	b.log.Tracef("%s Unsubscribing events-topic", logPrefix)
 
-	drainID, drainCloseSig := b.drain(c)
-	defer close(drainCloseSig)
+	// Messages left in subscription's queue are retained
+	// by drain-routine, after those it received.
+	var leftovers []interface{}
+	drainID, drainCloseSig := b.drain(c, action)
+	defer func() {
+		drainCloseSig <- leftovers
+	}()
 	b.log.Tracef("%s [DrainID: %s]: Started drain-routine", logPrefix, drainID)
 
 	b.subsMapLock.Lock()
@@ -190,12 +566,14 @@ func (b *MemoryBus) Unsubscribe(c <-chan interface{}, action string) error {
 
 			sub.lock.Lock()
 			if sub.isOpen {
-				close(sub.channel)
-				sub.isOpen = false
+				leftovers = sub.close()
 			}
 			sub.lock.Unlock()
 
-			b.subscriptions[action] = subs[1:]
+			// Group-subscriptions are removed from all their actions
+			for _, subAction := range sub.actions {
+				b.subscriptions[subAction] = withoutSub(b.subscriptions[subAction], sub)
+			}
 			b.log.Tracef("%s Unsubscribed from events-topic", logPrefix)
 			return nil
 		}
@@ -205,6 +583,18 @@ func (b *MemoryBus) Unsubscribe(c <-chan interface{}, action string) error {
 	return errors.New("no matching subscription found")
 }
 
+// withoutSub returns subs without sub. Subs are copied, so
+// slice isn't modified while Publish might be iterating over it.
+func withoutSub(subs []*subscription, sub *subscription) []*subscription {
+	remaining := make([]*subscription, 0, len(subs))
+	for _, s := range subs {
+		if s != sub {
+			remaining = append(remaining, s)
+		}
+	}
+	return remaining
+}
+
 // Terminate closes all subscriptions and terminates MemoryBus.
 func (b *MemoryBus) Terminate() {
 	logPrefix := fmt.Sprintf("[Terminate]:")
@@ -221,55 +611,162 @@ func (b *MemoryBus) Terminate() {
 
 	b.log.Tracef("%s Acquiring lock", logPrefix)
 	b.subsMapLock.Lock()
+	// Group-subscriptions are listed under several
+	// actions, but are only drained once.
+	isListed := make(map[*subscription]bool)
+	for _, subs := range b.subscriptions {
+		for _, sub := range subs {
+			isListed[sub] = true
+		}
+	}
+	numSubs := len(isListed)
+	// Subscriptions are drained in order these are closed, so
+	// one which blocks closing (with a publisher waiting on it)
+	// is always drained once preceding ones are closed.
+	jobs := make(chan drainJob, numSubs)
+	b.startDrainPool(jobs, numSubs)
 	for action, subs := range b.subscriptions {
 		b.log.Tracef("%s Closing events-topic: %s", logPrefix, action)
 
 		for _, sub := range subs {
+			if !isListed[sub] {
+				continue
+			}
+			delete(isListed, sub)
 			subLogPrefix := fmt.Sprintf("%s [Action: %s]:", logPrefix, action)
 
-			drainID, drainCloseSig := b.drain(sub.channel)
-			b.log.Tracef("%s [DrainID: %s]: Started drain-routine", subLogPrefix, drainID)
+			job := newDrainJob(sub.channel, action)
+			jobs <- job
+			b.log.Tracef("%s [DrainID: %s]: Queued subscription for draining", subLogPrefix, job.id)
 
+			var leftovers []interface{}
 			sub.lock.Lock()
 			if sub.isOpen {
-				close(sub.channel)
-				sub.isOpen = false
+				leftovers = sub.close()
 			}
 			sub.lock.Unlock()
-			close(drainCloseSig)
+			job.closeSig <- leftovers
 		}
 
 		b.log.Tracef("%s Closed events-topic: %s", logPrefix, action)
 		b.subscriptions[action] = make([]*subscription, 0)
 	}
 
+	close(jobs)
+
 	b.log.Tracef("%s Releasing lock", logPrefix)
 	b.subsMapLock.Unlock()
 	b.log.Debugf("%s Event-Bus terminated", logPrefix)
 }
 
+// newDrainJob creates drainJob for subscription-channel.
+func newDrainJob(c <-chan interface{}, action string) drainJob {
+	drainID, _ := uuid.NewRandom()
+	return drainJob{
+		id:      drainID.String(),
+		channel: c,
+		action:  action,
+		// Buffered, so sending close-signal never blocks
+		closeSig: make(chan []interface{}, 1),
+	}
+}
+
+// startDrainPool starts drain-routines for termination,
+// which drain subscriptions of jobs one at a time until
+// jobs is closed. At most MaxTerminateDrains routines
+// are started, and no more than number of subscriptions.
+func (b *MemoryBus) startDrainPool(jobs <-chan drainJob, numSubs int) {
+	numRoutines := b.maxTerminateDrains
+	if numSubs < numRoutines {
+		numRoutines = numSubs
+	}
+	for i := 0; i < numRoutines; i++ {
+		b.drainWg.Add(1)
+		go func() {
+			defer b.drainWg.Done()
+			for job := range jobs {
+				b.drainSub(job)
+			}
+		}()
+	}
+}
+
 // drain ensures a channel/subscription doesnt block
 // while it is being unsubscribed to or when the Bus
-// is terminating.
-func (b *MemoryBus) drain(c <-chan interface{}) (string, chan<- struct{}) {
-	drainCloseSig := make(chan struct{})
-	drainID, _ := uuid.NewRandom()
+// is terminating. Close-signal carries messages left
+// in subscription's queue, and must be sent once.
+// Drained messages are retained if enabled, in order
+// drained: received ones, those still buffered in
+// channel, and then those left in queue.
+func (b *MemoryBus) drain(c <-chan interface{}, action string) (string, chan<- []interface{}) {
+	job := newDrainJob(c, action)
+
+	b.drainWg.Add(1)
+	go func() {
+		defer b.drainWg.Done()
+		b.drainSub(job)
+	}()
+
+	return job.id, job.closeSig
+}
+
+// drainSub drains subscription of job (see #drain),
+// until its close-signal is received.
+func (b *MemoryBus) drainSub(job drainJob) {
+	for {
+		select {
+		case leftovers := <-job.closeSig:
+			b.drainBuffered(job.channel, job.action)
+			b.retain(job.action, leftovers)
+			b.log.Tracef("[%s] Drained subscription", job.id)
+			return
+		case msg, ok := <-job.channel:
+			if !ok {
+				b.retain(job.action, <-job.closeSig)
+				b.log.Tracef("[%s] Drained subscription", job.id)
+				return
+			}
+			b.retain(job.action, []interface{}{msg})
+		}
+	}
+}
 
-	go func(
-		closeSig <-chan struct{},
-		c <-chan interface{},
-		drainID string,
-	) {
-		for {
-			select {
-			case <-closeSig:
-				b.log.Tracef("[%s] Closed drain-routine", drainID)
+// drainBuffered drains messages buffered in channel, without blocking.
+func (b *MemoryBus) drainBuffered(c <-chan interface{}, action string) {
+	for {
+		select {
+		case msg, ok := <-c:
+			if !ok {
 				return
-			default:
-				<-c
 			}
+			b.retain(action, []interface{}{msg})
+		default:
+			return
 		}
-	}(drainCloseSig, c, drainID.String())
+	}
+}
 
-	return drainID.String(), drainCloseSig
+// retain keeps messages drained from a subscription of
+// action, if retaining drained messages is enabled. These
+// are kept by their own action, since a group-subscription
+// has messages of several actions.
+func (b *MemoryBus) retain(action string, msgs []interface{}) {
+	if !b.retainDrained || len(msgs) == 0 {
+		return
+	}
+	b.drainedLock.Lock()
+	defer b.drainedLock.Unlock()
+	for _, msg := range msgs {
+		msgAction := action
+		switch v := msg.(type) {
+		case model.Cmd:
+			msgAction = v.Action().String()
+		case model.Event:
+			msgAction = v.Action().String()
+		}
+		b.drained = append(b.drained, drainedEntry{
+			action: msgAction,
+			msg:    msg,
+		})
+	}
 }
@@ -1,162 +1,778 @@
-package eventutil
+package eventutil_test
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
 	"time"
 
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/logger"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
 )
 
-var _ = Describe("MemoryBus", func() {
-	const testEvent model.EventAction = "testEvent"
-	var bus *MemoryBus
+func TestMemoryBusPublish(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       func(t *testing.T) interface{}
+		expectErr bool
+	}{
+		{
+			name: "allows an event as message",
+			msg: func(t *testing.T) interface{} {
+				return newEvent(t)
+			},
+		},
+		{
+			name: "allows a command as message",
+			msg: func(t *testing.T) interface{} {
+				return newCmd(t)
+			},
+		},
+		{
+			name: "errors when message isn't command or event",
+			msg: func(*testing.T) interface{} {
+				return "invalid-message"
+			},
+			expectErr: true,
+		},
+		{
+			name: "errors when message is nil",
+			msg: func(*testing.T) interface{} {
+				return nil
+			},
+			expectErr: true,
+		},
+	}
 
-	BeforeSuite(func() {
-		SetDefaultEventuallyTimeout(1 * time.Second)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus := newBus(t)
+			err := bus.Publish(test.msg(t))
+			if test.expectErr && err == nil {
+				t.Fatal("expected error on publish")
+			}
+			if !test.expectErr && err != nil {
+				t.Fatalf("error publishing message: %s", err)
+			}
+		})
+	}
+}
+
+func TestMemoryBusSubscribe(t *testing.T) {
+	t.Run("subscribes to message-action", func(t *testing.T) {
+		bus := newBus(t)
+		recorder, err := testsupport.NewBusRecorder(bus, testsupport.FixtureEvent.String())
+		if err != nil {
+			t.Fatalf("error creating recorder: %s", err)
+		}
+		defer recorder.Stop()
+
+		go func() {
+			// Failure surfaces as WaitFor time-out
+			_ = bus.Publish(newEvent(t))
+		}()
+
+		_, err = recorder.WaitFor(testsupport.FixtureEvent.String(), nil, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
 	})
 
-	BeforeEach(func() {
-		var err error
-		bus, err = NewMemoryBus(logger.NewStdLogger("EventBus"))
-		Expect(err).ToNot(HaveOccurred())
+	t.Run("returns error if message-action is blank", func(t *testing.T) {
+		bus := newBus(t)
+		_, err := bus.Subscribe("")
+		if err == nil {
+			t.Fatal("expected error on blank message-action")
+		}
 	})
+}
 
-	AfterEach(func() {
-		bus.Terminate()
+func TestMemoryBusUnsubscribe(t *testing.T) {
+	testEvent := testsupport.FixtureEvent.String()
+
+	t.Run("unsubscribes from message-action", func(t *testing.T) {
+		bus := newBus(t)
+		sub, err := bus.Subscribe(testEvent)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		err = bus.Unsubscribe(sub, testEvent)
+		if err != nil {
+			t.Fatalf("error unsubscribing: %s", err)
+		}
+		if !isClosed(sub, time.Second) {
+			t.Fatal("expected subscription to be closed")
+		}
 	})
 
-	When("validating message before publishing", func() {
-		It("allows an event as message", func() {
-			event, err := model.NewEvent(&model.EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			err = bus.Publish(event)
-			Expect(err).ToNot(HaveOccurred())
-		})
+	t.Run("keeps other subscriptions of message-action", func(t *testing.T) {
+		bus := newBus(t)
+		otherSub, err := bus.Subscribe(testEvent)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+		sub, err := bus.Subscribe(testEvent)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
 
-		It("allows an command as message", func() {
-			const testCmd model.CmdAction = "testCmd"
+		err = bus.Unsubscribe(sub, testEvent)
+		if err != nil {
+			t.Fatalf("error unsubscribing: %s", err)
+		}
+		event := newEvent(t)
+		err = bus.Publish(event)
+		if err != nil {
+			t.Fatalf("error publishing event: %s", err)
+		}
+		select {
+		case msg := <-otherSub:
+			if msg.(model.Event).ID() != event.ID() {
+				t.Fatalf("expected event %s, got: %+v", event.ID(), msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected other subscription to receive event")
+		}
+	})
 
-			cmd, err := model.NewCmd(&model.CmdCfg{
-				Action: testCmd,
-				Data:   []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			err = bus.Publish(cmd)
-			Expect(err).ToNot(HaveOccurred())
-		})
+	tests := []struct {
+		name        string
+		unsubscribe func(bus eventutil.Bus, sub <-chan interface{}) error
+	}{
+		{
+			name: "errors when unsubscribing with invalid channel",
+			unsubscribe: func(bus eventutil.Bus, _ <-chan interface{}) error {
+				invalidSub := make(chan interface{})
+				return bus.Unsubscribe(invalidSub, testEvent)
+			},
+		},
+		{
+			name: "errors when message-action is blank",
+			unsubscribe: func(bus eventutil.Bus, sub <-chan interface{}) error {
+				return bus.Unsubscribe(sub, "")
+			},
+		},
+		{
+			name: "errors when subscription doesnt exist",
+			unsubscribe: func(bus eventutil.Bus, sub <-chan interface{}) error {
+				return bus.Unsubscribe(sub, "invalid-action")
+			},
+		},
+		{
+			name: "errors when unsubscribing same subscription multiple times",
+			unsubscribe: func(bus eventutil.Bus, sub <-chan interface{}) error {
+				err := bus.Unsubscribe(sub, testEvent)
+				if err != nil {
+					// First unsubscribe must succeed
+					return nil
+				}
+				return bus.Unsubscribe(sub, testEvent)
+			},
+		},
+	}
 
-		It("errors when message isn't command or event ", func() {
-			err := bus.Publish("invalid-message")
-			Expect(err).To(HaveOccurred())
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus := newBus(t)
+			sub, err := bus.Subscribe(testEvent)
+			if err != nil {
+				t.Fatalf("error subscribing: %s", err)
+			}
 
-			err = bus.Publish(nil)
-			Expect(err).To(HaveOccurred())
+			err = test.unsubscribe(bus, sub)
+			if err == nil {
+				t.Fatal("expected error on unsubscribe")
+			}
 		})
+	}
+}
+
+func TestMemoryBusTerminate(t *testing.T) {
+	testEvent := testsupport.FixtureEvent.String()
+
+	t.Run("closes subscription", func(t *testing.T) {
+		bus := newBus(t)
+		sub, err := bus.Subscribe(testEvent)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		bus.Terminate()
+		if !isClosed(sub, time.Second) {
+			t.Fatal("expected subscription to be closed")
+		}
 	})
 
-	When("subscribing to message-action", func() {
-		It("subscribes to message-action", func() {
-			sub, err := bus.Subscribe(testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
+	t.Run("errors when subscribing", func(t *testing.T) {
+		bus := newBus(t)
+		bus.Terminate()
+		_, err := bus.Subscribe(testEvent)
+		if !errors.Is(err, eventutil.ErrBusTerminating) {
+			t.Fatalf("expected ErrBusTerminating on subscribe, got: %v", err)
+		}
+	})
 
+	t.Run("errors when subscribing during termination", func(t *testing.T) {
+		bus := newBus(t)
+		// Subscriptions added before termination
+		// are closed by it, and others error.
+		const numSubs = 50
+		subs := make(chan (<-chan interface{}), numSubs)
+		errs := make(chan error, numSubs)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < numSubs; i++ {
+			wg.Add(1)
 			go func() {
-				defer GinkgoRecover()
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: "1",
-					Action:      testEvent,
-					Data:        []byte("test-data"),
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = bus.Publish(event)
-				Expect(err).ToNot(HaveOccurred())
+				defer wg.Done()
+				sub, err := bus.Subscribe(testEvent)
+				if err != nil {
+					if sub != nil {
+						t.Errorf("expected nil subscription with error, got: %v", sub)
+					}
+					errs <- err
+					return
+				}
+				if sub == nil {
+					t.Error("expected error with nil subscription")
+					return
+				}
+				subs <- sub
 			}()
+		}
+		bus.Terminate()
+		wg.Wait()
+		close(subs)
+		close(errs)
 
-			Eventually(sub).Should(Receive())
-		})
+		for err := range errs {
+			if !errors.Is(err, eventutil.ErrBusTerminating) {
+				t.Fatalf("expected ErrBusTerminating on subscribe, got: %v", err)
+			}
+		}
+		for sub := range subs {
+			if !isClosed(sub, time.Second) {
+				t.Fatal("expected subscription added before termination to be closed")
+			}
+		}
+	})
 
-		It("returns error if message-action is blank", func() {
-			_, err := bus.Subscribe("")
-			Expect(err).To(HaveOccurred())
-		})
+	t.Run("errors when publishing", func(t *testing.T) {
+		bus := newBus(t)
+		bus.Terminate()
+		err := bus.Publish(newEvent(t))
+		if !errors.Is(err, eventutil.ErrBusTerminating) {
+			t.Fatalf("expected ErrBusTerminating on publish, got: %v", err)
+		}
+	})
+
+	t.Run("errors when unsubscribing", func(t *testing.T) {
+		bus := newBus(t)
+		sub, err := bus.Subscribe(testEvent)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+		bus.Terminate()
+		err = bus.Unsubscribe(sub, testEvent)
+		if !errors.Is(err, eventutil.ErrBusTerminating) {
+			t.Fatalf("expected ErrBusTerminating on unsubscribe, got: %v", err)
+		}
 	})
+}
 
-	When("unsubscribing from message-action", func() {
-		It("unsubscribes from message-action", func() {
-			sub, err := bus.Subscribe(testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
+// slowDrainLogger delays drain-routines after these
+// drain a subscription, so these overlap unless bounded.
+type slowDrainLogger struct {
+	logger.Logger
+}
 
-			bus.Unsubscribe(sub, testEvent.String())
-			Eventually(sub).Should(BeClosed())
-		})
+func (l slowDrainLogger) Tracef(s string, v ...interface{}) {
+	if strings.Contains(s, "Drained subscription") {
+		time.Sleep(time.Millisecond)
+	}
+	l.Logger.Tracef(s, v...)
+}
 
-		It("errors when unsubscribing with invalid channel", func() {
-			_, err := bus.Subscribe(testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
+func TestMemoryBusTerminateBoundsDrainRoutines(t *testing.T) {
+	const numSubs = 500
+	const maxDrains = 4
 
-			invalidSub := make(chan interface{})
-			err = bus.Unsubscribe(invalidSub, testEvent.String())
-			Expect(err).To(HaveOccurred())
-		})
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		Log:                slowDrainLogger{logger.NewStdLogger("EventBus")},
+		MaxTerminateDrains: maxDrains,
+		// So termination can be waited on (see #DrainTo)
+		RetainDrained: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	subs := make([]<-chan interface{}, 0, numSubs)
+	for i := 0; i < numSubs; i++ {
+		sub, err := bus.Subscribe(testsupport.FixtureEvent.String())
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+		subs = append(subs, sub)
+	}
+	// Left buffered in subscriptions, for drain-routines
+	if err := bus.Publish(newEvent(t)); err != nil {
+		t.Fatalf("error publishing event: %s", err)
+	}
 
-		It("errors when message-action is blank", func() {
-			sub, err := bus.Subscribe(testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
+	// Samples number of goroutines until drained
+	stop := make(chan struct{})
+	peak := make(chan int)
+	go func() {
+		max := 0
+		for {
+			if n := runtime.NumGoroutine(); n > max {
+				max = n
+			}
+			select {
+			case <-stop:
+				peak <- max
+				return
+			default:
+				runtime.Gosched()
+			}
+		}
+	}()
+	baseline := runtime.NumGoroutine()
 
-			err = bus.Unsubscribe(sub, "")
-			Expect(err).To(HaveOccurred())
-		})
+	counts, err := bus.DrainTo(ioutil.Discard)
+	close(stop)
+	if err != nil {
+		t.Fatalf("error draining bus: %s", err)
+	}
+	if counts[testsupport.FixtureEvent.String()] != 1 {
+		t.Fatalf("expected drained event, got counts: %v", counts)
+	}
+	// Some slack for goroutines started by runtime
+	if extra := <-peak - baseline; extra > maxDrains+5 {
+		t.Fatalf("expected at most %d drain-routines, got %d extra goroutines", maxDrains, extra)
+	}
+	for _, sub := range subs {
+		if !isClosed(sub, time.Second) {
+			t.Fatal("expected subscription to be closed")
+		}
+	}
+}
+
+func TestMemoryBusPriorityDelivery(t *testing.T) {
+	testEvent := testsupport.FixtureEvent.String()
 
-		It("errors when subscription doesnt exist", func() {
-			sub, err := bus.Subscribe(testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
+	tests := []struct {
+		name             string
+		priorityDelivery bool
+		priorities       []int
+		// Indexes of published messages, in expected received order
+		expectOrder []int
+	}{
+		{
+			name:             "delivers higher priority first",
+			priorityDelivery: true,
+			priorities:       []int{model.PriorityNormal, model.PriorityControl},
+			expectOrder:      []int{1, 0},
+		},
+		{
+			name:             "delivers in published order within a priority",
+			priorityDelivery: true,
+			priorities: []int{
+				model.PriorityNormal,
+				model.PriorityControl,
+				model.PriorityNormal,
+				5,
+				model.PriorityControl,
+				5,
+				model.PriorityNormal,
+			},
+			expectOrder: []int{1, 4, 3, 5, 0, 2, 6},
+		},
+		{
+			name:             "delivers negative priority last",
+			priorityDelivery: true,
+			priorities:       []int{-1, model.PriorityNormal, -1},
+			expectOrder:      []int{1, 0, 2},
+		},
+		{
+			name:             "delivers in published order when priority-delivery is disabled",
+			priorityDelivery: false,
+			priorities:       []int{model.PriorityNormal, model.PriorityControl},
+			expectOrder:      []int{0, 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+				Log:              logger.NewStdLogger("EventBus"),
+				PriorityDelivery: test.priorityDelivery,
+			})
+			if err != nil {
+				t.Fatalf("error creating bus: %s", err)
+			}
+			t.Cleanup(bus.Terminate)
 
-			err = bus.Unsubscribe(sub, "invalid-action")
-			Expect(err).To(HaveOccurred())
+			sub, err := bus.Subscribe(testEvent)
+			if err != nil {
+				t.Fatalf("error subscribing: %s", err)
+			}
+
+			published := make(chan error, 1)
+			go func() {
+				for i, priority := range test.priorities {
+					event, err := testsupport.NewEventBuilder().
+						WithAggregateID(strconv.Itoa(i)).
+						WithPriority(priority).
+						Build()
+					if err == nil {
+						err = bus.Publish(event)
+					}
+					if err != nil {
+						published <- err
+						return
+					}
+				}
+				published <- nil
+			}()
+			if test.priorityDelivery {
+				// Publish doesn't block in priority-mode, so all
+				// messages are queued before any is received.
+				err = <-published
+				if err != nil {
+					t.Fatalf("error publishing: %s", err)
+				}
+				// Let delivery routine settle on queue-head
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			for _, expectIndex := range test.expectOrder {
+				select {
+				case msg := <-sub:
+					aggID := msg.(model.Event).AggregateID()
+					if aggID != strconv.Itoa(expectIndex) {
+						t.Fatalf(
+							"expected message %d, got message %s",
+							expectIndex, aggID,
+						)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("timed-out waiting for message %d", expectIndex)
+				}
+			}
+			if !test.priorityDelivery {
+				err = <-published
+				if err != nil {
+					t.Fatalf("error publishing: %s", err)
+				}
+			}
 		})
+	}
 
-		It("errors when unsubscribing same subscription multiple times", func() {
-			sub, err := bus.Subscribe(testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
+	t.Run("errors when log is nil", func(t *testing.T) {
+		_, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{})
+		if err == nil {
+			t.Fatal("expected error creating bus")
+		}
+	})
 
-			err = bus.Unsubscribe(sub, testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
-			err = bus.Unsubscribe(sub, testEvent.String())
-			Expect(err).To(HaveOccurred())
+	t.Run("discards queued messages on unsubscribe", func(t *testing.T) {
+		bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+			Log:              logger.NewStdLogger("EventBus"),
+			PriorityDelivery: true,
 		})
+		if err != nil {
+			t.Fatalf("error creating bus: %s", err)
+		}
+		t.Cleanup(bus.Terminate)
+
+		sub, err := bus.Subscribe(testEvent)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+		err = bus.Publish(newEvent(t))
+		if err != nil {
+			t.Fatalf("error publishing: %s", err)
+		}
+
+		err = bus.Unsubscribe(sub, testEvent)
+		if err != nil {
+			t.Fatalf("error unsubscribing: %s", err)
+		}
+		if _, ok := <-sub; ok {
+			t.Fatal("expected subscription to be closed without messages")
+		}
 	})
+}
 
-	When("terminating bus", func() {
-		It("should close subscription", func() {
-			sub, err := bus.Subscribe(testEvent.String())
-			Expect(err).ToNot(HaveOccurred())
+func TestMemoryBusSubscribeGroup(t *testing.T) {
+	const dataAction = model.EventAction("data")
+	const controlAction = model.EventAction("control")
+	actions := []string{dataAction.String(), controlAction.String()}
 
-			bus.Terminate()
-			Eventually(sub).Should(BeClosed())
+	newPriorityBus := func(t *testing.T) *eventutil.MemoryBus {
+		bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+			Log:              logger.NewStdLogger("EventBus"),
+			PriorityDelivery: true,
 		})
+		if err != nil {
+			t.Fatalf("error creating bus: %s", err)
+		}
+		t.Cleanup(bus.Terminate)
+		return bus
+	}
+	publish := func(t *testing.T, bus eventutil.Bus, action model.EventAction, aggID string, priority int) {
+		event, err := testsupport.NewEventBuilder().
+			WithAction(action).
+			WithAggregateID(aggID).
+			WithPriority(priority).
+			Build()
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		if err := bus.Publish(event); err != nil {
+			t.Fatalf("error publishing: %s", err)
+		}
+	}
 
-		It("errors when subscribing", func() {
-			bus.Terminate()
-			_, err := bus.Subscribe(testEvent.String())
-			Expect(err).To(HaveOccurred())
-		})
+	t.Run("delivers higher priority first across actions", func(t *testing.T) {
+		bus := newPriorityBus(t)
+		sub, err := bus.SubscribeGroup(actions)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
 
-		It("errors when publishing", func() {
-			bus.Terminate()
-			event, err := model.NewEvent(&model.EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			err = bus.Publish(event)
-			Expect(err).To(HaveOccurred())
+		publish(t, bus, dataAction, "0", model.PriorityNormal)
+		publish(t, bus, dataAction, "1", model.PriorityNormal)
+		publish(t, bus, controlAction, "2", model.PriorityControl)
+		publish(t, bus, dataAction, "3", model.PriorityNormal)
+		// Let delivery routine settle on queue-head
+		time.Sleep(10 * time.Millisecond)
+
+		for _, expectAggID := range []string{"2", "0", "1", "3"} {
+			select {
+			case msg := <-sub:
+				aggID := msg.(model.Event).AggregateID()
+				if aggID != expectAggID {
+					t.Fatalf("expected message %s, got message %s", expectAggID, aggID)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("timed-out waiting for message %s", expectAggID)
+			}
+		}
+	})
+
+	t.Run("unsubscribes from all actions", func(t *testing.T) {
+		bus := newPriorityBus(t)
+		sub, err := bus.SubscribeGroup(actions)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		err = bus.Unsubscribe(sub, controlAction.String())
+		if err != nil {
+			t.Fatalf("error unsubscribing: %s", err)
+		}
+		if _, ok := <-sub; ok {
+			t.Fatal("expected subscription to be closed")
+		}
+		stats := bus.SubscriptionStats()
+		for _, action := range actions {
+			if stats[action].Subscribers != 0 {
+				t.Fatalf("expected no subscribers for action %s, got: %d", action, stats[action].Subscribers)
+			}
+		}
+		err = bus.Unsubscribe(sub, dataAction.String())
+		if err == nil {
+			t.Fatal("expected error unsubscribing twice")
+		}
+	})
+
+	t.Run("retains drained messages by their action", func(t *testing.T) {
+		bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+			Log:              logger.NewStdLogger("EventBus"),
+			PriorityDelivery: true,
+			RetainDrained:    true,
 		})
+		if err != nil {
+			t.Fatalf("error creating bus: %s", err)
+		}
+		_, err = bus.SubscribeGroup(actions)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+		publish(t, bus, dataAction, "0", model.PriorityNormal)
+		publish(t, bus, controlAction, "1", model.PriorityControl)
+
+		counts, err := bus.DrainTo(&bytes.Buffer{})
+		if err != nil {
+			t.Fatalf("error draining: %s", err)
+		}
+		expected := map[string]int{dataAction.String(): 1, controlAction.String(): 1}
+		if !reflect.DeepEqual(counts, expected) {
+			t.Fatalf("expected drained counts %v, got: %v", expected, counts)
+		}
 	})
-})
+
+	t.Run("errors without priority-delivery", func(t *testing.T) {
+		bus := newBus(t)
+		_, err := bus.SubscribeGroup(actions)
+		if !errors.Is(err, eventutil.ErrGroupsUnsupported) {
+			t.Fatalf("expected ErrGroupsUnsupported, got: %v", err)
+		}
+	})
+
+	t.Run("errors for invalid actions", func(t *testing.T) {
+		bus := newPriorityBus(t)
+		invalidActions := [][]string{
+			{},
+			{dataAction.String(), ""},
+			{dataAction.String(), dataAction.String()},
+		}
+		for _, invalid := range invalidActions {
+			if _, err := bus.SubscribeGroup(invalid); err == nil {
+				t.Fatalf("expected error subscribing to actions: %q", invalid)
+			}
+		}
+	})
+}
+
+func TestMemoryBusSubscriptionStats(t *testing.T) {
+	bus := newBus(t)
+	sub, err := bus.Subscribe(testsupport.FixtureEvent.String())
+	if err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+	if _, err = bus.Subscribe(testsupport.FixtureEvent.String()); err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+	// Subscription-channels buffer 2 messages
+	for i := 0; i < 2; i++ {
+		if err = bus.Publish(newEvent(t)); err != nil {
+			t.Fatalf("error publishing event: %s", err)
+		}
+	}
+	<-sub
+	if err = bus.Publish(newCmd(t)); err != nil {
+		t.Fatalf("error publishing command: %s", err)
+	}
+
+	stats := bus.SubscriptionStats()
+	expected := map[string]eventutil.SubscriptionStats{
+		testsupport.FixtureEvent.String(): {Subscribers: 2, Buffered: 3, Published: 2},
+		testsupport.FixtureCmd.String():   {Subscribers: 0, Buffered: 0, Published: 1},
+	}
+	if len(stats) != len(expected) {
+		t.Fatalf("expected stats for %d actions, got: %v", len(expected), stats)
+	}
+	for action, actionStats := range expected {
+		if stats[action] != actionStats {
+			t.Fatalf("expected stats %+v for action %s, got: %+v", actionStats, action, stats[action])
+		}
+	}
+
+	if err = bus.Unsubscribe(sub, testsupport.FixtureEvent.String()); err != nil {
+		t.Fatalf("error unsubscribing: %s", err)
+	}
+	stats = bus.SubscriptionStats()
+	if s := stats[testsupport.FixtureEvent.String()]; s.Subscribers != 1 || s.Buffered != 2 {
+		t.Fatalf("expected unsubscribed subscription to be excluded, got: %+v", s)
+	}
+}
+
+func TestMemoryBusThrottlesNoSubscribersWarning(t *testing.T) {
+	logBuf := &bytes.Buffer{}
+	fakeClock := clock.NewFakeClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		// Other than "EventBus", so warnings are logged
+		Log: logger.NewStdLoggerWithCfg(logger.StdLoggerCfg{
+			Prefix: "ThrottledBus",
+			Writer: logBuf,
+		}),
+		NoSubscribersWarnInterval: time.Minute,
+		Clock:                     fakeClock,
+	})
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+
+	warnings := func(action string) int {
+		return strings.Count(logBuf.String(), fmt.Sprintf("[Action: %s]: No subscribers found", action))
+	}
+	publish := func(msg interface{}, times int) {
+		for i := 0; i < times; i++ {
+			if err := bus.Publish(msg); err != nil {
+				t.Fatalf("error publishing message: %s", err)
+			}
+		}
+	}
+
+	publish(newEvent(t), 5)
+	if n := warnings(testsupport.FixtureEvent.String()); n != 1 {
+		t.Fatalf("expected 1 warning within interval, got: %d\n%s", n, logBuf)
+	}
+	// Throttled per action
+	publish(newCmd(t), 1)
+	if n := warnings(testsupport.FixtureCmd.String()); n != 1 {
+		t.Fatalf("expected 1 warning for other action, got: %d\n%s", n, logBuf)
+	}
+
+	fakeClock.Advance(time.Minute)
+	publish(newEvent(t), 1)
+	if n := warnings(testsupport.FixtureEvent.String()); n != 2 {
+		t.Fatalf("expected warning after interval, got: %d warning(s)\n%s", n, logBuf)
+	}
+	if !strings.Contains(logBuf.String(), "suppressed 4 similar warning(s)") {
+		t.Fatalf("expected suppressed warnings to be noted, got:\n%s", logBuf)
+	}
+}
+
+func TestMemoryBusCollectsNoSubscribersWarnings(t *testing.T) {
+	collector := warnings.NewMemoryCollector(2)
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		Log:      logger.NewStdLogger("EventBus"),
+		Warnings: collector,
+	})
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+
+	// Throttled warnings are also collected
+	for i := 0; i < 3; i++ {
+		if err := bus.Publish(newEvent(t)); err != nil {
+			t.Fatalf("error publishing event: %s", err)
+		}
+	}
+	if _, err := bus.Subscribe(testsupport.FixtureCmd.String()); err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+	if err := bus.Publish(newCmd(t)); err != nil {
+		t.Fatalf("error publishing command: %s", err)
+	}
+
+	summary := collector.Summary()
+	expected := warnings.CodeSummary{
+		Count: 3,
+		Details: []warnings.Detail{
+			{Component: "eventBus", Detail: "action: " + testsupport.FixtureEvent.String()},
+			{Component: "eventBus", Detail: "action: " + testsupport.FixtureEvent.String()},
+		},
+	}
+	if len(summary) != 1 || !reflect.DeepEqual(summary[warnings.NoSubscribers], expected) {
+		t.Fatalf("expected no-subscribers warnings %+v, got: %+v", expected, summary)
+	}
+}
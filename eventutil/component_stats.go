@@ -0,0 +1,60 @@
+package eventutil
+
+import "sync/atomic"
+
+// ComponentStats counts messages handled by a component, such
+// as for diagnostics. Methods are safe for concurrent use, and
+// are no-ops on nil ComponentStats, so components can update
+// these unconditionally.
+type ComponentStats struct {
+	processed int64
+	ignored   int64
+	cached    int64
+}
+
+// ComponentCounts is a point-in-time copy of ComponentStats.
+type ComponentCounts struct {
+	// Messages handled by component
+	Processed int64 `json:"processed"`
+	// Messages received but not handled, such as
+	// messages without data, or late commands.
+	Ignored int64 `json:"ignored"`
+	// Aggregates cached in memory, such as long-lived
+	// account-actors. Zero for components without caches.
+	Cached int64 `json:"cached"`
+}
+
+// IncProcessed counts a message handled by component.
+func (s *ComponentStats) IncProcessed() {
+	if s != nil {
+		atomic.AddInt64(&s.processed, 1)
+	}
+}
+
+// IncIgnored counts a message received by
+// component, which it didn't handle.
+func (s *ComponentStats) IncIgnored() {
+	if s != nil {
+		atomic.AddInt64(&s.ignored, 1)
+	}
+}
+
+// SetCached sets number of aggregates cached by component.
+func (s *ComponentStats) SetCached(cached int) {
+	if s != nil {
+		atomic.StoreInt64(&s.cached, int64(cached))
+	}
+}
+
+// Counts returns current counts. Counts are read
+// individually, so these aren't from same instant.
+func (s *ComponentStats) Counts() ComponentCounts {
+	if s == nil {
+		return ComponentCounts{}
+	}
+	return ComponentCounts{
+		Processed: atomic.LoadInt64(&s.processed),
+		Ignored:   atomic.LoadInt64(&s.ignored),
+		Cached:    atomic.LoadInt64(&s.cached),
+	}
+}
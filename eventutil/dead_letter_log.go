@@ -0,0 +1,167 @@
+package eventutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// DeadLetter is a message (model.Cmd or model.Event)
+// that could not be processed, along with the reason.
+type DeadLetter struct {
+	MsgID  string
+	Msg    interface{}
+	Reason string
+	Time   time.Time
+}
+
+// DeadLetterLog stores messages that could not be
+// processed, so these can be inspected and replayed
+// once the cause of failure has been fixed.
+type DeadLetterLog interface {
+	// Inserts a message into log.
+	Insert(msg interface{}, reason string) error
+	// Removes a message from log.
+	Pop(msgID string) error
+	// Returns all stored dead-letters in log.
+	Entries() ([]DeadLetter, error)
+}
+
+// MemoryDeadLetterLog is an in-memory
+// DeadLetterLog without persistence.
+// Use #NewMemoryDeadLetterLog to create new instance.
+type MemoryDeadLetterLog struct {
+	entries []DeadLetter
+	lock    *sync.RWMutex
+}
+
+// NewMemoryDeadLetterLog creates new instance of MemoryDeadLetterLog.
+func NewMemoryDeadLetterLog() *MemoryDeadLetterLog {
+	return &MemoryDeadLetterLog{
+		entries: make([]DeadLetter, 0),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+// Insert inserts a message into log.
+// Message must be of model.Cmd or model.Event type.
+func (l *MemoryDeadLetterLog) Insert(msg interface{}, reason string) error {
+	var msgID string
+	switch v := msg.(type) {
+	case model.Cmd:
+		msgID = v.ID()
+	case model.Event:
+		msgID = v.ID()
+	default:
+		return errors.New("received message of unknown type")
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.entries = append(l.entries, DeadLetter{
+		MsgID:  msgID,
+		Msg:    msg,
+		Reason: reason,
+		Time:   time.Now().UTC(),
+	})
+	return nil
+}
+
+// Pop removes a message from log.
+func (l *MemoryDeadLetterLog) Pop(msgID string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for i, entry := range l.entries {
+		if entry.MsgID == msgID {
+			l.entries = append(l.entries[:i], l.entries[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("message not found in log")
+}
+
+// Entries returns all stored dead-letters in log.
+func (l *MemoryDeadLetterLog) Entries() ([]DeadLetter, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	entries := make([]DeadLetter, len(l.entries))
+	copy(entries, l.entries)
+	return entries, nil
+}
+
+// DeadLetterReplayer re-publishes dead-lettered
+// messages back onto the Bus.
+// Use #NewDeadLetterReplayer to create new instance.
+type DeadLetterReplayer struct {
+	log           logger.Logger
+	bus           Bus
+	deadLetterLog DeadLetterLog
+}
+
+// DeadLetterReplayerCfg is config for DeadLetterReplayer.
+type DeadLetterReplayerCfg struct {
+	Log           logger.Logger `validate:"nonnil"`
+	Bus           Bus           `validate:"nonnil"`
+	DeadLetterLog DeadLetterLog `validate:"nonnil"`
+}
+
+// NewDeadLetterReplayer validates provided config
+// and creates new instance of DeadLetterReplayer.
+func NewDeadLetterReplayer(cfg *DeadLetterReplayerCfg) (*DeadLetterReplayer, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+
+	return &DeadLetterReplayer{
+		log:           cfg.Log,
+		bus:           cfg.Bus,
+		deadLetterLog: cfg.DeadLetterLog,
+	}, nil
+}
+
+// ReplayDeadLetters re-publishes all dead-lettered messages
+// on Bus, in the order they were inserted. A message is removed
+// from dead-letter log only after it was successfully published,
+// so a failed replay can be safely retried.
+func (r *DeadLetterReplayer) ReplayDeadLetters(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("context is nil")
+	}
+
+	entries, err := r.deadLetterLog.Entries()
+	if err != nil {
+		return errors.Wrap(err, "error fetching entries from dead-letter log")
+	}
+	r.log.Debugf("Replaying %d dead-letter(s)", len(entries))
+
+	for _, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "context closed while replaying dead-letters")
+		default:
+		}
+
+		r.log.Tracef("[Msg: %s]: Replaying dead-letter", entry.MsgID)
+		err := r.bus.Publish(entry.Msg)
+		if err != nil {
+			return errors.Wrapf(err, "error publishing dead-letter to bus: %s", entry.MsgID)
+		}
+		err = r.deadLetterLog.Pop(entry.MsgID)
+		if err != nil {
+			return errors.Wrapf(err, "error popping message from dead-letter log: %s", entry.MsgID)
+		}
+		r.log.Tracef("[Msg: %s]: Replayed dead-letter", entry.MsgID)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package eventutil_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+func newDeadLetterReplayer(
+	t *testing.T,
+	bus eventutil.Bus,
+	deadLetterLog eventutil.DeadLetterLog,
+) *eventutil.DeadLetterReplayer {
+	t.Helper()
+
+	replayer, err := eventutil.NewDeadLetterReplayer(&eventutil.DeadLetterReplayerCfg{
+		Log:           logger.NewStdLogger("DeadLetterReplayer"),
+		Bus:           bus,
+		DeadLetterLog: deadLetterLog,
+	})
+	if err != nil {
+		t.Fatalf("error creating replayer: %s", err)
+	}
+	return replayer
+}
+
+func TestMemoryDeadLetterLogInsertUnknownType(t *testing.T) {
+	deadLetterLog := eventutil.NewMemoryDeadLetterLog()
+	err := deadLetterLog.Insert("invalid-message", "test-reason")
+	if err == nil {
+		t.Fatal("expected error when inserting message of unknown type")
+	}
+}
+
+func TestDeadLetterReplayerReplay(t *testing.T) {
+	bus := newBus(t)
+	deadLetterLog := eventutil.NewMemoryDeadLetterLog()
+	replayer := newDeadLetterReplayer(t, bus, deadLetterLog)
+
+	recorder, err := testsupport.NewBusRecorder(
+		bus,
+		testsupport.FixtureEvent.String(),
+		testsupport.FixtureCmd.String(),
+	)
+	if err != nil {
+		t.Fatalf("error creating recorder: %s", err)
+	}
+	defer recorder.Stop()
+
+	event := newEvent(t)
+	cmd := newCmd(t)
+	for _, msg := range []interface{}{event, cmd} {
+		err = deadLetterLog.Insert(msg, "test-reason")
+		if err != nil {
+			t.Fatalf("error inserting dead-letter: %s", err)
+		}
+	}
+
+	err = replayer.ReplayDeadLetters(context.Background())
+	if err != nil {
+		t.Fatalf("error replaying dead-letters: %s", err)
+	}
+
+	_, err = recorder.WaitFor(
+		testsupport.FixtureEvent.String(),
+		func(msg interface{}) bool {
+			return msg.(model.Event).ID() == event.ID()
+		},
+		time.Second,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = recorder.WaitFor(
+		testsupport.FixtureCmd.String(),
+		func(msg interface{}) bool {
+			return msg.(model.Cmd).ID() == cmd.ID()
+		},
+		time.Second,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := deadLetterLog.Entries()
+	if err != nil {
+		t.Fatalf("error fetching entries: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected dead-letter log to be cleared, got %d entries", len(entries))
+	}
+}
+
+func TestDeadLetterReplayerRetainsFailed(t *testing.T) {
+	bus := newBus(t)
+	deadLetterLog := eventutil.NewMemoryDeadLetterLog()
+	replayer := newDeadLetterReplayer(t, bus, deadLetterLog)
+
+	event := newEvent(t)
+	err := deadLetterLog.Insert(event, "test-reason")
+	if err != nil {
+		t.Fatalf("error inserting dead-letter: %s", err)
+	}
+
+	// Terminated bus rejects all publishes
+	bus.Terminate()
+	err = replayer.ReplayDeadLetters(context.Background())
+	if err == nil {
+		t.Fatal("expected error replaying on terminated bus")
+	}
+
+	entries, err := deadLetterLog.Entries()
+	if err != nil {
+		t.Fatalf("error fetching entries: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 retained dead-letter, got %d", len(entries))
+	}
+	if entries[0].MsgID != event.ID() {
+		t.Fatalf("expected retained message %s, got %s", event.ID(), entries[0].MsgID)
+	}
+	if entries[0].Reason != "test-reason" {
+		t.Fatalf("expected reason test-reason, got %s", entries[0].Reason)
+	}
+}
@@ -1,14 +1,25 @@
 package eventutil
 
 import (
+	"sync"
+
 	"github.com/pkg/errors"
 	"gopkg.in/validator.v2"
 
 	"github.com/Jaskaranbir/es-bank-account/model"
 )
 
+// EventReader fetches events for specific aggregate.
+// Both EventRepo and EventStore are EventReaders.
+type EventReader interface {
+	Fetch(aggID string) ([]model.Event, error)
+}
+
 // EventRepo handles inserting, publishing,
 // and fetching events for specific aggregate.
+// Implementations must ensure that an event is
+// stored before InsertAndPublish returns, so any
+// following Fetch reads the aggregate's own writes.
 type EventRepo interface {
 	InsertAndPublish(event model.Event) error
 	FetchByIndex(index int) ([]model.Event, error)
@@ -22,6 +33,13 @@ type LoggedEventRepo struct {
 	bus            Bus
 	eventStore     EventStore
 	unpublishedLog UnpublishedLog
+	source         string
+
+	// Serializes store-and-publish per aggregate,
+	// so events for an aggregate are published in
+	// same order as they are stored.
+	aggLocksLock *sync.Mutex
+	aggLocks     map[string]*sync.Mutex
 }
 
 // LoggedEventRepoCfg is config for LoggedEventRepo.
@@ -29,6 +47,11 @@ type LoggedEventRepoCfg struct {
 	Bus            Bus            `validate:"nonnil"`
 	EventStore     EventStore     `validate:"nonnil"`
 	UnpublishedLog UnpublishedLog `validate:"nonnil"`
+	// Optional, events without a source are tagged
+	// with this source (see model.Event#Source) as
+	// these are stored, such as instance-id of
+	// deployments sharing an event-store.
+	Source string
 }
 
 // NewLoggedEventRepo validates provided config and
@@ -43,12 +66,16 @@ func NewLoggedEventRepo(cfg *LoggedEventRepoCfg) (*LoggedEventRepo, error) {
 		bus:            cfg.Bus,
 		eventStore:     cfg.EventStore,
 		unpublishedLog: cfg.UnpublishedLog,
+		source:         cfg.Source,
+
+		aggLocksLock: &sync.Mutex{},
+		aggLocks:     make(map[string]*sync.Mutex),
 	}
 	// Initial hydration from unpublished-log,
 	// in case there was service-failure and
 	// unpublished-log still has events yet
 	// to be published.
-	err = repo.insertAndPubFromlog()
+	err = repo.insertAndPubFromlog("")
 	if err != nil {
 		return nil, errors.Wrap(err, "error hydrating from unpublished-log")
 	}
@@ -57,20 +84,55 @@ func NewLoggedEventRepo(cfg *LoggedEventRepoCfg) (*LoggedEventRepo, error) {
 
 // InsertAndPublish stores provided event into
 // event-store and publishes it on the Bus.
+// The event is stored before being published.
+// Concurrent calls for same aggregate are serialized,
+// so its events are published in the order stored.
+// Events without a source are tagged with repo's source.
 func (er *LoggedEventRepo) InsertAndPublish(event model.Event) error {
-	er.unpublishedLog.Insert(event)
+	if er.source != "" && event.Source() == "" {
+		event = event.WithSource(er.source)
+	}
+	aggLock := er.aggLock(event.AggregateID())
+	aggLock.Lock()
+	defer aggLock.Unlock()
 
-	err := er.insertAndPubFromlog()
+	err := er.unpublishedLog.Insert(event)
+	if err != nil {
+		return errors.Wrap(err, "error inserting event into unpublished-log")
+	}
+
+	err = er.insertAndPubFromlog(event.AggregateID())
 	return errors.Wrap(err, "error hydrating from unpublished-log")
 }
 
-func (er *LoggedEventRepo) insertAndPubFromlog() error {
+// aggLock returns lock for specified aggregate.
+func (er *LoggedEventRepo) aggLock(aggID string) *sync.Mutex {
+	er.aggLocksLock.Lock()
+	defer er.aggLocksLock.Unlock()
+
+	lock, exists := er.aggLocks[aggID]
+	if !exists {
+		lock = &sync.Mutex{}
+		er.aggLocks[aggID] = lock
+	}
+	return lock
+}
+
+// insertAndPubFromlog stores and publishes events from
+// unpublished-log for specified aggregate. Events for all
+// aggregates are processed if aggregate-ID is blank.
+func (er *LoggedEventRepo) insertAndPubFromlog(aggID string) error {
 	events, err := er.unpublishedLog.Events()
 	if err != nil {
 		return errors.Wrap(err, "error fetching events from unpublished-log")
 	}
 
 	for _, event := range events {
+		// Events for other aggregates are handled
+		// by calls holding their respective locks
+		if aggID != "" && event.AggregateID() != aggID {
+			continue
+		}
 		err := er.eventStore.Insert(event)
 		if err != nil {
 			return errors.Wrapf(err, "error inserting event in event-store: %s", event.ID())
@@ -102,3 +164,43 @@ func (er *LoggedEventRepo) FetchByIndex(index int) ([]model.Event, error) {
 	events, err := er.eventStore.FetchByIndex(index)
 	return events, errors.Wrap(err, "error fetching events from event-store")
 }
+
+// FetchIDs provides records of transaction-IDs of aggregate's
+// events, if event-store indexes these (see TxnIDFetcher).
+// Returns ErrTxnIDsNotIndexed otherwise.
+func (er *LoggedEventRepo) FetchIDs(aggID string) ([]TxnIDRecord, error) {
+	fetcher, ok := er.eventStore.(TxnIDFetcher)
+	if !ok {
+		return nil, ErrTxnIDsNotIndexed
+	}
+	records, err := fetcher.FetchIDs(aggID)
+	return records, errors.Wrap(err, "error fetching transaction-ids from event-store")
+}
+
+// FetchByTxnID provides records of events with provided
+// transaction-ID across aggregates, if event-store indexes
+// these (see TxnIDFetcher). Returns ErrTxnIDsNotIndexed otherwise.
+func (er *LoggedEventRepo) FetchByTxnID(txnID string) ([]TxnIDRecord, error) {
+	fetcher, ok := er.eventStore.(TxnIDFetcher)
+	if !ok {
+		return nil, ErrTxnIDsNotIndexed
+	}
+	records, err := fetcher.FetchByTxnID(txnID)
+	return records, errors.Wrap(err, "error fetching transaction-id records from event-store")
+}
+
+// UnpublishedCount returns number of events in unpublished-log,
+// which are yet to be inserted into event-store and published.
+func (er *LoggedEventRepo) UnpublishedCount() (int, error) {
+	events, err := er.unpublishedLog.Events()
+	if err != nil {
+		return 0, errors.Wrap(err, "error fetching events from unpublished-log")
+	}
+	return len(events), nil
+}
+
+// StoreStats returns size of repo's event-store,
+// along with topN aggregates by number of events.
+func (er *LoggedEventRepo) StoreStats(topN int) EventStoreStats {
+	return er.eventStore.Stats(topN)
+}
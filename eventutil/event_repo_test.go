@@ -1,239 +1,249 @@
-package eventutil
+package eventutil_test
 
 import (
-	"bytes"
 	"context"
-	"fmt"
+	"reflect"
+	"testing"
 	"time"
 
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
-
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
-	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
 )
 
-var _ = Describe("LoggedEventRepo", func() {
-	const testEvent model.EventAction = "testEvent"
-	var eventRepo *LoggedEventRepo
-	var bus Bus
+func newLoggedEventRepo(t *testing.T, bus eventutil.Bus) *eventutil.LoggedEventRepo {
+	t.Helper()
 
-	type testEventData struct {
-		aggID string
-		time  time.Time
-		data  []byte
+	eventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+		Bus:            bus,
+		EventStore:     eventutil.NewMemoryEventStore(),
+		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+	})
+	if err != nil {
+		t.Fatalf("error creating event-repo: %s", err)
 	}
+	return eventRepo
+}
 
-	var validateEvents = func(events []model.Event, testEvents []testEventData) error {
-		if len(events) != len(testEvents) {
-			return errors.New("length mismatch")
-		}
-
-		for i := 0; i < len(events); i++ {
-			event := events[i]
-			testData := testEvents[i]
+func TestLoggedEventRepoInsertAndPublish(t *testing.T) {
+	bus := newBus(t)
+	eventRepo := newLoggedEventRepo(t, bus)
 
-			dataEqual := bytes.Equal(event.Data(), testData.data)
-			if !dataEqual {
-				return fmt.Errorf("data mismatch")
-			}
-			if event.Time().UnixNano() != testData.time.UnixNano() {
-				return errors.New("time mismatch")
-			}
-			if event.AggregateID() != testData.aggID {
-				return errors.New("id mismatch")
-			}
-		}
-		return nil
+	recorder, err := testsupport.NewBusRecorder(bus, testsupport.FixtureEvent.String())
+	if err != nil {
+		t.Fatalf("error creating recorder: %s", err)
 	}
+	defer recorder.Stop()
 
-	var (
-		// We dont use slice/map here to have
-		// more individual control and significance
-		// of these IDs, since each ID should have
-		// very particular events associated
-		agg1Events []testEventData
-		agg2Events []testEventData
+	event := newEvent(t)
+	err = eventRepo.InsertAndPublish(event)
+	if err != nil {
+		t.Fatalf("error inserting event: %s", err)
+	}
+	_, err = recorder.WaitFor(
+		testsupport.FixtureEvent.String(),
+		func(msg interface{}) bool {
+			return msg.(model.Event).ID() == event.ID()
+		},
+		time.Second,
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	BeforeEach(func() {
-		var err error
-		bus, err = NewMemoryBus(logger.NewStdLogger("EventBus"))
-		Expect(err).ToNot(HaveOccurred())
+	repoEvents, err := eventRepo.Fetch(testsupport.FixtureAggregateID)
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(repoEvents) != 1 || !reflect.DeepEqual(repoEvents[0], event) {
+		t.Fatalf("expected only inserted event in repo, got %+v", repoEvents)
+	}
+}
+
+func TestLoggedEventRepoFetch(t *testing.T) {
+	bus := newBus(t)
+	eventRepo := newLoggedEventRepo(t, bus)
+	agg1Events := genDummyEventData(t, 3)
+	agg2Events := genDummyEventData(t, 2)
+
+	for _, event := range dummyEvents(t, append(agg1Events, agg2Events...)) {
+		err := eventRepo.InsertAndPublish(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+	}
 
-		eventRepo, err = NewLoggedEventRepo(&LoggedEventRepoCfg{
-			Bus:            bus,
-			EventStore:     NewMemoryEventStore(),
-			UnpublishedLog: NewMemoryUnpublishedLog(),
-		})
+	for _, aggEvents := range [][]testEventData{agg1Events, agg2Events} {
+		events, err := eventRepo.Fetch(aggEvents[0].aggID)
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		err = validateEvents(events, aggEvents)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoggedEventRepoSource(t *testing.T) {
+	bus := newBus(t)
+	eventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
+		Bus:            bus,
+		EventStore:     eventutil.NewMemoryEventStore(),
+		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+		Source:         "instance-1",
+	})
+	if err != nil {
+		t.Fatalf("error creating event-repo: %s", err)
+	}
 
-		// Generates data for an aggregate with
-		// specified number of events with random
-		// data
-		genDummyEventData := func(numEvents int) []testEventData {
-			testEvents := make([]testEventData, numEvents)
-			aggID, err := uuid.NewRandom()
-			Expect(err).ToNot(HaveOccurred())
-
-			for i := 0; i < numEvents; i++ {
-				data, err := uuid.NewRandom()
-				Expect(err).ToNot(HaveOccurred())
-
-				testEvents[i] = testEventData{
-					aggID: aggID.String(),
-					time:  time.Now().UTC(),
-					data:  []byte(data.String()),
-				}
-			}
-			return testEvents
+	untagged := newEvent(t)
+	tagged, err := testsupport.NewEventBuilder().
+		WithSource("instance-2").
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	for _, event := range []model.Event{untagged, tagged} {
+		err := eventRepo.InsertAndPublish(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
 		}
+	}
 
-		agg1Events = genDummyEventData(3)
-		agg2Events = genDummyEventData(2)
-	})
+	events, err := eventRepo.Fetch(testsupport.FixtureAggregateID)
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got: %d", len(events))
+	}
+	// Untagged event is tagged with repo's
+	// source, and other sources are kept.
+	if events[0].ID() != untagged.ID() || events[0].Source() != "instance-1" {
+		t.Fatalf("expected event tagged with repo's source, got: %q", events[0].Source())
+	}
+	if events[1].ID() != tagged.ID() || events[1].Source() != "instance-2" {
+		t.Fatalf("expected event's own source, got: %q", events[1].Source())
+	}
+}
 
-	AfterEach(func() {
-		bus.Terminate()
+func TestLoggedEventRepoFetchByIndex(t *testing.T) {
+	testFetchByIndex(t, func(t *testing.T) (eventInserter, indexFetcher) {
+		eventRepo := newLoggedEventRepo(t, newBus(t))
+		return eventRepo.InsertAndPublish, eventRepo.FetchByIndex
 	})
+}
 
-	It("inserts event into event-store and publishes on bus", func() {
-		sub, err := bus.Subscribe(testEvent.String())
-		Expect(err).ToNot(HaveOccurred())
-		event, err := model.NewEvent(&model.EventCfg{
-			AggregateID: "1",
-			Action:      testEvent,
-			Data:        []byte("test-data"),
-		})
-		Expect(err).ToNot(HaveOccurred())
+func TestLoggedEventRepoConcurrentOrder(t *testing.T) {
+	const numRoutines = 10
+	const numEventsPerRoutine = 20
+	const numEvents = numRoutines * numEventsPerRoutine
+
+	bus := newBus(t)
+	eventRepo := newLoggedEventRepo(t, bus)
+
+	// Recorder drains subscription concurrently,
+	// since publishing blocks on subscribers.
+	recorder, err := testsupport.NewBusRecorder(bus, testsupport.FixtureEvent.String())
+	if err != nil {
+		t.Fatalf("error creating recorder: %s", err)
+	}
+	defer recorder.Stop()
 
-		grp, _ := errgroup.WithContext(context.Background())
+	grp, _ := errgroup.WithContext(context.Background())
+	for i := 0; i < numRoutines; i++ {
 		grp.Go(func() error {
-			select {
-			case msg := <-sub:
-				msgEvent, castSuccess := msg.(model.Event)
-				if !castSuccess {
-					return errors.New("failed casting message")
+			for j := 0; j < numEventsPerRoutine; j++ {
+				event, err := testsupport.NewEventBuilder().Build()
+				if err != nil {
+					return errors.Wrap(err, "error creating event")
 				}
-				if msgEvent.ID() != event.ID() {
-					return errors.New("event mismatched")
+				err = eventRepo.InsertAndPublish(event)
+				if err != nil {
+					return errors.Wrap(err, "error inserting event")
 				}
-			case <-time.After(1 * time.Second):
-				return errors.New("timed-out waiting for event on bus")
 			}
 			return nil
 		})
+	}
+	err = grp.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		err = eventRepo.InsertAndPublish(event)
-		Expect(err).ToNot(HaveOccurred())
-		err = grp.Wait()
-		Expect(err).ToNot(HaveOccurred())
-
-		repoEvents, err := eventRepo.Fetch("1")
-		Expect(err).ToNot(HaveOccurred())
-		Expect(repoEvents).To(HaveLen(1))
-		Expect(repoEvents[0]).To(Equal(event))
-	})
+	numReceived := 0
+	_, err = recorder.WaitFor(
+		testsupport.FixtureEvent.String(),
+		func(interface{}) bool {
+			numReceived++
+			return numReceived == numEvents
+		},
+		time.Second,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	It("fetches events by aggregateID", func() {
-		// ============ Insert Dummy Events ============
-		testDataArr := append(agg1Events, agg2Events...)
-
-		for _, eventData := range testDataArr {
-			event, err := model.NewEvent(&model.EventCfg{
-				AggregateID: eventData.aggID,
-				Time:        eventData.time,
-				Action:      testEvent,
-				Data:        eventData.data,
-			})
-			Expect(err).ToNot(HaveOccurred())
-			err = eventRepo.InsertAndPublish(event)
-			Expect(err).ToNot(HaveOccurred())
+	storedEvents, err := eventRepo.Fetch(testsupport.FixtureAggregateID)
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(storedEvents) != numEvents {
+		t.Fatalf("expected %d stored events, got %d", numEvents, len(storedEvents))
+	}
+	publishedMsgs := recorder.Messages(testsupport.FixtureEvent.String())
+	for i, event := range storedEvents {
+		if publishedMsgs[i].(model.Event).ID() != event.ID() {
+			t.Fatalf("published order differs from stored order at index %d", i)
 		}
+	}
+}
 
-		// ============ Validation/Tests ============
-		agg1 := agg1Events[0].aggID
-		agg2 := agg2Events[0].aggID
+func TestLoggedEventRepoDataIsolatedFromSubscribers(t *testing.T) {
+	bus := newBus(t)
+	eventRepo := newLoggedEventRepo(t, bus)
 
-		agg1StoreEvents, err := eventRepo.Fetch(agg1)
-		Expect(err).ToNot(HaveOccurred())
-		err = validateEvents(agg1StoreEvents, agg1Events)
-		Expect(err).ToNot(HaveOccurred())
+	maliciousSub, err := bus.Subscribe(testsupport.FixtureEvent.String())
+	if err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+	otherSub, err := bus.Subscribe(testsupport.FixtureEvent.String())
+	if err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
 
-		agg2StoreEvents, err := eventRepo.Fetch(agg2)
-		Expect(err).ToNot(HaveOccurred())
-		err = validateEvents(agg2StoreEvents, agg2Events)
-		Expect(err).ToNot(HaveOccurred())
+	event := newEvent(t)
+	expectedData := string(event.Data())
+	errGroup, _ := errgroup.WithContext(context.Background())
+	errGroup.Go(func() error {
+		return eventRepo.InsertAndPublish(event)
 	})
 
-	When("fetching events by index", func() {
-		It("fetches all events when index is 0", func() {
-			testDataArr := append(agg1Events, agg2Events...)
-
-			for _, eventData := range testDataArr {
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: eventData.aggID,
-					Time:        eventData.time,
-					Action:      testEvent,
-					Data:        eventData.data,
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = eventRepo.InsertAndPublish(event)
-				Expect(err).ToNot(HaveOccurred())
-			}
-
-			index := 0
-			events, err := eventRepo.FetchByIndex(index)
-			Expect(err).ToNot(HaveOccurred())
-			err = validateEvents(events, testDataArr)
-			Expect(err).ToNot(HaveOccurred())
-		})
-
-		It("fetches missing events based on index", func() {
-			testDataArr := append(agg1Events, agg2Events...)
-
-			for _, eventData := range testDataArr {
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: eventData.aggID,
-					Time:        eventData.time,
-					Action:      testEvent,
-					Data:        eventData.data,
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = eventRepo.InsertAndPublish(event)
-				Expect(err).ToNot(HaveOccurred())
-			}
-
-			index := 2
-			events, err := eventRepo.FetchByIndex(index)
-			Expect(err).ToNot(HaveOccurred())
-			err = validateEvents(events, testDataArr[index:])
-			Expect(err).ToNot(HaveOccurred())
-		})
-
-		It("returns no events on last index", func() {
-			testDataArr := append(agg1Events, agg2Events...)
-
-			for _, eventData := range testDataArr {
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: eventData.aggID,
-					Time:        eventData.time,
-					Action:      testEvent,
-					Data:        eventData.data,
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = eventRepo.InsertAndPublish(event)
-				Expect(err).ToNot(HaveOccurred())
-			}
+	// Modifies payload in place before
+	// other subscriber receives event.
+	msg := <-maliciousSub
+	data := msg.(model.Event).Data()
+	for i := range data {
+		data[i] = 'X'
+	}
+	msg = <-otherSub
+	if string(msg.(model.Event).Data()) != expectedData {
+		t.Fatalf("expected data %q for other subscriber, got %q", expectedData, msg.(model.Event).Data())
+	}
+	err = errGroup.Wait()
+	if err != nil {
+		t.Fatalf("error inserting event: %s", err)
+	}
 
-			index := len(testDataArr)
-			events, err := eventRepo.FetchByIndex(index)
-			Expect(err).ToNot(HaveOccurred())
-			err = validateEvents(events, testDataArr[index:])
-			Expect(err).ToNot(HaveOccurred())
-		})
-	})
-})
+	repoEvents, err := eventRepo.Fetch(testsupport.FixtureAggregateID)
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(repoEvents) != 1 || string(repoEvents[0].Data()) != expectedData {
+		t.Fatalf("expected stored data %q, got %+v", expectedData, repoEvents)
+	}
+}
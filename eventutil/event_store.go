@@ -1,7 +1,9 @@
 package eventutil
 
 import (
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -16,6 +18,88 @@ type EventStore interface {
 	// than provided index.
 	// Index is incremented on every event-insertion into event-store.
 	FetchByIndex(index int) ([]model.Event, error)
+	// Stats returns size of event-store, along with topN
+	// aggregates by number of events, such as for monitoring.
+	// Event-stores without incremental stats can use #ScanStats.
+	Stats(topN int) EventStoreStats
+}
+
+// EventStoreStats is size of an EventStore.
+type EventStoreStats struct {
+	Events     int `json:"events"`
+	Aggregates int `json:"aggregates"`
+	// Optional, approximate bytes used by stored events.
+	// Zero if event-store can't determine it.
+	Bytes int64 `json:"bytes,omitempty"`
+	// Aggregates with most events, in descending order of
+	// events (and then ascending aggregate-id).
+	TopAggregates []AggregateStats `json:"top_aggregates"`
+	// Time of latest event of every aggregate
+	LastEventTimes map[string]time.Time `json:"last_event_times"`
+	// Number of events read to compute stats, zero
+	// if event-store maintains these on insertion.
+	ScannedEvents int `json:"scanned_events,omitempty"`
+}
+
+// AggregateStats is size of an aggregate in EventStore.
+type AggregateStats struct {
+	AggregateID   string    `json:"aggregate_id"`
+	Events        int       `json:"events"`
+	LastEventTime time.Time `json:"last_event_time"`
+}
+
+// StoreStatsProvider is implemented by event-repos
+// providing stats of their event-store.
+type StoreStatsProvider interface {
+	StoreStats(topN int) EventStoreStats
+}
+
+// ErrTxnIDsNotIndexed is returned by FetchIDs of
+// event-stores (and repos) which don't index
+// transaction-IDs of their events.
+var ErrTxnIDsNotIndexed = errors.New("transaction-ids are not indexed")
+
+// TxnIDRecord is transaction-ID of a stored event, along
+// with fields needed to track its transaction without
+// decoding the event. Extracted once when event is inserted
+// (see TxnIDExtractor).
+type TxnIDRecord struct {
+	// Aggregate of event, and position of event
+	// in its events, as returned by Fetch.
+	AggregateID string
+	Index       int
+	Action  model.EventAction
+	TxnID   string
+	TxnTime time.Time
+	// Optional value of event, such as
+	// balance after its transaction.
+	Value    float64
+	IsTest   bool
+	InputSeq uint64
+	// Optional category of transaction
+	Category string
+}
+
+// TxnIDExtractor extracts TxnIDRecord (except its AggregateID
+// and Index)
+// from event being inserted. Returns false for events
+// without a transaction, which aren't indexed.
+type TxnIDExtractor func(event model.Event) (TxnIDRecord, bool, error)
+
+// TxnIDFetcher is implemented by event-stores and repos
+// which index transaction-IDs of events as these are
+// inserted, so these can be read without fetching and
+// decoding events.
+type TxnIDFetcher interface {
+	// FetchIDs returns records of aggregate's indexed events,
+	// in order of insertion. Returns ErrTxnIDsNotIndexed if
+	// transaction-IDs aren't indexed.
+	FetchIDs(aggID string) ([]TxnIDRecord, error)
+	// FetchByTxnID returns records of indexed events with
+	// provided transaction-ID across all aggregates, in order
+	// of insertion. Returns ErrTxnIDsNotIndexed if
+	// transaction-IDs aren't indexed.
+	FetchByTxnID(txnID string) ([]TxnIDRecord, error)
 }
 
 // MemoryEventStore is in-memory EventStore without persistence.
@@ -23,6 +107,18 @@ type EventStore interface {
 type MemoryEventStore struct {
 	store       map[string][]model.Event
 	eventsIndex []model.Event
+	// Optional, records of transaction-IDs by aggregate-id,
+	// updated as events are inserted.
+	extractTxnID TxnIDExtractor
+	txnIDs       map[string][]TxnIDRecord
+	// Same records by transaction-id
+	txnIDRecords map[string][]TxnIDRecord
+	// Approximate bytes used by stored events,
+	// counted as these are inserted.
+	bytes int64
+	// Time of latest event by aggregate-id,
+	// updated as events are inserted.
+	lastEventTimes map[string]time.Time
 
 	lock *sync.RWMutex
 }
@@ -34,10 +130,26 @@ func NewMemoryEventStore() *MemoryEventStore {
 		store:       make(map[string][]model.Event),
 		eventsIndex: make([]model.Event, 0),
 
+		lastEventTimes: make(map[string]time.Time),
+
 		lock: &sync.RWMutex{},
 	}
 }
 
+// NewMemoryEventStoreWithTxnIDs creates a new instance of
+// MemoryEventStore, which indexes transaction-IDs of events
+// extracted using provided extractor (see #FetchIDs).
+func NewMemoryEventStoreWithTxnIDs(extract TxnIDExtractor) (*MemoryEventStore, error) {
+	if extract == nil {
+		return nil, errors.New("transaction-id extractor is nil")
+	}
+	s := NewMemoryEventStore()
+	s.extractTxnID = extract
+	s.txnIDs = make(map[string][]TxnIDRecord)
+	s.txnIDRecords = make(map[string][]TxnIDRecord)
+	return s, nil
+}
+
 // Insert validates and inserts provided event into event-store.
 // Duplicate events are ignored.
 func (s *MemoryEventStore) Insert(event model.Event) error {
@@ -58,12 +170,125 @@ func (s *MemoryEventStore) Insert(event model.Event) error {
 	}
 
 	aggEvents := s.store[event.AggregateID()]
+	if s.extractTxnID != nil {
+		record, ok, err := s.extractTxnID(event)
+		if err != nil {
+			return errors.Wrap(err, "error extracting transaction-id")
+		}
+		if ok {
+			record.AggregateID = event.AggregateID()
+			record.Index = len(aggEvents)
+			s.txnIDs[event.AggregateID()] = append(s.txnIDs[event.AggregateID()], record)
+			if record.TxnID != "" {
+				s.txnIDRecords[record.TxnID] = append(s.txnIDRecords[record.TxnID], record)
+			}
+		}
+	}
 	s.store[event.AggregateID()] = append(aggEvents, event)
 
 	s.eventsIndex = append(s.eventsIndex, event)
+	s.bytes += eventSize(event)
+	if event.Time().After(s.lastEventTimes[event.AggregateID()]) {
+		s.lastEventTimes[event.AggregateID()] = event.Time()
+	}
 	return nil
 }
 
+// eventSize returns approximate bytes used by event,
+// counting its data and string-fields.
+func eventSize(event model.Event) int64 {
+	size := len(event.RawData()) +
+		len(event.ID()) +
+		len(event.AggregateID()) +
+		len(event.CausationID()) +
+		len(event.CausationKey()) +
+		len(event.CorrelationKey()) +
+		len(event.Source()) +
+		len(event.Action())
+	return int64(size)
+}
+
+// Stats returns number of events and aggregates in event-store,
+// approximate bytes used by events, and topN aggregates by events.
+// Stats are maintained as events are inserted, so no events are
+// scanned.
+func (s *MemoryEventStore) Stats(topN int) EventStoreStats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	numEvents := make(map[string]int, len(s.store))
+	for aggID, aggEvents := range s.store {
+		numEvents[aggID] = len(aggEvents)
+	}
+	lastEventTimes := make(map[string]time.Time, len(s.lastEventTimes))
+	for aggID, lastEventTime := range s.lastEventTimes {
+		lastEventTimes[aggID] = lastEventTime
+	}
+
+	return EventStoreStats{
+		Events:         len(s.eventsIndex),
+		Aggregates:     len(s.store),
+		Bytes:          s.bytes,
+		TopAggregates:  topAggregates(numEvents, lastEventTimes, topN),
+		LastEventTimes: lastEventTimes,
+	}
+}
+
+// ScanStats returns stats of event-store containing provided
+// events (such as fetched using FetchByIndex(0)), for event-stores
+// which don't maintain stats on insertion. Cost grows with number
+// of events, which is reported as ScannedEvents.
+func ScanStats(events []model.Event, topN int) EventStoreStats {
+	stats := EventStoreStats{
+		Events:         len(events),
+		LastEventTimes: make(map[string]time.Time),
+		ScannedEvents:  len(events),
+	}
+	numEvents := make(map[string]int)
+	for _, event := range events {
+		aggID := event.AggregateID()
+		numEvents[aggID]++
+		stats.Bytes += eventSize(event)
+		if event.Time().After(stats.LastEventTimes[aggID]) {
+			stats.LastEventTimes[aggID] = event.Time()
+		}
+	}
+	stats.Aggregates = len(numEvents)
+	stats.TopAggregates = topAggregates(numEvents, stats.LastEventTimes, topN)
+	return stats
+}
+
+// topAggregates returns topN aggregates by number of events,
+// with ties ordered by aggregate-id, so order is deterministic.
+func topAggregates(
+	numEvents map[string]int,
+	lastEventTimes map[string]time.Time,
+	topN int,
+) []AggregateStats {
+	aggStats := make([]AggregateStats, 0, len(numEvents))
+	for aggID, count := range numEvents {
+		aggStats = append(aggStats, AggregateStats{
+			AggregateID:   aggID,
+			Events:        count,
+			LastEventTime: lastEventTimes[aggID],
+		})
+	}
+	sort.Slice(aggStats, func(i, j int) bool {
+		if aggStats[i].Events != aggStats[j].Events {
+			return aggStats[i].Events > aggStats[j].Events
+		}
+		return aggStats[i].AggregateID < aggStats[j].AggregateID
+	})
+
+	if topN < 0 {
+		topN = 0
+	}
+	if topN < len(aggStats) {
+		aggStats = aggStats[:topN]
+	}
+	return aggStats
+}
+
 // Fetch provides all events for a specific aggregate.
 func (s *MemoryEventStore) Fetch(aggID string) ([]model.Event, error) {
 	s.lock.RLock()
@@ -72,6 +297,34 @@ func (s *MemoryEventStore) Fetch(aggID string) ([]model.Event, error) {
 	return s.store[aggID], nil
 }
 
+// FetchIDs provides records of transaction-IDs of aggregate's
+// events, maintained as events are inserted. Returns
+// ErrTxnIDsNotIndexed unless event-store was created using
+// #NewMemoryEventStoreWithTxnIDs.
+func (s *MemoryEventStore) FetchIDs(aggID string) ([]TxnIDRecord, error) {
+	if s.extractTxnID == nil {
+		return nil, ErrTxnIDsNotIndexed
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.txnIDs[aggID], nil
+}
+
+// FetchByTxnID provides records of events with provided
+// transaction-ID across aggregates, maintained as events
+// are inserted. Returns ErrTxnIDsNotIndexed unless
+// event-store was created using #NewMemoryEventStoreWithTxnIDs.
+func (s *MemoryEventStore) FetchByTxnID(txnID string) ([]TxnIDRecord, error) {
+	if s.extractTxnID == nil {
+		return nil, ErrTxnIDsNotIndexed
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.txnIDRecords[txnID], nil
+}
+
 // FetchByIndex allows fetching the events
 // with index greater than provided index.
 // Index is incremented on every event-insertion
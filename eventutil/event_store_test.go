@@ -1,228 +1,392 @@
-package eventutil
+package eventutil_test
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
+	"reflect"
+	"testing"
 	"time"
 
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
-
-	"github.com/google/uuid"
-	"github.com/pkg/errors"
-
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
 )
 
-var _ = Describe("MemoryEventStore", func() {
-	const testEvent model.EventAction = "testEvent"
-	var store *MemoryEventStore
+func TestMemoryEventStoreInsert(t *testing.T) {
+	t.Run("stores valid events", func(t *testing.T) {
+		store := eventutil.NewMemoryEventStore()
+		testDataArr := append(genDummyEventData(t, 3), genDummyEventData(t, 2)...)
+
+		for _, event := range dummyEvents(t, testDataArr) {
+			err := store.Insert(event)
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
+			}
+		}
+	})
+
+	t.Run("ignores duplicate events", func(t *testing.T) {
+		store := eventutil.NewMemoryEventStore()
+		event := newEvent(t)
+
+		for i := 0; i < 2; i++ {
+			err := store.Insert(event)
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
+			}
+		}
+	})
 
-	type testEventData struct {
-		aggID string
-		time  time.Time
-		data  []byte
+	t.Run("errors when missing aggregate-id in event", func(t *testing.T) {
+		store := eventutil.NewMemoryEventStore()
+		event, err := testsupport.NewEventBuilder().
+			WithAggregateID("").
+			Build()
+		if err == nil {
+			t.Fatal("expected error creating event without aggregate-id")
+		}
+
+		err = store.Insert(event)
+		if err == nil {
+			t.Fatal("expected error inserting event without aggregate-id")
+		}
+	})
+}
+
+func TestMemoryEventStoreFetch(t *testing.T) {
+	store := eventutil.NewMemoryEventStore()
+	agg1Events := genDummyEventData(t, 3)
+	agg2Events := genDummyEventData(t, 2)
+
+	for _, event := range dummyEvents(t, append(agg1Events, agg2Events...)) {
+		err := store.Insert(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
 	}
 
-	var validateEvents = func(events []model.Event, testEvents []testEventData) error {
-		if len(events) != len(testEvents) {
-			return errors.New("length mismatch")
+	for _, aggEvents := range [][]testEventData{agg1Events, agg2Events} {
+		events, err := store.Fetch(aggEvents[0].aggID)
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
 		}
+		err = validateEvents(events, aggEvents)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
 
-		for i := 0; i < len(events); i++ {
-			event := events[i]
-			testData := testEvents[i]
+func TestMemoryEventStoreStats(t *testing.T) {
+	store := eventutil.NewMemoryEventStore()
+	if stats := store.Stats(0); stats.Events != 0 || stats.Aggregates != 0 || stats.Bytes != 0 {
+		t.Fatalf("expected empty stats, got: %+v", stats)
+	}
 
-			dataEqual := bytes.Equal(event.Data(), testData.data)
-			if !dataEqual {
-				return fmt.Errorf("data mismatch")
-			}
-			if event.Time().UnixNano() != testData.time.UnixNano() {
-				return errors.New("time mismatch")
+	events := dummyEvents(t, append(genDummyEventData(t, 3), genDummyEventData(t, 2)...))
+	// Duplicate event isn't counted
+	events = append(events, events[0])
+	for _, event := range events {
+		err := store.Insert(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+	}
+
+	stats := store.Stats(0)
+	if stats.Events != 5 || stats.Aggregates != 2 {
+		t.Fatalf("expected 5 events across 2 aggregates, got: %+v", stats)
+	}
+	var minBytes int64
+	for _, event := range events[:5] {
+		minBytes += int64(len(event.RawData()) + len(event.ID()))
+	}
+	if stats.Bytes < minBytes {
+		t.Fatalf("expected at least %d bytes, got: %d", minBytes, stats.Bytes)
+	}
+}
+
+func TestMemoryEventStoreTopAggregates(t *testing.T) {
+	store := eventutil.NewMemoryEventStore()
+	baseTime := time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	// Skewed distribution, events of an aggregate
+	// being an hour apart from its previous one.
+	numEvents := map[string]int{"a": 1, "b": 6, "c": 3, "d": 3, "e": 2}
+	for _, aggID := range []string{"a", "b", "c", "d", "e"} {
+		for i := 0; i < numEvents[aggID]; i++ {
+			event, err := testsupport.NewEventBuilder().
+				WithAggregateID(aggID).
+				WithTime(baseTime.Add(time.Duration(i) * time.Hour)).
+				Build()
+			if err != nil {
+				t.Fatalf("error creating event: %s", err)
 			}
-			if event.AggregateID() != testData.aggID {
-				return errors.New("id mismatch")
+			err = store.Insert(event)
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
 			}
 		}
-		return nil
 	}
 
-	var (
-		// We dont use slice/map here to have
-		// more individual control and significance
-		// of these IDs, since each ID should have
-		// very particular events associated
-		agg1Events []testEventData
-		agg2Events []testEventData
-	)
-
-	BeforeEach(func() {
-		store = NewMemoryEventStore()
-
-		// Generates data for an aggregate with
-		// specified number of events with random
-		// data
-		genDummyEventData := func(numEvents int) []testEventData {
-			testEvents := make([]testEventData, numEvents)
-			aggID, err := uuid.NewRandom()
-			Expect(err).ToNot(HaveOccurred())
-
-			for i := 0; i < numEvents; i++ {
-				data, err := uuid.NewRandom()
-				Expect(err).ToNot(HaveOccurred())
-
-				testEvents[i] = testEventData{
-					aggID: aggID.String(),
-					time:  time.Now().UTC(),
-					data:  []byte(data.String()),
-				}
-			}
-			return testEvents
+	stats := store.Stats(3)
+	if stats.Events != 15 || stats.Aggregates != 5 {
+		t.Fatalf("expected 15 events across 5 aggregates, got: %+v", stats)
+	}
+	// Ties are ordered by aggregate-id
+	expectedTop := []eventutil.AggregateStats{
+		{AggregateID: "b", Events: 6, LastEventTime: baseTime.Add(5 * time.Hour)},
+		{AggregateID: "c", Events: 3, LastEventTime: baseTime.Add(2 * time.Hour)},
+		{AggregateID: "d", Events: 3, LastEventTime: baseTime.Add(2 * time.Hour)},
+	}
+	if !reflect.DeepEqual(stats.TopAggregates, expectedTop) {
+		t.Fatalf("expected top aggregates: %+v, got: %+v", expectedTop, stats.TopAggregates)
+	}
+	for aggID, count := range numEvents {
+		expectedTime := baseTime.Add(time.Duration(count-1) * time.Hour)
+		if !stats.LastEventTimes[aggID].Equal(expectedTime) {
+			t.Errorf(
+				"expected last event-time of aggregate %s: %s, got: %s",
+				aggID, expectedTime, stats.LastEventTimes[aggID],
+			)
 		}
+	}
 
-		agg1Events = genDummyEventData(3)
-		agg2Events = genDummyEventData(2)
+	t.Run("includes all aggregates if top-N exceeds these", func(t *testing.T) {
+		if stats := store.Stats(10); len(stats.TopAggregates) != 5 {
+			t.Fatalf("expected 5 top aggregates, got: %+v", stats.TopAggregates)
+		}
 	})
 
-	When("storing events", func() {
-		It("stores valid events", func() {
-			testDataArr := append(agg1Events, agg2Events...)
-
-			for _, eventData := range testDataArr {
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: eventData.aggID,
-					Time:        eventData.time,
-					Action:      testEvent,
-					Data:        eventData.data,
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = store.Insert(event)
-				Expect(err).ToNot(HaveOccurred())
-			}
-		})
-
-		It("ignores duplicate events", func() {
-			event, err := model.NewEvent(&model.EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
+	t.Run("matches stats computed by scanning events", func(t *testing.T) {
+		events, err := store.FetchByIndex(0)
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		scanStats := eventutil.ScanStats(events, 3)
+		if scanStats.ScannedEvents != 15 {
+			t.Fatalf("expected 15 scanned events, got: %d", scanStats.ScannedEvents)
+		}
+		scanStats.ScannedEvents = 0
+		if !reflect.DeepEqual(scanStats, stats) {
+			t.Fatalf("expected scanned stats: %+v, got: %+v", stats, scanStats)
+		}
+	})
 
+	t.Run("doesn't scan events as store grows", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			event, err := testsupport.NewEventBuilder().
+				WithAggregateID(fmt.Sprintf("agg-%d", i%10)).
+				Build()
+			if err != nil {
+				t.Fatalf("error creating event: %s", err)
+			}
 			err = store.Insert(event)
-			Expect(err).ToNot(HaveOccurred())
-			err = store.Insert(event)
-			Expect(err).ToNot(HaveOccurred())
-		})
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
+			}
+		}
+		stats := store.Stats(3)
+		if stats.Events != 115 {
+			t.Fatalf("expected 115 events, got: %d", stats.Events)
+		}
+		if stats.ScannedEvents != 0 {
+			t.Fatalf("expected no scanned events, got: %d", stats.ScannedEvents)
+		}
+	})
+}
+
+func TestMemoryEventStoreFetchIDs(t *testing.T) {
+	t.Run("errors if transaction-ids aren't indexed", func(t *testing.T) {
+		store := eventutil.NewMemoryEventStore()
+		_, err := store.FetchIDs("agg")
+		if !errors.Is(err, eventutil.ErrTxnIDsNotIndexed) {
+			t.Fatalf("expected ErrTxnIDsNotIndexed, got: %v", err)
+		}
+		_, err = store.FetchByTxnID("txn")
+		if !errors.Is(err, eventutil.ErrTxnIDsNotIndexed) {
+			t.Fatalf("expected ErrTxnIDsNotIndexed, got: %v", err)
+		}
+	})
 
-		It("errors when missing aggregate-id in event", func() {
-			event, err := model.NewEvent(&model.EventCfg{
-				Action: testEvent,
-				Data:   []byte("test-data"),
-			})
-			Expect(err).To(HaveOccurred())
+	t.Run("indexes extracted transaction-ids on insert", func(t *testing.T) {
+		// Every other event has a transaction
+		numExtracted := 0
+		store, err := eventutil.NewMemoryEventStoreWithTxnIDs(
+			func(event model.Event) (eventutil.TxnIDRecord, bool, error) {
+				numExtracted++
+				if numExtracted%2 == 0 {
+					return eventutil.TxnIDRecord{}, false, nil
+				}
+				return eventutil.TxnIDRecord{
+					Action:  event.Action(),
+					TxnID:   event.ID(),
+					TxnTime: event.Time(),
+				}, true, nil
+			},
+		)
+		if err != nil {
+			t.Fatalf("error creating event-store: %s", err)
+		}
+		events := dummyEvents(t, genDummyEventData(t, 4))
+		for _, event := range events {
+			err := store.Insert(event)
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
+			}
+		}
 
-			err = store.Insert(event)
-			Expect(err).To(HaveOccurred())
-		})
+		records, err := store.FetchIDs(events[0].AggregateID())
+		if err != nil {
+			t.Fatalf("error fetching transaction-ids: %s", err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("expected 2 records, got: %d", len(records))
+		}
+		for i, record := range records {
+			event := events[record.Index]
+			if record.Index != i*2 || record.TxnID != event.ID() || !record.TxnTime.Equal(event.Time()) {
+				t.Fatalf("unexpected record: %+v", record)
+			}
+		}
 	})
 
-	It("fetches events by aggregate-id", func() {
-		// ============ Insert Dummy Events ============
-		testDataArr := append(agg1Events, agg2Events...)
-
-		for _, eventData := range testDataArr {
-			event, err := model.NewEvent(&model.EventCfg{
-				AggregateID: eventData.aggID,
-				Time:        eventData.time,
-				Action:      testEvent,
-				Data:        eventData.data,
-			})
-			Expect(err).ToNot(HaveOccurred())
-			err = store.Insert(event)
-			Expect(err).ToNot(HaveOccurred())
+	t.Run("indexes records by transaction-id across aggregates", func(t *testing.T) {
+		store, err := eventutil.NewMemoryEventStoreWithTxnIDs(
+			func(event model.Event) (eventutil.TxnIDRecord, bool, error) {
+				return eventutil.TxnIDRecord{
+					Action: event.Action(),
+					TxnID:  string(event.RawData()),
+				}, true, nil
+			},
+		)
+		if err != nil {
+			t.Fatalf("error creating event-store: %s", err)
+		}
+		// Both aggregates have same transaction-ids
+		var events []model.Event
+		for i := 0; i < 2; i++ {
+			eventsData := genDummyEventData(t, 2)
+			eventsData[0].data = []byte("txn-1")
+			eventsData[1].data = []byte("txn-2")
+			events = append(events, dummyEvents(t, eventsData)...)
+		}
+		for _, event := range events {
+			err := store.Insert(event)
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
+			}
 		}
 
-		// ============ Validation/Tests ============
-		agg1 := agg1Events[0].aggID
-		agg2 := agg2Events[0].aggID
+		records, err := store.FetchByTxnID("txn-2")
+		if err != nil {
+			t.Fatalf("error fetching transaction-id records: %s", err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("expected 2 records, got: %d", len(records))
+		}
+		for i, record := range records {
+			event := events[i*2+1]
+			if record.AggregateID != event.AggregateID() || record.Index != 1 || record.TxnID != "txn-2" {
+				t.Fatalf("unexpected record: %+v", record)
+			}
+		}
 
-		agg1StoreEvents, err := store.Fetch(agg1)
-		Expect(err).ToNot(HaveOccurred())
-		err = validateEvents(agg1StoreEvents, agg1Events)
-		Expect(err).ToNot(HaveOccurred())
+		records, err = store.FetchByTxnID("txn-3")
+		if err != nil {
+			t.Fatalf("error fetching transaction-id records: %s", err)
+		}
+		if len(records) != 0 {
+			t.Fatalf("expected no records, got: %d", len(records))
+		}
+	})
 
-		agg2StoreEvents, err := store.Fetch(agg2)
-		Expect(err).ToNot(HaveOccurred())
-		err = validateEvents(agg2StoreEvents, agg2Events)
-		Expect(err).ToNot(HaveOccurred())
+	t.Run("doesn't insert events failing extraction", func(t *testing.T) {
+		store, err := eventutil.NewMemoryEventStoreWithTxnIDs(
+			func(model.Event) (eventutil.TxnIDRecord, bool, error) {
+				return eventutil.TxnIDRecord{}, false, fmt.Errorf("invalid event")
+			},
+		)
+		if err != nil {
+			t.Fatalf("error creating event-store: %s", err)
+		}
+		event := newEvent(t)
+		err = store.Insert(event)
+		if err == nil {
+			t.Fatal("expected error inserting event")
+		}
+		events, err := store.Fetch(event.AggregateID())
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		if len(events) != 0 {
+			t.Fatalf("expected no events, got: %d", len(events))
+		}
 	})
+}
 
-	When("fetching events by index", func() {
-		It("fetches all events when index is 0", func() {
-			testDataArr := append(agg1Events, agg2Events...)
-
-			for _, eventData := range testDataArr {
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: eventData.aggID,
-					Time:        eventData.time,
-					Action:      testEvent,
-					Data:        eventData.data,
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = store.Insert(event)
-				Expect(err).ToNot(HaveOccurred())
-			}
+func TestMemoryEventStoreFetchByIndex(t *testing.T) {
+	testFetchByIndex(t, func(t *testing.T) (eventInserter, indexFetcher) {
+		store := eventutil.NewMemoryEventStore()
+		return store.Insert, store.FetchByIndex
+	})
+}
+
+type eventInserter func(model.Event) error
+
+type indexFetcher func(index int) ([]model.Event, error)
+
+// Shared by EventStore and EventRepo tests,
+// since both fetch events by index alike.
+func testFetchByIndex(
+	t *testing.T,
+	newStore func(t *testing.T) (eventInserter, indexFetcher),
+) {
+	tests := []struct {
+		name  string
+		index func(numEvents int) int
+	}{
+		{
+			name: "fetches all events when index is 0",
+			index: func(int) int {
+				return 0
+			},
+		},
+		{
+			name: "fetches missing events based on index",
+			index: func(int) int {
+				return 2
+			},
+		},
+		{
+			name: "returns no events on last index",
+			index: func(numEvents int) int {
+				return numEvents
+			},
+		},
+	}
 
-			index := 0
-			events, err := store.FetchByIndex(index)
-			Expect(err).ToNot(HaveOccurred())
-			err = validateEvents(events, testDataArr)
-			Expect(err).ToNot(HaveOccurred())
-		})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			insert, fetchByIndex := newStore(t)
+			testDataArr := append(genDummyEventData(t, 3), genDummyEventData(t, 2)...)
 
-		It("fetches missing events based on index", func() {
-			testDataArr := append(agg1Events, agg2Events...)
-
-			for _, eventData := range testDataArr {
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: eventData.aggID,
-					Time:        eventData.time,
-					Action:      testEvent,
-					Data:        eventData.data,
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = store.Insert(event)
-				Expect(err).ToNot(HaveOccurred())
+			for _, event := range dummyEvents(t, testDataArr) {
+				err := insert(event)
+				if err != nil {
+					t.Fatalf("error inserting event: %s", err)
+				}
 			}
 
-			index := 2
-			events, err := store.FetchByIndex(index)
-			Expect(err).ToNot(HaveOccurred())
-			err = validateEvents(events, testDataArr[index:])
-			Expect(err).ToNot(HaveOccurred())
-		})
-
-		It("returns no events on last index", func() {
-			testDataArr := append(agg1Events, agg2Events...)
-
-			for _, eventData := range testDataArr {
-				event, err := model.NewEvent(&model.EventCfg{
-					AggregateID: eventData.aggID,
-					Time:        eventData.time,
-					Action:      testEvent,
-					Data:        eventData.data,
-				})
-				Expect(err).ToNot(HaveOccurred())
-				err = store.Insert(event)
-				Expect(err).ToNot(HaveOccurred())
+			index := test.index(len(testDataArr))
+			events, err := fetchByIndex(index)
+			if err != nil {
+				t.Fatalf("error fetching events: %s", err)
 			}
-
-			index := len(testDataArr)
-			events, err := store.FetchByIndex(index)
-			Expect(err).ToNot(HaveOccurred())
 			err = validateEvents(events, testDataArr[index:])
-			Expect(err).ToNot(HaveOccurred())
+			if err != nil {
+				t.Fatal(err)
+			}
 		})
-	})
-})
+	}
+}
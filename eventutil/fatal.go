@@ -0,0 +1,19 @@
+package eventutil
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// MarkFatal marks error from an event-store, view-repo, or Bus
+// as fatal (see model#FatalError), since listeners can't process
+// further commands once these fail. Errors caused by Bus
+// terminating are returned as-is, since these are secondary to
+// whatever terminated the Bus.
+func MarkFatal(err error) error {
+	if err == nil || errors.Is(err, ErrBusTerminating) {
+		return err
+	}
+	return model.NewFatalError(err)
+}
@@ -0,0 +1,30 @@
+package eventutil_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+func TestMarkFatal(t *testing.T) {
+	if eventutil.MarkFatal(nil) != nil {
+		t.Fatal("expected nil error to be returned as-is")
+	}
+
+	storeErr := errors.New("store unavailable")
+	err := errors.Wrap(eventutil.MarkFatal(storeErr), "error inserting event")
+	if !model.IsFatal(err) {
+		t.Fatal("expected error to be marked fatal")
+	}
+	if !errors.Is(err, storeErr) {
+		t.Fatal("expected marked error to wrap original error")
+	}
+
+	termErr := eventutil.SubscriptionClosedError("test-action")
+	if model.IsFatal(eventutil.MarkFatal(termErr)) {
+		t.Fatal("expected error of terminating bus to not be marked fatal")
+	}
+}
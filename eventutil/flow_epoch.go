@@ -0,0 +1,117 @@
+package eventutil
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FlowEpoch identifies current phase of application-flow,
+// and is shared between the component driving the flow and
+// the listeners processing commands for it. Commands are
+// stamped with epoch they were issued in, and listeners
+// reject commands from an older epoch than the current one.
+// Use #NewFlowEpoch to create new instance.
+type FlowEpoch struct {
+	// Accessed atomically, kept first
+	// for 64-bit alignment.
+	epoch       uint64
+	numRejected uint64
+
+	// Guards issued-commands, and advancing epoch
+	lock *sync.Mutex
+	// Commands issued in current epoch (see #Issue),
+	// which are yet to be admitted.
+	numUnadmitted int
+	// Closed once issued commands are all admitted
+	admittedSigs []chan struct{}
+}
+
+// NewFlowEpoch creates new instance of FlowEpoch.
+func NewFlowEpoch() *FlowEpoch {
+	return &FlowEpoch{
+		lock: &sync.Mutex{},
+	}
+}
+
+// Current returns current epoch.
+func (e *FlowEpoch) Current() uint64 {
+	return atomic.LoadUint64(&e.epoch)
+}
+
+// Issue returns current epoch to stamp a command with, and
+// tracks command as issued until it's admitted, so component
+// driving the flow can wait for its commands (see #Admitted)
+// before advancing epoch.
+func (e *FlowEpoch) Issue() uint64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.numUnadmitted++
+	return e.Current()
+}
+
+// Advance moves to next epoch and returns it.
+// Commands issued in previous epochs are
+// rejected from here on.
+func (e *FlowEpoch) Advance() uint64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	epoch := atomic.AddUint64(&e.epoch, 1)
+	// Unadmitted commands will be rejected
+	e.numUnadmitted = 0
+	e.closeAdmittedSigs()
+	return epoch
+}
+
+// Admit returns true if provided epoch is not
+// older than current epoch. Rejected epochs
+// are counted, see #NumRejected.
+func (e *FlowEpoch) Admit(epoch uint64) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if epoch < e.Current() {
+		atomic.AddUint64(&e.numRejected, 1)
+		return false
+	}
+	// Commands not issued through #Issue
+	// (such as recovered ones) aren't tracked.
+	if e.numUnadmitted > 0 {
+		e.numUnadmitted--
+		if e.numUnadmitted == 0 {
+			e.closeAdmittedSigs()
+		}
+	}
+	return true
+}
+
+// Admitted returns channel which is closed once commands
+// issued in current epoch (see #Issue) are all admitted by
+// listeners, or epoch is advanced. Commands which are never
+// admitted (such as ones without listeners) keep it open.
+func (e *FlowEpoch) Admitted() <-chan struct{} {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	admittedSig := make(chan struct{})
+	if e.numUnadmitted == 0 {
+		close(admittedSig)
+		return admittedSig
+	}
+	e.admittedSigs = append(e.admittedSigs, admittedSig)
+	return admittedSig
+}
+
+func (e *FlowEpoch) closeAdmittedSigs() {
+	for _, admittedSig := range e.admittedSigs {
+		close(admittedSig)
+	}
+	e.admittedSigs = nil
+}
+
+// NumRejected returns number of
+// epochs rejected by #Admit.
+func (e *FlowEpoch) NumRejected() uint64 {
+	return atomic.LoadUint64(&e.numRejected)
+}
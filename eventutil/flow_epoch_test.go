@@ -0,0 +1,64 @@
+package eventutil_test
+
+import (
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+)
+
+// isSignalled returns true if signal-channel is closed.
+func isSignalled(sig <-chan struct{}) bool {
+	select {
+	case <-sig:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFlowEpochAdmittedAwaitsIssuedCmds(t *testing.T) {
+	flowEpoch := eventutil.NewFlowEpoch()
+	if !isSignalled(flowEpoch.Admitted()) {
+		t.Fatal("expected no commands to be awaited before any are issued")
+	}
+
+	epoch1 := flowEpoch.Issue()
+	epoch2 := flowEpoch.Issue()
+	admittedSig := flowEpoch.Admitted()
+	if !flowEpoch.Admit(epoch1) {
+		t.Fatal("expected command of current epoch to be admitted")
+	}
+	if isSignalled(admittedSig) {
+		t.Fatal("expected second issued command to be awaited")
+	}
+	if !flowEpoch.Admit(epoch2) {
+		t.Fatal("expected command of current epoch to be admitted")
+	}
+	if !isSignalled(admittedSig) {
+		t.Fatal("expected issued commands to be admitted")
+	}
+	if flowEpoch.NumRejected() != 0 {
+		t.Fatalf("expected no rejected commands, got: %d", flowEpoch.NumRejected())
+	}
+}
+
+func TestFlowEpochAdvanceRejectsUnadmittedCmds(t *testing.T) {
+	flowEpoch := eventutil.NewFlowEpoch()
+	epoch := flowEpoch.Issue()
+	admittedSig := flowEpoch.Admitted()
+
+	// Waiting ends once epoch advances,
+	// since command will be rejected.
+	if flowEpoch.Advance() != 1 {
+		t.Fatalf("expected epoch 1, got: %d", flowEpoch.Current())
+	}
+	if !isSignalled(admittedSig) {
+		t.Fatal("expected waiting for commands to end when epoch advances")
+	}
+	if flowEpoch.Admit(epoch) {
+		t.Fatal("expected command of previous epoch to be rejected")
+	}
+	if flowEpoch.NumRejected() != 1 {
+		t.Fatalf("expected 1 rejected command, got: %d", flowEpoch.NumRejected())
+	}
+}
@@ -0,0 +1,13 @@
+package eventutil_test
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("LOG_LEVEL", "warn")
+	os.Setenv("EVENTBUS_LOG_LEVEL", "error")
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,128 @@
+package eventutil
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// MigrateFunc migrates an event to its new form. Event is
+// returned as is if it doesn't need migration. Only data
+// of event may change (see model.Event#WithData).
+type MigrateFunc func(event model.Event) (model.Event, error)
+
+// MigrationFailure is an event which couldn't be migrated.
+type MigrationFailure struct {
+	EventID string
+	Err     error
+}
+
+// MigrationReport is result of migrating events.
+type MigrationReport struct {
+	// Events written to destination with changed data
+	Migrated int
+	// Events written to destination as is
+	Unchanged int
+	// Events not written to destination, see Failures
+	Failed   int
+	Failures []MigrationFailure
+}
+
+// MigrateEvents migrates all events of src, in index-order, and
+// writes these to dst in same order. Events which fail migration
+// are collected in report, and not written to dst.
+func MigrateEvents(src EventStore, dst EventStore, migrate MigrateFunc) (*MigrationReport, error) {
+	return MigrateEventsWithBudget(src, dst, migrate, -1)
+}
+
+// MigrateEventsWithBudget is same as #MigrateEvents, but aborts
+// migration once more than errorBudget events fail migration.
+// Negative error-budget allows any number of failures.
+// Report is returned along with error, and covers events
+// migrated till migration was aborted.
+func MigrateEventsWithBudget(
+	src EventStore,
+	dst EventStore,
+	migrate MigrateFunc,
+	errorBudget int,
+) (*MigrationReport, error) {
+	if src == nil {
+		return nil, errors.New("source event-store is nil")
+	}
+	if dst == nil {
+		return nil, errors.New("destination event-store is nil")
+	}
+	if migrate == nil {
+		return nil, errors.New("migrate-func is nil")
+	}
+
+	events, err := src.FetchByIndex(0)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching events from source event-store")
+	}
+
+	report := &MigrationReport{
+		Failures: make([]MigrationFailure, 0),
+	}
+	for _, event := range events {
+		migrated, err := migrateEvent(event, migrate)
+		if err != nil {
+			report.Failed++
+			report.Failures = append(report.Failures, MigrationFailure{
+				EventID: event.ID(),
+				Err:     err,
+			})
+			if errorBudget >= 0 && report.Failed > errorBudget {
+				return report, errors.Errorf(
+					"aborted migration after %d failure(s), error-budget is %d",
+					report.Failed, errorBudget,
+				)
+			}
+			continue
+		}
+
+		err = dst.Insert(migrated)
+		if err != nil {
+			return report, errors.Wrapf(
+				err,
+				"error inserting event into destination event-store: %s",
+				event.ID(),
+			)
+		}
+		if bytes.Equal(migrated.RawData(), event.RawData()) {
+			report.Unchanged++
+		} else {
+			report.Migrated++
+		}
+	}
+	return report, nil
+}
+
+// migrateEvent migrates event, and verifies that migration
+// didn't change identity or position of event in its flow.
+func migrateEvent(event model.Event, migrate MigrateFunc) (model.Event, error) {
+	migrated, err := migrate(event)
+	if err != nil {
+		return model.Event{}, err
+	}
+
+	switch {
+	case migrated.ID() != event.ID():
+		return model.Event{}, errors.New("migration changed event-id")
+	case migrated.AggregateID() != event.AggregateID(),
+		migrated.Action() != event.Action():
+		return model.Event{}, errors.New("migration changed aggregate-id or action")
+	case !migrated.Time().Equal(event.Time()):
+		return model.Event{}, errors.New("migration changed event-time")
+	case migrated.CausationID() != event.CausationID(),
+		migrated.CausationKey() != event.CausationKey(),
+		migrated.CorrelationKey() != event.CorrelationKey(),
+		migrated.InputSeq() != event.InputSeq():
+		return model.Event{}, errors.New("migration changed causation/correlation of event")
+	case migrated.Source() != event.Source():
+		return model.Event{}, errors.New("migration changed source of event")
+	}
+	return migrated, nil
+}
@@ -0,0 +1,162 @@
+package eventutil_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+// migrationSource creates store with events having data "v1-<n>"
+// or "v2-<n>" (for even n), for n starting from 0.
+func migrationSource(t *testing.T, numEvents int) (eventutil.EventStore, []model.Event) {
+	t.Helper()
+
+	eventTime := time.Date(2000, 1, 5, 10, 0, 0, 0, time.UTC)
+	store := eventutil.NewMemoryEventStore()
+	events := make([]model.Event, 0, numEvents)
+	for i := 0; i < numEvents; i++ {
+		version := "v1"
+		if i%2 == 0 {
+			version = "v2"
+		}
+		event, err := testsupport.NewEventBuilder().
+			WithAggregateID(fmt.Sprint(i % 3)).
+			WithAction(model.AccountDeposited).
+			WithCausationID(fmt.Sprintf("cause-%d", i)).
+			WithCorrelationKey(fmt.Sprintf("flow-%d", i)).
+			WithTime(eventTime.Add(time.Duration(i) * time.Second)).
+			WithData([]byte(fmt.Sprintf("%s-%d", version, i))).
+			Build()
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		err = store.Insert(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+		events = append(events, event)
+	}
+	return store, events
+}
+
+// upgradeV1 rewrites "v1" data-prefix to "v2".
+func upgradeV1(event model.Event) (model.Event, error) {
+	data := event.Data()
+	if !bytes.HasPrefix(data, []byte("v1")) {
+		return event, nil
+	}
+	return event.WithData(append([]byte("v2"), data[2:]...)), nil
+}
+
+func TestMigrateEvents(t *testing.T) {
+	src, events := migrationSource(t, 5)
+	dst := eventutil.NewMemoryEventStore()
+
+	report, err := eventutil.MigrateEvents(src, dst, upgradeV1)
+	if err != nil {
+		t.Fatalf("error migrating events: %s", err)
+	}
+	if report.Migrated != 2 || report.Unchanged != 3 || report.Failed != 0 {
+		t.Fatalf("expected 2 migrated and 3 unchanged events, got: %+v", report)
+	}
+
+	migrated, err := dst.FetchByIndex(0)
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(migrated) != len(events) {
+		t.Fatalf("expected %d events, got %d", len(events), len(migrated))
+	}
+	for i, event := range migrated {
+		expected := events[i].WithData([]byte(fmt.Sprintf("v2-%d", i)))
+		expectSameEvent(t, expected, event)
+		if event.CausationKey() != expected.CausationKey() || event.InputSeq() != expected.InputSeq() {
+			t.Fatalf("expected event %+v, got %+v", expected, event)
+		}
+	}
+}
+
+func TestMigrateEventsFailures(t *testing.T) {
+	// Fails migration of events with odd data-suffix
+	failOdd := func(event model.Event) (model.Event, error) {
+		data := event.Data()
+		if (data[len(data)-1]-'0')%2 == 1 {
+			return event, errors.New("migration-error")
+		}
+		return upgradeV1(event)
+	}
+
+	t.Run("collects failures", func(t *testing.T) {
+		src, events := migrationSource(t, 5)
+		dst := eventutil.NewMemoryEventStore()
+
+		report, err := eventutil.MigrateEvents(src, dst, failOdd)
+		if err != nil {
+			t.Fatalf("error migrating events: %s", err)
+		}
+		if report.Failed != 2 || report.Unchanged != 3 {
+			t.Fatalf("expected 2 failed and 3 unchanged events, got: %+v", report)
+		}
+		for i, failure := range report.Failures {
+			if failure.EventID != events[i*2+1].ID() || failure.Err == nil {
+				t.Fatalf("unexpected failure #%d: %+v", i, failure)
+			}
+		}
+		// Failed events aren't written
+		written, err := dst.FetchByIndex(0)
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		if len(written) != 3 {
+			t.Fatalf("expected 3 written events, got %d", len(written))
+		}
+	})
+
+	t.Run("aborts once error-budget is exceeded", func(t *testing.T) {
+		src, _ := migrationSource(t, 5)
+		dst := eventutil.NewMemoryEventStore()
+
+		report, err := eventutil.MigrateEventsWithBudget(src, dst, failOdd, 1)
+		if err == nil {
+			t.Fatal("expected migration to be aborted")
+		}
+		// Aborted on failure of fourth event
+		if report.Failed != 2 || report.Unchanged != 2 {
+			t.Fatalf("expected 2 failed and 2 unchanged events, got: %+v", report)
+		}
+
+		report, err = eventutil.MigrateEventsWithBudget(src, eventutil.NewMemoryEventStore(), failOdd, 2)
+		if err != nil {
+			t.Fatalf("expected failures within error-budget, got error: %s", err)
+		}
+		if report.Failed != 2 {
+			t.Fatalf("expected 2 failed events, got: %+v", report)
+		}
+	})
+
+	t.Run("fails events whose identity is changed", func(t *testing.T) {
+		src, _ := migrationSource(t, 1)
+		dst := eventutil.NewMemoryEventStore()
+
+		report, err := eventutil.MigrateEvents(src, dst, func(event model.Event) (model.Event, error) {
+			return testsupport.NewEventBuilder().
+				WithAggregateID(event.AggregateID()).
+				WithAction(event.Action()).
+				WithTime(event.Time()).
+				Build()
+		})
+		if err != nil {
+			t.Fatalf("error migrating events: %s", err)
+		}
+		if report.Failed != 1 {
+			t.Fatalf("expected 1 failed event, got: %+v", report)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package eventutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// ExportNDJSON writes all events in store, in index-order,
+// as newline-delimited JSON (one event per line). All fields
+// of events are written, so these can be restored exactly
+// using #ImportNDJSON.
+func ExportNDJSON(store EventStore, w io.Writer) error {
+	if store == nil {
+		return errors.New("event-store is nil")
+	}
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+
+	events, err := store.FetchByIndex(0)
+	if err != nil {
+		return errors.Wrap(err, "error fetching events from event-store")
+	}
+
+	bufWriter := bufio.NewWriter(w)
+	// Encoder terminates every event with newline
+	encoder := json.NewEncoder(bufWriter)
+	for _, event := range events {
+		err := encoder.Encode(event)
+		if err != nil {
+			return errors.Wrapf(err, "error writing event: %s", event.ID())
+		}
+	}
+	err = bufWriter.Flush()
+	return errors.Wrap(err, "error flushing events to writer")
+}
+
+// ImportNDJSON reads events written by #ExportNDJSON and
+// inserts them into store, in order these were written.
+// Events already in store are skipped by store.
+func ImportNDJSON(store EventStore, r io.Reader) error {
+	if store == nil {
+		return errors.New("event-store is nil")
+	}
+	if r == nil {
+		return errors.New("reader is nil")
+	}
+
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		event := model.Event{}
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error reading event #%d", line)
+		}
+
+		err = store.Insert(event)
+		if err != nil {
+			return errors.Wrapf(err, "error inserting event: %s", event.ID())
+		}
+	}
+}
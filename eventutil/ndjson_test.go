@@ -0,0 +1,129 @@
+package eventutil_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+func TestNDJSONRoundTrip(t *testing.T) {
+	eventTime := time.Date(2000, 1, 5, 10, 20, 30, 123456789, time.UTC)
+
+	root, err := testsupport.NewEventBuilder().
+		WithAggregateID("1").
+		WithAction(model.TxnRead).
+		WithTime(eventTime).
+		WithData([]byte("not json")).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	caused, err := testsupport.NewEventBuilder().
+		WithAggregateID("2").
+		WithAction(model.AccountDeposited).
+		WithCausationID(root.ID()).
+		WithCorrelationKey(root.ID()).
+		WithSource("instance-1").
+		WithTime(eventTime.Add(time.Nanosecond)).
+		WithData(map[string]string{"key": "value"}).
+		WithIsReplay(true).
+		WithPriority(model.PriorityControl).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+
+	store := eventutil.NewMemoryEventStore()
+	for _, event := range []model.Event{root, caused} {
+		err := store.Insert(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	err = eventutil.ExportNDJSON(store, buf)
+	if err != nil {
+		t.Fatalf("error exporting events: %s", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %s", len(lines), buf)
+	}
+
+	importStore := eventutil.NewMemoryEventStore()
+	err = eventutil.ImportNDJSON(importStore, buf)
+	if err != nil {
+		t.Fatalf("error importing events: %s", err)
+	}
+	imported, err := importStore.FetchByIndex(0)
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	original, err := store.FetchByIndex(0)
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(imported) != len(original) {
+		t.Fatalf("expected %d events, got %d", len(original), len(imported))
+	}
+	for i := range original {
+		expectSameEvent(t, original[i], imported[i])
+	}
+
+	// Events are indexed by aggregate as well
+	aggEvents, err := importStore.Fetch("2")
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(aggEvents) != 1 || aggEvents[0].ID() != caused.ID() {
+		t.Fatalf("expected aggregate-events to be restored, got: %v", aggEvents)
+	}
+}
+
+func TestImportNDJSONErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "malformed json", input: "{not json}\n"},
+		{name: "missing event-id", input: `{"aggregate_id":"1","action":"a","time":"2000-01-05T00:00:00Z"}` + "\n"},
+		{name: "missing time", input: `{"id":"1","aggregate_id":"1","action":"a"}` + "\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := eventutil.NewMemoryEventStore()
+			err := eventutil.ImportNDJSON(store, strings.NewReader(test.input))
+			if err == nil {
+				t.Fatal("expected error on import")
+			}
+		})
+	}
+}
+
+func expectSameEvent(t *testing.T, expected, actual model.Event) {
+	t.Helper()
+
+	if actual.ID() != expected.ID() ||
+		actual.AggregateID() != expected.AggregateID() ||
+		actual.CausationID() != expected.CausationID() ||
+		actual.CorrelationKey() != expected.CorrelationKey() ||
+		actual.Source() != expected.Source() ||
+		actual.Action() != expected.Action() ||
+		actual.IsReplay() != expected.IsReplay() ||
+		actual.Priority() != expected.Priority() {
+		t.Fatalf("expected event %+v, got %+v", expected, actual)
+	}
+	if !actual.Time().Equal(expected.Time()) {
+		t.Fatalf("expected event-time %s, got %s", expected.Time(), actual.Time())
+	}
+	if !bytes.Equal(actual.Data(), expected.Data()) {
+		t.Fatalf("expected event-data %q, got %q", expected.Data(), actual.Data())
+	}
+}
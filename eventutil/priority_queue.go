@@ -0,0 +1,170 @@
+package eventutil
+
+import (
+	"sync"
+)
+
+// priorityQueue queues messages for a subscription and
+// delivers them to subscription-channel, highest priority
+// first and in queued order within a priority.
+// Use #newPriorityQueue to create new instance.
+type priorityQueue struct {
+	channel chan<- interface{}
+
+	lock *sync.Mutex
+	// Sorted by priority (descending), then queued order
+	entries []queueEntry
+	nextSeq uint64
+	closed  bool
+
+	// Signals pump-routine that entries changed
+	notify   chan struct{}
+	closeSig chan struct{}
+	pumpDone chan struct{}
+}
+
+type queueEntry struct {
+	msg      interface{}
+	priority int
+	// Identifies entry within queue
+	seq uint64
+}
+
+// newPriorityQueue creates new instance of priorityQueue
+// and starts routine delivering messages to channel.
+func newPriorityQueue(channel chan<- interface{}) *priorityQueue {
+	q := &priorityQueue{
+		channel: channel,
+
+		lock:    &sync.Mutex{},
+		entries: make([]queueEntry, 0),
+
+		notify:   make(chan struct{}, 1),
+		closeSig: make(chan struct{}),
+		pumpDone: make(chan struct{}),
+	}
+	go q.pump()
+	return q
+}
+
+// push queues message for delivery.
+// Messages pushed after #close are discarded.
+func (q *priorityQueue) push(msg interface{}, priority int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return
+	}
+	// Insert after all entries with same or higher priority
+	i := len(q.entries)
+	for i > 0 && q.entries[i-1].priority < priority {
+		i--
+	}
+	q.entries = append(q.entries, queueEntry{})
+	copy(q.entries[i+1:], q.entries[i:])
+	q.entries[i] = queueEntry{
+		msg:      msg,
+		priority: priority,
+		seq:      q.nextSeq,
+	}
+	q.nextSeq++
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// head returns entry at head of queue. Any pending
+// notification is cleared, since head is up-to-date.
+func (q *priorityQueue) head() (queueEntry, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	select {
+	case <-q.notify:
+	default:
+	}
+	if len(q.entries) == 0 {
+		return queueEntry{}, false
+	}
+	return q.entries[0], true
+}
+
+// pump delivers queued messages to channel. Head of queue
+// is re-evaluated whenever new messages are queued, so a
+// higher-priority message isn't held behind a message
+// waiting for subscriber to receive it.
+func (q *priorityQueue) pump() {
+	defer close(q.pumpDone)
+
+	for {
+		entry, exists := q.head()
+		if !exists {
+			select {
+			case <-q.notify:
+				continue
+			case <-q.closeSig:
+				return
+			}
+		}
+
+		select {
+		case q.channel <- entry.msg:
+			q.remove(entry.seq)
+		case <-q.notify:
+		case <-q.closeSig:
+			return
+		}
+	}
+}
+
+// len returns number of messages queued, including
+// one being delivered, if any.
+func (q *priorityQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.entries)
+}
+
+// remove removes delivered entry from queue. Entry might
+// not be head anymore if a higher-priority message was
+// queued while it was being delivered.
+func (q *priorityQueue) remove(seq uint64) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, entry := range q.entries {
+		if entry.seq == seq {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// close stops delivering messages and discards queued
+// ones, which are returned in delivery-order. Channel is
+// not closed, but is safe to be closed once this returns.
+func (q *priorityQueue) close() []interface{} {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.lock.Unlock()
+
+	close(q.closeSig)
+	<-q.pumpDone
+
+	// Pump doesn't remove entries once it returns
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	discarded := make([]interface{}, len(q.entries))
+	for i, entry := range q.entries {
+		discarded[i] = entry.msg
+	}
+	q.entries = nil
+	return discarded
+}
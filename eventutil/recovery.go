@@ -0,0 +1,159 @@
+package eventutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Types of drained messages.
+const (
+	DrainedEvent = "event"
+	DrainedCmd   = "cmd"
+)
+
+// DrainedMsg is a message drained from Bus without being
+// received by subscribers, as written by #DrainTo.
+type DrainedMsg struct {
+	// Type of message, either DrainedEvent or DrainedCmd.
+	Type   string          `json:"type"`
+	Action string          `json:"action"`
+	ID     string          `json:"id"`
+	Msg    json.RawMessage `json:"msg"`
+}
+
+// DrainTo terminates Bus, and writes messages drained from its
+// subscriptions, which subscribers didn't receive, as
+// newline-delimited JSON (one #DrainedMsg per line). Messages are
+// written in action-order, and in order drained within an action.
+// Messages delivered to multiple subscriptions of same action are
+// written once. Returns number of messages written per action.
+// Requires Bus to be created with RetainDrained.
+func (b *MemoryBus) DrainTo(w io.Writer) (map[string]int, error) {
+	if !b.retainDrained {
+		return nil, errors.New("bus does not retain drained messages")
+	}
+	if w == nil {
+		return nil, errors.New("writer is nil")
+	}
+
+	b.Terminate()
+	// Drain-routines retain messages until they return
+	b.drainWg.Wait()
+
+	b.drainedLock.Lock()
+	drained := b.drained
+	b.drained = make([]drainedEntry, 0)
+	b.drainedLock.Unlock()
+
+	byAction := make(map[string][]drainedEntry)
+	actions := make([]string, 0)
+	for _, entry := range drained {
+		if _, exists := byAction[entry.action]; !exists {
+			actions = append(actions, entry.action)
+		}
+		byAction[entry.action] = append(byAction[entry.action], entry)
+	}
+	sort.Strings(actions)
+
+	counts := make(map[string]int)
+	bufWriter := bufio.NewWriter(w)
+	// Encoder terminates every message with newline
+	encoder := json.NewEncoder(bufWriter)
+	for _, action := range actions {
+		written := make(map[string]bool)
+		for _, entry := range byAction[action] {
+			drainedMsg, err := newDrainedMsg(action, entry.msg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error serializing message of action: %s", action)
+			}
+			if written[drainedMsg.ID] {
+				continue
+			}
+			err = encoder.Encode(drainedMsg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error writing message: %s", drainedMsg.ID)
+			}
+			written[drainedMsg.ID] = true
+			counts[action]++
+		}
+		b.log.Infof("[DrainTo]: [Action: %s]: Drained %d message(s)", action, counts[action])
+	}
+
+	err := bufWriter.Flush()
+	if err != nil {
+		return nil, errors.Wrap(err, "error flushing messages to writer")
+	}
+	return counts, nil
+}
+
+// newDrainedMsg serializes message drained from action.
+func newDrainedMsg(action string, msg interface{}) (DrainedMsg, error) {
+	var msgType, msgID string
+	switch v := msg.(type) {
+	case model.Cmd:
+		msgType = DrainedCmd
+		msgID = v.ID()
+	case model.Event:
+		msgType = DrainedEvent
+		msgID = v.ID()
+	default:
+		return DrainedMsg{}, errors.New("message is of unknown type")
+	}
+
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return DrainedMsg{}, errors.Wrap(err, "error json-marshalling message")
+	}
+	return DrainedMsg{
+		Type:   msgType,
+		Action: action,
+		ID:     msgID,
+		Msg:    msgBytes,
+	}, nil
+}
+
+// ReadDrained reads messages written by #DrainTo, in order
+// these were written. Messages are either model.Cmd or
+// model.Event, and can be published again to a Bus.
+func ReadDrained(r io.Reader) ([]interface{}, error) {
+	if r == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	msgs := make([]interface{}, 0)
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		drainedMsg := DrainedMsg{}
+		err := decoder.Decode(&drainedMsg)
+		if err == io.EOF {
+			return msgs, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decoding message on line %d", line)
+		}
+
+		switch drainedMsg.Type {
+		case DrainedCmd:
+			cmd := model.Cmd{}
+			err = json.Unmarshal(drainedMsg.Msg, &cmd)
+			msgs = append(msgs, cmd)
+		case DrainedEvent:
+			event := model.Event{}
+			err = json.Unmarshal(drainedMsg.Msg, &event)
+			msgs = append(msgs, event)
+		default:
+			return nil, errors.Errorf(
+				"message on line %d has unknown type: %q", line, drainedMsg.Type,
+			)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling message on line %d", line)
+		}
+	}
+}
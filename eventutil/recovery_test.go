@@ -0,0 +1,76 @@
+package eventutil_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+func TestMemoryBusDrainTo(t *testing.T) {
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		Log:           logger.NewStdLogger("EventBus"),
+		RetainDrained: true,
+	})
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+
+	// Subscriptions are never received from, so
+	// published messages stay buffered in these.
+	for _, action := range []string{
+		testsupport.FixtureEvent.String(),
+		testsupport.FixtureEvent.String(),
+		testsupport.FixtureCmd.String(),
+	} {
+		if _, err := bus.Subscribe(action); err != nil {
+			t.Fatalf("error subscribing to action %s: %s", action, err)
+		}
+	}
+	published := []interface{}{newEvent(t), newEvent(t), newCmd(t)}
+	for _, msg := range published {
+		if err := bus.Publish(msg); err != nil {
+			t.Fatalf("error publishing message: %s", err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	counts, err := bus.DrainTo(buf)
+	if err != nil {
+		t.Fatalf("error draining bus: %s", err)
+	}
+	// Events delivered to both subscriptions are written once
+	expectedCounts := map[string]int{
+		testsupport.FixtureEvent.String(): 2,
+		testsupport.FixtureCmd.String():   1,
+	}
+	if !reflect.DeepEqual(counts, expectedCounts) {
+		t.Fatalf("expected counts %v, got: %v", expectedCounts, counts)
+	}
+
+	drained, err := eventutil.ReadDrained(buf)
+	if err != nil {
+		t.Fatalf("error reading drained messages: %s", err)
+	}
+	// Written in action-order
+	expected := []interface{}{published[2], published[0], published[1]}
+	if !reflect.DeepEqual(drained, expected) {
+		t.Fatalf("expected drained messages %+v, got: %+v", expected, drained)
+	}
+}
+
+func TestMemoryBusDrainToRequiresRetention(t *testing.T) {
+	bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+
+	if _, err := bus.DrainTo(&bytes.Buffer{}); err == nil {
+		t.Fatal("expected error draining bus without retention")
+	}
+}
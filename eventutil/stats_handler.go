@@ -0,0 +1,60 @@
+package eventutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+// StoreStatsPath is path stats of event-store are served on.
+const StoreStatsPath = "/store/stats"
+
+// storeStatsHandler serves stats of an event-store over HTTP.
+type storeStatsHandler struct {
+	log         logger.Logger
+	provider    StoreStatsProvider
+	defaultTopN int
+}
+
+// NewStoreStatsHandler returns http.Handler serving stats of
+// provider's event-store (see EventStore#Stats) as JSON, for
+// requests such as: "GET /store/stats?top={N}". Number of top
+// aggregates defaults to defaultTopN if not specified.
+// Handler should be registered on StoreStatsPath.
+func NewStoreStatsHandler(
+	log logger.Logger,
+	provider StoreStatsProvider,
+	defaultTopN int,
+) http.Handler {
+	return &storeStatsHandler{
+		log:         log,
+		provider:    provider,
+		defaultTopN: defaultTopN,
+	}
+}
+
+func (h *storeStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	topN := h.defaultTopN
+	if topParam := r.URL.Query().Get("top"); topParam != "" {
+		var err error
+		topN, err = strconv.Atoi(topParam)
+		if err != nil || topN < 0 {
+			http.Error(w, "query-param \"top\" must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats := h.provider.StoreStats(topN)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(stats)
+	if err != nil {
+		h.log.Errorf("Error writing event-store stats: %s", err)
+	}
+}
@@ -0,0 +1,84 @@
+package eventutil_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+// storeStatsFunc provides stats of an event-store from func.
+type storeStatsFunc func(topN int) eventutil.EventStoreStats
+
+func (f storeStatsFunc) StoreStats(topN int) eventutil.EventStoreStats {
+	return f(topN)
+}
+
+func TestStoreStatsHandler(t *testing.T) {
+	store := eventutil.NewMemoryEventStore()
+	for _, event := range dummyEvents(t, append(genDummyEventData(t, 3), genDummyEventData(t, 2)...)) {
+		err := store.Insert(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+	}
+	handler := eventutil.NewStoreStatsHandler(
+		logger.NewStdLogger("StoreStatsHandler"),
+		storeStatsFunc(store.Stats),
+		1,
+	)
+
+	serve := func(method string, target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+		return recorder
+	}
+
+	t.Run("serves stats with default top-N", func(t *testing.T) {
+		recorder := serve(http.MethodGet, eventutil.StoreStatsPath)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got: %d", recorder.Code)
+		}
+		stats := eventutil.EventStoreStats{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &stats)
+		if err != nil {
+			t.Fatalf("error unmarshalling stats: %s", err)
+		}
+		if stats.Events != 5 || stats.Aggregates != 2 {
+			t.Fatalf("expected 5 events across 2 aggregates, got: %+v", stats)
+		}
+		if len(stats.TopAggregates) != 1 || stats.TopAggregates[0].Events != 3 {
+			t.Fatalf("expected top aggregate with 3 events, got: %+v", stats.TopAggregates)
+		}
+		if len(stats.LastEventTimes) != 2 {
+			t.Fatalf("expected last event-times of 2 aggregates, got: %+v", stats.LastEventTimes)
+		}
+	})
+
+	t.Run("serves requested top-N", func(t *testing.T) {
+		recorder := serve(http.MethodGet, eventutil.StoreStatsPath+"?top=2")
+		stats := eventutil.EventStoreStats{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &stats)
+		if err != nil {
+			t.Fatalf("error unmarshalling stats: %s", err)
+		}
+		if len(stats.TopAggregates) != 2 {
+			t.Fatalf("expected 2 top aggregates, got: %+v", stats.TopAggregates)
+		}
+	})
+
+	t.Run("rejects invalid top-N", func(t *testing.T) {
+		if recorder := serve(http.MethodGet, eventutil.StoreStatsPath+"?top=-1"); recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got: %d", recorder.Code)
+		}
+	})
+
+	t.Run("rejects methods other than GET", func(t *testing.T) {
+		if recorder := serve(http.MethodPost, eventutil.StoreStatsPath); recorder.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected status 405, got: %d", recorder.Code)
+		}
+	})
+}
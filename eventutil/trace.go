@@ -0,0 +1,55 @@
+package eventutil
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// TraceChain reconstructs causal path of an event, by following
+// causation-ids backwards from provided event until an event
+// without causation-id (root) is reached. Events are returned in
+// causal order, starting with root.
+// All events in path must be in provided store, so to trace
+// across event-repos, use a store with events from all of them.
+func TraceChain(store EventStore, eventID string) ([]model.Event, error) {
+	if store == nil {
+		return nil, errors.New("event-store is nil")
+	}
+	if eventID == "" {
+		return nil, errors.New("event-id cannot be empty")
+	}
+
+	events, err := store.FetchByIndex(0)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching events from event-store")
+	}
+	eventsByID := make(map[string]model.Event, len(events))
+	for _, event := range events {
+		eventsByID[event.ID()] = event
+	}
+
+	chain := make([]model.Event, 0)
+	visited := make(map[string]struct{})
+	for id := eventID; id != ""; {
+		if _, exists := visited[id]; exists {
+			return nil, fmt.Errorf("causation-cycle detected at event: %s", id)
+		}
+		visited[id] = struct{}{}
+
+		event, exists := eventsByID[id]
+		if !exists {
+			return nil, fmt.Errorf("event not found in event-store: %s", id)
+		}
+		chain = append(chain, event)
+		id = event.CausationID()
+	}
+
+	// Reverse so root is first
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
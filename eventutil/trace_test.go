@@ -0,0 +1,105 @@
+package eventutil_test
+
+import (
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+// causedEvent builds event caused by provided
+// message, as producers do for inbound commands.
+func causedEvent(
+	t *testing.T,
+	action model.EventAction,
+	causationID string,
+	correlationKey string,
+) model.Event {
+	t.Helper()
+
+	event, err := testsupport.NewEventBuilder().
+		WithAction(action).
+		WithCausationID(causationID).
+		WithCorrelationKey(correlationKey).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	return event
+}
+
+func TestTraceChain(t *testing.T) {
+	const txnResult model.EventAction = "txnResult"
+
+	// read -> create -> process -> result
+	read := causedEvent(t, model.TxnRead, "", "")
+	created := causedEvent(t, model.TxnCreated, read.ID(), read.ID())
+	deposited := causedEvent(t, model.AccountDeposited, created.ID(), read.ID())
+	result := causedEvent(t, txnResult, deposited.ID(), read.ID())
+	// Unrelated flow
+	otherRead := causedEvent(t, model.TxnRead, "", "")
+	otherCreated := causedEvent(t, model.TxnCreated, otherRead.ID(), otherRead.ID())
+
+	store := eventutil.NewMemoryEventStore()
+	// Inserted out of causal order
+	for _, event := range []model.Event{
+		result, otherCreated, deposited, read, otherRead, created,
+	} {
+		err := store.Insert(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+	}
+
+	t.Run("returns path from root to event", func(t *testing.T) {
+		chain, err := eventutil.TraceChain(store, result.ID())
+		if err != nil {
+			t.Fatalf("error tracing chain: %s", err)
+		}
+
+		expected := []model.Event{read, created, deposited, result}
+		if len(chain) != len(expected) {
+			t.Fatalf("expected %d events in chain, got: %d", len(expected), len(chain))
+		}
+		for i, event := range chain {
+			if event.ID() != expected[i].ID() {
+				t.Errorf(
+					"expected event %d to be '%s', got: '%s'",
+					i, expected[i].Action(), event.Action(),
+				)
+			}
+		}
+	})
+
+	t.Run("returns only event if it has no cause", func(t *testing.T) {
+		chain, err := eventutil.TraceChain(store, read.ID())
+		if err != nil {
+			t.Fatalf("error tracing chain: %s", err)
+		}
+		if len(chain) != 1 || chain[0].ID() != read.ID() {
+			t.Fatalf("expected chain with only root-event, got: %v", chain)
+		}
+	})
+
+	t.Run("errors if event in path is missing", func(t *testing.T) {
+		partialStore := eventutil.NewMemoryEventStore()
+		for _, event := range []model.Event{read, deposited, result} {
+			err := partialStore.Insert(event)
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
+			}
+		}
+		_, err := eventutil.TraceChain(partialStore, result.ID())
+		if err == nil {
+			t.Fatal("expected error for missing event")
+		}
+	})
+
+	t.Run("errors for unknown event-id", func(t *testing.T) {
+		_, err := eventutil.TraceChain(store, "unknown")
+		if err == nil {
+			t.Fatal("expected error for unknown event")
+		}
+	})
+}
@@ -0,0 +1,356 @@
+package eventutil
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
+)
+
+// MismatchHandler handles a message delivered to a typed
+// subscription (see #SubscribeEvents and #SubscribeCmds)
+// which isn't of the subscription's type, such as a command
+// published on an action subscribed to for events.
+type MismatchHandler func(action string, msg interface{})
+
+// MismatchReporter is implemented by Buses which handle messages
+// of unexpected type delivered to their typed subscriptions, such
+// as MemoryBus (see MemoryBusCfg#MismatchHandler). Mismatches on
+// other Buses are only logged.
+type MismatchReporter interface {
+	ReportMismatch(action string, msg interface{})
+}
+
+// typedSub is a Bus-subscription adapted to a typed channel.
+type typedSub struct {
+	bus    Bus
+	action string
+	// Underlying subscription on Bus
+	channel <-chan interface{}
+	// Closed to stop adapter-routine, such as when it's
+	// blocked on a consumer which stopped receiving.
+	stopSig  chan struct{}
+	stopOnce *sync.Once
+	// Only set for channels of a group (see #SubscribeEventGroup),
+	// which share underlying subscription. Set to 1 once it's
+	// unsubscribed through any of these.
+	groupUnsubscribed *uint32
+}
+
+func (s *typedSub) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopSig)
+	})
+}
+
+// typedSubRegistry tracks typed subscriptions by their typed
+// channel, so these can be unsubscribed using the typed channel.
+// These are tracked until unsubscribed, even if closed by Bus,
+// so unsubscribing reports the Bus's error.
+type typedSubRegistry struct {
+	lock *sync.Mutex
+	subs map[interface{}]*typedSub
+}
+
+func newTypedSubRegistry() *typedSubRegistry {
+	return &typedSubRegistry{
+		lock: &sync.Mutex{},
+		subs: make(map[interface{}]*typedSub),
+	}
+}
+
+func (r *typedSubRegistry) track(c interface{}, sub *typedSub) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.subs[c] = sub
+}
+
+func (r *typedSubRegistry) get(c interface{}) (*typedSub, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	sub, exists := r.subs[c]
+	return sub, exists
+}
+
+func (r *typedSubRegistry) untrack(c interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.subs, c)
+}
+
+// typedSubTracker is implemented by Buses which track their
+// own typed subscriptions, such as MemoryBus, so these are
+// released along with Bus.
+type typedSubTracker interface {
+	typedSubs() *typedSubRegistry
+}
+
+// sharedTypedSubs tracks typed subscriptions of Buses which
+// don't track these themselves, such as wrappers which only
+// provide Bus-interface.
+var sharedTypedSubs = newTypedSubRegistry()
+
+// typedSubsOf returns registry tracking typed subscriptions of bus.
+func typedSubsOf(bus Bus) *typedSubRegistry {
+	tracker, isTracker := bus.(typedSubTracker)
+	if !isTracker {
+		return sharedTypedSubs
+	}
+	return tracker.typedSubs()
+}
+
+// logMismatch is the default MismatchHandler,
+// which logs a warning and skips the message.
+func logMismatch(action string, msg interface{}) {
+	logger.NewStdLogger("TypedSubscription").Warnf(
+		"[Action: %s]: Skipped message of unexpected type: %T", action, msg,
+	)
+}
+
+// CollectMismatches returns MismatchHandler which logs a
+// warning same as default handler, and collects it with
+// code warnings.TypeMismatch.
+func CollectMismatches(collector warnings.Collector) MismatchHandler {
+	collector = warnings.OrNoop(collector)
+	return func(action string, msg interface{}) {
+		logMismatch(action, msg)
+		collector.Add(
+			"typedSubscription",
+			warnings.TypeMismatch,
+			fmt.Sprintf("action %s: unexpected type: %T", action, msg),
+		)
+	}
+}
+
+// handleMismatch reports message of unexpected type delivered
+// to a typed subscription of bus (see MismatchReporter).
+func handleMismatch(bus Bus, action string, msg interface{}) {
+	reporter, isReporter := bus.(MismatchReporter)
+	if !isReporter {
+		logMismatch(action, msg)
+		return
+	}
+	reporter.ReportMismatch(action, msg)
+}
+
+// SubscribeEvents subscribes to action on bus, and delivers
+// its events on returned channel. Messages which aren't events
+// are skipped and handled as mismatches (see MismatchReporter).
+// Channel is closed once the underlying subscription is closed,
+// such as when bus terminates. Use #UnsubscribeEvents to
+// unsubscribe.
+func SubscribeEvents(bus Bus, action model.EventAction) (<-chan model.Event, error) {
+	sub, err := newTypedSub(bus, action.String())
+	if err != nil {
+		return nil, err
+	}
+
+	channel := make(chan model.Event)
+	typedSubsOf(bus).track((<-chan model.Event)(channel), sub)
+
+	go func() {
+		defer close(channel)
+
+		for msg := range sub.channel {
+			if msg == nil {
+				continue
+			}
+			event, castSuccess := msg.(model.Event)
+			if !castSuccess {
+				handleMismatch(sub.bus, sub.action, msg)
+				continue
+			}
+			select {
+			case channel <- event:
+			case <-sub.stopSig:
+				return
+			}
+		}
+	}()
+	return channel, nil
+}
+
+// SubscribeCmds subscribes to action on bus, and delivers
+// its commands on returned channel. Messages which aren't
+// commands are skipped and handled as mismatches (see
+// MismatchReporter). Channel is closed once the underlying
+// subscription is closed, such as when bus terminates.
+// Use #UnsubscribeCmds to unsubscribe.
+func SubscribeCmds(bus Bus, action model.CmdAction) (<-chan model.Cmd, error) {
+	sub, err := newTypedSub(bus, action.String())
+	if err != nil {
+		return nil, err
+	}
+
+	channel := make(chan model.Cmd)
+	typedSubsOf(bus).track((<-chan model.Cmd)(channel), sub)
+
+	go func() {
+		defer close(channel)
+
+		for msg := range sub.channel {
+			if msg == nil {
+				continue
+			}
+			cmd, castSuccess := msg.(model.Cmd)
+			if !castSuccess {
+				handleMismatch(sub.bus, sub.action, msg)
+				continue
+			}
+			select {
+			case channel <- cmd:
+			case <-sub.stopSig:
+				return
+			}
+		}
+	}()
+	return channel, nil
+}
+
+// SubscribeEventGroup subscribes to actions on bus as a single
+// group-subscription (see GroupSubscriber), and delivers events
+// of every action on its own channel. Events are routed one at a
+// time, in order bus delivers these to group, so a control-event
+// is received ahead of a backlog of events of other actions. An
+// event is hence only delivered once the previous one is received,
+// and consumer must receive from all channels. If bus doesn't
+// support group-subscriptions, every action is subscribed to
+// separately instead (see #SubscribeEvents). Use
+// #UnsubscribeEvents to unsubscribe, and unsubscribing any
+// channel of group unsubscribes all.
+func SubscribeEventGroup(
+	bus Bus,
+	actions []model.EventAction,
+) (map[model.EventAction]<-chan model.Event, error) {
+	if bus == nil {
+		return nil, errors.New("bus is nil")
+	}
+	names := make([]string, 0, len(actions))
+	for _, action := range actions {
+		names = append(names, action.String())
+	}
+	channels := make(map[model.EventAction]<-chan model.Event)
+
+	var busChannel <-chan interface{}
+	err := ErrGroupsUnsupported
+	groupBus, isGroupBus := bus.(GroupSubscriber)
+	if isGroupBus {
+		busChannel, err = groupBus.SubscribeGroup(names)
+	}
+	if errors.Is(err, ErrGroupsUnsupported) {
+		for _, action := range actions {
+			channels[action], err = SubscribeEvents(bus, action)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error subscribing to action: %s", action)
+			}
+		}
+		return channels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stopSig := make(chan struct{})
+	stopOnce := &sync.Once{}
+	groupUnsubscribed := new(uint32)
+	routes := make(map[model.EventAction]chan model.Event)
+	typedSubs := typedSubsOf(bus)
+	for _, action := range actions {
+		channel := make(chan model.Event)
+		routes[action] = channel
+		channels[action] = channel
+		typedSubs.track((<-chan model.Event)(channel), &typedSub{
+			bus:               bus,
+			action:            action.String(),
+			channel:           busChannel,
+			stopSig:           stopSig,
+			stopOnce:          stopOnce,
+			groupUnsubscribed: groupUnsubscribed,
+		})
+	}
+
+	go func() {
+		defer func() {
+			for _, channel := range routes {
+				close(channel)
+			}
+		}()
+
+		for msg := range busChannel {
+			if msg == nil {
+				continue
+			}
+			event, castSuccess := msg.(model.Event)
+			if !castSuccess {
+				handleMismatch(bus, strings.Join(names, ","), msg)
+				continue
+			}
+			select {
+			case routes[event.Action()] <- event:
+			case <-stopSig:
+				return
+			}
+		}
+	}()
+	return channels, nil
+}
+
+// UnsubscribeEvents removes subscription created using
+// #SubscribeEvents. Its channel is closed after unsubscribing.
+func UnsubscribeEvents(bus Bus, c <-chan model.Event, action model.EventAction) error {
+	return unsubscribeTyped(bus, c, action.String())
+}
+
+// UnsubscribeCmds removes subscription created using
+// #SubscribeCmds. Its channel is closed after unsubscribing.
+func UnsubscribeCmds(bus Bus, c <-chan model.Cmd, action model.CmdAction) error {
+	return unsubscribeTyped(bus, c, action.String())
+}
+
+func newTypedSub(bus Bus, action string) (*typedSub, error) {
+	if bus == nil {
+		return nil, errors.New("bus is nil")
+	}
+	channel, err := bus.Subscribe(action)
+	if err != nil {
+		return nil, err
+	}
+	return &typedSub{
+		bus:      bus,
+		action:   action,
+		channel:  channel,
+		stopSig:  make(chan struct{}),
+		stopOnce: &sync.Once{},
+	}, nil
+}
+
+// unsubscribeTyped unsubscribes typed channel c, which
+// is either <-chan model.Event or <-chan model.Cmd.
+func unsubscribeTyped(bus Bus, c interface{}, action string) error {
+	if action == "" {
+		return errors.New("action is blank")
+	}
+
+	typedSubs := typedSubsOf(bus)
+	sub, exists := typedSubs.get(c)
+	if !exists || sub.bus != bus || sub.action != action {
+		return errors.New("no matching subscription found")
+	}
+
+	// Adapter-routine is stopped regardless of whether
+	// unsubscribing succeeds, such as when bus is already
+	// terminating, so it doesn't wait on consumer.
+	sub.stop()
+	typedSubs.untrack(c)
+	// Group's subscription is only removed from bus once
+	if sub.groupUnsubscribed != nil && !atomic.CompareAndSwapUint32(sub.groupUnsubscribed, 0, 1) {
+		return nil
+	}
+	return bus.Unsubscribe(sub.channel, action)
+}
@@ -0,0 +1,365 @@
+package eventutil_test
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+	"github.com/Jaskaranbir/es-bank-account/warnings"
+)
+
+// Returns true if typed channel gets closed within timeout.
+// Messages received on channel are discarded.
+func isCmdsClosed(c <-chan model.Cmd, timeout time.Duration) bool {
+	timer := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return true
+			}
+		case <-timer:
+			return false
+		}
+	}
+}
+
+func TestSubscribeEventsSkipsMismatches(t *testing.T) {
+	lock := &sync.Mutex{}
+	mismatches := make([]interface{}, 0)
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		Log: logger.NewStdLogger("EventBus"),
+		MismatchHandler: func(action string, msg interface{}) {
+			lock.Lock()
+			defer lock.Unlock()
+			if action == testsupport.FixtureEvent.String() {
+				mismatches = append(mismatches, msg)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+	// Mismatches are counted per bus
+	otherBus := newBus(t)
+
+	events, err := eventutil.SubscribeEvents(bus, testsupport.FixtureEvent)
+	if err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+
+	// Command published on an event-action
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		Action: model.CmdAction(testsupport.FixtureEvent),
+		Data:   []byte(testsupport.FixtureData),
+	})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+	if err := bus.Publish(cmd); err != nil {
+		t.Fatalf("error publishing command: %s", err)
+	}
+	event := newEvent(t)
+	if err := bus.Publish(event); err != nil {
+		t.Fatalf("error publishing event: %s", err)
+	}
+
+	select {
+	case received := <-events:
+		if received.ID() != event.ID() {
+			t.Fatalf("expected event %s, got: %s", event.ID(), received.ID())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected event to be received")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(mismatches) != 1 || mismatches[0].(model.Cmd).ID() != cmd.ID() {
+		t.Fatalf("expected command to be handled as mismatch, got: %+v", mismatches)
+	}
+	if n := bus.Mismatches(); n != 1 {
+		t.Fatalf("expected 1 mismatch to be counted, got: %d", n)
+	}
+	if n := otherBus.Mismatches(); n != 0 {
+		t.Fatalf("expected no mismatches on other bus, got: %d", n)
+	}
+}
+
+func TestCollectMismatches(t *testing.T) {
+	// Collected by default handler
+	collector := warnings.NewMemoryCollector(0)
+	bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+		Log:      logger.NewStdLogger("EventBus"),
+		Warnings: collector,
+	})
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+
+	cmds, err := eventutil.SubscribeCmds(bus, testsupport.FixtureCmd)
+	if err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+	// Event published on a command-action
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID: "1",
+		Action:      model.EventAction(testsupport.FixtureCmd),
+		Data:        []byte(testsupport.FixtureData),
+	})
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	if err := bus.Publish(event); err != nil {
+		t.Fatalf("error publishing event: %s", err)
+	}
+	// Received once mismatch is handled
+	if err := bus.Publish(newCmd(t)); err != nil {
+		t.Fatalf("error publishing command: %s", err)
+	}
+	select {
+	case <-cmds:
+	case <-time.After(time.Second):
+		t.Fatal("expected command to be received")
+	}
+
+	summary := collector.Summary()[warnings.TypeMismatch]
+	if summary.Count != 1 || len(summary.Details) != 1 {
+		t.Fatalf("expected 1 type-mismatch warning, got: %+v", summary)
+	}
+	if detail := summary.Details[0]; !strings.Contains(detail.Detail, testsupport.FixtureCmd.String()) {
+		t.Fatalf("expected warning to note action, got: %+v", detail)
+	}
+}
+
+func TestUnsubscribeCmds(t *testing.T) {
+	testCmd := testsupport.FixtureCmd
+
+	t.Run("closes typed channel", func(t *testing.T) {
+		bus := newBus(t)
+		cmds, err := eventutil.SubscribeCmds(bus, testCmd)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+		// Delivered to adapter, but never received
+		if err := bus.Publish(newCmd(t)); err != nil {
+			t.Fatalf("error publishing command: %s", err)
+		}
+
+		err = eventutil.UnsubscribeCmds(bus, cmds, testCmd)
+		if err != nil {
+			t.Fatalf("error unsubscribing: %s", err)
+		}
+		if !isCmdsClosed(cmds, time.Second) {
+			t.Fatal("expected typed channel to be closed")
+		}
+		// Publishing doesn't block on removed subscription
+		if err := bus.Publish(newCmd(t)); err != nil {
+			t.Fatalf("error publishing command: %s", err)
+		}
+	})
+
+	t.Run("closes typed channel on termination", func(t *testing.T) {
+		bus := newBus(t)
+		cmds, err := eventutil.SubscribeCmds(bus, testCmd)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		bus.Terminate()
+		if !isCmdsClosed(cmds, time.Second) {
+			t.Fatal("expected typed channel to be closed")
+		}
+		err = eventutil.UnsubscribeCmds(bus, cmds, testCmd)
+		if !errors.Is(err, eventutil.ErrBusTerminating) {
+			t.Fatalf("expected ErrBusTerminating on unsubscribe, got: %v", err)
+		}
+	})
+
+	t.Run("closes typed channel of wrapped bus", func(t *testing.T) {
+		// Only provides Bus-interface, so its typed
+		// subscriptions are tracked in shared registry.
+		bus := struct{ eventutil.Bus }{newBus(t)}
+		cmds, err := eventutil.SubscribeCmds(bus, testCmd)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		err = eventutil.UnsubscribeCmds(bus, cmds, testCmd)
+		if err != nil {
+			t.Fatalf("error unsubscribing: %s", err)
+		}
+		if !isCmdsClosed(cmds, time.Second) {
+			t.Fatal("expected typed channel to be closed")
+		}
+	})
+
+	t.Run("errors for unknown subscription", func(t *testing.T) {
+		bus := newBus(t)
+		cmds, err := eventutil.SubscribeCmds(bus, testCmd)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		if err := eventutil.UnsubscribeCmds(bus, make(chan model.Cmd), testCmd); err == nil {
+			t.Fatal("expected error unsubscribing unknown channel")
+		}
+		if err := eventutil.UnsubscribeCmds(bus, cmds, "other-action"); err == nil {
+			t.Fatal("expected error unsubscribing with other action")
+		}
+		if err := eventutil.UnsubscribeCmds(bus, cmds, testCmd); err != nil {
+			t.Fatalf("error unsubscribing: %s", err)
+		}
+		if err := eventutil.UnsubscribeCmds(bus, cmds, testCmd); err == nil {
+			t.Fatal("expected error unsubscribing twice")
+		}
+	})
+}
+
+// Returns true if typed channel gets closed within timeout.
+// Messages received on channel are discarded.
+func isEventsClosed(c <-chan model.Event, timeout time.Duration) bool {
+	timer := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return true
+			}
+		case <-timer:
+			return false
+		}
+	}
+}
+
+func TestSubscribeEventGroup(t *testing.T) {
+	const dataAction = model.EventAction("data")
+	const controlAction = model.EventAction("control")
+	actions := []model.EventAction{dataAction, controlAction}
+
+	newPriorityBus := func(t *testing.T) *eventutil.MemoryBus {
+		bus, err := eventutil.NewMemoryBusWithCfg(&eventutil.MemoryBusCfg{
+			Log:              logger.NewStdLogger("EventBus"),
+			PriorityDelivery: true,
+		})
+		if err != nil {
+			t.Fatalf("error creating bus: %s", err)
+		}
+		t.Cleanup(bus.Terminate)
+		return bus
+	}
+	publish := func(t *testing.T, bus eventutil.Bus, action model.EventAction, aggID string, priority int) {
+		event, err := testsupport.NewEventBuilder().
+			WithAction(action).
+			WithAggregateID(aggID).
+			WithPriority(priority).
+			Build()
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		if err := bus.Publish(event); err != nil {
+			t.Fatalf("error publishing: %s", err)
+		}
+	}
+
+	t.Run("delivers control-event ahead of backlog of other actions", func(t *testing.T) {
+		bus := newPriorityBus(t)
+		channels, err := eventutil.SubscribeEventGroup(bus, actions)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			publish(t, bus, dataAction, strconv.Itoa(i), model.PriorityNormal)
+		}
+		publish(t, bus, controlAction, "control", model.PriorityControl)
+		// Let delivery routine settle on queue-head
+		time.Sleep(10 * time.Millisecond)
+
+		received := make([]string, 0)
+		for len(received) < 6 {
+			select {
+			case event := <-channels[dataAction]:
+				received = append(received, event.AggregateID())
+			case event := <-channels[controlAction]:
+				received = append(received, event.AggregateID())
+			case <-time.After(time.Second):
+				t.Fatalf("timed-out waiting for events, received: %v", received)
+			}
+		}
+		// First data-event might already be routed
+		// before control-event is published.
+		if received[0] != "control" && received[1] != "control" {
+			t.Fatalf("expected control-event ahead of backlog, got: %v", received)
+		}
+	})
+
+	t.Run("unsubscribes group through any channel", func(t *testing.T) {
+		bus := newPriorityBus(t)
+		channels, err := eventutil.SubscribeEventGroup(bus, actions)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		for _, action := range actions {
+			err = eventutil.UnsubscribeEvents(bus, channels[action], action)
+			if err != nil {
+				t.Fatalf("error unsubscribing action %s: %s", action, err)
+			}
+			if !isEventsClosed(channels[action], time.Second) {
+				t.Fatalf("expected channel of action %s to be closed", action)
+			}
+		}
+		if stats := bus.SubscriptionStats(); stats[dataAction.String()].Subscribers != 0 {
+			t.Fatalf("expected no subscribers, got: %d", stats[dataAction.String()].Subscribers)
+		}
+		err = eventutil.UnsubscribeEvents(bus, channels[dataAction], dataAction)
+		if err == nil {
+			t.Fatal("expected error unsubscribing twice")
+		}
+	})
+
+	t.Run("errors for channel unsubscribed with other action of group", func(t *testing.T) {
+		bus := newPriorityBus(t)
+		channels, err := eventutil.SubscribeEventGroup(bus, actions)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		err = eventutil.UnsubscribeEvents(bus, channels[dataAction], controlAction)
+		if err == nil {
+			t.Fatal("expected error unsubscribing with other action")
+		}
+	})
+
+	t.Run("subscribes actions separately without priority-delivery", func(t *testing.T) {
+		bus := newBus(t)
+		channels, err := eventutil.SubscribeEventGroup(bus, actions)
+		if err != nil {
+			t.Fatalf("error subscribing: %s", err)
+		}
+
+		publish(t, bus, controlAction, "control", model.PriorityControl)
+		select {
+		case event := <-channels[controlAction]:
+			if event.AggregateID() != "control" {
+				t.Fatalf("expected control-event, got: %s", event.AggregateID())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected event to be received")
+		}
+		if stats := bus.SubscriptionStats(); stats[dataAction.String()].Subscribers != 1 {
+			t.Fatalf("expected a subscriber per action, got: %d", stats[dataAction.String()].Subscribers)
+		}
+	})
+}
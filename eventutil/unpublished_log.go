@@ -48,27 +48,18 @@ func (p *MemoryUnpublishedLog) Insert(event model.Event) error {
 
 // Pop removes an event from log.
 func (p *MemoryUnpublishedLog) Pop(event model.Event) error {
-	// Find element
-	p.lock.RLock()
-	index := -1
+	// Event is found and removed under same lock, otherwise
+	// concurrent pops can shift index of found event.
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	for i, storedEvent := range p.events {
 		if event.ID() == storedEvent.ID() {
-			index = i
-			break
+			p.events = append(p.events[:i], p.events[i+1:]...)
+			return nil
 		}
 	}
-	if index == -1 {
-		p.lock.RUnlock()
-		return errors.New("event not found in log")
-	}
-	p.lock.RUnlock()
-
-	// Remove element
-	p.lock.Lock()
-	p.events = append(p.events[:index], p.events[index+1:]...)
-	p.lock.Unlock()
-
-	return nil
+	return errors.New("event not found in log")
 }
 
 // Events returns all stored events in log.
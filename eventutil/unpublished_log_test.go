@@ -1,110 +1,87 @@
-package eventutil
+package eventutil_test
 
 import (
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
+	"reflect"
+	"testing"
 
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
 	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
 )
 
-var _ = Describe("MemoryUnpublishedLog", func() {
-	const testEvent model.EventAction = "testEvent"
-	var unpubLog *MemoryUnpublishedLog
+func TestMemoryUnpublishedLogInsertAndFetch(t *testing.T) {
+	unpubLog := eventutil.NewMemoryUnpublishedLog()
+	event1 := newEvent(t)
+	event2 := newEvent(t)
 
-	BeforeEach(func() {
-		unpubLog = NewMemoryUnpublishedLog()
-	})
-
-	Specify("insert events", func() {
-		event1, err := model.NewEvent(&model.EventCfg{
-			AggregateID: "1",
-			Action:      testEvent,
-			Data:        []byte("test-data"),
-		})
-		Expect(err).ToNot(HaveOccurred())
-		event2, err := model.NewEvent(&model.EventCfg{
-			AggregateID: "1",
-			Action:      testEvent,
-			Data:        []byte("test-data"),
-		})
-		Expect(err).ToNot(HaveOccurred())
+	for _, event := range []model.Event{event1, event2} {
+		err := unpubLog.Insert(event)
+		if err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+	}
 
-		err = unpubLog.Insert(event1)
-		Expect(err).ToNot(HaveOccurred())
-		err = unpubLog.Insert(event2)
-		Expect(err).ToNot(HaveOccurred())
-	})
+	events, err := unpubLog.Events()
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events[0], event1) || !reflect.DeepEqual(events[1], event2) {
+		t.Fatal("expected events to be fetched in inserted order")
+	}
+}
 
-	Specify("fetch events", func() {
-		event1, err := model.NewEvent(&model.EventCfg{
-			AggregateID: "1",
-			Action:      testEvent,
-			Data:        []byte("test-data"),
-		})
-		Expect(err).ToNot(HaveOccurred())
-		event2, err := model.NewEvent(&model.EventCfg{
-			AggregateID: "1",
-			Action:      testEvent,
-			Data:        []byte("test-data"),
-		})
-		Expect(err).ToNot(HaveOccurred())
+func TestMemoryUnpublishedLogPop(t *testing.T) {
+	t.Run("removes specified event from log", func(t *testing.T) {
+		unpubLog := eventutil.NewMemoryUnpublishedLog()
+		event1 := newEvent(t)
+		event2 := newEvent(t)
 
-		err = unpubLog.Insert(event1)
-		Expect(err).ToNot(HaveOccurred())
-		err = unpubLog.Insert(event2)
-		Expect(err).ToNot(HaveOccurred())
+		for _, event := range []model.Event{event1, event2} {
+			err := unpubLog.Insert(event)
+			if err != nil {
+				t.Fatalf("error inserting event: %s", err)
+			}
+		}
 
+		err := unpubLog.Pop(event1)
+		if err != nil {
+			t.Fatalf("error popping event: %s", err)
+		}
 		events, err := unpubLog.Events()
-		Expect(err).ToNot(HaveOccurred())
-		Expect(events).To(HaveLen(2))
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		if len(events) != 1 || !reflect.DeepEqual(events[0], event2) {
+			t.Fatalf("expected only second event to remain, got %+v", events)
+		}
 
-		Expect(events[0]).To(Equal(event1))
-		Expect(events[1]).To(Equal(event2))
+		err = unpubLog.Pop(event2)
+		if err != nil {
+			t.Fatalf("error popping event: %s", err)
+		}
+		events, err = unpubLog.Events()
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		if len(events) != 0 {
+			t.Fatalf("expected log to be empty, got %d events", len(events))
+		}
 	})
 
-	When("popping events", func() {
-		It("removes specified event from log", func() {
-			event1, err := model.NewEvent(&model.EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			event2, err := model.NewEvent(&model.EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-
-			err = unpubLog.Insert(event1)
-			Expect(err).ToNot(HaveOccurred())
-			err = unpubLog.Insert(event2)
-			Expect(err).ToNot(HaveOccurred())
-
-			err = unpubLog.Pop(event1)
-			Expect(err).ToNot(HaveOccurred())
-			events, err := unpubLog.Events()
-			Expect(err).ToNot(HaveOccurred())
-			Expect(events).To(HaveLen(1))
-			Expect(events[0]).To(Equal(event2))
-
-			err = unpubLog.Pop(event2)
-			Expect(err).ToNot(HaveOccurred())
-			events, err = unpubLog.Events()
-			Expect(err).ToNot(HaveOccurred())
-			Expect(events).To(HaveLen(0))
-		})
+	t.Run("errors when event is not found in log", func(t *testing.T) {
+		unpubLog := eventutil.NewMemoryUnpublishedLog()
+		err := unpubLog.Pop(newEvent(t))
+		if err == nil {
+			t.Fatal("expected error popping missing event")
+		}
+	})
+}
 
-		It("errors when event is not found in log", func() {
-			event, err := model.NewEvent(&model.EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			err = unpubLog.Pop(event)
-			Expect(err).To(HaveOccurred())
-		})
+func TestMemoryUnpublishedLogConformance(t *testing.T) {
+	testsupport.UnpublishedLogSuite(t, func() eventutil.UnpublishedLog {
+		return eventutil.NewMemoryUnpublishedLog()
 	})
-})
+}
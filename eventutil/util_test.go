@@ -0,0 +1,140 @@
+package eventutil_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+type testEventData struct {
+	aggID string
+	time  time.Time
+	data  []byte
+}
+
+// Generates data for an aggregate with
+// specified number of events with random
+// data
+func genDummyEventData(t *testing.T, numEvents int) []testEventData {
+	t.Helper()
+
+	testEvents := make([]testEventData, numEvents)
+	aggID, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatalf("error generating aggregate-id: %s", err)
+	}
+
+	for i := 0; i < numEvents; i++ {
+		data, err := uuid.NewRandom()
+		if err != nil {
+			t.Fatalf("error generating data: %s", err)
+		}
+
+		testEvents[i] = testEventData{
+			aggID: aggID.String(),
+			time:  time.Now().UTC(),
+			data:  []byte(data.String()),
+		}
+	}
+	return testEvents
+}
+
+func dummyEvents(t *testing.T, testEvents []testEventData) []model.Event {
+	t.Helper()
+
+	events := make([]model.Event, len(testEvents))
+	for i, eventData := range testEvents {
+		event, err := testsupport.NewEventBuilder().
+			WithAggregateID(eventData.aggID).
+			WithTime(eventData.time).
+			WithData(eventData.data).
+			Build()
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		events[i] = event
+	}
+	return events
+}
+
+func validateEvents(events []model.Event, testEvents []testEventData) error {
+	if len(events) != len(testEvents) {
+		return errors.New("length mismatch")
+	}
+
+	for i := 0; i < len(events); i++ {
+		event := events[i]
+		testData := testEvents[i]
+
+		dataEqual := bytes.Equal(event.Data(), testData.data)
+		if !dataEqual {
+			return fmt.Errorf("data mismatch")
+		}
+		if event.Time().UnixNano() != testData.time.UnixNano() {
+			return errors.New("time mismatch")
+		}
+		if event.AggregateID() != testData.aggID {
+			return errors.New("id mismatch")
+		}
+	}
+	return nil
+}
+
+func newEvent(t *testing.T) model.Event {
+	t.Helper()
+
+	event, err := testsupport.NewEventBuilder().Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	return event
+}
+
+func newCmd(t *testing.T) model.Cmd {
+	t.Helper()
+
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		Action: testsupport.FixtureCmd,
+		Data:   []byte(testsupport.FixtureData),
+	})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+	return cmd
+}
+
+func newBus(t *testing.T) *eventutil.MemoryBus {
+	t.Helper()
+
+	bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+	return bus
+}
+
+// Returns true if channel gets closed within timeout.
+// Messages received on channel are discarded.
+func isClosed(c <-chan interface{}, timeout time.Duration) bool {
+	timer := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return true
+			}
+		case <-timer:
+			return false
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package loadgen replays historical transactions against a
+// pipeline at an accelerated virtual time, keeping the gaps
+// between transactions (scaled by a multiplier), such as for
+// sizing deployments with realistic bursts of load.
+package loadgen
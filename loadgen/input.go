@@ -0,0 +1,112 @@
+package loadgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Line is a transaction-request (as read from input), scheduled
+// at its transaction-time. Data is published as is.
+type Line struct {
+	Time time.Time
+	Data []byte
+}
+
+// ReadTxnReqs reads newline-delimited transaction-requests (see
+// txn.CreateTxnReq), such as input of a past run, and returns
+// these sorted by their times (stable for equal times). Times
+// of requests without a time-format are parsed with
+// defaultTimeFmt. Blank lines are skipped.
+func ReadTxnReqs(r io.Reader, defaultTimeFmt string) ([]Line, error) {
+	if r == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	lines := make([]Line, 0)
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		line, err := newLine(data, defaultTimeFmt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading line #%d", lineNum)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "error scanning input")
+	}
+	sortLines(lines)
+	return lines, nil
+}
+
+// ReadEvents reads events exported by eventutil#ExportNDJSON, and
+// returns transaction-requests from data of events of provided
+// action (such as model.TxnRead), sorted by their times (stable
+// for equal times). Events of other actions are skipped.
+func ReadEvents(r io.Reader, action model.EventAction, defaultTimeFmt string) ([]Line, error) {
+	if r == nil {
+		return nil, errors.New("reader is nil")
+	}
+
+	lines := make([]Line, 0)
+	decoder := json.NewDecoder(r)
+	for eventNum := 1; ; eventNum++ {
+		event := model.Event{}
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading event #%d", eventNum)
+		}
+		if event.Action() != action {
+			continue
+		}
+		line, err := newLine(event.RawData(), defaultTimeFmt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading event: %s", event.ID())
+		}
+		lines = append(lines, line)
+	}
+	sortLines(lines)
+	return lines, nil
+}
+
+// newLine returns line of transaction-request in data.
+func newLine(data []byte, defaultTimeFmt string) (Line, error) {
+	req, err := txn.ParseTxnReq(data)
+	if err != nil {
+		return Line{}, errors.Wrap(err, "error parsing transaction-request")
+	}
+	timeFmt := req.TimeFmt
+	if timeFmt == "" {
+		timeFmt = defaultTimeFmt
+	}
+	txnTime, err := txn.ParseTime(timeFmt, req.Time)
+	if err != nil {
+		return Line{}, errors.Wrapf(err, "error parsing time of transaction: %s", req.ID)
+	}
+	return Line{
+		Time: txnTime,
+		// Copied, since scanners reuse their buffers
+		Data: append([]byte(nil), data...),
+	}, nil
+}
+
+func sortLines(lines []Line) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+}
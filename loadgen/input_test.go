@@ -0,0 +1,106 @@
+package loadgen_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/loadgen"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+const timeFmt = "2006-01-02T15:04:05Z"
+
+func TestReadTxnReqsSortsByTime(t *testing.T) {
+	input := strings.Join([]string{
+		`{"id":"1","customer_id":"1","load_amount":"$1","time":"2000-01-05T02:00:00Z"}`,
+		`{"id":"2","customer_id":"1","load_amount":"$1","time":"2000-01-05T01:00:00Z"}`,
+		``,
+		`{"id":"3","customer_id":"2","load_amount":"$1","time":"2000-01-05T02:00:00Z"}`,
+		`{"id":"4","customer_id":"2","load_amount":"$1","time":"947030400","time_format":"epoch_seconds"}`,
+	}, "\n")
+
+	lines, err := loadgen.ReadTxnReqs(strings.NewReader(input), timeFmt)
+	if err != nil {
+		t.Fatalf("error reading transaction-requests: %s", err)
+	}
+	// Equal times keep their order from input
+	expectedIDs := []string{`"4"`, `"2"`, `"1"`, `"3"`}
+	if len(lines) != len(expectedIDs) {
+		t.Fatalf("expected %d lines, got: %d", len(expectedIDs), len(lines))
+	}
+	for i, line := range lines {
+		if !bytes.Contains(line.Data, []byte(`"id":`+expectedIDs[i])) {
+			t.Fatalf("expected line #%d to have id %s, got: %s", i+1, expectedIDs[i], line.Data)
+		}
+	}
+	if expected := time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC); !lines[0].Time.Equal(expected) {
+		t.Fatalf("expected time %s, got: %s", expected, lines[0].Time)
+	}
+}
+
+func TestReadTxnReqsErrorsOnInvalidLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "malformed JSON",
+			input: `{"id":"1"`,
+		},
+		{
+			name:  "invalid time",
+			input: `{"id":"1","customer_id":"1","load_amount":"$1","time":"yesterday"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadgen.ReadTxnReqs(strings.NewReader(test.input), timeFmt)
+			if err == nil {
+				t.Fatal("expected error reading transaction-requests")
+			}
+		})
+	}
+}
+
+func TestReadEventsFiltersByAction(t *testing.T) {
+	store := eventutil.NewMemoryEventStore()
+	events := []struct {
+		action model.EventAction
+		data   string
+	}{
+		{model.TxnRead, `{"id":"1","customer_id":"1","load_amount":"$1","time":"2000-01-05T02:00:00Z"}`},
+		{model.TxnCreated, `{"id":"1"}`},
+		{model.TxnRead, `{"id":"2","customer_id":"1","load_amount":"$1","time":"2000-01-05T01:00:00Z"}`},
+	}
+	for _, e := range events {
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      e.action,
+			Data:        []byte(e.data),
+		})
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		if err := store.Insert(event); err != nil {
+			t.Fatalf("error inserting event: %s", err)
+		}
+	}
+	exported := &bytes.Buffer{}
+	if err := eventutil.ExportNDJSON(store, exported); err != nil {
+		t.Fatalf("error exporting events: %s", err)
+	}
+
+	lines, err := loadgen.ReadEvents(exported, model.TxnRead, timeFmt)
+	if err != nil {
+		t.Fatalf("error reading events: %s", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got: %d", len(lines))
+	}
+	if string(lines[0].Data) != events[2].data || string(lines[1].Data) != events[0].data {
+		t.Fatalf("expected lines sorted by time, got: %s, %s", lines[0].Data, lines[1].Data)
+	}
+}
@@ -0,0 +1,282 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+const defaultBacklogPollInterval = 10 * time.Millisecond
+
+// Replayer publishes lines as events read from input, each
+// at its transaction-time on a virtual clock, which runs
+// faster than clock of Replayer by a multiplier.
+// Use #NewReplayer to create new instance.
+type Replayer struct {
+	log      logger.Logger
+	bus      eventutil.Bus
+	dataRead model.EventAction
+
+	multiplier          float64
+	clock               clock.Clock
+	lagTolerance        time.Duration
+	backlog             func() int
+	maxBacklog          int
+	backlogPollInterval time.Duration
+}
+
+// Cfg defines config for Replayer.
+type Cfg struct {
+	Log logger.Logger `validate:"nonnil"`
+
+	Bus eventutil.Bus `validate:"nonnil"`
+	// Published with lines as data, same as reader's events
+	DataRead model.EventAction `validate:"nonzero"`
+
+	// Virtual time runs this many times faster than clock,
+	// such as 60 for replaying an hour of transactions in
+	// a minute. Gaps between transactions are divided by
+	// this. Must be positive.
+	Multiplier float64
+	// Optional, defaults to clock.RealClock. With a
+	// clock.FakeClock, lines are only published as the
+	// clock is advanced, such as in tests.
+	Clock clock.Clock
+	// Optional, lines published behind schedule by more
+	// than this are counted as lagged (see Report), and
+	// replay falling behind is logged.
+	LagTolerance time.Duration `validate:"min=0"`
+
+	// Optional, returns number of published messages which
+	// pipeline hasn't handled yet, such as #BusBacklog.
+	// Sampled for every line (see Report#MaxBacklog).
+	Backlog func() int
+	// Optional, requires Backlog. Lines aren't published
+	// while backlog is at least this, so a pipeline which
+	// can't keep up makes replay fall behind schedule (see
+	// Report#MaxLag) instead of being flooded.
+	MaxBacklog int `validate:"min=0"`
+	// Optional, interval backlog is polled at
+	// while it's full. Defaults to 10ms.
+	BacklogPollInterval time.Duration `validate:"min=0"`
+}
+
+// Report is result of a replay.
+type Report struct {
+	Published int
+	// Span of transaction-times of lines
+	VirtualDuration time.Duration
+	// Time replay took as per clock of Replayer
+	Elapsed time.Duration
+	// Lines published per second of Elapsed.
+	// Zero if no time elapsed.
+	Throughput float64
+
+	// How late lines were published compared to their
+	// scheduled time, such as for a pipeline which can't
+	// keep up, as most and for last line.
+	MaxLag  time.Duration
+	LastLag time.Duration
+	// Lines which lagged by more than lag-tolerance
+	LaggedLines int
+	// Most backlog sampled. Zero if
+	// backlog isn't configured.
+	MaxBacklog int
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf(
+		"published %d line(s) spanning %s in %s (%.2f/sec), "+
+			"max lag: %s, last lag: %s, lagged lines: %d, max backlog: %d",
+		r.Published, r.VirtualDuration, r.Elapsed, r.Throughput,
+		r.MaxLag, r.LastLag, r.LaggedLines, r.MaxBacklog,
+	)
+}
+
+// NewReplayer validates Replayer-Config
+// and creates new Replayer-instance.
+func NewReplayer(cfg *Cfg) (*Replayer, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !(cfg.Multiplier > 0) {
+		return nil, fmt.Errorf("multiplier must be positive, got: %f", cfg.Multiplier)
+	}
+	if cfg.MaxBacklog > 0 && cfg.Backlog == nil {
+		return nil, errors.New("max-backlog requires backlog to be set")
+	}
+
+	var replayClock clock.Clock = clock.RealClock{}
+	if cfg.Clock != nil {
+		replayClock = cfg.Clock
+	}
+	backlogPollInterval := cfg.BacklogPollInterval
+	if backlogPollInterval == 0 {
+		backlogPollInterval = defaultBacklogPollInterval
+	}
+
+	return &Replayer{
+		log:      cfg.Log,
+		bus:      cfg.Bus,
+		dataRead: cfg.DataRead,
+
+		multiplier:          cfg.Multiplier,
+		clock:               replayClock,
+		lagTolerance:        cfg.LagTolerance,
+		backlog:             cfg.Backlog,
+		maxBacklog:          cfg.MaxBacklog,
+		backlogPollInterval: backlogPollInterval,
+	}, nil
+}
+
+// Replay publishes lines (sorted by time, see #ReadTxnReqs) in
+// order. First line is published right away, and every other
+// line once virtual time reaches its transaction-time. Lines
+// aren't skipped if replay falls behind schedule, but are
+// published as soon as possible, so lag is reported instead.
+// Replay stops if context is done.
+func (r *Replayer) Replay(ctx context.Context, lines []Line) (*Report, error) {
+	if ctx == nil {
+		return nil, errors.New("context is nil")
+	}
+	report := &Report{}
+	if len(lines) == 0 {
+		return report, nil
+	}
+	report.VirtualDuration = lines[len(lines)-1].Time.Sub(lines[0].Time)
+
+	start := r.clock.Now()
+	virtualStart := lines[0].Time
+	lagging := false
+	r.log.Infof(
+		"Replaying %d line(s) spanning %s at %.2fx",
+		len(lines), report.VirtualDuration, r.multiplier,
+	)
+	for i, line := range lines {
+		due := start.Add(r.realDuration(line.Time.Sub(virtualStart)))
+		err := r.waitUntil(ctx, due)
+		if err != nil {
+			return report, err
+		}
+		err = r.waitForBacklog(ctx, report)
+		if err != nil {
+			return report, err
+		}
+
+		lag := r.clock.Now().Sub(due)
+		if lag < 0 {
+			lag = 0
+		}
+		report.LastLag = lag
+		if lag > report.MaxLag {
+			report.MaxLag = lag
+		}
+		if lag > r.lagTolerance {
+			report.LaggedLines++
+			if !lagging {
+				r.log.Warnf("Replay fell behind schedule by %s at line #%d", lag, i+1)
+			}
+		} else if lagging {
+			r.log.Infof("Replay caught up with schedule at line #%d", i+1)
+		}
+		lagging = lag > r.lagTolerance
+
+		err = r.publish(uint64(i+1), line)
+		if err != nil {
+			return report, errors.Wrapf(err, "error publishing line #%d", i+1)
+		}
+		report.Published++
+	}
+
+	report.Elapsed = r.clock.Now().Sub(start)
+	if report.Elapsed > 0 {
+		report.Throughput = float64(report.Published) / report.Elapsed.Seconds()
+	}
+	r.log.Infof("Replay done: %s", report)
+	return report, nil
+}
+
+// realDuration returns duration of clock for
+// provided duration of virtual time.
+func (r *Replayer) realDuration(virtual time.Duration) time.Duration {
+	return time.Duration(float64(virtual) / r.multiplier)
+}
+
+// waitUntil waits till clock reaches provided time.
+func (r *Replayer) waitUntil(ctx context.Context, t time.Time) error {
+	wait := t.Sub(r.clock.Now())
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "replay stopped")
+	case <-r.clock.After(wait):
+		return nil
+	}
+}
+
+// waitForBacklog records backlog in report, and waits
+// while backlog is full, if max-backlog is set.
+func (r *Replayer) waitForBacklog(ctx context.Context, report *Report) error {
+	if r.backlog == nil {
+		return nil
+	}
+	for {
+		backlog := r.backlog()
+		if backlog > report.MaxBacklog {
+			report.MaxBacklog = backlog
+		}
+		if r.maxBacklog == 0 || backlog < r.maxBacklog {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "replay stopped")
+		case <-r.clock.After(r.backlogPollInterval):
+		}
+	}
+}
+
+// publish publishes line as read from input.
+func (r *Replayer) publish(inputSeq uint64, line Line) error {
+	aggID, err := uuid.NewRandom()
+	if err != nil {
+		return errors.Wrap(err, "error generating aggregate-id")
+	}
+	event, err := model.NewEvent(&model.EventCfg{
+		AggregateID: aggID.String(),
+		InputSeq:    inputSeq,
+		Action:      r.dataRead,
+		Data:        line.Data,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating event")
+	}
+	return r.bus.Publish(event)
+}
+
+// BusBacklog returns backlog of messages buffered for, but not
+// yet received by, subscribers of provided actions on Bus, such
+// as actions handled by pipeline's slowest stages. For use as
+// Cfg#Backlog.
+func BusBacklog(bus eventutil.BusIntrospector, actions ...string) func() int {
+	return func() int {
+		stats := bus.SubscriptionStats()
+		backlog := 0
+		for _, action := range actions {
+			backlog += stats[action].Buffered
+		}
+		return backlog
+	}
+}
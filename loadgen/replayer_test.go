@@ -0,0 +1,385 @@
+package loadgen_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/loadgen"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+var replayStart = time.Date(2000, 1, 5, 0, 0, 0, 0, time.UTC)
+
+// recordingBus records clock-time of every published message,
+// and optionally advances clock by a delay on every publish,
+// as if publishing blocked on a slow consumer.
+type recordingBus struct {
+	eventutil.Bus
+	clock *clock.FakeClock
+	delay time.Duration
+
+	lock   sync.Mutex
+	times  []time.Time
+	events []model.Event
+}
+
+func (b *recordingBus) Publish(msg interface{}) error {
+	b.lock.Lock()
+	b.times = append(b.times, b.clock.Now())
+	b.events = append(b.events, msg.(model.Event))
+	b.lock.Unlock()
+
+	if b.delay > 0 {
+		b.clock.Advance(b.delay)
+	}
+	return nil
+}
+
+// offsets returns clock-times of published
+// messages, relative to provided time.
+func (b *recordingBus) offsets(start time.Time) []time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	offsets := make([]time.Duration, 0, len(b.times))
+	for _, t := range b.times {
+		offsets = append(offsets, t.Sub(start))
+	}
+	return offsets
+}
+
+// linesAt returns lines with transaction-times
+// at provided offsets from replayStart.
+func linesAt(offsets ...time.Duration) []loadgen.Line {
+	lines := make([]loadgen.Line, 0, len(offsets))
+	for i, offset := range offsets {
+		lines = append(lines, loadgen.Line{
+			Time: replayStart.Add(offset),
+			Data: []byte(fmt.Sprintf(`{"id":"%d"}`, i+1)),
+		})
+	}
+	return lines
+}
+
+func newBus(t *testing.T) *eventutil.MemoryBus {
+	t.Helper()
+
+	bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	t.Cleanup(bus.Terminate)
+	return bus
+}
+
+func newReplayer(t *testing.T, cfg *loadgen.Cfg) *loadgen.Replayer {
+	t.Helper()
+
+	cfg.Log = logger.NewStdLogger("loadgen")
+	cfg.DataRead = model.TxnRead
+	replayer, err := loadgen.NewReplayer(cfg)
+	if err != nil {
+		t.Fatalf("error creating replayer: %s", err)
+	}
+	return replayer
+}
+
+// replay runs replay, advancing fake clock in steps
+// whenever replayer waits on it, till replay is done.
+func replay(
+	t *testing.T,
+	replayer *loadgen.Replayer,
+	fakeClock *clock.FakeClock,
+	lines []loadgen.Line,
+	step time.Duration,
+) *loadgen.Report {
+	t.Helper()
+
+	type result struct {
+		report *loadgen.Report
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		report, err := replayer.Replay(context.Background(), lines)
+		done <- result{report, err}
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case res := <-done:
+			if res.err != nil {
+				t.Fatalf("error replaying: %s", res.err)
+			}
+			return res.report
+		case <-timeout:
+			t.Fatal("timed-out waiting for replay")
+		default:
+		}
+		if fakeClock.Waiters() > 0 {
+			fakeClock.Advance(step)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestNewReplayerValidatesCfg(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *loadgen.Cfg
+	}{
+		{
+			name: "zero multiplier",
+			cfg:  &loadgen.Cfg{},
+		},
+		{
+			name: "negative multiplier",
+			cfg:  &loadgen.Cfg{Multiplier: -1},
+		},
+		{
+			name: "max-backlog without backlog",
+			cfg:  &loadgen.Cfg{Multiplier: 1, MaxBacklog: 10},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.cfg.Log = logger.NewStdLogger("loadgen")
+			test.cfg.Bus = newBus(t)
+			test.cfg.DataRead = model.TxnRead
+			_, err := loadgen.NewReplayer(test.cfg)
+			if err == nil {
+				t.Fatal("expected error creating replayer")
+			}
+		})
+	}
+}
+
+func TestReplayerScalesGapsByMultiplier(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := fakeClock.Now()
+	bus := &recordingBus{clock: fakeClock}
+	replayer := newReplayer(t, &loadgen.Cfg{
+		Bus:        bus,
+		Multiplier: 60,
+		Clock:      fakeClock,
+	})
+
+	// Burst of two lines at same time, then gaps of
+	// a minute and five minutes in virtual time.
+	lines := linesAt(0, 0, time.Minute, 6*time.Minute)
+	report := replay(t, replayer, fakeClock, lines, 100*time.Millisecond)
+
+	expected := []time.Duration{0, 0, time.Second, 6 * time.Second}
+	offsets := bus.offsets(start)
+	if fmt.Sprint(offsets) != fmt.Sprint(expected) {
+		t.Fatalf("expected lines published at %v, got: %v", expected, offsets)
+	}
+	for i, event := range bus.events {
+		if event.Action() != model.TxnRead {
+			t.Fatalf("expected action %s, got: %s", model.TxnRead, event.Action())
+		}
+		if event.InputSeq() != uint64(i+1) {
+			t.Fatalf("expected input-seq %d, got: %d", i+1, event.InputSeq())
+		}
+		if string(event.RawData()) != string(lines[i].Data) {
+			t.Fatalf("expected data %s, got: %s", lines[i].Data, event.RawData())
+		}
+	}
+
+	expectedReport := loadgen.Report{
+		Published:       4,
+		VirtualDuration: 6 * time.Minute,
+		Elapsed:         6 * time.Second,
+		Throughput:      4.0 / 6,
+	}
+	if *report != expectedReport {
+		t.Fatalf("expected report %+v, got: %+v", expectedReport, *report)
+	}
+}
+
+func TestReplayerReportsLagOfSlowConsumer(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := fakeClock.Now()
+	// Every line takes 2 seconds to be consumed,
+	// but lines are scheduled a second apart.
+	bus := &recordingBus{clock: fakeClock, delay: 2 * time.Second}
+	replayer := newReplayer(t, &loadgen.Cfg{
+		Bus:          bus,
+		Multiplier:   60,
+		Clock:        fakeClock,
+		LagTolerance: 1500 * time.Millisecond,
+	})
+
+	lines := linesAt(0, time.Minute, 2*time.Minute, 3*time.Minute)
+	report := replay(t, replayer, fakeClock, lines, 100*time.Millisecond)
+
+	// Lines are published as soon as previous
+	// line is consumed, falling further behind.
+	expected := []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second}
+	offsets := bus.offsets(start)
+	if fmt.Sprint(offsets) != fmt.Sprint(expected) {
+		t.Fatalf("expected lines published at %v, got: %v", expected, offsets)
+	}
+	expectedReport := loadgen.Report{
+		Published:       4,
+		VirtualDuration: 3 * time.Minute,
+		Elapsed:         8 * time.Second,
+		Throughput:      0.5,
+		MaxLag:          3 * time.Second,
+		LastLag:         3 * time.Second,
+		// Lines lagging by 2 and 3 seconds
+		LaggedLines: 2,
+	}
+	if *report != expectedReport {
+		t.Fatalf("expected report %+v, got: %+v", expectedReport, *report)
+	}
+}
+
+func TestReplayerWaitsWhileBacklogIsFull(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := fakeClock.Now()
+	bus := &recordingBus{clock: fakeClock}
+
+	// Backlog fills up once first line is
+	// published, and drains by one every poll.
+	backlog, filled := 0, false
+	replayer := newReplayer(t, &loadgen.Cfg{
+		Bus:        bus,
+		Multiplier: 60,
+		Clock:      fakeClock,
+		Backlog: func() int {
+			switch {
+			case !filled && len(bus.offsets(start)) == 1:
+				backlog, filled = 5, true
+			case backlog > 0:
+				backlog--
+			}
+			return backlog
+		},
+		MaxBacklog:          3,
+		BacklogPollInterval: 500 * time.Millisecond,
+	})
+
+	lines := linesAt(0, time.Minute, 2*time.Minute)
+	report := replay(t, replayer, fakeClock, lines, 100*time.Millisecond)
+
+	// Second line waits for backlog of 5, 4 and 3 to drain,
+	// so it's published 1.5 seconds late, and third line is
+	// published right after it.
+	expected := []time.Duration{0, 2500 * time.Millisecond, 2500 * time.Millisecond}
+	offsets := bus.offsets(start)
+	if fmt.Sprint(offsets) != fmt.Sprint(expected) {
+		t.Fatalf("expected lines published at %v, got: %v", expected, offsets)
+	}
+	if report.MaxBacklog != 5 {
+		t.Fatalf("expected max backlog 5, got: %d", report.MaxBacklog)
+	}
+	if report.MaxLag != 1500*time.Millisecond || report.LastLag != 500*time.Millisecond {
+		t.Fatalf("expected max lag 1.5s and last lag 0.5s, got: %+v", *report)
+	}
+}
+
+func TestReplayerStopsOnContextDone(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bus := &recordingBus{clock: fakeClock}
+	replayer := newReplayer(t, &loadgen.Cfg{
+		Bus:        bus,
+		Multiplier: 60,
+		Clock:      fakeClock,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := replayer.Replay(ctx, linesAt(0, time.Hour))
+		done <- err
+	}()
+	for fakeClock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error once context is done")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed-out waiting for replay to stop")
+	}
+	if offsets := bus.offsets(fakeClock.Now()); len(offsets) != 1 {
+		t.Fatalf("expected only first line published, got: %d", len(offsets))
+	}
+}
+
+func TestReplayerPublishesToPipelineBus(t *testing.T) {
+	bus := newBus(t)
+	sub, err := eventutil.SubscribeEvents(bus, model.TxnRead)
+	if err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+	replayer := newReplayer(t, &loadgen.Cfg{
+		Bus: bus,
+		// Real clock, with gaps of a few milliseconds
+		Multiplier: 60000,
+	})
+
+	lines := linesAt(0, time.Minute, 2*time.Minute)
+	report, err := replayer.Replay(context.Background(), lines)
+	if err != nil {
+		t.Fatalf("error replaying: %s", err)
+	}
+	if report.Published != len(lines) {
+		t.Fatalf("expected %d lines published, got: %d", len(lines), report.Published)
+	}
+	if report.Elapsed < 2*time.Millisecond {
+		t.Fatalf("expected replay to take at least 2ms, got: %s", report.Elapsed)
+	}
+	for i := range lines {
+		select {
+		case event := <-sub:
+			if string(event.RawData()) != string(lines[i].Data) {
+				t.Fatalf("expected data %s, got: %s", lines[i].Data, event.RawData())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed-out waiting for line #%d", i+1)
+		}
+	}
+}
+
+func TestBusBacklog(t *testing.T) {
+	bus := newBus(t)
+	if _, err := bus.Subscribe(model.TxnRead.String()); err != nil {
+		t.Fatalf("error subscribing: %s", err)
+	}
+	backlog := loadgen.BusBacklog(bus, model.TxnRead.String(), model.CreateTxn.String())
+	if n := backlog(); n != 0 {
+		t.Fatalf("expected no backlog, got: %d", n)
+	}
+
+	// Subscription-channels buffer 2 messages
+	for i := 0; i < 2; i++ {
+		event, err := model.NewEvent(&model.EventCfg{
+			AggregateID: "1",
+			Action:      model.TxnRead,
+			Data:        []byte(`{}`),
+		})
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		if err := bus.Publish(event); err != nil {
+			t.Fatalf("error publishing event: %s", err)
+		}
+	}
+	if n := backlog(); n != 2 {
+		t.Fatalf("expected backlog of 2, got: %d", n)
+	}
+}
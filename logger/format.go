@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Width of level and prefix columns in pretty-format.
+// Longer prefixes are not truncated.
+const (
+	levelColWidth  = 5
+	prefixColWidth = 26
+)
+
+const prettyTimeFmt = "15:04:05.000"
+
+const (
+	ansiReset = "\033[0m"
+	ansiDim   = "\033[2m"
+)
+
+// Colors assigned to prefixes. A prefix always gets same color.
+var prefixColors = []string{
+	"\033[36m", // Cyan
+	"\033[32m", // Green
+	"\033[35m", // Magenta
+	"\033[34m", // Blue
+	"\033[33m", // Yellow
+	"\033[96m", // Bright cyan
+	"\033[92m", // Bright green
+	"\033[95m", // Bright magenta
+	"\033[94m", // Bright blue
+}
+
+var levelColors = map[string]string{
+	"trace": ansiDim,
+	"debug": ansiDim,
+	"info":  "\033[1m",
+	"warn":  "\033[1;33m",
+	"error": "\033[1;31m",
+}
+
+// IsTerminal returns true if writer is a terminal (TTY).
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// isPrettyEnv returns true if pretty-format
+// is enabled using `LOG_PRETTY` env-var.
+func isPrettyEnv() bool {
+	switch strings.ToLower(os.Getenv("LOG_PRETTY")) {
+	case "1", "true":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseLogLevel returns logging-level for prefix, as
+// configured using `<PREFIX>_LOG_LEVEL` or `LOG_LEVEL`
+// env-vars. Default level is `info`.
+func parseLogLevel(prefix string) int {
+	logLevelStr := os.Getenv(strings.ToUpper(prefix) + "_LOG_LEVEL")
+	if logLevelStr == "" {
+		logLevelStr = os.Getenv("LOG_LEVEL")
+	}
+	logLevel, ok := logLevelMap[strings.ToLower(logLevelStr)]
+	if !ok {
+		logLevel = logLevelMap["info"]
+	}
+	return logLevel
+}
+
+// formatter filters log-levels and formats log-lines.
+// This is shared by loggers so they filter and
+// format logs consistently.
+type formatter struct {
+	prefix   string
+	logLevel int
+	// Formats lines as colored, aligned columns
+	// with timestamps, for reading on a terminal.
+	pretty bool
+}
+
+// enabled returns true if logs of level should be logged.
+func (f *formatter) enabled(level string) bool {
+	return logLevelMap[level] >= f.logLevel
+}
+
+// format formats log-line. Plain-format doesn't include
+// a timestamp, since it's expected to be added by writer.
+func (f *formatter) format(level string, t time.Time, s string, v ...interface{}) string {
+	msg := fmt.Sprintf(s, v...)
+	if !f.pretty {
+		return fmt.Sprintf(
+			"[%s]: [%s]: %s",
+			strings.ToUpper(level),
+			f.prefix,
+			msg,
+		)
+	}
+
+	return fmt.Sprintf(
+		"%s%s%s %s%-*s%s %s%-*s%s %s",
+		ansiDim, t.Format(prettyTimeFmt), ansiReset,
+		levelColors[level], levelColWidth, strings.ToUpper(level), ansiReset,
+		prefixColor(f.prefix), prefixColWidth, f.prefix, ansiReset,
+		msg,
+	)
+}
+
+func prefixColor(prefix string) string {
+	h := fnv.New32a()
+	// Writes to hash never error
+	_, _ = h.Write([]byte(prefix))
+	return prefixColors[h.Sum32()%uint32(len(prefixColors))]
+}
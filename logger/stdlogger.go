@@ -1,10 +1,10 @@
 package logger
 
 import (
-	"fmt"
+	"io"
 	"log"
 	"os"
-	"strings"
+	"time"
 )
 
 var logLevelMap = map[string]int{
@@ -23,10 +23,24 @@ var logLevelMap = map[string]int{
 // - warn
 // - error
 // A "prefix" can be specified to help identify logs from specific module.
-// Use #NewStdLogger to create new instance.
+// Use #NewStdLogger or #NewStdLoggerWithCfg to create new instance.
 type StdLogger struct {
-	prefix   string
-	logLevel int
+	formatter *formatter
+	logger    *log.Logger
+}
+
+// StdLoggerCfg is config for StdLogger.
+type StdLoggerCfg struct {
+	Prefix string
+	// Optional, defaults to os.Stderr.
+	Writer io.Writer
+	// Enables pretty-format, which logs colored and aligned
+	// columns with millisecond timestamps. Can also be enabled
+	// by setting env-var `LOG_PRETTY=1`.
+	// Plain-format is used if Writer is not a terminal.
+	Pretty bool
+	// Optional, defaults to #IsTerminal.
+	IsTerminal func(w io.Writer) bool
 }
 
 // NewStdLogger creates new instance of StdLogger.
@@ -35,32 +49,43 @@ type StdLogger struct {
 // Logging-level for an individual prefix can be
 // specified by setting env-var `<PREFIX>_LOG_LEVEL`.
 func NewStdLogger(prefix string) *StdLogger {
-	logLevelStr := os.Getenv(strings.ToUpper(prefix) + "_LOG_LEVEL")
-	if logLevelStr == "" {
-		logLevelStr = os.Getenv("LOG_LEVEL")
+	return NewStdLoggerWithCfg(StdLoggerCfg{
+		Prefix: prefix,
+	})
+}
+
+// NewStdLoggerWithCfg creates new instance of StdLogger
+// from provided config. Logging-levels are configured
+// same as #NewStdLogger.
+func NewStdLoggerWithCfg(cfg StdLoggerCfg) *StdLogger {
+	if cfg.Writer == nil {
+		cfg.Writer = os.Stderr
 	}
-	logLevel, ok := logLevelMap[strings.ToLower(logLevelStr)]
-	if !ok {
-		logLevel = logLevelMap["info"]
+	if cfg.IsTerminal == nil {
+		cfg.IsTerminal = IsTerminal
 	}
+	pretty := (cfg.Pretty || isPrettyEnv()) && cfg.IsTerminal(cfg.Writer)
 
+	flags := log.LstdFlags
+	if pretty {
+		// Pretty-format includes its own timestamp
+		flags = 0
+	}
 	return &StdLogger{
-		prefix:   prefix,
-		logLevel: logLevel,
+		formatter: &formatter{
+			prefix:   cfg.Prefix,
+			logLevel: parseLogLevel(cfg.Prefix),
+			pretty:   pretty,
+		},
+		logger: log.New(cfg.Writer, "", flags),
 	}
 }
 
 func (l *StdLogger) log(level string, s string, v ...interface{}) {
-	if logLevelMap[level] < l.logLevel {
+	if !l.formatter.enabled(level) {
 		return
 	}
-
-	log.Printf(
-		"[%s]: [%s]: %s",
-		strings.ToUpper(level),
-		l.prefix,
-		fmt.Sprintf(s, v...),
-	)
+	l.logger.Print(l.formatter.format(level, time.Now(), s, v...))
 }
 
 // Trace logs trace-level logs.
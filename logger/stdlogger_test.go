@@ -0,0 +1,185 @@
+package logger_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+var ansiRegex = regexp.MustCompile("\033\\[[0-9;]*m")
+
+func forceTerminal(isTerminal bool) func(io.Writer) bool {
+	return func(io.Writer) bool {
+		return isTerminal
+	}
+}
+
+// setEnv sets env-var for duration of test.
+func setEnv(t *testing.T, key string, value string) {
+	t.Helper()
+
+	prev, exists := os.LookupEnv(key)
+	err := os.Setenv(key, value)
+	if err != nil {
+		t.Fatalf("error setting env-var: %s", err)
+	}
+	t.Cleanup(func() {
+		if exists {
+			_ = os.Setenv(key, prev)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func logLines(buf *bytes.Buffer) []string {
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestStdLoggerFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		pretty     bool
+		prettyEnv  string
+		isTerminal bool
+		expectANSI bool
+	}{
+		{
+			name:       "logs plain-format by default",
+			isTerminal: true,
+		},
+		{
+			name:       "logs pretty-format when enabled on terminal",
+			pretty:     true,
+			isTerminal: true,
+			expectANSI: true,
+		},
+		{
+			name:       "logs pretty-format when enabled using env-var",
+			prettyEnv:  "1",
+			isTerminal: true,
+			expectANSI: true,
+		},
+		{
+			name:   "falls back to plain-format when writer is not a terminal",
+			pretty: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, "LOG_PRETTY", test.prettyEnv)
+			setEnv(t, "LOG_LEVEL", "info")
+
+			buf := &bytes.Buffer{}
+			log := logger.NewStdLoggerWithCfg(logger.StdLoggerCfg{
+				Prefix:     "Test",
+				Writer:     buf,
+				Pretty:     test.pretty,
+				IsTerminal: forceTerminal(test.isTerminal),
+			})
+			log.Infof("test %s", "message")
+
+			line := buf.String()
+			if ansiRegex.MatchString(line) != test.expectANSI {
+				t.Fatalf("expected ANSI-codes: %t, got line: %q", test.expectANSI, line)
+			}
+			if !test.expectANSI && !strings.Contains(line, "[INFO]: [Test]: test message") {
+				t.Fatalf("expected plain-format, got line: %q", line)
+			}
+		})
+	}
+}
+
+func TestStdLoggerPrettyColumns(t *testing.T) {
+	setEnv(t, "LOG_LEVEL", "trace")
+
+	buf := &bytes.Buffer{}
+	prefixes := []string{"A", "account/CmdListener", "EventBus"}
+	for _, prefix := range prefixes {
+		log := logger.NewStdLoggerWithCfg(logger.StdLoggerCfg{
+			Prefix:     prefix,
+			Writer:     buf,
+			Pretty:     true,
+			IsTerminal: forceTerminal(true),
+		})
+		log.Trace("message")
+		log.Error("message")
+	}
+
+	lines := logLines(buf)
+	if len(lines) != len(prefixes)*2 {
+		t.Fatalf("expected %d lines, got %d", len(prefixes)*2, len(lines))
+	}
+	timeRegex := regexp.MustCompile(`^\d{2}:\d{2}:\d{2}\.\d{3} `)
+
+	msgCol := -1
+	for _, line := range lines {
+		plain := ansiRegex.ReplaceAllString(line, "")
+		if !timeRegex.MatchString(plain) {
+			t.Fatalf("expected millisecond timestamp, got line: %q", plain)
+		}
+		col := strings.LastIndex(plain, "message")
+		if msgCol == -1 {
+			msgCol = col
+		}
+		if col != msgCol {
+			t.Fatalf("expected message at column %d, got line: %q", msgCol, plain)
+		}
+	}
+}
+
+func TestStdLoggerLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		pretty      bool
+		logLevel    string
+		expectLines int
+	}{
+		{
+			name:        "filters levels below configured level in plain-format",
+			logLevel:    "warn",
+			expectLines: 2,
+		},
+		{
+			name:        "filters levels below configured level in pretty-format",
+			pretty:      true,
+			logLevel:    "warn",
+			expectLines: 2,
+		},
+		{
+			name:        "defaults to info level",
+			logLevel:    "invalid",
+			expectLines: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, "LOG_LEVEL", test.logLevel)
+
+			buf := &bytes.Buffer{}
+			log := logger.NewStdLoggerWithCfg(logger.StdLoggerCfg{
+				Prefix:     "Test",
+				Writer:     buf,
+				Pretty:     test.pretty,
+				IsTerminal: forceTerminal(true),
+			})
+			log.Trace("message")
+			log.Debug("message")
+			log.Info("message")
+			log.Warn("message")
+			log.Error("message")
+
+			lines := logLines(buf)
+			if len(lines) != test.expectLines {
+				t.Fatalf("expected %d lines, got: %q", test.expectLines, lines)
+			}
+		})
+	}
+}
@@ -1,94 +1,218 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/Jaskaranbir/es-bank-account/api"
 	globalcfg "github.com/Jaskaranbir/es-bank-account/config"
-	"github.com/Jaskaranbir/es-bank-account/eventutil"
-	"github.com/Jaskaranbir/es-bank-account/logger"
-	"github.com/Jaskaranbir/es-bank-account/model"
-
-	"github.com/Jaskaranbir/es-bank-account/domain"
-	"github.com/Jaskaranbir/es-bank-account/domain/account"
-	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
-	"github.com/Jaskaranbir/es-bank-account/domain/reader"
-	"github.com/Jaskaranbir/es-bank-account/domain/txn"
-	"github.com/Jaskaranbir/es-bank-account/domain/writer"
 )
 
+// Exit-codes for runs flagged as empty, so schedulers
+// can tell these apart from other failures (exit-code 1).
+const (
+	exitCodeEmptyInput    = 3
+	exitCodeZeroValidTxns = 4
+)
+
+// Env-var setting path of file to write
+// tracing-spans to. Tracing is disabled
+// if not set.
+const traceFilePathEnv = "TRACE_FILE_PATH"
+
+// Exit-code for "validate" subcommand
+// if input has invalid records.
+const exitCodeInvalidRecords = 5
+
 func main() {
-	bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
-	if err != nil {
-		err = errors.Wrap(err, "error creating memory-bus")
-		log.Fatalln(err)
+	// Usage: "validate [input-file]", validates input
+	// without running the pipeline. Input-file defaults
+	// to one in config.
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validateInput(os.Args[2:]))
 	}
-
-	// ================== Account ==================
-	accountCfg, err := accountRunCfg(bus)
-	if err != nil {
-		err = errors.Wrap(err, "error creating account-config")
-		log.Fatalln(err)
+	// Usage: "migrate [src-file] [dst-file]", migrates stored
+	// events to current schema-versions without running the
+	// pipeline. Files default to ones in config.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrateEvents(os.Args[2:]))
 	}
 
-	// ================== TxnResultView ==================
-	accountViewCfg := accountViewRunCfg(bus, accountCfg.AccountCfg.EventRepo)
-
-	// ================== TxnCreator ==================
-	txnCreatorCfg, err := txnCreatorRunCfg(bus)
+	// ================== Metrics ==================
+	metricsCtx, metricsCancel := context.WithCancel(context.Background())
+	defer metricsCancel()
+	// Queries are served along with metrics,
+	// and registered as their sources are created.
+	queryMux := http.NewServeMux()
+	appMetrics, err := api.ServeMetrics(metricsCtx, globalcfg.MetricsAddr, queryMux)
 	if err != nil {
-		err = errors.Wrap(err, "error creating transaction-creator config")
+		err = errors.Wrap(err, "error running metrics")
 		log.Fatalln(err)
 	}
 
-	// ================== Process-Manager ==================
-	processMgrCfg := processMgrRunCfg(bus, accountViewCfg.ResultViewCfg.ResultRepo)
-
-	// ================== Reader ==================
+	// ================== Input/Output ==================
 	inputFile, err := os.Open(globalcfg.InputFilePath)
 	if err != nil {
 		err = errors.Wrap(err, "error opening input-file")
 		log.Fatalln(err)
 	}
 	defer inputFile.Close()
-	readerCfg := &reader.Cfg{
-		Log:      logger.NewStdLogger("reader"),
-		Bus:      bus,
-		Reader:   inputFile,
-		DataRead: model.TxnRead,
-	}
-
-	// ================== Writer ==================
 	outputFile, err := os.Create(globalcfg.OutputFilePath)
 	if err != nil {
 		err = errors.Wrap(err, "error creating output-file")
 		log.Fatalln(err)
 	}
 	defer outputFile.Close()
-	writerCfg, err := writerRunCfg(bus, outputFile)
+
+	shardOutputs := make([]io.Writer, 0, globalcfg.OutputShards)
+	for shard := 0; shard < globalcfg.OutputShards; shard++ {
+		shardFile, err := os.Create(fmt.Sprintf(globalcfg.OutputShardFilePathFmt, shard))
+		if err != nil {
+			err = errors.Wrapf(err, "error creating file of output-shard %d", shard)
+			log.Fatalln(err)
+		}
+		defer shardFile.Close()
+		shardOutputs = append(shardOutputs, shardFile)
+	}
+
+	// ================== Tracing ==================
+	var tracer api.Tracer
+	closeTrace := func() error { return nil }
+	if tracePath := os.Getenv(traceFilePathEnv); tracePath != "" {
+		tracer, closeTrace, err = api.NewFileTracer(tracePath)
+		if err != nil {
+			err = errors.Wrap(err, "error creating tracer")
+			log.Fatalln(err)
+		}
+	}
+
+	// ================== Recovery ==================
+	var recoveryInput io.Reader
+	var recoveryOutput *bytes.Buffer
+	if globalcfg.RecoveryFilePath != "" {
+		recoveryInput, err = readRecoveryFile()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		// Recovery-file is only replaced once run ends, so its
+		// messages aren't lost if run exits before draining bus.
+		recoveryOutput = &bytes.Buffer{}
+	}
+
+	// ================== Ingestion-Profile ==================
+	var ingestionProfile *api.Profile
+	if globalcfg.IngestionProfile != "" {
+		ingestionProfile, err = api.LoadNamedProfile(globalcfg.IngestionProfilesDir, globalcfg.IngestionProfile)
+		if err != nil {
+			err = errors.Wrap(err, "error loading ingestion-profile")
+			log.Fatalln(err)
+		}
+	}
+
+	// ================== Pipeline ==================
+	pipelineCfg := &api.PipelineCfg{
+		Input:         inputFile,
+		Output:        outputFile,
+		ShardOutputs:  shardOutputs,
+		Metrics:       appMetrics,
+		Tracer:        tracer,
+		Queries:       queryMux,
+		RecoveryInput: recoveryInput,
+		Profile:       ingestionProfile,
+	}
+	// Only set if enabled, since a nil *bytes.Buffer
+	// would be a non-nil io.Writer.
+	if recoveryOutput != nil {
+		pipelineCfg.RecoveryOutput = recoveryOutput
+	}
+	pipeline, err := api.NewPipeline(pipelineCfg)
 	if err != nil {
-		err = errors.Wrap(err, "error creating writer-config")
+		err = errors.Wrap(err, "error creating pipeline")
 		log.Fatalln(err)
 	}
 
+	if globalcfg.OpeningBalancesFilePath != "" {
+		err = seedOpeningBalances(pipeline)
+		if err != nil {
+			err = errors.Wrap(err, "error seeding opening-balances")
+			log.Fatalln(err)
+		}
+	}
+
 	// ================== Runner ==================
-	err = domain.RunRoutines(&domain.RoutinesCfg{
-		Log:            logger.NewStdLogger("runner"),
-		ReaderCfg:      readerCfg,
-		TxnCreatorCfg:  txnCreatorCfg,
-		AccountCfg:     accountCfg,
-		AccountViewCfg: accountViewCfg,
-		ProcessMgrCfg:  processMgrCfg,
-		WriterCfg:      writerCfg,
-	})
+	summary, err := pipeline.Run()
+	if recoveryOutput != nil {
+		recoveryErr := writeRecoveryFile(recoveryOutput.Bytes())
+		if recoveryErr != nil {
+			log.Printf("Error writing recovery-file: %s", recoveryErr)
+		}
+	}
+	// Spans are ended once routines return
+	traceErr := closeTrace()
+	if traceErr != nil {
+		log.Printf("Error writing trace: %s", traceErr)
+	}
+	if summary != nil && summary.Partial {
+		log.Printf("Input was read partially (%d line(s)), report is incomplete", summary.LinesRead)
+	}
+	if summary != nil && summary.QuarantinedEvents > 0 {
+		log.Printf("Quarantined %d event(s), report is missing their results", summary.QuarantinedEvents)
+	}
+	if summary != nil && summary.RejectionAnomalies > 0 {
+		log.Printf("Detected %d rejection-rate anomaly(s)", summary.RejectionAnomalies)
+	}
+	if summary != nil && len(summary.UnsafeCustomerIDs) > 0 {
+		log.Printf(
+			"Skipped per-customer output of %d customer(s) with unsafe IDs: %q",
+			len(summary.UnsafeCustomerIDs), summary.UnsafeCustomerIDs,
+		)
+	}
+	if summary != nil && summary.Stragglers > 0 {
+		log.Printf("Read %d line(s) of customers after their group ended", summary.Stragglers)
+	}
+	if summary != nil && len(summary.Deprecations) > 0 {
+		log.Printf("Used deprecated features: %v", summary.Deprecations)
+	}
+	if summary != nil && len(summary.Warnings) > 0 {
+		log.Printf("Warnings during run:\n%s", summary.Warnings)
+	}
+	var emptyRunErr *api.EmptyRunError
+	if errors.As(err, &emptyRunErr) {
+		// Report is still written, so files are
+		// closed before exiting with mapped code.
+		inputFile.Close()
+		outputFile.Close()
+		log.Println(emptyRunErr)
+		os.Exit(emptyRunExitCode(emptyRunErr))
+	}
+	var runErr *api.RunError
+	if errors.As(err, &runErr) && runErr.RootCause != nil {
+		log.Printf("Root cause: %s", runErr.RootCause)
+	}
 	if err != nil {
 		err = errors.Wrap(err, "error running domain-routines")
 		log.Fatalln(err)
 	}
+	if globalcfg.LogEventStoreStats {
+		logEventStoreStats(pipeline)
+	}
+	if globalcfg.BalanceDriftCheck {
+		err = checkBalanceDrift(pipeline)
+		if err != nil {
+			err = errors.Wrap(err, "error checking balance-drift")
+			log.Fatalln(err)
+		}
+	}
 
 	err = inputFile.Close()
 	if err != nil {
@@ -102,140 +226,211 @@ func main() {
 	}
 }
 
-func accountRunCfg(bus eventutil.Bus) (*account.CmdListenerCfg, error) {
-	accountEventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
-		Bus:            bus,
-		EventStore:     eventutil.NewMemoryEventStore(),
-		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
+// emptyRunExitCode maps EmptyRunError to exit-code.
+func emptyRunExitCode(err *api.EmptyRunError) int {
+	if err.Reason == api.EmptyInput {
+		return exitCodeEmptyInput
+	}
+	return exitCodeZeroValidTxns
+}
+
+// validateInput logs ValidationReport of input-file, and
+// returns exit-code reflecting whether input is valid.
+func validateInput(args []string) int {
+	inputFilePath := globalcfg.InputFilePath
+	if len(args) > 0 {
+		inputFilePath = args[0]
+	}
+	inputFile, err := os.Open(inputFilePath)
+	if err != nil {
+		log.Println(errors.Wrap(err, "error opening input-file"))
+		return 1
+	}
+	defer inputFile.Close()
+
+	report, err := api.ValidateInput(inputFile, api.ValidateCfg{
+		DefaultTimeFmt:      globalcfg.TxnRequestTimeFmt,
+		MaxAmountDecimals:   globalcfg.MaxAmountDecimals,
+		StrictTimeRoundTrip: globalcfg.StrictTimeRoundTrip,
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating event-repo for account")
+		log.Println(errors.Wrap(err, "error validating input"))
+		return 1
 	}
 
-	return &account.CmdListenerCfg{
-		Log: logger.NewStdLogger("account/CmdListener"),
+	log.Printf(
+		"Valid records: %d, invalid records: %d, customers: %d",
+		report.ValidRecords, report.InvalidRecords, report.DistinctCustomers,
+	)
+	if report.ValidRecords > 0 {
+		log.Printf(
+			"Transactions from %s to %s",
+			report.FirstTxnTime.Format(globalcfg.TxnRequestTimeFmt),
+			report.LastTxnTime.Format(globalcfg.TxnRequestTimeFmt),
+		)
+	}
+	codes := make([]api.FailureCode, 0, len(report.FailureCodes))
+	for code := range report.FailureCodes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i] < codes[j]
+	})
+	for _, code := range codes {
+		log.Printf("Failure %s: %d record(s)", code, report.FailureCodes[code])
+	}
+	for _, line := range report.OffendingLines {
+		log.Printf("Line %d: [%s]: %s: %s", line.LineNum, line.Code, line.Error, line.Line)
+	}
+	if report.HasInvalid() {
+		return exitCodeInvalidRecords
+	}
+	return 0
+}
 
-		Bus:           bus,
-		ProcessTxnCmd: model.ProcessTxn,
+// migrateEvents migrates events of NDJSON src-file, and
+// writes these to dst-file, returning the exit-code.
+func migrateEvents(args []string) int {
+	srcFilePath := globalcfg.MigrationSrcFilePath
+	dstFilePath := globalcfg.MigrationDstFilePath
+	if len(args) > 0 {
+		srcFilePath = args[0]
+	}
+	if len(args) > 1 {
+		dstFilePath = args[1]
+	}
 
-		AccountCfg: &account.AggregateCfg{
-			Log:       logger.NewStdLogger("account/Aggregate"),
-			EventRepo: accountEventRepo,
+	srcFile, err := os.Open(srcFilePath)
+	if err != nil {
+		log.Println(errors.Wrap(err, "error opening source event-file"))
+		return 1
+	}
+	defer srcFile.Close()
+	src := api.NewMemoryEventStore()
+	err = api.ImportEvents(src, srcFile)
+	if err != nil {
+		log.Println(errors.Wrap(err, "error reading source events"))
+		return 1
+	}
 
-			DailyTxnsAmountLimit:  globalcfg.DailyTxnsAmountLimit,
-			NumDailyTxnsLimit:     globalcfg.NumDailyTxnsLimit,
-			WeeklyTxnsAmountLimit: globalcfg.WeeklyTxnsAmountLimit,
-			NumWeeklyTxnsLimit:    globalcfg.NumWeeklyTxnsLimit,
+	dst := api.NewMemoryEventStore()
+	report, err := api.MigrateAccountEvents(src, dst, globalcfg.MigrationErrorBudget)
+	if report != nil {
+		log.Printf(
+			"Migrated events: %d, unchanged: %d, failed: %d",
+			report.Migrated, report.Unchanged, report.Failed,
+		)
+		for _, failure := range report.Failures {
+			log.Printf("Event %s: %s", failure.EventID, failure.Err)
+		}
+	}
+	if err != nil {
+		log.Println(errors.Wrap(err, "error migrating events"))
+		return 1
+	}
 
-			AccountDeposited:     model.AccountDeposited,
-			AccountWithdrawn:     model.AccountWithdrawn,
-			DuplicateTxn:         model.DuplicateTxn,
-			AccountLimitExceeded: model.AccountLimitExceeded,
-		},
-	}, nil
+	dstFile, err := os.Create(dstFilePath)
+	if err != nil {
+		log.Println(errors.Wrap(err, "error creating destination event-file"))
+		return 1
+	}
+	defer dstFile.Close()
+	err = api.ExportEvents(dst, dstFile)
+	if err != nil {
+		log.Println(errors.Wrap(err, "error writing destination events"))
+		return 1
+	}
+	return 0
 }
 
-func accountViewRunCfg(
-	bus eventutil.Bus,
-	accountEventRepo eventutil.EventRepo,
-) *accountview.EventListenerCfg {
-	txnResultViewRepo := accountview.NewMemoryTxnResultViewRepo()
-
-	return &accountview.EventListenerCfg{
-		Log: logger.NewStdLogger("accountView/EventListener"),
-
-		Bus:                  bus,
-		AccountDeposited:     model.AccountDeposited,
-		AccountWithdrawn:     model.AccountWithdrawn,
-		DuplicateTxn:         model.DuplicateTxn,
-		AccountLimitExceeded: model.AccountLimitExceeded,
-
-		ResultViewCfg: &accountview.TxnResultViewCfg{
-			Log:        logger.NewStdLogger("accountView/TxnResultView"),
-			ResultRepo: txnResultViewRepo,
-			// To fetch events from Account-aggregate
-			EventRepo: accountEventRepo,
-
-			AccountDeposited:     model.AccountDeposited,
-			AccountWithdrawn:     model.AccountWithdrawn,
-			DuplicateTxn:         model.DuplicateTxn,
-			AccountLimitExceeded: model.AccountLimitExceeded,
-		},
+// readRecoveryFile returns messages left unprocessed by
+// previous run from recovery-file, or nil if it doesn't exist.
+func readRecoveryFile() (io.Reader, error) {
+	data, err := ioutil.ReadFile(globalcfg.RecoveryFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading recovery-file")
 	}
+	log.Printf("Recovering unprocessed messages from: %s", globalcfg.RecoveryFilePath)
+	return bytes.NewReader(data), nil
 }
 
-func txnCreatorRunCfg(bus eventutil.Bus) (*txn.CmdListenerCfg, error) {
-	txnCreatorEventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
-		Bus:            bus,
-		EventStore:     eventutil.NewMemoryEventStore(),
-		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
-	})
+// writeRecoveryFile replaces recovery-file with data, or
+// removes it if run left no messages unprocessed.
+func writeRecoveryFile(data []byte) error {
+	if len(data) == 0 {
+		err := os.Remove(globalcfg.RecoveryFilePath)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error removing recovery-file")
+	}
+	err := ioutil.WriteFile(globalcfg.RecoveryFilePath, data, 0644)
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating event-repo for transaction-creator")
+		return errors.Wrap(err, "error writing recovery-file")
 	}
-
-	return &txn.CmdListenerCfg{
-		Log: logger.NewStdLogger("txn/CmdListener"),
-
-		Bus:          bus,
-		CreateTxnCmd: model.CreateTxn,
-
-		CreatorCfg: &txn.CreatorCfg{
-			Log:            logger.NewStdLogger("txn/Aggregate"),
-			EventRepo:      txnCreatorEventRepo,
-			DefaultTimeFmt: globalcfg.TxnRequestTimeFmt,
-
-			TxnCreated:      model.TxnCreated,
-			TxnCreateFailed: model.TxnCreateFailed,
-		},
-	}, nil
+	log.Printf("Wrote unprocessed messages to: %s", globalcfg.RecoveryFilePath)
+	return nil
 }
 
-func processMgrRunCfg(
-	bus eventutil.Bus,
-	txnResultViewRepo accountview.TxnResultViewRepo,
-) *domain.ProcessMgrCfg {
-	return &domain.ProcessMgrCfg{
-		Log:               logger.NewStdLogger("ProcessMgr"),
-		Bus:               bus,
-		TxnResultViewRepo: txnResultViewRepo,
-
-		WriteData:  model.WriteData,
-		CreateTxn:  model.CreateTxn,
-		ProcessTxn: model.ProcessTxn,
-
-		TxnRead:         model.TxnRead,
-		TxnCreated:      model.TxnCreated,
-		TxnCreateFailed: model.TxnCreateFailed,
-		ReportWritten:   model.DataWritten,
+// seedOpeningBalances seeds accounts of pipeline
+// with opening-balances from file in config.
+func seedOpeningBalances(pipeline *api.Pipeline) error {
+	seedFile, err := os.Open(globalcfg.OpeningBalancesFilePath)
+	if err != nil {
+		return errors.Wrap(err, "error opening opening-balances file")
+	}
+	defer seedFile.Close()
 
-		IdleTimeoutSec:               globalcfg.ProcessMgrIdleTimeoutSec,
-		ReportWrittenEventTimeoutSec: 2,
+	balances, err := api.ReadOpeningBalancesCSV(seedFile, globalcfg.TxnRequestTimeFmt)
+	if err != nil {
+		return errors.Wrap(err, "error reading opening-balances")
 	}
+	err = pipeline.SeedOpeningBalances(balances)
+	if err != nil {
+		return errors.Wrap(err, "error seeding accounts")
+	}
+	log.Printf("Seeded opening-balances of %d account(s)", len(balances))
+	return nil
 }
 
-func writerRunCfg(bus eventutil.Bus, w io.Writer) (*writer.CmdListenerCfg, error) {
-	writerEventRepo, err := eventutil.NewLoggedEventRepo(&eventutil.LoggedEventRepoCfg{
-		Bus:            bus,
-		EventStore:     eventutil.NewMemoryEventStore(),
-		UnpublishedLog: eventutil.NewMemoryUnpublishedLog(),
-	})
+// checkBalanceDrift logs customers whose balance, replayed
+// from account's events, differs from published balance.
+func checkBalanceDrift(pipeline *api.Pipeline) error {
+	drifts, err := pipeline.CheckBalanceDrift()
 	if err != nil {
-		return nil, errors.Wrap(err, "error creating event-repo for writer")
+		return err
 	}
+	for _, drift := range drifts {
+		log.Printf(
+			"Balance-drift for customer %s: published %.2f, replayed %.2f (since transaction %s)",
+			drift.CustID, drift.PublishedBalance, drift.ReplayedBalance, drift.FirstDriftTxnID,
+		)
+	}
+	if len(drifts) == 0 {
+		log.Println("No balance-drift detected")
+	}
+	return nil
+}
 
-	return &writer.CmdListenerCfg{
-		Log: logger.NewStdLogger("writer/CmdListener"),
-
-		Bus:       bus,
-		WriteData: model.WriteData,
-
-		WriterCfg: &writer.AggregateCfg{
-			Log:    logger.NewStdLogger("writer/Aggregate"),
-			Writer: bufio.NewWriter(w),
-
-			EventRepo:   writerEventRepo,
-			DataWritten: model.DataWritten,
-		},
-	}, nil
+// logEventStoreStats logs size of account's event-store,
+// if it provides it.
+func logEventStoreStats(pipeline *api.Pipeline) {
+	stats, ok := pipeline.StoreStats(globalcfg.StoreStatsTopN)
+	if !ok {
+		log.Println("Event-repo doesn't provide event-store stats")
+		return
+	}
+	log.Printf(
+		"Event-store: %d event(s) across %d aggregate(s), ~%d byte(s)",
+		stats.Events, stats.Aggregates, stats.Bytes,
+	)
+	for _, aggStats := range stats.TopAggregates {
+		log.Printf(
+			"Event-store: aggregate %s has %d event(s), last at %s",
+			aggStats.AggregateID, aggStats.Events, aggStats.LastEventTime.Format(time.RFC3339),
+		)
+	}
 }
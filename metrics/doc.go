@@ -0,0 +1,3 @@
+// Package metrics provides instrumentation of
+// application-flow, with a Prometheus implementation.
+package metrics
@@ -0,0 +1,66 @@
+package metrics
+
+import "time"
+
+// Results of processed transactions.
+const (
+	ResultAccepted = "accepted"
+	ResultDeclined = "declined"
+	ResultSkipped  = "skipped"
+)
+
+// Metrics records measurements at instrumented
+// points of application-flow.
+type Metrics interface {
+	// IncLinesRead counts lines read from input.
+	IncLinesRead()
+	// IncMsgsPublished counts messages published on bus.
+	IncMsgsPublished(action string)
+	// IncTypeMismatches counts messages of unexpected type
+	// skipped by typed subscriptions to action on bus.
+	IncTypeMismatches(action string)
+	// IncTxnResults counts transaction-results
+	// (ResultAccepted, ResultDeclined or ResultSkipped).
+	IncTxnResults(result string)
+	// ObserveTxnProcessing records time taken by
+	// account to process a transaction.
+	ObserveTxnProcessing(duration time.Duration)
+	// ObserveViewHydration records time taken
+	// to hydrate transaction-result view.
+	ObserveViewHydration(duration time.Duration)
+	// SetStoreStats sets source of event-store size (number
+	// of events and aggregates), which is read on demand.
+	SetStoreStats(stats func() (events int, aggregates int))
+}
+
+// Noop is Metrics which discards all measurements.
+type Noop struct{}
+
+// IncLinesRead does nothing.
+func (Noop) IncLinesRead() {}
+
+// IncMsgsPublished does nothing.
+func (Noop) IncMsgsPublished(string) {}
+
+// IncTypeMismatches does nothing.
+func (Noop) IncTypeMismatches(string) {}
+
+// IncTxnResults does nothing.
+func (Noop) IncTxnResults(string) {}
+
+// ObserveTxnProcessing does nothing.
+func (Noop) ObserveTxnProcessing(time.Duration) {}
+
+// ObserveViewHydration does nothing.
+func (Noop) ObserveViewHydration(time.Duration) {}
+
+// SetStoreStats does nothing.
+func (Noop) SetStoreStats(func() (int, int)) {}
+
+// OrNoop returns provided Metrics, or Noop if nil.
+func OrNoop(m Metrics) Metrics {
+	if m == nil {
+		return Noop{}
+	}
+	return m
+}
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultNamespace prefixes names of Prometheus metrics.
+const DefaultNamespace = "es_bank_account"
+
+// Prometheus is Metrics exposed for Prometheus-scraping.
+// Use #NewPrometheus to create new instance.
+type Prometheus struct {
+	registry *prometheus.Registry
+
+	linesRead      prometheus.Counter
+	msgsPublished  *prometheus.CounterVec
+	typeMismatches *prometheus.CounterVec
+	txnResults     *prometheus.CounterVec
+	txnProcessing  prometheus.Histogram
+	viewHydrations prometheus.Histogram
+
+	storeStatsLock *sync.RWMutex
+	// Read by gauges of event-store size on every scrape
+	storeStats func() (events int, aggregates int)
+}
+
+// PrometheusCfg is config for Prometheus.
+type PrometheusCfg struct {
+	// Optional, defaults to DefaultNamespace.
+	Namespace string
+}
+
+// NewPrometheus creates new instance of Prometheus,
+// with metrics registered on a dedicated registry.
+func NewPrometheus(cfg *PrometheusCfg) (*Prometheus, error) {
+	if cfg == nil {
+		return nil, errors.New("config is nil")
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	p := &Prometheus{
+		registry:       prometheus.NewRegistry(),
+		storeStatsLock: &sync.RWMutex{},
+
+		linesRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lines_read_total",
+			Help:      "Number of lines read from input.",
+		}),
+		msgsPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bus_messages_published_total",
+			Help:      "Number of messages published on bus, by action.",
+		}, []string{"action"}),
+		typeMismatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bus_type_mismatches_total",
+			Help:      "Number of messages of unexpected type skipped by typed subscriptions, by action.",
+		}, []string{"action"}),
+		txnResults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "txn_results_total",
+			Help:      "Number of transaction-results, by result.",
+		}, []string{"result"}),
+		txnProcessing: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "txn_processing_seconds",
+			Help:      "Time taken by account to process a transaction.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		viewHydrations: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "view_hydration_seconds",
+			Help:      "Time taken to hydrate transaction-result view.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+
+	storeEvents := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_events",
+		Help:      "Number of events in event-store.",
+	}, func() float64 {
+		events, _ := p.readStoreStats()
+		return float64(events)
+	})
+	storeAggregates := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_aggregates",
+		Help:      "Number of aggregates in event-store.",
+	}, func() float64 {
+		_, aggregates := p.readStoreStats()
+		return float64(aggregates)
+	})
+
+	collectors := []prometheus.Collector{
+		p.linesRead,
+		p.msgsPublished,
+		p.typeMismatches,
+		p.txnResults,
+		p.txnProcessing,
+		p.viewHydrations,
+		storeEvents,
+		storeAggregates,
+	}
+	for _, collector := range collectors {
+		err := p.registry.Register(collector)
+		if err != nil {
+			return nil, errors.Wrap(err, "error registering metric")
+		}
+	}
+	return p, nil
+}
+
+// Handler returns http.Handler serving
+// metrics in Prometheus exposition-format.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+// IncLinesRead counts lines read from input.
+func (p *Prometheus) IncLinesRead() {
+	p.linesRead.Inc()
+}
+
+// IncMsgsPublished counts messages published on bus.
+func (p *Prometheus) IncMsgsPublished(action string) {
+	p.msgsPublished.WithLabelValues(action).Inc()
+}
+
+// IncTypeMismatches counts messages of unexpected
+// type skipped by typed subscriptions.
+func (p *Prometheus) IncTypeMismatches(action string) {
+	p.typeMismatches.WithLabelValues(action).Inc()
+}
+
+// IncTxnResults counts transaction-results.
+func (p *Prometheus) IncTxnResults(result string) {
+	p.txnResults.WithLabelValues(result).Inc()
+}
+
+// ObserveTxnProcessing records time taken by
+// account to process a transaction.
+func (p *Prometheus) ObserveTxnProcessing(duration time.Duration) {
+	p.txnProcessing.Observe(duration.Seconds())
+}
+
+// ObserveViewHydration records time taken
+// to hydrate transaction-result view.
+func (p *Prometheus) ObserveViewHydration(duration time.Duration) {
+	p.viewHydrations.Observe(duration.Seconds())
+}
+
+// SetStoreStats sets source of event-store size,
+// which is read on every scrape. Gauges are zero
+// until source is set.
+func (p *Prometheus) SetStoreStats(stats func() (events int, aggregates int)) {
+	p.storeStatsLock.Lock()
+	defer p.storeStatsLock.Unlock()
+
+	p.storeStats = stats
+}
+
+func (p *Prometheus) readStoreStats() (int, int) {
+	p.storeStatsLock.RLock()
+	stats := p.storeStats
+	p.storeStatsLock.RUnlock()
+
+	if stats == nil {
+		return 0, 0
+	}
+	return stats()
+}
@@ -0,0 +1,138 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/metrics"
+)
+
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("error scraping metrics: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got: %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading response: %s", err)
+	}
+	return string(body)
+}
+
+func TestPrometheusServe(t *testing.T) {
+	promMetrics, err := metrics.NewPrometheus(&metrics.PrometheusCfg{})
+	if err != nil {
+		t.Fatalf("error creating metrics: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, err := metrics.Serve(ctx, &metrics.ServerCfg{
+		Log:     logger.NewStdLogger("metrics"),
+		Addr:    "127.0.0.1:0",
+		Handler: promMetrics.Handler(),
+	})
+	if err != nil {
+		t.Fatalf("error serving metrics: %s", err)
+	}
+
+	promMetrics.IncLinesRead()
+	promMetrics.IncLinesRead()
+	promMetrics.IncMsgsPublished("TxnRead")
+	promMetrics.IncTypeMismatches("TxnRead")
+	promMetrics.IncTxnResults(metrics.ResultAccepted)
+	promMetrics.IncTxnResults(metrics.ResultDeclined)
+	promMetrics.ObserveTxnProcessing(10 * time.Millisecond)
+	promMetrics.ObserveViewHydration(time.Millisecond)
+	promMetrics.SetStoreStats(func() (int, int) {
+		return 15, 4
+	})
+
+	body := scrape(t, fmt.Sprintf("http://%s%s", addr, metrics.MetricsPath))
+	expected := []string{
+		"es_bank_account_lines_read_total 2",
+		`es_bank_account_bus_messages_published_total{action="TxnRead"} 1`,
+		`es_bank_account_bus_type_mismatches_total{action="TxnRead"} 1`,
+		`es_bank_account_txn_results_total{result="accepted"} 1`,
+		`es_bank_account_txn_results_total{result="declined"} 1`,
+		"es_bank_account_txn_processing_seconds_count 1",
+		"es_bank_account_view_hydration_seconds_count 1",
+		"es_bank_account_store_events 15",
+		"es_bank_account_store_aggregates 4",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected metrics to contain '%s', got:\n%s", line, body)
+		}
+	}
+}
+
+func TestPrometheusNamespace(t *testing.T) {
+	promMetrics, err := metrics.NewPrometheus(&metrics.PrometheusCfg{
+		Namespace: "custom",
+	})
+	if err != nil {
+		t.Fatalf("error creating metrics: %s", err)
+	}
+	promMetrics.IncLinesRead()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, err := metrics.Serve(ctx, &metrics.ServerCfg{
+		Log:     logger.NewStdLogger("metrics"),
+		Addr:    "127.0.0.1:0",
+		Handler: promMetrics.Handler(),
+	})
+	if err != nil {
+		t.Fatalf("error serving metrics: %s", err)
+	}
+
+	body := scrape(t, fmt.Sprintf("http://%s%s", addr, metrics.MetricsPath))
+	if !strings.Contains(body, "custom_lines_read_total 1") {
+		t.Errorf("expected namespaced metric, got:\n%s", body)
+	}
+}
+
+func TestServeStopsOnContextDone(t *testing.T) {
+	promMetrics, err := metrics.NewPrometheus(&metrics.PrometheusCfg{})
+	if err != nil {
+		t.Fatalf("error creating metrics: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, err := metrics.Serve(ctx, &metrics.ServerCfg{
+		Log:     logger.NewStdLogger("metrics"),
+		Addr:    "127.0.0.1:0",
+		Handler: promMetrics.Handler(),
+	})
+	if err != nil {
+		t.Fatalf("error serving metrics: %s", err)
+	}
+	cancel()
+
+	url := fmt.Sprintf("http://%s%s", addr, metrics.MetricsPath)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("expected server to stop after context is done")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/logger"
+)
+
+// MetricsPath is path metrics are served on.
+const MetricsPath = "/metrics"
+
+// shutdownTimeout bounds waiting for
+// in-flight scrapes on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// ServerCfg is config for Serve.
+type ServerCfg struct {
+	Log logger.Logger `validate:"nonnil"`
+	// Use port 0 to listen on any free port.
+	Addr    string       `validate:"nonzero"`
+	Handler http.Handler `validate:"nonnil"`
+	// Optional, additional handlers (such as queries)
+	// served on same address, keyed by path-pattern.
+	Routes map[string]http.Handler
+}
+
+// Serve serves metrics from handler on MetricsPath in
+// background, until context is done. Listener is created
+// before Serve returns, so address is ready for scraping.
+// Errors after Serve returns are logged, since metrics
+// being unavailable shouldn't affect application-flow.
+func Serve(ctx context.Context, cfg *ServerCfg) (net.Addr, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+	if ctx == nil {
+		return nil, errors.New("context is nil")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, cfg.Handler)
+	for pattern, handler := range cfg.Routes {
+		if pattern == MetricsPath {
+			return nil, errors.Errorf("route conflicts with metrics-path: %s", pattern)
+		}
+		mux.Handle(pattern, handler)
+	}
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listening on address")
+	}
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		cfg.Log.Infof("Serving metrics on: %s%s", listener.Addr(), MetricsPath)
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			cfg.Log.Errorf("Error serving metrics: %s", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		cfg.Log.Debug("Received context-done signal")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			cfg.Log.Errorf("Error shutting down metrics-server: %s", err)
+		}
+	}()
+	return listener.Addr(), nil
+}
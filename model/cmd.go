@@ -23,26 +23,59 @@ const (
 	ProcessTxn   CmdAction = "ProcessTxn"
 	CreateReport CmdAction = "CreateReport"
 	WriteData    CmdAction = "WriteData"
+	UpdateLimits CmdAction = "UpdateLimits"
+	QueryState   CmdAction = "QueryState"
+	QueryBalance CmdAction = "QueryBalance"
+	// Rebuilds a customer's transaction-results
+	RebuildCustomer CmdAction = "RebuildCustomer"
+	// Dumps diagnostics of a running pipeline
+	DumpDiagnostics CmdAction = "DumpDiagnostics"
 )
 
 // Cmd represents a Command.
 // Use #NewCmd to create new instance.
 type Cmd struct {
 	id             string
+	causationID    string
+	causationKey   string
 	correlationKey string
-
-	time   time.Time
-	action CmdAction
-	data   []byte
+	epoch          uint64
+	isReplay       bool
+	inputSeq       uint64
+
+	time     time.Time
+	action   CmdAction
+	data     []byte
+	priority int
 }
 
 // CmdCfg is config for Cmd.
 type CmdCfg struct {
+	// Optional, ID of event which caused this command.
+	CausationID string
+	// Optional, ID of message (command or event)
+	// which directly caused this command.
+	CausationKey string
+	// Optional, ID of message which started the flow
+	// this command is part of. Stays same across hops.
 	CorrelationKey string
+	// Flow-epoch the command was issued in.
+	// Listeners can use this to reject commands
+	// issued before the current phase of flow.
+	Epoch uint64
+	// Set if command is caused by a replayed event. Handlers
+	// rebuild state without emitting events for messages
+	// they have already handled.
+	IsReplay bool
+	// Optional, sequence-number (starting from 1) of input-record
+	// the command's flow started from. Stays same across hops.
+	InputSeq uint64
 
 	Time   time.Time
 	Action CmdAction `validate:"nonzero"`
 	Data   interface{}
+	// Optional, defaults to PriorityNormal.
+	Priority int
 }
 
 // NewCmd validates provided
@@ -65,7 +98,8 @@ func NewCmd(cfg *CmdCfg) (Cmd, error) {
 	var dataBytes []byte
 	switch v := cfg.Data.(type) {
 	case []byte:
-		dataBytes = v
+		// Copied, so caller can't modify data afterwards
+		dataBytes = copyData(v)
 	default:
 		dataBytes, err = json.Marshal(cfg.Data)
 		if err != nil {
@@ -75,11 +109,17 @@ func NewCmd(cfg *CmdCfg) (Cmd, error) {
 
 	return Cmd{
 		id:             id.String(),
+		causationID:    cfg.CausationID,
+		causationKey:   cfg.CausationKey,
 		correlationKey: cfg.CorrelationKey,
-
-		time:   cfg.Time,
-		action: cfg.Action,
-		data:   dataBytes,
+		epoch:          cfg.Epoch,
+		isReplay:       cfg.IsReplay,
+		inputSeq:       cfg.InputSeq,
+
+		time:     cfg.Time,
+		action:   cfg.Action,
+		data:     dataBytes,
+		priority: cfg.Priority,
 	}, nil
 }
 
@@ -88,11 +128,36 @@ func (c Cmd) ID() string {
 	return c.id
 }
 
+// CausationID returns Command-CausationID.
+func (c Cmd) CausationID() string {
+	return c.causationID
+}
+
+// CausationKey returns Command-CausationKey.
+func (c Cmd) CausationKey() string {
+	return c.causationKey
+}
+
 // CorrelationKey returns Command-CorrelationKey.
 func (c Cmd) CorrelationKey() string {
 	return c.correlationKey
 }
 
+// Epoch returns flow-epoch the Command was issued in.
+func (c Cmd) Epoch() uint64 {
+	return c.epoch
+}
+
+// IsReplay return Command-IsReplay.
+func (c Cmd) IsReplay() bool {
+	return c.isReplay
+}
+
+// InputSeq return Command-InputSeq.
+func (c Cmd) InputSeq() uint64 {
+	return c.inputSeq
+}
+
 // Time return Command-Time.
 func (c Cmd) Time() time.Time {
 	return c.time
@@ -103,7 +168,88 @@ func (c Cmd) Action() CmdAction {
 	return c.action
 }
 
-// Data return Command-Data.
+// Data returns a copy of Command-Data. Same Command is
+// delivered to multiple subscribers, so modifying the
+// copy doesn't affect data seen by others.
 func (c Cmd) Data() []byte {
+	return copyData(c.data)
+}
+
+// RawData returns Command-Data without copying, for trusted
+// read-only paths (such as unmarshalling data). The returned
+// slice is shared, and must not be modified.
+func (c Cmd) RawData() []byte {
 	return c.data
 }
+
+// Priority return Command-Priority.
+func (c Cmd) Priority() int {
+	return c.priority
+}
+
+// cmdJSON is JSON-representation of Cmd.
+// Data is base64-encoded, since it isn't always JSON.
+type cmdJSON struct {
+	ID             string `json:"id"`
+	CausationID    string `json:"causation_id,omitempty"`
+	CausationKey   string `json:"causation_key,omitempty"`
+	CorrelationKey string `json:"correlation_key,omitempty"`
+	Epoch          uint64 `json:"epoch,omitempty"`
+	IsReplay       bool   `json:"is_replay,omitempty"`
+	InputSeq       uint64 `json:"input_seq,omitempty"`
+
+	Time     time.Time `json:"time"`
+	Action   CmdAction `json:"action"`
+	Data     []byte    `json:"data"`
+	Priority int       `json:"priority,omitempty"`
+}
+
+// MarshalJSON marshals all fields of Cmd, including its ID.
+func (c Cmd) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&cmdJSON{
+		ID:             c.id,
+		CausationID:    c.causationID,
+		CausationKey:   c.causationKey,
+		CorrelationKey: c.correlationKey,
+		Epoch:          c.epoch,
+		IsReplay:       c.isReplay,
+		InputSeq:       c.inputSeq,
+
+		Time:     c.time,
+		Action:   c.action,
+		Data:     c.data,
+		Priority: c.priority,
+	})
+}
+
+// UnmarshalJSON restores Cmd, including its
+// ID, from JSON created by #MarshalJSON.
+func (c *Cmd) UnmarshalJSON(b []byte) error {
+	cj := &cmdJSON{}
+	err := json.Unmarshal(b, cj)
+	if err != nil {
+		return err
+	}
+	if cj.ID == "" {
+		return errors.New("command-id is blank")
+	}
+	if cj.Action == "" {
+		return errors.New("action is blank")
+	}
+
+	*c = Cmd{
+		id:             cj.ID,
+		causationID:    cj.CausationID,
+		causationKey:   cj.CausationKey,
+		correlationKey: cj.CorrelationKey,
+		epoch:          cj.Epoch,
+		isReplay:       cj.IsReplay,
+		inputSeq:       cj.InputSeq,
+
+		time:     cj.Time,
+		action:   cj.Action,
+		data:     cj.Data,
+		priority: cj.Priority,
+	}
+	return nil
+}
@@ -1,105 +1,230 @@
-package model
+package model_test
 
 import (
 	"encoding/binary"
 	"encoding/json"
+	"reflect"
+	"testing"
 	"time"
 
 	"github.com/google/uuid"
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
 )
 
-var _ = Describe("NewCmd", func() {
-	const testCmd CmdAction = "testCmd"
+func TestNewCmdTime(t *testing.T) {
+	now := time.Now()
 
-	Context("setting time", func() {
-		It("should set time if not already set", func() {
-			cmd, err := NewCmd(&CmdCfg{
-				Action: testCmd,
-				Data:   []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(cmd.Time().IsZero()).To(BeFalse())
-		})
+	tests := []struct {
+		name string
+		time time.Time
+	}{
+		{name: "sets time if not already set"},
+		{name: "uses existing time if already set", time: now},
+	}
 
-		It("should use existing time if already set", func() {
-			t := time.Now()
-			cmd, err := NewCmd(&CmdCfg{
-				Time:   t,
-				Action: testCmd,
-				Data:   []byte("test-data"),
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Time:   test.time,
+				Action: testsupport.FixtureCmd,
+				Data:   []byte(testsupport.FixtureData),
 			})
-			Expect(err).ToNot(HaveOccurred())
+			if err != nil {
+				t.Fatalf("error creating command: %s", err)
+			}
 
-			Expect(cmd.Time().IsZero()).To(BeFalse())
-			Expect(cmd.Time().UnixNano()).To(Equal(t.UnixNano()))
+			if cmd.Time().IsZero() {
+				t.Fatal("expected command-time to be set")
+			}
+			if !test.time.IsZero() && cmd.Time().UnixNano() != test.time.UnixNano() {
+				t.Fatalf("expected command-time %s, got %s", test.time, cmd.Time())
+			}
 		})
-	})
+	}
+}
 
-	It("should generate command-id", func() {
-		cmd, err := NewCmd(&CmdCfg{
-			Action: testCmd,
-			Data:   []byte("test-data"),
-		})
-		Expect(err).ToNot(HaveOccurred())
-		Expect(cmd.ID()).ToNot(BeEmpty())
+func TestNewCmdID(t *testing.T) {
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		Action: testsupport.FixtureCmd,
+		Data:   []byte(testsupport.FixtureData),
 	})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+	if cmd.ID() == "" {
+		t.Fatal("expected command-id to be generated")
+	}
+}
 
-	Context("setting data", func() {
-		It("sets data as is if data-type is bytes", func() {
-			data := "test-data"
-			cmd, err := NewCmd(&CmdCfg{
-				Action: testCmd,
-				Data:   []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(string(cmd.Data())).To(Equal(data))
-
-			int64Data := int64(33)
-			int64Bytes := make([]byte, 8)
-			binary.LittleEndian.PutUint64(int64Bytes, uint64(int64Data))
-			cmd, err = NewCmd(&CmdCfg{
-				Action: testCmd,
-				Data:   int64Bytes,
-			})
-			Expect(err).ToNot(HaveOccurred())
-			cmdData := int64(binary.LittleEndian.Uint64(cmd.Data()))
-			Expect(cmdData).To(Equal(int64Data))
-		})
+func TestNewCmdData(t *testing.T) {
+	type dataStruct struct {
+		Field1 string
+		Field2 int
+	}
 
-		It("json-marshals data if data-type is not bytes", func() {
-			type dataStruct struct {
-				Field1 string
-				Field2 int
-			}
-			data := dataStruct{
+	int64Data := int64(33)
+	int64Bytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(int64Bytes, uint64(int64Data))
+
+	tests := []struct {
+		name     string
+		data     interface{}
+		validate func(data []byte) error
+	}{
+		{
+			name:     "sets string-bytes as is",
+			data:     []byte("test-data"),
+			validate: expectString("test-data"),
+		},
+		{
+			name:     "sets int64-bytes as is",
+			data:     int64Bytes,
+			validate: expectInt64(int64Data),
+		},
+		{
+			name: "json-marshals data if data-type is not bytes",
+			data: dataStruct{
 				Field1: "test",
 				Field2: 140,
-			}
-			cmd, err := NewCmd(&CmdCfg{
-				Action: testCmd,
-				Data:   data,
-			})
-			Expect(err).ToNot(HaveOccurred())
+			},
+			validate: func(data []byte) error {
+				unmarshData := dataStruct{}
+				err := json.Unmarshal(data, &unmarshData)
+				if err != nil {
+					return err
+				}
+				return expectEqual(unmarshData, dataStruct{Field1: "test", Field2: 140})
+			},
+		},
+	}
 
-			unmarshData := &dataStruct{}
-			err = json.Unmarshal(cmd.Data(), unmarshData)
-			Expect(err).ToNot(HaveOccurred())
-			Expect(*unmarshData).To(Equal(data))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd, err := model.NewCmd(&model.CmdCfg{
+				Action: testsupport.FixtureCmd,
+				Data:   test.data,
+			})
+			if err != nil {
+				t.Fatalf("error creating command: %s", err)
+			}
+			if err = test.validate(cmd.Data()); err != nil {
+				t.Fatal(err)
+			}
 		})
+	}
+}
 
-		It("sets correlation-key correctly", func() {
-			key, err := uuid.NewRandom()
-			Expect(err).ToNot(HaveOccurred())
+func TestNewCmdCorrelationKey(t *testing.T) {
+	key, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
 
-			cmd, err := NewCmd(&CmdCfg{
-				CorrelationKey: key.String(),
-				Action:         testCmd,
-				Data:           []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(cmd.CorrelationKey()).To(Equal(key.String()))
-		})
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		CorrelationKey: key.String(),
+		Action:         testsupport.FixtureCmd,
+		Data:           []byte(testsupport.FixtureData),
+	})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+	if cmd.CorrelationKey() != key.String() {
+		t.Fatalf("expected correlation-key %s, got %s", key, cmd.CorrelationKey())
+	}
+}
+
+func TestNewCmdCausationID(t *testing.T) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatalf("error generating id: %s", err)
+	}
+
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		CausationID: id.String(),
+		Action:      testsupport.FixtureCmd,
+		Data:        []byte(testsupport.FixtureData),
+	})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+	if cmd.CausationID() != id.String() {
+		t.Fatalf("expected causation-id %s, got %s", id, cmd.CausationID())
+	}
+}
+
+func TestNewCmdCausationKey(t *testing.T) {
+	key, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		CausationKey: key.String(),
+		Action:       testsupport.FixtureCmd,
+		Data:         []byte(testsupport.FixtureData),
+	})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+	if cmd.CausationKey() != key.String() {
+		t.Fatalf("expected causation-key %s, got %s", key, cmd.CausationKey())
+	}
+}
+
+func TestCmdDataIsCopied(t *testing.T) {
+	data := []byte("test-data")
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		Action: testsupport.FixtureCmd,
+		Data:   data,
+	})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+
+	data[0] = 'X'
+	cmd.Data()[1] = 'X'
+	if err = expectString("test-data")(cmd.Data()); err != nil {
+		t.Fatal(err)
+	}
+	if err = expectString("test-data")(cmd.RawData()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCmdJSONRoundTrip(t *testing.T) {
+	cmd, err := model.NewCmd(&model.CmdCfg{
+		CausationID:    "cause-1",
+		CausationKey:   "cause-2",
+		CorrelationKey: "flow-1",
+		Epoch:          3,
+		IsReplay:       true,
+		InputSeq:       7,
+		Time:           time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Action:         testsupport.FixtureCmd,
+		Data:           []byte(testsupport.FixtureData),
+		Priority:       model.PriorityControl,
 	})
-})
+	if err != nil {
+		t.Fatalf("error creating command: %s", err)
+	}
+
+	cmdJSON, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatalf("error marshalling command: %s", err)
+	}
+	restored := model.Cmd{}
+	err = json.Unmarshal(cmdJSON, &restored)
+	if err != nil {
+		t.Fatalf("error unmarshalling command: %s", err)
+	}
+	if !reflect.DeepEqual(restored, cmd) {
+		t.Fatalf("expected restored command: %+v, got: %+v", cmd, restored)
+	}
+
+	err = json.Unmarshal([]byte(`{"action":"CreateTxn"}`), &restored)
+	if err == nil {
+		t.Fatal("expected error unmarshalling command without ID")
+	}
+}
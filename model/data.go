@@ -0,0 +1,13 @@
+package model
+
+// copyData returns a copy of message-data.
+// Nil data stays nil, so it can still be
+// told apart from empty data.
+func copyData(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	dataCopy := make([]byte, len(data))
+	copy(dataCopy, data)
+	return dataCopy
+}
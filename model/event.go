@@ -19,17 +19,29 @@ func (ea EventAction) String() string {
 
 // Domain events
 const (
-	TxnRead EventAction = "TxnRead"
+	TxnRead       EventAction = "TxnRead"
+	TxnReadFailed EventAction = "TxnReadFailed"
 
 	TxnCreated      EventAction = "TxnCreated"
 	TxnCreateFailed EventAction = "TxnCreateFailed"
+	TxnSkipped      EventAction = "TxnSkipped"
 
 	AccountDeposited     EventAction = "AccountDeposited"
 	AccountWithdrawn     EventAction = "AccountWithdrawn"
 	AccountLimitExceeded EventAction = "AccountLimitExceeded"
 	DuplicateTxn         EventAction = "DuplicateTxn"
+	BalanceSnapshot      EventAction = "BalanceSnapshot"
+	AccountSeeded        EventAction = "AccountSeeded"
+	AccountRecovered     EventAction = "AccountRecovered"
+	PartialWithdrawal    EventAction = "PartialWithdrawal"
+	StateQueried         EventAction = "StateQueried"
+	BalanceQueried       EventAction = "BalanceQueried"
+
+	RejectionRateAnomaly EventAction = "RejectionRateAnomaly"
+	DiagnosticsDumped    EventAction = "DiagnosticsDumped"
 
 	DataWritten EventAction = "DataWritten"
+	WriteFailed EventAction = "WriteFailed"
 )
 
 // Event represents a Command.
@@ -37,23 +49,45 @@ const (
 type Event struct {
 	id             string
 	aggregateID    string
+	causationID    string
+	causationKey   string
 	correlationKey string
+	inputSeq       uint64
+	source         string
 
 	time     time.Time
 	action   EventAction
 	data     []byte
 	isReplay bool
+	priority int
 }
 
 // EventCfg is config for Event.
 type EventCfg struct {
-	AggregateID    string `validate:"nonzero"`
+	AggregateID string `validate:"nonzero"`
+	// Optional, ID of event which caused this event. For events
+	// resulting from a command, this is the event which caused
+	// the command, so events can be traced across commands.
+	CausationID string
+	// Optional, ID of message (command or event)
+	// which directly caused this event.
+	CausationKey string
+	// Optional, ID of message which started the flow
+	// this event is part of. Stays same across hops.
 	CorrelationKey string
+	// Optional, sequence-number (starting from 1) of input-record
+	// the event's flow started from. Stays same across hops.
+	InputSeq uint64
+	// Optional, identifies instance which produced the event,
+	// such as in deployments sharing an event-store.
+	Source string
 
 	Time     time.Time
 	Action   EventAction `validate:"nonzero"`
 	Data     interface{}
 	IsReplay bool
+	// Optional, defaults to PriorityNormal.
+	Priority int
 }
 
 // NewEvent validates provided
@@ -76,7 +110,8 @@ func NewEvent(cfg *EventCfg) (Event, error) {
 	var dataBytes []byte
 	switch v := cfg.Data.(type) {
 	case []byte:
-		dataBytes = v
+		// Copied, so caller can't modify data afterwards
+		dataBytes = copyData(v)
 	default:
 		dataBytes, err = json.Marshal(cfg.Data)
 		if err != nil {
@@ -87,12 +122,17 @@ func NewEvent(cfg *EventCfg) (Event, error) {
 	return Event{
 		id:             id.String(),
 		aggregateID:    cfg.AggregateID,
+		causationID:    cfg.CausationID,
+		causationKey:   cfg.CausationKey,
 		correlationKey: cfg.CorrelationKey,
+		inputSeq:       cfg.InputSeq,
+		source:         cfg.Source,
 
 		time:     cfg.Time,
 		action:   cfg.Action,
 		data:     dataBytes,
 		isReplay: cfg.IsReplay,
+		priority: cfg.Priority,
 	}, nil
 }
 
@@ -106,11 +146,31 @@ func (e Event) AggregateID() string {
 	return e.aggregateID
 }
 
+// CausationID return Event-CausationID.
+func (e Event) CausationID() string {
+	return e.causationID
+}
+
+// CausationKey return Event-CausationKey.
+func (e Event) CausationKey() string {
+	return e.causationKey
+}
+
 // CorrelationKey return Event-CorrelationKey.
 func (e Event) CorrelationKey() string {
 	return e.correlationKey
 }
 
+// InputSeq return Event-InputSeq.
+func (e Event) InputSeq() uint64 {
+	return e.inputSeq
+}
+
+// Source return Event-Source.
+func (e Event) Source() string {
+	return e.source
+}
+
 // Time return Event-Time.
 func (e Event) Time() time.Time {
 	return e.time
@@ -121,12 +181,115 @@ func (e Event) Action() EventAction {
 	return e.action
 }
 
-// Data return Event-Data.
+// Data returns a copy of Event-Data. Same Event is delivered
+// to multiple subscribers and stored, so modifying the copy
+// doesn't affect data seen by others.
 func (e Event) Data() []byte {
+	return copyData(e.data)
+}
+
+// RawData returns Event-Data without copying, for trusted
+// read-only paths (such as unmarshalling data). The returned
+// slice is shared, and must not be modified.
+func (e Event) RawData() []byte {
 	return e.data
 }
 
+// WithData returns copy of Event with its data replaced, keeping
+// all other fields (including ID) same. Used for rewriting stored
+// events, such as when migrating schema of their data.
+func (e Event) WithData(data []byte) Event {
+	e.data = copyData(data)
+	return e
+}
+
+// WithSource returns copy of Event with its source
+// replaced, keeping all other fields (including ID) same.
+// Used for tagging events with instance storing these.
+func (e Event) WithSource(source string) Event {
+	e.source = source
+	return e
+}
+
 // IsReplay return Event-IsReplay.
 func (e Event) IsReplay() bool {
 	return e.isReplay
 }
+
+// Priority return Event-Priority.
+func (e Event) Priority() int {
+	return e.priority
+}
+
+// eventJSON is JSON-representation of Event.
+// Data is base64-encoded, since it isn't always JSON.
+type eventJSON struct {
+	ID             string `json:"id"`
+	AggregateID    string `json:"aggregate_id"`
+	CausationID    string `json:"causation_id,omitempty"`
+	CausationKey   string `json:"causation_key,omitempty"`
+	CorrelationKey string `json:"correlation_key,omitempty"`
+	InputSeq       uint64 `json:"input_seq,omitempty"`
+	Source         string `json:"source,omitempty"`
+
+	Time     time.Time   `json:"time"`
+	Action   EventAction `json:"action"`
+	Data     []byte      `json:"data"`
+	IsReplay bool        `json:"is_replay,omitempty"`
+	Priority int         `json:"priority,omitempty"`
+}
+
+// MarshalJSON marshals all fields of Event, including its ID.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&eventJSON{
+		ID:             e.id,
+		AggregateID:    e.aggregateID,
+		CausationID:    e.causationID,
+		CausationKey:   e.causationKey,
+		CorrelationKey: e.correlationKey,
+		InputSeq:       e.inputSeq,
+		Source:         e.source,
+
+		Time:     e.time,
+		Action:   e.action,
+		Data:     e.data,
+		IsReplay: e.isReplay,
+		Priority: e.priority,
+	})
+}
+
+// UnmarshalJSON restores Event, including its
+// ID, from JSON created by #MarshalJSON.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	ej := &eventJSON{}
+	err := json.Unmarshal(b, ej)
+	if err != nil {
+		return err
+	}
+	if ej.ID == "" {
+		return errors.New("event-id is blank")
+	}
+	if ej.AggregateID == "" {
+		return errors.New("aggregate-id is blank")
+	}
+	if ej.Action == "" {
+		return errors.New("action is blank")
+	}
+
+	*e = Event{
+		id:             ej.ID,
+		aggregateID:    ej.AggregateID,
+		causationID:    ej.CausationID,
+		causationKey:   ej.CausationKey,
+		correlationKey: ej.CorrelationKey,
+		inputSeq:       ej.InputSeq,
+		source:         ej.Source,
+
+		time:     ej.Time,
+		action:   ej.Action,
+		data:     ej.Data,
+		isReplay: ej.IsReplay,
+		priority: ej.Priority,
+	}
+	return nil
+}
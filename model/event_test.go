@@ -1,112 +1,265 @@
-package model
+package model_test
 
 import (
 	"encoding/binary"
 	"encoding/json"
+	"testing"
 	"time"
 
 	"github.com/google/uuid"
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
 )
 
-var _ = Describe("NewEvent", func() {
-	const testEvent EventAction = "testEvent"
-
-	Context("setting time", func() {
-		It("should set time if not already set", func() {
-			event, err := NewEvent(&EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(event.Time().IsZero()).To(BeFalse())
-		})
+func TestNewEventTime(t *testing.T) {
+	now := time.Now()
 
-		It("should use existing time if already set", func() {
-			t := time.Now()
-			event, err := NewEvent(&EventCfg{
-				AggregateID: "1",
-				Time:        t,
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-
-			Expect(event.Time().IsZero()).To(BeFalse())
-			Expect(event.Time().UnixNano()).To(Equal(t.UnixNano()))
-		})
-	})
+	tests := []struct {
+		name string
+		time time.Time
+	}{
+		{name: "sets time if not already set"},
+		{name: "uses existing time if already set", time: now},
+	}
 
-	It("should generate event-id", func() {
-		event, err := NewEvent(&EventCfg{
-			AggregateID: "1",
-			Action:      testEvent,
-			Data:        []byte("test-data"),
-		})
-		Expect(err).ToNot(HaveOccurred())
-		Expect(event.ID()).ToNot(BeEmpty())
-	})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := testsupport.NewEventBuilder().
+				WithTime(test.time).
+				Build()
+			if err != nil {
+				t.Fatalf("error creating event: %s", err)
+			}
 
-	Context("setting data", func() {
-		It("sets data as is if data-type is bytes", func() {
-			data := "test-data"
-			event, err := NewEvent(&EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(string(event.Data())).To(Equal(data))
-
-			int64Data := int64(33)
-			int64Bytes := make([]byte, 8)
-			binary.LittleEndian.PutUint64(int64Bytes, uint64(int64Data))
-			event, err = NewEvent(&EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        int64Bytes,
-			})
-			Expect(err).ToNot(HaveOccurred())
-			eventData := int64(binary.LittleEndian.Uint64(event.Data()))
-			Expect(eventData).To(Equal(int64Data))
+			if event.Time().IsZero() {
+				t.Fatal("expected event-time to be set")
+			}
+			if !test.time.IsZero() && event.Time().UnixNano() != test.time.UnixNano() {
+				t.Fatalf("expected event-time %s, got %s", test.time, event.Time())
+			}
 		})
+	}
+}
 
-		It("json-marshals data if data-type is not bytes", func() {
-			type dataStruct struct {
-				Field1 string
-				Field2 int
-			}
-			data := dataStruct{
+func TestNewEventID(t *testing.T) {
+	event, err := testsupport.NewEventBuilder().Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	if event.ID() == "" {
+		t.Fatal("expected event-id to be generated")
+	}
+}
+
+func TestNewEventData(t *testing.T) {
+	type dataStruct struct {
+		Field1 string
+		Field2 int
+	}
+
+	int64Data := int64(33)
+	int64Bytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(int64Bytes, uint64(int64Data))
+
+	tests := []struct {
+		name     string
+		data     interface{}
+		validate func(data []byte) error
+	}{
+		{
+			name:     "sets string-bytes as is",
+			data:     []byte("test-data"),
+			validate: expectString("test-data"),
+		},
+		{
+			name:     "sets int64-bytes as is",
+			data:     int64Bytes,
+			validate: expectInt64(int64Data),
+		},
+		{
+			name: "json-marshals data if data-type is not bytes",
+			data: dataStruct{
 				Field1: "test",
 				Field2: 140,
+			},
+			validate: func(data []byte) error {
+				unmarshData := dataStruct{}
+				err := json.Unmarshal(data, &unmarshData)
+				if err != nil {
+					return err
+				}
+				return expectEqual(unmarshData, dataStruct{Field1: "test", Field2: 140})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := testsupport.NewEventBuilder().
+				WithData(test.data).
+				Build()
+			if err != nil {
+				t.Fatalf("error creating event: %s", err)
+			}
+			if err = test.validate(event.Data()); err != nil {
+				t.Fatal(err)
 			}
-			event, err := NewEvent(&EventCfg{
-				AggregateID: "1",
-				Action:      testEvent,
-				Data:        data,
-			})
-			Expect(err).ToNot(HaveOccurred())
-
-			unmarshData := &dataStruct{}
-			err = json.Unmarshal(event.Data(), unmarshData)
-			Expect(err).ToNot(HaveOccurred())
-			Expect(*unmarshData).To(Equal(data))
 		})
+	}
+}
 
-		It("sets correlation-key correctly", func() {
-			key, err := uuid.NewRandom()
-			Expect(err).ToNot(HaveOccurred())
-
-			event, err := NewEvent(&EventCfg{
-				AggregateID:    "1",
-				CorrelationKey: key.String(),
-				Action:         testEvent,
-				Data:           []byte("test-data"),
-			})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(event.CorrelationKey()).To(Equal(key.String()))
-		})
+func TestNewEventCorrelationKey(t *testing.T) {
+	key, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+
+	event, err := testsupport.NewEventBuilder().
+		WithCorrelationKey(key.String()).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	if event.CorrelationKey() != key.String() {
+		t.Fatalf("expected correlation-key %s, got %s", key, event.CorrelationKey())
+	}
+}
+
+func TestNewEventCausationID(t *testing.T) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatalf("error generating id: %s", err)
+	}
+
+	event, err := testsupport.NewEventBuilder().
+		WithCausationID(id.String()).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	if event.CausationID() != id.String() {
+		t.Fatalf("expected causation-id %s, got %s", id, event.CausationID())
+	}
+}
+
+func TestNewEventCausationKey(t *testing.T) {
+	key, err := uuid.NewRandom()
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+
+	event, err := testsupport.NewEventBuilder().
+		WithCausationKey(key.String()).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	if event.CausationKey() != key.String() {
+		t.Fatalf("expected causation-key %s, got %s", key, event.CausationKey())
+	}
+
+	// Causation-key is retained when event is stored as JSON
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("error marshalling event: %s", err)
+	}
+	restored := model.Event{}
+	err = json.Unmarshal(eventJSON, &restored)
+	if err != nil {
+		t.Fatalf("error unmarshalling event: %s", err)
+	}
+	if restored.CausationKey() != key.String() {
+		t.Fatalf("expected restored causation-key %s, got %s", key, restored.CausationKey())
+	}
+}
+
+func TestNewEventSource(t *testing.T) {
+	event, err := testsupport.NewEventBuilder().
+		WithSource("instance-1").
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	if event.Source() != "instance-1" {
+		t.Fatalf("expected source instance-1, got %s", event.Source())
+	}
+
+	// Source is retained when event is stored as JSON
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("error marshalling event: %s", err)
+	}
+	restored := model.Event{}
+	err = json.Unmarshal(eventJSON, &restored)
+	if err != nil {
+		t.Fatalf("error unmarshalling event: %s", err)
+	}
+	if restored.Source() != "instance-1" {
+		t.Fatalf("expected restored source instance-1, got %s", restored.Source())
+	}
+
+	// Replacing source keeps other fields
+	retagged := event.WithSource("instance-2")
+	if retagged.Source() != "instance-2" || retagged.ID() != event.ID() {
+		t.Fatalf("expected event with replaced source, got %+v", retagged)
+	}
+	if event.Source() != "instance-1" {
+		t.Fatalf("expected original source to be unchanged, got %s", event.Source())
+	}
+}
+
+func TestEventDataIsCopied(t *testing.T) {
+	data := []byte("test-data")
+	event, err := testsupport.NewEventBuilder().
+		WithData(data).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+
+	// Modifying data passed to, or returned by, event
+	// shouldn't affect data seen by other consumers.
+	data[0] = 'X'
+	event.Data()[1] = 'X'
+	if err = expectString("test-data")(event.Data()); err != nil {
+		t.Fatal(err)
+	}
+	if err = expectString("test-data")(event.RawData()); err != nil {
+		t.Fatal(err)
+	}
+
+	nilEvent, err := testsupport.NewEventBuilder().
+		WithData([]byte(nil)).
+		Build()
+	if err != nil {
+		t.Fatalf("error creating event: %s", err)
+	}
+	if nilEvent.Data() != nil {
+		t.Fatalf("expected nil data to stay nil, got %v", nilEvent.Data())
+	}
+}
+
+// BenchmarkEventData measures cost of copying event-data
+// for a typical account-state payload.
+func BenchmarkEventData(b *testing.B) {
+	event, err := testsupport.NewEventBuilder().
+		WithData(make([]byte, 256)).
+		Build()
+	if err != nil {
+		b.Fatalf("error creating event: %s", err)
+	}
+
+	b.Run("Data", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = event.Data()
+		}
+	})
+	b.Run("RawData", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = event.RawData()
+		}
 	})
-})
+}
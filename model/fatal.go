@@ -0,0 +1,36 @@
+package model
+
+import (
+	"github.com/pkg/errors"
+)
+
+// FatalError marks an error after which the application
+// cannot meaningfully continue (such as a store becoming
+// unavailable). Runners can use this to abort early.
+// Use #NewFatalError to create new instance.
+type FatalError struct {
+	Err error
+}
+
+// NewFatalError marks provided error as fatal.
+func NewFatalError(err error) *FatalError {
+	return &FatalError{
+		Err: err,
+	}
+}
+
+func (e *FatalError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error marked as fatal.
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
+// IsFatal returns true if any error in
+// error's chain is a FatalError.
+func IsFatal(err error) bool {
+	var fatalErr *FatalError
+	return errors.As(err, &fatalErr)
+}
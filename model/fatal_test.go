@@ -0,0 +1,52 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+func TestIsFatal(t *testing.T) {
+	cause := errors.New("some error")
+
+	tests := []struct {
+		name        string
+		err         error
+		expectFatal bool
+	}{
+		{
+			name:        "detects fatal error",
+			err:         model.NewFatalError(cause),
+			expectFatal: true,
+		},
+		{
+			name:        "detects wrapped fatal error",
+			err:         errors.Wrap(model.NewFatalError(cause), "wrapped"),
+			expectFatal: true,
+		},
+		{
+			name: "ignores non-fatal error",
+			err:  cause,
+		},
+		{
+			name: "ignores nil error",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if model.IsFatal(test.err) != test.expectFatal {
+				t.Fatalf("expected fatal: %t, for error: %v", test.expectFatal, test.err)
+			}
+		})
+	}
+
+	t.Run("unwraps to cause", func(t *testing.T) {
+		err := errors.Wrap(model.NewFatalError(cause), "wrapped")
+		if !errors.Is(err, cause) {
+			t.Fatal("expected fatal error to unwrap to cause")
+		}
+	})
+}
@@ -1,13 +0,0 @@
-package model
-
-import (
-	"testing"
-
-	. "github.com/onsi/ginkgo"
-	. "github.com/onsi/gomega"
-)
-
-func TestModel(t *testing.T) {
-	RegisterFailHandler(Fail)
-	RunSpecs(t, "Model Suite")
-}
@@ -0,0 +1,11 @@
+package model
+
+// Priorities for commands and events. Buses supporting
+// priority-delivery deliver higher-priority messages to a
+// subscriber first, and in published order within a priority.
+const (
+	PriorityNormal = 0
+	// For control-messages which should not wait
+	// behind a backlog of regular messages.
+	PriorityControl = 10
+)
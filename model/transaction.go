@@ -10,4 +10,14 @@ type Transaction struct {
 	CustomerID string    `json:"customer_id"`
 	LoadAmount float64   `json:"load_amount"`
 	Time       time.Time `json:"time"`
+	// Test-transactions are processed like any other
+	// transaction, but can be excluded from reports.
+	IsTest bool `json:"is_test,omitempty"`
+	// Sequence-number of input-record transaction was
+	// created from. Zero if not read from input.
+	InputSeq uint64 `json:"input_seq,omitempty"`
+	// Optional, such as "ATM" or "online". Transactions
+	// of a category can have their own limits, along
+	// with limits of all transactions.
+	Category string `json:"category,omitempty"`
 }
@@ -0,0 +1,36 @@
+package model_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+func expectString(expected string) func([]byte) error {
+	return func(data []byte) error {
+		if string(data) != expected {
+			return fmt.Errorf("expected data %q, got %q", expected, string(data))
+		}
+		return nil
+	}
+}
+
+func expectInt64(expected int64) func([]byte) error {
+	return func(data []byte) error {
+		if len(data) != 8 {
+			return fmt.Errorf("expected 8 bytes of data, got %d", len(data))
+		}
+		actual := int64(binary.LittleEndian.Uint64(data))
+		if actual != expected {
+			return fmt.Errorf("expected data %d, got %d", expected, actual)
+		}
+		return nil
+	}
+}
+
+func expectEqual(actual, expected interface{}) error {
+	if !reflect.DeepEqual(actual, expected) {
+		return fmt.Errorf("expected %+v, got %+v", expected, actual)
+	}
+	return nil
+}
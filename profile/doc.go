@@ -0,0 +1,3 @@
+// Package profile provides named ingestion-profiles,
+// bundling settings for input of upstream partners.
+package profile
@@ -0,0 +1,70 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// extensions of supported profile-files, in order
+// they're looked up by LoadNamed.
+var extensions = []string{".json", ".yaml", ".yml"}
+
+// Load loads and validates profile from JSON or YAML file,
+// decided by file's extension. Unknown fields fail loading,
+// so misspelled settings aren't silently ignored.
+func Load(path string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading profile")
+	}
+
+	profile := &Profile{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(profile)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, profile)
+	default:
+		return nil, fmt.Errorf("unsupported profile-file: %s, expected one of: %v", path, extensions)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decoding profile: %s", path)
+	}
+
+	err = profile.Validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error validating profile: %s", path)
+	}
+	return profile, nil
+}
+
+// LoadNamed loads profile with name from dir, from file
+// named after profile with any supported extension.
+func LoadNamed(dir string, name string) (*Profile, error) {
+	for _, ext := range extensions {
+		path := filepath.Join(dir, name+ext)
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		profile, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if profile.Name != name {
+			return nil, fmt.Errorf("profile-file %s is of profile %q, expected %q", path, profile.Name, name)
+		}
+		return profile, nil
+	}
+	return nil, fmt.Errorf("profile %q not found in: %s", name, dir)
+}
@@ -0,0 +1,44 @@
+package profile
+
+import "strings"
+
+// Normalizer normalizes customer-IDs of transaction-requests,
+// such as for partners padding their IDs.
+type Normalizer string
+
+// Supported customer-ID normalizers.
+const (
+	// Removes surrounding spaces
+	NormalizeTrim      Normalizer = "trim"
+	NormalizeLowercase Normalizer = "lowercase"
+	// Removes leading zeros, keeping at least one character
+	// so an ID of only zeros normalizes to "0".
+	NormalizeStripLeadingZeros Normalizer = "strip_leading_zeros"
+)
+
+var normalizers = map[Normalizer]func(string) string{
+	NormalizeTrim:      strings.TrimSpace,
+	NormalizeLowercase: strings.ToLower,
+	NormalizeStripLeadingZeros: func(id string) string {
+		stripped := strings.TrimLeft(id, "0")
+		if stripped == "" && id != "" {
+			return "0"
+		}
+		return stripped
+	},
+}
+
+// customerIDNormalizer returns func applying
+// normalizers in order. Normalizers must be valid.
+func customerIDNormalizer(names []Normalizer) func(string) string {
+	funcs := make([]func(string) string, len(names))
+	for i, name := range names {
+		funcs[i] = normalizers[name]
+	}
+	return func(id string) string {
+		for _, normalize := range funcs {
+			id = normalize(id)
+		}
+		return id
+	}
+}
@@ -0,0 +1,220 @@
+package profile
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Profile is a named bundle of ingestion-settings for
+// input of an upstream partner.
+type Profile struct {
+	Name     string `json:"name" yaml:"name" validate:"nonzero"`
+	Settings `yaml:",inline"`
+}
+
+// Settings are settings for reading and creating transactions
+// from input. Unset (zero or nil) settings keep their value
+// from package config, so a profile only sets what's specific
+// to its partner.
+type Settings struct {
+	// ================== Reader ==================
+	Format reader.Format `json:"format,omitempty" yaml:"format,omitempty"`
+	// Renames columns of CSV-header to fields of
+	// transaction-requests, such as "amount" to
+	// "load_amount". Only for reader.FormatCSV.
+	CSVColumns map[string]string `json:"csv_columns,omitempty" yaml:"csv_columns,omitempty"`
+	Encoding   reader.Encoding   `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+
+	// ================== Creator ==================
+	// Default time-format of transaction-requests, either
+	// a Go time-layout or txn.TimeFmtEpochSeconds.
+	TimeFmt                 string               `json:"time_format,omitempty" yaml:"time_format,omitempty"`
+	CurrencySymbol          string               `json:"currency_symbol,omitempty" yaml:"currency_symbol,omitempty"`
+	MaxAmountDecimals       *int                 `json:"max_amount_decimals,omitempty" yaml:"max_amount_decimals,omitempty"`
+	StrictTimeRoundTrip     *bool                `json:"strict_time_round_trip,omitempty" yaml:"strict_time_round_trip,omitempty"`
+	RejectContentDuplicates *bool                `json:"reject_content_duplicates,omitempty" yaml:"reject_content_duplicates,omitempty"`
+	ZeroAmountPolicy        txn.ZeroAmountPolicy `json:"zero_amount_policy,omitempty" yaml:"zero_amount_policy,omitempty"`
+	// Applied in order to customer-IDs of transaction-requests
+	CustomerIDNormalizers []Normalizer `json:"customer_id_normalizers,omitempty" yaml:"customer_id_normalizers,omitempty"`
+	// Transactions loading (or withdrawing) more than this
+	// fail creation with txn.RejectedByValidator.
+	MaxLoadAmount float64 `json:"max_load_amount,omitempty" yaml:"max_load_amount,omitempty"`
+	// Withdrawals fail creation with txn.RejectedByValidator
+	RejectWithdrawals *bool `json:"reject_withdrawals,omitempty" yaml:"reject_withdrawals,omitempty"`
+
+	// ================== Filters ==================
+	// Moves test-transactions to separate section of report
+	ExcludeTestTxns *bool `json:"exclude_test_txns,omitempty" yaml:"exclude_test_txns,omitempty"`
+}
+
+// Validate validates profile, including values of its settings.
+func (p *Profile) Validate() error {
+	err := validator.Validate(p)
+	if err != nil {
+		return err
+	}
+	err = p.Settings.Validate()
+	if err != nil {
+		return errors.Wrapf(err, "invalid profile %q", p.Name)
+	}
+	return nil
+}
+
+// Validate validates values of set settings.
+func (s *Settings) Validate() error {
+	switch s.Format {
+	case "", reader.FormatNDJSON:
+		if len(s.CSVColumns) > 0 {
+			return fmt.Errorf("csv_columns can only be set for format: %s", reader.FormatCSV)
+		}
+	case reader.FormatCSV:
+	default:
+		return fmt.Errorf("invalid format: %s", s.Format)
+	}
+	switch s.Encoding {
+	case "", reader.EncodingUTF8, reader.EncodingUTF16LE, reader.EncodingUTF16BE:
+	default:
+		return fmt.Errorf("invalid encoding: %s", s.Encoding)
+	}
+
+	if s.TimeFmt != "" {
+		err := txn.CheckTimeFmt(s.TimeFmt)
+		if err != nil {
+			return errors.Wrap(err, "invalid time_format")
+		}
+	}
+	if strings.TrimSpace(s.CurrencySymbol) != s.CurrencySymbol {
+		return errors.New("currency_symbol cannot have surrounding spaces")
+	}
+	if s.MaxAmountDecimals != nil && *s.MaxAmountDecimals < 0 {
+		return errors.New("max_amount_decimals cannot be negative")
+	}
+	switch s.ZeroAmountPolicy {
+	case "", txn.ZeroAmountAllow, txn.ZeroAmountReject, txn.ZeroAmountSkip:
+	default:
+		return fmt.Errorf("invalid zero_amount_policy: %s", s.ZeroAmountPolicy)
+	}
+	for _, normalizer := range s.CustomerIDNormalizers {
+		if _, exists := normalizers[normalizer]; !exists {
+			return fmt.Errorf("invalid customer_id_normalizer: %s", normalizer)
+		}
+	}
+	if s.MaxLoadAmount < 0 {
+		return errors.New("max_load_amount cannot be negative")
+	}
+	return nil
+}
+
+// Resolve returns settings of profile, with settings set in
+// explicit taking precedence. A notice is logged for every
+// explicit setting which conflicts with profile's setting.
+// Profile and explicit can be nil.
+func Resolve(profile *Profile, explicit *Settings, log logger.Logger) Settings {
+	resolved := Settings{}
+	if profile != nil {
+		resolved = profile.Settings
+	}
+	if explicit == nil {
+		return resolved
+	}
+
+	resolvedValue := reflect.ValueOf(&resolved).Elem()
+	explicitValue := reflect.ValueOf(explicit).Elem()
+	for i := 0; i < explicitValue.NumField(); i++ {
+		explicitField := explicitValue.Field(i)
+		if explicitField.IsZero() {
+			continue
+		}
+		resolvedField := resolvedValue.Field(i)
+		if !resolvedField.IsZero() &&
+			!reflect.DeepEqual(resolvedField.Interface(), explicitField.Interface()) {
+			log.Infof(
+				"Explicit setting %s (%s) takes precedence over profile %q (%s)",
+				resolvedValue.Type().Field(i).Name,
+				settingString(explicitField),
+				profile.Name,
+				settingString(resolvedField),
+			)
+		}
+		resolvedField.Set(explicitField)
+	}
+	return resolved
+}
+
+// settingString formats value of setting for logs.
+func settingString(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// ApplyReader applies set reader-settings to cfg.
+func (s *Settings) ApplyReader(cfg *reader.Cfg) {
+	if s.Format != "" {
+		cfg.Format = s.Format
+	}
+	if s.CSVColumns != nil {
+		cfg.CSVColumns = s.CSVColumns
+	}
+	if s.Encoding != "" {
+		cfg.Encoding = s.Encoding
+	}
+}
+
+// ApplyCreator applies set creator-settings to cfg. Validators
+// and normalizers of settings replace ones set in cfg.
+func (s *Settings) ApplyCreator(cfg *txn.CreatorCfg) {
+	if s.TimeFmt != "" {
+		cfg.DefaultTimeFmt = s.TimeFmt
+	}
+	if s.CurrencySymbol != "" {
+		cfg.CurrencySymbol = s.CurrencySymbol
+	}
+	if s.MaxAmountDecimals != nil {
+		cfg.MaxAmountDecimals = *s.MaxAmountDecimals
+	}
+	if s.StrictTimeRoundTrip != nil {
+		cfg.StrictTimeRoundTrip = *s.StrictTimeRoundTrip
+	}
+	if s.RejectContentDuplicates != nil {
+		cfg.RejectContentDuplicates = *s.RejectContentDuplicates
+	}
+	if s.ZeroAmountPolicy != "" {
+		cfg.ZeroAmountPolicy = s.ZeroAmountPolicy
+	}
+	if len(s.CustomerIDNormalizers) > 0 {
+		cfg.NormalizeCustomerID = customerIDNormalizer(s.CustomerIDNormalizers)
+	}
+
+	validators := make([]txn.TxnValidator, 0)
+	if s.MaxLoadAmount > 0 {
+		maxLoadAmount := s.MaxLoadAmount
+		validators = append(validators, func(txn *model.Transaction) error {
+			if txn.LoadAmount > maxLoadAmount || -txn.LoadAmount > maxLoadAmount {
+				return fmt.Errorf("LoadAmount exceeds maximum of %.2f", maxLoadAmount)
+			}
+			return nil
+		})
+	}
+	if s.RejectWithdrawals != nil && *s.RejectWithdrawals {
+		validators = append(validators, func(txn *model.Transaction) error {
+			if txn.LoadAmount < 0 {
+				return errors.New("withdrawals are not accepted")
+			}
+			return nil
+		})
+	}
+	if len(validators) > 0 {
+		cfg.Validators = validators
+	}
+}
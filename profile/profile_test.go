@@ -0,0 +1,174 @@
+package profile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/reader"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/profile"
+)
+
+// writeProfile writes profile-file with name to a temporary dir.
+func writeProfile(t *testing.T, name string, content string) (string, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatalf("error creating dir: %s", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("error writing profile: %s", err)
+	}
+	return dir, path
+}
+
+func TestLoadSamples(t *testing.T) {
+	strict, err := profile.LoadNamed("../_samples/profiles", "usd-strict")
+	if err != nil {
+		t.Fatalf("error loading profile: %s", err)
+	}
+	if strict.Format != reader.FormatNDJSON || strict.ZeroAmountPolicy != txn.ZeroAmountReject {
+		t.Fatalf("unexpected settings: %+v", strict.Settings)
+	}
+
+	lax, err := profile.LoadNamed("../_samples/profiles", "eur-lax")
+	if err != nil {
+		t.Fatalf("error loading profile: %s", err)
+	}
+	if lax.Format != reader.FormatCSV || lax.CurrencySymbol != "€" || lax.CSVColumns["amount"] != "load_amount" {
+		t.Fatalf("unexpected settings: %+v", lax.Settings)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		errorMsg string
+	}{
+		{"unknown JSON-field", "p.json", `{"name":"p","zero_amount":"skip"}`, "unknown field"},
+		{"unknown YAML-field", "p.yaml", "name: p\nzero_amount: skip\n", "not found"},
+		{"missing name", "p.json", `{"format":"csv"}`, "Name"},
+		{"invalid format", "p.json", `{"name":"p","format":"xml"}`, "invalid format"},
+		{"columns without CSV", "p.yml", "name: p\ncsv_columns:\n  a: id\n", "csv_columns"},
+		{"invalid time-format", "p.json", `{"name":"p","time_format":"2006-01"}`, "time_format"},
+		{"invalid policy", "p.json", `{"name":"p","zero_amount_policy":"drop"}`, "zero_amount_policy"},
+		{"invalid normalizer", "p.yaml", "name: p\ncustomer_id_normalizers: [upper]\n", "normalizer"},
+		{"negative decimals", "p.json", `{"name":"p","max_amount_decimals":-1}`, "max_amount_decimals"},
+		{"unsupported file", "p.toml", `name = "p"`, "unsupported"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, path := writeProfile(t, test.file, test.content)
+			_, err := profile.Load(path)
+			if err == nil || !strings.Contains(err.Error(), test.errorMsg) {
+				t.Fatalf("expected error containing %q, got: %v", test.errorMsg, err)
+			}
+		})
+	}
+
+	t.Run("name not matching file", func(t *testing.T) {
+		dir, _ := writeProfile(t, "p.json", `{"name":"other"}`)
+		_, err := profile.LoadNamed(dir, "p")
+		if err == nil {
+			t.Fatal("expected error for mismatched name")
+		}
+		_, err = profile.LoadNamed(dir, "missing")
+		if err == nil {
+			t.Fatal("expected error for missing profile")
+		}
+	})
+}
+
+func TestResolve(t *testing.T) {
+	decimals := 2
+	overrideDecimals := 4
+	base := &profile.Profile{
+		Name: "base",
+		Settings: profile.Settings{
+			TimeFmt:           "2006-01-02T15:04:05Z07:00",
+			CurrencySymbol:    "$",
+			MaxAmountDecimals: &decimals,
+			ZeroAmountPolicy:  txn.ZeroAmountReject,
+		},
+	}
+
+	resolved := profile.Resolve(base, &profile.Settings{
+		MaxAmountDecimals: &overrideDecimals,
+		// Same as profile, so isn't a conflict
+		CurrencySymbol: "$",
+		Format:         reader.FormatCSV,
+	}, logger.NewStdLogger("profile"))
+	if *resolved.MaxAmountDecimals != 4 {
+		t.Fatalf("expected explicit setting to take precedence, got: %d", *resolved.MaxAmountDecimals)
+	}
+	if resolved.Format != reader.FormatCSV || resolved.ZeroAmountPolicy != txn.ZeroAmountReject {
+		t.Fatalf("unexpected resolved settings: %+v", resolved)
+	}
+	// Profile isn't modified
+	if *base.MaxAmountDecimals != 2 || base.Format != "" {
+		t.Fatalf("expected profile to be unchanged, got: %+v", base.Settings)
+	}
+
+	resolved = profile.Resolve(nil, nil, logger.NewStdLogger("profile"))
+	if resolved.Format != "" || resolved.MaxAmountDecimals != nil {
+		t.Fatalf("expected blank settings, got: %+v", resolved)
+	}
+}
+
+func TestApplyCreator(t *testing.T) {
+	rejectWithdrawals := true
+	settings := profile.Settings{
+		CustomerIDNormalizers: []profile.Normalizer{
+			profile.NormalizeTrim,
+			profile.NormalizeLowercase,
+			profile.NormalizeStripLeadingZeros,
+		},
+		MaxLoadAmount:     100,
+		RejectWithdrawals: &rejectWithdrawals,
+	}
+	cfg := &txn.CreatorCfg{}
+	settings.ApplyCreator(cfg)
+
+	for id, expected := range map[string]string{
+		" 0042 ": "42",
+		"00AB":   "ab",
+		"000":    "0",
+		"":       "",
+	} {
+		if normalized := cfg.NormalizeCustomerID(id); normalized != expected {
+			t.Fatalf("expected %q to normalize to %q, got %q", id, expected, normalized)
+		}
+	}
+
+	validate := func(amount float64) error {
+		for _, validator := range cfg.Validators {
+			err := validator(&model.Transaction{LoadAmount: amount})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := validate(100); err != nil {
+		t.Fatalf("expected amount to be valid, got: %s", err)
+	}
+	if err := validate(100.01); err == nil {
+		t.Fatal("expected amount above maximum to be invalid")
+	}
+	if err := validate(-1); err == nil {
+		t.Fatal("expected withdrawal to be invalid")
+	}
+}
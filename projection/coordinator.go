@@ -0,0 +1,187 @@
+package projection
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/validator.v2"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// ApplyFunc applies an event to a projection.
+type ApplyFunc func(event model.Event) error
+
+// FailurePolicy decides how Coordinator
+// handles a projection failing to apply an event.
+type FailurePolicy string
+
+// Supported failure-policies.
+const (
+	// Failed projection stops receiving events, and
+	// other projections continue to be hydrated.
+	FailurePolicyIsolate FailurePolicy = "isolate"
+	// Hydration stops and returns the error. Failed event
+	// is applied again on next hydration, but only to
+	// projections which didn't apply it already.
+	FailurePolicyHalt FailurePolicy = "halt"
+)
+
+// Coordinator hydrates registered projections with a single
+// read of new events from event-repo per hydration, instead
+// of each projection reading events on its own.
+// Use #NewCoordinator to create new instance.
+type Coordinator struct {
+	log           logger.Logger
+	eventRepo     eventutil.EventRepo
+	failurePolicy FailurePolicy
+
+	// Serializes hydration and registration
+	lock *sync.Mutex
+	// Index of first event not yet applied
+	// to all non-failed projections
+	index       int
+	projections []*registeredProjection
+}
+
+type registeredProjection struct {
+	name  string
+	apply ApplyFunc
+	// Index of next event to apply
+	applied int
+	// Set once projection fails with isolate-policy
+	err error
+}
+
+// CoordinatorCfg is config for Coordinator.
+type CoordinatorCfg struct {
+	Log       logger.Logger       `validate:"nonnil"`
+	EventRepo eventutil.EventRepo `validate:"nonnil"`
+	// Events before this index are considered to
+	// be already applied to registered projections.
+	StartIndex int `validate:"min=0"`
+	// Optional, defaults to FailurePolicyIsolate.
+	FailurePolicy FailurePolicy
+}
+
+// ProjectionStatus is hydration-status of a projection.
+type ProjectionStatus struct {
+	// Number of events applied, including
+	// events before start-index.
+	Applied int
+	// Set if projection was isolated after an error.
+	Err error
+}
+
+// NewCoordinator validates provided config
+// and creates new instance of Coordinator.
+func NewCoordinator(cfg *CoordinatorCfg) (*Coordinator, error) {
+	err := validator.Validate(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error validating config")
+	}
+	failurePolicy := cfg.FailurePolicy
+	switch failurePolicy {
+	case "":
+		failurePolicy = FailurePolicyIsolate
+	case FailurePolicyIsolate, FailurePolicyHalt:
+	default:
+		return nil, fmt.Errorf("invalid failure-policy: %s", failurePolicy)
+	}
+
+	return &Coordinator{
+		log:           cfg.Log,
+		eventRepo:     cfg.EventRepo,
+		failurePolicy: failurePolicy,
+
+		lock:        &sync.Mutex{},
+		index:       cfg.StartIndex,
+		projections: make([]*registeredProjection, 0),
+	}, nil
+}
+
+// Register adds a projection to be hydrated. Projection
+// receives events from coordinator's current index.
+func (c *Coordinator) Register(name string, apply ApplyFunc) error {
+	if name == "" {
+		return errors.New("projection-name cannot be blank")
+	}
+	if apply == nil {
+		return errors.New("apply-func is nil")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, p := range c.projections {
+		if p.name == name {
+			return fmt.Errorf("projection already registered: %s", name)
+		}
+	}
+	c.projections = append(c.projections, &registeredProjection{
+		name:    name,
+		apply:   apply,
+		applied: c.index,
+	})
+	return nil
+}
+
+// Hydrate reads new events from event-repo once, and
+// applies these to all registered projections in order.
+// Projection-errors are handled as per failure-policy.
+func (c *Coordinator) Hydrate() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.log.Tracef("Fetching events from event-repo")
+	events, err := c.eventRepo.FetchByIndex(c.index)
+	if err != nil {
+		return errors.Wrap(err, "error getting events from event-repo")
+	}
+	c.log.Tracef("Fetched %d event(s) from event-repo", len(events))
+
+	for i, event := range events {
+		eventIndex := c.index + i
+		for _, p := range c.projections {
+			if p.err != nil || p.applied > eventIndex {
+				continue
+			}
+
+			err := p.apply(event)
+			if err == nil {
+				p.applied++
+				continue
+			}
+			err = errors.Wrapf(err, "error applying event to projection: %s", p.name)
+			if c.failurePolicy == FailurePolicyHalt {
+				c.index = eventIndex
+				return err
+			}
+			c.log.Errorf(
+				"[EventID: %s]: Isolating failed projection: %s", event.ID(), err,
+			)
+			p.err = err
+		}
+	}
+	c.index += len(events)
+	return nil
+}
+
+// Status returns hydration-status of projection.
+func (c *Coordinator) Status(name string) (ProjectionStatus, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, p := range c.projections {
+		if p.name == name {
+			return ProjectionStatus{
+				Applied: p.applied,
+				Err:     p.err,
+			}, nil
+		}
+	}
+	return ProjectionStatus{}, fmt.Errorf("projection not registered: %s", name)
+}
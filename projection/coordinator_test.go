@@ -0,0 +1,310 @@
+package projection_test
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/projection"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+// countingEventRepo is an in-memory
+// event-repo which counts reads by index.
+type countingEventRepo struct {
+	eventutil.EventRepo
+	lock    *sync.Mutex
+	events  []model.Event
+	fetches int
+}
+
+func newCountingEventRepo(tb testing.TB, numEvents int) *countingEventRepo {
+	tb.Helper()
+
+	repo := &countingEventRepo{
+		lock:   &sync.Mutex{},
+		events: make([]model.Event, 0, numEvents),
+	}
+	for i := 0; i < numEvents; i++ {
+		repo.add(tb, strconv.Itoa(i))
+	}
+	return repo
+}
+
+func (r *countingEventRepo) add(tb testing.TB, aggID string) {
+	tb.Helper()
+
+	event, err := testsupport.NewEventBuilder().WithAggregateID(aggID).Build()
+	if err != nil {
+		tb.Fatalf("error building event: %s", err)
+	}
+	r.lock.Lock()
+	r.events = append(r.events, event)
+	r.lock.Unlock()
+}
+
+func (r *countingEventRepo) FetchByIndex(index int) ([]model.Event, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.fetches++
+	events := make([]model.Event, len(r.events)-index)
+	copy(events, r.events[index:])
+	return events, nil
+}
+
+func newCoordinator(
+	tb testing.TB,
+	eventRepo eventutil.EventRepo,
+	policy projection.FailurePolicy,
+) *projection.Coordinator {
+	tb.Helper()
+
+	coordinator, err := projection.NewCoordinator(&projection.CoordinatorCfg{
+		Log:           logger.NewStdLogger("Coordinator"),
+		EventRepo:     eventRepo,
+		FailurePolicy: policy,
+	})
+	if err != nil {
+		tb.Fatalf("error creating coordinator: %s", err)
+	}
+	return coordinator
+}
+
+// recorder returns an apply-func which records
+// aggregate-ids of applied events, and fails
+// for events with aggregate-id failOn.
+func recorder(applied *[]string, failOn string) projection.ApplyFunc {
+	return func(event model.Event) error {
+		if event.AggregateID() == failOn {
+			return errors.New("projection-failure")
+		}
+		*applied = append(*applied, event.AggregateID())
+		return nil
+	}
+}
+
+func TestCoordinatorRegister(t *testing.T) {
+	coordinator := newCoordinator(t, newCountingEventRepo(t, 0), "")
+	noop := func(model.Event) error {
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		projNm  string
+		apply   projection.ApplyFunc
+		wantErr bool
+	}{
+		{name: "valid projection", projNm: "proj", apply: noop},
+		{name: "duplicate name", projNm: "proj", apply: noop, wantErr: true},
+		{name: "blank name", projNm: "", apply: noop, wantErr: true},
+		{name: "nil apply-func", projNm: "proj2", apply: nil, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := coordinator.Register(test.projNm, test.apply)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error: %t, got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewCoordinatorInvalidPolicy(t *testing.T) {
+	_, err := projection.NewCoordinator(&projection.CoordinatorCfg{
+		Log:           logger.NewStdLogger("Coordinator"),
+		EventRepo:     newCountingEventRepo(t, 0),
+		FailurePolicy: "unknown",
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid failure-policy")
+	}
+}
+
+func TestCoordinatorHydrateSingleRead(t *testing.T) {
+	eventRepo := newCountingEventRepo(t, 3)
+	coordinator := newCoordinator(t, eventRepo, "")
+
+	applied := make([][]string, 3)
+	for i := range applied {
+		err := coordinator.Register(fmt.Sprintf("proj%d", i), recorder(&applied[i], ""))
+		if err != nil {
+			t.Fatalf("error registering projection: %s", err)
+		}
+	}
+
+	err := coordinator.Hydrate()
+	if err != nil {
+		t.Fatalf("error hydrating: %s", err)
+	}
+	eventRepo.add(t, "3")
+	err = coordinator.Hydrate()
+	if err != nil {
+		t.Fatalf("error hydrating: %s", err)
+	}
+
+	if eventRepo.fetches != 2 {
+		t.Errorf("expected 2 fetches, got: %d", eventRepo.fetches)
+	}
+	want := []string{"0", "1", "2", "3"}
+	for i, got := range applied {
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("projection %d: expected applied: %v, got: %v", i, want, got)
+		}
+	}
+}
+
+func TestCoordinatorIsolatePolicy(t *testing.T) {
+	eventRepo := newCountingEventRepo(t, 4)
+	coordinator := newCoordinator(t, eventRepo, projection.FailurePolicyIsolate)
+
+	var failingApplied, healthyApplied []string
+	err := coordinator.Register("failing", recorder(&failingApplied, "1"))
+	if err != nil {
+		t.Fatalf("error registering projection: %s", err)
+	}
+	err = coordinator.Register("healthy", recorder(&healthyApplied, ""))
+	if err != nil {
+		t.Fatalf("error registering projection: %s", err)
+	}
+
+	err = coordinator.Hydrate()
+	if err != nil {
+		t.Fatalf("expected no error with isolate-policy, got: %s", err)
+	}
+
+	if fmt.Sprint(failingApplied) != "[0]" {
+		t.Errorf("expected failed projection to stop after event 0, got: %v", failingApplied)
+	}
+	if fmt.Sprint(healthyApplied) != "[0 1 2 3]" {
+		t.Errorf("expected healthy projection to apply all events, got: %v", healthyApplied)
+	}
+
+	failingStatus, err := coordinator.Status("failing")
+	if err != nil {
+		t.Fatalf("error getting status: %s", err)
+	}
+	if failingStatus.Err == nil || failingStatus.Applied != 1 {
+		t.Errorf("unexpected failed-projection status: %+v", failingStatus)
+	}
+	healthyStatus, err := coordinator.Status("healthy")
+	if err != nil {
+		t.Fatalf("error getting status: %s", err)
+	}
+	if healthyStatus.Err != nil || healthyStatus.Applied != 4 {
+		t.Errorf("unexpected healthy-projection status: %+v", healthyStatus)
+	}
+
+	// Isolated projection receives no further events
+	eventRepo.add(t, "4")
+	err = coordinator.Hydrate()
+	if err != nil {
+		t.Fatalf("error hydrating: %s", err)
+	}
+	if fmt.Sprint(failingApplied) != "[0]" {
+		t.Errorf("expected isolated projection to receive no events, got: %v", failingApplied)
+	}
+	if fmt.Sprint(healthyApplied) != "[0 1 2 3 4]" {
+		t.Errorf("expected healthy projection to apply new event, got: %v", healthyApplied)
+	}
+}
+
+func TestCoordinatorHaltPolicy(t *testing.T) {
+	eventRepo := newCountingEventRepo(t, 3)
+	coordinator := newCoordinator(t, eventRepo, projection.FailurePolicyHalt)
+
+	failOn := "1"
+	var firstApplied, secondApplied []string
+	err := coordinator.Register("first", recorder(&firstApplied, ""))
+	if err != nil {
+		t.Fatalf("error registering projection: %s", err)
+	}
+	err = coordinator.Register("second", func(event model.Event) error {
+		return recorder(&secondApplied, failOn)(event)
+	})
+	if err != nil {
+		t.Fatalf("error registering projection: %s", err)
+	}
+
+	err = coordinator.Hydrate()
+	if err == nil {
+		t.Fatal("expected error with halt-policy")
+	}
+	if fmt.Sprint(firstApplied) != "[0 1]" || fmt.Sprint(secondApplied) != "[0]" {
+		t.Fatalf("unexpected applied events: %v, %v", firstApplied, secondApplied)
+	}
+
+	// Retry doesn't re-apply events to projections
+	// which already applied those.
+	failOn = ""
+	err = coordinator.Hydrate()
+	if err != nil {
+		t.Fatalf("error hydrating: %s", err)
+	}
+	if fmt.Sprint(firstApplied) != "[0 1 2]" {
+		t.Errorf("expected first projection to apply each event once, got: %v", firstApplied)
+	}
+	if fmt.Sprint(secondApplied) != "[0 1 2]" {
+		t.Errorf("expected second projection to resume from failed event, got: %v", secondApplied)
+	}
+}
+
+const (
+	benchProjections = 4
+	benchEvents      = 50000
+)
+
+func benchApply(model.Event) error {
+	return nil
+}
+
+// BenchmarkCoordinatorHydrate hydrates all
+// projections with a single read of events.
+func BenchmarkCoordinatorHydrate(b *testing.B) {
+	eventRepo := newCountingEventRepo(b, benchEvents)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		coordinator := newCoordinator(b, eventRepo, "")
+		for p := 0; p < benchProjections; p++ {
+			err := coordinator.Register(fmt.Sprintf("proj%d", p), benchApply)
+			if err != nil {
+				b.Fatalf("error registering projection: %s", err)
+			}
+		}
+		err := coordinator.Hydrate()
+		if err != nil {
+			b.Fatalf("error hydrating: %s", err)
+		}
+	}
+	b.ReportMetric(float64(eventRepo.fetches)/float64(b.N), "fetches/op")
+}
+
+// BenchmarkIndependentHydrate hydrates each projection
+// with its own read of events, for comparison.
+func BenchmarkIndependentHydrate(b *testing.B) {
+	eventRepo := newCountingEventRepo(b, benchEvents)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for p := 0; p < benchProjections; p++ {
+			coordinator := newCoordinator(b, eventRepo, "")
+			err := coordinator.Register(fmt.Sprintf("proj%d", p), benchApply)
+			if err != nil {
+				b.Fatalf("error registering projection: %s", err)
+			}
+			err = coordinator.Hydrate()
+			if err != nil {
+				b.Fatalf("error hydrating: %s", err)
+			}
+		}
+	}
+	b.ReportMetric(float64(eventRepo.fetches)/float64(b.N), "fetches/op")
+}
@@ -0,0 +1,4 @@
+// Package projection provides coordinated hydration
+// of multiple projections (read-models) from a single
+// event-repo.
+package projection
@@ -0,0 +1,144 @@
+package testsupport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+)
+
+// MsgPredicate matches a message received on Bus.
+type MsgPredicate func(msg interface{}) bool
+
+// BusRecorder subscribes to specified actions on
+// Bus and records all messages received on those.
+// Recorded messages can be inspected using #Messages
+// or waited upon using #WaitFor.
+// Use #NewBusRecorder to create new instance.
+type BusRecorder struct {
+	bus  eventutil.Bus
+	subs map[string]<-chan interface{}
+
+	msgs map[string][]interface{}
+	// Closed and replaced every time a
+	// message is recorded, to wake waiters.
+	notify chan struct{}
+	lock   *sync.Mutex
+
+	wg *sync.WaitGroup
+}
+
+// NewBusRecorder creates new instance of BusRecorder
+// and subscribes to provided actions on Bus.
+// #Stop must be called once recorder is no longer needed.
+func NewBusRecorder(bus eventutil.Bus, actions ...string) (*BusRecorder, error) {
+	if bus == nil {
+		return nil, errors.New("bus is nil")
+	}
+
+	r := &BusRecorder{
+		bus:  bus,
+		subs: make(map[string]<-chan interface{}),
+
+		msgs:   make(map[string][]interface{}),
+		notify: make(chan struct{}),
+		lock:   &sync.Mutex{},
+
+		wg: &sync.WaitGroup{},
+	}
+
+	for _, action := range actions {
+		if _, exists := r.subs[action]; exists {
+			continue
+		}
+		sub, err := bus.Subscribe(action)
+		if err != nil {
+			r.Stop()
+			return nil, errors.Wrapf(err, "error subscribing to action: %s", action)
+		}
+		r.subs[action] = sub
+
+		r.wg.Add(1)
+		go r.record(action, sub)
+	}
+	return r, nil
+}
+
+func (r *BusRecorder) record(action string, sub <-chan interface{}) {
+	defer r.wg.Done()
+
+	for msg := range sub {
+		r.lock.Lock()
+		r.msgs[action] = append(r.msgs[action], msg)
+		close(r.notify)
+		r.notify = make(chan struct{})
+		r.lock.Unlock()
+	}
+}
+
+// Messages returns copy of all messages
+// recorded for action, in received order.
+func (r *BusRecorder) Messages(action string) []interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	msgs := make([]interface{}, len(r.msgs[action]))
+	copy(msgs, r.msgs[action])
+	return msgs
+}
+
+// WaitFor waits until a message matching predicate is
+// recorded for action, and returns the first such message.
+// Messages recorded before this call are also considered.
+// A nil predicate matches any message.
+func (r *BusRecorder) WaitFor(
+	action string,
+	predicate MsgPredicate,
+	timeout time.Duration,
+) (interface{}, error) {
+	if _, exists := r.subs[action]; !exists {
+		return nil, fmt.Errorf("recorder is not subscribed to action: %s", action)
+	}
+	if predicate == nil {
+		predicate = func(interface{}) bool {
+			return true
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	checked := 0
+	for {
+		r.lock.Lock()
+		msgs := r.msgs[action]
+		notify := r.notify
+		r.lock.Unlock()
+
+		for ; checked < len(msgs); checked++ {
+			if predicate(msgs[checked]) {
+				return msgs[checked], nil
+			}
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, fmt.Errorf("timed-out waiting for message on action: %s", action)
+		}
+	}
+}
+
+// Stop unsubscribes recorder from all actions.
+// Recorded messages remain available.
+func (r *BusRecorder) Stop() {
+	for action, sub := range r.subs {
+		// Errors if bus was already terminated, in which
+		// case the subscription is already closed.
+		_ = r.bus.Unsubscribe(sub, action)
+	}
+	r.wg.Wait()
+}
@@ -0,0 +1,86 @@
+package testsupport_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/logger"
+	"github.com/Jaskaranbir/es-bank-account/model"
+	"github.com/Jaskaranbir/es-bank-account/testsupport"
+)
+
+func TestBusRecorderWaitFor(t *testing.T) {
+	bus, err := eventutil.NewMemoryBus(logger.NewStdLogger("EventBus"))
+	if err != nil {
+		t.Fatalf("error creating bus: %s", err)
+	}
+	defer bus.Terminate()
+
+	action := testsupport.FixtureEvent.String()
+	recorder, err := testsupport.NewBusRecorder(bus, action)
+	if err != nil {
+		t.Fatalf("error creating recorder: %s", err)
+	}
+	defer recorder.Stop()
+
+	aggIDs := []string{"1", "2", "3"}
+	for _, aggID := range aggIDs {
+		event, err := testsupport.NewEventBuilder().
+			WithAggregateID(aggID).
+			Build()
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		err = bus.Publish(event)
+		if err != nil {
+			t.Fatalf("error publishing event: %s", err)
+		}
+	}
+
+	msg, err := recorder.WaitFor(action, func(msg interface{}) bool {
+		return msg.(model.Event).AggregateID() == "2"
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.(model.Event).AggregateID() != "2" {
+		t.Fatalf("expected matching event, got %+v", msg)
+	}
+
+	_, err = recorder.WaitFor(action, func(msg interface{}) bool {
+		return msg.(model.Event).AggregateID() == "4"
+	}, 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected time-out waiting for unmatched event")
+	}
+
+	_, err = recorder.WaitFor("unsubscribed-action", nil, time.Second)
+	if err == nil {
+		t.Fatal("expected error waiting on unsubscribed action")
+	}
+
+	msgs := recorder.Messages(action)
+	if len(msgs) != len(aggIDs) {
+		t.Fatalf("expected %d recorded messages, got %d", len(aggIDs), len(msgs))
+	}
+}
+
+func TestTxnBuilderCreateTxnReq(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		expected string
+	}{
+		{amount: 100, expected: "$100.00"},
+		{amount: -33.47, expected: "-$33.47"},
+	}
+
+	for _, test := range tests {
+		req := testsupport.NewTxnBuilder().
+			WithLoadAmount(test.amount).
+			CreateTxnReq()
+		if req.LoadAmount != test.expected {
+			t.Fatalf("expected load-amount %s, got %s", test.expected, req.LoadAmount)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package testsupport
+
+import (
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+)
+
+// FakeClock is a clock.Clock which only
+// moves forward when explicitly advanced.
+type FakeClock = clock.FakeClock
+
+// NewFakeClock creates new instance
+// of FakeClock set to provided time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return clock.NewFakeClock(now)
+}
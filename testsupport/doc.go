@@ -0,0 +1,7 @@
+// Package testsupport contains utilities for testing
+// against this module's components using plain
+// "testing"-style tests, without requiring Ginkgo/Gomega.
+//
+// Exported types and functions in this package
+// are considered stable for external consumers.
+package testsupport
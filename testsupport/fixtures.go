@@ -0,0 +1,186 @@
+package testsupport
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	globalcfg "github.com/Jaskaranbir/es-bank-account/config"
+	"github.com/Jaskaranbir/es-bank-account/domain/txn"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// Defaults used by fixture-builders.
+const (
+	FixtureTxnID      = "1"
+	FixtureCustomerID = "1"
+	FixtureLoadAmount = 100
+
+	FixtureAggregateID = "1"
+	FixtureEvent       = model.EventAction("testEvent")
+	FixtureCmd         = model.CmdAction("testCmd")
+	FixtureData        = "test-data"
+)
+
+// FixtureTime is default time used by fixture-builders.
+var FixtureTime = time.Date(2000, 1, 5, 0, 0, 1, 0, time.UTC)
+
+// TxnBuilder builds valid transaction-fixtures, as
+// model.Transaction or as equivalent txn.CreateTxnReq.
+// Use #NewTxnBuilder to create new instance.
+type TxnBuilder struct {
+	txn model.Transaction
+}
+
+// NewTxnBuilder creates new instance of
+// TxnBuilder with valid default values.
+func NewTxnBuilder() *TxnBuilder {
+	return &TxnBuilder{
+		txn: model.Transaction{
+			ID:         FixtureTxnID,
+			CustomerID: FixtureCustomerID,
+			LoadAmount: FixtureLoadAmount,
+			Time:       FixtureTime,
+		},
+	}
+}
+
+// WithID sets transaction-id.
+func (b *TxnBuilder) WithID(id string) *TxnBuilder {
+	b.txn.ID = id
+	return b
+}
+
+// WithCustomerID sets customer-id.
+func (b *TxnBuilder) WithCustomerID(customerID string) *TxnBuilder {
+	b.txn.CustomerID = customerID
+	return b
+}
+
+// WithLoadAmount sets load-amount.
+// Negative amounts are withdrawals.
+func (b *TxnBuilder) WithLoadAmount(amount float64) *TxnBuilder {
+	b.txn.LoadAmount = amount
+	return b
+}
+
+// WithTime sets transaction-time.
+func (b *TxnBuilder) WithTime(t time.Time) *TxnBuilder {
+	b.txn.Time = t.UTC()
+	return b
+}
+
+// WithIsTest marks transaction as test-transaction.
+func (b *TxnBuilder) WithIsTest(isTest bool) *TxnBuilder {
+	b.txn.IsTest = isTest
+	return b
+}
+
+// Transaction returns built model.Transaction.
+func (b *TxnBuilder) Transaction() model.Transaction {
+	return b.txn
+}
+
+// CreateTxnReq returns built transaction
+// as a txn.CreateTxnReq, formatted the same
+// way as requests are read from input.
+func (b *TxnBuilder) CreateTxnReq() txn.CreateTxnReq {
+	loadAmount := fmt.Sprintf("$%.2f", math.Abs(b.txn.LoadAmount))
+	if b.txn.LoadAmount < 0 {
+		loadAmount = "-" + loadAmount
+	}
+
+	return txn.CreateTxnReq{
+		ID:         b.txn.ID,
+		CustomerID: b.txn.CustomerID,
+		LoadAmount: loadAmount,
+		Time:       b.txn.Time.Format(globalcfg.TxnRequestTimeFmt),
+		TimeFmt:    globalcfg.TxnRequestTimeFmt,
+		IsTest:     b.txn.IsTest,
+	}
+}
+
+// EventBuilder builds valid model.Event fixtures.
+// Use #NewEventBuilder to create new instance.
+type EventBuilder struct {
+	cfg model.EventCfg
+}
+
+// NewEventBuilder creates new instance of
+// EventBuilder with valid default values.
+func NewEventBuilder() *EventBuilder {
+	return &EventBuilder{
+		cfg: model.EventCfg{
+			AggregateID: FixtureAggregateID,
+			Action:      FixtureEvent,
+			Data:        []byte(FixtureData),
+		},
+	}
+}
+
+// WithAggregateID sets aggregate-id.
+func (b *EventBuilder) WithAggregateID(aggID string) *EventBuilder {
+	b.cfg.AggregateID = aggID
+	return b
+}
+
+// WithCausationID sets causation-id.
+func (b *EventBuilder) WithCausationID(id string) *EventBuilder {
+	b.cfg.CausationID = id
+	return b
+}
+
+// WithCausationKey sets causation-key.
+func (b *EventBuilder) WithCausationKey(key string) *EventBuilder {
+	b.cfg.CausationKey = key
+	return b
+}
+
+// WithCorrelationKey sets correlation-key.
+func (b *EventBuilder) WithCorrelationKey(key string) *EventBuilder {
+	b.cfg.CorrelationKey = key
+	return b
+}
+
+// WithSource sets source of event.
+func (b *EventBuilder) WithSource(source string) *EventBuilder {
+	b.cfg.Source = source
+	return b
+}
+
+// WithAction sets event-action.
+func (b *EventBuilder) WithAction(action model.EventAction) *EventBuilder {
+	b.cfg.Action = action
+	return b
+}
+
+// WithTime sets event-time.
+func (b *EventBuilder) WithTime(t time.Time) *EventBuilder {
+	b.cfg.Time = t
+	return b
+}
+
+// WithData sets event-data. Data which is not
+// bytes is json-marshalled by model.NewEvent.
+func (b *EventBuilder) WithData(data interface{}) *EventBuilder {
+	b.cfg.Data = data
+	return b
+}
+
+// WithIsReplay marks event as replayed.
+func (b *EventBuilder) WithIsReplay(isReplay bool) *EventBuilder {
+	b.cfg.IsReplay = isReplay
+	return b
+}
+
+// WithPriority sets event-priority.
+func (b *EventBuilder) WithPriority(priority int) *EventBuilder {
+	b.cfg.Priority = priority
+	return b
+}
+
+// Build creates event from builder values.
+func (b *EventBuilder) Build() (model.Event, error) {
+	cfg := b.cfg
+	return model.NewEvent(&cfg)
+}
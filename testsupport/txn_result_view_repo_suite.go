@@ -0,0 +1,211 @@
+package testsupport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/domain/accountview"
+)
+
+// Number of concurrent writers, and entries
+// inserted by each writer, in concurrency-tests.
+const (
+	conformanceWriters          = 8
+	conformanceEntriesPerWriter = 50
+)
+
+// TxnResultViewRepoSuite runs conformance-tests for contract
+// of accountview.TxnResultViewRepo against repos created by
+// factory. Factory must return a new, empty repo on every call,
+// which serializes entries as one JSON-line per entry (test-
+// transactions are not inserted, so repos may exclude those).
+func TxnResultViewRepoSuite(t *testing.T, factory func() accountview.TxnResultViewRepo) {
+	t.Run("is empty on creation", func(t *testing.T) {
+		repo := factory()
+		if repo.Index() != 0 {
+			t.Fatalf("expected index 0, got %d", repo.Index())
+		}
+		if repo.Serialized() != "" {
+			t.Fatalf("expected empty serialized results, got %q", repo.Serialized())
+		}
+	})
+
+	t.Run("serializes entries in insertion order", func(t *testing.T) {
+		repo := factory()
+		entries := resultEntries("w", 5)
+		for _, entry := range entries {
+			insertResult(t, repo, entry)
+		}
+
+		serialized := parseSerializedResults(t, repo.Serialized())
+		if len(serialized) != len(entries) {
+			t.Fatalf("expected %d entries, got %d", len(entries), len(serialized))
+		}
+		for i, entry := range entries {
+			if serialized[i] != entry {
+				t.Fatalf("expected entry %+v at position %d, got %+v", entry, i, serialized[i])
+			}
+		}
+	})
+
+	t.Run("increments index by one per entry", func(t *testing.T) {
+		repo := factory()
+		for i, entry := range resultEntries("w", 5) {
+			insertResult(t, repo, entry)
+			if repo.Index() != i+1 {
+				t.Fatalf("expected index %d after %d entries, got %d", i+1, i+1, repo.Index())
+			}
+		}
+	})
+
+	t.Run("has no leading or trailing newlines", func(t *testing.T) {
+		repo := factory()
+		insertResult(t, repo, resultEntries("w", 1)[0])
+		serialized := repo.Serialized()
+		if strings.Contains(serialized, "\n") {
+			t.Fatalf("expected single line for single entry, got %q", serialized)
+		}
+
+		insertResult(t, repo, resultEntries("x", 1)[0])
+		serialized = repo.Serialized()
+		if strings.HasPrefix(serialized, "\n") || strings.HasSuffix(serialized, "\n") {
+			t.Fatalf("expected no leading/trailing newline, got %q", serialized)
+		}
+		if strings.Count(serialized, "\n") != 1 {
+			t.Fatalf("expected entries delimited by a single newline, got %q", serialized)
+		}
+	})
+
+	t.Run("removes results of customer only", func(t *testing.T) {
+		repo := factory()
+		for _, writer := range []string{"w", "x", "y"} {
+			for _, entry := range resultEntries(writer, 3) {
+				insertResult(t, repo, entry)
+			}
+		}
+
+		err := repo.RemoveCustomer("x")
+		if err != nil {
+			t.Fatalf("error removing customer: %s", err)
+		}
+		if repo.Index() != 6 {
+			t.Fatalf("expected index 6 after removing 3 of 9 entries, got %d", repo.Index())
+		}
+		expected := append(resultEntries("w", 3), resultEntries("y", 3)...)
+		serialized := parseSerializedResults(t, repo.Serialized())
+		if len(serialized) != len(expected) {
+			t.Fatalf("expected %d entries, got %d", len(expected), len(serialized))
+		}
+		for i, entry := range expected {
+			if serialized[i] != entry {
+				t.Fatalf("expected entry %+v at position %d, got %+v", entry, i, serialized[i])
+			}
+		}
+
+		// Unknown customer is a no-op
+		err = repo.RemoveCustomer("z")
+		if err != nil {
+			t.Fatalf("error removing unknown customer: %s", err)
+		}
+		if repo.Index() != 6 {
+			t.Fatalf("expected index 6, got %d", repo.Index())
+		}
+	})
+
+	t.Run("is safe for concurrent inserts", func(t *testing.T) {
+		repo := factory()
+
+		wg := &sync.WaitGroup{}
+		for w := 0; w < conformanceWriters; w++ {
+			wg.Add(1)
+			go func(writer string) {
+				defer wg.Done()
+				lastIndex := 0
+				for _, entry := range resultEntries(writer, conformanceEntriesPerWriter) {
+					err := repo.Insert(entry)
+					if err != nil {
+						t.Errorf("error inserting entry: %s", err)
+						return
+					}
+					index := repo.Index()
+					if index <= lastIndex {
+						t.Errorf("expected index to increase after insert, got %d after %d", index, lastIndex)
+						return
+					}
+					lastIndex = index
+				}
+			}(fmt.Sprintf("w%d", w))
+		}
+		wg.Wait()
+		if t.Failed() {
+			return
+		}
+
+		numEntries := conformanceWriters * conformanceEntriesPerWriter
+		if repo.Index() != numEntries {
+			t.Fatalf("expected index %d, got %d", numEntries, repo.Index())
+		}
+		serialized := parseSerializedResults(t, repo.Serialized())
+		if len(serialized) != numEntries {
+			t.Fatalf("expected %d entries, got %d", numEntries, len(serialized))
+		}
+		// Entries from each writer must be
+		// in order that writer inserted them.
+		next := make(map[string]int)
+		for _, entry := range serialized {
+			expected := resultEntry(entry.CustomerID, next[entry.CustomerID])
+			if entry != expected {
+				t.Fatalf("expected entry %+v, got %+v", expected, entry)
+			}
+			next[entry.CustomerID]++
+		}
+	})
+}
+
+// resultEntries creates entries for writer,
+// using writer as customer-id of entries.
+func resultEntries(writer string, n int) []accountview.TxnResultEntry {
+	entries := make([]accountview.TxnResultEntry, n)
+	for i := range entries {
+		entries[i] = resultEntry(writer, i)
+	}
+	return entries
+}
+
+func resultEntry(writer string, i int) accountview.TxnResultEntry {
+	return accountview.TxnResultEntry{
+		ID:         fmt.Sprintf("%s-%d", writer, i),
+		CustomerID: writer,
+		Accepted:   i%2 == 0,
+	}
+}
+
+func insertResult(t *testing.T, repo accountview.TxnResultViewRepo, entry accountview.TxnResultEntry) {
+	t.Helper()
+
+	err := repo.Insert(entry)
+	if err != nil {
+		t.Fatalf("error inserting entry: %s", err)
+	}
+}
+
+func parseSerializedResults(t *testing.T, serialized string) []accountview.TxnResultEntry {
+	t.Helper()
+
+	entries := make([]accountview.TxnResultEntry, 0)
+	if serialized == "" {
+		return entries
+	}
+	for _, line := range strings.Split(serialized, "\n") {
+		entry := accountview.TxnResultEntry{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("error parsing serialized entry %q: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
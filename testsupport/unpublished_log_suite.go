@@ -0,0 +1,200 @@
+package testsupport
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/eventutil"
+	"github.com/Jaskaranbir/es-bank-account/model"
+)
+
+// UnpublishedLogSuite runs conformance-tests for contract of
+// eventutil.UnpublishedLog against logs created by factory.
+// Factory must return a new, empty log on every call.
+func UnpublishedLogSuite(t *testing.T, factory func() eventutil.UnpublishedLog) {
+	t.Run("is empty on creation", func(t *testing.T) {
+		expectLogEvents(t, factory(), nil)
+	})
+
+	t.Run("returns events in insertion order", func(t *testing.T) {
+		unpubLog := factory()
+		events := logEvents(t, 3)
+		for _, event := range events {
+			insertLogEvent(t, unpubLog, event)
+		}
+		expectLogEvents(t, unpubLog, events)
+	})
+
+	t.Run("returns a copy of events", func(t *testing.T) {
+		unpubLog := factory()
+		events := logEvents(t, 2)
+		for _, event := range events {
+			insertLogEvent(t, unpubLog, event)
+		}
+
+		fetched, err := unpubLog.Events()
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		fetched[0] = fetched[1]
+		expectLogEvents(t, unpubLog, events)
+	})
+
+	t.Run("pops only specified event", func(t *testing.T) {
+		unpubLog := factory()
+		events := logEvents(t, 3)
+		for _, event := range events {
+			insertLogEvent(t, unpubLog, event)
+		}
+
+		popLogEvent(t, unpubLog, events[1])
+		expectLogEvents(t, unpubLog, []model.Event{events[0], events[2]})
+		popLogEvent(t, unpubLog, events[0])
+		popLogEvent(t, unpubLog, events[2])
+		expectLogEvents(t, unpubLog, nil)
+	})
+
+	t.Run("errors popping missing event without altering log", func(t *testing.T) {
+		unpubLog := factory()
+		events := logEvents(t, 2)
+		insertLogEvent(t, unpubLog, events[0])
+
+		err := unpubLog.Pop(events[1])
+		if err == nil {
+			t.Fatal("expected error popping missing event")
+		}
+		expectLogEvents(t, unpubLog, events[:1])
+
+		// Popped events are missing too
+		popLogEvent(t, unpubLog, events[0])
+		err = unpubLog.Pop(events[0])
+		if err == nil {
+			t.Fatal("expected error popping already-popped event")
+		}
+	})
+
+	t.Run("is safe for concurrent producers", func(t *testing.T) {
+		unpubLog := factory()
+		producerEvents := make([][]model.Event, conformanceWriters)
+		for i := range producerEvents {
+			producerEvents[i] = logEvents(t, conformanceEntriesPerWriter)
+		}
+
+		wg := &sync.WaitGroup{}
+		for _, events := range producerEvents {
+			wg.Add(1)
+			go func(events []model.Event) {
+				defer wg.Done()
+				for _, event := range events {
+					err := unpubLog.Insert(event)
+					if err != nil {
+						t.Errorf("error inserting event: %s", err)
+						return
+					}
+				}
+			}(events)
+		}
+		wg.Wait()
+		if t.Failed() {
+			return
+		}
+
+		fetched, err := unpubLog.Events()
+		if err != nil {
+			t.Fatalf("error fetching events: %s", err)
+		}
+		numEvents := conformanceWriters * conformanceEntriesPerWriter
+		if len(fetched) != numEvents {
+			t.Fatalf("expected %d events, got %d", numEvents, len(fetched))
+		}
+		// Events from each producer must be
+		// in order that producer inserted them.
+		position := make(map[string]int)
+		for i, event := range fetched {
+			position[event.ID()] = i
+		}
+		for _, events := range producerEvents {
+			lastPosition := -1
+			for _, event := range events {
+				pos, exists := position[event.ID()]
+				if !exists {
+					t.Fatalf("expected event %s in log", event.ID())
+				}
+				if pos <= lastPosition {
+					t.Fatalf("expected events of a producer in insertion order")
+				}
+				lastPosition = pos
+			}
+		}
+
+		// Concurrently pop all events
+		for _, events := range producerEvents {
+			wg.Add(1)
+			go func(events []model.Event) {
+				defer wg.Done()
+				for _, event := range events {
+					err := unpubLog.Pop(event)
+					if err != nil {
+						t.Errorf("error popping event %s: %s", event.ID(), err)
+						return
+					}
+				}
+			}(events)
+		}
+		wg.Wait()
+		if t.Failed() {
+			return
+		}
+		expectLogEvents(t, unpubLog, nil)
+	})
+}
+
+func logEvents(t *testing.T, n int) []model.Event {
+	t.Helper()
+
+	events := make([]model.Event, n)
+	for i := range events {
+		event, err := NewEventBuilder().Build()
+		if err != nil {
+			t.Fatalf("error creating event: %s", err)
+		}
+		events[i] = event
+	}
+	return events
+}
+
+func insertLogEvent(t *testing.T, unpubLog eventutil.UnpublishedLog, event model.Event) {
+	t.Helper()
+
+	err := unpubLog.Insert(event)
+	if err != nil {
+		t.Fatalf("error inserting event: %s", err)
+	}
+}
+
+func popLogEvent(t *testing.T, unpubLog eventutil.UnpublishedLog, event model.Event) {
+	t.Helper()
+
+	err := unpubLog.Pop(event)
+	if err != nil {
+		t.Fatalf("error popping event: %s", err)
+	}
+}
+
+// expectLogEvents compares events in log by their IDs.
+func expectLogEvents(t *testing.T, unpubLog eventutil.UnpublishedLog, expected []model.Event) {
+	t.Helper()
+
+	events, err := unpubLog.Events()
+	if err != nil {
+		t.Fatalf("error fetching events: %s", err)
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events in log, got %d", len(expected), len(events))
+	}
+	for i := range expected {
+		if events[i].ID() != expected[i].ID() {
+			t.Fatalf("expected event %s at position %d, got %s", expected[i].ID(), i, events[i].ID())
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package trace provides lightweight timing-spans of
+// pipeline-stages, joined into per-transaction traces
+// by their correlation-ID, with pluggable exporters.
+package trace
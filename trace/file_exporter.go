@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+)
+
+// FileExporter is Tracer which writes finished spans
+// to a writer (such as a file) as NDJSON, a span per line.
+// Use #NewFileExporter to create new instance.
+type FileExporter struct {
+	clock clock.Clock
+	lock  *sync.Mutex
+	enc   *json.Encoder
+	err   error
+}
+
+// NewFileExporter creates new instance of FileExporter,
+// timing spans using provided clock (defaults to real-clock).
+func NewFileExporter(w io.Writer, clk clock.Clock) (*FileExporter, error) {
+	if w == nil {
+		return nil, errors.New("writer is nil")
+	}
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	return &FileExporter{
+		clock: clk,
+		lock:  &sync.Mutex{},
+		enc:   json.NewEncoder(w),
+	}, nil
+}
+
+// StartSpan starts a span which is written when ended.
+func (e *FileExporter) StartSpan(name string, correlationID string) Span {
+	return newRecordingSpan(name, correlationID, e.clock.Now, e.write)
+}
+
+func (e *FileExporter) write(span SpanRecord) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// Writer might have a partial line after
+	// an error, so following spans are dropped.
+	if e.err != nil {
+		return
+	}
+	err := e.enc.Encode(span)
+	if err != nil {
+		e.err = errors.Wrap(err, "error writing span")
+	}
+}
+
+// Err returns first error writing spans, if any.
+// Spans ended after an error are dropped.
+func (e *FileExporter) Err() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.err
+}
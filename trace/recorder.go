@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"sync"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+)
+
+// Recorder is Tracer which keeps finished spans in memory,
+// so these can be inspected, such as by tests.
+// Use #NewRecorder to create new instance.
+type Recorder struct {
+	clock clock.Clock
+	lock  *sync.RWMutex
+	spans []SpanRecord
+}
+
+// NewRecorder creates new instance of Recorder, timing
+// spans using provided clock (defaults to real-clock).
+func NewRecorder(clk clock.Clock) *Recorder {
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	return &Recorder{
+		clock: clk,
+		lock:  &sync.RWMutex{},
+		spans: make([]SpanRecord, 0),
+	}
+}
+
+// StartSpan starts a span which is recorded when ended.
+func (r *Recorder) StartSpan(name string, correlationID string) Span {
+	return newRecordingSpan(name, correlationID, r.clock.Now, r.add)
+}
+
+func (r *Recorder) add(span SpanRecord) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// Spans returns finished spans, in order these ended.
+func (r *Recorder) Spans() []SpanRecord {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	spans := make([]SpanRecord, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// Trace returns finished spans with provided
+// correlation-ID, in order these ended.
+func (r *Recorder) Trace(correlationID string) []SpanRecord {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	spans := make([]SpanRecord, 0)
+	for _, span := range r.spans {
+		if span.CorrelationID == correlationID {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
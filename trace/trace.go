@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"sync"
+	"time"
+)
+
+// Names of spans recorded by pipeline-stages
+// for every transaction.
+const (
+	SpanRead       = "read"
+	SpanCreate     = "create"
+	SpanProcess    = "process"
+	SpanViewInsert = "view-insert"
+	SpanWrite      = "write"
+)
+
+// SpanReportWrite is name of span recorded by writer
+// for every write, keyed by its command's correlation.
+const SpanReportWrite = "report-write"
+
+// Tracer starts timing-spans. Spans with same
+// correlation-ID belong to the same trace.
+type Tracer interface {
+	StartSpan(name string, correlationID string) Span
+}
+
+// Span is a timed operation started by Tracer.
+type Span interface {
+	// End marks span as finished. Only the first
+	// call is recorded, so it is safe to call End
+	// early, and again in a deferred call.
+	End()
+}
+
+// SpanRecord is a finished span.
+type SpanRecord struct {
+	Name          string    `json:"name"`
+	CorrelationID string    `json:"correlation_id"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+}
+
+// Duration returns time taken by span.
+func (s SpanRecord) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Noop is Tracer which discards all spans.
+type Noop struct{}
+
+// StartSpan returns a span which does nothing.
+func (Noop) StartSpan(string, string) Span {
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End() {}
+
+// OrNoop returns provided Tracer, or Noop if nil.
+func OrNoop(t Tracer) Tracer {
+	if t == nil {
+		return Noop{}
+	}
+	return t
+}
+
+// IsNoop returns true if provided Tracer is nil
+// or Noop, so callers can skip collecting data
+// only required for tracing.
+func IsNoop(t Tracer) bool {
+	if t == nil {
+		return true
+	}
+	_, isNoop := t.(Noop)
+	return isNoop
+}
+
+// recordingSpan times a span using
+// its tracer's clock, and passes the
+// finished span to its export-func.
+type recordingSpan struct {
+	record SpanRecord
+	now    func() time.Time
+	export func(SpanRecord)
+	once   *sync.Once
+}
+
+func newRecordingSpan(
+	name string,
+	correlationID string,
+	now func() time.Time,
+	export func(SpanRecord),
+) *recordingSpan {
+	return &recordingSpan{
+		record: SpanRecord{
+			Name:          name,
+			CorrelationID: correlationID,
+			Start:         now(),
+		},
+		now:    now,
+		export: export,
+		once:   &sync.Once{},
+	}
+}
+
+func (s *recordingSpan) End() {
+	s.once.Do(func() {
+		s.record.End = s.now()
+		s.export(s.record)
+	})
+}
@@ -0,0 +1,130 @@
+package trace_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Jaskaranbir/es-bank-account/clock"
+	"github.com/Jaskaranbir/es-bank-account/trace"
+)
+
+func TestRecorderRecordsEndedSpans(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(start)
+	recorder := trace.NewRecorder(fakeClock)
+
+	readSpan := recorder.StartSpan(trace.SpanRead, "flow-1")
+	otherSpan := recorder.StartSpan(trace.SpanRead, "flow-2")
+	fakeClock.Advance(time.Second)
+	readSpan.End()
+	// Only first call is recorded
+	fakeClock.Advance(time.Second)
+	readSpan.End()
+
+	createSpan := recorder.StartSpan(trace.SpanCreate, "flow-1")
+	fakeClock.Advance(time.Second)
+	createSpan.End()
+
+	if n := len(recorder.Spans()); n != 2 {
+		t.Fatalf("expected 2 ended spans, got: %d", n)
+	}
+	spans := recorder.Trace("flow-1")
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans in trace, got: %d", len(spans))
+	}
+	expected := []trace.SpanRecord{
+		{
+			Name:          trace.SpanRead,
+			CorrelationID: "flow-1",
+			Start:         start,
+			End:           start.Add(time.Second),
+		},
+		{
+			Name:          trace.SpanCreate,
+			CorrelationID: "flow-1",
+			Start:         start.Add(2 * time.Second),
+			End:           start.Add(3 * time.Second),
+		},
+	}
+	for i, span := range spans {
+		if span != expected[i] {
+			t.Fatalf("expected span %d to be: %+v, got: %+v", i, expected[i], span)
+		}
+	}
+	if d := spans[0].Duration(); d != time.Second {
+		t.Fatalf("expected span-duration of 1s, got: %s", d)
+	}
+
+	otherSpan.End()
+	if n := len(recorder.Trace("flow-2")); n != 1 {
+		t.Fatalf("expected 1 span in other trace, got: %d", n)
+	}
+}
+
+func TestFileExporterWritesNDJSON(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFakeClock(start)
+	output := &bytes.Buffer{}
+	exporter, err := trace.NewFileExporter(output, fakeClock)
+	if err != nil {
+		t.Fatalf("error creating exporter: %s", err)
+	}
+
+	for _, name := range []string{trace.SpanRead, trace.SpanCreate} {
+		span := exporter.StartSpan(name, "flow-1")
+		fakeClock.Advance(time.Second)
+		span.End()
+		span.End()
+	}
+	if err := exporter.Err(); err != nil {
+		t.Fatalf("unexpected exporter-error: %s", err)
+	}
+
+	scanner := bufio.NewScanner(output)
+	spans := make([]trace.SpanRecord, 0)
+	for scanner.Scan() {
+		span := trace.SpanRecord{}
+		err := json.Unmarshal(scanner.Bytes(), &span)
+		if err != nil {
+			t.Fatalf("error unmarshalling line %q: %s", scanner.Text(), err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 lines, got: %d", len(spans))
+	}
+	if spans[1].Name != trace.SpanCreate || !spans[1].Start.Equal(start.Add(time.Second)) {
+		t.Fatalf("unexpected second span: %+v", spans[1])
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestFileExporterKeepsFirstError(t *testing.T) {
+	exporter, err := trace.NewFileExporter(failingWriter{}, nil)
+	if err != nil {
+		t.Fatalf("error creating exporter: %s", err)
+	}
+	exporter.StartSpan(trace.SpanRead, "flow-1").End()
+	if exporter.Err() == nil {
+		t.Fatal("expected exporter-error after failed write")
+	}
+}
+
+func TestNoop(t *testing.T) {
+	if !trace.IsNoop(nil) || !trace.IsNoop(trace.OrNoop(nil)) {
+		t.Fatal("expected nil-tracer to be no-op")
+	}
+	if trace.IsNoop(trace.NewRecorder(nil)) {
+		t.Fatal("expected recorder not to be no-op")
+	}
+	trace.Noop{}.StartSpan(trace.SpanRead, "flow-1").End()
+}
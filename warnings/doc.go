@@ -0,0 +1,5 @@
+// Package warnings collects discrete warnings raised by
+// components during a run, such as skipped input-lines,
+// so these are aggregated in the run's summary instead
+// of only being logged.
+package warnings
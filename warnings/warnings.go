@@ -0,0 +1,171 @@
+package warnings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Codes of warnings, stable across releases,
+// so these can be aggregated and alerted on.
+const (
+	// Message published to an action without subscribers
+	NoSubscribers = "no-subscribers"
+	// Message delivered to a listener's typed subscription
+	// which isn't of its type (see eventutil.SubscribeEvents)
+	TypeMismatch = "type-mismatch"
+	// Malformed input-line skipped by reader
+	SkippedLine = "skipped-line"
+)
+
+// DefaultMaxDetails is used if MemoryCollector
+// is created with a non-positive max-details.
+const DefaultMaxDetails = 5
+
+// Collector collects warnings raised by components.
+// Implementations must be safe for concurrent use.
+type Collector interface {
+	// Add records a warning of code, raised by component,
+	// along with detail of this instance (such as ID of
+	// message it was raised for).
+	Add(component string, code string, detail string)
+}
+
+// Noop is Collector which discards all warnings.
+type Noop struct{}
+
+// Add does nothing.
+func (Noop) Add(string, string, string) {}
+
+// OrNoop returns provided Collector, or Noop if nil.
+func OrNoop(c Collector) Collector {
+	if c == nil {
+		return Noop{}
+	}
+	return c
+}
+
+// Counts are warnings keyed by code.
+type Counts map[string]int64
+
+// Detail is an instance of a warning.
+type Detail struct {
+	Component string `json:"component"`
+	Detail    string `json:"detail"`
+}
+
+// CodeSummary is warnings of a code.
+type CodeSummary struct {
+	Count int64 `json:"count"`
+	// First instances of warning, bounded
+	// by collector's max-details.
+	Details []Detail `json:"details"`
+}
+
+// Summary is warnings keyed by code.
+type Summary map[string]CodeSummary
+
+// Counts returns number of warnings of every code.
+func (s Summary) Counts() Counts {
+	counts := make(Counts, len(s))
+	for code, codeSummary := range s {
+		counts[code] = codeSummary.Count
+	}
+	return counts
+}
+
+// Codes returns codes in summary, sorted.
+func (s Summary) Codes() []string {
+	codes := make([]string, 0, len(s))
+	for code := range s {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// String renders summary as lines of every code (sorted) and
+// its count, each followed by its details, and number of
+// warnings omitted from details.
+func (s Summary) String() string {
+	lines := make([]string, 0)
+	for _, code := range s.Codes() {
+		codeSummary := s[code]
+		lines = append(lines, fmt.Sprintf("%s: %d", code, codeSummary.Count))
+		for _, detail := range codeSummary.Details {
+			lines = append(lines, fmt.Sprintf("  [%s]: %s", detail.Component, detail.Detail))
+		}
+		if omitted := codeSummary.Count - int64(len(codeSummary.Details)); omitted > 0 {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", omitted))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MemoryCollector is an in-memory Collector, which counts
+// all warnings, but only keeps details of first few of every
+// code, so its memory is bounded by number of codes.
+// Use #NewMemoryCollector to create new instance.
+type MemoryCollector struct {
+	maxDetails int
+
+	lock    *sync.Mutex
+	summary Summary
+}
+
+// NewMemoryCollector creates a new instance of MemoryCollector,
+// which keeps details of first maxDetails warnings of every code.
+// Defaults to DefaultMaxDetails if maxDetails isn't positive.
+func NewMemoryCollector(maxDetails int) *MemoryCollector {
+	if maxDetails <= 0 {
+		maxDetails = DefaultMaxDetails
+	}
+	return &MemoryCollector{
+		maxDetails: maxDetails,
+		lock:       &sync.Mutex{},
+		summary:    make(Summary),
+	}
+}
+
+// Add records a warning of code.
+func (c *MemoryCollector) Add(component string, code string, detail string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	codeSummary := c.summary[code]
+	codeSummary.Count++
+	if len(codeSummary.Details) < c.maxDetails {
+		codeSummary.Details = append(codeSummary.Details, Detail{
+			Component: component,
+			Detail:    detail,
+		})
+	}
+	c.summary[code] = codeSummary
+}
+
+// Counts returns number of warnings of every code so far.
+func (c *MemoryCollector) Counts() Counts {
+	return c.Summary().Counts()
+}
+
+// Summary returns warnings collected so far.
+// Nil if no warnings were collected.
+func (c *MemoryCollector) Summary() Summary {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.summary) == 0 {
+		return nil
+	}
+	summary := make(Summary, len(c.summary))
+	for code, codeSummary := range c.summary {
+		details := make([]Detail, len(codeSummary.Details))
+		copy(details, codeSummary.Details)
+		summary[code] = CodeSummary{
+			Count:   codeSummary.Count,
+			Details: details,
+		}
+	}
+	return summary
+}
@@ -0,0 +1,105 @@
+package warnings_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Jaskaranbir/es-bank-account/warnings"
+)
+
+func TestMemoryCollectorConcurrentAdd(t *testing.T) {
+	const numRoutines = 10
+	const numWarnings = 100
+
+	collector := warnings.NewMemoryCollector(3)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numRoutines; i++ {
+		wg.Add(1)
+		go func(component string) {
+			defer wg.Done()
+			for j := 0; j < numWarnings; j++ {
+				collector.Add(component, warnings.SkippedLine, fmt.Sprintf("line %d", j))
+				collector.Add(component, warnings.NoSubscribers, "action: test")
+			}
+		}(fmt.Sprintf("component-%d", i))
+	}
+	wg.Wait()
+
+	expected := warnings.Counts{
+		warnings.SkippedLine:   numRoutines * numWarnings,
+		warnings.NoSubscribers: numRoutines * numWarnings,
+	}
+	if counts := collector.Counts(); !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected counts %v, got: %v", expected, counts)
+	}
+}
+
+func TestMemoryCollectorBoundsDetails(t *testing.T) {
+	collector := warnings.NewMemoryCollector(2)
+	if summary := collector.Summary(); summary != nil {
+		t.Fatalf("expected nil summary without warnings, got: %v", summary)
+	}
+	for i := 0; i < 5; i++ {
+		collector.Add("reader", warnings.SkippedLine, fmt.Sprintf("line %d", i))
+	}
+	collector.Add("eventBus", warnings.NoSubscribers, "action: test")
+
+	summary := collector.Summary()
+	expected := warnings.Summary{
+		warnings.SkippedLine: {
+			Count: 5,
+			// Only first details are kept
+			Details: []warnings.Detail{
+				{Component: "reader", Detail: "line 0"},
+				{Component: "reader", Detail: "line 1"},
+			},
+		},
+		warnings.NoSubscribers: {
+			Count:   1,
+			Details: []warnings.Detail{{Component: "eventBus", Detail: "action: test"}},
+		},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("expected summary %+v, got: %+v", expected, summary)
+	}
+
+	// Summary is a copy
+	summary[warnings.SkippedLine].Details[0].Detail = "changed"
+	if detail := collector.Summary()[warnings.SkippedLine].Details[0].Detail; detail != "line 0" {
+		t.Fatalf("expected summary to be unaffected by changes to copy, got detail: %s", detail)
+	}
+}
+
+func TestSummaryString(t *testing.T) {
+	collector := warnings.NewMemoryCollector(1)
+	collector.Add("reader", warnings.SkippedLine, "line 1")
+	collector.Add("reader", warnings.SkippedLine, "line 2")
+	collector.Add("reader", warnings.SkippedLine, "line 3")
+	collector.Add("eventBus", warnings.NoSubscribers, "action: test")
+
+	expected := `no-subscribers: 1
+  [eventBus]: action: test
+skipped-line: 3
+  [reader]: line 1
+  ... and 2 more`
+	if rendered := collector.Summary().String(); rendered != expected {
+		t.Fatalf("expected rendered summary:\n%s\ngot:\n%s", expected, rendered)
+	}
+	if rendered := warnings.Summary(nil).String(); rendered != "" {
+		t.Fatalf("expected empty summary to render blank, got: %q", rendered)
+	}
+}
+
+func TestOrNoop(t *testing.T) {
+	if _, isNoop := warnings.OrNoop(nil).(warnings.Noop); !isNoop {
+		t.Fatal("expected Noop for nil collector")
+	}
+	collector := warnings.NewMemoryCollector(0)
+	if warnings.OrNoop(collector) != collector {
+		t.Fatal("expected provided collector")
+	}
+	// Doesn't panic
+	warnings.OrNoop(nil).Add("reader", warnings.SkippedLine, "line 1")
+}